@@ -10,6 +10,7 @@ import (
 	"github.com/spf13/cobra"
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -80,6 +81,80 @@ func main() {
 
 	cmd.Flags().StringArrayVar(&filesToWatch, "files", []string{}, "List of files to watch")
 
+	cmd.AddCommand(&cobra.Command{
+		Use:   "storage-inventory",
+		Short: "Inventory the objects held by the image registry storage",
+		Run: func(cmd *cobra.Command, args []string) {
+			printVersion()
+			kubeconfig, err := rest.InClusterConfig()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := operator.RunStorageInventory(ctx, kubeconfig); err != nil {
+				log.Fatal(err)
+			}
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "storage-sync",
+		Short: "Copy the image registry storage to the target storage of a storage upgrade",
+		Run: func(cmd *cobra.Command, args []string) {
+			printVersion()
+			kubeconfig, err := rest.InClusterConfig()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := operator.RunStorageSync(ctx, kubeconfig); err != nil {
+				log.Fatal(err)
+			}
+		},
+	})
+
+	var migrationFrom []string
+	var migrationTo string
+	var migrationNamespaces []string
+	var migrationRewrite bool
+	migrationCmd := &cobra.Command{
+		Use:   "hostname-migration",
+		Short: "Find image streams and pull secrets referencing former image registry hostnames",
+		Run: func(cmd *cobra.Command, args []string) {
+			printVersion()
+			kubeconfig, err := rest.InClusterConfig()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := operator.RunHostnameMigration(ctx, kubeconfig, migrationFrom, migrationTo, migrationNamespaces, migrationRewrite); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	migrationCmd.Flags().StringArrayVar(&migrationFrom, "from", []string{}, "Former registry hostname")
+	migrationCmd.Flags().StringVar(&migrationTo, "to", "", "Registry hostname references are rewritten to")
+	migrationCmd.Flags().StringArrayVar(&migrationNamespaces, "namespace", []string{}, "Namespace references are rewritten in")
+	migrationCmd.Flags().BoolVar(&migrationRewrite, "rewrite", false, "Replace the former hostnames with the new one in the namespaces")
+	cmd.AddCommand(migrationCmd)
+
+	var routerOpts operator.ShardRouterOptions
+	routerCmd := &cobra.Command{
+		Use:   "shard-router",
+		Short: "Route the image registry requests to the shard serving the repository",
+		Run: func(cmd *cobra.Command, args []string) {
+			printVersion()
+			if err := operator.RunShardRouter(ctx, routerOpts); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routerCmd.Flags().IntVar(&routerOpts.Port, "port", defaults.ContainerPort, "Port to listen on")
+	routerCmd.Flags().StringVar(&routerOpts.CertFile, "tls-cert", "", "Serving certificate")
+	routerCmd.Flags().StringVar(&routerOpts.KeyFile, "tls-key", "", "Serving certificate key")
+	routerCmd.Flags().StringVar(&routerOpts.CAFile, "ca-file", "", "CA the certificates of the shards are verified against")
+	routerCmd.Flags().StringVar(&routerOpts.ServerName, "server-name", "", "Hostname the certificates of the shards are issued for")
+	routerCmd.Flags().StringVar(&routerOpts.DefaultBackend, "default-backend", "", "URL of the shard serving the other repositories")
+	routerCmd.Flags().StringArrayVar(&routerOpts.Shards, "shard", []string{}, "Repository prefix and URL of the shard serving it, as prefix=url")
+	cmd.AddCommand(routerCmd)
+
 	if err := cmd.Execute(); err != nil {
 		klog.Errorf("%v", err)
 		os.Exit(1)
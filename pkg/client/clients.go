@@ -1,6 +1,7 @@
 package client
 
 import (
+	"k8s.io/client-go/dynamic"
 	kubeset "k8s.io/client-go/kubernetes"
 	appsset "k8s.io/client-go/kubernetes/typed/apps/v1"
 	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
@@ -23,4 +24,8 @@ type Clients struct {
 	RBAC   rbacset.RbacV1Interface
 	Batch  batchset.BatchV1Interface
 	Job    jobset.BatchV1Interface
+
+	// Dynamic is used for the resources of other components that have no
+	// typed client, e.g. OVN-Kubernetes EgressIPs.
+	Dynamic dynamic.Interface
 }
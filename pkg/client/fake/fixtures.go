@@ -35,6 +35,7 @@ type FixturesBuilder struct {
 	proxyConfigsIndexer        cache.Indexer
 	infraIndexer               cache.Indexer
 	nodeIndexer                cache.Indexer
+	pvcIndexer                 cache.Indexer
 
 	kClientSet []runtime.Object
 }
@@ -61,6 +62,7 @@ func NewFixturesBuilder() *FixturesBuilder {
 		proxyConfigsIndexer:        cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		infraIndexer:               cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		nodeIndexer:                cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
+		pvcIndexer:                 cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		kClientSet:                 []runtime.Object{},
 	}
 	return factory
@@ -90,6 +92,19 @@ func (f *FixturesBuilder) AddDeployments(objs ...*appsv1.Deployment) *FixturesBu
 	return f
 }
 
+// AddPersistentVolumeClaims adds corev1.PersistentVolumeClaims to the lister
+// cache
+func (f *FixturesBuilder) AddPersistentVolumeClaims(objs ...*corev1.PersistentVolumeClaim) *FixturesBuilder {
+	for _, v := range objs {
+		err := f.pvcIndexer.Add(v)
+		if err != nil {
+			panic(err)
+		}
+		f.kClientSet = append(f.kClientSet, v)
+	}
+	return f
+}
+
 // AddNamespaces adds corev1.Namespaces to the fixture
 func (f *FixturesBuilder) AddNamespaces(objs ...*corev1.Namespace) *FixturesBuilder {
 	for _, v := range objs {
@@ -226,8 +241,10 @@ func (f *FixturesBuilder) BuildListers() *client.Listers {
 			OpenShiftConfig:        corev1listers.NewConfigMapLister(f.configMapsIndexer).ConfigMaps("openshift-config"),
 			OpenShiftConfigManaged: corev1listers.NewConfigMapLister(f.configMapsIndexer).ConfigMaps("openshift-config-managed"),
 			Secrets:                corev1listers.NewSecretLister(f.secretsIndexer).Secrets("openshift-image-registry"),
+			ProxyConfigs:           configv1listers.NewProxyLister(f.proxyConfigsIndexer),
+			Deployments:            appsv1listers.NewDeploymentLister(f.deploymentIndexer).Deployments("openshift-image-registry"),
+			PersistentVolumeClaims: corev1listers.NewPersistentVolumeClaimLister(f.pvcIndexer).PersistentVolumeClaims("openshift-image-registry"),
 		},
-		Deployments:         appsv1listers.NewDeploymentLister(f.deploymentIndexer).Deployments("openshift-image-registry"),
 		Services:            corev1listers.NewServiceLister(f.servicesIndexer).Services("openshift-image-registry"),
 		ConfigMaps:          corev1listers.NewConfigMapLister(f.configMapsIndexer).ConfigMaps("openshift-image-registry"),
 		ServiceAccounts:     corev1listers.NewServiceAccountLister(f.serviceAcctIndexer).ServiceAccounts("openshift-image-registry"),
@@ -235,7 +252,6 @@ func (f *FixturesBuilder) BuildListers() *client.Listers {
 		ClusterRoles:        rbacv1listers.NewClusterRoleLister(f.clusterRolesIndexer),
 		ClusterRoleBindings: rbacv1listers.NewClusterRoleBindingLister(f.clusterRoleBindingsIndexer),
 		RegistryConfigs:     regopv1listers.NewConfigLister(f.registryConfigsIndexer),
-		ProxyConfigs:        configv1listers.NewProxyLister(f.proxyConfigsIndexer),
 	}
 	return listers
 }
@@ -15,10 +15,22 @@ import (
 
 // StorageListers is a set of listers that can be used by storage drivers.
 type StorageListers struct {
-	Infrastructures        configlisters.InfrastructureLister
+	Infrastructures configlisters.InfrastructureLister
+	// FeatureGates is optional, the Default feature set is used when it
+	// is nil.
+	FeatureGates           configlisters.FeatureGateLister
 	OpenShiftConfig        kcorelisters.ConfigMapNamespaceLister
 	OpenShiftConfigManaged kcorelisters.ConfigMapNamespaceLister
 	Secrets                kcorelisters.SecretNamespaceLister
+	// ProxyConfigs is optional, the proxy settings of the environment
+	// are used when it is nil.
+	ProxyConfigs configlisters.ProxyLister
+	// Deployments is optional, it is only used by drivers that follow the
+	// rollouts of the registry.
+	Deployments kappslisters.DeploymentNamespaceLister
+	// PersistentVolumeClaims is optional, it is only used by the PVC
+	// driver to read the claim the registry uses.
+	PersistentVolumeClaims kcorelisters.PersistentVolumeClaimNamespaceLister
 }
 
 func NewStorageListers(
@@ -37,16 +49,15 @@ func NewStorageListers(
 
 type Listers struct {
 	StorageListers
-	Deployments          kappslisters.DeploymentNamespaceLister
 	Services             kcorelisters.ServiceNamespaceLister
 	ConfigMaps           kcorelisters.ConfigMapNamespaceLister
 	ServiceAccounts      kcorelisters.ServiceAccountNamespaceLister
 	PodDisruptionBudgets kpolicylisters.PodDisruptionBudgetNamespaceLister
+	Jobs                 kjoblisters.JobNamespaceLister
 	Routes               routelisters.RouteNamespaceLister
 	ClusterRoles         krbaclisters.ClusterRoleLister
 	ClusterRoleBindings  krbaclisters.ClusterRoleBindingLister
 	RegistryConfigs      regoplisters.ConfigLister
-	ProxyConfigs         configlisters.ProxyLister
 }
 
 type ImagePrunerControllerListers struct {
@@ -59,4 +70,5 @@ type ImagePrunerControllerListers struct {
 	ImagePrunerConfigs  regoplisters.ImagePrunerLister
 	ConfigMaps          kcorelisters.ConfigMapNamespaceLister
 	ImageConfigs        configlisters.ImageLister
+	Namespaces          kcorelisters.NamespaceLister
 }
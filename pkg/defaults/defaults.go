@@ -8,6 +8,27 @@ const (
 	// ImageRegistryName is the name of the image-registry workload resource (deployment)
 	ImageRegistryName = "image-registry"
 
+	// FailoverDeploymentName is the name of the deployment running the
+	// registry replica pinned to the second zone when the registry claims
+	// are spread across zones.
+	FailoverDeploymentName = ImageRegistryName + "-failover"
+
+	// FailureDomainLabel is set on the pods of the failover deployment to
+	// the zone they are pinned to.
+	FailureDomainLabel = "imageregistry.operator.openshift.io/failure-domain"
+
+	// ShardNamePrefix prefixes the names of the deployments and Services
+	// of the registry shards, it is followed by the shard name.
+	ShardNamePrefix = ImageRegistryName + "-shard-"
+
+	// ShardRouterName is the name of the deployment routing the registry
+	// requests to the shard serving the repository.
+	ShardRouterName = ImageRegistryName + "-shard-router"
+
+	// ShardLabel is set on the objects of the registry shards to the shard
+	// name.
+	ShardLabel = "imageregistry.operator.openshift.io/shard"
+
 	// PVCImageRegistryName is the default name of the claim provisioned for PVC backend
 	PVCImageRegistryName = "image-registry-storage"
 
@@ -40,6 +61,32 @@ const (
 	// automatically pulls from other locations, and it is merged into ImageRegistryPrivateConfiguration
 	ImageRegistryPrivateConfigurationUser = "image-registry-private-configuration-user"
 
+	// SwiftTempURLKeySecretName is the name of a secret that is managed by the
+	// registry operator and which holds the temporary URL keys set on the
+	// registry Swift container.
+	SwiftTempURLKeySecretName = "image-registry-swift-temp-url-key"
+
+	// SwiftTempURLKey and SwiftTempURLPreviousKey are the keys under which
+	// the current and the previous temporary URL keys are stored in the
+	// SwiftTempURLKeySecretName secret.
+	SwiftTempURLKey         = "key"
+	SwiftTempURLPreviousKey = "previousKey"
+
+	// SwiftTempURLKeyRotatedAnnotation holds the time at which the Swift
+	// temporary URL key was last generated.
+	SwiftTempURLKeyRotatedAnnotation = "imageregistry.operator.openshift.io/temp-url-key-rotated"
+
+	// HTTPSecretGeneratedAnnotation holds the time at which the operator
+	// last generated the HTTP secret of the registry config.
+	HTTPSecretGeneratedAnnotation = "imageregistry.operator.openshift.io/http-secret-generated"
+
+	// StorageCredentialsRotatedAnnotation holds the time at which the
+	// storage credentials in the ImageRegistryPrivateConfiguration secret
+	// last changed, StorageCredentialsChecksumAnnotation holds the checksum
+	// of these credentials.
+	StorageCredentialsRotatedAnnotation  = "imageregistry.operator.openshift.io/storage-credentials-rotated"
+	StorageCredentialsChecksumAnnotation = "imageregistry.operator.openshift.io/storage-credentials-checksum"
+
 	// ImageRegistryOperatorNamespace is the namespace containing the registry operator
 	// and the registry itself
 	ImageRegistryOperatorNamespace = "openshift-image-registry"
@@ -61,6 +108,11 @@ const (
 	// StorageExists denotes whether or not the registry storage medium exists
 	StorageExists = "StorageExists"
 
+	// OrphanedStorage reports storage left behind by previous installations
+	// of the cluster that was found, and not adopted, when the registry
+	// storage was created.
+	OrphanedStorage = "OrphanedStorage"
+
 	// StorageTagged denotes whether or not the registry storage medium
 	// that we created was tagged correctly
 	StorageTagged = "StorageTagged"
@@ -90,20 +142,190 @@ const (
 	ChecksumOperatorAnnotation     = "imageregistry.operator.openshift.io/checksum"
 	ChecksumOperatorDepsAnnotation = "imageregistry.operator.openshift.io/dependencies-checksum"
 
+	// ChecksumPodTemplateAnnotation holds the checksum of the registry pod
+	// template, it tells apart the changes that roll out the registry.
+	ChecksumPodTemplateAnnotation = "imageregistry.operator.openshift.io/pod-template-checksum"
+
 	SupplementalGroupsAnnotation = "openshift.io/sa.scc.supplemental-groups"
 
+	// StorageRecreatedAnnotation holds the time at which the operator last
+	// recreated a storage that was deleted out-of-band. It is copied into
+	// the registry pod template so the registry is restarted on recreation.
+	StorageRecreatedAnnotation = "imageregistry.operator.openshift.io/storage-recreated"
+
+	// StoragePlanApprovedAnnotation is set on the registry config to
+	// approve the storage provisioning plan with the given checksum, when
+	// plans require an approval.
+	StoragePlanApprovedAnnotation = "imageregistry.operator.openshift.io/storage-plan-approved"
+
+	// StorageUpgradeAnnotation holds the state of the storage upgrade in
+	// progress on the registry config.
+	StorageUpgradeAnnotation = "imageregistry.operator.openshift.io/storage-upgrade"
+
+	// AdoptStorageAnnotation is set to "true" on the registry config to let
+	// the operator adopt, as managed, storage carrying the cluster tag that
+	// was left behind by a previous installation of the cluster.
+	AdoptStorageAnnotation = "imageregistry.operator.openshift.io/adopt-storage"
+
+	// AzureStorageAccountIDAnnotation records on the registry config the
+	// resource ID of the Azure storage account, so the operator notices
+	// the credentials moving to another subscription or resource group.
+	AzureStorageAccountIDAnnotation = "imageregistry.operator.openshift.io/azure-storage-account-id"
+
+	// AzureAccountKeyAnnotation records on the registry config the name of
+	// the Azure storage account key used by the registry, key1 if unset.
+	AzureAccountKeyAnnotation = "imageregistry.operator.openshift.io/azure-account-key"
+
+	// AzureAccountKeyRotatedAnnotation holds the time at which the
+	// registry was last switched to another Azure storage account key.
+	AzureAccountKeyRotatedAnnotation = "imageregistry.operator.openshift.io/azure-account-key-rotated"
+
+	// AzureAccountKeyPendingAnnotation holds the name of the Azure storage
+	// account key the registry no longer uses, it is regenerated once the
+	// registry is rolled out with the other key.
+	AzureAccountKeyPendingAnnotation = "imageregistry.operator.openshift.io/azure-account-key-pending"
+
+	// AzureAccountKeyRolloutAnnotation holds the generations of the
+	// registry deployments, by name, when the registry was switched to
+	// another Azure storage account key. The former key is regenerated
+	// once later generations of all of them are rolled out.
+	AzureAccountKeyRolloutAnnotation = "imageregistry.operator.openshift.io/azure-account-key-rollout"
+
+	// AzureNetworkAccessDeniedAnnotation holds the checksum of the Azure
+	// storage account network rules that denied access to the operator,
+	// they are not applied again until they change.
+	AzureNetworkAccessDeniedAnnotation = "imageregistry.operator.openshift.io/azure-network-access-denied"
+
+	// InternalHostnameAnnotation marks the Services created by the operator
+	// as aliases of the registry hostname.
+	InternalHostnameAnnotation = "imageregistry.operator.openshift.io/internal-hostname"
+
+	// CredentialsExpiryAnnotation can be set on the storage credentials
+	// secret to the RFC 3339 time at which the credentials expire, so it
+	// is reported along with the credentials mode.
+	CredentialsExpiryAnnotation = "imageregistry.operator.openshift.io/credentials-expiry"
+
 	ServiceName           = "image-registry"
 	ServiceAccountName    = "registry"
 	ContainerPort         = 5000
 	HealthzRoute          = "/healthz"
 	HealthzTimeoutSeconds = 5
 
+	// OperatorServiceAccountName is the name of the service account the
+	// operator runs as.
+	OperatorServiceAccountName = "cluster-image-registry-operator"
+
+	// StorageInventoryName is the name of the CronJob that inventories the
+	// registry storage and of the ConfigMap holding its last report.
+	StorageInventoryName = "image-registry-storage-inventory"
+
+	// StorageInventoryReportKey is the key under which the storage inventory
+	// report is kept in the StorageInventoryName config map.
+	StorageInventoryReportKey = "report.json"
+
+	// StorageSyncName is the name of the Job copying the registry storage
+	// to the target storage of a storage upgrade.
+	StorageSyncName = "image-registry-storage-sync"
+
+	// StorageLockName is the name of the Lease held by the Job allowed to
+	// delete objects from the registry storage, e.g. the pruner or a
+	// garbage collection. The registry itself does not take the lock.
+	StorageLockName = "image-registry-storage-lock"
+
+	// StorageLockLabel marks the Jobs of the registry namespace that have
+	// to hold the storage lock to run. They are created suspended and are
+	// resumed by the operator once they hold the lock.
+	StorageLockLabel = "imageregistry.operator.openshift.io/storage-lock"
+
+	// HostnameMigrationName is the prefix of the Jobs looking for references
+	// to former registry hostnames and the name of the ConfigMap holding the
+	// report of the last one.
+	HostnameMigrationName = "image-registry-hostname-migration"
+
+	// HostnameMigrationReportKey is the key under which the hostname
+	// migration report is kept in the HostnameMigrationName config map.
+	HostnameMigrationReportKey = "report.json"
+
+	// EgressIPName is the name of the cluster scoped OVN-Kubernetes
+	// EgressIP assigning egress IPs to the registry pods.
+	EgressIPName = "image-registry"
+
+	// SmokeTestNamespace is the default namespace the image pushed by the
+	// registry smoke test goes to.
+	SmokeTestNamespace = "openshift-image-registry-smoke-test"
+
+	// ConformanceName is the prefix of the Jobs running the OCI
+	// distribution conformance suite against the registry and the name of
+	// the Secret holding the credentials they use.
+	ConformanceName = "image-registry-conformance"
+
+	// ConformanceNamespace is the default namespace the repositories
+	// created by the conformance suite go to.
+	ConformanceNamespace = "openshift-image-registry-conformance"
+
 	ImageConfigName   = "cluster"
 	ClusterConfigName = "cluster-config-v1"
 
 	ServiceCAName = "serviceca"
 	TrustedCAName = "trusted-ca"
 
+	// ReadinessConfigMapName is the name of the config map, in the
+	// openshift-config-managed namespace, reporting whether the registry
+	// is ready to serve images. Operators depending on the registry watch
+	// it to sequence their rollouts.
+	ReadinessConfigMapName = "image-registry-readiness"
+
+	// EffectiveConfigConfigMapName is the name of the config map, in the
+	// operator namespace, documenting the configuration the registry
+	// deployment runs with.
+	EffectiveConfigConfigMapName = "image-registry-effective-config"
+
+	// ManagedObjectsConfigMapName is the name of the config map, in the
+	// operator namespace, holding the inventory of the objects owned by
+	// the operator under the ManagedObjectsKey key.
+	ManagedObjectsConfigMapName = "image-registry-managed-objects"
+	ManagedObjectsKey           = "objects.json"
+
+	// SecretsStatusConfigMapName is the name of the config map, in the
+	// operator namespace, holding the rotation status of the secrets the
+	// registry runs with under the SecretsStatusKey key.
+	SecretsStatusConfigMapName = "image-registry-secrets-status"
+	SecretsStatusKey           = "secrets.json"
+
+	// PrometheusRuleName is the name of the PrometheusRule, in the
+	// operator namespace, holding the registry alerts and recording rules.
+	PrometheusRuleName = "image-registry-operator-rules"
+
+	// UserPrometheusRuleName is the name of the PrometheusRule, in the
+	// operator namespace, holding the rule groups added by the user.
+	UserPrometheusRuleName = "image-registry-user-rules"
+
+	// PrometheusRulesConfigMapName is the name of the config map, in the
+	// operator namespace, where users add their own rule groups, shipped
+	// in the UserPrometheusRuleName PrometheusRule, under the
+	// PrometheusRulesKey key.
+	PrometheusRulesConfigMapName = "image-registry-prometheus-rules"
+	PrometheusRulesKey           = "rules.yaml"
+
+	// RolloutPendingSinceAnnotation records on the registry deployment
+	// since when a rollout is held back to be batched with further
+	// changes.
+	RolloutPendingSinceAnnotation = "imageregistry.operator.openshift.io/rollout-pending-since"
+
+	// RolloutPendingTemplateAnnotation records on the registry deployment
+	// the checksum of the pod template kept while a rollout is held back.
+	// RolloutPendingSinceAnnotation is only taken into account while the
+	// deployment still runs that template.
+	RolloutPendingTemplateAnnotation = "imageregistry.operator.openshift.io/rollout-pending-template"
+
+	// UpdateDiffAnnotation records on the registry deployment the changes
+	// made by the last update of the operator, sensitive values redacted.
+	UpdateDiffAnnotation = "imageregistry.operator.openshift.io/last-update-diff"
+
+	// DeploymentGenerationAnnotation records the generation of the
+	// registry deployment the effective configuration was rendered from.
+	DeploymentGenerationAnnotation = "imageregistry.operator.openshift.io/deployment-generation"
+
 	// OpenShiftConfigNamespace is a namespace with global configuration resources.
 	OpenShiftConfigNamespace = "openshift-config"
 
@@ -118,8 +340,12 @@ const (
 )
 
 var (
-	DeploymentLabels      = map[string]string{"docker-registry": "default"}
-	DeploymentAnnotations = map[string]string{
+	DeploymentLabels = map[string]string{"docker-registry": "default"}
+	// FailoverDeploymentLabels select the pods of the failover deployment.
+	// They do not match the selectors of the registry deployment and of
+	// its pod disruption budget.
+	FailoverDeploymentLabels = map[string]string{"docker-registry": "failover"}
+	DeploymentAnnotations    = map[string]string{
 		"target.workload.openshift.io/management": `{"effect": "PreferredDuringScheduling"}`,
 	}
 )
@@ -0,0 +1,7 @@
+//go:build !standalone
+
+package defaults
+
+// Standalone is true when the operator is built with the standalone tag, see
+// standalone.go.
+const Standalone = false
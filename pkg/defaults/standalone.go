@@ -0,0 +1,11 @@
+//go:build standalone
+
+package defaults
+
+// Standalone is true when the operator is built with the standalone tag, to
+// run on Kubernetes clusters without the OpenShift APIs. The registry is then
+// exposed through Ingresses instead of Routes, and the controllers relying
+// on image streams or on the ClusterOperator API are not started. The
+// config.openshift.io and imageregistry.operator.openshift.io CRDs still
+// have to be installed.
+const Standalone = true
@@ -0,0 +1,143 @@
+package featuregates
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	configapiv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+)
+
+// Gate is the name of an image registry feature gate. The names share the
+// namespace of the cluster FeatureGate resource, so the gates can also be
+// toggled through its CustomNoUpgrade feature set.
+type Gate string
+
+const (
+	// AzurePrivateEndpoint verifies the private endpoint provided by the
+	// user for the Azure storage account.
+	AzurePrivateEndpoint Gate = "ImageRegistryAzurePrivateEndpoint"
+
+	// StorageMigration allows moving the registry contents from a storage
+	// to another.
+	StorageMigration Gate = "ImageRegistryStorageMigration"
+
+	// Sharding allows splitting the registry into several deployments,
+	// each serving the repositories under some prefixes from its own
+	// storage prefix.
+	Sharding Gate = "ImageRegistrySharding"
+)
+
+// defaults holds the known gates along with their state in the Default
+// feature set. Every gate is enabled in the TechPreviewNoUpgrade feature
+// set.
+var defaults = map[Gate]bool{
+	AzurePrivateEndpoint: true,
+	StorageMigration:     false,
+	Sharding:             false,
+}
+
+// Gates holds the state of the image registry feature gates.
+type Gates map[Gate]bool
+
+// Enabled returns true if gate is enabled.
+func (g Gates) Enabled(gate Gate) bool {
+	return g[gate]
+}
+
+// String returns the states of the gates sorted by name, e.g.
+// "ImageRegistrySharding=false, ImageRegistryStorageMigration=true".
+func (g Gates) String() string {
+	states := make([]string, 0, len(g))
+	for gate, enabled := range g {
+		states = append(states, fmt.Sprintf("%s=%t", gate, enabled))
+	}
+	sort.Strings(states)
+	return strings.Join(states, ", ")
+}
+
+// Resolve returns the state of the gates for the cluster feature gate fg,
+// which may be nil, and the per cluster toggles set by the user. The
+// toggles take precedence over the cluster feature gate.
+func Resolve(fg *configapiv1.FeatureGate, toggles map[Gate]bool) (Gates, error) {
+	gates := Gates{}
+	for gate, enabled := range defaults {
+		gates[gate] = enabled
+	}
+
+	if fg != nil {
+		switch fg.Spec.FeatureSet {
+		case configapiv1.TechPreviewNoUpgrade:
+			for gate := range gates {
+				gates[gate] = true
+			}
+		case configapiv1.CustomNoUpgrade:
+			if custom := fg.Spec.CustomNoUpgrade; custom != nil {
+				// The cluster feature gate lists the gates of every
+				// component, the unknown ones are not ours.
+				for _, name := range custom.Enabled {
+					if _, ok := gates[Gate(name)]; ok {
+						gates[Gate(name)] = true
+					}
+				}
+				for _, name := range custom.Disabled {
+					if _, ok := gates[Gate(name)]; ok {
+						gates[Gate(name)] = false
+					}
+				}
+			}
+		}
+	}
+
+	for gate, enabled := range toggles {
+		if _, ok := gates[gate]; !ok {
+			return nil, fmt.Errorf("unknown feature gate %q", gate)
+		}
+		gates[gate] = enabled
+	}
+	return gates, nil
+}
+
+// getToggles returns the featureGates section of the unsupported config
+// overrides.
+func getToggles(cr *imageregistryv1.Config) (map[Gate]bool, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		FeatureGates map[Gate]bool `json:"featureGates,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	return overrides.FeatureGates, nil
+}
+
+// Get returns the state of the gates for cr. The cluster feature gate is
+// read with lister, the Default feature set is used when lister is nil or
+// the cluster has no feature gate.
+func Get(lister configlisters.FeatureGateLister, cr *imageregistryv1.Config) (Gates, error) {
+	var fg *configapiv1.FeatureGate
+	if lister != nil {
+		var err error
+		fg, err = lister.Get("cluster")
+		if kerrors.IsNotFound(err) {
+			fg = nil
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to get the cluster feature gate: %w", err)
+		}
+	}
+
+	toggles, err := getToggles(cr)
+	if err != nil {
+		return nil, err
+	}
+	return Resolve(fg, toggles)
+}
@@ -0,0 +1,87 @@
+package featuregates
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	configapiv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+)
+
+func TestGet(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		selection *configapiv1.FeatureGateSelection
+		overrides string
+		want      string
+		err       string
+	}{
+		{
+			name: "no cluster feature gate",
+			want: "ImageRegistryAzurePrivateEndpoint=true, ImageRegistrySharding=false, ImageRegistryStorageMigration=false",
+		},
+		{
+			name:      "default feature set",
+			selection: &configapiv1.FeatureGateSelection{},
+			want:      "ImageRegistryAzurePrivateEndpoint=true, ImageRegistrySharding=false, ImageRegistryStorageMigration=false",
+		},
+		{
+			name:      "tech preview",
+			selection: &configapiv1.FeatureGateSelection{FeatureSet: configapiv1.TechPreviewNoUpgrade},
+			want:      "ImageRegistryAzurePrivateEndpoint=true, ImageRegistrySharding=true, ImageRegistryStorageMigration=true",
+		},
+		{
+			name: "custom",
+			selection: &configapiv1.FeatureGateSelection{
+				FeatureSet: configapiv1.CustomNoUpgrade,
+				CustomNoUpgrade: &configapiv1.CustomFeatureGates{
+					Enabled:  []string{"ImageRegistrySharding", "SomeOtherGate"},
+					Disabled: []string{"ImageRegistryAzurePrivateEndpoint"},
+				},
+			},
+			want: "ImageRegistryAzurePrivateEndpoint=false, ImageRegistrySharding=true, ImageRegistryStorageMigration=false",
+		},
+		{
+			name:      "overrides take precedence",
+			selection: &configapiv1.FeatureGateSelection{FeatureSet: configapiv1.TechPreviewNoUpgrade},
+			overrides: `{"featureGates":{"ImageRegistryStorageMigration":false}}`,
+			want:      "ImageRegistryAzurePrivateEndpoint=true, ImageRegistrySharding=true, ImageRegistryStorageMigration=false",
+		},
+		{
+			name:      "unknown gate",
+			overrides: `{"featureGates":{"SomeOtherGate":true}}`,
+			err:       `unknown feature gate "SomeOtherGate"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.selection != nil {
+				fg := &configapiv1.FeatureGate{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+				fg.Spec.FeatureGateSelection = *tt.selection
+				if err := indexer.Add(fg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+
+			gates, err := Get(configlisters.NewFeatureGateLister(indexer), cr)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := gates.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -33,6 +33,99 @@ var (
 		},
 		[]string{"storage"},
 	)
+	storageObjects = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_inventory_objects",
+			Help: "Number of blobs found in the registry storage by the last storage inventory",
+		},
+	)
+	storageBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_inventory_bytes",
+			Help: "Total size in bytes of the blobs found in the registry storage by the last storage inventory",
+		},
+	)
+	storageBlobSizes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_inventory_blobs",
+			Help: "Number of blobs found in the registry storage by the last storage inventory, by size. 'size' label holds the upper bound of the size range",
+		},
+		[]string{"size"},
+	)
+	controllerRequeues = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "image_registry_operator_requeues_total",
+			Help: "Number of times the operator requeued a failed sync. 'reason' label holds the class of the error: throttled, auth, notfound, network or other",
+		},
+		[]string{"reason"},
+	)
+	storageVolumeUsedBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_volume_used_bytes",
+			Help: "Bytes used in the volume backing the registry claim",
+		},
+	)
+	storageVolumeCapacityBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_volume_capacity_bytes",
+			Help: "Capacity in bytes of the volume backing the registry claim",
+		},
+	)
+	storageVolumeExpansions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "image_registry_operator_storage_volume_expansions_total",
+			Help: "Total times the operator expanded the registry claim as its volume filled up",
+		},
+	)
+	swiftContainerBytesUsed = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_swift_container_bytes_used",
+			Help: "Bytes used in the registry Swift container",
+		},
+	)
+	swiftContainerObjects = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_swift_container_objects",
+			Help: "Number of objects in the registry Swift container",
+		},
+	)
+	swiftContainerQuotaBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_swift_container_quota_bytes",
+			Help: "Quota in bytes of the registry Swift container, 0 if it has none",
+		},
+	)
+	deprecatedFieldsInUse = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_deprecated_fields_in_use",
+			Help: "Deprecated fields set in the image registry resources. 'resource' label holds the resource type, configs or imagepruners, and 'field' the path of the field",
+		},
+		[]string{"resource", "field"},
+	)
+	storageInventoryTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_inventory_timestamp_seconds",
+			Help: "Unix time at which the last storage inventory completed",
+		},
+	)
+	conformancePassed = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_conformance_passed",
+			Help: "Whether the last run of the OCI distribution conformance suite passed. 1 = passed, 0 = failed",
+		},
+	)
+	conformanceFailedSpecs = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_conformance_failed_specs",
+			Help: "Number of specs of the OCI distribution conformance suite that failed in the last run",
+		},
+	)
+	conformanceTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "image_registry_conformance_timestamp_seconds",
+			Help: "Unix time at which the last run of the OCI distribution conformance suite completed",
+		},
+	)
 )
 
 func init() {
@@ -42,5 +135,20 @@ func init() {
 		azurePrimaryKeyCache,
 		imageStreamTags,
 		storageType,
+		storageObjects,
+		storageBytes,
+		storageBlobSizes,
+		storageInventoryTimestamp,
+		conformancePassed,
+		conformanceFailedSpecs,
+		conformanceTimestamp,
+		storageVolumeUsedBytes,
+		storageVolumeCapacityBytes,
+		storageVolumeExpansions,
+		swiftContainerBytesUsed,
+		swiftContainerObjects,
+		swiftContainerQuotaBytes,
+		controllerRequeues,
+		deprecatedFieldsInUse,
 	)
 }
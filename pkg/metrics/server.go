@@ -3,10 +3,13 @@ package metrics
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/calllog"
 )
 
 var (
@@ -31,6 +34,7 @@ func RunServer(port int) {
 	bindAddr := fmt.Sprintf(":%d", port)
 	router := http.NewServeMux()
 	router.Handle("/metrics", handler)
+	router.Handle("/debug/cloud-api-calls", calllog.Default())
 	srv := &http.Server{
 		Addr:    bindAddr,
 		Handler: router,
@@ -79,6 +83,66 @@ func ReportStorageType(stype string) {
 	storageType.WithLabelValues(stype).Set(1)
 }
 
+// ReportStorageInventory reports the object counts and sizes found by the
+// last storage inventory. sizes maps the upper bound of each size bucket to
+// the number of blobs in it.
+func ReportStorageInventory(objects, bytes int64, sizes map[string]int64, timestamp time.Time) {
+	storageObjects.Set(float64(objects))
+	storageBytes.Set(float64(bytes))
+	storageBlobSizes.Reset()
+	for size, count := range sizes {
+		storageBlobSizes.WithLabelValues(size).Set(float64(count))
+	}
+	storageInventoryTimestamp.Set(float64(timestamp.Unix()))
+}
+
+// ReportConformance reports the result of the last run of the OCI
+// distribution conformance suite.
+func ReportConformance(passed bool, failedSpecs int, timestamp time.Time) {
+	if passed {
+		conformancePassed.Set(1)
+	} else {
+		conformancePassed.Set(0)
+	}
+	conformanceFailedSpecs.Set(float64(failedSpecs))
+	conformanceTimestamp.Set(float64(timestamp.Unix()))
+}
+
+// ReportStorageVolumeUsage reports the used and total bytes of the volume
+// backing the registry claim.
+func ReportStorageVolumeUsage(used, capacity uint64) {
+	storageVolumeUsedBytes.Set(float64(used))
+	storageVolumeCapacityBytes.Set(float64(capacity))
+}
+
+// StorageVolumeExpanded registers an expansion of the registry claim.
+func StorageVolumeExpanded() {
+	storageVolumeExpansions.Inc()
+}
+
+// ReportSwiftContainerUsage reports the usage and the quota of the registry
+// Swift container, as returned by a HEAD request on the container.
+func ReportSwiftContainerUsage(bytesUsed, objects, quotaBytes int64) {
+	swiftContainerBytesUsed.Set(float64(bytesUsed))
+	swiftContainerObjects.Set(float64(objects))
+	swiftContainerQuotaBytes.Set(float64(quotaBytes))
+}
+
+// ControllerRequeued registers a failed sync requeued because of an error
+// of the given class.
+func ControllerRequeued(reason string) {
+	controllerRequeues.With(map[string]string{"reason": reason}).Inc()
+}
+
+// ReportDeprecatedFields reports the deprecated fields set in the resources
+// of the given type, replacing the ones previously reported for it.
+func ReportDeprecatedFields(resource string, fields []string) {
+	deprecatedFieldsInUse.DeletePartialMatch(map[string]string{"resource": resource})
+	for _, field := range fields {
+		deprecatedFieldsInUse.With(map[string]string{"resource": resource, "field": field}).Set(1)
+	}
+}
+
 // AzureKeyCacheHit registers a hit on Azure key cache.
 func AzureKeyCacheHit() {
 	azurePrimaryKeyCache.With(map[string]string{"result": "hit"}).Inc()
@@ -11,6 +11,7 @@ import (
 	"math/big"
 	"net/http"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -201,6 +202,36 @@ func TestImagePrunerInstallStatus(t *testing.T) {
 	}
 }
 
+func TestReportDeprecatedFields(t *testing.T) {
+	metricName := "image_registry_operator_deprecated_fields_in_use"
+
+	ReportDeprecatedFields("configs", []string{"spec.logging", "spec.storage.azure.cloudName"})
+	ReportDeprecatedFields("imagepruners", []string{"spec.keepYoungerThan"})
+	// the fields of a resource type are replaced on every report.
+	ReportDeprecatedFields("configs", []string{"spec.logging"})
+
+	resp, err := http.Get("https://localhost:5000/metrics")
+	if err != nil {
+		t.Fatalf("error requesting metrics server: %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, m := range findMetricsByCounter(resp.Body, metricName) {
+		labels := map[string]string{}
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		got[labels["resource"]+"/"+labels["field"]] = m.Gauge.GetValue() == 1
+	}
+	expected := map[string]bool{
+		"configs/spec.logging":              true,
+		"imagepruners/spec.keepYoungerThan": true,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
 func findMetricsByCounter(buf io.ReadCloser, name string) []*io_prometheus_client.Metric {
 	defer buf.Close()
 	mf := io_prometheus_client.MetricFamily{}
@@ -0,0 +1,161 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	gapi "google.golang.org/api/googleapi"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// errorClass groups the errors a sync can fail with by how quickly they are
+// expected to go away.
+type errorClass string
+
+const (
+	// errorClassThrottled is for requests rejected because the API rate
+	// limits were hit, retrying early only makes it worse.
+	errorClassThrottled errorClass = "throttled"
+	// errorClassAuth is for rejected credentials or missing permissions,
+	// they are usually fixed by a human.
+	errorClassAuth errorClass = "auth"
+	// errorClassNotFound is for objects or cloud resources that do not
+	// exist yet, e.g. while another component creates them.
+	errorClassNotFound errorClass = "notfound"
+	// errorClassNetwork is for transient network failures.
+	errorClassNetwork errorClass = "network"
+	// errorClassOther is for every other error.
+	errorClassOther errorClass = "other"
+)
+
+// backoffCurve is an exponential backoff starting at base and capped at max.
+type backoffCurve struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// backoffCurves are the backoffs used for each class of errors. The curve
+// for other errors is the one of the default controller rate limiter.
+var backoffCurves = map[errorClass]backoffCurve{
+	errorClassThrottled: {base: 5 * time.Second, max: 5 * time.Minute},
+	errorClassAuth:      {base: 30 * time.Second, max: 10 * time.Minute},
+	errorClassNotFound:  {base: 5 * time.Second, max: 2 * time.Minute},
+	errorClassNetwork:   {base: time.Second, max: time.Minute},
+	errorClassOther:     {base: 5 * time.Millisecond, max: 1000 * time.Second},
+}
+
+// classifyError returns the class of err, looking at the errors returned by
+// the Kubernetes API and by the cloud SDKs used by the storage drivers.
+func classifyError(err error) errorClass {
+	switch {
+	case kerrors.IsTooManyRequests(err):
+		return errorClassThrottled
+	case kerrors.IsUnauthorized(err), kerrors.IsForbidden(err):
+		return errorClassAuth
+	case kerrors.IsNotFound(err):
+		return errorClassNotFound
+	case kerrors.IsServerTimeout(err), kerrors.IsTimeout(err):
+		return errorClassNetwork
+	}
+
+	var awsErr interface{ Code() string }
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "Throttling", "ThrottlingException", "SlowDown", "RequestLimitExceeded", "TooManyRequestsException":
+			return errorClassThrottled
+		}
+	}
+
+	if class, ok := classifyStatusCode(errorStatusCode(err)); ok {
+		return class
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return errorClassNetwork
+	}
+	return errorClassOther
+}
+
+// errorStatusCode returns the HTTP status code of the response that caused
+// err, or 0 if err does not come from an HTTP API.
+func errorStatusCode(err error) int {
+	var gerr *gapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code
+	}
+	var azureErr autorest.DetailedError
+	if errors.As(err, &azureErr) {
+		if code, ok := azureErr.StatusCode.(int); ok {
+			return code
+		}
+	}
+	// AWS and IBM COS request failures.
+	var reqErr interface{ StatusCode() int }
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode()
+	}
+	return 0
+}
+
+func classifyStatusCode(code int) (errorClass, bool) {
+	switch code {
+	case http.StatusTooManyRequests:
+		return errorClassThrottled, true
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errorClassAuth, true
+	case http.StatusNotFound:
+		return errorClassNotFound, true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return errorClassNetwork, true
+	}
+	return "", false
+}
+
+// errorBackoff computes when a failed sync is retried. Every class of
+// errors has its own failure count, so a throttled API does not inherit
+// the short delays of a flaky network and the other way round. The counts
+// are reset once a sync succeeds.
+type errorBackoff struct {
+	mu       sync.Mutex
+	failures map[errorClass]int
+}
+
+func newErrorBackoff() *errorBackoff {
+	return &errorBackoff{
+		failures: map[errorClass]int{},
+	}
+}
+
+// When records a failure of the given class and returns for how long the
+// next sync should be delayed.
+func (b *errorBackoff) When(class errorClass) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	curve, ok := backoffCurves[class]
+	if !ok {
+		curve = backoffCurves[errorClassOther]
+	}
+	exp := b.failures[class]
+	b.failures[class]++
+
+	delay := float64(curve.base) * math.Pow(2, float64(exp))
+	if delay > float64(curve.max) {
+		return curve.max
+	}
+	return time.Duration(delay)
+}
+
+// Forget resets the failure counts.
+func (b *errorBackoff) Forget() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = map[errorClass]int{}
+}
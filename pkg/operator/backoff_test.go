@@ -0,0 +1,105 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	gapi "google.golang.org/api/googleapi"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		err      error
+		expected errorClass
+	}{
+		{
+			name:     "api throttled",
+			err:      kerrors.NewTooManyRequests("slow down", 1),
+			expected: errorClassThrottled,
+		},
+		{
+			name:     "aws throttled",
+			err:      fmt.Errorf("unable to sync storage: %w", awserr.NewRequestFailure(awserr.New("SlowDown", "slow down", nil), http.StatusServiceUnavailable, "id")),
+			expected: errorClassThrottled,
+		},
+		{
+			name:     "api forbidden",
+			err:      kerrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "foo", fmt.Errorf("denied")),
+			expected: errorClassAuth,
+		},
+		{
+			name:     "wrapped api forbidden",
+			err:      fmt.Errorf("unable to apply objects: %w", kerrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "foo", fmt.Errorf("denied"))),
+			expected: errorClassAuth,
+		},
+		{
+			name:     "aws forbidden",
+			err:      awserr.NewRequestFailure(awserr.New("AccessDenied", "denied", nil), http.StatusForbidden, "id"),
+			expected: errorClassAuth,
+		},
+		{
+			name:     "azure unauthorized",
+			err:      autorest.DetailedError{StatusCode: http.StatusUnauthorized},
+			expected: errorClassAuth,
+		},
+		{
+			name:     "gcs not found",
+			err:      &gapi.Error{Code: http.StatusNotFound},
+			expected: errorClassNotFound,
+		},
+		{
+			name:     "api not found",
+			err:      kerrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "foo"),
+			expected: errorClassNotFound,
+		},
+		{
+			name:     "deadline exceeded",
+			err:      fmt.Errorf("unable to list: %w", context.DeadlineExceeded),
+			expected: errorClassNetwork,
+		},
+		{
+			name:     "unknown",
+			err:      fmt.Errorf("something went wrong"),
+			expected: errorClassOther,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.expected {
+				t.Errorf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestErrorBackoff(t *testing.T) {
+	b := newErrorBackoff()
+
+	for i, expected := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		if got := b.When(errorClassAuth); got != expected {
+			t.Errorf("auth failure %d: got %s, want %s", i, got, expected)
+		}
+	}
+	// classes are counted apart.
+	if got := b.When(errorClassNetwork); got != time.Second {
+		t.Errorf("got %s, want %s", got, time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		b.When(errorClassThrottled)
+	}
+	if got := b.When(errorClassThrottled); got != 5*time.Minute {
+		t.Errorf("got %s, want the throttling backoff to be capped at %s", got, 5*time.Minute)
+	}
+
+	b.Forget()
+	if got := b.When(errorClassAuth); got != 30*time.Second {
+		t.Errorf("got %s after a successful sync, want %s", got, 30*time.Second)
+	}
+}
@@ -3,11 +3,15 @@ package operator
 import (
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	appsv1informers "k8s.io/client-go/informers/apps/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
@@ -31,6 +35,9 @@ type ClusterOperatorStatusController struct {
 	imageRegistryConfigLister imageregistryv1listers.ConfigLister
 	imagePrunerLister         imageregistryv1listers.ImagePrunerLister
 	deploymentLister          appsv1listers.DeploymentNamespaceLister
+	readinessLister           corev1listers.ConfigMapNamespaceLister
+	managedObjectsLister      corev1listers.ConfigMapNamespaceLister
+	coreClient                coreset.CoreV1Interface
 
 	cachesToSync []cache.InformerSynced
 	queue        workqueue.RateLimitingInterface
@@ -43,6 +50,9 @@ func NewClusterOperatorStatusController(
 	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
 	imagePrunerInformer imageregistryv1informers.ImagePrunerInformer,
 	deploymentInformer appsv1informers.DeploymentInformer,
+	configManagedConfigMapInformer corev1informers.ConfigMapInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
+	coreClient coreset.CoreV1Interface,
 ) (*ClusterOperatorStatusController, error) {
 	c := &ClusterOperatorStatusController{
 		relatedObjects:            relatedObjects,
@@ -51,6 +61,9 @@ func NewClusterOperatorStatusController(
 		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
 		imagePrunerLister:         imagePrunerInformer.Lister(),
 		deploymentLister:          deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		readinessLister:           configManagedConfigMapInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		managedObjectsLister:      configMapInformer.Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		coreClient:                coreClient,
 		queue:                     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ClusterOperatorStatusController"),
 	}
 
@@ -74,6 +87,34 @@ func NewClusterOperatorStatusController(
 	}
 	c.cachesToSync = append(c.cachesToSync, deploymentInformer.Informer().HasSynced)
 
+	if _, err := configManagedConfigMapInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			cm, ok := obj.(*corev1.ConfigMap)
+			return ok && cm.Name == defaults.ReadinessConfigMapName
+		},
+		Handler: c.eventHandler(),
+	}); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, configManagedConfigMapInformer.Informer().HasSynced)
+
+	if _, err := configMapInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			cm, ok := obj.(*corev1.ConfigMap)
+			return ok && cm.Name == defaults.ManagedObjectsConfigMapName
+		},
+		Handler: c.eventHandler(),
+	}); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, configMapInformer.Informer().HasSynced)
+
 	return c, nil
 }
 
@@ -124,6 +165,11 @@ func (c *ClusterOperatorStatusController) sync() error {
 		imagepruner = nil
 	}
 
+	managedObjects, err := resource.GetManagedObjects(c.managedObjectsLister)
+	if err != nil {
+		klog.Warningf("unable to get the managed objects: %v", err)
+	}
+
 	mut := resource.NewGeneratorClusterOperator(
 		c.deploymentLister,
 		c.clusterOperatorLister,
@@ -131,9 +177,19 @@ func (c *ClusterOperatorStatusController) sync() error {
 		cr,
 		imagepruner,
 		c.relatedObjects,
+		managedObjects,
 	)
+	if err := resource.ApplyMutator(mut); err != nil {
+		return err
+	}
 
-	return resource.ApplyMutator(mut)
+	readiness := resource.NewGeneratorReadiness(
+		c.readinessLister,
+		c.coreClient,
+		c.deploymentLister,
+		cr,
+	)
+	return resource.ApplyMutator(readiness)
 }
 
 func (c *ClusterOperatorStatusController) Run(stopCh <-chan struct{}) {
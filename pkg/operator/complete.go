@@ -3,6 +3,7 @@ package operator
 import (
 	"crypto/rand"
 	"fmt"
+	"time"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 
@@ -51,6 +52,10 @@ func applyDefaults(cr *imageregistryv1.Config) error {
 		}
 
 		cr.Spec.HTTPSecret = fmt.Sprintf("%x", string(secretBytes[:]))
+		if cr.Annotations == nil {
+			cr.Annotations = map[string]string{}
+		}
+		cr.Annotations[defaults.HTTPSecretGeneratedAnnotation] = time.Now().UTC().Format(time.RFC3339)
 	}
 
 	return nil
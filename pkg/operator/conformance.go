@@ -0,0 +1,659 @@
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1informers "k8s.io/client-go/informers/apps/v1"
+	batchv1informers "k8s.io/client-go/informers/batch/v1"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacset "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	routev1informers "github.com/openshift/client-go/route/informers/externalversions/route/v1"
+	routev1listers "github.com/openshift/client-go/route/listers/route/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+const (
+	// conformanceTestPassedCondition reports the result of the OCI
+	// distribution conformance suite run after the last registry rollout.
+	conformanceTestPassedCondition = "ConformanceTestPassed"
+
+	// conformanceImage is the image of the upstream conformance suite.
+	conformanceImage = "ghcr.io/opencontainers/distribution-spec/conformance:v1.1.0"
+
+	// conformanceRepository is the repository the suite pushes to, another
+	// one suffixed with -crossmount is used to test cross repository blob
+	// mounts.
+	conformanceRepository = "conformance"
+
+	// conformancePasswordKey is the key of the conformance Secret holding
+	// the password the suite authenticates with.
+	conformancePasswordKey = "password"
+
+	// conformanceCAKey is the key of the conformance Secret holding the CA
+	// bundle the certificate of the registry route is verified with.
+	conformanceCAKey = "ca-bundle.crt"
+
+	// defaultIngressCertName is the config map, in the
+	// openshift-config-managed namespace, holding the CA bundle of the
+	// default ingress certificate.
+	defaultIngressCertName = "default-ingress-cert"
+
+	// conformanceCredentialsMount is where the conformance Secret is mounted.
+	conformanceCredentialsMount = "/etc/pki/conformance"
+
+	// conformanceDeadline bounds a run of the suite.
+	conformanceDeadline = int64(30 * 60)
+
+	// conformanceTTL is how long finished conformance jobs are kept around,
+	// so their logs can be read.
+	conformanceTTL = int32(7 * 24 * 60 * 60)
+
+	// conformanceTokenLifetime bounds the token of the conformance service
+	// account, which outlives the suite by a few minutes at most.
+	conformanceTokenLifetime = conformanceDeadline + 10*60
+)
+
+// conformanceClusterRoles are the roles the conformance service account is
+// granted in the conformance namespace, enough to push and pull images
+// there and nowhere else.
+var conformanceClusterRoles = []string{"system:image-builder", "system:image-puller"}
+
+// conformanceWorkflows maps the workflows of the conformance suite to the
+// variables enabling them.
+var conformanceWorkflows = map[string]string{
+	"pull":              "OCI_TEST_PULL",
+	"push":              "OCI_TEST_PUSH",
+	"contentDiscovery":  "OCI_TEST_CONTENT_DISCOVERY",
+	"contentManagement": "OCI_TEST_CONTENT_MANAGEMENT",
+}
+
+// defaultConformanceWorkflows are the workflows run when the user has not
+// chosen any. Content management deletes manifests, blobs and tags, the
+// registry leaves the removal of images to the pruner.
+var defaultConformanceWorkflows = []string{"pull", "push", "contentDiscovery"}
+
+// conformanceSummaryRegexp matches the summary printed by the suite at the
+// end of a run.
+var conformanceSummaryRegexp = regexp.MustCompile(`(SUCCESS!|FAIL!) -- (\d+) Passed \| (\d+) Failed \| (\d+) Pending \| (\d+) Skipped`)
+
+// conformanceSummary is the outcome of a conformance suite run.
+type conformanceSummary struct {
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+// parseConformanceSummary returns the summary found in the output of the
+// suite, or nil if it did not get to print one.
+func parseConformanceSummary(output string) *conformanceSummary {
+	m := conformanceSummaryRegexp.FindAllStringSubmatch(output, -1)
+	if len(m) == 0 {
+		return nil
+	}
+	last := m[len(m)-1]
+	passed, _ := strconv.Atoi(last[2])
+	failed, _ := strconv.Atoi(last[3])
+	skipped, _ := strconv.Atoi(last[5])
+	return &conformanceSummary{
+		Passed:  passed,
+		Failed:  failed,
+		Skipped: skipped,
+	}
+}
+
+// ConformanceController runs the OCI distribution conformance suite against
+// the registry after each rollout, reporting the result in the operator
+// status and in the metrics. It lets users check that the registry still
+// behaves as clients expect after changing its configuration.
+type ConformanceController struct {
+	eventRecorder    events.Recorder
+	operatorClient   v1helpers.OperatorClient
+	coreClient       coreset.CoreV1Interface
+	batchClient      batchset.BatchV1Interface
+	rbacClient       rbacset.RbacV1Interface
+	configLister     imageregistryv1listers.ConfigLister
+	deploymentLister appsv1listers.DeploymentNamespaceLister
+	routeLister      routev1listers.RouteNamespaceLister
+	jobLister        batchv1listers.JobNamespaceLister
+
+	// lastReported is the name of the job the result was last reported
+	// for.
+	lastReported string
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.RateLimitingInterface
+}
+
+func NewConformanceController(
+	eventRecorder events.Recorder,
+	operatorClient v1helpers.OperatorClient,
+	coreClient coreset.CoreV1Interface,
+	batchClient batchset.BatchV1Interface,
+	rbacClient rbacset.RbacV1Interface,
+	configInformer imageregistryv1informers.ConfigInformer,
+	deploymentInformer appsv1informers.DeploymentInformer,
+	routeInformer routev1informers.RouteInformer,
+	jobInformer batchv1informers.JobInformer,
+) (*ConformanceController, error) {
+	c := &ConformanceController{
+		eventRecorder:    eventRecorder,
+		operatorClient:   operatorClient,
+		coreClient:       coreClient,
+		batchClient:      batchClient,
+		rbacClient:       rbacClient,
+		configLister:     configInformer.Lister(),
+		deploymentLister: deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		routeLister:      routeInformer.Lister().Routes(defaults.ImageRegistryOperatorNamespace),
+		jobLister:        jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		queue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ConformanceController"),
+	}
+
+	for _, informer := range []cache.SharedIndexInformer{
+		configInformer.Informer(),
+		deploymentInformer.Informer(),
+		routeInformer.Informer(),
+		jobInformer.Informer(),
+	} {
+		if _, err := informer.AddEventHandler(c.eventHandler()); err != nil {
+			return nil, err
+		}
+		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
+	}
+
+	return c, nil
+}
+
+func (c *ConformanceController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *ConformanceController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *ConformanceController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("ConformanceController: got event from workqueue")
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("ConformanceController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("ConformanceController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// conformanceSettings returns the namespace, the image and the workflows
+// the suite runs with.
+func conformanceSettings(overrides *resource.ConformanceOverrides) (string, string, []string, error) {
+	namespace := overrides.Namespace
+	if namespace == "" {
+		namespace = defaults.ConformanceNamespace
+	}
+	image := overrides.Image
+	if image == "" {
+		image = conformanceImage
+	}
+	workflows := overrides.Workflows
+	if len(workflows) == 0 {
+		workflows = defaultConformanceWorkflows
+	}
+	for _, workflow := range workflows {
+		if _, ok := conformanceWorkflows[workflow]; !ok {
+			return "", "", nil, fmt.Errorf("unknown conformance workflow %q", workflow)
+		}
+	}
+	return namespace, image, workflows, nil
+}
+
+// conformanceJob returns the job running the conformance suite against the
+// registry at rootURL for the given rollout. The job name is derived from
+// the rollout and the settings of the suite, so each of them is only
+// tested once.
+func conformanceJob(rollout, rootURL, namespace, image string, workflows []string) *batchv1.Job {
+	hash := sha256.Sum256([]byte(strings.Join([]string{rollout, namespace, image, strings.Join(workflows, ",")}, "/")))
+	name := fmt.Sprintf("%s-%x", defaults.ConformanceName, hash[:4])
+
+	env := []corev1.EnvVar{
+		{Name: "OCI_ROOT_URL", Value: rootURL},
+		{Name: "OCI_NAMESPACE", Value: namespace + "/" + conformanceRepository},
+		{Name: "OCI_CROSSMOUNT_NAMESPACE", Value: namespace + "/" + conformanceRepository + "-crossmount"},
+		{Name: "OCI_USERNAME", Value: "unused"},
+		{
+			Name: "OCI_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: defaults.ConformanceName},
+					Key:                  conformancePasswordKey,
+				},
+			},
+		},
+		{Name: "OCI_HIDE_SKIPPED_WORKFLOWS", Value: "1"},
+		{Name: "OCI_REPORT_DIR", Value: "/results"},
+		// the route certificate is issued by the ingress CA.
+		{Name: "SSL_CERT_FILE", Value: conformanceCredentialsMount + "/" + conformanceCAKey},
+	}
+	for _, workflow := range workflows {
+		env = append(env, corev1.EnvVar{Name: conformanceWorkflows[workflow], Value: "1"})
+	}
+
+	backoffLimit := int32(0)
+	deadline := conformanceDeadline
+	ttl := conformanceTTL
+	automount := false
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Labels: map[string]string{
+				"created-by": defaults.ConformanceName,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   &deadline,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:                corev1.RestartPolicyNever,
+					AutomountServiceAccountToken: &automount,
+					PriorityClassName:            "openshift-user-critical",
+					NodeSelector: map[string]string{
+						"kubernetes.io/os": "linux",
+					},
+					Containers: []corev1.Container{
+						{
+							Name:       defaults.ConformanceName,
+							Image:      image,
+							WorkingDir: "/results",
+							Env:        env,
+							// the summary of failed runs ends up in the
+							// termination message.
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "results", MountPath: "/results"},
+								{Name: "credentials", MountPath: conformanceCredentialsMount, ReadOnly: true},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "results",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name: "credentials",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: defaults.ConformanceName,
+									Items: []corev1.KeyToPath{
+										{Key: conformanceCAKey, Path: conformanceCAKey},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// jobFinishedCondition returns the condition of the job reporting it
+// completed or failed, or nil if it is still running.
+func jobFinishedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func (c *ConformanceController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	overrides, err := resource.GetConfigOverrides(cr)
+	if err != nil {
+		// invalid overrides are reported by the main controller.
+		return nil
+	}
+	if overrides.Conformance == nil || !overrides.Conformance.Enabled {
+		c.lastReported = ""
+		if err := c.cleanup(ctx); err != nil {
+			return err
+		}
+		_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, func(status *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&status.Conditions, conformanceTestPassedCondition)
+			return nil
+		})
+		return err
+	}
+	namespace, image, workflows, err := conformanceSettings(overrides.Conformance)
+	if err != nil {
+		_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    conformanceTestPassedCondition,
+			Status:  operatorv1.ConditionFalse,
+			Reason:  "InvalidConfiguration",
+			Message: err.Error(),
+		}))
+		return err
+	}
+
+	deploy, err := c.deploymentLister.Get(defaults.ImageRegistryName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !rolloutComplete(deploy) {
+		return nil
+	}
+	host := c.routeHost()
+	if host == "" {
+		_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    conformanceTestPassedCondition,
+			Status:  operatorv1.ConditionFalse,
+			Reason:  "NoRoute",
+			Message: "The conformance suite runs against the default route of the registry, set spec.defaultRoute to expose it",
+		}))
+		return err
+	}
+	rootURL := "https://" + host
+
+	rollout := fmt.Sprintf("%s/%d", deploy.UID, deploy.Generation)
+	expected := conformanceJob(rollout, rootURL, namespace, image, workflows)
+	if expected.Name == c.lastReported {
+		return nil
+	}
+
+	job, err := c.jobLister.Get(expected.Name)
+	if errors.IsNotFound(err) {
+		return c.start(ctx, expected, namespace)
+	} else if err != nil {
+		return err
+	}
+	finished := jobFinishedCondition(job)
+	if finished == nil {
+		return nil
+	}
+
+	cond, summary, err := c.result(ctx, job, finished)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	if summary != nil {
+		failed = summary.Failed
+	}
+	metrics.ReportConformance(cond.Status == operatorv1.ConditionTrue, failed, finished.LastTransitionTime.Time)
+	if cond.Status != operatorv1.ConditionTrue {
+		c.eventRecorder.Warningf("ConformanceTestFailed", "%s", cond.Message)
+	}
+
+	if err := c.deleteCredentials(ctx); err != nil {
+		return err
+	}
+	if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(cond)); err != nil {
+		return err
+	}
+	c.lastReported = job.Name
+	return nil
+}
+
+// routeHost returns the host of the default route of the registry, or an
+// empty string if it is not exposed.
+func (c *ConformanceController) routeHost() string {
+	route, err := c.routeLister.Get(defaults.RouteName)
+	if err != nil {
+		return ""
+	}
+	if route.Spec.Host != "" {
+		return route.Spec.Host
+	}
+	for _, ingress := range route.Status.Ingress {
+		if ingress.Host != "" {
+			return ingress.Host
+		}
+	}
+	return ""
+}
+
+// ensureServiceAccount creates the service account the suite authenticates
+// as, allowed to push and pull images in the conformance namespace only.
+func (c *ConformanceController) ensureServiceAccount(ctx context.Context, namespace string) error {
+	_, _, err := resourceapply.ApplyServiceAccount(ctx, c.coreClient, c.eventRecorder, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ConformanceName,
+			Namespace: namespace,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to apply the conformance service account: %w", err)
+	}
+	for _, role := range conformanceClusterRoles {
+		_, _, err := resourceapply.ApplyRoleBinding(ctx, c.rbacClient, c.eventRecorder, &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      conformanceRoleBindingName(role),
+				Namespace: namespace,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     role,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      defaults.ConformanceName,
+					Namespace: namespace,
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to grant %s to the conformance service account: %w", role, err)
+		}
+	}
+	return nil
+}
+
+// conformanceRoleBindingName returns the name of the role binding granting
+// role to the conformance service account.
+func conformanceRoleBindingName(role string) string {
+	return defaults.ConformanceName + "-" + strings.TrimPrefix(role, "system:")
+}
+
+// start stores short-lived credentials of the conformance service account,
+// along with the CA bundle of the route, for the suite and creates its job.
+func (c *ConformanceController) start(ctx context.Context, job *batchv1.Job, namespace string) error {
+	if err := ensureNamespace(ctx, c.coreClient, namespace); err != nil {
+		return err
+	}
+	if err := c.ensureServiceAccount(ctx, namespace); err != nil {
+		return err
+	}
+
+	lifetime := conformanceTokenLifetime
+	token, err := c.coreClient.ServiceAccounts(namespace).CreateToken(ctx, defaults.ConformanceName, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &lifetime,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to request a token for the conformance service account: %w", err)
+	}
+	ingressCA, err := c.coreClient.ConfigMaps(defaults.OpenShiftConfigManagedNamespace).Get(ctx, defaultIngressCertName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get the CA bundle of the default ingress certificate: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ConformanceName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			conformancePasswordKey: []byte(token.Status.Token),
+			conformanceCAKey:       []byte(ingressCA.Data[conformanceCAKey]),
+		},
+	}
+	secrets := c.coreClient.Secrets(defaults.ImageRegistryOperatorNamespace)
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); errors.IsAlreadyExists(err) {
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("unable to update the conformance credentials: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("unable to create the conformance credentials: %w", err)
+	}
+
+	_, err = c.batchClient.Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to start the conformance job: %w", err)
+	}
+	klog.Infof("started job %s running the OCI distribution conformance suite against the registry", job.Name)
+
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+		Type:    conformanceTestPassedCondition,
+		Status:  operatorv1.ConditionUnknown,
+		Reason:  "Running",
+		Message: fmt.Sprintf("The conformance suite is running in the job %s", job.Name),
+	}))
+	return err
+}
+
+// deleteCredentials deletes the Secret holding the credentials of the
+// suite.
+func (c *ConformanceController) deleteCredentials(ctx context.Context) error {
+	err := c.coreClient.Secrets(defaults.ImageRegistryOperatorNamespace).Delete(ctx, defaults.ConformanceName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete the conformance credentials: %w", err)
+	}
+	return nil
+}
+
+// cleanup deletes the credentials and the jobs of the suite once it is
+// disabled, stopping a run in progress.
+func (c *ConformanceController) cleanup(ctx context.Context) error {
+	if err := c.deleteCredentials(ctx); err != nil {
+		return err
+	}
+	jobs, err := c.jobLister.List(labels.SelectorFromSet(labels.Set{"created-by": defaults.ConformanceName}))
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	for _, job := range jobs {
+		err := c.batchClient.Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete the conformance job %s: %w", job.Name, err)
+		}
+	}
+	return nil
+}
+
+// result returns the condition reporting the outcome of the finished job,
+// along with the summary of the suite when it could be found.
+func (c *ConformanceController) result(ctx context.Context, job *batchv1.Job, finished *batchv1.JobCondition) (operatorv1.OperatorCondition, *conformanceSummary, error) {
+	cond := operatorv1.OperatorCondition{
+		Type:    conformanceTestPassedCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("The registry passed the OCI distribution conformance suite run by the job %s", job.Name),
+	}
+	if finished.Type == batchv1.JobComplete {
+		return cond, nil, nil
+	}
+
+	pods, err := c.coreClient.Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "job-name=" + job.Name,
+	})
+	if err != nil {
+		return cond, nil, fmt.Errorf("unable to list the pods of the job %s: %w", job.Name, err)
+	}
+	var summary *conformanceSummary
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil {
+				if s := parseConformanceSummary(status.State.Terminated.Message); s != nil {
+					summary = s
+				}
+			}
+		}
+	}
+
+	cond.Status = operatorv1.ConditionFalse
+	cond.Reason = "Failed"
+	if summary != nil {
+		cond.Message = fmt.Sprintf("%d of %d specs of the OCI distribution conformance suite failed, see the logs of the job %s", summary.Failed, summary.Passed+summary.Failed, job.Name)
+	} else {
+		cond.Message = fmt.Sprintf("The OCI distribution conformance suite did not complete: %s: %s, see the logs of the job %s", finished.Reason, finished.Message, job.Name)
+	}
+	return cond, summary, nil
+}
+
+func (c *ConformanceController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting ConformanceController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, ctx.Done())
+
+	klog.Infof("Started ConformanceController")
+	<-ctx.Done()
+	klog.Infof("Shutting down ConformanceController")
+}
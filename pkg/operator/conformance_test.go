@@ -0,0 +1,167 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+func TestParseConformanceSummary(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		output   string
+		expected *conformanceSummary
+	}{
+		{
+			name: "failed run",
+			output: `Summarizing 2 Failures:
+  [FAIL] OCI Distribution Conformance Tests Push Blob Upload Streamed PATCH request with blob in body should yield 202 response
+  [FAIL] OCI Distribution Conformance Tests Push Manifest Upload Registry should accept a manifest upload with no layers
+
+Ran 40 of 79 Specs in 3.210 seconds
+FAIL! -- 38 Passed | 2 Failed | 0 Pending | 39 Skipped
+--- FAIL: TestConformance (3.21s)`,
+			expected: &conformanceSummary{Passed: 38, Failed: 2, Skipped: 39},
+		},
+		{
+			name:     "successful run",
+			output:   "Ran 40 of 79 Specs in 2.001 seconds\nSUCCESS! -- 40 Passed | 0 Failed | 0 Pending | 39 Skipped\nPASS",
+			expected: &conformanceSummary{Passed: 40, Failed: 0, Skipped: 39},
+		},
+		{
+			name:   "no summary",
+			output: "OCI_ROOT_URL: Get \"https://image-registry.openshift-image-registry.svc:5000/v2/\": x509: certificate signed by unknown authority",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseConformanceSummary(tt.output)
+			if tt.expected == nil {
+				if got != nil {
+					t.Errorf("got summary %#v, want none", got)
+				}
+			} else if got == nil || *got != *tt.expected {
+				t.Errorf("got summary %#v, want %#v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConformanceSettings(t *testing.T) {
+	namespace, image, workflows, err := conformanceSettings(&resource.ConformanceOverrides{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "openshift-image-registry-conformance" || image != conformanceImage || strings.Join(workflows, ",") != "pull,push,contentDiscovery" {
+		t.Errorf("got namespace %q, image %q and workflows %v, want the defaults", namespace, image, workflows)
+	}
+
+	_, _, _, err = conformanceSettings(&resource.ConformanceOverrides{Enabled: true, Workflows: []string{"pull", "referrers"}})
+	if err == nil || !strings.Contains(err.Error(), `unknown conformance workflow "referrers"`) {
+		t.Errorf("got error %v, want an unknown workflow error", err)
+	}
+}
+
+func TestConformanceJob(t *testing.T) {
+	const rootURL = "https://default-route-openshift-image-registry.apps.example.com"
+
+	job := conformanceJob("uid/2", rootURL, "conformance-ns", "mirror.example.com/conformance:v1.1.0", []string{"pull", "contentManagement"})
+	if !strings.HasPrefix(job.Name, "image-registry-conformance-") {
+		t.Errorf("got job name %q, want the conformance prefix", job.Name)
+	}
+
+	container := job.Spec.Template.Spec.Containers[0]
+	if container.Image != "mirror.example.com/conformance:v1.1.0" {
+		t.Errorf("got image %q", container.Image)
+	}
+	env := map[string]corev1.EnvVar{}
+	for _, e := range container.Env {
+		env[e.Name] = e
+	}
+	for name, value := range map[string]string{
+		"OCI_ROOT_URL":                rootURL,
+		"OCI_NAMESPACE":               "conformance-ns/conformance",
+		"OCI_CROSSMOUNT_NAMESPACE":    "conformance-ns/conformance-crossmount",
+		"OCI_TEST_PULL":               "1",
+		"OCI_TEST_CONTENT_MANAGEMENT": "1",
+	} {
+		if env[name].Value != value {
+			t.Errorf("got %s=%q, want %q", name, env[name].Value, value)
+		}
+	}
+	for _, name := range []string{"OCI_TEST_PUSH", "OCI_TEST_CONTENT_DISCOVERY"} {
+		if _, ok := env[name]; ok {
+			t.Errorf("got %s set, want it unset", name)
+		}
+	}
+	if ref := env["OCI_PASSWORD"].ValueFrom; ref == nil || ref.SecretKeyRef == nil || ref.SecretKeyRef.Name != "image-registry-conformance" {
+		t.Errorf("got OCI_PASSWORD %#v, want it from the conformance secret", env["OCI_PASSWORD"])
+	}
+
+	if env["SSL_CERT_FILE"].Value != "/etc/pki/conformance/ca-bundle.crt" {
+		t.Errorf("got SSL_CERT_FILE %q, want the CA bundle of the conformance secret", env["SSL_CERT_FILE"].Value)
+	}
+	var mounted bool
+	for _, v := range job.Spec.Template.Spec.Volumes {
+		if v.Secret != nil && v.Secret.SecretName == "image-registry-conformance" {
+			mounted = true
+			for _, item := range v.Secret.Items {
+				if item.Key == conformancePasswordKey {
+					t.Errorf("got the password mounted, want it only in the environment")
+				}
+			}
+		}
+	}
+	if !mounted {
+		t.Errorf("got volumes %#v, want the conformance secret mounted", job.Spec.Template.Spec.Volumes)
+	}
+
+	if other := conformanceJob("uid/3", rootURL, "conformance-ns", "mirror.example.com/conformance:v1.1.0", []string{"pull", "contentManagement"}); other.Name == job.Name {
+		t.Errorf("got the same job name %q for another rollout", job.Name)
+	}
+	if other := conformanceJob("uid/2", rootURL, "conformance-ns", "mirror.example.com/conformance:v1.1.0", []string{"pull"}); other.Name == job.Name {
+		t.Errorf("got the same job name %q for other workflows", job.Name)
+	}
+}
+
+func TestConformanceCleanup(t *testing.T) {
+	running := conformanceJob("uid/2", "https://registry.example.com", "conformance-ns", conformanceImage, defaultConformanceWorkflows)
+	other := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: defaults.ImageRegistryOperatorNamespace}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: defaults.ConformanceName, Namespace: defaults.ImageRegistryOperatorNamespace}}
+
+	client := fake.NewSimpleClientset(running, other, secret)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, job := range []*batchv1.Job{running, other} {
+		if err := indexer.Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &ConformanceController{
+		coreClient:  client.CoreV1(),
+		batchClient: client.BatchV1(),
+		jobLister:   batchv1listers.NewJobLister(indexer).Jobs(defaults.ImageRegistryOperatorNamespace),
+	}
+	if err := c.cleanup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.ConformanceName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("got error %v, want the conformance secret deleted", err)
+	}
+	if _, err := client.BatchV1().Jobs(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), running.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("got error %v, want the conformance job deleted", err)
+	}
+	if _, err := client.BatchV1().Jobs(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), other.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("got error %v, want other jobs kept", err)
+	}
+}
@@ -2,15 +2,19 @@ package operator
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	kmeta "k8s.io/apimachinery/pkg/api/meta"
 	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	kubeinformers "k8s.io/client-go/informers"
 	kubeclient "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
@@ -32,10 +36,12 @@ import (
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 const (
@@ -82,11 +88,13 @@ func NewController(
 	listers := &regopclient.Listers{}
 	clients := &regopclient.Clients{}
 	c := &Controller{
-		kubeconfig: kubeconfig,
-		generator:  resource.NewGenerator(eventRecorder, kubeconfig, clients, listers),
-		workqueue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Changes"),
-		listers:    listers,
-		clients:    clients,
+		eventRecorder: eventRecorder,
+		kubeconfig:    kubeconfig,
+		generator:     resource.NewGenerator(eventRecorder, kubeconfig, clients, listers),
+		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Changes"),
+		backoff:       newErrorBackoff(),
+		listers:       listers,
+		clients:       clients,
 	}
 
 	// Initial event to bootstrap CR if it doesn't exist.
@@ -101,12 +109,23 @@ func NewController(
 	c.clients.RegOp = imageregistryClient
 	c.clients.Batch = kubeClient.BatchV1()
 
-	for _, ctor := range []func() cache.SharedIndexInformer{
+	dynamicClient, err := dynamic.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	c.clients.Dynamic = dynamicClient
+
+	informerCtors := []func() cache.SharedIndexInformer{
 		func() cache.SharedIndexInformer {
 			informer := kubeInformerFactory.Apps().V1().Deployments()
 			c.listers.Deployments = informer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace)
 			return informer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := kubeInformerFactory.Core().V1().PersistentVolumeClaims()
+			c.listers.PersistentVolumeClaims = informer.Lister().PersistentVolumeClaims(defaults.ImageRegistryOperatorNamespace)
+			return informer.Informer()
+		},
 		func() cache.SharedIndexInformer {
 			informer := kubeInformerFactory.Core().V1().Services()
 			c.listers.Services = informer.Lister().Services(defaults.ImageRegistryOperatorNamespace)
@@ -133,8 +152,8 @@ func NewController(
 			return informer.Informer()
 		},
 		func() cache.SharedIndexInformer {
-			informer := routeInformerFactory.Route().V1().Routes()
-			c.listers.Routes = informer.Lister().Routes(defaults.ImageRegistryOperatorNamespace)
+			informer := kubeInformerFactory.Batch().V1().Jobs()
+			c.listers.Jobs = informer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace)
 			return informer.Informer()
 		},
 		func() cache.SharedIndexInformer {
@@ -172,7 +191,22 @@ func NewController(
 			c.listers.Infrastructures = informer.Lister()
 			return informer.Informer()
 		},
-	} {
+		func() cache.SharedIndexInformer {
+			informer := configInformerFactory.Config().V1().FeatureGates()
+			c.listers.FeatureGates = informer.Lister()
+			return informer.Informer()
+		},
+	}
+	// standalone clusters have no routes, the registry is exposed by
+	// ingresses.
+	if !defaults.Standalone {
+		informerCtors = append(informerCtors, func() cache.SharedIndexInformer {
+			informer := routeInformerFactory.Route().V1().Routes()
+			c.listers.Routes = informer.Lister().Routes(defaults.ImageRegistryOperatorNamespace)
+			return informer.Informer()
+		})
+	}
+	for _, ctor := range informerCtors {
 		informer := ctor()
 		if _, err := informer.AddEventHandler(c.handler()); err != nil {
 			return nil, err
@@ -185,12 +219,14 @@ func NewController(
 
 // Controller keeps track of openshift image registry components.
 type Controller struct {
-	kubeconfig   *restclient.Config
-	generator    *resource.Generator
-	workqueue    workqueue.RateLimitingInterface
-	listers      *regopclient.Listers
-	clients      *regopclient.Clients
-	cachesToSync []cache.InformerSynced
+	eventRecorder events.Recorder
+	kubeconfig    *restclient.Config
+	generator     *resource.Generator
+	workqueue     workqueue.RateLimitingInterface
+	backoff       *errorBackoff
+	listers       *regopclient.Listers
+	clients       *regopclient.Clients
+	cachesToSync  []cache.InformerSynced
 }
 
 func (c *Controller) createOrUpdateResources(cr *imageregistryv1.Config) error {
@@ -206,9 +242,24 @@ func (c *Controller) createOrUpdateResources(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	// fields are reported before they are migrated, users applying their
+	// manifests keep setting them.
+	metrics.ReportDeprecatedFields("configs", deprecatedFields(cr))
+	if migrated := migrateDeprecatedFields(cr); len(migrated) > 0 {
+		klog.Infof("migrated deprecated fields in %s: %s", utilObjectInfo(cr), strings.Join(migrated, "; "))
+		updateCondition(cr, deprecatedFieldsMigratedCondition, operatorv1.OperatorCondition{
+			Status:  operatorv1.ConditionTrue,
+			Reason:  "Migrated",
+			Message: strings.Join(migrated, "; "),
+		})
+	}
+
 	err = c.generator.Apply(cr)
+	var degradedErr *storageutil.DegradedError
 	if err == storage.ErrStorageNotConfigured {
 		return newPermanentError("StorageNotConfigured", err)
+	} else if stderrors.As(err, &degradedErr) {
+		return newPermanentError(degradedErr.Reason, err)
 	} else if err != nil {
 		return err
 	}
@@ -220,6 +271,9 @@ func (c *Controller) createOrUpdateResources(cr *imageregistryv1.Config) error {
 // the default route if configured.
 func (c *Controller) getRoutes(cr *imageregistryv1.Config) ([]*routev1.Route, error) {
 	var routes []*routev1.Route
+	if defaults.Standalone {
+		return routes, nil
+	}
 	if cr.Spec.DefaultRoute {
 		if route, err := c.listers.Routes.Get(defaults.RouteName); err != nil {
 			klog.V(4).Infof("unable to get default route: %s", err)
@@ -373,10 +427,20 @@ func (c *Controller) eventProcessor() {
 			}
 
 			if err := c.sync(); err != nil {
-				c.workqueue.AddRateLimited(workqueueKey)
-				klog.Errorf("unable to sync: %s, requeuing", err)
+				class := classifyError(err)
+				delay := c.backoff.When(class)
+				c.workqueue.AddAfter(workqueueKey, delay)
+				metrics.ControllerRequeued(string(class))
+				klog.Errorf("unable to sync: %s, requeuing in %s (%s error)", err, delay, class)
 			} else {
+				c.backoff.Forget()
 				c.workqueue.Forget(obj)
+				if delay := c.generator.ResyncAfter(); delay > 0 {
+					// changes are held back to be batched or
+					// until the maintenance window opens, sync
+					// again when they are due.
+					c.workqueue.AddAfter(workqueueKey, delay)
+				}
 				klog.V(4).Infof("event from workqueue successfully processed")
 			}
 		}()
@@ -413,6 +477,10 @@ func (c *Controller) handler() cache.ResourceEventHandlerFuncs {
 			if obj.GetNamespace() == kubeSystemNamespace && obj.GetName() != defaults.ClusterConfigName {
 				return
 			}
+			if storageCredentialsChanged(o, n) {
+				klog.Infof("storage credentials in secret %s changed, the image registry will be rolled out", newAccessor.GetName())
+				c.eventRecorder.Eventf("StorageCredentialsChanged", "Storage credentials in secret %s changed, rolling out the image registry", newAccessor.GetName())
+			}
 			klog.V(4).Infof("add event to workqueue due to %s (update)", utilObjectInfo(n))
 			c.workqueue.Add(workqueueKey)
 		},
@@ -440,6 +508,26 @@ func (c *Controller) handler() cache.ResourceEventHandlerFuncs {
 	}
 }
 
+// storageCredentialsChanged returns true if the provided objects are two
+// versions of a secret holding storage credentials with different data.
+func storageCredentialsChanged(o, n interface{}) bool {
+	oldSecret, ok := o.(*corev1.Secret)
+	if !ok {
+		return false
+	}
+	newSecret, ok := n.(*corev1.Secret)
+	if !ok {
+		return false
+	}
+	if newSecret.Namespace != defaults.ImageRegistryOperatorNamespace {
+		return false
+	}
+	if newSecret.Name != defaults.CloudCredentialsName && newSecret.Name != defaults.ImageRegistryPrivateConfigurationUser {
+		return false
+	}
+	return !reflect.DeepEqual(oldSecret.Data, newSecret.Data)
+}
+
 // Run starts the Controller.
 func (c *Controller) Run(stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
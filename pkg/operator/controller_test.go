@@ -0,0 +1,64 @@
+package operator
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestStorageCredentialsChanged(t *testing.T) {
+	secret := func(name, value string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+				Name:      name,
+			},
+			Data: map[string][]byte{
+				"credentials": []byte(value),
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		old, new interface{}
+		expected bool
+	}{
+		{
+			name:     "cloud credentials rotated",
+			old:      secret(defaults.CloudCredentialsName, "old"),
+			new:      secret(defaults.CloudCredentialsName, "new"),
+			expected: true,
+		},
+		{
+			name:     "user credentials rotated",
+			old:      secret(defaults.ImageRegistryPrivateConfigurationUser, "old"),
+			new:      secret(defaults.ImageRegistryPrivateConfigurationUser, "new"),
+			expected: true,
+		},
+		{
+			name: "cloud credentials metadata changed",
+			old:  secret(defaults.CloudCredentialsName, "old"),
+			new:  secret(defaults.CloudCredentialsName, "old"),
+		},
+		{
+			name: "other secret",
+			old:  secret(defaults.ImageRegistryPrivateConfiguration, "old"),
+			new:  secret(defaults.ImageRegistryPrivateConfiguration, "new"),
+		},
+		{
+			name: "not a secret",
+			old:  &corev1.ConfigMap{},
+			new:  &corev1.ConfigMap{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storageCredentialsChanged(tt.old, tt.new); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
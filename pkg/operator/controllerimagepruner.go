@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
@@ -23,12 +24,14 @@ import (
 	"k8s.io/klog/v2"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
 	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
 	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
 	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
@@ -117,6 +120,11 @@ func NewImagePrunerController(
 			c.listers.ImageConfigs = imageConfigInformer.Lister()
 			return imageConfigInformer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := kubeInformerFactory.Core().V1().Namespaces()
+			c.listers.Namespaces = informer.Lister()
+			return informer.Informer()
+		},
 	} {
 		informer := ctor()
 		if _, err := informer.AddEventHandler(c.handler()); err != nil {
@@ -212,6 +220,16 @@ func (c *ImagePrunerController) sync() error {
 
 	pcr = pcr.DeepCopy() // we don't want to change the cached version
 	prevPCR := pcr.DeepCopy()
+
+	metrics.ReportDeprecatedFields("imagepruners", deprecatedImagePrunerFields(pcr))
+	if migrated := migrateDeprecatedImagePrunerFields(pcr); len(migrated) > 0 {
+		klog.Infof("migrated deprecated fields in %s: %s", utilObjectInfo(pcr), strings.Join(migrated, "; "))
+		updatePrunerCondition(pcr, deprecatedFieldsMigratedCondition, operatorv1.OperatorCondition{
+			Status:  operatorv1.ConditionTrue,
+			Reason:  "Migrated",
+			Message: strings.Join(migrated, "; "),
+		})
+	}
 	prunerCronJob, err := c.listers.CronJobs.Get("image-pruner")
 	if errors.IsNotFound(err) {
 		prunerCronJob = nil
@@ -236,8 +254,9 @@ func (c *ImagePrunerController) sync() error {
 	if len(prunerJobs) > 0 {
 		sort.Sort(sort.Reverse(byCreationTimestamp(prunerJobs)))
 		for _, job := range prunerJobs {
-			// skip not finished jobs.
-			if len(job.Status.Conditions) == 0 {
+			// skip not finished jobs, including the ones waiting
+			// for the storage lock.
+			if !jobFinished(job) {
 				continue
 			}
 			lastPrunerJobConditions = job.Status.Conditions
@@ -247,6 +266,14 @@ func (c *ImagePrunerController) sync() error {
 
 	c.syncPrunerStatus(pcr, applyError, prunerCronJob, lastPrunerJobConditions)
 
+	registryConfig, err := c.listers.RegistryConfigs.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		registryConfig = nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get %q image registry resource: %s", defaults.ImageRegistryResourceName, err)
+	}
+	syncStorageDeletionCondition(pcr, registryConfig)
+
 	metadataChanged := strategy.Metadata(&prevPCR.ObjectMeta, &pcr.ObjectMeta)
 	specChanged := !reflect.DeepEqual(prevPCR.Spec, pcr.Spec)
 	if metadataChanged || specChanged {
@@ -0,0 +1,95 @@
+package operator
+
+import (
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+)
+
+// deprecatedFieldsMigratedCondition records the deprecated fields that were
+// last migrated by the operator into their replacements.
+const deprecatedFieldsMigratedCondition = "DeprecatedFieldsMigrated"
+
+// deprecatedFields returns the paths of the deprecated fields set in the
+// image registry config, including the ones the operator is able to migrate.
+func deprecatedFields(cr *imageregistryv1.Config) []string {
+	var fields []string
+	if cr.Spec.Logging != 0 {
+		fields = append(fields, "spec.logging")
+	}
+	for _, d := range storageDeprecations {
+		if d.used(&cr.Spec.Storage) {
+			fields = append(fields, d.field)
+		}
+	}
+	return fields
+}
+
+// deprecatedImagePrunerFields returns the paths of the deprecated fields set
+// in the image pruner config.
+func deprecatedImagePrunerFields(cr *imageregistryv1.ImagePruner) []string {
+	var fields []string
+	if cr.Spec.KeepYoungerThan != nil {
+		fields = append(fields, "spec.keepYoungerThan")
+	}
+	return fields
+}
+
+// migrateDeprecatedFields moves the values of deprecated fields in the image
+// registry config into the fields that replaced them. Fields are migrated
+// only if this can be done without changing the registry behaviour. It
+// returns a description of each migration that was performed.
+func migrateDeprecatedFields(cr *imageregistryv1.Config) []string {
+	var migrated []string
+
+	switch cr.Spec.LogLevel {
+	case operatorapiv1.Debug, operatorapiv1.Trace, operatorapiv1.TraceAll:
+		// logLevel takes precedence, logging is ignored.
+		if cr.Spec.Logging != 0 {
+			cr.Spec.Logging = 0
+			migrated = append(migrated, "spec.logging removed in favor of spec.logLevel")
+		}
+	case "", operatorapiv1.Normal:
+		switch {
+		case cr.Spec.Logging == 2 || cr.Spec.Logging == 3:
+			cr.Spec.LogLevel = operatorapiv1.Normal
+			cr.Spec.Logging = 0
+			migrated = append(migrated, "spec.logging migrated to spec.logLevel Normal")
+		case cr.Spec.Logging > 3 || cr.Spec.Logging < 0:
+			cr.Spec.LogLevel = operatorapiv1.Debug
+			cr.Spec.Logging = 0
+			migrated = append(migrated, "spec.logging migrated to spec.logLevel Debug")
+		}
+		// spec.logging 1 maps to the warn level, which spec.logLevel
+		// can't express, so it is left in place.
+	}
+
+	// The storage fields have no replacement in the registry config API:
+	// spec.storage.s3.encrypt and spec.storage.s3.keyID are the only way
+	// to configure the S3 encryption, the keyID is used to encrypt the
+	// bucket even when encrypt is false, and spec.storage.azure has no
+	// deprecated fields. The storage settings being retired are reported
+	// by the upgrade pre-check instead.
+
+	return migrated
+}
+
+// migrateDeprecatedImagePrunerFields moves the values of deprecated fields in
+// the image pruner config into the fields that replaced them. It returns a
+// description of each migration that was performed.
+func migrateDeprecatedImagePrunerFields(cr *imageregistryv1.ImagePruner) []string {
+	var migrated []string
+
+	if cr.Spec.KeepYoungerThan != nil {
+		if cr.Spec.KeepYoungerThanDuration == nil {
+			cr.Spec.KeepYoungerThanDuration = &metaapi.Duration{Duration: *cr.Spec.KeepYoungerThan}
+			migrated = append(migrated, "spec.keepYoungerThan migrated to spec.keepYoungerThanDuration")
+		} else {
+			migrated = append(migrated, "spec.keepYoungerThan removed in favor of spec.keepYoungerThanDuration")
+		}
+		cr.Spec.KeepYoungerThan = nil
+	}
+
+	return migrated
+}
@@ -0,0 +1,103 @@
+package operator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestMigrateDeprecatedFields(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		logging          int64
+		logLevel         operatorapiv1.LogLevel
+		expectedLogging  int64
+		expectedLogLevel operatorapiv1.LogLevel
+		migrated         bool
+	}{
+		{
+			name: "nothing to migrate",
+		},
+		{
+			name:             "info",
+			logging:          2,
+			expectedLogLevel: operatorapiv1.Normal,
+			migrated:         true,
+		},
+		{
+			name:             "debug",
+			logging:          4,
+			logLevel:         operatorapiv1.Normal,
+			expectedLogLevel: operatorapiv1.Debug,
+			migrated:         true,
+		},
+		{
+			name:            "warn has no replacement",
+			logging:         1,
+			expectedLogging: 1,
+		},
+		{
+			name:             "logLevel takes precedence",
+			logging:          1,
+			logLevel:         operatorapiv1.Trace,
+			expectedLogLevel: operatorapiv1.Trace,
+			migrated:         true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Logging = tt.logging
+			cr.Spec.LogLevel = tt.logLevel
+
+			migrated := migrateDeprecatedFields(cr)
+			if (len(migrated) > 0) != tt.migrated {
+				t.Errorf("got migrations %v, expected migration: %v", migrated, tt.migrated)
+			}
+			if cr.Spec.Logging != tt.expectedLogging {
+				t.Errorf("got logging %d, want %d", cr.Spec.Logging, tt.expectedLogging)
+			}
+			if cr.Spec.LogLevel != tt.expectedLogLevel {
+				t.Errorf("got logLevel %q, want %q", cr.Spec.LogLevel, tt.expectedLogLevel)
+			}
+		})
+	}
+}
+
+func TestDeprecatedFields(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	if fields := deprecatedFields(cr); len(fields) != 0 {
+		t.Errorf("got %v, want no deprecated fields", fields)
+	}
+
+	cr.Spec.Logging = 1
+	cr.Spec.Storage.Azure = &imageregistryv1.ImageRegistryConfigStorageAzure{CloudName: "AzureGermanCloud"}
+	expected := []string{"spec.logging", "spec.storage.azure.cloudName"}
+	if fields := deprecatedFields(cr); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("got %v, want %v", fields, expected)
+	}
+}
+
+func TestMigrateDeprecatedImagePrunerFields(t *testing.T) {
+	hour := time.Hour
+
+	cr := &imageregistryv1.ImagePruner{}
+	cr.Spec.KeepYoungerThan = &hour
+
+	migrated := migrateDeprecatedImagePrunerFields(cr)
+	if len(migrated) != 1 {
+		t.Fatalf("expected one migration, got %v", migrated)
+	}
+	if cr.Spec.KeepYoungerThan != nil {
+		t.Errorf("expected keepYoungerThan to be cleared")
+	}
+	if cr.Spec.KeepYoungerThanDuration == nil || cr.Spec.KeepYoungerThanDuration.Duration != hour {
+		t.Errorf("got keepYoungerThanDuration %v, want %v", cr.Spec.KeepYoungerThanDuration, hour)
+	}
+
+	if migrated := migrateDeprecatedImagePrunerFields(cr); len(migrated) != 0 {
+		t.Errorf("expected no further migrations, got %v", migrated)
+	}
+}
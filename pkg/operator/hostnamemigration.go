@@ -0,0 +1,430 @@
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imagev1client "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+// hostnameMigrationTTL is how long finished hostname migration jobs are
+// kept around, so their logs can be read.
+const hostnameMigrationTTL = int32(7 * 24 * 60 * 60)
+
+// hostnameReference is a reference to a former registry hostname found by
+// the hostname migration job.
+type hostnameReference struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Reference string `json:"reference"`
+	Rewritten bool   `json:"rewritten,omitempty"`
+}
+
+// hostnameMigrationReport is the result of a hostname migration job.
+type hostnameMigrationReport struct {
+	From       []string            `json:"from"`
+	To         string              `json:"to,omitempty"`
+	Namespaces []string            `json:"namespaces,omitempty"`
+	Rewrite    bool                `json:"rewrite"`
+	Time       time.Time           `json:"time"`
+	References []hostnameReference `json:"references"`
+	Errors     []string            `json:"errors,omitempty"`
+}
+
+// removedHostnames returns the hostnames in previous that are not in
+// current.
+func removedHostnames(previous, current []string) []string {
+	var removed []string
+	for _, hostname := range previous {
+		found := false
+		for _, h := range current {
+			if h == hostname {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, hostname)
+		}
+	}
+	return removed
+}
+
+// referenceHost returns the host of an image reference or of a docker config
+// entry, e.g. the host of https://registry.example.com/v1/ or of
+// registry.example.com/ns/name:tag.
+func referenceHost(reference string) string {
+	if i := strings.Index(reference, "://"); i >= 0 {
+		reference = reference[i+3:]
+	}
+	if i := strings.Index(reference, "/"); i >= 0 {
+		reference = reference[:i]
+	}
+	return strings.ToLower(reference)
+}
+
+// matchHostname returns the hostname in from the reference points to, or an
+// empty string.
+func matchHostname(reference string, from []string) string {
+	host := referenceHost(reference)
+	for _, hostname := range from {
+		if host == strings.ToLower(hostname) {
+			return hostname
+		}
+	}
+	return ""
+}
+
+// replaceHostname replaces the host of the reference with to.
+func replaceHostname(reference, to string) string {
+	host := referenceHost(reference)
+	i := strings.Index(strings.ToLower(reference), host)
+	return reference[:i] + to + reference[i+len(host):]
+}
+
+// migrateImageStream looks for references to the hostnames in from in the
+// spec of the image stream. When rewrite is set, they are replaced with to
+// in is.
+func migrateImageStream(is *imagev1.ImageStream, from []string, to string, rewrite bool) []hostnameReference {
+	var references []hostnameReference
+	check := func(reference *string) {
+		if matchHostname(*reference, from) == "" {
+			return
+		}
+		ref := hostnameReference{
+			Kind:      "ImageStream",
+			Namespace: is.Namespace,
+			Name:      is.Name,
+			Reference: *reference,
+		}
+		if rewrite && to != "" {
+			*reference = replaceHostname(*reference, to)
+			ref.Rewritten = true
+		}
+		references = append(references, ref)
+	}
+
+	if is.Spec.DockerImageRepository != "" {
+		check(&is.Spec.DockerImageRepository)
+	}
+	for i := range is.Spec.Tags {
+		if f := is.Spec.Tags[i].From; f != nil && f.Kind == "DockerImage" {
+			check(&f.Name)
+		}
+	}
+	return references
+}
+
+// migrateDockerConfig looks for entries for the hostnames in from in the
+// docker config data. The entries are under the auths key when nested is
+// set, as in .dockerconfigjson. When rewrite is set, the entries are moved
+// to to and the updated data is returned.
+func migrateDockerConfig(data []byte, nested bool, from []string, to string, rewrite bool) ([]string, []byte, error) {
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, err
+	}
+	auths := config
+	if nested {
+		auths = map[string]json.RawMessage{}
+		if raw, ok := config["auths"]; ok {
+			if err := json.Unmarshal(raw, &auths); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	var entries []string
+	for entry := range auths {
+		if matchHostname(entry, from) != "" {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+	if len(entries) == 0 || !rewrite || to == "" {
+		return entries, nil, nil
+	}
+
+	for _, entry := range entries {
+		newEntry := replaceHostname(entry, to)
+		// credentials already set for the new hostname are kept.
+		if _, ok := auths[newEntry]; !ok {
+			auths[newEntry] = auths[entry]
+		}
+		delete(auths, entry)
+	}
+	if nested {
+		raw, err := json.Marshal(auths)
+		if err != nil {
+			return nil, nil, err
+		}
+		config["auths"] = raw
+	}
+	updated, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, updated, nil
+}
+
+// migrateSecret looks for references to the hostnames in from in the pull
+// secret. When rewrite is set, they are replaced with to in secret, and true
+// is returned if the secret has been modified.
+func migrateSecret(secret *corev1.Secret, from []string, to string, rewrite bool) ([]hostnameReference, bool, error) {
+	var key string
+	var nested bool
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		key, nested = corev1.DockerConfigJsonKey, true
+	case corev1.SecretTypeDockercfg:
+		key, nested = corev1.DockerConfigKey, false
+	default:
+		return nil, false, nil
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entries, updated, err := migrateDockerConfig(data, nested, from, to, rewrite)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to parse the pull secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	var references []hostnameReference
+	for _, entry := range entries {
+		references = append(references, hostnameReference{
+			Kind:      "Secret",
+			Namespace: secret.Namespace,
+			Name:      secret.Name,
+			Reference: entry,
+			Rewritten: updated != nil,
+		})
+	}
+	if updated != nil {
+		secret.Data[key] = updated
+	}
+	return references, updated != nil, nil
+}
+
+// migrateHostnameReferences looks for image streams and pull secrets
+// referencing the hostnames in from in all the namespaces, and replaces them
+// with to in namespaces when rewrite is set. Objects that cannot be updated
+// are reported as errors and do not stop the migration.
+func migrateHostnameReferences(ctx context.Context, kubeClient kubeclient.Interface, imageClient imagev1client.ImageV1Interface, from []string, to string, namespaces []string, rewrite bool) (*hostnameMigrationReport, error) {
+	report := &hostnameMigrationReport{
+		From:       from,
+		To:         to,
+		Namespaces: namespaces,
+		Rewrite:    rewrite,
+		References: []hostnameReference{},
+	}
+	rewriteIn := map[string]bool{}
+	if rewrite {
+		for _, ns := range namespaces {
+			rewriteIn[ns] = true
+		}
+	}
+
+	opts := metav1.ListOptions{Limit: 500}
+	for {
+		imageStreams, err := imageClient.ImageStreams("").List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list image streams: %w", err)
+		}
+		for i := range imageStreams.Items {
+			is := &imageStreams.Items[i]
+			references := migrateImageStream(is, from, to, rewriteIn[is.Namespace])
+			if len(references) > 0 && references[0].Rewritten {
+				if _, err := imageClient.ImageStreams(is.Namespace).Update(ctx, is, metav1.UpdateOptions{}); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("unable to update the image stream %s/%s: %s", is.Namespace, is.Name, err))
+					for j := range references {
+						references[j].Rewritten = false
+					}
+				}
+			}
+			report.References = append(report.References, references...)
+		}
+		if imageStreams.Continue == "" {
+			break
+		}
+		opts.Continue = imageStreams.Continue
+	}
+
+	opts = metav1.ListOptions{Limit: 500}
+	for {
+		secrets, err := kubeClient.CoreV1().Secrets("").List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list secrets: %w", err)
+		}
+		for i := range secrets.Items {
+			secret := &secrets.Items[i]
+			references, modified, err := migrateSecret(secret, from, to, rewriteIn[secret.Namespace])
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+			if modified {
+				if _, err := kubeClient.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("unable to update the secret %s/%s: %s", secret.Namespace, secret.Name, err))
+					for j := range references {
+						references[j].Rewritten = false
+					}
+				}
+			}
+			report.References = append(report.References, references...)
+		}
+		if secrets.Continue == "" {
+			break
+		}
+		opts.Continue = secrets.Continue
+	}
+
+	report.Time = time.Now().UTC()
+	return report, nil
+}
+
+// RunHostnameMigration looks for image streams and pull secrets referencing
+// the former registry hostnames from, optionally replacing them with to in
+// namespaces, and stores the report in the hostname migration config map.
+func RunHostnameMigration(ctx context.Context, kubeconfig *restclient.Config, from []string, to string, namespaces []string, rewrite bool) error {
+	if len(from) == 0 {
+		return fmt.Errorf("at least one former hostname is required")
+	}
+	if rewrite && (to == "" || len(namespaces) == 0) {
+		return fmt.Errorf("the new hostname and the namespaces are required to rewrite references")
+	}
+
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageClient, err := imagev1client.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	report, err := migrateHostnameReferences(ctx, kubeClient, imageClient, from, to, namespaces, rewrite)
+	if err != nil {
+		return err
+	}
+	for _, ref := range report.References {
+		klog.Infof("%s %s/%s references %s (rewritten: %t)", ref.Kind, ref.Namespace, ref.Name, ref.Reference, ref.Rewritten)
+	}
+	for _, e := range report.Errors {
+		klog.Errorf("%s", e)
+	}
+	klog.Infof("hostname migration complete: %d references to %s found", len(report.References), strings.Join(from, ", "))
+	return writeReport(ctx, kubeClient, defaults.HostnameMigrationName, defaults.HostnameMigrationReportKey, report)
+}
+
+// hostnameMigrationJob returns the job looking for references to the former
+// registry hostnames from. The job name is derived from its arguments, so a
+// change is only migrated once.
+func hostnameMigrationJob(from []string, to string, namespaces []string, rewrite bool) *batchv1.Job {
+	args := []string{"cluster-image-registry-operator", "hostname-migration"}
+	for _, hostname := range from {
+		args = append(args, "--from="+hostname)
+	}
+	if to != "" {
+		args = append(args, "--to="+to)
+	}
+	for _, ns := range namespaces {
+		args = append(args, "--namespace="+ns)
+	}
+	if rewrite {
+		args = append(args, "--rewrite")
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(from, ",") + ">" + to + "@" + strings.Join(namespaces, ",")))
+	name := fmt.Sprintf("%s-%x", defaults.HostnameMigrationName, hash[:4])
+
+	backoffLimit := int32(0)
+	ttl := hostnameMigrationTTL
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Labels: map[string]string{
+				"created-by": defaults.HostnameMigrationName,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: defaults.OperatorServiceAccountName,
+					PriorityClassName:  "openshift-user-critical",
+					NodeSelector: map[string]string{
+						"kubernetes.io/os": "linux",
+					},
+					Containers: []corev1.Container{
+						{
+							Name:                     defaults.HostnameMigrationName,
+							Image:                    os.Getenv("OPERATOR_IMAGE"),
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							Command:                  args,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// startHostnameMigration starts the hostname migration job when hostnames
+// have been removed from the registry routes and the user has enabled it.
+// References are only rewritten to the target hostname chosen by the user,
+// in the namespaces chosen by the user.
+func startHostnameMigration(ctx context.Context, client batchset.BatchV1Interface, overrides *resource.HostnameMigrationOverrides, previous, current []string) error {
+	if overrides == nil || !overrides.Enabled {
+		return nil
+	}
+	from := removedHostnames(previous, current)
+	if len(from) == 0 {
+		return nil
+	}
+
+	var to string
+	var namespaces []string
+	if overrides.Rewrite {
+		if overrides.Target == "" || len(overrides.Namespaces) == 0 {
+			return fmt.Errorf("the hostname migration requires a target hostname and namespaces to rewrite references")
+		}
+		if len(removedHostnames([]string{overrides.Target}, current)) > 0 {
+			return fmt.Errorf("the hostname migration target %s is not a hostname of the registry routes", overrides.Target)
+		}
+		to, namespaces = overrides.Target, overrides.Namespaces
+	}
+
+	job := hostnameMigrationJob(from, to, namespaces, overrides.Rewrite)
+	_, err := client.Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to start the hostname migration job: %w", err)
+	}
+	klog.Infof("started job %s looking for references to the former registry hostnames %s", job.Name, strings.Join(from, ", "))
+	return nil
+}
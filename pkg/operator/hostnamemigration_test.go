@@ -0,0 +1,253 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imagev1 "github.com/openshift/api/image/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+func TestMigrateImageStream(t *testing.T) {
+	newImageStream := func(repository, from string) *imagev1.ImageStream {
+		return &imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "is"},
+			Spec: imagev1.ImageStreamSpec{
+				DockerImageRepository: repository,
+				Tags: []imagev1.TagReference{
+					{Name: "latest", From: &corev1.ObjectReference{Kind: "DockerImage", Name: from}},
+					{Name: "other", From: &corev1.ObjectReference{Kind: "ImageStreamTag", Name: "is:latest"}},
+				},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name       string
+		is         *imagev1.ImageStream
+		rewrite    bool
+		references int
+		expected   *imagev1.ImageStream
+	}{
+		{
+			name:     "no references",
+			is:       newImageStream("", "quay.io/ns/app:1"),
+			expected: newImageStream("", "quay.io/ns/app:1"),
+		},
+		{
+			name:       "report",
+			is:         newImageStream("old.example.com/ns/app", "OLD.example.com/ns/app:1"),
+			references: 2,
+			expected:   newImageStream("old.example.com/ns/app", "OLD.example.com/ns/app:1"),
+		},
+		{
+			name:       "rewrite",
+			is:         newImageStream("", "old.example.com/ns/app@sha256:abc"),
+			rewrite:    true,
+			references: 1,
+			expected:   newImageStream("", "new.example.com/ns/app@sha256:abc"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			references := migrateImageStream(tt.is, []string{"old.example.com"}, "new.example.com", tt.rewrite)
+			if len(references) != tt.references {
+				t.Errorf("got %d references, want %d: %#v", len(references), tt.references, references)
+			}
+			for _, ref := range references {
+				if ref.Rewritten != tt.rewrite {
+					t.Errorf("got rewritten %t, want %t", ref.Rewritten, tt.rewrite)
+				}
+			}
+			if !reflect.DeepEqual(tt.is, tt.expected) {
+				t.Errorf("got %#v, want %#v", tt.is.Spec, tt.expected.Spec)
+			}
+		})
+	}
+}
+
+func TestMigrateSecret(t *testing.T) {
+	auth := json.RawMessage(`{"auth":"dXNlcjpwYXNz"}`)
+	for _, tt := range []struct {
+		name       string
+		secretType corev1.SecretType
+		data       string
+		rewrite    bool
+		references int
+		expected   map[string]json.RawMessage
+	}{
+		{
+			name:       "dockerconfigjson report",
+			secretType: corev1.SecretTypeDockerConfigJson,
+			data:       `{"auths":{"old.example.com":{"auth":"dXNlcjpwYXNz"},"quay.io":{"auth":"dXNlcjpwYXNz"}}}`,
+			references: 1,
+		},
+		{
+			name:       "dockerconfigjson rewrite",
+			secretType: corev1.SecretTypeDockerConfigJson,
+			data:       `{"auths":{"https://old.example.com/v1/":{"auth":"dXNlcjpwYXNz"},"quay.io":{"auth":"dXNlcjpwYXNz"}}}`,
+			rewrite:    true,
+			references: 1,
+			expected:   map[string]json.RawMessage{"https://new.example.com/v1/": auth, "quay.io": auth},
+		},
+		{
+			name:       "dockercfg rewrite",
+			secretType: corev1.SecretTypeDockercfg,
+			data:       `{"old.example.com":{"auth":"dXNlcjpwYXNz"}}`,
+			rewrite:    true,
+			references: 1,
+			expected:   map[string]json.RawMessage{"new.example.com": auth},
+		},
+		{
+			name:       "opaque",
+			secretType: corev1.SecretTypeOpaque,
+			data:       `{"old.example.com":{}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			key := corev1.DockerConfigJsonKey
+			if tt.secretType != corev1.SecretTypeDockerConfigJson {
+				key = corev1.DockerConfigKey
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pull-secret"},
+				Type:       tt.secretType,
+				Data:       map[string][]byte{key: []byte(tt.data)},
+			}
+
+			references, modified, err := migrateSecret(secret, []string{"old.example.com"}, "new.example.com", tt.rewrite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(references) != tt.references {
+				t.Errorf("got %d references, want %d: %#v", len(references), tt.references, references)
+			}
+			if modified != (tt.expected != nil) {
+				t.Fatalf("got modified %t, want %t", modified, tt.expected != nil)
+			}
+			if !modified {
+				if string(secret.Data[key]) != tt.data {
+					t.Errorf("got data %s, want it unchanged", secret.Data[key])
+				}
+				return
+			}
+
+			auths := map[string]json.RawMessage{}
+			if tt.secretType == corev1.SecretTypeDockerConfigJson {
+				var config struct {
+					Auths map[string]json.RawMessage `json:"auths"`
+				}
+				if err := json.Unmarshal(secret.Data[key], &config); err != nil {
+					t.Fatal(err)
+				}
+				auths = config.Auths
+			} else if err := json.Unmarshal(secret.Data[key], &auths); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(auths, tt.expected) {
+				t.Errorf("got %s, want %s", auths, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStartHostnameMigration(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides *resource.HostnameMigrationOverrides
+		previous  []string
+		current   []string
+		command   []string
+		err       bool
+	}{
+		{
+			name:     "disabled",
+			previous: []string{"old.example.com"},
+			current:  []string{"new.example.com"},
+		},
+		{
+			name:      "hostname added",
+			overrides: &resource.HostnameMigrationOverrides{Enabled: true},
+			previous:  []string{"old.example.com"},
+			current:   []string{"old.example.com", "new.example.com"},
+		},
+		{
+			name:      "hostname changed",
+			overrides: &resource.HostnameMigrationOverrides{Enabled: true},
+			previous:  []string{"old.example.com"},
+			current:   []string{"new.example.com"},
+			command:   []string{"cluster-image-registry-operator", "hostname-migration", "--from=old.example.com"},
+		},
+		{
+			name:      "rewrite",
+			overrides: &resource.HostnameMigrationOverrides{Enabled: true, Rewrite: true, Target: "new.example.com", Namespaces: []string{"team-a", "team-b"}},
+			previous:  []string{"old.example.com"},
+			current:   []string{"other.example.com", "new.example.com"},
+			command:   []string{"cluster-image-registry-operator", "hostname-migration", "--from=old.example.com", "--to=new.example.com", "--namespace=team-a", "--namespace=team-b", "--rewrite"},
+		},
+		{
+			name:      "rewrite without target",
+			overrides: &resource.HostnameMigrationOverrides{Enabled: true, Rewrite: true, Namespaces: []string{"team-a"}},
+			previous:  []string{"old.example.com"},
+			current:   []string{"new.example.com"},
+			err:       true,
+		},
+		{
+			name:      "rewrite to an unknown hostname",
+			overrides: &resource.HostnameMigrationOverrides{Enabled: true, Rewrite: true, Target: "typo.example.com", Namespaces: []string{"team-a"}},
+			previous:  []string{"old.example.com"},
+			current:   []string{"new.example.com"},
+			err:       true,
+		},
+		{
+			name:      "route removed",
+			overrides: &resource.HostnameMigrationOverrides{Enabled: true},
+			previous:  []string{"old.example.com"},
+			command:   []string{"cluster-image-registry-operator", "hostname-migration", "--from=old.example.com"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			ctx := context.Background()
+
+			err := startHostnameMigration(ctx, client.BatchV1(), tt.overrides, tt.previous, tt.current)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a second sync with the same hostnames doesn't start another
+			// job.
+			if err := startHostnameMigration(ctx, client.BatchV1(), tt.overrides, tt.previous, tt.current); err != nil {
+				t.Fatal(err)
+			}
+
+			jobs, err := client.BatchV1().Jobs("").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.command == nil {
+				if len(jobs.Items) != 0 {
+					t.Errorf("got %d jobs, want none", len(jobs.Items))
+				}
+				return
+			}
+			if len(jobs.Items) != 1 {
+				t.Fatalf("got %d jobs, want 1", len(jobs.Items))
+			}
+			if command := jobs.Items[0].Spec.Template.Spec.Containers[0].Command; !reflect.DeepEqual(command, tt.command) {
+				t.Errorf("got command %q, want %q", command, tt.command)
+			}
+		})
+	}
+}
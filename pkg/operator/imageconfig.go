@@ -3,6 +3,7 @@ package operator
 import (
 	"context"
 	"fmt"
+	"net"
 	"reflect"
 	"sort"
 	"strings"
@@ -15,6 +16,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	corev1informers "k8s.io/client-go/informers/core/v1"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
@@ -23,6 +25,8 @@ import (
 	configapi "github.com/openshift/api/config/v1"
 	operatorv1 "github.com/openshift/api/operator/v1"
 	configset "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
 	routev1informers "github.com/openshift/client-go/route/informers/externalversions/route/v1"
 	routev1lister "github.com/openshift/client-go/route/listers/route/v1"
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
@@ -31,31 +35,47 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
+// internalRegistryHostnameReachableCondition reports whether the internal
+// registry hostname set by the admin can be reached. It is only present when
+// the operator does not manage the hostname.
+const internalRegistryHostnameReachableCondition = "InternalRegistryHostnameReachable"
+
 // ImageConfigController controls image.config.openshift.io/cluster.
 //
 // Watches for changes on image registry routes and services, updating
 // the resource status appropriately.
 type ImageConfigController struct {
-	configClient   configset.ConfigV1Interface
-	operatorClient v1helpers.OperatorClient
-	routeLister    routev1lister.RouteNamespaceLister
-	serviceLister  corev1listers.ServiceNamespaceLister
-	cachesToSync   []cache.InformerSynced
-	queue          workqueue.RateLimitingInterface
+	configClient         configset.ConfigV1Interface
+	batchClient          batchset.BatchV1Interface
+	operatorClient       v1helpers.OperatorClient
+	routeLister          routev1lister.RouteNamespaceLister
+	serviceLister        corev1listers.ServiceNamespaceLister
+	registryConfigLister imageregistryv1listers.ConfigLister
+	cachesToSync         []cache.InformerSynced
+	queue                workqueue.RateLimitingInterface
+
+	// dial is used to verify that an internal registry hostname that is
+	// not managed by the operator is reachable.
+	dial func(ctx context.Context, network, address string) (net.Conn, error)
 }
 
 func NewImageConfigController(
 	configClient configset.ConfigV1Interface,
+	batchClient batchset.BatchV1Interface,
 	operatorClient v1helpers.OperatorClient,
 	routeInformer routev1informers.RouteInformer,
 	serviceInformer corev1informers.ServiceInformer,
+	registryConfigInformer imageregistryv1informers.ConfigInformer,
 ) (*ImageConfigController, error) {
 	icc := &ImageConfigController{
-		configClient:   configClient,
-		operatorClient: operatorClient,
-		routeLister:    routeInformer.Lister().Routes(defaults.ImageRegistryOperatorNamespace),
-		serviceLister:  serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
-		queue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageConfigController"),
+		configClient:         configClient,
+		batchClient:          batchClient,
+		operatorClient:       operatorClient,
+		routeLister:          routeInformer.Lister().Routes(defaults.ImageRegistryOperatorNamespace),
+		serviceLister:        serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
+		registryConfigLister: registryConfigInformer.Lister(),
+		queue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageConfigController"),
+		dial:                 (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
 	}
 
 	if _, err := serviceInformer.Informer().AddEventHandler(icc.eventHandler()); err != nil {
@@ -68,6 +88,11 @@ func NewImageConfigController(
 	}
 	icc.cachesToSync = append(icc.cachesToSync, routeInformer.Informer().HasSynced)
 
+	if _, err := registryConfigInformer.Informer().AddEventHandler(icc.eventHandler()); err != nil {
+		return nil, err
+	}
+	icc.cachesToSync = append(icc.cachesToSync, registryConfigInformer.Informer().HasSynced)
+
 	return icc, nil
 }
 
@@ -119,11 +144,79 @@ func (icc *ImageConfigController) processNextWorkItem() bool {
 	return true
 }
 
-// sync keeps image.config.openshift.io/cluster status updated.
-func (icc *ImageConfigController) syncImageStatus() error {
+// internalHostnameManaged returns false if the admin has taken over the
+// management of the internal registry hostname.
+func (icc *ImageConfigController) internalHostnameManaged() (bool, error) {
+	cr, err := icc.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	overrides, err := resource.GetConfigOverrides(cr)
+	if err != nil {
+		return false, err
+	}
+	if overrides.ImageConfig == nil {
+		return true, nil
+	}
+	switch state := overrides.ImageConfig.InternalRegistryHostnameManagementState; state {
+	case "", operatorv1.Managed:
+		return true, nil
+	case operatorv1.Unmanaged:
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid internal registry hostname management state %q, expected %s or %s", state, operatorv1.Managed, operatorv1.Unmanaged)
+	}
+}
+
+// hostnameMigrationOverrides returns the configuration of the job looking
+// for references to former registry hostnames.
+func (icc *ImageConfigController) hostnameMigrationOverrides() (*resource.HostnameMigrationOverrides, error) {
+	cr, err := icc.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	overrides, err := resource.GetConfigOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	return overrides.HostnameMigration, nil
+}
+
+// checkHostnameReachable verifies that a connection can be established to
+// the provided registry hostname. The https port is assumed when the
+// hostname has no port.
+func (icc *ImageConfigController) checkHostnameReachable(hostname string) error {
+	if hostname == "" {
+		return fmt.Errorf("the internal registry hostname is not set")
+	}
+
+	address := hostname
+	if _, _, err := net.SplitHostPort(hostname); err != nil {
+		address = net.JoinHostPort(hostname, "443")
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+	conn, err := icc.dial(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("the internal registry hostname %s is not reachable: %w", hostname, err)
+	}
+	return conn.Close()
+}
+
+// sync keeps image.config.openshift.io/cluster status updated. When the
+// internal registry hostname is not managed by the operator, its
+// reachability is returned.
+func (icc *ImageConfigController) syncImageStatus() (*operatorv1.OperatorCondition, error) {
 	cfg, err := icc.configClient.Images().Get(context.TODO(), defaults.ImageConfigName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		return err
+		return nil, err
 	}
 
 	if errors.IsNotFound(err) {
@@ -136,42 +229,72 @@ func (icc *ImageConfigController) syncImageStatus() error {
 			},
 			metav1.CreateOptions{},
 		); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	externalHostnames, err := icc.getRouteHostnames()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	internalHostname, err := icc.getServiceHostname()
+	internalHostnameManaged, err := icc.internalHostnameManaged()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	modified := false
 	if !reflect.DeepEqual(externalHostnames, cfg.Status.ExternalRegistryHostnames) {
+		overrides, err := icc.hostnameMigrationOverrides()
+		if err == nil {
+			err = startHostnameMigration(context.TODO(), icc.batchClient, overrides, cfg.Status.ExternalRegistryHostnames, externalHostnames)
+		}
+		if err != nil {
+			// the former hostnames stay published until the job
+			// has started, otherwise they would be lost for the
+			// next attempt.
+			return nil, fmt.Errorf("unable to migrate the references to the former registry hostnames: %w", err)
+		}
 		cfg.Status.ExternalRegistryHostnames = externalHostnames
 		modified = true
 	}
-	if cfg.Status.InternalRegistryHostname != internalHostname {
-		cfg.Status.InternalRegistryHostname = internalHostname
-		modified = true
+	if internalHostnameManaged {
+		internalHostname, err := icc.getServiceHostname()
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Status.InternalRegistryHostname != internalHostname {
+			cfg.Status.InternalRegistryHostname = internalHostname
+			modified = true
+		}
 	}
 
 	if modified {
 		if _, err := icc.configClient.Images().UpdateStatus(context.TODO(), cfg, metav1.UpdateOptions{}); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	if internalHostnameManaged {
+		return nil, nil
+	}
+	reachable := &operatorv1.OperatorCondition{
+		Type:    internalRegistryHostnameReachableCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("The internal registry hostname %s is reachable", cfg.Status.InternalRegistryHostname),
+	}
+	if err := icc.checkHostnameReachable(cfg.Status.InternalRegistryHostname); err != nil {
+		reachable.Status = operatorv1.ConditionFalse
+		reachable.Reason = "Unreachable"
+		reachable.Message = err.Error()
+	}
+	return reachable, nil
 }
 
 func (icc *ImageConfigController) sync() error {
 	ctx := context.TODO()
-	err := icc.syncImageStatus()
+	reachable, err := icc.syncImageStatus()
 	if err != nil {
 		_, _, updateError := v1helpers.UpdateStatus(
 			ctx,
@@ -185,9 +308,18 @@ func (icc *ImageConfigController) sync() error {
 		return utilerrors.NewAggregate([]error{err, updateError})
 	}
 
+	reachableFn := func(status *operatorv1.OperatorStatus) error {
+		v1helpers.RemoveOperatorCondition(&status.Conditions, internalRegistryHostnameReachableCondition)
+		return nil
+	}
+	if reachable != nil {
+		reachableFn = v1helpers.UpdateConditionFn(*reachable)
+	}
+
 	_, _, err = v1helpers.UpdateStatus(
 		ctx,
 		icc.operatorClient,
+		reachableFn,
 		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
 			Type:   "ImageConfigControllerDegraded",
 			Status: operatorv1.ConditionFalse,
@@ -0,0 +1,197 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configapi "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	fakeconfig "github.com/openshift/client-go/config/clientset/versioned/fake"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	routev1lister "github.com/openshift/client-go/route/listers/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestSyncImageStatusInternalHostname(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		overrides         string
+		dialErr           error
+		expectedHostname  string
+		expectedCondition operatorv1.ConditionStatus
+	}{
+		{
+			name:             "managed",
+			expectedHostname: "image-registry.openshift-image-registry.svc:5000",
+		},
+		{
+			name:              "unmanaged and reachable",
+			overrides:         `{"imageConfig":{"internalRegistryHostnameManagementState":"Unmanaged"}}`,
+			expectedHostname:  "registry.mesh.local",
+			expectedCondition: operatorv1.ConditionTrue,
+		},
+		{
+			name:              "unmanaged and unreachable",
+			overrides:         `{"imageConfig":{"internalRegistryHostnameManagementState":"Unmanaged"}}`,
+			dialErr:           errors.New("no such host"),
+			expectedHostname:  "registry.mesh.local",
+			expectedCondition: operatorv1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			configClient := fakeconfig.NewSimpleClientset(&configapi.Image{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageConfigName},
+				Status: configapi.ImageStatus{
+					InternalRegistryHostname: "registry.mesh.local",
+				},
+			})
+
+			serviceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := serviceIndexer.Add(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+					Name:      defaults.ServiceName,
+				},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{{Port: 5000}},
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			registryConfigIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+			}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			if err := registryConfigIndexer.Add(cr); err != nil {
+				t.Fatal(err)
+			}
+
+			var dialed string
+			icc := &ImageConfigController{
+				configClient:         configClient.ConfigV1(),
+				routeLister:          routev1lister.NewRouteLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})).Routes(defaults.ImageRegistryOperatorNamespace),
+				serviceLister:        corev1listers.NewServiceLister(serviceIndexer).Services(defaults.ImageRegistryOperatorNamespace),
+				registryConfigLister: imageregistryv1listers.NewConfigLister(registryConfigIndexer),
+				dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+					dialed = address
+					if tt.dialErr != nil {
+						return nil, tt.dialErr
+					}
+					client, server := net.Pipe()
+					server.Close()
+					return client, nil
+				},
+			}
+
+			reachable, err := icc.syncImageStatus()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			cfg, err := configClient.ConfigV1().Images().Get(context.Background(), defaults.ImageConfigName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Status.InternalRegistryHostname != tt.expectedHostname {
+				t.Errorf("got internal hostname %q, want %q", cfg.Status.InternalRegistryHostname, tt.expectedHostname)
+			}
+
+			if tt.expectedCondition == "" {
+				if reachable != nil {
+					t.Errorf("unexpected condition %#v", reachable)
+				}
+				return
+			}
+			if reachable == nil || reachable.Status != tt.expectedCondition {
+				t.Errorf("got condition %#v, want status %s", reachable, tt.expectedCondition)
+			}
+			if dialed != "registry.mesh.local:443" {
+				t.Errorf("got dialed address %q, want %q", dialed, "registry.mesh.local:443")
+			}
+		})
+	}
+}
+
+func TestSyncImageStatusHostnameMigration(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		overrides         string
+		expectErr         bool
+		expectedHostnames []string
+		expectedJobs      int
+	}{
+		{
+			name:         "job started",
+			overrides:    `{"hostnameMigration":{"enabled":true}}`,
+			expectedJobs: 1,
+		},
+		{
+			name:              "job not started",
+			overrides:         `{"hostnameMigration":{"enabled":true,"rewrite":true}}`,
+			expectErr:         true,
+			expectedHostnames: []string{"registry.example.com"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			configClient := fakeconfig.NewSimpleClientset(&configapi.Image{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageConfigName},
+				Status: configapi.ImageStatus{
+					ExternalRegistryHostnames: []string{"registry.example.com"},
+				},
+			})
+			kubeClient := fake.NewSimpleClientset()
+
+			registryConfigIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+			}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			if err := registryConfigIndexer.Add(cr); err != nil {
+				t.Fatal(err)
+			}
+
+			icc := &ImageConfigController{
+				configClient:         configClient.ConfigV1(),
+				batchClient:          kubeClient.BatchV1(),
+				routeLister:          routev1lister.NewRouteLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})).Routes(defaults.ImageRegistryOperatorNamespace),
+				serviceLister:        corev1listers.NewServiceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})).Services(defaults.ImageRegistryOperatorNamespace),
+				registryConfigLister: imageregistryv1listers.NewConfigLister(registryConfigIndexer),
+			}
+
+			_, err := icc.syncImageStatus()
+			if tt.expectErr && err == nil {
+				t.Errorf("expected an error")
+			} else if !tt.expectErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			cfg, err := configClient.ConfigV1().Images().Get(context.Background(), defaults.ImageConfigName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.Status.ExternalRegistryHostnames, tt.expectedHostnames) {
+				t.Errorf("got external hostnames %v, want %v", cfg.Status.ExternalRegistryHostnames, tt.expectedHostnames)
+			}
+			jobs, err := kubeClient.BatchV1().Jobs(defaults.ImageRegistryOperatorNamespace).List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs.Items) != tt.expectedJobs {
+				t.Errorf("got %d jobs, want %d", len(jobs.Items), tt.expectedJobs)
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package operator
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/wait"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 
@@ -14,21 +18,28 @@ import (
 	imageinformers "github.com/openshift/client-go/image/informers/externalversions/image/v1"
 	imagelisters "github.com/openshift/client-go/image/listers/image/v1"
 
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
 )
 
 // MetricsController is a controller that runs from time to time and reports some metrics about
 // the current status of the system.
 type MetricsController struct {
-	lister imagelisters.ImageStreamLister
-	caches []cache.InformerSynced
+	lister          imagelisters.ImageStreamLister
+	configMapLister corev1listers.ConfigMapNamespaceLister
+	caches          []cache.InformerSynced
 }
 
 // NewMetricsController returns a new MetricsController.
-func NewMetricsController(informer imageinformers.ImageStreamInformer) *MetricsController {
+func NewMetricsController(informer imageinformers.ImageStreamInformer, configMapInformer corev1informers.ConfigMapInformer) *MetricsController {
 	return &MetricsController{
-		lister: informer.Lister(),
-		caches: []cache.InformerSynced{informer.Informer().HasSynced},
+		lister:          informer.Lister(),
+		configMapLister: configMapInformer.Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		caches: []cache.InformerSynced{
+			informer.Informer().HasSynced,
+			configMapInformer.Informer().HasSynced,
+		},
 	}
 }
 
@@ -59,6 +70,28 @@ func (m *MetricsController) report(_ context.Context) {
 
 	metrics.ReportOpenShiftImageStreamTags(importedOpenShift, pushedOpenShift)
 	metrics.ReportOtherImageStreamTags(importedOther, pushedOther)
+
+	m.reportStorageInventory()
+}
+
+// reportStorageInventory reports the metrics gathered by the last run of the
+// storage inventory job, if any.
+func (m *MetricsController) reportStorageInventory() {
+	cm, err := m.configMapLister.Get(defaults.StorageInventoryName)
+	if errors.IsNotFound(err) {
+		return
+	} else if err != nil {
+		klog.Errorf("unable to get storage inventory report: %s", err)
+		return
+	}
+
+	var report inventory.Report
+	if err := json.Unmarshal([]byte(cm.Data[defaults.StorageInventoryReportKey]), &report); err != nil {
+		klog.Errorf("unable to parse storage inventory report: %s", err)
+		return
+	}
+
+	metrics.ReportStorageInventory(report.Objects, report.Bytes, report.Sizes, report.Time)
 }
 
 // assessImageStream returns the number of imported and the number of pushed tags for the provided
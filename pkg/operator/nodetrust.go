@@ -0,0 +1,424 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+)
+
+const (
+	// nodeTrustPropagatedCondition reports whether the CA bundles of the
+	// registry hostnames are installed on the sampled nodes.
+	nodeTrustPropagatedCondition = "NodeTrustPropagated"
+
+	// nodeTrustVerificationLabel is set on the verification pods.
+	nodeTrustVerificationLabel = "node-trust-verification"
+
+	// nodeTrustVerificationDelay is for how long the verification waits
+	// after the registry certificates change, node-ca copies the CA
+	// bundles to the nodes every minute.
+	nodeTrustVerificationDelay = 2 * time.Minute
+
+	// nodeTrustVerificationInterval is how often the nodes are verified
+	// when the registry certificates do not change.
+	nodeTrustVerificationInterval = time.Hour
+
+	// nodeTrustVerificationTimeout bounds the run of a verification pod.
+	nodeTrustVerificationTimeout = 2 * time.Minute
+
+	// zoneLabel is the label holding the zone of a node.
+	zoneLabel = "topology.kubernetes.io/zone"
+)
+
+// nodeTrustPollInterval is how often the verification pods are checked for
+// completion.
+var nodeTrustPollInterval = 2 * time.Second
+
+// nodeTrustScript compares the CA bundles of the image-registry-certificates
+// config map with the ones node-ca installed for the container runtime,
+// using the same file naming as node-ca.
+const nodeTrustScript = `stale=""
+for f in $(ls /tmp/serviceca); do
+    host=$(echo $f | sed -r 's/(.*)\.\./\1:/')
+    installed="/etc/docker/certs.d/${host}/ca.crt"
+    if [ ! -e "${installed}" ] || [ "$(cat /tmp/serviceca/${f})" != "$(cat ${installed})" ]; then
+        stale="${stale} ${host}"
+    fi
+done
+if [ -n "${stale}" ]; then
+    echo "missing or outdated CA bundle for${stale}" > /dev/termination-log
+    exit 1
+fi
+`
+
+// NodeTrustVerificationController verifies that the CA bundles node-ca
+// installs on the nodes match the registry certificates, by running a short
+// lived pod on a node of every zone. Nodes that do not trust the registry
+// otherwise go unnoticed until image pulls fail on them.
+type NodeTrustVerificationController struct {
+	operatorClient  v1helpers.OperatorClient
+	coreClient      coreset.CoreV1Interface
+	configLister    imageregistryv1listers.ConfigLister
+	configMapLister corev1listers.ConfigMapNamespaceLister
+
+	// lastVerified is the checksum of the registry certificates verified
+	// by the last run, at lastRun.
+	lastVerified string
+	lastRun      time.Time
+	// round rotates the nodes sampled in every zone.
+	round int
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.RateLimitingInterface
+}
+
+func NewNodeTrustVerificationController(
+	operatorClient v1helpers.OperatorClient,
+	coreClient coreset.CoreV1Interface,
+	configInformer imageregistryv1informers.ConfigInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
+) (*NodeTrustVerificationController, error) {
+	c := &NodeTrustVerificationController{
+		operatorClient:  operatorClient,
+		coreClient:      coreClient,
+		configLister:    configInformer.Lister(),
+		configMapLister: configMapInformer.Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		queue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "NodeTrustVerificationController"),
+	}
+
+	if _, err := configInformer.Informer().AddEventHandler(c.eventHandler(0)); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, configInformer.Informer().HasSynced)
+
+	// give node-ca time to install the new certificates.
+	if _, err := configMapInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			cm, ok := obj.(*corev1.ConfigMap)
+			return ok && cm.Name == defaults.ImageRegistryCertificatesName
+		},
+		Handler: c.eventHandler(nodeTrustVerificationDelay),
+	}); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, configMapInformer.Informer().HasSynced)
+
+	return c, nil
+}
+
+func (c *NodeTrustVerificationController) eventHandler(delay time.Duration) cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.AddAfter(workQueueKey, delay) },
+		UpdateFunc: func(old, new interface{}) { c.queue.AddAfter(workQueueKey, delay) },
+		DeleteFunc: func(obj interface{}) { c.queue.AddAfter(workQueueKey, delay) },
+	}
+}
+
+func (c *NodeTrustVerificationController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *NodeTrustVerificationController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("NodeTrustVerificationController: got event from workqueue")
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("NodeTrustVerificationController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("NodeTrustVerificationController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// nodeReady returns true if pods can run on the node.
+func nodeReady(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	if nodeOS, ok := node.Labels["kubernetes.io/os"]; ok && nodeOS != "linux" {
+		return false
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// sampleNodes picks a ready node in every zone, a different one in every
+// round when the zone has several.
+func sampleNodes(nodes []corev1.Node, round int) []*corev1.Node {
+	zones := map[string][]*corev1.Node{}
+	for i := range nodes {
+		node := &nodes[i]
+		if !nodeReady(node) {
+			continue
+		}
+		zone := node.Labels[zoneLabel]
+		zones[zone] = append(zones[zone], node)
+	}
+
+	var sampled []*corev1.Node
+	for _, zoneNodes := range zones {
+		sort.Slice(zoneNodes, func(i, j int) bool {
+			return zoneNodes[i].Name < zoneNodes[j].Name
+		})
+		sampled = append(sampled, zoneNodes[round%len(zoneNodes)])
+	}
+	sort.Slice(sampled, func(i, j int) bool {
+		return sampled[i].Name < sampled[j].Name
+	})
+	return sampled
+}
+
+// verificationPod returns a pod that checks the CA bundles installed on the
+// node.
+func verificationPod(node *corev1.Node) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: nodeTrustVerificationLabel + "-",
+			Namespace:    defaults.ImageRegistryOperatorNamespace,
+			Labels: map[string]string{
+				"app": nodeTrustVerificationLabel,
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:           node.Name,
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: "node-ca",
+			Tolerations: []corev1.Toleration{
+				{Operator: corev1.TolerationOpExists},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "verify",
+					Image:   os.Getenv("IMAGE"),
+					Command: []string{"/bin/sh", "-c", nodeTrustScript},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: pointer.Bool(true),
+						RunAsUser:  pointer.Int64(1001),
+						RunAsGroup: pointer.Int64(0),
+					},
+					TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "serviceca", MountPath: "/tmp/serviceca"},
+						{Name: "host", MountPath: "/etc/docker/certs.d", ReadOnly: true},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "host",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: "/etc/docker/certs.d"},
+					},
+				},
+				{
+					Name: "serviceca",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: defaults.ImageRegistryCertificatesName},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// verifyNode runs a verification pod on the node and returns the problem it
+// found, if any.
+func (c *NodeTrustVerificationController) verifyNode(ctx context.Context, node *corev1.Node) (string, error) {
+	pods := c.coreClient.Pods(defaults.ImageRegistryOperatorNamespace)
+	pod, err := pods.Create(ctx, verificationPod(node), metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to create the verification pod for node %s: %w", node.Name, err)
+	}
+	defer func() {
+		if err := pods.Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			klog.Warningf("unable to delete the verification pod %s: %s", pod.Name, err)
+		}
+	}()
+
+	err = wait.PollImmediate(nodeTrustPollInterval, nodeTrustVerificationTimeout, func() (bool, error) {
+		pod, err = pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("the verification pod for node %s did not complete: %w", node.Name, err)
+	}
+
+	if pod.Status.Phase == corev1.PodSucceeded {
+		return "", nil
+	}
+	message := "the verification failed"
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.Message != "" {
+			message = strings.TrimSpace(status.State.Terminated.Message)
+		}
+	}
+	return message, nil
+}
+
+// removeStalePods deletes the verification pods left by a previous run,
+// e.g. when the operator was restarted while verifying.
+func (c *NodeTrustVerificationController) removeStalePods(ctx context.Context) error {
+	return c.coreClient.Pods(defaults.ImageRegistryOperatorNamespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+		LabelSelector: "app=" + nodeTrustVerificationLabel,
+	})
+}
+
+func (c *NodeTrustVerificationController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	overrides, err := resource.GetConfigOverrides(cr)
+	if err != nil {
+		// invalid overrides are reported by the main controller.
+		return nil
+	}
+	if overrides.NodeTrustVerification == nil || !overrides.NodeTrustVerification.Enabled {
+		c.lastVerified = ""
+		_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, func(status *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&status.Conditions, nodeTrustPropagatedCondition)
+			return nil
+		})
+		return err
+	}
+
+	certificates, err := c.configMapLister.Get(defaults.ImageRegistryCertificatesName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	checksum, err := strategy.Checksum(certificates.Data)
+	if err != nil {
+		return err
+	}
+	if checksum == c.lastVerified && time.Since(c.lastRun) < nodeTrustVerificationInterval {
+		return nil
+	}
+
+	if err := c.removeStalePods(ctx); err != nil {
+		return fmt.Errorf("unable to remove stale verification pods: %w", err)
+	}
+	nodes, err := c.coreClient.Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list nodes: %w", err)
+	}
+	sampled := sampleNodes(nodes.Items, c.round)
+	c.round++
+
+	var names, problems []string
+	var errs []error
+	for _, node := range sampled {
+		names = append(names, node.Name)
+		problem, err := c.verifyNode(ctx, node)
+		if err != nil {
+			errs = append(errs, err)
+		} else if problem != "" {
+			problems = append(problems, fmt.Sprintf("node %s: %s", node.Name, problem))
+		}
+	}
+
+	cond := operatorv1.OperatorCondition{
+		Type:    nodeTrustPropagatedCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("The registry CA bundles are installed on the sampled nodes: %s", strings.Join(names, ", ")),
+	}
+	switch {
+	case len(problems) > 0:
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "StaleNodes"
+		cond.Message = fmt.Sprintf("Nodes do not trust the registry hostnames: %s", strings.Join(problems, "; "))
+	case len(errs) > 0:
+		cond.Status = operatorv1.ConditionUnknown
+		cond.Reason = "VerificationFailed"
+		cond.Message = utilerrors.NewAggregate(errs).Error()
+	case len(sampled) == 0:
+		cond.Status = operatorv1.ConditionUnknown
+		cond.Reason = "NoReadyNodes"
+		cond.Message = "No ready node to verify"
+	}
+	if _, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(cond)); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	c.lastVerified = checksum
+	c.lastRun = time.Now()
+	if len(problems) > 0 {
+		// node-ca may still be catching up, verify again soon.
+		c.lastVerified = ""
+		c.queue.AddAfter(workqueueKey, nodeTrustVerificationDelay)
+	} else {
+		c.queue.AddAfter(workqueueKey, nodeTrustVerificationInterval)
+	}
+	return nil
+}
+
+func (c *NodeTrustVerificationController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting NodeTrustVerificationController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, ctx.Done())
+
+	klog.Infof("Started NodeTrustVerificationController")
+	<-ctx.Done()
+	klog.Infof("Shutting down NodeTrustVerificationController")
+}
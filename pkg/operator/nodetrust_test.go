@@ -0,0 +1,109 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func testNode(name, zone string, ready bool) corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	node := corev1.Node{}
+	node.Name = name
+	node.Labels = map[string]string{zoneLabel: zone, "kubernetes.io/os": "linux"}
+	node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}
+	return node
+}
+
+func TestSampleNodes(t *testing.T) {
+	windows := testNode("windows", "a", true)
+	windows.Labels["kubernetes.io/os"] = "windows"
+	cordoned := testNode("cordoned", "c", true)
+	cordoned.Spec.Unschedulable = true
+	nodes := []corev1.Node{
+		testNode("a-2", "a", true),
+		testNode("a-1", "a", true),
+		testNode("b-1", "b", false),
+		testNode("b-2", "b", true),
+		windows,
+		cordoned,
+	}
+
+	for round, expected := range [][]string{
+		{"a-1", "b-2"},
+		{"a-2", "b-2"},
+		{"a-1", "b-2"},
+	} {
+		var names []string
+		for _, node := range sampleNodes(nodes, round) {
+			names = append(names, node.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("round %d: got %v, want %v", round, names, expected)
+		}
+	}
+}
+
+func TestVerifyNode(t *testing.T) {
+	defer func(interval time.Duration) { nodeTrustPollInterval = interval }(nodeTrustPollInterval)
+	nodeTrustPollInterval = time.Millisecond
+
+	for _, tt := range []struct {
+		name     string
+		phase    corev1.PodPhase
+		message  string
+		expected string
+	}{
+		{
+			name:  "trusted",
+			phase: corev1.PodSucceeded,
+		},
+		{
+			name:     "stale",
+			phase:    corev1.PodFailed,
+			message:  "missing or outdated CA bundle for image-registry.openshift-image-registry.svc:5000\n",
+			expected: "missing or outdated CA bundle for image-registry.openshift-image-registry.svc:5000",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				pod := action.(clienttesting.CreateAction).GetObject().(*corev1.Pod)
+				pod.Name = pod.GenerateName + "test"
+				pod.Status.Phase = tt.phase
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+					{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: tt.message}}},
+				}
+				return false, nil, nil
+			})
+
+			c := &NodeTrustVerificationController{coreClient: client.CoreV1()}
+			node := testNode("node", "a", true)
+			problem, err := c.verifyNode(context.Background(), &node)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if problem != tt.expected {
+				t.Errorf("got %q, want %q", problem, tt.expected)
+			}
+
+			pods, err := client.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pods.Items) != 0 {
+				t.Errorf("expected the verification pod to be deleted, found %d pods", len(pods.Items))
+			}
+		})
+	}
+}
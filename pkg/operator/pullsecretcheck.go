@@ -0,0 +1,328 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	// clusterPullSecretName is the name of the cluster-wide pull secret
+	// living in the openshift-config namespace.
+	clusterPullSecretName = "pull-secret"
+
+	// pullSecretsConsistentCondition reports whether the registry
+	// credentials found in the cluster pull secret and in the default
+	// service account dockercfg secret match the registry hostnames
+	// published in the image config status.
+	pullSecretsConsistentCondition = "PullSecretsConsistent"
+)
+
+// PullSecretCheckController verifies that the credentials for the internal
+// registry that are handed out to workloads are issued for the hostnames
+// the registry is currently exposed on. When the registry hostnames are
+// customized, stale credentials lead to pull failures that are hard to
+// diagnose, so mismatches are flagged in the operator status.
+type PullSecretCheckController struct {
+	eventRecorder         events.Recorder
+	operatorClient        v1helpers.OperatorClient
+	imageConfigLister     configv1listers.ImageLister
+	secretLister          corev1listers.SecretNamespaceLister
+	openshiftConfigLister corev1listers.SecretNamespaceLister
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.RateLimitingInterface
+}
+
+func NewPullSecretCheckController(
+	eventRecorder events.Recorder,
+	operatorClient v1helpers.OperatorClient,
+	imageConfigInformer configv1informers.ImageInformer,
+	secretInformer corev1informers.SecretInformer,
+	openshiftConfigSecretInformer corev1informers.SecretInformer,
+) (*PullSecretCheckController, error) {
+	c := &PullSecretCheckController{
+		eventRecorder:         eventRecorder,
+		operatorClient:        operatorClient,
+		imageConfigLister:     imageConfigInformer.Lister(),
+		secretLister:          secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		openshiftConfigLister: openshiftConfigSecretInformer.Lister().Secrets(defaults.OpenShiftConfigNamespace),
+		queue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "PullSecretCheckController"),
+	}
+
+	for _, informer := range []cache.SharedIndexInformer{
+		imageConfigInformer.Informer(),
+		secretInformer.Informer(),
+		openshiftConfigSecretInformer.Informer(),
+	} {
+		if _, err := informer.AddEventHandler(c.eventHandler()); err != nil {
+			return nil, err
+		}
+		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
+	}
+
+	return c, nil
+}
+
+func (c *PullSecretCheckController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *PullSecretCheckController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *PullSecretCheckController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("PullSecretCheckController: got event from workqueue")
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("PullSecretCheckController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("PullSecretCheckController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// dockerConfigHosts returns the registry hostnames for which the provided
+// secret holds credentials. Both the legacy dockercfg and the dockerconfigjson
+// formats are supported.
+func dockerConfigHosts(secret *corev1.Secret) ([]string, error) {
+	var auths map[string]json.RawMessage
+	switch secret.Type {
+	case corev1.SecretTypeDockercfg:
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+			return nil, fmt.Errorf("unable to parse secret %s/%s: %s", secret.Namespace, secret.Name, err)
+		}
+	case corev1.SecretTypeDockerConfigJson:
+		var cfg struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse secret %s/%s: %s", secret.Namespace, secret.Name, err)
+		}
+		auths = cfg.Auths
+	default:
+		return nil, fmt.Errorf("secret %s/%s has unexpected type %s", secret.Namespace, secret.Name, secret.Type)
+	}
+
+	hosts := make([]string, 0, len(auths))
+	for host := range auths {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// isRegistryHost returns true if the hostname looks like one that belongs to
+// the integrated image registry, either through its service or through the
+// default route.
+func isRegistryHost(host string) bool {
+	serviceHost := fmt.Sprintf("%s.%s.svc", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace)
+	if host == serviceHost || strings.HasPrefix(host, serviceHost+":") || strings.HasPrefix(host, serviceHost+".") {
+		return true
+	}
+	defaultRoutePrefix := fmt.Sprintf("%s-%s.", defaults.RouteName, defaults.ImageRegistryOperatorNamespace)
+	return strings.HasPrefix(host, defaultRoutePrefix)
+}
+
+// checkPullSecretHosts compares the registry hostnames found in the default
+// service account dockercfg secret and in the cluster pull secret against the
+// expected hostnames, returning a list of human readable problems.
+func checkPullSecretHosts(expected []string, dockercfgHosts []string, pullSecretHosts []string) []string {
+	var problems []string
+
+	known := map[string]bool{}
+	for _, host := range dockercfgHosts {
+		known[host] = true
+	}
+	var missing []string
+	for _, host := range expected {
+		if !known[host] {
+			missing = append(missing, host)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("default service account dockercfg secret has no credentials for %s", strings.Join(missing, ", ")))
+	}
+
+	current := map[string]bool{}
+	for _, host := range expected {
+		current[host] = true
+	}
+	var stale []string
+	for _, host := range pullSecretHosts {
+		if isRegistryHost(host) && !current[host] {
+			stale = append(stale, host)
+		}
+	}
+	if len(stale) > 0 {
+		problems = append(problems, fmt.Sprintf("cluster pull secret has credentials for registry hostnames that are no longer in use: %s", strings.Join(stale, ", ")))
+	}
+
+	return problems
+}
+
+// getDefaultDockercfgSecret returns the dockercfg secret that the
+// openshift-controller-manager minted for the default service account in the
+// registry namespace. Nil is returned if the secret does not exist yet.
+func (c *PullSecretCheckController) getDefaultDockercfgSecret() (*corev1.Secret, error) {
+	secrets, err := c.secretLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		if secret.Type != corev1.SecretTypeDockercfg {
+			continue
+		}
+		if secret.Annotations[corev1.ServiceAccountNameKey] != "default" {
+			continue
+		}
+		return secret, nil
+	}
+	return nil, nil
+}
+
+func (c *PullSecretCheckController) checkPullSecrets() ([]string, error) {
+	imageConfig, err := c.imageConfigLister.Get(defaults.ImageConfigName)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var expected []string
+	if imageConfig.Status.InternalRegistryHostname != "" {
+		expected = append(expected, imageConfig.Status.InternalRegistryHostname)
+	}
+	expected = append(expected, imageConfig.Status.ExternalRegistryHostnames...)
+	if len(expected) == 0 {
+		// the registry is not exposed, there is nothing to verify.
+		return nil, nil
+	}
+
+	dockercfg, err := c.getDefaultDockercfgSecret()
+	if err != nil {
+		return nil, err
+	}
+	if dockercfg == nil {
+		// the dockercfg secret is yet to be created.
+		return nil, nil
+	}
+	dockercfgHosts, err := dockerConfigHosts(dockercfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var pullSecretHosts []string
+	pullSecret, err := c.openshiftConfigLister.Get(clusterPullSecretName)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	} else if err == nil {
+		if pullSecretHosts, err = dockerConfigHosts(pullSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	return checkPullSecretHosts(expected, dockercfgHosts, pullSecretHosts), nil
+}
+
+func (c *PullSecretCheckController) sync() error {
+	ctx := context.TODO()
+	problems, err := c.checkPullSecrets()
+	if err != nil {
+		_, _, updateError := v1helpers.UpdateStatus(
+			ctx,
+			c.operatorClient,
+			v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+				Type:    "PullSecretCheckControllerDegraded",
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Error",
+				Message: err.Error(),
+			}))
+		return utilerrors.NewAggregate([]error{err, updateError})
+	}
+
+	consistent := operatorv1.OperatorCondition{
+		Type:    pullSecretsConsistentCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: "Registry credentials match the registry hostnames",
+	}
+	if len(problems) > 0 {
+		consistent.Status = operatorv1.ConditionFalse
+		consistent.Reason = "HostnameMismatch"
+		consistent.Message = strings.Join(problems, "; ")
+
+		_, currentStatus, _, err := c.operatorClient.GetOperatorState()
+		if err != nil {
+			return err
+		}
+		current := v1helpers.FindOperatorCondition(currentStatus.Conditions, pullSecretsConsistentCondition)
+		if current == nil || current.Message != consistent.Message {
+			c.eventRecorder.Warningf("PullSecretHostnameMismatch", "%s", consistent.Message)
+		}
+	}
+
+	_, _, err = v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		v1helpers.UpdateConditionFn(consistent),
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:   "PullSecretCheckControllerDegraded",
+			Status: operatorv1.ConditionFalse,
+			Reason: "AsExpected",
+		}))
+	return err
+}
+
+func (c *PullSecretCheckController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting PullSecretCheckController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, ctx.Done())
+
+	klog.Infof("Started PullSecretCheckController")
+	<-ctx.Done()
+	klog.Infof("Shutting down PullSecretCheckController")
+}
@@ -0,0 +1,108 @@
+package operator
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDockerConfigHosts(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		secret *corev1.Secret
+		hosts  []string
+		err    bool
+	}{
+		{
+			name: "dockercfg",
+			secret: &corev1.Secret{
+				Type: corev1.SecretTypeDockercfg,
+				Data: map[string][]byte{
+					corev1.DockerConfigKey: []byte(`{"b.example.com":{},"a.example.com":{}}`),
+				},
+			},
+			hosts: []string{"a.example.com", "b.example.com"},
+		},
+		{
+			name: "dockerconfigjson",
+			secret: &corev1.Secret{
+				Type: corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"auths":{"quay.io":{}}}`),
+				},
+			},
+			hosts: []string{"quay.io"},
+		},
+		{
+			name: "opaque",
+			secret: &corev1.Secret{
+				Type: corev1.SecretTypeOpaque,
+			},
+			err: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := dockerConfigHosts(tt.secret)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(hosts, tt.hosts) {
+				t.Errorf("got hosts %v, want %v", hosts, tt.hosts)
+			}
+		})
+	}
+}
+
+func TestCheckPullSecretHosts(t *testing.T) {
+	internal := "image-registry.openshift-image-registry.svc:5000"
+	external := "default-route-openshift-image-registry.apps.example.com"
+
+	for _, tt := range []struct {
+		name            string
+		expected        []string
+		dockercfgHosts  []string
+		pullSecretHosts []string
+		problems        int
+	}{
+		{
+			name:            "consistent",
+			expected:        []string{internal, external},
+			dockercfgHosts:  []string{internal, external, "172.30.0.10:5000"},
+			pullSecretHosts: []string{"quay.io", external},
+		},
+		{
+			name:           "dockercfg missing external hostname",
+			expected:       []string{internal, external},
+			dockercfgHosts: []string{internal},
+			problems:       1,
+		},
+		{
+			name:            "stale hostname in pull secret",
+			expected:        []string{internal},
+			dockercfgHosts:  []string{internal},
+			pullSecretHosts: []string{"quay.io", "default-route-openshift-image-registry.apps.old.example.com"},
+			problems:        1,
+		},
+		{
+			name:            "both",
+			expected:        []string{internal, external},
+			dockercfgHosts:  []string{internal},
+			pullSecretHosts: []string{"image-registry.openshift-image-registry.svc:443"},
+			problems:        2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := checkPullSecretHosts(tt.expected, tt.dockercfgHosts, tt.pullSecretHosts)
+			if len(problems) != tt.problems {
+				t.Errorf("got %d problems, want %d: %v", len(problems), tt.problems, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package operator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// shardRouterShutdownTimeout is how long the shard router waits for the
+// requests in flight when it is stopped.
+const shardRouterShutdownTimeout = 30 * time.Second
+
+// shardRepositoryRegexp matches the paths of the registry API addressing a
+// repository and captures its name. The name is matched greedily, the
+// references, digests and upload identifiers that follow have no slashes.
+var shardRepositoryRegexp = regexp.MustCompile(`^/(?:extensions/)?v2/(.+)/(?:manifests|blobs|tags|referrers|signatures)/`)
+
+// ShardRouterOptions configures the router forwarding the registry requests
+// to the shard serving the repository.
+type ShardRouterOptions struct {
+	// Port is the port the router listens on.
+	Port int
+	// CertFile and KeyFile hold the serving certificate of the router.
+	CertFile string
+	KeyFile  string
+	// CAFile holds the CA the certificates of the shards are verified
+	// against, along with the system CAs.
+	CAFile string
+	// ServerName is the hostname the certificates of the shards are
+	// issued for.
+	ServerName string
+	// DefaultBackend is the URL of the shard serving the repositories not
+	// matched by Shards.
+	DefaultBackend string
+	// Shards are the repository prefixes and the URL of the shard serving
+	// them, as prefix=url.
+	Shards []string
+}
+
+// shardRoute forwards the requests for the repositories under prefix.
+type shardRoute struct {
+	prefix string
+	proxy  http.Handler
+}
+
+// shardRouter forwards the registry requests to the shard serving the
+// repository, the others go to the default shard.
+type shardRouter struct {
+	routes       []shardRoute
+	defaultProxy http.Handler
+}
+
+// newShardProxy returns a reverse proxy to the shard at rawURL. The Host
+// header of the requests is kept, so the URLs returned by the shard point
+// to the router.
+func newShardProxy(rawURL string, transport http.RoundTripper) (http.Handler, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid shard url %q", rawURL)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.Transport = transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		klog.Errorf("unable to forward %s %s to %s: %s", r.Method, r.URL.Path, u.Host, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy, nil
+}
+
+// newShardRouter returns a router for the shards, given as prefix=url.
+func newShardRouter(defaultBackend string, shards []string, transport http.RoundTripper) (*shardRouter, error) {
+	defaultProxy, err := newShardProxy(defaultBackend, transport)
+	if err != nil {
+		return nil, err
+	}
+	router := &shardRouter{defaultProxy: defaultProxy}
+
+	seen := map[string]bool{}
+	for _, shard := range shards {
+		prefix, rawURL, ok := strings.Cut(shard, "=")
+		prefix = strings.Trim(prefix, "/")
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("invalid shard %q, expected prefix=url", shard)
+		}
+		if seen[prefix] {
+			return nil, fmt.Errorf("duplicate shard prefix %q", prefix)
+		}
+		seen[prefix] = true
+		proxy, err := newShardProxy(rawURL, transport)
+		if err != nil {
+			return nil, err
+		}
+		router.routes = append(router.routes, shardRoute{prefix: prefix, proxy: proxy})
+	}
+	// the longest prefix matching a repository wins.
+	sort.SliceStable(router.routes, func(i, j int) bool {
+		return len(router.routes[i].prefix) > len(router.routes[j].prefix)
+	})
+	return router, nil
+}
+
+// route returns the proxy to the shard serving the request.
+func (r *shardRouter) route(path string) http.Handler {
+	m := shardRepositoryRegexp.FindStringSubmatch(path)
+	if m == nil {
+		return r.defaultProxy
+	}
+	repository := m[1]
+	for _, route := range r.routes {
+		if repository == route.prefix || strings.HasPrefix(repository, route.prefix+"/") {
+			return route.proxy
+		}
+	}
+	return r.defaultProxy
+}
+
+func (r *shardRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == defaults.HealthzRoute {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	r.route(req.URL.Path).ServeHTTP(w, req)
+}
+
+// shardTransport returns the transport to the shards, verifying their
+// certificates for serverName against the system CAs and the CA in caFile.
+func shardTransport(caFile, serverName string) (http.RoundTripper, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the shards CA: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	return transport, nil
+}
+
+// RunShardRouter forwards the registry requests to the shard serving the
+// repository until ctx is done.
+func RunShardRouter(ctx context.Context, opts ShardRouterOptions) error {
+	transport, err := shardTransport(opts.CAFile, opts.ServerName)
+	if err != nil {
+		return err
+	}
+	router, err := newShardRouter(opts.DefaultBackend, opts.Shards, transport)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", opts.Port),
+		Handler:           router,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		klog.Infof("routing the registry requests to %d shards on %s", len(router.routes), server.Addr)
+		errCh <- server.ListenAndServeTLS(opts.CertFile, opts.KeyFile)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shardRouterShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package operator
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// shardBackend replies with its name and the Host header it received.
+func shardBackend(t *testing.T, name string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, name+" "+req.Host)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestShardRouter(t *testing.T) {
+	def := shardBackend(t, "default")
+	teamA := shardBackend(t, "team-a")
+	teamASub := shardBackend(t, "team-a-sub")
+
+	router, err := newShardRouter(def.URL, []string{
+		"team-a=" + teamA.URL,
+		"team-a/sub=" + teamASub.URL,
+	}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path     string
+		expected string
+	}{
+		{path: "/v2/", expected: "default"},
+		{path: "/v2/_catalog", expected: "default"},
+		{path: "/v2/team-a/app/manifests/latest", expected: "team-a"},
+		{path: "/v2/team-a/manifests/latest", expected: "team-a"},
+		{path: "/v2/team-a/app/blobs/uploads/", expected: "team-a"},
+		{path: "/v2/team-a/app/tags/list", expected: "team-a"},
+		{path: "/v2/team-a/sub/app/blobs/sha256:abc", expected: "team-a-sub"},
+		{path: "/v2/team-ab/app/manifests/latest", expected: "default"},
+		{path: "/v2/team-b/team-a/manifests/latest", expected: "default"},
+		{path: "/extensions/v2/team-a/app/signatures/sha256:abc", expected: "team-a"},
+		{path: "/extensions/v2/metrics", expected: "default"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = "image-registry.openshift-image-registry.svc:5000"
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := tt.expected + " image-registry.openshift-image-registry.svc:5000"
+		if string(body) != expected {
+			t.Errorf("%s: got %q, want %q", tt.path, body, expected)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status code %d for the health check, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestNewShardRouterErrors(t *testing.T) {
+	for _, tt := range []struct {
+		defaultBackend string
+		shards         []string
+		err            string
+	}{
+		{defaultBackend: "not a url", err: `invalid shard url "not a url"`},
+		{defaultBackend: "https://default", shards: []string{"team-a"}, err: "expected prefix=url"},
+		{defaultBackend: "https://default", shards: []string{"team-a=https://a", "team-a=https://b"}, err: `duplicate shard prefix "team-a"`},
+	} {
+		if _, err := newShardRouter(tt.defaultBackend, tt.shards, http.DefaultTransport); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%v: got error %v, want %q", tt.shards, err, tt.err)
+		}
+	}
+}
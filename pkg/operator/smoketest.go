@@ -0,0 +1,520 @@
+package operator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1informers "k8s.io/client-go/informers/apps/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imagev1client "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+const (
+	// smokeTestPassedCondition reports the result of the smoke test run
+	// after the last registry rollout.
+	smokeTestPassedCondition = "SmokeTestPassed"
+
+	// smokeTestRepository is the image stream the smoke test pushes to.
+	smokeTestRepository = "smoke-test"
+
+	// smokeTestTimeout bounds a smoke test run.
+	smokeTestTimeout = 2 * time.Minute
+
+	manifestSchema2MediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	imageConfigMediaType     = "application/vnd.docker.container.image.v1+json"
+	imageLayerMediaType      = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// SmokeTestController pushes a tiny image to the registry after each
+// rollout and pulls it back, reporting the result in the operator status.
+// Problems that only show up when the registry talks to its storage, like
+// revoked storage credentials, are caught before users run into them.
+type SmokeTestController struct {
+	kubeconfig       *restclient.Config
+	eventRecorder    events.Recorder
+	operatorClient   v1helpers.OperatorClient
+	coreClient       coreset.CoreV1Interface
+	imageClient      imagev1client.ImageV1Interface
+	configLister     imageregistryv1listers.ConfigLister
+	deploymentLister appsv1listers.DeploymentNamespaceLister
+	serviceLister    corev1listers.ServiceNamespaceLister
+	configMapLister  corev1listers.ConfigMapNamespaceLister
+
+	// lastTested identifies the rollout the smoke test last passed for.
+	lastTested string
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.RateLimitingInterface
+}
+
+func NewSmokeTestController(
+	kubeconfig *restclient.Config,
+	eventRecorder events.Recorder,
+	operatorClient v1helpers.OperatorClient,
+	coreClient coreset.CoreV1Interface,
+	imageClient imagev1client.ImageV1Interface,
+	configInformer imageregistryv1informers.ConfigInformer,
+	deploymentInformer appsv1informers.DeploymentInformer,
+	serviceInformer corev1informers.ServiceInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
+) (*SmokeTestController, error) {
+	c := &SmokeTestController{
+		kubeconfig:       kubeconfig,
+		eventRecorder:    eventRecorder,
+		operatorClient:   operatorClient,
+		coreClient:       coreClient,
+		imageClient:      imageClient,
+		configLister:     configInformer.Lister(),
+		deploymentLister: deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		serviceLister:    serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
+		configMapLister:  configMapInformer.Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		queue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "SmokeTestController"),
+	}
+
+	for _, informer := range []cache.SharedIndexInformer{
+		configInformer.Informer(),
+		deploymentInformer.Informer(),
+		serviceInformer.Informer(),
+		configMapInformer.Informer(),
+	} {
+		if _, err := informer.AddEventHandler(c.eventHandler()); err != nil {
+			return nil, err
+		}
+		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
+	}
+
+	return c, nil
+}
+
+func (c *SmokeTestController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *SmokeTestController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *SmokeTestController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("SmokeTestController: got event from workqueue")
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("SmokeTestController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("SmokeTestController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// rolloutComplete returns true when all the replicas of the deployment run
+// its latest pod template and are available.
+func rolloutComplete(deploy *appsv1.Deployment) bool {
+	if deploy.Spec.Replicas == nil || *deploy.Spec.Replicas == 0 {
+		return false
+	}
+	replicas := *deploy.Spec.Replicas
+	return deploy.Status.ObservedGeneration >= deploy.Generation &&
+		deploy.Status.UpdatedReplicas == replicas &&
+		deploy.Status.Replicas == replicas &&
+		deploy.Status.AvailableReplicas == replicas
+}
+
+func (c *SmokeTestController) sync() error {
+	ctx := context.TODO()
+
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	overrides, err := resource.GetConfigOverrides(cr)
+	if err != nil {
+		// invalid overrides are reported by the main controller.
+		return nil
+	}
+	if overrides.SmokeTest == nil || !overrides.SmokeTest.Enabled {
+		c.lastTested = ""
+		_, _, err := v1helpers.UpdateStatus(ctx, c.operatorClient, func(status *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&status.Conditions, smokeTestPassedCondition)
+			return nil
+		})
+		return err
+	}
+	namespace := overrides.SmokeTest.Namespace
+	if namespace == "" {
+		namespace = defaults.SmokeTestNamespace
+	}
+
+	deploy, err := c.deploymentLister.Get(defaults.ImageRegistryName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !rolloutComplete(deploy) {
+		return nil
+	}
+	rollout := fmt.Sprintf("%s/%d", deploy.UID, deploy.Generation)
+	if rollout == c.lastTested {
+		return nil
+	}
+
+	cond := operatorv1.OperatorCondition{
+		Type:    smokeTestPassedCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("An image was pushed to and pulled from %s/%s", namespace, smokeTestRepository),
+	}
+	// the result is recorded with ctx, even when the test timed out.
+	testCtx, cancel := context.WithTimeout(ctx, smokeTestTimeout)
+	defer cancel()
+	testErr := c.smokeTest(testCtx, namespace)
+	if testErr != nil {
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "Failed"
+		cond.Message = fmt.Sprintf("The smoke test run after the registry rollout failed: %s", testErr)
+		c.eventRecorder.Warningf("SmokeTestFailed", "%s", cond.Message)
+	}
+
+	_, _, err = v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(cond))
+	if testErr != nil {
+		// the smoke test is retried with backoff until it passes.
+		return utilerrors.NewAggregate([]error{testErr, err})
+	}
+	if err == nil {
+		c.lastTested = rollout
+	}
+	return err
+}
+
+// smokeTest pushes an image to the registry, pulls it back and removes its
+// image stream.
+func (c *SmokeTestController) smokeTest(ctx context.Context, namespace string) error {
+	if err := ensureNamespace(ctx, c.coreClient, namespace); err != nil {
+		return err
+	}
+
+	registry, err := c.registryClient()
+	if err != nil {
+		return err
+	}
+	if err := registry.pushAndPull(ctx, namespace+"/"+smokeTestRepository, time.Now()); err != nil {
+		return err
+	}
+
+	err = c.imageClient.ImageStreams(namespace).Delete(ctx, smokeTestRepository, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete image stream %s/%s: %w", namespace, smokeTestRepository, err)
+	}
+	return nil
+}
+
+// ensureNamespace creates the namespace if it does not exist.
+func ensureNamespace(ctx context.Context, coreClient coreset.CoreV1Interface, namespace string) error {
+	if _, err := coreClient.Namespaces().Get(ctx, namespace, metav1.GetOptions{}); errors.IsNotFound(err) {
+		_, err = coreClient.Namespaces().Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace},
+		}, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("unable to create namespace %s: %w", namespace, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("unable to get namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// operatorToken returns the token the operator authenticates with, which
+// the registry accepts as a password.
+func operatorToken(kubeconfig *restclient.Config) (string, error) {
+	if kubeconfig.BearerToken != "" || kubeconfig.BearerTokenFile == "" {
+		return kubeconfig.BearerToken, nil
+	}
+	b, err := os.ReadFile(kubeconfig.BearerTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the operator token: %w", err)
+	}
+	return string(bytes.TrimSpace(b)), nil
+}
+
+// registryClient returns a client that talks to the registry through its
+// Service, authenticated as the operator.
+func (c *SmokeTestController) registryClient() (*registryClient, error) {
+	svc, err := c.serviceLister.Get(defaults.ServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the registry service: %w", err)
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return nil, fmt.Errorf("the registry service has no ports")
+	}
+
+	serviceCA, err := c.configMapLister.Get(defaults.ServiceCAName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the service CA bundle: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(serviceCA.Data["service-ca.crt"])) {
+		return nil, fmt.Errorf("the service CA bundle has not been injected yet")
+	}
+
+	token, err := operatorToken(c.kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &registryClient{
+		client: &http.Client{
+			Transport: &http.Transport{
+				// the registry Service is reached directly, not
+				// through the cluster proxy.
+				Proxy:           nil,
+				TLSClientConfig: &tls.Config{RootCAs: roots},
+			},
+		},
+		host:  fmt.Sprintf("%s.%s.svc:%d", svc.Name, svc.Namespace, svc.Spec.Ports[0].Port),
+		token: token,
+	}, nil
+}
+
+// registryClient speaks just enough of the distribution API to push and
+// pull a single layer image.
+type registryClient struct {
+	client *http.Client
+	host   string
+	token  string
+}
+
+func sha256Digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func (r *registryClient) do(ctx context.Context, method, u, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Accept", manifestSchema2MediaType)
+	}
+	// the registry takes the OpenShift token as the password.
+	req.SetBasicAuth("unused", r.token)
+	return r.client.Do(req)
+}
+
+func (r *registryClient) expect(resp *http.Response, status int, what string) error {
+	if resp.StatusCode == status {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unable to %s: %s: %s", what, resp.Status, bytes.TrimSpace(body))
+}
+
+func (r *registryClient) pushBlob(ctx context.Context, repo string, content []byte) error {
+	base := &url.URL{Scheme: "https", Host: r.host}
+	resp, err := r.do(ctx, http.MethodPost, base.String()+"/v2/"+repo+"/blobs/uploads/", "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := r.expect(resp, http.StatusAccepted, "start blob upload"); err != nil {
+		return err
+	}
+
+	location, err := base.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("unable to parse the blob upload location: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", sha256Digest(content))
+	location.RawQuery = query.Encode()
+
+	resp, err = r.do(ctx, http.MethodPut, location.String(), "application/octet-stream", content)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return r.expect(resp, http.StatusCreated, "upload blob")
+}
+
+func (r *registryClient) get(ctx context.Context, path, what string) ([]byte, error) {
+	resp, err := r.do(ctx, http.MethodGet, "https://"+r.host+path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := r.expect(resp, http.StatusOK, what); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// pushAndPull pushes a single layer image created at now to repo and pulls
+// its manifest and layer back. The image content is unique to every run
+// so the blobs are written to the storage each time.
+func (r *registryClient) pushAndPull(ctx context.Context, repo string, now time.Time) error {
+	layer, diffID, err := smokeTestLayer(now)
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"created":      now.UTC().Format(time.RFC3339Nano),
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{diffID},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     manifestSchema2MediaType,
+		"config": map[string]interface{}{
+			"mediaType": imageConfigMediaType,
+			"size":      len(config),
+			"digest":    sha256Digest(config),
+		},
+		"layers": []map[string]interface{}{
+			{
+				"mediaType": imageLayerMediaType,
+				"size":      len(layer),
+				"digest":    sha256Digest(layer),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, blob := range [][]byte{layer, config} {
+		if err := r.pushBlob(ctx, repo, blob); err != nil {
+			return err
+		}
+	}
+	resp, err := r.do(ctx, http.MethodPut, "https://"+r.host+"/v2/"+repo+"/manifests/latest", manifestSchema2MediaType, manifest)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := r.expect(resp, http.StatusCreated, "push manifest"); err != nil {
+		return err
+	}
+
+	pulled, err := r.get(ctx, "/v2/"+repo+"/manifests/"+sha256Digest(manifest), "pull manifest")
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pulled, manifest) {
+		return fmt.Errorf("the pulled manifest does not match the pushed one")
+	}
+	pulled, err = r.get(ctx, "/v2/"+repo+"/blobs/"+sha256Digest(layer), "pull layer")
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pulled, layer) {
+		return fmt.Errorf("the pulled layer does not match the pushed one")
+	}
+	return nil
+}
+
+// smokeTestLayer returns a gzipped tar archive with a single file holding
+// now, along with the digest of the uncompressed archive.
+func smokeTestLayer(now time.Time) ([]byte, string, error) {
+	content := []byte(now.UTC().Format(time.RFC3339Nano))
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    "smoke-test",
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: now,
+	}); err != nil {
+		return nil, "", err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return nil, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	var layer bytes.Buffer
+	gw := gzip.NewWriter(&layer)
+	if _, err := gw.Write(archive.Bytes()); err != nil {
+		return nil, "", err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, "", err
+	}
+	return layer.Bytes(), sha256Digest(archive.Bytes()), nil
+}
+
+func (c *SmokeTestController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting SmokeTestController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, ctx.Done())
+
+	klog.Infof("Started SmokeTestController")
+	<-ctx.Done()
+	klog.Infof("Shutting down SmokeTestController")
+}
@@ -0,0 +1,141 @@
+package operator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/utils/pointer"
+)
+
+// fakeRegistry stores the blobs and manifests pushed to it in memory.
+type fakeRegistry struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+	// failBlobUploads makes blob uploads fail like when the registry
+	// cannot write to its storage.
+	failBlobUploads bool
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, password, ok := req.BasicAuth(); !ok || password != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/blobs/uploads/"):
+		w.Header().Set("Location", path+"upload-id?_state=abc")
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && strings.Contains(path, "/blobs/uploads/"):
+		if f.failBlobUploads || req.URL.Query().Get("_state") != "abc" {
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		if digest := req.URL.Query().Get("digest"); digest != sha256Digest(body) {
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		f.blobs[sha256Digest(body)] = body
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodPut && strings.Contains(path, "/manifests/"):
+		body, _ := io.ReadAll(req.Body)
+		f.blobs[sha256Digest(body)] = body
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodGet:
+		blob, ok := f.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(blob)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestSmokeTestPushAndPull(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		failBlobUploads bool
+		err             string
+	}{
+		{
+			name: "healthy",
+		},
+		{
+			name:            "broken storage",
+			failBlobUploads: true,
+			err:             "unable to upload blob: 500 Internal Server Error: storage error",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := &fakeRegistry{blobs: map[string][]byte{}, failBlobUploads: tt.failBlobUploads}
+			server := httptest.NewTLSServer(registry)
+			defer server.Close()
+
+			r := &registryClient{
+				client: server.Client(),
+				host:   strings.TrimPrefix(server.URL, "https://"),
+				token:  "token",
+			}
+			err := r.pushAndPull(context.Background(), "smoke/smoke-test", time.Now())
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+			if tt.err == "" && len(registry.blobs) != 3 {
+				t.Errorf("got %d blobs and manifests, want 3", len(registry.blobs))
+			}
+		})
+	}
+}
+
+func TestRolloutComplete(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		status   appsv1.DeploymentStatus
+		expected bool
+	}{
+		{
+			name:     "complete",
+			status:   appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			expected: true,
+		},
+		{
+			name:   "not observed",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+		},
+		{
+			name:   "old replicas",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 3},
+		},
+		{
+			name:   "unavailable",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy := &appsv1.Deployment{}
+			deploy.Generation = 2
+			deploy.Spec.Replicas = pointer.Int32(2)
+			deploy.Status = tt.status
+			if got := rolloutComplete(deploy); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
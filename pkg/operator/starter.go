@@ -1,3 +1,5 @@
+//go:build !standalone
+
 package operator
 
 import (
@@ -89,9 +91,11 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 
 	imageConfigStatusController, err := NewImageConfigController(
 		configClient.ConfigV1(),
+		kubeClient.BatchV1(),
 		configOperatorClient,
 		routeInformers.Route().V1().Routes(),
 		kubeInformers.Core().V1().Services(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
 	)
 	if err != nil {
 		return err
@@ -111,6 +115,9 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		imageregistryInformers.Imageregistry().V1().Configs(),
 		imageregistryInformers.Imageregistry().V1().ImagePruners(),
 		kubeInformers.Apps().V1().Deployments(),
+		kubeInformersForOpenShiftConfigManaged.Core().V1().ConfigMaps(),
+		kubeInformers.Core().V1().ConfigMaps(),
+		kubeClient.CoreV1(),
 	)
 	if err != nil {
 		return err
@@ -168,7 +175,76 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		return err
 	}
 
-	metricsController := NewMetricsController(imageInformers.Image().V1().ImageStreams())
+	upgradePreCheckController, err := NewUpgradePreCheckController(
+		configOperatorClient,
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	pullSecretCheckController, err := NewPullSecretCheckController(
+		eventRecorder,
+		configOperatorClient,
+		configInformers.Config().V1().Images(),
+		kubeInformers.Core().V1().Secrets(),
+		kubeInformersForOpenShiftConfig.Core().V1().Secrets(),
+	)
+	if err != nil {
+		return err
+	}
+
+	smokeTestController, err := NewSmokeTestController(
+		kubeconfig,
+		eventRecorder,
+		configOperatorClient,
+		kubeClient.CoreV1(),
+		imageClient.ImageV1(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		kubeInformers.Apps().V1().Deployments(),
+		kubeInformers.Core().V1().Services(),
+		kubeInformers.Core().V1().ConfigMaps(),
+	)
+	if err != nil {
+		return err
+	}
+
+	conformanceController, err := NewConformanceController(
+		eventRecorder,
+		configOperatorClient,
+		kubeClient.CoreV1(),
+		kubeClient.BatchV1(),
+		kubeClient.RbacV1(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		kubeInformers.Apps().V1().Deployments(),
+		routeInformers.Route().V1().Routes(),
+		kubeInformers.Batch().V1().Jobs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	nodeTrustVerificationController, err := NewNodeTrustVerificationController(
+		configOperatorClient,
+		kubeClient.CoreV1(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		kubeInformers.Core().V1().ConfigMaps(),
+	)
+	if err != nil {
+		return err
+	}
+
+	metricsController := NewMetricsController(imageInformers.Image().V1().ImageStreams(), kubeInformers.Core().V1().ConfigMaps())
+
+	storageLockController, err := NewStorageLockController(
+		eventRecorder,
+		kubeClient.BatchV1(),
+		kubeClient.CoordinationV1(),
+		kubeInformers.Batch().V1().Jobs(),
+	)
+	if err != nil {
+		return err
+	}
 
 	kubeInformers.Start(ctx.Done())
 	kubeInformersForOpenShiftConfig.Start(ctx.Done())
@@ -186,7 +262,13 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	go imageConfigStatusController.Run(ctx.Done())
 	go imagePrunerController.Run(ctx.Done())
 	go loggingController.Run(ctx, 1)
+	go storageLockController.Run(ctx)
 	go azureStackCloudController.Run(ctx)
+	go pullSecretCheckController.Run(ctx)
+	go upgradePreCheckController.Run(ctx)
+	go smokeTestController.Run(ctx)
+	go conformanceController.Run(ctx)
+	go nodeTrustVerificationController.Run(ctx)
 	go metricsController.Run(ctx)
 
 	<-ctx.Done()
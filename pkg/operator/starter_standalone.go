@@ -0,0 +1,145 @@
+//go:build standalone
+
+package operator
+
+import (
+	"context"
+
+	kubeinformers "k8s.io/client-go/informers"
+	kubeclient "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	routeclient "github.com/openshift/client-go/route/clientset/versioned"
+	routeinformers "github.com/openshift/client-go/route/informers/externalversions"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/loglevel"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// RunOperator runs the controllers provisioning the registry storage and
+// deploying the registry. The controllers relying on image streams, routes
+// or the ClusterOperator API are not available on standalone clusters.
+func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	configClient, err := configclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	// routes are never listed nor created in standalone mode, the client
+	// is only needed to satisfy the controller.
+	routeClient, err := routeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+	kubeInformersForOpenShiftConfig := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigNamespace))
+	kubeInformersForOpenShiftConfigManaged := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigManagedNamespace))
+	kubeInformersForKubeSystem := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(kubeSystemNamespace))
+	configInformers := configinformers.NewSharedInformerFactory(configClient, defaultResyncDuration)
+	imageregistryInformers := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, defaultResyncDuration)
+	routeInformers := routeinformers.NewSharedInformerFactoryWithOptions(routeClient, defaultResyncDuration, routeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+
+	configOperatorClient := client.NewConfigOperatorClient(
+		imageregistryClient.ImageregistryV1().Configs(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+
+	controllerRef, err := events.GetControllerReferenceForCurrentPod(ctx, kubeClient, defaults.ImageRegistryOperatorNamespace, nil)
+	if err != nil {
+		klog.Warningf("unable to get owner reference (falling back to namespace): %v", err)
+	}
+	eventRecorder := events.NewKubeRecorder(kubeClient.CoreV1().Events(defaults.ImageRegistryOperatorNamespace), "image-registry-operator", controllerRef)
+
+	controller, err := NewController(
+		eventRecorder,
+		kubeconfig,
+		kubeClient,
+		configClient,
+		imageregistryClient,
+		routeClient,
+		kubeInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		kubeInformersForKubeSystem,
+		configInformers,
+		imageregistryInformers,
+		routeInformers,
+	)
+	if err != nil {
+		return err
+	}
+
+	imageRegistryCertificatesController, err := NewImageRegistryCertificatesController(
+		kubeconfig,
+		kubeClient.CoreV1(),
+		configOperatorClient,
+		kubeInformers.Core().V1().ConfigMaps(),
+		kubeInformers.Core().V1().Secrets(),
+		kubeInformers.Core().V1().Services(),
+		configInformers.Config().V1().Images(),
+		configInformers.Config().V1().Infrastructures(),
+		kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps(),
+		kubeInformersForOpenShiftConfigManaged.Core().V1().ConfigMaps(),
+		imageregistryInformers.Imageregistry().V1().Configs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	nodeCADaemonController, err := NewNodeCADaemonController(
+		eventRecorder,
+		kubeClient.AppsV1(),
+		configOperatorClient,
+		kubeInformers.Apps().V1().DaemonSets(),
+		kubeInformers.Core().V1().Services(),
+	)
+	if err != nil {
+		return err
+	}
+
+	loggingController := loglevel.NewClusterOperatorLoggingController(
+		configOperatorClient,
+		eventRecorder,
+	)
+
+	storageLockController, err := NewStorageLockController(
+		eventRecorder,
+		kubeClient.BatchV1(),
+		kubeClient.CoordinationV1(),
+		kubeInformers.Batch().V1().Jobs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	kubeInformers.Start(ctx.Done())
+	kubeInformersForOpenShiftConfig.Start(ctx.Done())
+	kubeInformersForOpenShiftConfigManaged.Start(ctx.Done())
+	kubeInformersForKubeSystem.Start(ctx.Done())
+	configInformers.Start(ctx.Done())
+	imageregistryInformers.Start(ctx.Done())
+
+	go controller.Run(ctx.Done())
+	go nodeCADaemonController.Run(ctx.Done())
+	go imageRegistryCertificatesController.Run(ctx.Done())
+	go loggingController.Run(ctx, 1)
+	go storageLockController.Run(ctx)
+
+	<-ctx.Done()
+	return nil
+}
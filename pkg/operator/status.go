@@ -18,6 +18,7 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
 func updateCondition(cr *imageregistryv1.Config, condtype string, condstate operatorapiv1.OperatorCondition) {
@@ -92,6 +93,40 @@ func updatePrunerCondition(cr *imageregistryv1.ImagePruner, condtype string, con
 	cr.Status.Conditions = conditions
 }
 
+// storageDeletionCompatibleCondition reports whether the pruner can delete
+// the images it prunes from the registry storage.
+const storageDeletionCompatibleCondition = "StorageDeletionCompatible"
+
+// syncStorageDeletionCondition reports in the pruner status whether the
+// deletion policy of the registry storage lets the pruner do its job.
+func syncStorageDeletionCondition(pcr *imageregistryv1.ImagePruner, registryConfig *imageregistryv1.Config) {
+	cond := operatorapiv1.OperatorCondition{
+		Status:  operatorapiv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: "The registry accepts the deletions made by the pruner",
+	}
+
+	enabled := true
+	var err error
+	if registryConfig != nil {
+		enabled, err = resource.GetStorageDeletion(registryConfig)
+	}
+	suspended := pcr.Spec.Suspend != nil && *pcr.Spec.Suspend
+	switch {
+	case err != nil:
+		cond.Status = operatorapiv1.ConditionUnknown
+		cond.Reason = "InvalidStorageDeletion"
+		cond.Message = err.Error()
+	case suspended:
+		cond.Message = "The pruner is suspended"
+	case !enabled:
+		cond.Status = operatorapiv1.ConditionFalse
+		cond.Reason = "StorageDeletionDisabled"
+		cond.Message = "Deletion is disabled in the registry storage, the pruner only removes image objects from the cluster and their data is kept in the storage"
+	}
+	updatePrunerCondition(pcr, storageDeletionCompatibleCondition, cond)
+}
+
 func isDeploymentStatusAvailable(deploy *appsapi.Deployment) bool {
 	return deploy.Status.AvailableReplicas > 0
 }
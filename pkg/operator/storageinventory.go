@@ -0,0 +1,183 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	kubeclient "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
+)
+
+// RunStorageInventory lists the objects held by the registry storage and
+// stores the resulting report in the storage inventory config map, from
+// where it is exposed as metrics by the operator.
+func RunStorageInventory(ctx context.Context, kubeconfig *restclient.Config) error {
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	configClient, err := configclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	listers, err := startStorageListers(ctx, kubeClient, configClient)
+	if err != nil {
+		return err
+	}
+
+	cr, err := imageregistryClient.ImageregistryV1().Configs().Get(
+		ctx, defaults.ImageRegistryResourceName, metav1.GetOptions{},
+	)
+	if err != nil {
+		return err
+	}
+
+	driver, err := storage.NewDriver(&cr.Status.Storage, kubeconfig, listers)
+	if err != nil {
+		return err
+	}
+	if reader, ok := driver.(storage.ConfigStateReader); ok {
+		reader.ReadConfigState(cr)
+	}
+
+	overrides, err := resource.GetConfigOverrides(cr)
+	if err != nil {
+		return err
+	}
+
+	report := inventory.NewReport(storage.StorageType(&cr.Status.Storage))
+	if o := overrides.Inventory; o != nil && o.S3Report != nil {
+		reader, ok := driver.(inventory.ReportReader)
+		if !ok || cr.Status.Storage.S3 == nil {
+			return fmt.Errorf("inventory reports can only be used with S3 storage")
+		}
+		location := inventory.ReportLocation{
+			Bucket: o.S3Report.Bucket,
+			Prefix: o.S3Report.Prefix,
+		}
+		if err := reader.InventoryFromReports(ctx, report, location); err != nil {
+			return fmt.Errorf("unable to inventory storage from inventory reports: %w", err)
+		}
+	} else if o := overrides.Inventory; o != nil && o.AzureReport != nil {
+		reader, ok := driver.(inventory.ReportReader)
+		if !ok || cr.Status.Storage.Azure == nil {
+			return fmt.Errorf("blob inventory reports can only be used with Azure storage")
+		}
+		location := inventory.ReportLocation{
+			Bucket: o.AzureReport.Container,
+		}
+		if err := reader.InventoryFromReports(ctx, report, location); err != nil {
+			return fmt.Errorf("unable to inventory storage from blob inventory reports: %w", err)
+		}
+	} else {
+		inventorier, ok := driver.(inventory.Inventorier)
+		if !ok {
+			return &inventory.ErrNotSupported{Storage: storage.StorageType(&cr.Status.Storage)}
+		}
+		if err := inventorier.Inventory(ctx, report); err != nil {
+			return fmt.Errorf("unable to inventory storage: %w", err)
+		}
+	}
+	report.Time = time.Now().UTC()
+
+	klog.Infof("storage inventory complete: %d objects, %d bytes", report.Objects, report.Bytes)
+	return writeReport(ctx, kubeClient, defaults.StorageInventoryName, defaults.StorageInventoryReportKey, report)
+}
+
+// startStorageListers returns the listers used by the storage drivers in the
+// jobs run by the operator, once their caches are synced.
+func startStorageListers(ctx context.Context, kubeClient kubeclient.Interface, configClient configclient.Interface) (*client.StorageListers, error) {
+	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+	kubeInformersForOpenShiftConfig := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigNamespace))
+	kubeInformersForOpenShiftConfigManaged := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigManagedNamespace))
+	configInformers := configinformers.NewSharedInformerFactory(configClient, defaultResyncDuration)
+
+	secretInformer := kubeInformers.Core().V1().Secrets()
+	openshiftConfigInformer := kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps()
+	openshiftConfigManagedInformer := kubeInformersForOpenShiftConfigManaged.Core().V1().ConfigMaps()
+	infrastructureInformer := configInformers.Config().V1().Infrastructures()
+
+	listers := client.NewStorageListers(
+		infrastructureInformer.Lister(),
+		openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+	)
+
+	for _, informer := range []interface{ Start(<-chan struct{}) }{
+		kubeInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		configInformers,
+	} {
+		informer.Start(ctx.Done())
+	}
+	if !cache.WaitForCacheSync(
+		ctx.Done(),
+		secretInformer.Informer().HasSynced,
+		openshiftConfigInformer.Informer().HasSynced,
+		openshiftConfigManagedInformer.Informer().HasSynced,
+		infrastructureInformer.Informer().HasSynced,
+	) {
+		return nil, fmt.Errorf("unable to sync caches")
+	}
+	return listers, nil
+}
+
+// writeReport stores the report of a job run by the operator under key in
+// the config map name, creating it if necessary.
+func writeReport(ctx context.Context, kubeClient kubeclient.Interface, name, key string, report interface{}) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	configMaps := kubeClient.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+	cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Data: map[string]string{
+				key: string(data),
+			},
+		}
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[key] = string(data)
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,320 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	batchv1informers "k8s.io/client-go/informers/batch/v1"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationset "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	// storageLockLeaseDuration is for how long the storage lock is held
+	// without being renewed. A job deleted while it holds the lock keeps
+	// it until the lease expires, which gives its pods time to terminate.
+	storageLockLeaseDuration = 2 * time.Minute
+
+	// storageLockRenewInterval is how often the lock of a running job is
+	// renewed.
+	storageLockRenewInterval = 30 * time.Second
+
+	// storageLockJobPrefix prefixes the holder identity of the jobs
+	// holding the storage lock.
+	storageLockJobPrefix = "job/"
+)
+
+// jobFinished returns true if the job completed or failed.
+func jobFinished(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// leaseExpired returns true if the lease was not renewed in time.
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	renewed := lease.CreationTimestamp.Time
+	if lease.Spec.RenewTime != nil {
+		renewed = lease.Spec.RenewTime.Time
+	}
+	duration := storageLockLeaseDuration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	return !now.Before(renewed.Add(duration))
+}
+
+// StorageLockController makes the jobs deleting objects from the registry
+// storage run one at a time. The pruner, hard prune and garbage collection
+// jobs of the registry namespace carry the defaults.StorageLockLabel label
+// and are created suspended. The controller resumes them one after the
+// other, recording the running job as the holder of the
+// defaults.StorageLockName lease, so a garbage collection never deletes
+// blobs a running pruner still relies on.
+//
+// Only these jobs take part in the lock. The registry pods keep serving
+// pushes while a job holds it, so a hard prune or a garbage collection
+// still needs the registry to be read-only to not delete the blobs of a
+// push in progress.
+type StorageLockController struct {
+	eventRecorder events.Recorder
+	jobClient     batchset.JobsGetter
+	leaseClient   coordinationset.LeasesGetter
+	jobLister     batchv1listers.JobNamespaceLister
+	now           func() time.Time
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.RateLimitingInterface
+}
+
+func NewStorageLockController(
+	eventRecorder events.Recorder,
+	jobClient batchset.JobsGetter,
+	leaseClient coordinationset.LeasesGetter,
+	jobInformer batchv1informers.JobInformer,
+) (*StorageLockController, error) {
+	c := &StorageLockController{
+		eventRecorder: eventRecorder,
+		jobClient:     jobClient,
+		leaseClient:   leaseClient,
+		jobLister:     jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		now:           time.Now,
+		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "StorageLockController"),
+	}
+
+	if _, err := jobInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			job, ok := obj.(*batchv1.Job)
+			return ok && job.Labels[defaults.StorageLockLabel] == "true"
+		},
+		Handler: c.eventHandler(),
+	}); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, jobInformer.Informer().HasSynced)
+
+	return c, nil
+}
+
+func (c *StorageLockController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *StorageLockController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *StorageLockController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("StorageLockController: got event from workqueue")
+	resyncAfter, err := c.sync()
+	if err != nil {
+		c.queue.AddRateLimited(obj)
+		klog.Errorf("StorageLockController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		if resyncAfter > 0 {
+			c.queue.AddAfter(obj, resyncAfter)
+		}
+		klog.V(4).Infof("StorageLockController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// sync renews the lock of the running job, releases the lock of a finished
+// job or an expired lock, and hands the free lock to the oldest waiting
+// job. It returns when the lock has to be looked at again.
+func (c *StorageLockController) sync() (time.Duration, error) {
+	ctx := context.TODO()
+	now := c.now()
+
+	jobs, err := c.jobLister.List(labels.SelectorFromSet(labels.Set{defaults.StorageLockLabel: "true"}))
+	if err != nil {
+		return 0, err
+	}
+	byName := map[string]*batchv1.Job{}
+	for _, job := range jobs {
+		byName[job.Name] = job
+	}
+
+	lease, err := c.leaseClient.Leases(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.StorageLockName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease = nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var holder string
+	if lease != nil && lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != "" {
+		var job *batchv1.Job
+		if strings.HasPrefix(holder, storageLockJobPrefix) {
+			job = byName[strings.TrimPrefix(holder, storageLockJobPrefix)]
+		}
+		switch {
+		case job != nil && !jobFinished(job):
+			lease.Spec.RenewTime = &metav1.MicroTime{Time: now}
+			if _, err := c.leaseClient.Leases(lease.Namespace).Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+				return 0, fmt.Errorf("unable to renew the storage lock of the job %s: %w", job.Name, err)
+			}
+			if err := c.resume(ctx, job); err != nil {
+				return 0, err
+			}
+			c.warnUnlockedJobs(jobs, job.Name)
+			return storageLockRenewInterval, nil
+		case job != nil:
+			klog.Infof("job %s finished, releasing the storage lock", job.Name)
+		case leaseExpired(lease, now):
+			c.eventRecorder.Warningf("StorageLockRecovered", "The storage lock held by %s was not renewed in time, it was released", holder)
+		default:
+			// the job holding the lock was deleted and its pods may
+			// still be running, or the lock is held by another
+			// client, it is released once it expires.
+			c.warnUnlockedJobs(jobs, "")
+			return storageLockRenewInterval, nil
+		}
+		lease.Spec.HolderIdentity = nil
+		lease.Spec.AcquireTime = nil
+		lease.Spec.RenewTime = nil
+	}
+
+	var waiting []*batchv1.Job
+	for _, job := range jobs {
+		if job.Spec.Suspend != nil && *job.Spec.Suspend && !jobFinished(job) && job.DeletionTimestamp == nil {
+			waiting = append(waiting, job)
+		}
+	}
+	if len(waiting) == 0 {
+		if holder != "" {
+			if _, err := c.leaseClient.Leases(lease.Namespace).Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+				return 0, fmt.Errorf("unable to release the storage lock: %w", err)
+			}
+		}
+		c.warnUnlockedJobs(jobs, "")
+		return 0, nil
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		if !waiting[i].CreationTimestamp.Equal(&waiting[j].CreationTimestamp) {
+			return waiting[i].CreationTimestamp.Before(&waiting[j].CreationTimestamp)
+		}
+		return waiting[i].Name < waiting[j].Name
+	})
+	next := waiting[0]
+
+	identity := storageLockJobPrefix + next.Name
+	duration := int32(storageLockLeaseDuration / time.Second)
+	acquired := metav1.MicroTime{Time: now}
+	if lease == nil {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.StorageLockName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+		}
+	}
+	transitions := int32(1)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions + 1
+	}
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.AcquireTime = &acquired
+	lease.Spec.RenewTime = &acquired
+	lease.Spec.LeaseTransitions = &transitions
+	if lease.ResourceVersion == "" {
+		_, err = c.leaseClient.Leases(lease.Namespace).Create(ctx, lease, metav1.CreateOptions{})
+	} else {
+		_, err = c.leaseClient.Leases(lease.Namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to acquire the storage lock for the job %s: %w", next.Name, err)
+	}
+	c.eventRecorder.Eventf("StorageLockAcquired", "The job %s holds the storage lock, %d jobs are waiting for it", next.Name, len(waiting)-1)
+
+	if err := c.resume(ctx, next); err != nil {
+		return 0, err
+	}
+	c.warnUnlockedJobs(jobs, next.Name)
+	return storageLockRenewInterval, nil
+}
+
+// resume lets the job holding the storage lock run.
+func (c *StorageLockController) resume(ctx context.Context, job *batchv1.Job) error {
+	if job.Spec.Suspend == nil || !*job.Spec.Suspend {
+		return nil
+	}
+	_, err := c.jobClient.Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, []byte(`{"spec":{"suspend":false}}`), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to resume the job %s: %w", job.Name, err)
+	}
+	klog.Infof("job %s holds the storage lock, resumed", job.Name)
+	return nil
+}
+
+// warnUnlockedJobs logs the jobs that run without holding the storage lock,
+// i.e. that were not created suspended.
+func (c *StorageLockController) warnUnlockedJobs(jobs []*batchv1.Job, holder string) {
+	for _, job := range jobs {
+		if job.Name == holder || jobFinished(job) || (job.Spec.Suspend != nil && *job.Spec.Suspend) {
+			continue
+		}
+		klog.Warningf("job %s runs without holding the storage lock, it has to be created suspended", job.Name)
+	}
+}
+
+func (c *StorageLockController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting StorageLockController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	// an expired lock is released even when no job changes.
+	c.queue.Add("instance")
+	go wait.Until(c.runWorker, time.Second, ctx.Done())
+
+	klog.Infof("Started StorageLockController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageLockController")
+}
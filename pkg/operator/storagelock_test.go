@@ -0,0 +1,176 @@
+package operator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestStorageLockController(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	lockJob := func(name string, created time.Duration, suspended bool, finished batchv1.JobConditionType) *batchv1.Job {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         defaults.ImageRegistryOperatorNamespace,
+				CreationTimestamp: metav1.NewTime(now.Add(created)),
+				Labels:            map[string]string{defaults.StorageLockLabel: "true"},
+			},
+			Spec: batchv1.JobSpec{Suspend: &suspended},
+		}
+		if finished != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: finished, Status: corev1.ConditionTrue}}
+		}
+		return job
+	}
+	lease := func(holder string, renewed time.Duration) *coordinationv1.Lease {
+		identity := storageLockJobPrefix + holder
+		duration := int32(storageLockLeaseDuration / time.Second)
+		renewTime := metav1.NewMicroTime(now.Add(renewed))
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            defaults.StorageLockName,
+				Namespace:       defaults.ImageRegistryOperatorNamespace,
+				ResourceVersion: "1",
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &duration,
+				RenewTime:            &renewTime,
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name            string
+		jobs            []*batchv1.Job
+		lease           *coordinationv1.Lease
+		expectedHolder  string
+		expectedResumed []string
+	}{
+		{
+			name: "no job",
+		},
+		{
+			name: "free lock",
+			jobs: []*batchv1.Job{
+				lockJob("gc", -time.Minute, true, ""),
+				lockJob("pruner", -2*time.Minute, true, ""),
+			},
+			expectedHolder:  "pruner",
+			expectedResumed: []string{"pruner"},
+		},
+		{
+			name: "lock held by a running job",
+			jobs: []*batchv1.Job{
+				lockJob("pruner", -2*time.Minute, false, ""),
+				lockJob("gc", -time.Minute, true, ""),
+			},
+			lease:          lease("pruner", -time.Minute),
+			expectedHolder: "pruner",
+		},
+		{
+			name: "lock held by a finished job",
+			jobs: []*batchv1.Job{
+				lockJob("pruner", -2*time.Minute, false, batchv1.JobComplete),
+				lockJob("gc", -time.Minute, true, ""),
+			},
+			lease:           lease("pruner", -time.Minute),
+			expectedHolder:  "gc",
+			expectedResumed: []string{"gc"},
+		},
+		{
+			name: "lock released by a failed job",
+			jobs: []*batchv1.Job{
+				lockJob("pruner", -2*time.Minute, false, batchv1.JobFailed),
+			},
+			lease: lease("pruner", -time.Minute),
+		},
+		{
+			name: "lock held by a deleted job",
+			jobs: []*batchv1.Job{
+				lockJob("gc", -time.Minute, true, ""),
+			},
+			lease:          lease("pruner", -time.Minute),
+			expectedHolder: "pruner",
+		},
+		{
+			name: "stale lock",
+			jobs: []*batchv1.Job{
+				lockJob("gc", -time.Minute, true, ""),
+			},
+			lease:           lease("pruner", -storageLockLeaseDuration-time.Second),
+			expectedHolder:  "gc",
+			expectedResumed: []string{"gc"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var objects []runtime.Object
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, job := range tc.jobs {
+				objects = append(objects, job)
+				if err := indexer.Add(job); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.lease != nil {
+				objects = append(objects, tc.lease)
+			}
+			client := fake.NewSimpleClientset(objects...)
+
+			c := &StorageLockController{
+				eventRecorder: events.NewInMemoryRecorder("test"),
+				jobClient:     client.BatchV1(),
+				leaseClient:   client.CoordinationV1(),
+				jobLister:     batchv1listers.NewJobLister(indexer).Jobs(defaults.ImageRegistryOperatorNamespace),
+				now:           func() time.Time { return now },
+			}
+			if _, err := c.sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			var holder string
+			l, err := client.CoordinationV1().Leases(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.StorageLockName, metav1.GetOptions{})
+			if err == nil && l.Spec.HolderIdentity != nil {
+				holder = *l.Spec.HolderIdentity
+			}
+			if tc.expectedHolder == "" && holder != "" {
+				t.Errorf("got holder %q, want the lock to be free", holder)
+			} else if tc.expectedHolder != "" && holder != storageLockJobPrefix+tc.expectedHolder {
+				t.Errorf("got holder %q, want %q", holder, storageLockJobPrefix+tc.expectedHolder)
+			}
+
+			resumed := map[string]bool{}
+			for _, name := range tc.expectedResumed {
+				resumed[name] = true
+			}
+			for _, job := range tc.jobs {
+				if job.Spec.Suspend == nil || !*job.Spec.Suspend {
+					continue
+				}
+				got, err := client.BatchV1().Jobs(job.Namespace).Get(context.Background(), job.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				suspended := got.Spec.Suspend != nil && *got.Spec.Suspend
+				if suspended == resumed[job.Name] {
+					t.Errorf("job %s: got suspended %t, want %t", job.Name, suspended, !resumed[job.Name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// RunStorageSync copies the content of the registry storage to the target
+// storage of the storage upgrade in progress, or back to the previous
+// storage when the upgrade is rolled back.
+func RunStorageSync(ctx context.Context, kubeconfig *restclient.Config) error {
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	configClient, err := configclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	listers, err := startStorageListers(ctx, kubeClient, configClient)
+	if err != nil {
+		return err
+	}
+
+	cr, err := imageregistryClient.ImageregistryV1().Configs().Get(
+		ctx, defaults.ImageRegistryResourceName, metav1.GetOptions{},
+	)
+	if err != nil {
+		return err
+	}
+
+	state, err := resource.GetStorageUpgradeState(cr)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("no storage upgrade is waiting for the storage to be synced")
+	}
+	from, to := &state.Source, &state.Target
+	switch state.Phase {
+	case resource.StorageUpgradePhaseSyncing:
+	case resource.StorageUpgradePhaseRollingBack:
+		from, to = to, from
+	default:
+		return fmt.Errorf("no storage upgrade is waiting for the storage to be synced")
+	}
+
+	src, err := objectStore(cr, from, kubeconfig, listers)
+	if err != nil {
+		return fmt.Errorf("source storage: %w", err)
+	}
+	dst, err := objectStore(cr, to, kubeconfig, listers)
+	if err != nil {
+		return fmt.Errorf("target storage: %w", err)
+	}
+
+	result, err := storage.CopyObjects(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	klog.Infof("storage sync complete: %d objects copied, %d bytes, %d blobs already present, %d stale objects deleted", result.Objects, result.Bytes, result.Skipped, result.Deleted)
+	return nil
+}
+
+// objectStore returns the objects of the storage cfg of the registry
+// config cr.
+func objectStore(cr *imageregistryv1.Config, cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *restclient.Config, listers *client.StorageListers) (storage.ObjectStore, error) {
+	driver, err := storage.NewDriver(cfg, kubeconfig, listers)
+	if err != nil {
+		return nil, err
+	}
+	if reader, ok := driver.(storage.ConfigStateReader); ok {
+		reader.ReadConfigState(cr)
+	}
+	store, ok := driver.(storage.ObjectStore)
+	if !ok {
+		return nil, fmt.Errorf("objects cannot be copied from or to %s storage", storage.StorageType(cfg))
+	}
+	return store, nil
+}
@@ -0,0 +1,195 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// storageDeprecationsUpgradeableCondition blocks upgrades while the registry
+// storage relies on cloud APIs or settings the next version of the operator
+// no longer supports.
+const storageDeprecationsUpgradeableCondition = "StorageDeprecationsUpgradeable"
+
+// storageDeprecation describes a storage setting that goes away in the next
+// version of the operator. Entries are added one release ahead of the
+// removal, so clusters using them are held back until they are migrated.
+type storageDeprecation struct {
+	// field is the path of the deprecated field, reported in the
+	// deprecated fields metric.
+	field string
+	// used returns true if the storage configuration relies on the
+	// deprecated setting.
+	used func(storage *imageregistryv1.ImageRegistryConfigStorage) bool
+	// remediation tells the user how to move away from the setting.
+	remediation func(storage *imageregistryv1.ImageRegistryConfigStorage) string
+}
+
+var storageDeprecations = []storageDeprecation{
+	{
+		field: "spec.storage.azure.cloudName",
+		used: func(storage *imageregistryv1.ImageRegistryConfigStorage) bool {
+			return storage.Azure != nil && storage.Azure.CloudName == string(configv1.AzureGermanCloud)
+		},
+		remediation: func(storage *imageregistryv1.ImageRegistryConfigStorage) string {
+			return "the Azure Germany cloud (AzureGermanCloud) has been retired and its storage endpoints are no longer supported: move the registry storage to a storage account in AzurePublicCloud and update spec.storage.azure"
+		},
+	},
+}
+
+// checkStorageDeprecations returns the remediation of each deprecated
+// setting used by the storage configuration.
+func checkStorageDeprecations(storage *imageregistryv1.ImageRegistryConfigStorage) []string {
+	var remediations []string
+	for _, d := range storageDeprecations {
+		if d.used(storage) {
+			remediations = append(remediations, d.remediation(storage))
+		}
+	}
+	return remediations
+}
+
+// UpgradePreCheckController verifies the storage configuration of the
+// registry does not depend on settings removed in the next version of the
+// operator, and marks the operator as not upgradeable when it does.
+type UpgradePreCheckController struct {
+	operatorClient v1helpers.OperatorClient
+	configLister   imageregistryv1listers.ConfigLister
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.RateLimitingInterface
+}
+
+func NewUpgradePreCheckController(
+	operatorClient v1helpers.OperatorClient,
+	configInformer imageregistryv1informers.ConfigInformer,
+) (*UpgradePreCheckController, error) {
+	c := &UpgradePreCheckController{
+		operatorClient: operatorClient,
+		configLister:   configInformer.Lister(),
+		queue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "UpgradePreCheckController"),
+	}
+
+	if _, err := configInformer.Informer().AddEventHandler(c.eventHandler()); err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync, configInformer.Informer().HasSynced)
+
+	return c, nil
+}
+
+func (c *UpgradePreCheckController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *UpgradePreCheckController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *UpgradePreCheckController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("UpgradePreCheckController: got event from workqueue")
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("UpgradePreCheckController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("UpgradePreCheckController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// upgradeableCondition returns the condition reporting whether the storage
+// configuration of cr allows the operator to be upgraded.
+func upgradeableCondition(cr *imageregistryv1.Config) operatorv1.OperatorCondition {
+	cond := operatorv1.OperatorCondition{
+		Type:   storageDeprecationsUpgradeableCondition,
+		Status: operatorv1.ConditionTrue,
+		Reason: "AsExpected",
+	}
+	if cr.Spec.ManagementState == operatorv1.Removed {
+		return cond
+	}
+
+	if remediations := checkStorageDeprecations(&cr.Spec.Storage); len(remediations) > 0 {
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "DeprecatedStorageSettings"
+		cond.Message = strings.Join(remediations, "\n")
+	}
+	return cond
+}
+
+func (c *UpgradePreCheckController) sync() error {
+	ctx := context.TODO()
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		// the config is yet to be bootstrapped.
+		return nil
+	} else if err != nil {
+		_, _, updateError := v1helpers.UpdateStatus(
+			ctx,
+			c.operatorClient,
+			v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+				Type:    "UpgradePreCheckControllerDegraded",
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Error",
+				Message: err.Error(),
+			}))
+		return utilerrors.NewAggregate([]error{err, updateError})
+	}
+
+	_, _, err = v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		v1helpers.UpdateConditionFn(upgradeableCondition(cr)),
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:   "UpgradePreCheckControllerDegraded",
+			Status: operatorv1.ConditionFalse,
+			Reason: "AsExpected",
+		}))
+	return err
+}
+
+func (c *UpgradePreCheckController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting UpgradePreCheckController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, ctx.Done())
+
+	klog.Infof("Started UpgradePreCheckController")
+	<-ctx.Done()
+	klog.Infof("Shutting down UpgradePreCheckController")
+}
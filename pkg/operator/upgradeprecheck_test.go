@@ -0,0 +1,65 @@
+package operator
+
+import (
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestUpgradeableCondition(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		managementState operatorv1.ManagementState
+		storage         imageregistryv1.ImageRegistryConfigStorage
+		status          operatorv1.ConditionStatus
+	}{
+		{
+			name:   "no storage",
+			status: operatorv1.ConditionTrue,
+		},
+		{
+			name: "swift keystone v2",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				Swift: &imageregistryv1.ImageRegistryConfigStorageSwift{AuthVersion: "2"},
+			},
+			status: operatorv1.ConditionTrue,
+		},
+		{
+			name: "azure public cloud",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{CloudName: "AzurePublicCloud"},
+			},
+			status: operatorv1.ConditionTrue,
+		},
+		{
+			name: "azure germany",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{CloudName: "AzureGermanCloud"},
+			},
+			status: operatorv1.ConditionFalse,
+		},
+		{
+			name:            "removed",
+			managementState: operatorv1.Removed,
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{CloudName: "AzureGermanCloud"},
+			},
+			status: operatorv1.ConditionTrue,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.ManagementState = tt.managementState
+			cr.Spec.Storage = tt.storage
+
+			cond := upgradeableCondition(cr)
+			if cond.Status != tt.status {
+				t.Errorf("got status %s, want %s: %s", cond.Status, tt.status, cond.Message)
+			}
+			if cond.Status == operatorv1.ConditionFalse && cond.Message == "" {
+				t.Errorf("got no remediation for a deprecated setting")
+			}
+		})
+	}
+}
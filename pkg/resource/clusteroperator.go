@@ -114,6 +114,7 @@ var _ Mutator = &generatorClusterOperator{}
 
 type generatorClusterOperator struct {
 	relatedObjects []configv1.ObjectReference
+	managedObjects []ManagedObject
 	cr             *imageregistryv1.Config
 	imagePruner    *imageregistryv1.ImagePruner
 	deployLister   appslisters.DeploymentNamespaceLister
@@ -128,6 +129,7 @@ func NewGeneratorClusterOperator(
 	cr *imageregistryv1.Config,
 	imagePruner *imageregistryv1.ImagePruner,
 	relatedObjects []configv1.ObjectReference,
+	managedObjects []ManagedObject,
 ) *generatorClusterOperator {
 	return &generatorClusterOperator{
 		deployLister:   deployLister,
@@ -136,6 +138,7 @@ func NewGeneratorClusterOperator(
 		cr:             cr,
 		imagePruner:    imagePruner,
 		relatedObjects: relatedObjects,
+		managedObjects: managedObjects,
 	}
 }
 
@@ -222,6 +225,7 @@ func (gco *generatorClusterOperator) syncConditions(op *configv1.ClusterOperator
 	configv1helpers.SetStatusCondition(&op.Status.Conditions, unionCondition("Available", operatorv1.ConditionTrue, conditions))
 	configv1helpers.SetStatusCondition(&op.Status.Conditions, unionCondition("Progressing", operatorv1.ConditionFalse, conditions))
 	configv1helpers.SetStatusCondition(&op.Status.Conditions, unionCondition("Degraded", operatorv1.ConditionFalse, conditions))
+	configv1helpers.SetStatusCondition(&op.Status.Conditions, unionCondition("Upgradeable", operatorv1.ConditionTrue, conditions))
 	return !equality.Semantic.DeepEqual(oldStatus, &op.Status)
 }
 
@@ -281,8 +285,9 @@ func (gco *generatorClusterOperator) syncVersions(op *configv1.ClusterOperator)
 }
 
 func (gco *generatorClusterOperator) syncRelatedObjects(op *configv1.ClusterOperator) (modified bool) {
-	if !reflect.DeepEqual(op.Status.RelatedObjects, gco.relatedObjects) {
-		op.Status.RelatedObjects = gco.relatedObjects
+	relatedObjects := mergeRelatedObjects(gco.relatedObjects, gco.managedObjects)
+	if !reflect.DeepEqual(op.Status.RelatedObjects, relatedObjects) {
+		op.Status.RelatedObjects = relatedObjects
 		modified = true
 	}
 
@@ -263,7 +263,7 @@ func TestSyncVersions(t *testing.T) {
 
 			lister.deploys, lister.failOnGet = tt.deploys, tt.failOnGet
 			gen := NewGeneratorClusterOperator(
-				lister, nil, nil, tt.config, nil, nil,
+				lister, nil, nil, tt.config, nil, nil, nil,
 			)
 
 			modified, err := gen.syncVersions(co)
@@ -292,3 +292,56 @@ func TestSyncVersions(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncConditionsUpgradeable(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		condition operatorv1.OperatorCondition
+		status    cfgapi.ConditionStatus
+		reason    string
+	}{
+		{
+			name: "no deprecated storage settings",
+			condition: operatorv1.OperatorCondition{
+				Type:   "StorageDeprecationsUpgradeable",
+				Status: operatorv1.ConditionTrue,
+				Reason: "AsExpected",
+			},
+			status: cfgapi.ConditionTrue,
+			reason: "AsExpected",
+		},
+		{
+			name: "deprecated storage settings",
+			condition: operatorv1.OperatorCondition{
+				Type:    "StorageDeprecationsUpgradeable",
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "DeprecatedStorageSettings",
+				Message: "the Azure Germany cloud (AzureGermanCloud) has been retired",
+			},
+			status: cfgapi.ConditionFalse,
+			reason: "StorageDeprecationsDeprecatedStorageSettings",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imregv1.Config{}
+			cr.Status.Conditions = []operatorv1.OperatorCondition{tt.condition}
+			gco := &generatorClusterOperator{cr: cr}
+
+			co := &cfgapi.ClusterOperator{}
+			gco.syncConditions(co)
+
+			var upgradeable *cfgapi.ClusterOperatorStatusCondition
+			for i := range co.Status.Conditions {
+				if co.Status.Conditions[i].Type == cfgapi.OperatorUpgradeable {
+					upgradeable = &co.Status.Conditions[i]
+				}
+			}
+			if upgradeable == nil {
+				t.Fatalf("no Upgradeable condition in %#v", co.Status.Conditions)
+			}
+			if upgradeable.Status != tt.status || upgradeable.Reason != tt.reason {
+				t.Errorf("got Upgradeable=%s (%s), want %s (%s)", upgradeable.Status, upgradeable.Reason, tt.status, tt.reason)
+			}
+		})
+	}
+}
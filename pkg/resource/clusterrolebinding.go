@@ -21,11 +21,11 @@ type generatorClusterRoleBinding struct {
 	saNamespace string
 }
 
-func newGeneratorClusterRoleBinding(lister rbaclisters.ClusterRoleBindingLister, client rbacset.RbacV1Interface) *generatorClusterRoleBinding {
+func newGeneratorClusterRoleBinding(lister rbaclisters.ClusterRoleBindingLister, client rbacset.RbacV1Interface, saName string) *generatorClusterRoleBinding {
 	return &generatorClusterRoleBinding{
 		lister:      lister,
 		client:      client,
-		saName:      defaults.ServiceAccountName,
+		saName:      saName,
 		saNamespace: defaults.ImageRegistryOperatorNamespace,
 	}
 }
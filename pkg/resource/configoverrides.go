@@ -1,13 +1,520 @@
 package resource
 
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/gcs"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/ibmcos"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/pvc"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/swift"
+)
+
 // ConfigOverrides holds data users can set to override default object configurations created
 // by this operator. This is stored in the registry Config.Spec.UnsupportedConfigOverrides.
 type ConfigOverrides struct {
-	Deployment *DeploymentOverrides `json:"deployment,omitempty"`
+	Deployment            *DeploymentOverrides            `json:"deployment,omitempty"`
+	Inventory             *InventoryOverrides             `json:"inventory,omitempty"`
+	Storage               *StorageOverrides               `json:"storage,omitempty"`
+	Audit                 *AuditOverrides                 `json:"audit,omitempty"`
+	Conformance           *ConformanceOverrides           `json:"conformance,omitempty"`
+	Egress                *EgressOverrides                `json:"egress,omitempty"`
+	HostnameMigration     *HostnameMigrationOverrides     `json:"hostnameMigration,omitempty"`
+	ImageConfig           *ImageConfigOverrides           `json:"imageConfig,omitempty"`
+	MaintenanceWindow     *MaintenanceWindowOverrides     `json:"maintenanceWindow,omitempty"`
+	NodeTrustVerification *NodeTrustVerificationOverrides `json:"nodeTrustVerification,omitempty"`
+	Pruner                *PrunerOverrides                `json:"pruner,omitempty"`
+	Quota                 *QuotaOverrides                 `json:"quota,omitempty"`
+	RolloutBatching       *RolloutBatchingOverrides       `json:"rolloutBatching,omitempty"`
+	Service               *ServiceOverrides               `json:"service,omitempty"`
+	Sharding              *ShardingOverrides              `json:"sharding,omitempty"`
+	SmokeTest             *SmokeTestOverrides             `json:"smokeTest,omitempty"`
+	StorageDeletion       *StorageDeletionOverrides       `json:"storageDeletion,omitempty"`
+	StorageUpgrade        *StorageUpgradeOverrides        `json:"storageUpgrade,omitempty"`
+
+	// FeatureGates toggles the image registry feature gates for this
+	// cluster, taking precedence over the cluster FeatureGate.
+	FeatureGates map[featuregates.Gate]bool `json:"featureGates,omitempty"`
+
+	// InternalHostnames lists additional Services created in front of the
+	// registry, so <name>.<registry namespace>.svc can be used as an alias
+	// of the registry hostname by tooling with hardcoded hostnames. The
+	// service CA issues certificates for a single Service, clients using
+	// an alias have to verify the registry certificate against the main
+	// registry hostname.
+	InternalHostnames []string `json:"internalHostnames,omitempty"`
+
+	// Port is the port the registry listens on and the registry Services
+	// expose, for clusters where host firewalls only allow some ports.
+	// Defaults to defaults.ContainerPort.
+	Port int32 `json:"port,omitempty"`
+
+	// Routes holds per route settings, keyed by the route name. The default
+	// route is named defaults.RouteName.
+	Routes map[string]RouteOverrides `json:"routes,omitempty"`
 }
 
 // DeploymentOverrides holds items that can be overwriten in the image registry deployment.
 type DeploymentOverrides struct {
 	Annotations      map[string]string `json:"annotations,omitempty"`
 	RuntimeClassName *string           `json:"runtimeClassName,omitempty"`
+	LivenessProbe    *ProbeOverrides   `json:"livenessProbe,omitempty"`
+	ReadinessProbe   *ProbeOverrides   `json:"readinessProbe,omitempty"`
+
+	// ServiceAccountName is the service account the registry pods run
+	// as, instead of the one managed by the operator. The service account
+	// is managed by the user, e.g. to carry the annotations a cloud
+	// workload identity integration needs, and is granted the registry
+	// cluster role by the operator.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// ImagePullSecrets are added to the registry pods, e.g. when the
+	// registry image is mirrored to a registry that needs credentials.
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// TerminationGracePeriodSeconds is how long a registry pod is given
+	// to stop, including its preStop hook, before it is killed. Defaults
+	// to 55 seconds.
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+	// PreStop configures the hook run before the registry is stopped.
+	PreStop *PreStopOverrides `json:"preStop,omitempty"`
+
+	// RecordUpdateDiff records the changes made by the operator to the
+	// registry deployment in its
+	// imageregistry.operator.openshift.io/last-update-diff annotation,
+	// sensitive values redacted, so the cause of the last rollout can be
+	// found once the operator log has rotated.
+	RecordUpdateDiff bool `json:"recordUpdateDiff,omitempty"`
+}
+
+// PreStopOverrides configures how a registry pod is taken out of rotation
+// before it is stopped. Pushes of large layers take longer than the default
+// grace period on busy clusters, draining lets them complete during
+// rollouts.
+type PreStopOverrides struct {
+	// SleepSeconds is how long the pod keeps serving once it is deleted,
+	// so its endpoint is removed from routers, load balancers and nodes.
+	// Defaults to 25 seconds.
+	SleepSeconds *int32 `json:"sleepSeconds,omitempty"`
+	// DrainTimeoutSeconds makes the pod wait, after the sleep, for the
+	// connections to the registry to be closed, for up to this many
+	// seconds. The registry is not drained if unset.
+	DrainTimeoutSeconds *int32 `json:"drainTimeoutSeconds,omitempty"`
+}
+
+// ProbeOverrides holds the timings of a registry container probe. Slow
+// storage backends may need the registry to be given more time before it
+// is restarted or taken out of rotation.
+type ProbeOverrides struct {
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       *int32 `json:"periodSeconds,omitempty"`
+	FailureThreshold    *int32 `json:"failureThreshold,omitempty"`
+}
+
+// InventoryOverrides holds the configuration for the periodic storage
+// inventory job.
+type InventoryOverrides struct {
+	Enabled  bool   `json:"enabled,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+	// S3Report makes the inventory job consume the S3 Inventory reports
+	// delivered for the registry bucket instead of listing the bucket.
+	S3Report *S3InventoryReportOverrides `json:"s3Report,omitempty"`
+	// AzureReport makes the operator configure a blob inventory policy on
+	// the storage account and the inventory job consume its reports
+	// instead of listing the container.
+	AzureReport *azure.InventoryReport `json:"azureReport,omitempty"`
+}
+
+// S3InventoryReportOverrides points to the S3 Inventory reports of the
+// registry bucket. Only reports in the CSV format are supported.
+type S3InventoryReportOverrides struct {
+	// Bucket is the destination bucket of the inventory reports. Defaults
+	// to the registry bucket.
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix is the path of the inventory configuration in the destination
+	// bucket, usually <destination prefix>/<registry bucket>/<inventory id>.
+	Prefix string `json:"prefix"`
+}
+
+// AuditOverrides configures the audit records written by the registry. When
+// enabled, the registry logs a record for every authorized request, with the
+// user, the repository and the pull or push access that was granted, so
+// token issuance can be traced. The records are part of the registry logs
+// with the "audit" logger field, from where the cluster log forwarder can
+// route them to the audit log sink.
+type AuditOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// SmokeTestOverrides configures the smoke test run by the operator after
+// every registry rollout. The test pushes a tiny image to the registry
+// through its Service, pulls it back and reports the result with the
+// SmokeTestPassed condition, so broken storage credentials are noticed
+// before users are affected.
+type SmokeTestOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Namespace is where the test image is pushed, it is created when it
+	// does not exist. Defaults to defaults.SmokeTestNamespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ConformanceOverrides configures the OCI distribution conformance suite
+// run by the operator after every registry rollout. The suite runs in a Job
+// talking to the registry through its default route, authenticated as a
+// service account allowed to push and pull in Namespace only. Its result is
+// reported with the ConformanceTestPassed condition and the
+// image_registry_conformance_* metrics.
+type ConformanceOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Namespace is where the suite creates its repositories, it is created
+	// when it does not exist. Defaults to defaults.ConformanceNamespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Image is the conformance suite image, for clusters that mirror it.
+	// Defaults to the upstream image.
+	Image string `json:"image,omitempty"`
+	// Workflows lists the workflows of the suite to run, among pull,
+	// push, contentDiscovery and contentManagement. Defaults to pull, push
+	// and contentDiscovery.
+	Workflows []string `json:"workflows,omitempty"`
+}
+
+// HostnameMigrationOverrides configures the job run by the operator when a
+// hostname of the registry routes goes away. The job looks for image streams
+// and pull secrets still referencing the old hostname, which stop working
+// silently, and reports them in the defaults.HostnameMigrationName config
+// map.
+type HostnameMigrationOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Rewrite makes the job replace the old hostname with Target in the
+	// references it finds in Namespaces, instead of only reporting them.
+	// The references in the other namespaces are only reported.
+	Rewrite bool `json:"rewrite,omitempty"`
+	// Target is the hostname references are rewritten to, it has to be
+	// one of the hostnames of the registry routes. Required by Rewrite.
+	Target string `json:"target,omitempty"`
+	// Namespaces are the namespaces references are rewritten in.
+	// Required by Rewrite.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// NodeTrustVerificationOverrides configures the verification of the CA
+// bundles the node-ca daemon installs on the nodes. When enabled, a short
+// lived pod is run on a node of every zone after the registry certificates
+// change, and then hourly, to check that the container runtime trusts the
+// registry hostnames. Nodes with missing or outdated CA bundles are
+// reported by the NodeTrustPropagated condition.
+type NodeTrustVerificationOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// EgressOverrides routes the traffic of the registry pods leaving the
+// cluster, e.g. to the storage, through egress IPs of the OVN-Kubernetes
+// network, so storage firewalls can allow the registry by address.
+type EgressOverrides struct {
+	// IPs are the egress IPs assigned to the registry pods, they are
+	// hosted by the nodes labeled k8s.ovn.org/egress-assignable.
+	IPs []string `json:"ips"`
+}
+
+// ServiceOverrides configures the main registry Service.
+type ServiceOverrides struct {
+	// ClusterIP pins the cluster IP of the Service, it has to be a free
+	// address of the service network. "None" makes the Service headless,
+	// so clients behind a service mesh address the registry pods
+	// directly. The Service is recreated when its cluster IP changes.
+	// The node resolver writes the addresses of a headless Service to the
+	// hosts file of the nodes, they are only refreshed periodically and
+	// pulls by the nodes may fail for a while after a rollout.
+	ClusterIP string `json:"clusterIP,omitempty"`
+}
+
+// StorageDeletionOverrides controls whether manifests, tags and layers can be
+// deleted from the registry storage, so clusters can enforce append-only
+// registries. Deleting images from the storage is what the image pruner
+// does, it is reported as incompatible when deletion is disabled.
+type StorageDeletionOverrides struct {
+	// Enabled sets whether deletion is allowed. Defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// StorageUpgradeOverrides moves the registry to new storage with minimal
+// downtime, e.g. to change storage parameters such as the encryption or the
+// region that cannot be changed in place. The target storage is provisioned
+// and the registry is made read-only while the content of its current
+// storage is copied by the defaults.StorageSyncName job, after which the
+// registry is moved to the target storage. The target storage has to be
+// empty. Until the rollback window ends the registry can be moved back to
+// its previous storage, which is never deleted by the operator. Only S3 and
+// GCS storage can be upgraded.
+type StorageUpgradeOverrides struct {
+	// Target is the storage configuration to move the registry to.
+	Target *imageregistryv1.ImageRegistryConfigStorage `json:"target,omitempty"`
+	// RollbackWindow is how long after the move the registry can be
+	// moved back to its previous storage. Defaults to 24h.
+	RollbackWindow *metav1.Duration `json:"rollbackWindow,omitempty"`
+	// Rollback moves the registry back to its previous storage, it only
+	// has an effect during the rollback window. The registry is made
+	// read-only while the target storage is copied back, so the pushes
+	// made since the move are kept.
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+// ShardingOverrides splits the registry into shards, for clusters so large
+// that a single storage location becomes a bottleneck. Each shard is a
+// registry deployment serving the repositories under its prefixes from its
+// own prefix of the registry storage, the registry deployment serves the
+// remaining repositories. A router deployed behind the registry Service
+// forwards the requests to the shard serving the repository. It requires
+// the Sharding feature gate and object storage.
+type ShardingOverrides struct {
+	Shards []ShardOverrides `json:"shards,omitempty"`
+}
+
+// ShardOverrides is a registry shard.
+type ShardOverrides struct {
+	// Name names the shard objects and its storage prefix, it has to be
+	// a DNS label.
+	Name string `json:"name"`
+	// RepositoryPrefixes are the repository prefixes served by the shard,
+	// e.g. "team-a" covers the repositories of the team-a namespace. The
+	// longest prefix matching a repository wins.
+	RepositoryPrefixes []string `json:"repositoryPrefixes"`
+	// Replicas is the number of replicas of the shard, the number of
+	// replicas of the registry if zero.
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+// QuotaOverrides holds the settings of the project quota enforcement done by
+// the registry when images are pushed.
+type QuotaOverrides struct {
+	// Enabled turns quota enforcement on or off. Defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+	// CacheTTL is how long the registry caches the project quotas.
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
+	// BlobRepositoryCacheTTL is how long the registry remembers in which
+	// repositories a blob is present.
+	BlobRepositoryCacheTTL *metav1.Duration `json:"blobRepositoryCacheTTL,omitempty"`
+}
+
+// ImageConfigOverrides holds settings for the status of the cluster image
+// config, image.config.openshift.io/cluster, maintained by the operator.
+type ImageConfigOverrides struct {
+	// InternalRegistryHostnameManagementState is Managed (default) when
+	// the operator publishes the registry Service hostname as the internal
+	// registry hostname. When Unmanaged, the hostname set by the admin is
+	// left in place, e.g. when the registry is fronted by a service mesh or
+	// a custom DNS name, and the operator only verifies it is reachable.
+	InternalRegistryHostnameManagementState operatorv1.ManagementState `json:"internalRegistryHostnameManagementState,omitempty"`
+}
+
+// MaintenanceWindowOverrides restricts when the operator makes disruptive
+// changes: rolling out the registry, moving it to new storage and rotating
+// storage keys. Outside the window these changes are reported by the
+// PendingChanges condition. Registry upgrades are never deferred.
+type MaintenanceWindowOverrides struct {
+	// Schedule is the cron schedule at which the window opens, in the
+	// standard five fields format and evaluated in UTC.
+	Schedule string `json:"schedule"`
+	// Duration is for how long the window stays open.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RolloutBatchingOverrides coalesces the registry rollouts caused by changes
+// of its inputs, e.g. the CA bundle, the proxy or the storage credentials.
+// The first change starts a debounce interval, the registry is rolled out
+// once with every change made until the interval ends. Registry upgrades
+// are never delayed.
+type RolloutBatchingOverrides struct {
+	// DebounceInterval is how long a rollout waits for further changes.
+	DebounceInterval metav1.Duration `json:"debounceInterval"`
+}
+
+// PrunerOverrides configures how the image pruner reaches the registry. They
+// are needed on topologies where the pruner can't use the registry Service,
+// e.g. when it runs on a hosted control plane.
+type PrunerOverrides struct {
+	// RegistryURL is the URL the pruner uses to reach the registry, usually
+	// the one of an external route. Defaults to the internal registry
+	// hostname.
+	RegistryURL string `json:"registryURL,omitempty"`
+	// CABundleConfigMap is the name of a config map in the registry
+	// namespace holding, under the ca-bundle.crt key, the CA bundle used
+	// to verify the registry certificate. Defaults to the service CA.
+	CABundleConfigMap string `json:"caBundleConfigMap,omitempty"`
+	// Insecure allows the pruner to reach the registry over plain http or
+	// without verifying its certificate.
+	Insecure bool `json:"insecure,omitempty"`
+	// NamespaceSelector restricts the pruning of image stream tag
+	// history to the namespaces whose labels match it, the image streams
+	// of other namespaces keep their whole history. Namespaces are
+	// excluded with a NotIn or DoesNotExist expression, e.g. on the
+	// imageregistry.openshift.io/prune label. Images that are not
+	// referenced anymore are still pruned cluster wide.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// HostedCluster makes the pruner prune a HyperShift hosted cluster
+	// when the operator runs in its control plane on the management
+	// cluster. The pruner job runs on the management cluster with the
+	// credentials of the hosted cluster.
+	HostedCluster *PrunerHostedClusterOverrides `json:"hostedCluster,omitempty"`
+}
+
+// PrunerHostedClusterOverrides points the pruner to a hosted cluster. The
+// internal registry hostname and the service CA of the hosted cluster are
+// not available on the management cluster, RegistryURL is required and the
+// registry certificate is verified with CABundleConfigMap.
+type PrunerHostedClusterOverrides struct {
+	// KubeconfigSecret is the name of a secret in the registry namespace
+	// holding a kubeconfig for the hosted cluster.
+	KubeconfigSecret string `json:"kubeconfigSecret"`
+	// KubeconfigKey is the key of the kubeconfig in the secret. Defaults
+	// to kubeconfig.
+	KubeconfigKey string `json:"kubeconfigKey,omitempty"`
+}
+
+// RouteOverrides holds settings for a route exposing the registry.
+type RouteOverrides struct {
+	// IPWhitelist is a list of IP addresses and CIDR ranges allowed to
+	// reach the registry through the route.
+	IPWhitelist []string `json:"ipWhitelist,omitempty"`
+}
+
+// StorageOverrides holds storage settings that are not part of the registry
+// config API.
+type StorageOverrides struct {
+	// RecoveryPolicy controls what the operator does when it finds that
+	// the storage it manages was deleted out-of-band. Defaults to
+	// StorageRecoveryPolicyReportOnly.
+	RecoveryPolicy StorageRecoveryPolicy `json:"recoveryPolicy,omitempty"`
+	// DeletionPolicy controls whether the storage the operator manages is
+	// deleted when the registry is removed. Defaults to
+	// StorageDeletionPolicyDelete.
+	DeletionPolicy StorageDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// RequirePlanApproval makes the operator wait for the storage
+	// provisioning plan to be approved before it provisions the storage
+	// for the first time. The plan is reported by the
+	// StorageProvisioningPlan condition.
+	RequirePlanApproval bool `json:"requirePlanApproval,omitempty"`
+
+	Azure  *azure.Overrides `json:"azure,omitempty"`
+	GCS    *GCSOverrides    `json:"gcs,omitempty"`
+	IBMCOS *IBMCOSOverrides `json:"ibmcos,omitempty"`
+	PVC    *PVCOverrides    `json:"pvc,omitempty"`
+	Swift  *SwiftOverrides  `json:"swift,omitempty"`
+
+	// TLSPolicies holds the transport security requirements for the
+	// storage endpoints, keyed by storage type (S3, Swift).
+	TLSPolicies map[string]StorageTLSPolicy `json:"tlsPolicies,omitempty"`
+}
+
+// StorageTLSPolicy restricts the storage endpoints the registry is allowed
+// to talk to. The registry always negotiates TLS 1.2 or newer with https
+// endpoints, so requiring https is enough to encrypt the traffic to the
+// storage.
+type StorageTLSPolicy struct {
+	// RequireHTTPS makes the operator degrade when the registry is
+	// configured to reach its storage over plain http.
+	RequireHTTPS bool `json:"requireHTTPS,omitempty"`
+	// AllowedHTTPEndpoints lists the plain http endpoints that are
+	// accepted even when RequireHTTPS is set.
+	AllowedHTTPEndpoints []string `json:"allowedHTTPEndpoints,omitempty"`
+}
+
+// GCSOverrides holds the GCS specific storage settings. They are read by the
+// GCS storage driver directly.
+type GCSOverrides struct {
+	// VPCServiceControlsPerimeter is the name of the VPC Service Controls
+	// perimeter the bucket is expected to be in. It is only used to give
+	// more context when requests are rejected by VPC Service Controls.
+	VPCServiceControlsPerimeter string `json:"vpcServiceControlsPerimeter,omitempty"`
+	// HierarchicalNamespace creates the bucket provisioned by the
+	// operator with a hierarchical namespace, which speeds up the
+	// renames the registry does when it commits large layers. It can
+	// only be set when the bucket is created, the bucket gets a flat
+	// namespace if GCS rejects it.
+	HierarchicalNamespace bool `json:"hierarchicalNamespace,omitempty"`
+	// BucketIAM grants access to the bucket to the service account of
+	// the registry and the listed members through the bucket IAM policy.
+	// The other principals with access to the bucket are reported by the
+	// GCSBucketIAM condition.
+	BucketIAM *gcs.BucketIAM `json:"bucketIAM,omitempty"`
+}
+
+// IBMCOSOverrides holds the IBM COS specific storage settings. They are read
+// by the IBM COS storage driver directly.
+type IBMCOSOverrides struct {
+	// BucketConfiguration sets the firewall and the hard quota of the
+	// bucket when it is managed by the operator.
+	BucketConfiguration *ibmcos.BucketConfiguration `json:"bucketConfiguration,omitempty"`
+}
+
+// PVCOverrides holds the PVC specific storage settings. They are read by the
+// PVC storage driver directly.
+type PVCOverrides struct {
+	Profile        *pvc.Profile        `json:"profile,omitempty"`
+	Autoscaling    *pvc.Autoscaling    `json:"autoscaling,omitempty"`
+	FailureDomains *pvc.FailureDomains `json:"failureDomains,omitempty"`
+}
+
+type StorageRecoveryPolicy string
+
+const (
+	// StorageRecoveryPolicyReportOnly leaves the operator degraded until
+	// the storage is restored manually.
+	StorageRecoveryPolicyReportOnly StorageRecoveryPolicy = "ReportOnly"
+
+	// StorageRecoveryPolicyRecreate makes the operator provision the
+	// storage again and restart the registry.
+	StorageRecoveryPolicyRecreate StorageRecoveryPolicy = "Recreate"
+)
+
+type StorageDeletionPolicy string
+
+const (
+	// StorageDeletionPolicyDelete makes the operator delete the storage
+	// it manages when the registry is removed.
+	StorageDeletionPolicyDelete StorageDeletionPolicy = "Delete"
+
+	// StorageDeletionPolicyRetain leaves the storage in place when the
+	// registry is removed, so the operator can provision storage that
+	// outlives the cluster.
+	StorageDeletionPolicyRetain StorageDeletionPolicy = "Retain"
+)
+
+// SwiftOverrides holds the Swift specific storage settings.
+type SwiftOverrides struct {
+	TempURL *SwiftTempURLOverrides `json:"tempURL,omitempty"`
+	Quota   *swift.Quota           `json:"quota,omitempty"`
+}
+
+// SwiftTempURLOverrides configures the temporary URL key the operator manages
+// on the registry Swift container. With a key in place the registry redirects
+// blob downloads to signed Swift URLs instead of proxying the content.
+type SwiftTempURLOverrides struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// RotationInterval is how often the key is replaced. The previous key
+	// is kept as the secondary container key so URLs already handed out
+	// remain valid. The key is never rotated if unset.
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+}
+
+// GetConfigOverrides decodes the unsupported config overrides present in the
+// provided registry config. An empty ConfigOverrides is returned when no
+// overrides are set.
+func GetConfigOverrides(cr *imageregistryv1.Config) (*ConfigOverrides, error) {
+	overrides := &ConfigOverrides{}
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return overrides, nil
+	}
+	if err := json.Unmarshal(rawoverrides, overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	return overrides, nil
 }
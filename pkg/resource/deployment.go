@@ -5,15 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	appsapi "k8s.io/api/apps/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	appsset "k8s.io/client-go/kubernetes/typed/apps/v1"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	appslisters "k8s.io/client-go/listers/apps/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -23,12 +29,18 @@ import (
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 var _ Mutator = &generatorDeployment{}
 
+// maxUpdateDiffLength is the length after which the changes recorded on the
+// deployment are truncated.
+const maxUpdateDiffLength = 8192
+
 type generatorDeployment struct {
 	eventRecorder   events.Recorder
 	lister          appslisters.DeploymentNamespaceLister
@@ -39,9 +51,21 @@ type generatorDeployment struct {
 	client          appsset.AppsV1Interface
 	driver          storage.Driver
 	cr              *imageregistryv1.Config
+	maintenance     *maintenance
+	batch           *rolloutBatch
+
+	// domain is the zone the registry pods are pinned to, along with
+	// their claim, nil unless the registry runs in several zones.
+	domain *util.FailureDomain
+	// failover is true for the deployment of the registry replica
+	// running in the second zone.
+	failover bool
+	// shard is the registry shard the deployment runs, nil for the
+	// registry deployment.
+	shard *ShardOverrides
 }
 
-func newGeneratorDeployment(eventRecorder events.Recorder, lister appslisters.DeploymentNamespaceLister, configMapLister corelisters.ConfigMapNamespaceLister, secretLister corelisters.SecretNamespaceLister, proxyLister configlisters.ProxyLister, coreClient coreset.CoreV1Interface, client appsset.AppsV1Interface, driver storage.Driver, cr *imageregistryv1.Config) *generatorDeployment {
+func newGeneratorDeployment(eventRecorder events.Recorder, lister appslisters.DeploymentNamespaceLister, configMapLister corelisters.ConfigMapNamespaceLister, secretLister corelisters.SecretNamespaceLister, proxyLister configlisters.ProxyLister, coreClient coreset.CoreV1Interface, client appsset.AppsV1Interface, driver storage.Driver, cr *imageregistryv1.Config, m *maintenance, b *rolloutBatch) *generatorDeployment {
 	return &generatorDeployment{
 		eventRecorder:   eventRecorder,
 		lister:          lister,
@@ -52,6 +76,8 @@ func newGeneratorDeployment(eventRecorder events.Recorder, lister appslisters.De
 		client:          client,
 		driver:          driver,
 		cr:              cr,
+		maintenance:     m,
+		batch:           b,
 	}
 }
 
@@ -72,6 +98,12 @@ func (gd *generatorDeployment) GetNamespace() string {
 }
 
 func (gd *generatorDeployment) GetName() string {
+	if gd.shard != nil {
+		return defaults.ShardNamePrefix + gd.shard.Name
+	}
+	if gd.failover {
+		return defaults.FailoverDeploymentName
+	}
 	return defaults.ImageRegistryName
 }
 
@@ -94,6 +126,9 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 		podTemplateSpec.Annotations = map[string]string{}
 	}
 	podTemplateSpec.Annotations[defaults.ChecksumOperatorDepsAnnotation] = depsChecksum
+	if recreated := gd.cr.Annotations[defaults.StorageRecreatedAnnotation]; recreated != "" {
+		podTemplateSpec.Annotations[defaults.StorageRecreatedAnnotation] = recreated
+	}
 
 	// Strategy defaults to RollingUpdate
 	deployStrategy := appsapi.DeploymentStrategyType(gd.cr.Spec.RolloutStrategy)
@@ -156,23 +191,53 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 		},
 	}
 
-	rawoverrides := gd.cr.Spec.UnsupportedConfigOverrides.Raw
-	if len(rawoverrides) > 0 {
-		var overrides ConfigOverrides
-		if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
-			return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	overrides, err := GetConfigOverrides(gd.cr)
+	if err != nil {
+		return nil, err
+	}
+	if depoverrides := overrides.Deployment; depoverrides != nil {
+		deploy.Spec.Template.Spec.RuntimeClassName = depoverrides.RuntimeClassName
+		registry := &deploy.Spec.Template.Spec.Containers[0]
+		if err := applyProbeOverrides(registry.LivenessProbe, depoverrides.LivenessProbe); err != nil {
+			return nil, fmt.Errorf("invalid liveness probe override: %w", err)
 		}
-
-		depoverrides := overrides.Deployment
-		if depoverrides != nil {
-			deploy.Spec.Template.Spec.RuntimeClassName = depoverrides.RuntimeClassName
-			for key, val := range depoverrides.Annotations {
-				deploy.Annotations[key] = val
-				deploy.Spec.Template.Annotations[key] = val
+		if err := applyProbeOverrides(registry.ReadinessProbe, depoverrides.ReadinessProbe); err != nil {
+			return nil, fmt.Errorf("invalid readiness probe override: %w", err)
+		}
+		for key, val := range depoverrides.Annotations {
+			deploy.Annotations[key] = val
+			deploy.Spec.Template.Annotations[key] = val
+		}
+		serviceAccountName, err := getRegistryServiceAccountName(gd.cr)
+		if err != nil {
+			return nil, err
+		}
+		deploy.Spec.Template.Spec.ServiceAccountName = serviceAccountName
+		for _, secret := range depoverrides.ImagePullSecrets {
+			if errs := validation.IsDNS1123Subdomain(secret.Name); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid image pull secret name %q: %s", secret.Name, strings.Join(errs, ", "))
 			}
+			deploy.Spec.Template.Spec.ImagePullSecrets = append(deploy.Spec.Template.Spec.ImagePullSecrets, secret)
 		}
 	}
 
+	gd.applyFailureDomain(deploy)
+	if err := gd.applyShard(deploy); err != nil {
+		return nil, err
+	}
+
+	templateDgst, err := strategy.Checksum(deploy.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	deploy.ObjectMeta.Annotations[defaults.ChecksumPodTemplateAnnotation] = templateDgst
+	if err := gd.deferRollout(deploy); err != nil {
+		return nil, err
+	}
+	if err := gd.batchRollout(deploy); err != nil {
+		return nil, err
+	}
+
 	dgst, err := strategy.Checksum(deploy)
 	if err != nil {
 		return nil, err
@@ -182,6 +247,72 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 	return deploy, nil
 }
 
+// deferRollout keeps the pod template of the current deployment when the
+// template changes outside of the maintenance window. Upgrades are rolled
+// out right away.
+func (gd *generatorDeployment) deferRollout(deploy *appsapi.Deployment) error {
+	if gd.maintenance.open() {
+		return nil
+	}
+
+	current, err := gd.lister.Get(gd.GetName())
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	currentDgst := current.Annotations[defaults.ChecksumPodTemplateAnnotation]
+	if currentDgst == "" || currentDgst == deploy.Annotations[defaults.ChecksumPodTemplateAnnotation] {
+		return nil
+	}
+	if current.Annotations[defaults.VersionAnnotation] != deploy.Annotations[defaults.VersionAnnotation] {
+		return nil
+	}
+
+	if !gd.maintenance.allowed("registry rollout") {
+		deploy.Spec.Template = *current.Spec.Template.DeepCopy()
+		deploy.Annotations[defaults.ChecksumPodTemplateAnnotation] = currentDgst
+	}
+	return nil
+}
+
+// batchRollout keeps the pod template of the current deployment until the
+// debounce interval that started with the first template change ends, so
+// the changes made meanwhile are rolled out together. Upgrades are rolled
+// out right away.
+func (gd *generatorDeployment) batchRollout(deploy *appsapi.Deployment) error {
+	if !gd.batch.enabled() {
+		return nil
+	}
+
+	current, err := gd.lister.Get(gd.GetName())
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	currentDgst := current.Annotations[defaults.ChecksumPodTemplateAnnotation]
+	if currentDgst == "" || currentDgst == deploy.Annotations[defaults.ChecksumPodTemplateAnnotation] {
+		return nil
+	}
+	if current.Annotations[defaults.VersionAnnotation] != deploy.Annotations[defaults.VersionAnnotation] {
+		return nil
+	}
+
+	hold, since := gd.batch.hold(current)
+	if !hold {
+		return nil
+	}
+	klog.Infof("holding back the registry rollout until %s to batch further changes", since.Add(gd.batch.interval).UTC().Format(time.RFC3339))
+	deploy.Annotations[defaults.RolloutPendingSinceAnnotation] = since.UTC().Format(time.RFC3339)
+	deploy.Annotations[defaults.RolloutPendingTemplateAnnotation] = currentDgst
+	deploy.Spec.Template = *current.Spec.Template.DeepCopy()
+	deploy.Annotations[defaults.ChecksumPodTemplateAnnotation] = currentDgst
+	return nil
+}
+
 func (gd *generatorDeployment) Get() (runtime.Object, error) {
 	return gd.lister.Get(gd.GetName())
 }
@@ -218,11 +349,48 @@ func (gd *generatorDeployment) Update(o runtime.Object) (runtime.Object, bool, e
 
 	if updated {
 		gd.UpdateLastGeneration(dep.ObjectMeta.Generation)
+		gd.recordUpdateDiff(o.(*appsapi.Deployment), dep)
 	}
 
 	return dep, updated, nil
 }
 
+// recordUpdateDiff records the changes made to the deployment in its
+// defaults.UpdateDiffAnnotation annotation when it is requested in the
+// unsupported config overrides. The annotation is kept by later updates, as
+// the operator doesn't set it in the expected deployment. Failures are only
+// logged, the deployment is already updated.
+func (gd *generatorDeployment) recordUpdateDiff(old, dep *appsapi.Deployment) {
+	overrides, err := GetConfigOverrides(gd.cr)
+	if err != nil || overrides.Deployment == nil || !overrides.Deployment.RecordUpdateDiff {
+		return
+	}
+
+	diff, err := object.DiffString(old, dep)
+	if err != nil {
+		klog.Warningf("unable to calculate the changes made to the deployment %s: %s", dep.Name, err)
+		return
+	}
+	if len(diff) > maxUpdateDiffLength {
+		diff = diff[:maxUpdateDiffLength] + "..."
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				defaults.UpdateDiffAnnotation: diff,
+			},
+		},
+	})
+	if err != nil {
+		klog.Warningf("unable to record the changes made to the deployment %s: %s", dep.Name, err)
+		return
+	}
+	_, err = gd.client.Deployments(dep.Namespace).Patch(context.TODO(), dep.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		klog.Warningf("unable to record the changes made to the deployment %s: %s", dep.Name, err)
+	}
+}
+
 func (gd *generatorDeployment) UpdateLastGeneration(lastGen int64) {
 	for i, gen := range gd.cr.Status.Generations {
 		if gen.Name == gd.GetName() &&
@@ -21,6 +21,7 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func TestChecksum(t *testing.T) {
@@ -189,6 +190,10 @@ func (d *testDriver) ConfigEnv() (envvar.List, error) {
 	return nil, nil
 }
 
+func (d *testDriver) Capabilities() util.Capabilities {
+	panic("Capabilities not implemented")
+}
+
 func (d *testDriver) CreateStorage(*imageregistryv1.Config) error {
 	panic("CreateStorage not implemented")
 }
@@ -226,3 +231,66 @@ func (d *testDriver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
 	}
 	return volumes, []corev1.VolumeMount{}, nil
 }
+
+func TestRecordUpdateDiff(t *testing.T) {
+	deployment := func(secret, level string) *appsapi.Deployment {
+		return &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.ImageRegistryName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Spec: appsapi.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "registry",
+								Env: []corev1.EnvVar{
+									{Name: "REGISTRY_HTTP_SECRET", Value: secret},
+									{Name: "REGISTRY_LOG_LEVEL", Value: level},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		expected  string
+	}{
+		{
+			name: "not requested",
+		},
+		{
+			name:      "requested",
+			overrides: `{"deployment":{"recordUpdateDiff":true}}`,
+			expected:  `changed:spec.template.spec.containers.0.env.0.value={<REDACTED> -> <REDACTED>}, changed:spec.template.spec.containers.0.env.1.value={"info" -> "debug"}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			old := deployment("aaa", "info")
+			updated := deployment("bbb", "debug")
+			kubeClient := fake.NewSimpleClientset(updated)
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			gd := &generatorDeployment{
+				client: kubeClient.AppsV1(),
+				cr:     cr,
+			}
+			gd.recordUpdateDiff(old, updated)
+
+			got, err := kubeClient.AppsV1().Deployments(updated.Namespace).Get(context.Background(), updated.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := got.Annotations[defaults.UpdateDiffAnnotation]; diff != tt.expected {
+				t.Errorf("got recorded changes %q, want %q", diff, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
+)
+
+// effectiveConfigKey is the key of the effective config map holding the
+// rendered configuration.
+const effectiveConfigKey = "config.yml"
+
+// redactedValue replaces sensitive values in the rendered configuration.
+const redactedValue = "<redacted>"
+
+// effectiveConfigHeader explains where the rendered configuration comes from.
+const effectiveConfigHeader = `# Configuration of the image registry deployment, rendered from the
+# REGISTRY_* environment variables of the registry container. These settings
+# override the config.yml shipped in the registry image. Sensitive values are
+# redacted.
+`
+
+var _ Mutator = &generatorEffectiveConfig{}
+
+// generatorEffectiveConfig documents the configuration the registry deployment
+// runs with in a config map, so it can be inspected without exec'ing into the
+// registry pods.
+type generatorEffectiveConfig struct {
+	lister       corelisters.ConfigMapNamespaceLister
+	client       coreset.CoreV1Interface
+	deployLister appslisters.DeploymentNamespaceLister
+}
+
+func newGeneratorEffectiveConfig(lister corelisters.ConfigMapNamespaceLister, client coreset.CoreV1Interface, deployLister appslisters.DeploymentNamespaceLister) *generatorEffectiveConfig {
+	return &generatorEffectiveConfig{
+		lister:       lister,
+		client:       client,
+		deployLister: deployLister,
+	}
+}
+
+func (g *generatorEffectiveConfig) Type() runtime.Object {
+	return &corev1.ConfigMap{}
+}
+
+func (g *generatorEffectiveConfig) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (g *generatorEffectiveConfig) GetName() string {
+	return defaults.EffectiveConfigConfigMapName
+}
+
+func (g *generatorEffectiveConfig) expected() (runtime.Object, error) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      g.GetName(),
+			Namespace: g.GetNamespace(),
+		},
+		Data: map[string]string{},
+	}
+
+	deploy, err := g.deployLister.Get(defaults.ImageRegistryName)
+	if kerrors.IsNotFound(err) {
+		return cm, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var env []corev1.EnvVar
+	for _, c := range deploy.Spec.Template.Spec.Containers {
+		if c.Name == "registry" {
+			env = c.Env
+		}
+	}
+	config, err := renderEffectiveConfig(env)
+	if err != nil {
+		return nil, err
+	}
+
+	cm.Annotations = map[string]string{
+		defaults.DeploymentGenerationAnnotation: strconv.FormatInt(deploy.Generation, 10),
+		defaults.VersionAnnotation:              deploy.Annotations[defaults.VersionAnnotation],
+	}
+	cm.Data[effectiveConfigKey] = config
+	return cm, nil
+}
+
+// renderEffectiveConfig turns the REGISTRY_* environment variables into the
+// configuration tree they set, the same way the registry does:
+// REGISTRY_STORAGE_S3_BUCKET sets storage.s3.bucket. Values sourced from
+// secrets or that look sensitive are redacted.
+func renderEffectiveConfig(env []corev1.EnvVar) (string, error) {
+	config := map[string]interface{}{}
+	for _, e := range env {
+		if !strings.HasPrefix(e.Name, "REGISTRY_") {
+			continue
+		}
+
+		var value interface{}
+		switch {
+		case e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil:
+			value = redactedValue
+		case e.ValueFrom != nil && e.ValueFrom.ConfigMapKeyRef != nil:
+			value = fmt.Sprintf("<from config map %s, key %s>", e.ValueFrom.ConfigMapKeyRef.Name, e.ValueFrom.ConfigMapKeyRef.Key)
+		case e.ValueFrom != nil:
+			value = "<from the pod>"
+		case object.SensitiveEnvVar(e.Name):
+			value = redactedValue
+		default:
+			// values are YAML encoded, the registry keeps the
+			// string when it cannot be decoded.
+			if err := yaml.Unmarshal([]byte(e.Value), &value); err != nil {
+				value = e.Value
+			}
+		}
+
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(e.Name, "REGISTRY_")), "_")
+		setConfigValue(config, path, value)
+	}
+
+	buf, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("unable to render the effective registry configuration: %w", err)
+	}
+	return effectiveConfigHeader + string(buf), nil
+}
+
+// setConfigValue sets the value at path in config. A scalar set on a section
+// that has parameters selects the section, e.g. REGISTRY_STORAGE=s3 with
+// REGISTRY_STORAGE_S3_BUCKET, so it becomes a key of the section.
+func setConfigValue(config map[string]interface{}, path []string, value interface{}) {
+	key := path[0]
+	if len(path) == 1 {
+		if section, ok := config[key].(map[string]interface{}); ok {
+			if name, ok := value.(string); ok {
+				if _, ok := section[name]; !ok {
+					section[name] = map[string]interface{}{}
+				}
+				return
+			}
+		}
+		config[key] = value
+		return
+	}
+
+	section, ok := config[key].(map[string]interface{})
+	if !ok {
+		section = map[string]interface{}{}
+		if name, ok := config[key].(string); ok {
+			section[name] = map[string]interface{}{}
+		}
+		config[key] = section
+	}
+	setConfigValue(section, path[1:], value)
+}
+
+func (g *generatorEffectiveConfig) Get() (runtime.Object, error) {
+	return g.lister.Get(g.GetName())
+}
+
+func (g *generatorEffectiveConfig) Create() (runtime.Object, error) {
+	return commonCreate(g, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (g *generatorEffectiveConfig) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(g, o, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (g *generatorEffectiveConfig) Delete(opts metav1.DeleteOptions) error {
+	return g.client.ConfigMaps(g.GetNamespace()).Delete(
+		context.TODO(), g.GetName(), opts,
+	)
+}
+
+func (g *generatorEffectiveConfig) Owned() bool {
+	return true
+}
@@ -0,0 +1,50 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRenderEffectiveConfig(t *testing.T) {
+	env := []corev1.EnvVar{
+		{Name: "REGISTRY_STORAGE", Value: "s3"},
+		{Name: "REGISTRY_STORAGE_S3_BUCKET", Value: "image-registry"},
+		{Name: "REGISTRY_STORAGE_S3_ENCRYPT", Value: "true"},
+		{Name: "REGISTRY_STORAGE_S3_ACCESSKEY", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "image-registry-private-configuration"},
+				Key:                  "REGISTRY_STORAGE_S3_ACCESSKEY",
+			},
+		}},
+		{Name: "REGISTRY_HTTP_ADDR", Value: ":5000"},
+		{Name: "REGISTRY_HTTP_SECRET", Value: "not-for-your-eyes"},
+		{Name: "REGISTRY_OPENSHIFT_SERVER_ADDR", Value: "image-registry.openshift-image-registry.svc:5000"},
+		{Name: "NO_PROXY", Value: "localhost"},
+	}
+
+	got, err := renderEffectiveConfig(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := effectiveConfigHeader + `http:
+  addr: :5000
+  secret: <redacted>
+openshift:
+  server:
+    addr: image-registry.openshift-image-registry.svc:5000
+storage:
+  s3:
+    accesskey: <redacted>
+    bucket: image-registry
+    encrypt: true
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if strings.Contains(got, "not-for-your-eyes") {
+		t.Errorf("the HTTP secret is not redacted")
+	}
+}
@@ -0,0 +1,291 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// egressIPResource is the OVN-Kubernetes EgressIP resource, there is no typed
+// client for it.
+var egressIPResource = schema.GroupVersionResource{Group: "k8s.ovn.org", Version: "v1", Resource: "egressips"}
+
+var _ Mutator = &generatorEgressIP{}
+
+// generatorEgressIP generates the EgressIP routing the traffic the registry
+// pods send out of the cluster through the egress IPs set by the user.
+type generatorEgressIP struct {
+	client dynamic.Interface
+	ips    []string
+}
+
+func newGeneratorEgressIP(client dynamic.Interface, ips []string) *generatorEgressIP {
+	return &generatorEgressIP{
+		client: client,
+		ips:    ips,
+	}
+}
+
+// getEgressIPs returns the egress IPs set for the registry pods, or nil if
+// none are.
+func getEgressIPs(cr *imageregistryv1.Config) ([]string, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides.Egress == nil {
+		return nil, nil
+	}
+	if len(overrides.Egress.IPs) == 0 {
+		return nil, fmt.Errorf("invalid egress: at least one egress IP is required")
+	}
+	for _, ip := range overrides.Egress.IPs {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid egress IP %q", ip)
+		}
+	}
+	return overrides.Egress.IPs, nil
+}
+
+func (ge *generatorEgressIP) Type() runtime.Object {
+	return &unstructured.Unstructured{}
+}
+
+func (ge *generatorEgressIP) GetNamespace() string {
+	return ""
+}
+
+func (ge *generatorEgressIP) GetName() string {
+	return defaults.EgressIPName
+}
+
+// expected returns the EgressIP selecting the registry pods. The namespace
+// is selected through the label set on every namespace, so it doesn't have
+// to be labeled.
+func (ge *generatorEgressIP) expected() (runtime.Object, error) {
+	ips := make([]interface{}, 0, len(ge.ips))
+	for _, ip := range ge.ips {
+		ips = append(ips, ip)
+	}
+	podLabels := map[string]interface{}{}
+	for k, v := range defaults.DeploymentLabels {
+		podLabels[k] = v
+	}
+	spec := map[string]interface{}{
+		"egressIPs": ips,
+		"namespaceSelector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{
+				"kubernetes.io/metadata.name": defaults.ImageRegistryOperatorNamespace,
+			},
+		},
+		"podSelector": map[string]interface{}{
+			"matchLabels": podLabels,
+		},
+	}
+	dgst, err := strategy.Checksum(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetAPIVersion(egressIPResource.GroupVersion().String())
+	u.SetKind("EgressIP")
+	u.SetName(ge.GetName())
+	u.SetAnnotations(map[string]string{
+		defaults.ChecksumOperatorAnnotation: dgst,
+	})
+	return u, nil
+}
+
+func (ge *generatorEgressIP) Get() (runtime.Object, error) {
+	return ge.client.Resource(egressIPResource).Get(context.TODO(), ge.GetName(), metav1.GetOptions{})
+}
+
+func (ge *generatorEgressIP) Create() (runtime.Object, error) {
+	n, err := ge.expected()
+	if err != nil {
+		return nil, err
+	}
+	return ge.client.Resource(egressIPResource).Create(context.TODO(), n.(*unstructured.Unstructured), metav1.CreateOptions{})
+}
+
+func (ge *generatorEgressIP) Update(o runtime.Object) (runtime.Object, bool, error) {
+	n, err := ge.expected()
+	if err != nil {
+		return o, false, err
+	}
+	current := o.(*unstructured.Unstructured)
+	expected := n.(*unstructured.Unstructured)
+
+	dgst := expected.GetAnnotations()[defaults.ChecksumOperatorAnnotation]
+	if current.GetAnnotations()[defaults.ChecksumOperatorAnnotation] == dgst {
+		return o, false, nil
+	}
+
+	current.Object["spec"] = expected.Object["spec"]
+	annotations := current.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[defaults.ChecksumOperatorAnnotation] = dgst
+	current.SetAnnotations(annotations)
+
+	u, err := ge.client.Resource(egressIPResource).Update(context.TODO(), current, metav1.UpdateOptions{})
+	return u, true, err
+}
+
+func (ge *generatorEgressIP) Delete(opts metav1.DeleteOptions) error {
+	return ge.client.Resource(egressIPResource).Delete(context.TODO(), ge.GetName(), opts)
+}
+
+func (ge *generatorEgressIP) Owned() bool {
+	return true
+}
+
+// removeEgressIP deletes the EgressIP of the registry pods once the user no
+// longer sets egress IPs. Only EgressIPs recorded in previous, the managed
+// objects before the current sync, are deleted, clusters that never used one
+// don't query the API.
+func (g *Generator) removeEgressIP(cr *imageregistryv1.Config, previous []ManagedObject) error {
+	ips, err := getEgressIPs(cr)
+	if err != nil {
+		return err
+	}
+	if ips != nil {
+		return nil
+	}
+
+	egressIP := ManagedObject{
+		Group:    egressIPResource.Group,
+		Resource: egressIPResource.Resource,
+		Name:     defaults.EgressIPName,
+	}
+	recorded := false
+	for _, obj := range previous {
+		if sameManagedObject(obj, egressIP) {
+			recorded = true
+			break
+		}
+	}
+	if !recorded {
+		return nil
+	}
+
+	err = g.clients.Dynamic.Resource(egressIPResource).Delete(context.TODO(), defaults.EgressIPName, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// egressIPCondition reports whether the egress IPs set by the user can be
+// assigned to the registry pods.
+const egressIPCondition = "EgressIP"
+
+// egressIPAvailable returns true if the cluster serves the EgressIP resource,
+// i.e. it runs OVN-Kubernetes.
+func egressIPAvailable(client discovery.DiscoveryInterface) (bool, error) {
+	resources, err := client.ServerResourcesForGroupVersion(egressIPResource.GroupVersion().String())
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == egressIPResource.Resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// syncEgressIPCondition reports whether the EgressIP of the registry pods can
+// be created, the egress IPs are not assigned on clusters without the
+// EgressIP resource.
+func syncEgressIPCondition(cr *imageregistryv1.Config, client discovery.DiscoveryInterface) error {
+	ips, err := getEgressIPs(cr)
+	if err != nil {
+		return err
+	}
+	if ips == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, egressIPCondition)
+		return nil
+	}
+
+	available, err := egressIPAvailable(client)
+	if err != nil {
+		return err
+	}
+	if !available {
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+			Type:    egressIPCondition,
+			Status:  operatorv1.ConditionFalse,
+			Reason:  "NotAvailable",
+			Message: fmt.Sprintf("The cluster network does not serve the %s resource, the egress IPs %s are not assigned to the registry pods", egressIPResource.GroupResource(), strings.Join(ips, ", ")),
+		})
+		return nil
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+		Type:    egressIPCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("The egress IPs %s are assigned to the registry pods", strings.Join(ips, ", ")),
+	})
+	return nil
+}
+
+// storageEgressCondition reports whether the storage firewall accepts
+// requests from the egress IPs of the registry pods.
+const storageEgressCondition = "StorageEgress"
+
+// syncStorageEgress verifies the storage firewall allows the egress IPs set
+// for the registry pods, so both sides are configured from one place.
+func syncStorageEgress(cr *imageregistryv1.Config, driver storage.Driver) error {
+	ips, err := getEgressIPs(cr)
+	if err != nil {
+		return err
+	}
+	if ips == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, storageEgressCondition)
+		return nil
+	}
+
+	cond := operatorv1.OperatorCondition{
+		Type:    storageEgressCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("The storage accepts requests from the egress IPs %s", strings.Join(ips, ", ")),
+	}
+	if verifier, ok := driver.(storage.EgressVerifier); !ok {
+		cond.Status = operatorv1.ConditionUnknown
+		cond.Reason = "NotVerified"
+		cond.Message = "The storage firewall cannot be verified for this storage type"
+	} else if denied, err := verifier.DeniedEgressIPs(ips); err != nil {
+		cond.Status = operatorv1.ConditionUnknown
+		cond.Reason = "VerificationFailed"
+		cond.Message = fmt.Sprintf("Unable to verify the storage firewall: %s", err)
+	} else if len(denied) > 0 {
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "EgressIPsDenied"
+		cond.Message = fmt.Sprintf("The storage firewall does not accept requests from the egress IPs %s", strings.Join(denied, ", "))
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+	return nil
+}
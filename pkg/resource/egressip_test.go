@@ -0,0 +1,155 @@
+package resource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestGetEgressIPs(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		ips       []string
+		err       string
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:      "egress IPs",
+			overrides: `{"egress":{"ips":["203.0.113.10","2001:db8::10"]}}`,
+			ips:       []string{"203.0.113.10", "2001:db8::10"},
+		},
+		{
+			name:      "no egress IP",
+			overrides: `{"egress":{"ips":[]}}`,
+			err:       "at least one egress IP is required",
+		},
+		{
+			name:      "invalid egress IP",
+			overrides: `{"egress":{"ips":["203.0.113.0/24"]}}`,
+			err:       `invalid egress IP "203.0.113.0/24"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+
+			ips, err := getEgressIPs(cr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ips, tt.ips) {
+				t.Errorf("got %v, want %v", ips, tt.ips)
+			}
+		})
+	}
+}
+
+func TestGeneratorEgressIPExpected(t *testing.T) {
+	ge := newGeneratorEgressIP(nil, []string{"203.0.113.10"})
+	o, err := ge.expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := o.(*unstructured.Unstructured)
+
+	if u.GetKind() != "EgressIP" || u.GetAPIVersion() != "k8s.ovn.org/v1" || u.GetName() != defaults.EgressIPName {
+		t.Errorf("got %s %s %s, want k8s.ovn.org/v1 EgressIP %s", u.GetAPIVersion(), u.GetKind(), u.GetName(), defaults.EgressIPName)
+	}
+	ips, _, _ := unstructured.NestedStringSlice(u.Object, "spec", "egressIPs")
+	if !reflect.DeepEqual(ips, []string{"203.0.113.10"}) {
+		t.Errorf("got egress IPs %v", ips)
+	}
+	namespace, _, _ := unstructured.NestedString(u.Object, "spec", "namespaceSelector", "matchLabels", "kubernetes.io/metadata.name")
+	if namespace != defaults.ImageRegistryOperatorNamespace {
+		t.Errorf("got namespace selector %q, want %q", namespace, defaults.ImageRegistryOperatorNamespace)
+	}
+	podLabels, _, _ := unstructured.NestedStringMap(u.Object, "spec", "podSelector", "matchLabels")
+	if !reflect.DeepEqual(podLabels, defaults.DeploymentLabels) {
+		t.Errorf("got pod selector %v, want %v", podLabels, defaults.DeploymentLabels)
+	}
+
+	// the current object is left alone while its checksum matches.
+	_, updated, err := ge.Update(u.DeepCopy())
+	if err != nil || updated {
+		t.Errorf("got updated %t and error %v, want no update", updated, err)
+	}
+}
+
+func TestSyncEgressIPCondition(t *testing.T) {
+	egressIPResources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "k8s.ovn.org/v1",
+			APIResources: []metav1.APIResource{{Name: "egressips"}},
+		},
+	}
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		resources []*metav1.APIResourceList
+		status    operatorv1.ConditionStatus
+		reason    string
+	}{
+		{
+			name: "no egress IPs",
+		},
+		{
+			name:      "egress IPs",
+			overrides: `{"egress":{"ips":["203.0.113.10"]}}`,
+			resources: egressIPResources,
+			status:    operatorv1.ConditionTrue,
+			reason:    "AsExpected",
+		},
+		{
+			name:      "no EgressIP resource",
+			overrides: `{"egress":{"ips":["203.0.113.10"]}}`,
+			status:    operatorv1.ConditionFalse,
+			reason:    "NotAvailable",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			if tt.overrides != "" {
+				cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+			}
+			client := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: tt.resources}}
+
+			if err := syncEgressIPCondition(cr, client); err != nil {
+				t.Fatal(err)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, egressIPCondition)
+			if tt.status == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+				return
+			}
+			if cond == nil {
+				t.Fatalf("condition %s not found", egressIPCondition)
+			}
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %s/%s, want %s/%s", cond.Status, cond.Reason, tt.status, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// failureDomainsCondition reports the zones the registry replicas are
+// pinned to, and that their storage is not replicated.
+const failureDomainsCondition = "FailureDomains"
+
+// zoneLabel is the node label holding the zone of the node.
+const zoneLabel = "topology.kubernetes.io/zone"
+
+// getFailureDomains returns the zones the registry replicas are pinned to,
+// nil if the registry does not run in several zones.
+func getFailureDomains(driver storage.Driver, cr *imageregistryv1.Config) ([]util.FailureDomain, error) {
+	pinner, ok := driver.(storage.ZonePinner)
+	if !ok {
+		return nil, nil
+	}
+	return pinner.FailureDomains(cr)
+}
+
+// failoverDeployment returns a generator for the deployment of the registry
+// replica running in the zone of domain. It is the registry deployment with
+// its own claim, pinned to another zone.
+func (gd *generatorDeployment) failoverDeployment(domain util.FailureDomain) *generatorDeployment {
+	failover := *gd
+	failover.domain = &domain
+	failover.failover = true
+	return &failover
+}
+
+// applyFailureDomain pins the registry pods of deploy to the zone of the
+// deployment failure domain and makes them use its claim. The pods of the
+// failover deployment get the defaults.FailoverDeploymentLabels labels
+// instead of the ones of the registry pods, so the selectors of the
+// registry deployment and of its pod disruption budget do not match them.
+func (gd *generatorDeployment) applyFailureDomain(deploy *appsapi.Deployment) {
+	if gd.domain == nil {
+		return
+	}
+
+	spec := &deploy.Spec.Template.Spec
+	nodeSelector := map[string]string{}
+	for k, v := range spec.NodeSelector {
+		nodeSelector[k] = v
+	}
+	nodeSelector[zoneLabel] = gd.domain.Zone
+	spec.NodeSelector = nodeSelector
+	for i, vol := range spec.Volumes {
+		if vol.PersistentVolumeClaim != nil {
+			spec.Volumes[i].PersistentVolumeClaim.ClaimName = gd.domain.Claim
+		}
+	}
+
+	if !gd.failover {
+		return
+	}
+	labels := defaults.FailoverDeploymentLabels
+	deploy.Labels = labels
+	deploy.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	templateLabels := map[string]string{}
+	for k, v := range deploy.Spec.Template.Labels {
+		templateLabels[k] = v
+	}
+	for k, v := range labels {
+		templateLabels[k] = v
+	}
+	templateLabels[defaults.FailureDomainLabel] = gd.domain.Zone
+	deploy.Spec.Template.Labels = templateLabels
+
+	// the constraints may be the ones of the registry config.
+	constraints := make([]corev1.TopologySpreadConstraint, len(spec.TopologySpreadConstraints))
+	copy(constraints, spec.TopologySpreadConstraints)
+	for i := range constraints {
+		constraints[i].LabelSelector = relabelSelector(constraints[i].LabelSelector, labels)
+	}
+	spec.TopologySpreadConstraints = constraints
+	if spec.Affinity != nil && spec.Affinity.PodAntiAffinity != nil {
+		terms := spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		for i := range terms {
+			terms[i].LabelSelector = relabelSelector(terms[i].LabelSelector, labels)
+		}
+	}
+}
+
+// activeReplicaSelector returns the selector of the pods the registry
+// Service sends the traffic to when the registry runs in several zones. The
+// replicas do not share their storage, so the traffic goes to the registry
+// deployment, and to the failover deployment only while the registry
+// deployment has no available replica and the failover one has.
+func (g *Generator) activeReplicaSelector() (map[string]string, error) {
+	primary, err := g.listers.Deployments.Get(defaults.ImageRegistryName)
+	if errors.IsNotFound(err) {
+		return defaults.DeploymentLabels, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if primary.Status.AvailableReplicas > 0 {
+		return defaults.DeploymentLabels, nil
+	}
+
+	failover, err := g.listers.Deployments.Get(defaults.FailoverDeploymentName)
+	if errors.IsNotFound(err) {
+		return defaults.DeploymentLabels, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if failover.Status.AvailableReplicas == 0 {
+		return defaults.DeploymentLabels, nil
+	}
+	return defaults.FailoverDeploymentLabels, nil
+}
+
+// syncFailureDomainsCondition reports the zones the registry replicas are
+// pinned to. Each replica has its own claim: the images pushed through one
+// replica cannot be pulled through the other, hence the failover replica
+// only serves requests while the registry deployment is unavailable.
+func syncFailureDomainsCondition(cr *imageregistryv1.Config, driver storage.Driver) {
+	domains, err := getFailureDomains(driver, cr)
+	if err != nil {
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+			Type:    failureDomainsCondition,
+			Status:  operatorv1.ConditionFalse,
+			Reason:  "InvalidFailureDomains",
+			Message: err.Error(),
+		})
+		return
+	}
+	if len(domains) < 2 {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, failureDomainsCondition)
+		return
+	}
+
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+		Type:   failureDomainsCondition,
+		Status: operatorv1.ConditionTrue,
+		Reason: "StorageNotReplicated",
+		Message: fmt.Sprintf(
+			"The registry runs a replica in the zone %s with the claim %s and a failover replica in the zone %s with the claim %s. "+
+				"The registry Service only fails over to the second replica while the first one is unavailable. "+
+				"The claims are not replicated: images pushed through one replica cannot be pulled through the other.",
+			domains[0].Zone, domains[0].Claim, domains[1].Zone, domains[1].Claim,
+		),
+	})
+}
+
+// removeFailoverDeployment deletes the failover deployment once the
+// registry no longer runs in several zones. The claim of the failover
+// replica is kept, it is removed along with the registry storage.
+func (g *Generator) removeFailoverDeployment(generators []Mutator) error {
+	for _, gen := range generators {
+		if gd, ok := gen.(*generatorDeployment); ok && gd.failover {
+			return nil
+		}
+	}
+
+	if _, err := g.listers.Deployments.Get(defaults.FailoverDeploymentName); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err := g.clients.Apps.Deployments(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.FailoverDeploymentName, metav1.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+package resource
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type zonePinnerDriver struct {
+	storage.Driver
+	domains []storageutil.FailureDomain
+	err     error
+}
+
+func (d *zonePinnerDriver) FailureDomains(*imageregistryv1.Config) ([]storageutil.FailureDomain, error) {
+	return d.domains, d.err
+}
+
+func TestApplyFailureDomain(t *testing.T) {
+	registryDeployment := func() *appsapi.Deployment {
+		return &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   defaults.ImageRegistryName,
+				Labels: defaults.DeploymentLabels,
+			},
+			Spec: appsapi.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: defaults.DeploymentLabels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: defaults.DeploymentLabels},
+					Spec: corev1.PodSpec{
+						NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+						Volumes: []corev1.Volume{{
+							Name: "registry-storage",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "image-registry-storage"},
+							},
+						}},
+					},
+				},
+			},
+		}
+	}
+
+	primary := &generatorDeployment{cr: &imageregistryv1.Config{}}
+	primary.domain = &storageutil.FailureDomain{Zone: "zone-a", Claim: "image-registry-storage"}
+	failover := primary.failoverDeployment(storageutil.FailureDomain{Zone: "zone-b", Claim: "image-registry-storage-failover"})
+	if failover.GetName() != defaults.FailoverDeploymentName || primary.GetName() != defaults.ImageRegistryName {
+		t.Fatalf("got deployments %s and %s, want %s and %s", primary.GetName(), failover.GetName(), defaults.ImageRegistryName, defaults.FailoverDeploymentName)
+	}
+
+	deploy := registryDeployment()
+	primary.applyFailureDomain(deploy)
+	if zone := deploy.Spec.Template.Spec.NodeSelector[zoneLabel]; zone != "zone-a" {
+		t.Errorf("got primary zone %q, want zone-a", zone)
+	}
+	if _, ok := deploy.Spec.Template.Labels[defaults.FailureDomainLabel]; ok {
+		t.Errorf("the primary pods are labeled with the failure domain, their template would change")
+	}
+
+	deploy = registryDeployment()
+	failover.applyFailureDomain(deploy)
+	spec := deploy.Spec.Template.Spec
+	if spec.NodeSelector[zoneLabel] != "zone-b" || spec.NodeSelector["kubernetes.io/os"] != "linux" {
+		t.Errorf("got failover node selector %v", spec.NodeSelector)
+	}
+	if claim := spec.Volumes[0].PersistentVolumeClaim.ClaimName; claim != "image-registry-storage-failover" {
+		t.Errorf("got failover claim %s, want image-registry-storage-failover", claim)
+	}
+	if !reflect.DeepEqual(deploy.Spec.Selector.MatchLabels, defaults.FailoverDeploymentLabels) || deploy.Spec.Template.Labels[defaults.FailureDomainLabel] != "zone-b" {
+		t.Errorf("got selector %v and pod labels %v, want the failover labels", deploy.Spec.Selector.MatchLabels, deploy.Spec.Template.Labels)
+	}
+	if labels.SelectorFromSet(defaults.DeploymentLabels).Matches(labels.Set(deploy.Spec.Template.Labels)) {
+		t.Errorf("got failover pod labels %v matched by the registry selector", deploy.Spec.Template.Labels)
+	}
+	if defaults.DeploymentLabels["docker-registry"] != "default" {
+		t.Errorf("the default deployment labels were altered")
+	}
+}
+
+func TestActiveReplicaSelector(t *testing.T) {
+	newDeployment := func(name string, available int32) *appsapi.Deployment {
+		return &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: defaults.ImageRegistryOperatorNamespace},
+			Status:     appsapi.DeploymentStatus{AvailableReplicas: available},
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		deployments []*appsapi.Deployment
+		expected    map[string]string
+	}{
+		{
+			name:     "no deployments yet",
+			expected: defaults.DeploymentLabels,
+		},
+		{
+			name: "primary available",
+			deployments: []*appsapi.Deployment{
+				newDeployment(defaults.ImageRegistryName, 1),
+				newDeployment(defaults.FailoverDeploymentName, 1),
+			},
+			expected: defaults.DeploymentLabels,
+		},
+		{
+			name: "primary unavailable",
+			deployments: []*appsapi.Deployment{
+				newDeployment(defaults.ImageRegistryName, 0),
+				newDeployment(defaults.FailoverDeploymentName, 1),
+			},
+			expected: defaults.FailoverDeploymentLabels,
+		},
+		{
+			name: "both unavailable",
+			deployments: []*appsapi.Deployment{
+				newDeployment(defaults.ImageRegistryName, 0),
+				newDeployment(defaults.FailoverDeploymentName, 0),
+			},
+			expected: defaults.DeploymentLabels,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, d := range tc.deployments {
+				if err := indexer.Add(d); err != nil {
+					t.Fatal(err)
+				}
+			}
+			g := &Generator{
+				listers: &client.Listers{
+					StorageListers: client.StorageListers{
+						Deployments: appslisters.NewDeploymentLister(indexer).Deployments(defaults.ImageRegistryOperatorNamespace),
+					},
+				},
+			}
+			selector, err := g.activeReplicaSelector()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(selector, tc.expected) {
+				t.Errorf("got selector %v, want %v", selector, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSyncFailureDomainsCondition(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		driver          storage.Driver
+		expectedStatus  operatorv1.ConditionStatus
+		expectedMessage string
+	}{
+		{
+			name:   "driver without zones",
+			driver: &testDriver{},
+		},
+		{
+			name:   "single zone",
+			driver: &zonePinnerDriver{},
+		},
+		{
+			name: "two zones",
+			driver: &zonePinnerDriver{domains: []storageutil.FailureDomain{
+				{Zone: "zone-a", Claim: "image-registry-storage"},
+				{Zone: "zone-b", Claim: "image-registry-storage-failover"},
+			}},
+			expectedStatus:  operatorv1.ConditionTrue,
+			expectedMessage: "images pushed through one replica cannot be pulled through the other",
+		},
+		{
+			name:            "invalid zones",
+			driver:          &zonePinnerDriver{err: errors.New("exactly two zones are required")},
+			expectedStatus:  operatorv1.ConditionFalse,
+			expectedMessage: "exactly two zones are required",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+				Type:   failureDomainsCondition,
+				Status: operatorv1.ConditionTrue,
+			})
+
+			syncFailureDomainsCondition(cr, tc.driver)
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, failureDomainsCondition)
+			if tc.expectedStatus == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Status != tc.expectedStatus || !strings.Contains(cond.Message, tc.expectedMessage) {
+				t.Errorf("got condition %#v, want status %s and message %q", cond, tc.expectedStatus, tc.expectedMessage)
+			}
+		})
+	}
+}
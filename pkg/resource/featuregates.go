@@ -0,0 +1,23 @@
+package resource
+
+import (
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+)
+
+// featureGatesCondition reports the state of the image registry feature
+// gates.
+const featureGatesCondition = "FeatureGates"
+
+// syncFeatureGatesCondition reports the state of gates in the status of cr.
+func syncFeatureGatesCondition(cr *imageregistryv1.Config, gates featuregates.Gates) {
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+		Type:    featureGatesCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: gates.String(),
+	})
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/retry"
@@ -19,13 +21,23 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 )
 
 func ApplyMutator(gen Mutator) error {
-	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+	_, _, err := applyMutator(gen)
+	return err
+}
+
+// applyMutator creates or updates the object of gen. It returns the object
+// and whether it was created or updated.
+func applyMutator(gen Mutator) (runtime.Object, bool, error) {
+	var current runtime.Object
+	var applied bool
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		o, err := gen.Get()
 		if err != nil {
 			if !errors.IsNotFound(err) {
@@ -43,6 +55,7 @@ func ApplyMutator(gen Mutator) error {
 			}
 
 			klog.Infof("object %s created: %s", Name(gen), str)
+			current, applied = n, true
 			return nil
 		}
 
@@ -54,14 +67,18 @@ func ApplyMutator(gen Mutator) error {
 			return fmt.Errorf("failed to update object %s: %s", Name(gen), err)
 		}
 		if updated {
-			difference, err := object.DiffString(o, n)
+			changes, err := object.Diff(o, n)
 			if err != nil {
 				klog.Errorf("unable to calculate difference: %s", err)
 			}
-			klog.Infof("object %s updated: %s", Name(gen), difference)
+			klog.InfoS("object updated", "kind", fmt.Sprintf("%T", gen.Type()), "object", klog.KRef(gen.GetNamespace(), gen.GetName()), "changes", changes)
+			current, applied = n, true
+			return nil
 		}
+		current, applied = o, false
 		return nil
 	})
+	return current, applied, err
 }
 
 func NewGenerator(eventRecorder events.Recorder, kubeconfig *rest.Config, clients *client.Clients, listers *client.Listers) *Generator {
@@ -78,40 +95,208 @@ type Generator struct {
 	kubeconfig    *rest.Config
 	listers       *client.Listers
 	clients       *client.Clients
+
+	// resyncAfter is how long until the changes held back by the last
+	// Apply are due, zero if none are.
+	resyncAfter time.Duration
+}
+
+// routeMutator returns the mutator exposing the registry for route, an
+// Ingress when the operator runs in standalone mode.
+func (g *Generator) routeMutator(cr *imageregistryv1.Config, route imageregistryv1.ImageRegistryConfigRoute) Mutator {
+	if defaults.Standalone {
+		return newGeneratorIngress(g.clients.Kube.NetworkingV1(), route)
+	}
+	return newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, route)
 }
 
 func (g *Generator) listRoutes(cr *imageregistryv1.Config) []Mutator {
 	var mutators []Mutator
 	if cr.Spec.DefaultRoute {
-		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, imageregistryv1.ImageRegistryConfigRoute{
+		mutators = append(mutators, g.routeMutator(cr, imageregistryv1.ImageRegistryConfigRoute{
 			Name: defaults.RouteName,
 		}))
 	}
 	for _, route := range cr.Spec.Routes {
-		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, route))
+		mutators = append(mutators, g.routeMutator(cr, route))
 	}
 	return mutators
 }
 
 func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
-	driver, err := storage.NewDriver(&cr.Spec.Storage, g.kubeconfig, &g.listers.StorageListers)
+	return g.list(cr, nil, nil)
+}
+
+// ResyncAfter returns how long until the changes held back by the last
+// Apply, to be batched or to wait for the maintenance window, are due, zero
+// if none are.
+func (g *Generator) ResyncAfter() time.Duration {
+	return g.resyncAfter
+}
+
+// list returns the mutators for cr. Disruptive changes are deferred until
+// the maintenance window m opens, a nil m allows them at any time. Registry
+// rollouts are batched by b, a nil b rolls out every change.
+func (g *Generator) list(cr *imageregistryv1.Config, m *maintenance, b *rolloutBatch) ([]Mutator, error) {
+	// the registry keeps its current storage, and the credentials for it,
+	// until the deferred storage reconfiguration is made.
+	storageConfig := &cr.Spec.Storage
+	if m.deferred(storageReconfigurationChange) {
+		storageConfig = &cr.Status.Storage
+	}
+	driver, err := storage.NewDriver(storageConfig, g.kubeconfig, &g.listers.StorageListers)
 	if err != nil && err != storage.ErrStorageNotConfigured {
 		return nil, err
 	} else if err == storage.ErrStorageNotConfigured {
 		klog.V(6).Info("storage not configured, some mutators might not work.")
 	}
+	if reader, ok := driver.(storage.ConfigStateReader); ok {
+		reader.ReadConfigState(cr)
+	}
 
 	var mutators []Mutator
 	mutators = append(mutators, newGeneratorClusterRole(g.listers.ClusterRoles, g.clients.RBAC))
-	mutators = append(mutators, newGeneratorClusterRoleBinding(g.listers.ClusterRoleBindings, g.clients.RBAC))
+	serviceAccountName, err := getRegistryServiceAccountName(cr)
+	if err != nil {
+		return nil, err
+	}
+	mutators = append(mutators, newGeneratorClusterRoleBinding(g.listers.ClusterRoleBindings, g.clients.RBAC, serviceAccountName))
 	mutators = append(mutators, newGeneratorServiceAccount(g.listers.ServiceAccounts, g.clients.Core))
 	mutators = append(mutators, newGeneratorPullSecret(g.clients.Core))
+
+	swiftTempURL, swiftTempURLOverrides, err := swiftTempURLEnabled(cr)
+	if err != nil {
+		return nil, err
+	}
+	if swiftTempURL {
+		mutators = append(mutators, newGeneratorSwiftTempURLSecret(g.listers.Secrets, g.clients.Core, swiftTempURLOverrides, m))
+	}
+
 	mutators = append(mutators, newGeneratorSecret(g.listers.Secrets, g.clients.Core, driver))
-	mutators = append(mutators, newGeneratorService(g.listers.Services, g.clients.Core))
-	mutators = append(mutators, newGeneratorDeployment(g.eventRecorder, g.listers.Deployments, g.listers.ConfigMaps, g.listers.Secrets, g.listers.ProxyConfigs, g.clients.Core, g.clients.Apps, driver, cr))
+	port, err := getRegistryPort(cr)
+	if err != nil {
+		return nil, err
+	}
+	clusterIP, err := getServiceClusterIP(cr)
+	if err != nil {
+		return nil, err
+	}
+	domains, err := getFailureDomains(driver, cr)
+	if err != nil {
+		return nil, err
+	}
+	service := newGeneratorService(g.listers.Services, g.clients.Core, port)
+	service.clusterIP = clusterIP
+	if len(domains) > 1 {
+		selector, err := g.activeReplicaSelector()
+		if err != nil {
+			return nil, err
+		}
+		service.selector = selector
+	}
+	mutators = append(mutators, service)
+	internalHostnames, err := getInternalHostnames(cr)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range internalHostnames {
+		svc, err := g.listers.Services.Get(name)
+		if err == nil && !ServiceIsInternalHostname(svc) {
+			klog.Warningf("service %s already exists and is not an internal hostname of the registry, leaving it untouched", name)
+			continue
+		} else if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		mutators = append(mutators, newGeneratorAliasService(g.listers.Services, g.clients.Core, port, name))
+	}
+
+	egressIPs, err := getEgressIPs(cr)
+	if err != nil {
+		return nil, err
+	}
+	if egressIPs != nil {
+		available, err := egressIPAvailable(g.clients.Kube.Discovery())
+		if err != nil {
+			return nil, err
+		}
+		if available {
+			mutators = append(mutators, newGeneratorEgressIP(g.clients.Dynamic, egressIPs))
+		}
+	}
+
+	gates, err := featuregates.Get(g.listers.FeatureGates, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !defaults.Standalone {
+		mutators = append(mutators, newGeneratorPrometheusRule(g.clients.Dynamic))
+	}
+
+	deployment := newGeneratorDeployment(g.eventRecorder, g.listers.Deployments, g.listers.ConfigMaps, g.listers.Secrets, g.listers.ProxyConfigs, g.clients.Core, g.clients.Apps, driver, cr, m, b)
+	mutators = append(mutators, deployment)
+	if len(domains) > 1 {
+		deployment.domain = &domains[0]
+		mutators = append(mutators, deployment.failoverDeployment(domains[1]))
+	}
+	shards, err := shardingEnabled(cr, gates)
+	if err != nil {
+		// the error is reported by the Sharding condition, the shards
+		// are left as they are until their configuration is fixed.
+		klog.Warningf("ignoring the registry shards: %s", err)
+		svc, err := g.listers.Services.Get(defaults.ServiceName)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil && reflect.DeepEqual(svc.Spec.Selector, shardRouterLabels) {
+			service.selector = shardRouterLabels
+		}
+	} else if len(shards) > 0 {
+		if len(domains) > 1 {
+			return nil, fmt.Errorf("the registry cannot be sharded while it runs in several zones")
+		}
+		for _, shard := range shards {
+			mutators = append(mutators, deployment.shardDeployment(shard))
+			mutators = append(mutators, newGeneratorShardService(g.listers.Services, g.clients.Core, port, shard.Name))
+		}
+		mutators = append(mutators, newGeneratorShardService(g.listers.Services, g.clients.Core, port, defaultShardName))
+		mutators = append(mutators, newGeneratorShardRouter(g.eventRecorder, g.listers.Deployments, g.listers.ConfigMaps, g.listers.Secrets, g.clients.Apps, cr, port, shards))
+		serving, err := g.shardRouterServing()
+		if err != nil {
+			return nil, err
+		}
+		if serving {
+			service.selector = shardRouterLabels
+		}
+	}
+	mutators = append(mutators, newGeneratorEffectiveConfig(g.listers.ConfigMaps, g.clients.Core, g.listers.Deployments))
+	mutators = append(mutators, newGeneratorSecretsStatus(g.listers.ConfigMaps, g.clients.Core, g.listers.Secrets, cr, driver))
 	mutators = append(mutators, newGeneratorPodDisruptionBudget(g.listers.PodDisruptionBudgets, g.clients.Kube.PolicyV1(), cr))
 	mutators = append(mutators, g.listRoutes(cr)...)
 
+	enabled, inventory, err := inventoryEnabled(cr)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		mutators = append(mutators, newGeneratorInventoryCronJob(g.clients.Batch, inventory))
+	}
+
+	// the storage is copied once no replica can write to it anymore.
+	upgrade, err := GetStorageUpgradeState(cr)
+	if err != nil {
+		return nil, err
+	}
+	if upgrade != nil && upgrade.copying() {
+		readOnly, err := g.registryReadOnly()
+		if err != nil {
+			return nil, err
+		}
+		if readOnly {
+			mutators = append(mutators, newGeneratorStorageSyncJob(g.clients.Batch, upgrade))
+		}
+	}
+
 	return mutators, nil
 }
 
@@ -121,7 +306,7 @@ func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
 //
 //	a.) check to make sure that we can access the storage or
 //	b.) see if we need to try to create the new storage
-func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
+func (g *Generator) syncStorage(cr *imageregistryv1.Config, gates featuregates.Gates, m *maintenance) error {
 	var runCreate bool
 	// Create a driver with the current configuration
 	driver, err := storage.NewDriver(&cr.Spec.Storage, g.kubeconfig, &g.listers.StorageListers)
@@ -136,7 +321,25 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	if gater, ok := driver.(storage.DisruptionGater); ok {
+		gater.SetDisruptionGate(m.allowed)
+	}
+
+	if err := checkStorageTLSPolicy(cr, driver); err != nil {
+		return err
+	}
+
+	if err := checkStorageRegionChange(cr, gates); err != nil {
+		return err
+	}
+
+	var recreate bool
 	if driver.StorageChanged(cr) {
+		// moving the registry to new storage is deferred to the
+		// maintenance window, the initial configuration is not.
+		if storageConfigured(cr.Status.Storage) && !m.allowed(storageReconfigurationChange) {
+			return nil
+		}
 		runCreate = true
 	} else {
 		exists, err := driver.StorageExists(cr)
@@ -145,10 +348,35 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 		}
 		if !exists {
 			runCreate = true
+			recreate = storageDeletedOutOfBand(cr, driver)
+		} else if autoscaler, ok := driver.(storage.Autoscaler); ok {
+			expansion, err := autoscaler.AutoscaleStorage(cr)
+			if err != nil {
+				return err
+			}
+			if expansion != "" {
+				g.eventRecorder.Eventf("StorageExpanded", "%s", expansion)
+			}
+		}
+		if exists {
+			if err := syncStorageEgress(cr, driver); err != nil {
+				return err
+			}
+		}
+	}
+
+	if recreate {
+		if err := g.checkStorageRecovery(cr, driver); err != nil {
+			return err
 		}
 	}
 
 	if runCreate {
+		if !storageConfigured(cr.Status.Storage) {
+			if err := checkStoragePlan(cr, driver); err != nil {
+				return err
+			}
+		}
 		reconf := g.storageReconfigured(cr, g.kubeconfig, g.listers)
 		if err := driver.CreateStorage(cr); err != nil {
 			return err
@@ -158,9 +386,117 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
+	if recreate {
+		if cr.Annotations == nil {
+			cr.Annotations = map[string]string{}
+		}
+		cr.Annotations[defaults.StorageRecreatedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		g.eventRecorder.Eventf("StorageRecreated", "Storage %s was recreated after being deleted out-of-band", driver.ID())
+	}
+
+	syncStorageCapabilitiesCondition(cr, driver.Capabilities())
+	syncStorageCredentialsCondition(cr, driver, time.Now())
+	syncFailureDomainsCondition(cr, driver)
+	return nil
+}
+
+// storageDeletedOutOfBand returns true if the storage provisioned and managed
+// by the operator is gone even though its configuration did not change.
+func storageDeletedOutOfBand(cr *imageregistryv1.Config, driver storage.Driver) bool {
+	return cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged && driver.ID() != ""
+}
+
+// checkStorageRecovery returns an error unless the user has opted in for the
+// operator to recreate storage that was deleted out-of-band.
+func (g *Generator) checkStorageRecovery(cr *imageregistryv1.Config, driver storage.Driver) error {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return err
+	}
+	policy := StorageRecoveryPolicyReportOnly
+	if overrides.Storage != nil && overrides.Storage.RecoveryPolicy != "" {
+		policy = overrides.Storage.RecoveryPolicy
+	}
+
+	switch policy {
+	case StorageRecoveryPolicyRecreate:
+		g.eventRecorder.Warningf("StorageDeleted", "Storage %s was deleted out-of-band, recreating it", driver.ID())
+		return nil
+	case StorageRecoveryPolicyReportOnly:
+		g.eventRecorder.Warningf("StorageDeleted", "Storage %s was deleted out-of-band", driver.ID())
+		return fmt.Errorf("storage %s was deleted out-of-band: restore it or set the storage recovery policy to %s", driver.ID(), StorageRecoveryPolicyRecreate)
+	default:
+		return fmt.Errorf("unknown storage recovery policy %q", policy)
+	}
+}
+
+// storageRetained returns true if the user asked for the storage to be left
+// in place when the registry is removed.
+func storageRetained(cr *imageregistryv1.Config) (bool, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return false, err
+	}
+	policy := StorageDeletionPolicyDelete
+	if overrides.Storage != nil && overrides.Storage.DeletionPolicy != "" {
+		policy = overrides.Storage.DeletionPolicy
+	}
+
+	switch policy {
+	case StorageDeletionPolicyDelete:
+		return false, nil
+	case StorageDeletionPolicyRetain:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown storage deletion policy %q", policy)
+	}
+}
+
+// checkStorageTLSPolicy returns an error if the storage endpoints do not
+// comply with the TLS policy set for the storage type in use.
+func checkStorageTLSPolicy(cr *imageregistryv1.Config, driver storage.Driver) error {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return err
+	}
+	if overrides.Storage == nil {
+		return nil
+	}
+	storageType := storage.StorageType(&cr.Spec.Storage)
+	policy, ok := overrides.Storage.TLSPolicies[storageType]
+	if !ok || !policy.RequireHTTPS {
+		return nil
+	}
+
+	endpointer, ok := driver.(storage.Endpointer)
+	if !ok {
+		// the driver only talks to the provider https endpoints.
+		return nil
+	}
+	endpoints, err := endpointer.Endpoints()
+	if err != nil {
+		return err
+	}
+
+	allowed := map[string]bool{}
+	for _, endpoint := range policy.AllowedHTTPEndpoints {
+		allowed[endpoint] = true
+	}
+	for _, endpoint := range endpoints {
+		if !strings.HasPrefix(strings.ToLower(endpoint), "http://") || allowed[endpoint] {
+			continue
+		}
+		return fmt.Errorf("%s storage endpoint %s does not use https as required by the storage TLS policy, add it to the allowed http endpoints to accept it", storageType, endpoint)
+	}
 	return nil
 }
 
+// storageConfigured returns true if s points to a storage backend.
+func storageConfigured(s imageregistryv1.ImageRegistryConfigStorage) bool {
+	s.ManagementState = ""
+	return !reflect.DeepEqual(s, imageregistryv1.ImageRegistryConfigStorage{})
+}
+
 // storageReconfigured returns true if we are, based on the provided config,
 // starting to use a different underlying storage location.
 func (g *Generator) storageReconfigured(
@@ -185,6 +521,10 @@ func (g *Generator) storageReconfigured(
 }
 
 func (g *Generator) removeObsoleteRoutes(cr *imageregistryv1.Config) error {
+	if defaults.Standalone {
+		return g.removeObsoleteIngresses(cr)
+	}
+
 	routes, err := g.listers.Routes.List(labels.Everything())
 	if err != nil {
 		return fmt.Errorf("failed to list routes: %s", err)
@@ -219,12 +559,128 @@ func (g *Generator) removeObsoleteRoutes(cr *imageregistryv1.Config) error {
 	return nil
 }
 
+// removeInventoryCronJob deletes the storage inventory CronJob if it is no
+// longer enabled by the user.
+func (g *Generator) removeInventoryCronJob(cr *imageregistryv1.Config) error {
+	enabled, _, err := inventoryEnabled(cr)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return nil
+	}
+	err = g.clients.Batch.CronJobs(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StorageInventoryName, metaapi.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// removeSwiftTempURLKeySecret deletes the Swift temporary URL key secret if
+// the user no longer wants the operator to manage the key.
+func (g *Generator) removeSwiftTempURLKeySecret(cr *imageregistryv1.Config) error {
+	enabled, _, err := swiftTempURLEnabled(cr)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return nil
+	}
+	if _, err := g.listers.Secrets.Get(defaults.SwiftTempURLKeySecretName); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = g.clients.Core.Secrets(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.SwiftTempURLKeySecretName, metaapi.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// removeObsoleteInternalHostnames deletes the alias Services that are no
+// longer requested by the user.
+func (g *Generator) removeObsoleteInternalHostnames(cr *imageregistryv1.Config) error {
+	internalHostnames, err := getInternalHostnames(cr)
+	if err != nil {
+		return err
+	}
+	knownNames := map[string]bool{}
+	for _, name := range internalHostnames {
+		knownNames[name] = true
+	}
+
+	services, err := g.listers.Services.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list services: %s", err)
+	}
+	for _, svc := range services {
+		if !ServiceIsInternalHostname(svc) || knownNames[svc.Name] {
+			continue
+		}
+		err = g.clients.Core.Services(defaults.ImageRegistryOperatorNamespace).Delete(
+			context.TODO(), svc.Name, metaapi.DeleteOptions{},
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 func (g *Generator) Apply(cr *imageregistryv1.Config) error {
-	err := g.syncStorage(cr)
+	m, err := newMaintenance(cr, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	defer m.syncCondition(cr)
+
+	gates, err := featuregates.Get(g.listers.FeatureGates, cr)
+	if err != nil {
+		return err
+	}
+	syncFeatureGatesCondition(cr, gates)
+
+	err = syncShardingCondition(cr, gates)
+	if err != nil {
+		return fmt.Errorf("unable to sync sharding condition: %w", err)
+	}
+
+	if !defaults.Standalone {
+		err = syncUserPrometheusRule(cr, g.listers.ConfigMaps, func(groups []ruleGroup) Mutator {
+			return newGeneratorUserPrometheusRule(g.clients.Dynamic, groups)
+		})
+		if err != nil {
+			return fmt.Errorf("unable to sync user prometheus rule: %w", err)
+		}
+	}
+
+	b, err := newRolloutBatch(cr, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	g.resyncAfter = 0
+	defer func() {
+		g.resyncAfter = b.resyncAfter
+		if after := m.resyncAfter(); after > 0 && (g.resyncAfter == 0 || after < g.resyncAfter) {
+			g.resyncAfter = after
+		}
+	}()
+
+	err = g.syncStorageUpgrade(cr, gates, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("unable to sync storage upgrade: %w", err)
+	}
+
+	err = g.syncStorage(cr, gates, m)
 	if err == storage.ErrStorageNotConfigured {
 		return err
 	} else if err != nil {
-		return fmt.Errorf("unable to sync storage configuration: %s", err)
+		return fmt.Errorf("unable to sync storage configuration: %w", err)
 	}
 
 	// XXX https://bugzilla.redhat.com/show_bug.cgi?id=1833109
@@ -243,21 +699,91 @@ func (g *Generator) Apply(cr *imageregistryv1.Config) error {
 	cr.Status.StorageManaged = cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
 	cr.Status.Storage.ManagementState = cr.Spec.Storage.ManagementState
 
-	generators, err := g.List(cr)
+	err = syncEgressIPCondition(cr, g.clients.Kube.Discovery())
 	if err != nil {
-		return fmt.Errorf("unable to get generators: %s", err)
+		return fmt.Errorf("unable to sync egress IP condition: %w", err)
+	}
+
+	generators, err := g.list(cr, m, b)
+	if err != nil {
+		return fmt.Errorf("unable to get generators: %w", err)
 	}
 
+	previous, err := GetManagedObjects(g.listers.ConfigMaps)
+	if err != nil {
+		return fmt.Errorf("unable to get the managed objects: %w", err)
+	}
+	now := metaapi.Now()
+	var managed []ManagedObject
 	for _, gen := range generators {
-		err = ApplyMutator(gen)
+		o, applied, err := applyMutator(gen)
 		if err != nil {
-			return fmt.Errorf("unable to apply objects: %s", err)
+			return fmt.Errorf("unable to apply objects: %w", err)
 		}
+		if !gen.Owned() || o == nil {
+			continue
+		}
+		obj, err := managedObject(o)
+		if err != nil {
+			klog.V(4).Infof("unable to record managed object %s: %s", Name(gen), err)
+			continue
+		}
+		managed = append(managed, recordManagedObject(previous, obj, applied, now))
+	}
+	sortManagedObjects(managed)
+	err = ApplyMutator(newGeneratorManagedObjects(g.listers.ConfigMaps, g.clients.Core, managed))
+	if err != nil {
+		return fmt.Errorf("unable to publish the managed objects: %w", err)
+	}
+
+	driver, err := storage.NewDriver(&cr.Spec.Storage, g.kubeconfig, &g.listers.StorageListers)
+	if err != nil {
+		return fmt.Errorf("unable to create storage driver: %w", err)
+	}
+	secretStatuses, err := getSecretStatuses(cr, driver, g.listers.Secrets)
+	if err != nil {
+		return fmt.Errorf("unable to sync secrets condition: %w", err)
 	}
+	syncSecretsCondition(cr, secretStatuses, time.Now().UTC())
 
 	err = g.removeObsoleteRoutes(cr)
 	if err != nil {
-		return fmt.Errorf("unable to remove obsolete routes: %s", err)
+		return fmt.Errorf("unable to remove obsolete routes: %w", err)
+	}
+
+	err = g.removeInventoryCronJob(cr)
+	if err != nil {
+		return fmt.Errorf("unable to remove storage inventory cronjob: %w", err)
+	}
+
+	err = g.removeStorageSyncJobs(cr)
+	if err != nil {
+		return fmt.Errorf("unable to remove storage sync jobs: %w", err)
+	}
+
+	err = g.removeSwiftTempURLKeySecret(cr)
+	if err != nil {
+		return fmt.Errorf("unable to remove swift temporary url key secret: %w", err)
+	}
+
+	err = g.removeObsoleteInternalHostnames(cr)
+	if err != nil {
+		return fmt.Errorf("unable to remove obsolete internal hostnames: %w", err)
+	}
+
+	err = g.removeEgressIP(cr, previous)
+	if err != nil {
+		return fmt.Errorf("unable to remove egress IP: %w", err)
+	}
+
+	err = g.removeFailoverDeployment(generators)
+	if err != nil {
+		return fmt.Errorf("unable to remove failover deployment: %w", err)
+	}
+
+	err = g.removeObsoleteShards(cr, gates, generators)
+	if err != nil {
+		return fmt.Errorf("unable to remove obsolete shards: %w", err)
 	}
 
 	return nil
@@ -295,6 +821,17 @@ func (g *Generator) Remove(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	retain, err := storageRetained(cr)
+	if err != nil {
+		return err
+	}
+	if retain {
+		klog.Infof("storage %s is retained, not removing it", driver.ID())
+		g.eventRecorder.Eventf("StorageRetained", "Storage %s was left in place as the storage deletion policy is %s", driver.ID(), StorageDeletionPolicyRetain)
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{}
+		return nil
+	}
+
 	var derr error
 	var retriable bool
 	err = wait.PollImmediate(1*time.Second, 5*time.Minute, func() (stop bool, err error) {
@@ -0,0 +1,210 @@
+package resource
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+func TestCheckStorageRecovery(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		overrides string
+		err       bool
+	}{
+		{
+			name: "default policy",
+			err:  true,
+		},
+		{
+			name:      "report only",
+			overrides: `{"storage":{"recoveryPolicy":"ReportOnly"}}`,
+			err:       true,
+		},
+		{
+			name:      "recreate",
+			overrides: `{"storage":{"recoveryPolicy":"Recreate"}}`,
+		},
+		{
+			name:      "unknown policy",
+			overrides: `{"storage":{"recoveryPolicy":"Ignore"}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+			cr.Spec.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "bucket",
+			}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tc.overrides)}
+
+			driver, err := storage.NewDriver(&cr.Spec.Storage, nil, &client.StorageListers{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !storageDeletedOutOfBand(cr, driver) {
+				t.Fatal("expected managed storage to be considered deleted out-of-band")
+			}
+
+			recorder := events.NewInMemoryRecorder("test")
+			g := &Generator{eventRecorder: recorder}
+			err = g.checkStorageRecovery(cr, driver)
+			if tc.err && err == nil {
+				t.Error("expected error, got nil")
+			} else if !tc.err && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestStorageDeletedOutOfBand(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		managementState string
+		bucket          string
+		expected        bool
+	}{
+		{
+			name:            "managed",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			bucket:          "bucket",
+			expected:        true,
+		},
+		{
+			name:            "unmanaged",
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+			bucket:          "bucket",
+		},
+		{
+			name:            "not provisioned yet",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tc.managementState
+			cr.Spec.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: tc.bucket,
+			}
+			driver, err := storage.NewDriver(&cr.Spec.Storage, nil, &client.StorageListers{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := storageDeletedOutOfBand(cr, driver); got != tc.expected {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestStorageRetained(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		overrides string
+		expected  bool
+		err       bool
+	}{
+		{
+			name: "default policy",
+		},
+		{
+			name:      "delete",
+			overrides: `{"storage":{"deletionPolicy":"Delete"}}`,
+		},
+		{
+			name:      "retain",
+			overrides: `{"storage":{"deletionPolicy":"Retain"}}`,
+			expected:  true,
+		},
+		{
+			name:      "unknown policy",
+			overrides: `{"storage":{"deletionPolicy":"Orphan"}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tc.overrides)}
+
+			got, err := storageRetained(cr)
+			if tc.err && err == nil {
+				t.Error("expected error, got nil")
+			} else if !tc.err && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if got != tc.expected {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+type endpointerDriver struct {
+	storage.Driver
+	endpoints []string
+}
+
+func (d *endpointerDriver) Endpoints() ([]string, error) {
+	return d.endpoints, nil
+}
+
+func TestCheckStorageTLSPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		overrides string
+		endpoints []string
+		err       bool
+	}{
+		{
+			name:      "no policy",
+			endpoints: []string{"http://minio.example.com"},
+		},
+		{
+			name:      "https endpoint",
+			overrides: `{"storage":{"tlsPolicies":{"S3":{"requireHTTPS":true}}}}`,
+			endpoints: []string{"https://minio.example.com"},
+		},
+		{
+			name:      "endpoint without scheme",
+			overrides: `{"storage":{"tlsPolicies":{"S3":{"requireHTTPS":true}}}}`,
+			endpoints: []string{"minio.example.com"},
+		},
+		{
+			name:      "http endpoint",
+			overrides: `{"storage":{"tlsPolicies":{"S3":{"requireHTTPS":true}}}}`,
+			endpoints: []string{"http://minio.example.com"},
+			err:       true,
+		},
+		{
+			name:      "allowed http endpoint",
+			overrides: `{"storage":{"tlsPolicies":{"S3":{"requireHTTPS":true,"allowedHTTPEndpoints":["http://minio.example.com"]}}}}`,
+			endpoints: []string{"http://minio.example.com"},
+		},
+		{
+			name:      "policy for another storage type",
+			overrides: `{"storage":{"tlsPolicies":{"Swift":{"requireHTTPS":true}}}}`,
+			endpoints: []string{"http://minio.example.com"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tc.overrides)}
+
+			err := checkStorageTLSPolicy(cr, &endpointerDriver{endpoints: tc.endpoints})
+			if tc.err && err == nil {
+				t.Error("expected error, got nil")
+			} else if !tc.err && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
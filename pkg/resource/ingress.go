@@ -0,0 +1,162 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	networkingapi "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	networkingset "k8s.io/client-go/kubernetes/typed/networking/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// IngressBackendProtocolAnnotation tells the ingress controller the registry
+// serves TLS, ingress controllers other than ingress-nginx ignore it and
+// have to be configured accordingly.
+const IngressBackendProtocolAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+
+var _ Mutator = &generatorIngress{}
+
+// generatorIngress generates the Ingress exposing the registry for a route
+// of the registry config, it replaces the Route when the operator runs in
+// standalone mode.
+type generatorIngress struct {
+	client      networkingset.NetworkingV1Interface
+	namespace   string
+	serviceName string
+	route       imageregistryv1.ImageRegistryConfigRoute
+}
+
+func newGeneratorIngress(client networkingset.NetworkingV1Interface, route imageregistryv1.ImageRegistryConfigRoute) *generatorIngress {
+	return &generatorIngress{
+		client:      client,
+		namespace:   defaults.ImageRegistryOperatorNamespace,
+		serviceName: defaults.ServiceName,
+		route:       route,
+	}
+}
+
+func (gi *generatorIngress) Type() runtime.Object {
+	return &networkingapi.Ingress{}
+}
+
+func (gi *generatorIngress) GetNamespace() string {
+	return gi.namespace
+}
+
+func (gi *generatorIngress) GetName() string {
+	return gi.route.Name
+}
+
+func (gi *generatorIngress) expected() (runtime.Object, error) {
+	pathType := networkingapi.PathTypePrefix
+	ing := &networkingapi.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gi.GetName(),
+			Namespace: gi.GetNamespace(),
+			Annotations: map[string]string{
+				RouteOwnerAnnotation:             "true",
+				IngressBackendProtocolAnnotation: "HTTPS",
+			},
+		},
+		Spec: networkingapi.IngressSpec{
+			Rules: []networkingapi.IngressRule{
+				{
+					Host: gi.route.Hostname,
+					IngressRuleValue: networkingapi.IngressRuleValue{
+						HTTP: &networkingapi.HTTPIngressRuleValue{
+							Paths: []networkingapi.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingapi.IngressBackend{
+										Service: &networkingapi.IngressServiceBackend{
+											Name: gi.serviceName,
+											Port: networkingapi.ServiceBackendPort{
+												Name: fmt.Sprintf("%d-tcp", defaults.ContainerPort),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if gi.route.SecretName != "" {
+		tls := networkingapi.IngressTLS{SecretName: gi.route.SecretName}
+		if gi.route.Hostname != "" {
+			tls.Hosts = []string{gi.route.Hostname}
+		}
+		ing.Spec.TLS = []networkingapi.IngressTLS{tls}
+	}
+	return ing, nil
+}
+
+func (gi *generatorIngress) Get() (runtime.Object, error) {
+	return gi.client.Ingresses(gi.GetNamespace()).Get(
+		context.TODO(), gi.GetName(), metav1.GetOptions{},
+	)
+}
+
+func (gi *generatorIngress) Create() (runtime.Object, error) {
+	return commonCreate(gi, func(obj runtime.Object) (runtime.Object, error) {
+		return gi.client.Ingresses(gi.GetNamespace()).Create(
+			context.TODO(), obj.(*networkingapi.Ingress), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gi *generatorIngress) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gi, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gi.client.Ingresses(gi.GetNamespace()).Update(
+			context.TODO(), obj.(*networkingapi.Ingress), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gi *generatorIngress) Delete(opts metav1.DeleteOptions) error {
+	return gi.client.Ingresses(gi.GetNamespace()).Delete(
+		context.TODO(), gi.GetName(), opts,
+	)
+}
+
+func (gi *generatorIngress) Owned() bool {
+	return true
+}
+
+// removeObsoleteIngresses deletes the Ingresses created by the operator for
+// routes that were removed from the registry config.
+func (g *Generator) removeObsoleteIngresses(cr *imageregistryv1.Config) error {
+	client := g.clients.Kube.NetworkingV1().Ingresses(defaults.ImageRegistryOperatorNamespace)
+	ingresses, err := client.List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list ingresses: %s", err)
+	}
+
+	knownNames := map[string]struct{}{}
+	for _, gen := range g.listRoutes(cr) {
+		knownNames[gen.GetName()] = struct{}{}
+	}
+
+	for _, ing := range ingresses.Items {
+		if _, ok := ing.Annotations[RouteOwnerAnnotation]; !ok {
+			continue
+		}
+		if _, found := knownNames[ing.Name]; found {
+			continue
+		}
+		err = client.Delete(context.TODO(), ing.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package resource
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+func TestIngressExpected(t *testing.T) {
+	gen := newGeneratorIngress(nil, imageregistryv1.ImageRegistryConfigRoute{
+		Name:       "public",
+		Hostname:   "registry.example.com",
+		SecretName: "public-tls",
+	})
+	obj, err := gen.expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ing := obj.(*networkingv1.Ingress)
+
+	if _, ok := ing.Annotations[RouteOwnerAnnotation]; !ok {
+		t.Errorf("expected the ingress to be marked as created by the operator")
+	}
+	if len(ing.Spec.Rules) != 1 || ing.Spec.Rules[0].Host != "registry.example.com" {
+		t.Fatalf("got rules %#v, want one rule for registry.example.com", ing.Spec.Rules)
+	}
+	backend := ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+	if backend.Name != "image-registry" || backend.Port.Name != "5000-tcp" {
+		t.Errorf("got backend %#v, want the registry service", backend)
+	}
+	if len(ing.Spec.TLS) != 1 || ing.Spec.TLS[0].SecretName != "public-tls" || ing.Spec.TLS[0].Hosts[0] != "registry.example.com" {
+		t.Errorf("got tls %#v, want the route secret", ing.Spec.TLS)
+	}
+}
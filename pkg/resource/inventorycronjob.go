@@ -0,0 +1,145 @@
+package resource
+
+import (
+	"context"
+	"os"
+
+	batchapi "k8s.io/api/batch/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var defaultInventorySchedule = "30 2 * * *"
+
+var _ Mutator = &generatorInventoryCronJob{}
+
+// generatorInventoryCronJob generates the CronJob that periodically lists
+// the blobs held by the registry storage and writes a report into the
+// storage inventory config map.
+type generatorInventoryCronJob struct {
+	client    batchset.BatchV1Interface
+	overrides *InventoryOverrides
+}
+
+func newGeneratorInventoryCronJob(client batchset.BatchV1Interface, overrides *InventoryOverrides) *generatorInventoryCronJob {
+	return &generatorInventoryCronJob{
+		client:    client,
+		overrides: overrides,
+	}
+}
+
+// inventoryEnabled returns true if the user has asked for the storage
+// inventory job to be created.
+func inventoryEnabled(cr *imageregistryv1.Config) (bool, *InventoryOverrides, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return false, nil, err
+	}
+	if overrides.Inventory == nil || !overrides.Inventory.Enabled {
+		return false, nil, nil
+	}
+	return true, overrides.Inventory, nil
+}
+
+func (gcj *generatorInventoryCronJob) Type() runtime.Object {
+	return &batchapi.CronJob{}
+}
+
+func (gcj *generatorInventoryCronJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gcj *generatorInventoryCronJob) GetName() string {
+	return defaults.StorageInventoryName
+}
+
+func (gcj *generatorInventoryCronJob) schedule() string {
+	if gcj.overrides != nil && gcj.overrides.Schedule != "" {
+		return gcj.overrides.Schedule
+	}
+	return defaultInventorySchedule
+}
+
+func (gcj *generatorInventoryCronJob) expected() (runtime.Object, error) {
+	backoffLimit := int32(0)
+	cj := &batchapi.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gcj.GetName(),
+			Namespace: gcj.GetNamespace(),
+		},
+		Spec: batchapi.CronJobSpec{
+			Schedule:                   gcj.schedule(),
+			ConcurrencyPolicy:          batchapi.ForbidConcurrent,
+			FailedJobsHistoryLimit:     &defaultFailedJobsHistoryLimit,
+			SuccessfulJobsHistoryLimit: &defaultSuccessfulJobsHistoryLimit,
+			StartingDeadlineSeconds:    &defaultStartingDeadlineSeconds,
+			JobTemplate: batchapi.JobTemplateSpec{
+				Spec: batchapi.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: kcorev1.PodTemplateSpec{
+						Spec: kcorev1.PodSpec{
+							RestartPolicy:      kcorev1.RestartPolicyNever,
+							ServiceAccountName: defaults.OperatorServiceAccountName,
+							PriorityClassName:  "openshift-user-critical",
+							NodeSelector: map[string]string{
+								"kubernetes.io/os": "linux",
+							},
+							Containers: []kcorev1.Container{
+								{
+									Name:                     gcj.GetName(),
+									Image:                    os.Getenv("OPERATOR_IMAGE"),
+									Resources:                defaultResources,
+									TerminationMessagePolicy: kcorev1.TerminationMessageFallbackToLogsOnError,
+									Command: []string{
+										"cluster-image-registry-operator",
+										"storage-inventory",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	cj.Spec.JobTemplate.Labels = map[string]string{"created-by": gcj.GetName()}
+	return cj, nil
+}
+
+func (gcj *generatorInventoryCronJob) Get() (runtime.Object, error) {
+	return gcj.client.CronJobs(gcj.GetNamespace()).Get(
+		context.TODO(), gcj.GetName(), metav1.GetOptions{},
+	)
+}
+
+func (gcj *generatorInventoryCronJob) Create() (runtime.Object, error) {
+	return commonCreate(gcj, func(obj runtime.Object) (runtime.Object, error) {
+		return gcj.client.CronJobs(gcj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchapi.CronJob), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gcj *generatorInventoryCronJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gcj, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gcj.client.CronJobs(gcj.GetNamespace()).Update(
+			context.TODO(), obj.(*batchapi.CronJob), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gcj *generatorInventoryCronJob) Delete(opts metav1.DeleteOptions) error {
+	return gcj.client.CronJobs(gcj.GetNamespace()).Delete(
+		context.TODO(), gcj.GetName(), opts,
+	)
+}
+
+func (gcj *generatorInventoryCronJob) Owned() bool {
+	return true
+}
@@ -0,0 +1,74 @@
+package resource
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+func TestInventoryEnabled(t *testing.T) {
+	testCases := []struct {
+		name     string
+		raw      string
+		enabled  bool
+		schedule string
+		err      bool
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name: "deployment overrides only",
+			raw:  `{"deployment":{"annotations":{"a":"b"}}}`,
+		},
+		{
+			name:     "enabled with default schedule",
+			raw:      `{"inventory":{"enabled":true}}`,
+			enabled:  true,
+			schedule: defaultInventorySchedule,
+		},
+		{
+			name:     "enabled with custom schedule",
+			raw:      `{"inventory":{"enabled":true,"schedule":"0 4 * * 0"}}`,
+			enabled:  true,
+			schedule: "0 4 * * 0",
+		},
+		{
+			name: "disabled",
+			raw:  `{"inventory":{"enabled":false,"schedule":"0 4 * * 0"}}`,
+		},
+		{
+			name: "invalid",
+			raw:  `{"inventory":`,
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tc.raw)}
+
+			enabled, overrides, err := inventoryEnabled(cr)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if enabled != tc.enabled {
+				t.Fatalf("got enabled %v, want %v", enabled, tc.enabled)
+			}
+			if !enabled {
+				return
+			}
+			if got := newGeneratorInventoryCronJob(nil, overrides).schedule(); got != tc.schedule {
+				t.Errorf("got schedule %q, want %q", got, tc.schedule)
+			}
+		})
+	}
+}
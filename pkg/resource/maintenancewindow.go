@@ -0,0 +1,123 @@
+package resource
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+// pendingChangesCondition reports the disruptive changes that were deferred
+// until the maintenance window opens.
+const pendingChangesCondition = "PendingChanges"
+
+// storageReconfigurationChange is the change moving the registry to the
+// storage set in its spec.
+const storageReconfigurationChange = "storage reconfiguration"
+
+// maintenance gates the disruptive changes the operator makes, e.g. rolling
+// out the registry or replacing storage keys, behind the maintenance window
+// set by the user. Changes are always allowed when no window is set.
+type maintenance struct {
+	schedule cron.Schedule
+	duration time.Duration
+	now      time.Time
+
+	pending []string
+}
+
+// newMaintenance returns the maintenance window set in the unsupported
+// config overrides of cr, evaluated at now.
+func newMaintenance(cr *imageregistryv1.Config, now time.Time) (*maintenance, error) {
+	m := &maintenance{now: now}
+
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	window := overrides.MaintenanceWindow
+	if window == nil {
+		return m, nil
+	}
+
+	m.schedule, err = cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance window schedule %q: %w", window.Schedule, err)
+	}
+	m.duration = window.Duration.Duration
+	if m.duration <= 0 {
+		return nil, fmt.Errorf("invalid maintenance window duration %s: must be positive", window.Duration.Duration)
+	}
+	return m, nil
+}
+
+// open returns true if disruptive changes can be made now.
+func (m *maintenance) open() bool {
+	if m == nil || m.schedule == nil {
+		return true
+	}
+	return !m.schedule.Next(m.now.Add(-m.duration)).After(m.now)
+}
+
+// allowed returns true if the change can be made now, otherwise the change
+// is recorded as pending.
+func (m *maintenance) allowed(change string) bool {
+	if m.open() {
+		return true
+	}
+	m.pending = append(m.pending, change)
+	return false
+}
+
+// deferred returns true if change was deferred until the maintenance window
+// opens.
+func (m *maintenance) deferred(change string) bool {
+	if m == nil {
+		return false
+	}
+	for _, c := range m.pending {
+		if c == change {
+			return true
+		}
+	}
+	return false
+}
+
+// resyncAfter returns how long until the maintenance window opens, zero if
+// no change is waiting for it.
+func (m *maintenance) resyncAfter() time.Duration {
+	if len(m.pending) == 0 || m.schedule == nil {
+		return 0
+	}
+	return m.schedule.Next(m.now).Sub(m.now)
+}
+
+// syncCondition reports the pending changes in the status of cr.
+func (m *maintenance) syncCondition(cr *imageregistryv1.Config) {
+	if m.schedule == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, pendingChangesCondition)
+		return
+	}
+
+	cond := operatorv1.OperatorCondition{
+		Type:    pendingChangesCondition,
+		Status:  operatorv1.ConditionFalse,
+		Reason:  "AsExpected",
+		Message: "No changes are waiting for the maintenance window",
+	}
+	if len(m.pending) > 0 {
+		cond.Status = operatorv1.ConditionTrue
+		cond.Reason = "WaitingForMaintenanceWindow"
+		cond.Message = fmt.Sprintf(
+			"The following changes will be made when the maintenance window opens at %s: %s",
+			m.schedule.Next(m.now).UTC().Format(time.RFC3339),
+			strings.Join(m.pending, ", "),
+		)
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+}
@@ -0,0 +1,125 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func TestMaintenanceWindowOpen(t *testing.T) {
+	// the window opens every Saturday at 02:00 for two hours.
+	overrides := `{"maintenanceWindow":{"schedule":"0 2 * * 6","duration":"2h"}}`
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		now       string
+		open      bool
+		err       bool
+	}{
+		{
+			name: "no window",
+			now:  "2023-03-01T12:00:00Z",
+			open: true,
+		},
+		{
+			name:      "inside the window",
+			overrides: overrides,
+			now:       "2023-03-04T03:30:00Z",
+			open:      true,
+		},
+		{
+			name:      "when the window opens",
+			overrides: overrides,
+			now:       "2023-03-04T02:00:00Z",
+			open:      true,
+		},
+		{
+			name:      "after the window",
+			overrides: overrides,
+			now:       "2023-03-04T04:00:00Z",
+		},
+		{
+			name:      "another day",
+			overrides: overrides,
+			now:       "2023-03-01T03:00:00Z",
+		},
+		{
+			name:      "invalid schedule",
+			overrides: `{"maintenanceWindow":{"schedule":"every saturday","duration":"2h"}}`,
+			err:       true,
+		},
+		{
+			name:      "missing duration",
+			overrides: `{"maintenanceWindow":{"schedule":"0 2 * * 6"}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			now, _ := time.Parse(time.RFC3339, tt.now)
+			m, err := newMaintenance(cr, now)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := m.open(); got != tt.open {
+				t.Errorf("got open %v, want %v", got, tt.open)
+			}
+		})
+	}
+}
+
+func TestMaintenanceSyncCondition(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"maintenanceWindow":{"schedule":"0 2 * * 6","duration":"2h"}}`)
+
+	now, _ := time.Parse(time.RFC3339, "2023-03-01T03:00:00Z")
+	m, err := newMaintenance(cr, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.allowed("registry rollout") {
+		t.Fatal("expected the rollout to be deferred")
+	}
+	if !m.deferred("registry rollout") || m.deferred(storageReconfigurationChange) {
+		t.Errorf("got pending changes %v, want only the rollout", m.pending)
+	}
+	m.syncCondition(cr)
+
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, pendingChangesCondition)
+	if cond == nil || cond.Status != operatorv1.ConditionTrue {
+		t.Fatalf("got condition %#v, want status True", cond)
+	}
+	if !strings.Contains(cond.Message, "2023-03-04T02:00:00Z") || !strings.Contains(cond.Message, "registry rollout") {
+		t.Errorf("unexpected message %q", cond.Message)
+	}
+	// the deferred rollout is synced again when the window opens.
+	if got, want := m.resyncAfter(), 71*time.Hour; got != want {
+		t.Errorf("got resync after %s, want %s", got, want)
+	}
+
+	// removing the window removes the condition.
+	cr.Spec.UnsupportedConfigOverrides.Raw = nil
+	m, err = newMaintenance(cr, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.syncCondition(cr)
+	if cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, pendingChangesCondition); cond != nil {
+		t.Errorf("unexpected condition %#v", cond)
+	}
+	if got := m.resyncAfter(); got != 0 {
+		t.Errorf("got resync after %s, want none", got)
+	}
+}
@@ -0,0 +1,237 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kmeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	kscheme "k8s.io/client-go/kubernetes/scheme"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// managedObjectsScheme knows about every type the generator applies, it is
+// used to find the kind and resource of objects returned by listers and
+// clients, which don't have their TypeMeta set.
+var managedObjectsScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(kscheme.AddToScheme(managedObjectsScheme))
+	utilruntime.Must(routev1.Install(managedObjectsScheme))
+}
+
+// ManagedObject is an entry of the inventory of the objects owned by the
+// operator.
+type ManagedObject struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Hash is the checksum the operator stores on the objects it
+	// applies, it is empty for objects that are applied by the
+	// resourceapply helpers.
+	Hash string `json:"hash,omitempty"`
+	// LastApplied is when the operator last created or updated the
+	// object, or when it was first recorded in the inventory.
+	LastApplied metav1.Time `json:"lastApplied"`
+}
+
+// managedObject returns the inventory entry for the object o.
+func managedObject(o runtime.Object) (ManagedObject, error) {
+	gvks, _, err := managedObjectsScheme.ObjectKinds(o)
+	if err != nil {
+		return ManagedObject{}, err
+	}
+	gvr, _ := kmeta.UnsafeGuessKindToResource(gvks[0])
+	accessor, err := kmeta.Accessor(o)
+	if err != nil {
+		return ManagedObject{}, err
+	}
+	return ManagedObject{
+		Group:     gvks[0].Group,
+		Version:   gvks[0].Version,
+		Kind:      gvks[0].Kind,
+		Resource:  gvr.Resource,
+		Namespace: accessor.GetNamespace(),
+		Name:      accessor.GetName(),
+		Hash:      accessor.GetAnnotations()[defaults.ChecksumOperatorAnnotation],
+	}, nil
+}
+
+func sameManagedObject(a, b ManagedObject) bool {
+	return a.Group == b.Group &&
+		a.Resource == b.Resource &&
+		a.Namespace == b.Namespace &&
+		a.Name == b.Name
+}
+
+// recordManagedObject sets the last apply time of obj. It is now if the
+// object was just applied or is not in the previous inventory, otherwise the
+// time recorded by the previous inventory is kept.
+func recordManagedObject(previous []ManagedObject, obj ManagedObject, applied bool, now metav1.Time) ManagedObject {
+	obj.LastApplied = now
+	if applied {
+		return obj
+	}
+	for _, p := range previous {
+		if sameManagedObject(p, obj) {
+			obj.LastApplied = p.LastApplied
+			break
+		}
+	}
+	return obj
+}
+
+// sortManagedObjects orders the inventory by group, resource, namespace and
+// name.
+func sortManagedObjects(objects []ManagedObject) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+}
+
+// GetManagedObjects returns the inventory of the objects owned by the
+// operator, or nil if it has not been published yet.
+func GetManagedObjects(lister corelisters.ConfigMapNamespaceLister) ([]ManagedObject, error) {
+	cm, err := lister.Get(defaults.ManagedObjectsConfigMapName)
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var objects []ManagedObject
+	if err := json.Unmarshal([]byte(cm.Data[defaults.ManagedObjectsKey]), &objects); err != nil {
+		return nil, fmt.Errorf("unable to parse the config map %s/%s: %w", cm.Namespace, cm.Name, err)
+	}
+	return objects, nil
+}
+
+var _ Mutator = &generatorManagedObjects{}
+
+// generatorManagedObjects publishes the inventory of the objects owned by the
+// operator in a config map, so tools that snapshot the registry
+// configuration know exactly what the operator manages.
+type generatorManagedObjects struct {
+	lister  corelisters.ConfigMapNamespaceLister
+	client  coreset.CoreV1Interface
+	objects []ManagedObject
+}
+
+func newGeneratorManagedObjects(lister corelisters.ConfigMapNamespaceLister, client coreset.CoreV1Interface, objects []ManagedObject) *generatorManagedObjects {
+	return &generatorManagedObjects{
+		lister:  lister,
+		client:  client,
+		objects: objects,
+	}
+}
+
+func (g *generatorManagedObjects) Type() runtime.Object {
+	return &corev1.ConfigMap{}
+}
+
+func (g *generatorManagedObjects) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (g *generatorManagedObjects) GetName() string {
+	return defaults.ManagedObjectsConfigMapName
+}
+
+func (g *generatorManagedObjects) expected() (runtime.Object, error) {
+	objects := g.objects
+	if objects == nil {
+		objects = []ManagedObject{}
+	}
+	buf, err := json.MarshalIndent(objects, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      g.GetName(),
+			Namespace: g.GetNamespace(),
+		},
+		Data: map[string]string{
+			defaults.ManagedObjectsKey: string(buf),
+		},
+	}, nil
+}
+
+func (g *generatorManagedObjects) Get() (runtime.Object, error) {
+	return g.lister.Get(g.GetName())
+}
+
+func (g *generatorManagedObjects) Create() (runtime.Object, error) {
+	return commonCreate(g, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (g *generatorManagedObjects) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(g, o, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (g *generatorManagedObjects) Delete(opts metav1.DeleteOptions) error {
+	return g.client.ConfigMaps(g.GetNamespace()).Delete(
+		context.TODO(), g.GetName(), opts,
+	)
+}
+
+func (g *generatorManagedObjects) Owned() bool {
+	return true
+}
+
+// mergeRelatedObjects returns the static related objects followed by the
+// managed objects that are not already part of them.
+func mergeRelatedObjects(related []configv1.ObjectReference, objects []ManagedObject) []configv1.ObjectReference {
+	result := append([]configv1.ObjectReference{}, related...)
+	for _, obj := range objects {
+		ref := configv1.ObjectReference{
+			Group:     obj.Group,
+			Resource:  obj.Resource,
+			Namespace: obj.Namespace,
+			Name:      obj.Name,
+		}
+		found := false
+		for _, r := range result {
+			if r == ref {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, ref)
+		}
+	}
+	return result
+}
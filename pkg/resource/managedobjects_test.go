@@ -0,0 +1,127 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configv1 "github.com/openshift/api/config/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestManagedObject(t *testing.T) {
+	for _, tt := range []struct {
+		obj  runtime.Object
+		want ManagedObject
+	}{
+		{
+			obj:  &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-image-registry", Name: "image-registry"}},
+			want: ManagedObject{Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments", Namespace: "openshift-image-registry", Name: "image-registry"},
+		},
+		{
+			obj: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "openshift-image-registry",
+				Name:        "image-registry-private-configuration",
+				Annotations: map[string]string{defaults.ChecksumOperatorAnnotation: "abc"},
+			}},
+			want: ManagedObject{Version: "v1", Kind: "Secret", Resource: "secrets", Namespace: "openshift-image-registry", Name: "image-registry-private-configuration", Hash: "abc"},
+		},
+		{
+			obj:  &routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-image-registry", Name: "default-route"}},
+			want: ManagedObject{Group: "route.openshift.io", Version: "v1", Kind: "Route", Resource: "routes", Namespace: "openshift-image-registry", Name: "default-route"},
+		},
+	} {
+		got, err := managedObject(tt.obj)
+		if err != nil {
+			t.Fatalf("%T: unexpected error: %s", tt.obj, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%T: got %#v, want %#v", tt.obj, got, tt.want)
+		}
+	}
+}
+
+func TestRecordManagedObject(t *testing.T) {
+	before := metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	previous := []ManagedObject{
+		{Group: "apps", Resource: "deployments", Namespace: "openshift-image-registry", Name: "image-registry", LastApplied: before},
+	}
+	deployment := ManagedObject{Group: "apps", Resource: "deployments", Namespace: "openshift-image-registry", Name: "image-registry"}
+	service := ManagedObject{Resource: "services", Namespace: "openshift-image-registry", Name: "image-registry"}
+
+	for _, tt := range []struct {
+		name    string
+		obj     ManagedObject
+		applied bool
+		want    metav1.Time
+	}{
+		{name: "unchanged", obj: deployment, want: before},
+		{name: "applied", obj: deployment, applied: true, want: now},
+		{name: "not recorded", obj: service, want: now},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recordManagedObject(previous, tt.obj, tt.applied, now)
+			if !got.LastApplied.Equal(&tt.want) {
+				t.Errorf("got last applied %s, want %s", got.LastApplied, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetManagedObjects(t *testing.T) {
+	objects := []ManagedObject{
+		// the time is read back in the local time zone.
+		{Resource: "services", Namespace: "openshift-image-registry", Name: "image-registry", Hash: "svc", LastApplied: metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local))},
+	}
+	cm, err := newGeneratorManagedObjects(nil, nil, objects).expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	lister := corelisters.NewConfigMapLister(indexer).ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+	got, err := GetManagedObjects(lister)
+	if err != nil || got != nil {
+		t.Errorf("got %#v and error %v, want no inventory", got, err)
+	}
+
+	if err := indexer.Add(cm); err != nil {
+		t.Fatal(err)
+	}
+	got, err = GetManagedObjects(lister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, objects) {
+		t.Errorf("got %#v, want %#v", got, objects)
+	}
+}
+
+func TestMergeRelatedObjects(t *testing.T) {
+	related := []configv1.ObjectReference{
+		{Group: "imageregistry.operator.openshift.io", Resource: "configs", Name: "cluster"},
+		{Resource: "namespaces", Name: "openshift-image-registry"},
+	}
+	objects := []ManagedObject{
+		{Group: "", Resource: "namespaces", Name: "openshift-image-registry"},
+		{Group: "apps", Resource: "deployments", Namespace: "openshift-image-registry", Name: "image-registry"},
+	}
+
+	got := mergeRelatedObjects(related, objects)
+	want := append(related, configv1.ObjectReference{
+		Group: "apps", Resource: "deployments", Namespace: "openshift-image-registry", Name: "image-registry",
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
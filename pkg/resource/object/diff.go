@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 
 	"k8s.io/klog/v2"
 )
@@ -96,30 +97,73 @@ func convertToMap(o interface{}) (res map[string]string, err error) {
 	return
 }
 
-func DiffString(old_o, new_o interface{}) (string, error) {
+// ignoredKey returns true for the keys that change on every update or are
+// not set by the operator, they only add noise to the differences.
+func ignoredKey(key string) bool {
+	return key == "metadata.resourceVersion" ||
+		key == "metadata.generation" ||
+		strings.HasPrefix(key, "metadata.managedFields.") ||
+		strings.HasPrefix(key, "status.")
+}
+
+// Change is a difference between two versions of an object. Its values are
+// quoted, sensitive values are redacted.
+type Change struct {
+	// Op is added, removed or changed.
+	Op    string
+	Key   string
+	Value string
+	// OldValue is only set for changed keys.
+	OldValue string
+}
+
+func (c Change) String() string {
+	if c.Op == "changed" {
+		return fmt.Sprintf("changed:%s={%s -> %s}", c.Key, c.OldValue, c.Value)
+	}
+	return fmt.Sprintf("%s:%s=%s", c.Op, c.Key, c.Value)
+}
+
+// Diff returns the changes between two versions of an object, sorted by
+// key.
+func Diff(old_o, new_o interface{}) ([]Change, error) {
 	res0, err := convertToMap(old_o)
 	if err != nil {
-		return "", fmt.Errorf("unable to convert to map the old object: %s", err)
+		return nil, fmt.Errorf("unable to convert to map the old object: %s", err)
 	}
 
 	res1, err := convertToMap(new_o)
 	if err != nil {
-		return "", fmt.Errorf("unable to convert to map the new object: %s", err)
+		return nil, fmt.Errorf("unable to convert to map the new object: %s", err)
 	}
 
-	sep := ""
-	s := ""
+	var changes []Change
 	printDiff(res0, res1, func(key, typ, oldv, newv string) {
+		if ignoredKey(key) {
+			return
+		}
 		switch typ {
 		case "n":
-			s += fmt.Sprintf("%sadded:%s=%s", sep, key, printValue(new_o, key, newv))
+			changes = append(changes, Change{Op: "added", Key: key, Value: printValue(new_o, res1, key, newv)})
 		case "o":
-			s += fmt.Sprintf("%sremoved:%s=%s", sep, key, printValue(old_o, key, oldv))
+			changes = append(changes, Change{Op: "removed", Key: key, Value: printValue(old_o, res0, key, oldv)})
 		case "c":
-			s += fmt.Sprintf("%schanged:%s={%s -> %s}", sep, key, printValue(old_o, key, oldv), printValue(new_o, key, newv))
+			changes = append(changes, Change{Op: "changed", Key: key, Value: printValue(new_o, res1, key, newv), OldValue: printValue(old_o, res0, key, oldv)})
 		}
-		sep = ", "
 	})
+	return changes, nil
+}
 
-	return s, nil
+// DiffString returns the changes between two versions of an object as a
+// single line.
+func DiffString(old_o, new_o interface{}) (string, error) {
+	changes, err := Diff(old_o, new_o)
+	if err != nil {
+		return "", err
+	}
+	s := make([]string, len(changes))
+	for i, c := range changes {
+		s[i] = c.String()
+	}
+	return strings.Join(s, ", "), nil
 }
@@ -83,6 +83,45 @@ func TestDiffObject(t *testing.T) {
 			},
 			diff: "added:data.bar=<REDACTED>, removed:data.foo=<REDACTED>, changed:data.xxx={<REDACTED> -> <REDACTED>}, changed:data.yyy={<REDACTED> -> \"\"}, changed:metadata.annotations.openshift.io/version={\"1.1\" -> \"1.2\"}",
 		},
+		{
+			oldObject: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "registry",
+					ResourceVersion: "1",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "registry",
+							Env: []corev1.EnvVar{
+								{Name: "REGISTRY_HTTP_SECRET", Value: "aaa"},
+								{Name: "REGISTRY_LOG_LEVEL", Value: "info"},
+							},
+						},
+					},
+				},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning},
+			},
+			newObject: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "registry",
+					ResourceVersion: "2",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "registry",
+							Env: []corev1.EnvVar{
+								{Name: "REGISTRY_HTTP_SECRET", Value: "bbb"},
+								{Name: "REGISTRY_LOG_LEVEL", Value: "debug"},
+							},
+						},
+					},
+				},
+				Status: corev1.PodStatus{Phase: corev1.PodPending},
+			},
+			diff: "changed:spec.containers.0.env.0.value={<REDACTED> -> <REDACTED>}, changed:spec.containers.0.env.1.value={\"info\" -> \"debug\"}",
+		},
 	}
 	for _, tc := range testcases {
 		diff, err := DiffString(tc.oldObject, tc.newObject)
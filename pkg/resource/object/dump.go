@@ -2,18 +2,40 @@ package object
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 )
 
-func printValue(obj interface{}, key string, value string) string {
+// envValueKey matches the keys of the literal values of environment
+// variables, e.g. spec.template.spec.containers.0.env.3.value.
+var envValueKey = regexp.MustCompile(`^((?:.*\.)?env\.[0-9]+)\.value$`)
+
+// SensitiveEnvVar returns true if the literal value of the environment
+// variable name should not be logged or documented.
+func SensitiveEnvVar(name string) bool {
+	for _, s := range []string{"SECRET", "PASSWORD", "TOKEN", "CREDENTIAL"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return strings.HasSuffix(name, "KEY")
+}
+
+// printValue quotes the value of key, unless it is the data of a secret or
+// the value of an environment variable that looks sensitive. pairs are the
+// keys and values of obj.
+func printValue(obj interface{}, pairs map[string]string, key string, value string) string {
 	if _, ok := obj.(*corev1.Secret); ok {
 		if value != "" && (strings.HasPrefix(key, "data.") || strings.HasPrefix(key, "stringData.")) {
 			return "<REDACTED>"
 		}
 	}
+	if m := envValueKey.FindStringSubmatch(key); m != nil && value != "" && SensitiveEnvVar(pairs[m[1]+".name"]) {
+		return "<REDACTED>"
+	}
 	return fmt.Sprintf("%q", value)
 }
 
@@ -35,7 +57,7 @@ func DumpString(o interface{}) (string, error) {
 	s := ""
 
 	for _, k := range keys {
-		s += fmt.Sprintf("%s%s=%s", sep, k, printValue(o, k, res[k]))
+		s += fmt.Sprintf("%s%s=%s", sep, k, printValue(o, res, k, res[k]))
 		sep = ", "
 	}
 
@@ -50,6 +50,16 @@ func TestDumpString(t *testing.T) {
 			},
 			result: "data.bar=<REDACTED>, data.foo=<REDACTED>, data.xxx=\"\", metadata.creationTimestamp=\"nil\", stringData.write=<REDACTED>, type=\"Opaque\"",
 		},
+		{
+			object: &corev1.Container{
+				Name: "registry",
+				Env: []corev1.EnvVar{
+					{Name: "REGISTRY_STORAGE_SWIFT_PASSWORD", Value: "aaa"},
+					{Name: "REGISTRY_STORAGE_S3_BUCKET", Value: "bucket"},
+				},
+			},
+			result: "env.0.name=\"REGISTRY_STORAGE_SWIFT_PASSWORD\", env.0.value=<REDACTED>, env.1.name=\"REGISTRY_STORAGE_S3_BUCKET\", env.1.value=\"bucket\", name=\"registry\"",
+		},
 	}
 	for _, tc := range testcases {
 		s, err := DumpString(tc.object)
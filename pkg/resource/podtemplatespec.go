@@ -21,6 +21,7 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure"
 )
 
 // generateLogLevel returns the appropriate operand log level according to user
@@ -42,8 +43,8 @@ func generateLogLevel(cr *v1.Config) string {
 
 // generateLivenessProbeConfig returns an HTTPS liveness probe for the image
 // registry.
-func generateLivenessProbeConfig() *corev1.Probe {
-	probeConfig := generateProbeConfig()
+func generateLivenessProbeConfig(port int) *corev1.Probe {
+	probeConfig := generateProbeConfig(port)
 	// Wait until the registry is ready to serve requests.
 	probeConfig.InitialDelaySeconds = 5
 	return probeConfig
@@ -51,22 +52,127 @@ func generateLivenessProbeConfig() *corev1.Probe {
 
 // generateReadinessProbeConfig returns an HTTPS readiness probe for the image
 // registry.
-func generateReadinessProbeConfig() *corev1.Probe {
-	probeConfig := generateProbeConfig()
+func generateReadinessProbeConfig(port int) *corev1.Probe {
+	probeConfig := generateProbeConfig(port)
 	// Wait until the registry checks its storage health before reporting
 	// the registry as Ready.
 	probeConfig.InitialDelaySeconds = 15
 	return probeConfig
 }
 
-func generateProbeConfig() *corev1.Probe {
+// Bounds for the probe timings that can be overridden, they keep a
+// misconfigured registry from never being restarted or from being restarted
+// continuously.
+const (
+	maxProbeInitialDelaySeconds = 600
+	maxProbePeriodSeconds       = 300
+	maxProbeFailureThreshold    = 30
+)
+
+// applyProbeOverrides sets the timings provided by the user on probe.
+func applyProbeOverrides(probe *corev1.Probe, overrides *ProbeOverrides) error {
+	if overrides == nil {
+		return nil
+	}
+	if v := overrides.InitialDelaySeconds; v != nil {
+		if *v < 0 || *v > maxProbeInitialDelaySeconds {
+			return fmt.Errorf("initialDelaySeconds must be between 0 and %d, got %d", maxProbeInitialDelaySeconds, *v)
+		}
+		probe.InitialDelaySeconds = *v
+	}
+	if v := overrides.PeriodSeconds; v != nil {
+		if *v < 1 || *v > maxProbePeriodSeconds {
+			return fmt.Errorf("periodSeconds must be between 1 and %d, got %d", maxProbePeriodSeconds, *v)
+		}
+		probe.PeriodSeconds = *v
+	}
+	if v := overrides.FailureThreshold; v != nil {
+		if *v < 1 || *v > maxProbeFailureThreshold {
+			return fmt.Errorf("failureThreshold must be between 1 and %d, got %d", maxProbeFailureThreshold, *v)
+		}
+		probe.FailureThreshold = *v
+	}
+	return nil
+}
+
+// Defaults and bounds of the registry pods shutdown. The grace period has to
+// leave room for the preStop hook, or the registry is killed before it gets
+// the chance to stop cleanly.
+const (
+	defaultTerminationGracePeriodSeconds = 55
+	defaultPreStopSleepSeconds           = 25
+	maxTerminationGracePeriodSeconds     = 3600
+)
+
+// preStopDrainScript waits for the connections established to the registry
+// port to be closed, for up to the drain timeout. The state of the
+// connections is read from the kernel, as the registry has no drain
+// endpoint: the local port is the second field of the local address, state
+// 01 is ESTABLISHED.
+const preStopDrainScript = `sleep %d
+deadline=$(( $(date +%%s) + %d ))
+while [ "$(date +%%s)" -lt "$deadline" ] && grep -q ':%04X [0-9A-F]*:[0-9A-F]* 01 ' /proc/net/tcp /proc/net/tcp6 2>/dev/null; do
+	sleep 1
+done
+`
+
+// makeShutdown returns the preStop hook and the termination grace period of
+// the registry pods. Once a pod is deleted, its endpoint should be removed
+// from routers, load balancers, and nodes, so the hook gives it time to
+// propagate before the registry is shut down. Optionally, the hook also
+// waits for in-flight requests to complete.
+func makeShutdown(port int, overrides *DeploymentOverrides) (*corev1.Lifecycle, int64, error) {
+	gracePeriod := int64(defaultTerminationGracePeriodSeconds)
+	sleep := int32(defaultPreStopSleepSeconds)
+	var drain int32
+	if overrides != nil {
+		if v := overrides.TerminationGracePeriodSeconds; v != nil {
+			if *v < 1 || *v > maxTerminationGracePeriodSeconds {
+				return nil, 0, fmt.Errorf("terminationGracePeriodSeconds must be between 1 and %d, got %d", maxTerminationGracePeriodSeconds, *v)
+			}
+			gracePeriod = *v
+		}
+		if preStop := overrides.PreStop; preStop != nil {
+			if v := preStop.SleepSeconds; v != nil {
+				if *v < 0 {
+					return nil, 0, fmt.Errorf("preStop sleepSeconds must not be negative, got %d", *v)
+				}
+				sleep = *v
+			}
+			if v := preStop.DrainTimeoutSeconds; v != nil {
+				if *v < 0 {
+					return nil, 0, fmt.Errorf("preStop drainTimeoutSeconds must not be negative, got %d", *v)
+				}
+				drain = *v
+			}
+		}
+	}
+	if int64(sleep)+int64(drain) >= gracePeriod {
+		return nil, 0, fmt.Errorf("the preStop hook takes up to %d seconds, the termination grace period of %d seconds has to be longer", int64(sleep)+int64(drain), gracePeriod)
+	}
+
+	command := []string{"sleep", strconv.Itoa(int(sleep))}
+	if drain > 0 {
+		command = []string{"/bin/sh", "-c", fmt.Sprintf(preStopDrainScript, sleep, drain, port)}
+	}
+	lifecycle := &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{
+				Command: command,
+			},
+		},
+	}
+	return lifecycle, gracePeriod, nil
+}
+
+func generateProbeConfig(port int) *corev1.Probe {
 	return &corev1.Probe{
 		TimeoutSeconds: int32(defaults.HealthzTimeoutSeconds),
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
 				Scheme: corev1.URISchemeHTTPS,
 				Path:   defaults.HealthzRoute,
-				Port:   intstr.FromInt(defaults.ContainerPort),
+				Port:   intstr.FromInt(port),
 			},
 		},
 	}
@@ -159,23 +265,67 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		return corev1.PodTemplateSpec{}, deps, fmt.Errorf("unable to get cluster proxy configuration: %v", err)
 	}
 
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	quotaEnabled := true
+	if overrides.Quota != nil && overrides.Quota.Enabled != nil {
+		quotaEnabled = *overrides.Quota.Enabled
+	}
+	port, err := getRegistryPort(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+
 	env = append(env,
-		corev1.EnvVar{Name: "REGISTRY_HTTP_ADDR", Value: fmt.Sprintf(":%d", defaults.ContainerPort)},
+		corev1.EnvVar{Name: "REGISTRY_HTTP_ADDR", Value: fmt.Sprintf(":%d", port)},
 		corev1.EnvVar{Name: "REGISTRY_HTTP_NET", Value: "tcp"},
 		corev1.EnvVar{Name: "REGISTRY_HTTP_SECRET", Value: cr.Spec.HTTPSecret},
 		corev1.EnvVar{Name: "REGISTRY_LOG_LEVEL", Value: generateLogLevel(cr)},
-		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_QUOTA_ENABLED", Value: "true"},
+		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_QUOTA_ENABLED", Value: strconv.FormatBool(quotaEnabled)},
 		corev1.EnvVar{Name: "REGISTRY_STORAGE_CACHE_BLOBDESCRIPTOR", Value: "inmemory"},
-		corev1.EnvVar{Name: "REGISTRY_STORAGE_DELETE_ENABLED", Value: "true"},
 		corev1.EnvVar{Name: "REGISTRY_HEALTH_STORAGEDRIVER_ENABLED", Value: "true"},
 		corev1.EnvVar{Name: "REGISTRY_HEALTH_STORAGEDRIVER_INTERVAL", Value: "10s"},
 		corev1.EnvVar{Name: "REGISTRY_HEALTH_STORAGEDRIVER_THRESHOLD", Value: "1"},
 		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_METRICS_ENABLED", Value: "true"},
 		// TODO(dmage): sync with InternalRegistryHostname in origin
-		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_SERVER_ADDR", Value: fmt.Sprintf("%s.%s.svc:%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, defaults.ContainerPort)},
+		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_SERVER_ADDR", Value: fmt.Sprintf("%s.%s.svc:%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, port)},
 	)
 
-	if cr.Spec.ReadOnly {
+	if overrides.Quota != nil && overrides.Quota.CacheTTL != nil {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_QUOTA_CACHETTL", Value: overrides.Quota.CacheTTL.Duration.String()})
+	}
+	if overrides.Quota != nil && overrides.Quota.BlobRepositoryCacheTTL != nil {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_CACHE_BLOBREPOSITORYTTL", Value: overrides.Quota.BlobRepositoryCacheTTL.Duration.String()})
+	}
+
+	if overrides.Audit != nil && overrides.Audit.Enabled {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_AUDIT_ENABLED", Value: "true"})
+	}
+
+	deletionEnv, err := storageDeletionEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, deletionEnv...)
+
+	readOnly := cr.Spec.ReadOnly
+	if syncing, err := storageUpgradeSyncing(cr); err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	} else if syncing {
+		readOnly = true
+	}
+	if overrides.Storage != nil && overrides.Storage.Azure != nil && overrides.Storage.Azure.UseSecondaryEndpoint && cr.Spec.Storage.Azure != nil {
+		serviceURL, err := azure.SecondaryBlobServiceURL(cr.Spec.Storage.Azure)
+		if err != nil {
+			return corev1.PodTemplateSpec{}, deps, fmt.Errorf("unable to get the secondary blob endpoint: %w", err)
+		}
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_STORAGE_AZURE_SERVICEURL", Value: serviceURL})
+		readOnly = true
+	}
+
+	if readOnly {
 		env = append(env, corev1.EnvVar{Name: "REGISTRY_STORAGE_MAINTENANCE_READONLY", Value: "{enabled: true}"})
 	}
 
@@ -428,9 +578,10 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		topologySpreadConstraints = append(topologySpreadConstraints, zoneConstraint)
 	}
 
-	// topology spread constraints might conflict with node selectors, so we
-	// do not set defaults when they're specified.
-	if cr.Spec.NodeSelector != nil {
+	// topology spread constraints might conflict with node selectors and
+	// node affinities (e.g. when pods are pinned to a zone), so we do not
+	// set defaults when they're specified.
+	if cr.Spec.NodeSelector != nil || (cr.Spec.Affinity != nil && cr.Spec.Affinity.NodeAffinity != nil) {
 		topologySpreadConstraints = nil
 	}
 
@@ -438,27 +589,7 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		topologySpreadConstraints = cr.Spec.TopologySpreadConstraints
 	}
 
-	// if user has provided an affinity through config spec we use it here, if not
-	// then we fallback to a preferred affinity configuration. we only require a
-	// certain affinity during schedule if the number of replicas is defined to two.
-	affinity := cr.Spec.Affinity
-	if affinity == nil && cr.Spec.Replicas == 2 {
-		affinity = &corev1.Affinity{
-			PodAntiAffinity: &corev1.PodAntiAffinity{
-				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
-					{
-						TopologyKey: "kubernetes.io/hostname",
-						Namespaces: []string{
-							defaults.ImageRegistryOperatorNamespace,
-						},
-						LabelSelector: &metav1.LabelSelector{
-							MatchLabels: defaults.DeploymentLabels,
-						},
-					},
-				},
-			},
-		}
-	}
+	affinity := makeAffinity(cr)
 
 	nodeSelectors := map[string]string{}
 	for k, v := range cr.Spec.NodeSelector {
@@ -468,7 +599,10 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		nodeSelectors["kubernetes.io/os"] = "linux"
 	}
 
-	gracePeriod := int64(55)
+	lifecycle, gracePeriod, err := makeShutdown(port, overrides.Deployment)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
 
 	spec := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
@@ -490,26 +624,16 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 					},
 					Ports: []corev1.ContainerPort{
 						{
-							ContainerPort: int32(defaults.ContainerPort),
+							ContainerPort: int32(port),
 							Protocol:      "TCP",
 						},
 					},
 					Env:            env,
 					VolumeMounts:   mounts,
-					LivenessProbe:  generateLivenessProbeConfig(),
-					ReadinessProbe: generateReadinessProbeConfig(),
+					LivenessProbe:  generateLivenessProbeConfig(port),
+					ReadinessProbe: generateReadinessProbeConfig(port),
 					Resources:      resources,
-					// Once the pod is deleted, its endpoint should be removed
-					// from routers, load balancers, and nodes. We'll give 25
-					// seconds to propagate before we actually shutdown the
-					// registry.
-					Lifecycle: &corev1.Lifecycle{
-						PreStop: &corev1.LifecycleHandler{
-							Exec: &corev1.ExecAction{
-								Command: []string{"sleep", "25"},
-							},
-						},
-					},
+					Lifecycle:      lifecycle,
 				},
 			},
 			Volumes:                       volumes,
@@ -523,3 +647,31 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 
 	return spec, deps, nil
 }
+
+// makeAffinity returns the affinity of the registry pods. If user has provided
+// an affinity through config spec we use it as it is, if not then we fallback
+// to a preferred affinity configuration. We only require a certain affinity
+// during schedule if the number of replicas is defined to two.
+func makeAffinity(cr *v1.Config) *corev1.Affinity {
+	if cr.Spec.Affinity != nil {
+		return cr.Spec.Affinity
+	}
+	if cr.Spec.Replicas != 2 {
+		return nil
+	}
+	return &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+				{
+					TopologyKey: "kubernetes.io/hostname",
+					Namespaces: []string{
+						defaults.ImageRegistryOperatorNamespace,
+					},
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: defaults.DeploymentLabels,
+					},
+				},
+			},
+		},
+	}
+}
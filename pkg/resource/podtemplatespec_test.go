@@ -121,6 +121,29 @@ func TestMakePodTemplateSpecWithTopologySpread(t *testing.T) {
 			},
 			expected: nil,
 		},
+		"testOmitsDefaultsWithNodeAffinity": {
+			nodes: []*corev1.Node{nodeMasterA, nodeWorkerA, nodeWorkerB},
+			spec: imageregistryapiv1.ImageRegistrySpec{
+				Affinity: &corev1.Affinity{
+					NodeAffinity: &corev1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+							NodeSelectorTerms: []corev1.NodeSelectorTerm{
+								{
+									MatchExpressions: []corev1.NodeSelectorRequirement{
+										{
+											Key:      "topology.kubernetes.io/zone",
+											Operator: corev1.NodeSelectorOpIn,
+											Values:   []string{"a"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: nil,
+		},
 		"testUserDefinedOverrideDefaults": {
 			nodes: []*corev1.Node{nodeMasterA, nodeWorkerA, nodeWorkerB},
 			spec: v1.ImageRegistrySpec{
@@ -225,6 +248,92 @@ func TestMakePodTemplateSpecWithTopologySpread(t *testing.T) {
 	}
 }
 
+func TestMakeAffinity(t *testing.T) {
+	defaultAntiAffinity := &corev1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+			{
+				TopologyKey: "kubernetes.io/hostname",
+				Namespaces:  []string{defaults.ImageRegistryOperatorNamespace},
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: defaults.DeploymentLabels,
+				},
+			},
+		},
+	}
+	nodeAffinity := &corev1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{
+			{
+				Weight: 1,
+				Preference: corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+					},
+				},
+			},
+		},
+	}
+	userAntiAffinity := &corev1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+			{
+				Weight:          10,
+				PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: "topology.kubernetes.io/zone"},
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		replicas int32
+		affinity *corev1.Affinity
+		expected *corev1.Affinity
+	}{
+		{
+			name:     "no affinity with one replica",
+			replicas: 1,
+			expected: nil,
+		},
+		{
+			name:     "default anti-affinity with two replicas",
+			replicas: 2,
+			expected: &corev1.Affinity{PodAntiAffinity: defaultAntiAffinity},
+		},
+		{
+			name:     "user affinity replaces the default anti-affinity",
+			replicas: 2,
+			affinity: &corev1.Affinity{NodeAffinity: nodeAffinity},
+			expected: &corev1.Affinity{NodeAffinity: nodeAffinity},
+		},
+		{
+			name:     "user anti-affinity is used as it is",
+			replicas: 2,
+			affinity: &corev1.Affinity{NodeAffinity: nodeAffinity, PodAntiAffinity: userAntiAffinity},
+			expected: &corev1.Affinity{NodeAffinity: nodeAffinity, PodAntiAffinity: userAntiAffinity},
+		},
+		{
+			name:     "user affinity with one replica",
+			replicas: 1,
+			affinity: &corev1.Affinity{NodeAffinity: nodeAffinity},
+			expected: &corev1.Affinity{NodeAffinity: nodeAffinity},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1.Config{
+				Spec: v1.ImageRegistrySpec{
+					Replicas: tt.replicas,
+					Affinity: tt.affinity,
+				},
+			}
+			got := makeAffinity(cr)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %#v, want %#v", got, tt.expected)
+			}
+			if tt.affinity != nil && tt.affinity.PodAntiAffinity == nil && cr.Spec.Affinity.PodAntiAffinity != nil {
+				t.Errorf("the affinity of the config spec was modified")
+			}
+		})
+	}
+}
+
 type volumeMount struct {
 	volExists   bool
 	mountExists bool
@@ -552,3 +661,252 @@ func TestMakePodTemplateSpecS3CloudFront(t *testing.T) {
 		t.Errorf("expected env var %s not found", name)
 	}
 }
+
+func TestMakePodTemplateSpecQuotaOverrides(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		expected  map[string]string
+	}{
+		{
+			name: "defaults",
+			expected: map[string]string{
+				"REGISTRY_OPENSHIFT_QUOTA_ENABLED": "true",
+			},
+		},
+		{
+			name:      "disabled",
+			overrides: `{"quota":{"enabled":false}}`,
+			expected: map[string]string{
+				"REGISTRY_OPENSHIFT_QUOTA_ENABLED": "false",
+			},
+		},
+		{
+			name:      "cache ttls",
+			overrides: `{"quota":{"cacheTTL":"30s","blobRepositoryCacheTTL":"5m"}}`,
+			expected: map[string]string{
+				"REGISTRY_OPENSHIFT_QUOTA_ENABLED":           "true",
+				"REGISTRY_OPENSHIFT_QUOTA_CACHETTL":          "30s",
+				"REGISTRY_OPENSHIFT_CACHE_BLOBREPOSITORYTTL": "5m0s",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Storage: v1.ImageRegistryConfigStorage{
+						EmptyDir: &v1.ImageRegistryConfigStorageEmptyDir{},
+					},
+				},
+			}
+			if tt.overrides != "" {
+				config.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			}
+			fixture := buildFakeClient(config, nil)
+
+			pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, emptydir.NewDriver(config.Spec.Storage.EmptyDir), config)
+			if err != nil {
+				t.Fatalf("error creating pod template: %v", err)
+			}
+
+			for _, envVar := range pod.Spec.Containers[0].Env {
+				if envVar.Name != "REGISTRY_OPENSHIFT_QUOTA_ENABLED" &&
+					envVar.Name != "REGISTRY_OPENSHIFT_QUOTA_CACHETTL" &&
+					envVar.Name != "REGISTRY_OPENSHIFT_CACHE_BLOBREPOSITORYTTL" {
+					continue
+				}
+				expected, ok := tt.expected[envVar.Name]
+				if !ok {
+					t.Errorf("unexpected env var %s", envVar.Name)
+					continue
+				}
+				if envVar.Value != expected {
+					t.Errorf("expected env var %s to have value %s, got %s", envVar.Name, expected, envVar.Value)
+				}
+				delete(tt.expected, envVar.Name)
+			}
+			for name := range tt.expected {
+				t.Errorf("expected env var %s not found", name)
+			}
+		})
+	}
+}
+
+func TestApplyProbeOverrides(t *testing.T) {
+	int32p := func(i int32) *int32 { return &i }
+
+	probe := generateReadinessProbeConfig(defaults.ContainerPort)
+	if err := applyProbeOverrides(probe, &ProbeOverrides{
+		InitialDelaySeconds: int32p(120),
+		PeriodSeconds:       int32p(30),
+		FailureThreshold:    int32p(10),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if probe.InitialDelaySeconds != 120 || probe.PeriodSeconds != 30 || probe.FailureThreshold != 10 {
+		t.Errorf("probe timings were not overridden: %#v", probe)
+	}
+
+	probe = generateLivenessProbeConfig(defaults.ContainerPort)
+	if err := applyProbeOverrides(probe, &ProbeOverrides{PeriodSeconds: int32p(30)}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if probe.InitialDelaySeconds != 5 {
+		t.Errorf("expected initial delay to keep its default, got %d", probe.InitialDelaySeconds)
+	}
+
+	for _, overrides := range []*ProbeOverrides{
+		{InitialDelaySeconds: int32p(-1)},
+		{InitialDelaySeconds: int32p(maxProbeInitialDelaySeconds + 1)},
+		{PeriodSeconds: int32p(0)},
+		{FailureThreshold: int32p(maxProbeFailureThreshold + 1)},
+	} {
+		if err := applyProbeOverrides(generateLivenessProbeConfig(defaults.ContainerPort), overrides); err == nil {
+			t.Errorf("expected error for out of range overrides %#v", overrides)
+		}
+	}
+}
+
+func TestMakePodTemplateSpecAuditOverrides(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		expected  bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:      "enabled",
+			overrides: `{"audit":{"enabled":true}}`,
+			expected:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Storage: v1.ImageRegistryConfigStorage{
+						EmptyDir: &v1.ImageRegistryConfigStorageEmptyDir{},
+					},
+				},
+			}
+			if tt.overrides != "" {
+				config.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			}
+			fixture := buildFakeClient(config, nil)
+
+			pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, emptydir.NewDriver(config.Spec.Storage.EmptyDir), config)
+			if err != nil {
+				t.Fatalf("error creating pod template: %v", err)
+			}
+
+			found := false
+			for _, envVar := range pod.Spec.Containers[0].Env {
+				if envVar.Name == "REGISTRY_OPENSHIFT_AUDIT_ENABLED" && envVar.Value == "true" {
+					found = true
+				}
+			}
+			if found != tt.expected {
+				t.Errorf("got audit enabled %v, want %v", found, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecPort(t *testing.T) {
+	config := &v1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Spec: v1.ImageRegistrySpec{
+			Storage: v1.ImageRegistryConfigStorage{
+				EmptyDir: &v1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	}
+	config.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"port":8443}`)
+	fixture := buildFakeClient(config, nil)
+
+	pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, emptydir.NewDriver(config.Spec.Storage.EmptyDir), config)
+	if err != nil {
+		t.Fatalf("error creating pod template: %v", err)
+	}
+
+	container := pod.Spec.Containers[0]
+	if port := container.Ports[0].ContainerPort; port != 8443 {
+		t.Errorf("got container port %d, want 8443", port)
+	}
+	if port := container.ReadinessProbe.HTTPGet.Port.IntValue(); port != 8443 {
+		t.Errorf("got readiness probe port %d, want 8443", port)
+	}
+	if port := container.LivenessProbe.HTTPGet.Port.IntValue(); port != 8443 {
+		t.Errorf("got liveness probe port %d, want 8443", port)
+	}
+	env := map[string]string{}
+	for _, envVar := range container.Env {
+		env[envVar.Name] = envVar.Value
+	}
+	if addr := env["REGISTRY_HTTP_ADDR"]; addr != ":8443" {
+		t.Errorf("got REGISTRY_HTTP_ADDR %q, want %q", addr, ":8443")
+	}
+	if addr, want := env["REGISTRY_OPENSHIFT_SERVER_ADDR"], "image-registry.openshift-image-registry.svc:8443"; addr != want {
+		t.Errorf("got REGISTRY_OPENSHIFT_SERVER_ADDR %q, want %q", addr, want)
+	}
+}
+
+func TestMakeShutdown(t *testing.T) {
+	int32p := func(i int32) *int32 { return &i }
+	int64p := func(i int64) *int64 { return &i }
+
+	lifecycle, gracePeriod, err := makeShutdown(defaults.ContainerPort, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if gracePeriod != defaultTerminationGracePeriodSeconds {
+		t.Errorf("got grace period %d, want %d", gracePeriod, defaultTerminationGracePeriodSeconds)
+	}
+	if !reflect.DeepEqual(lifecycle.PreStop.Exec.Command, []string{"sleep", "25"}) {
+		t.Errorf("got preStop command %q, want sleep 25", lifecycle.PreStop.Exec.Command)
+	}
+
+	lifecycle, gracePeriod, err = makeShutdown(5000, &DeploymentOverrides{
+		TerminationGracePeriodSeconds: int64p(900),
+		PreStop: &PreStopOverrides{
+			SleepSeconds:        int32p(10),
+			DrainTimeoutSeconds: int32p(840),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if gracePeriod != 900 {
+		t.Errorf("got grace period %d, want 900", gracePeriod)
+	}
+	command := lifecycle.PreStop.Exec.Command
+	if len(command) != 3 || command[0] != "/bin/sh" {
+		t.Fatalf("got preStop command %q, want a drain script", command)
+	}
+	for _, want := range []string{"sleep 10\n", "+ 840 ))", ":1388 "} {
+		if !strings.Contains(command[2], want) {
+			t.Errorf("expected the drain script to contain %q, got %s", want, command[2])
+		}
+	}
+
+	for _, overrides := range []*DeploymentOverrides{
+		{TerminationGracePeriodSeconds: int64p(0)},
+		{TerminationGracePeriodSeconds: int64p(maxTerminationGracePeriodSeconds + 1)},
+		{TerminationGracePeriodSeconds: int64p(20)},
+		{PreStop: &PreStopOverrides{SleepSeconds: int32p(-1)}},
+		{PreStop: &PreStopOverrides{DrainTimeoutSeconds: int32p(30)}},
+	} {
+		if _, _, err := makeShutdown(defaults.ContainerPort, overrides); err == nil {
+			t.Errorf("expected error for overrides %#v", overrides)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+)
+
+// prometheusRuleResource is the prometheus-operator PrometheusRule resource,
+// there is no typed client for it.
+var prometheusRuleResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "prometheusrules"}
+
+// prometheusRulesCondition reports whether the rule groups added by the user
+// are shipped in the user PrometheusRule.
+const prometheusRulesCondition = "PrometheusRules"
+
+// ruleGroup is a group of alerting and recording rules of a PrometheusRule.
+type ruleGroup struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval,omitempty"`
+	Rules    []rule `json:"rules"`
+}
+
+// rule is an alerting rule when Alert is set, a recording rule when Record
+// is set.
+type rule struct {
+	Alert       string            `json:"alert,omitempty"`
+	Record      string            `json:"record,omitempty"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// staticRuleGroupNames are the rule groups of the PrometheusRules shipped as
+// manifests: they are kept whatever the management state of the registry.
+var staticRuleGroupNames = []string{
+	"imagestreams.rules",
+	"imageregistry.operations.rules",
+}
+
+// defaultRuleGroups are the rule groups shipped by the operator.
+var defaultRuleGroups = []ruleGroup{
+	{
+		Name: "imageregistry.deprecations",
+		Rules: []rule{
+			{
+				Alert: "ImageRegistryDeprecatedFieldsInUse",
+				Expr:  "max by (resource, field) (image_registry_operator_deprecated_fields_in_use) == 1",
+				For:   "1h",
+				Labels: map[string]string{
+					"severity": "info",
+				},
+				Annotations: map[string]string{
+					"summary":     "The image registry configuration uses a deprecated field.",
+					"description": "The {{ $labels.field }} field of the image registry {{ $labels.resource }} is deprecated and will be removed in a future release. Move to its replacement before upgrading.",
+				},
+			},
+		},
+	},
+}
+
+// pullThroughRuleGroup holds the rules on the pull-through of the images
+// image streams reference on remote registries, which the registry always
+// does. It counts the blobs served from its storage (Hit) or from the
+// remotes (Miss), and the requests to the remotes and their errors by remote
+// registry.
+var pullThroughRuleGroup = ruleGroup{
+	Name: "imageregistry.pullthrough.rules",
+	Rules: []rule{
+		{
+			Record: "imageregistry:pullthrough_cache_requests:rate5m",
+			Expr:   "sum by (type) (rate(imageregistry_pullthrough_blobstore_cache_requests_total[5m]))",
+		},
+		{
+			Record: "imageregistry:pullthrough_cache_hits:ratio_rate5m",
+			Expr:   `sum(rate(imageregistry_pullthrough_blobstore_cache_requests_total{type="Hit"}[5m])) / sum(rate(imageregistry_pullthrough_blobstore_cache_requests_total[5m]))`,
+		},
+		{
+			Record: "imageregistry:pullthrough_upstream_errors:ratio_rate5m",
+			Expr:   "sum by (registry) (rate(imageregistry_pullthrough_repository_errors_total[5m])) / sum by (registry) (rate(imageregistry_pullthrough_repository_duration_seconds_count[5m]))",
+		},
+		{
+			Alert: "ImageRegistryPullThroughUpstreamErrors",
+			Expr:  "imageregistry:pullthrough_upstream_errors:ratio_rate5m > 0.1",
+			For:   "15m",
+			Labels: map[string]string{
+				"severity": "warning",
+			},
+			Annotations: map[string]string{
+				"summary":     "The image registry fails to pull through from a remote registry.",
+				"description": "{{ $value | humanizePercentage }} of the requests of the image registry pull-through cache to {{ $labels.registry }} fail. Images not cached yet cannot be pulled from the remote, check that it is reachable and that its credentials are valid.",
+			},
+		},
+	},
+}
+
+// validateRuleGroups checks the rule groups added by the user. The PromQL
+// expressions are checked by the prometheus-operator when the user
+// PrometheusRule is applied, a rejection is reported by
+// syncUserPrometheusRule.
+func validateRuleGroups(groups []ruleGroup) error {
+	names := map[string]bool{pullThroughRuleGroup.Name: true}
+	for _, name := range staticRuleGroupNames {
+		names[name] = true
+	}
+	for _, g := range defaultRuleGroups {
+		names[g.Name] = true
+	}
+	for _, g := range groups {
+		if g.Name == "" {
+			return fmt.Errorf("rule group without a name")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("rule group %s: the name is already used", g.Name)
+		}
+		names[g.Name] = true
+		if g.Interval != "" {
+			if _, err := model.ParseDuration(g.Interval); err != nil {
+				return fmt.Errorf("rule group %s: invalid interval: %w", g.Name, err)
+			}
+		}
+		if len(g.Rules) == 0 {
+			return fmt.Errorf("rule group %s: no rules", g.Name)
+		}
+		for i, r := range g.Rules {
+			if err := validateRule(r); err != nil {
+				return fmt.Errorf("rule group %s: rule %d: %w", g.Name, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRule(r rule) error {
+	switch {
+	case r.Alert != "" && r.Record != "":
+		return fmt.Errorf("only one of alert and record can be set")
+	case r.Alert == "" && r.Record == "":
+		return fmt.Errorf("one of alert and record has to be set")
+	case r.Record != "" && !model.IsValidMetricName(model.LabelValue(r.Record)):
+		return fmt.Errorf("invalid record name %q", r.Record)
+	case r.Record != "" && (r.For != "" || len(r.Annotations) > 0):
+		return fmt.Errorf("recording rule %s: for and annotations are only allowed on alerts", r.Record)
+	case strings.TrimSpace(r.Expr) == "":
+		return fmt.Errorf("empty expr")
+	}
+	if r.For != "" {
+		if _, err := model.ParseDuration(r.For); err != nil {
+			return fmt.Errorf("invalid for: %w", err)
+		}
+	}
+	for name := range r.Labels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// getPrometheusRulesConfigMap returns the config map where the user adds
+// rule groups, nil if there is none.
+func getPrometheusRulesConfigMap(lister corelisters.ConfigMapNamespaceLister) (*corev1.ConfigMap, error) {
+	cm, err := lister.Get(defaults.PrometheusRulesConfigMapName)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return cm, err
+}
+
+// parseRuleGroups returns the valid rule groups added by the user to cm.
+func parseRuleGroups(cm *corev1.ConfigMap) ([]ruleGroup, error) {
+	var rules struct {
+		Groups []ruleGroup
+	}
+	if err := yaml.UnmarshalStrict([]byte(cm.Data[defaults.PrometheusRulesKey]), &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse the %s key: %w", defaults.PrometheusRulesKey, err)
+	}
+	if err := validateRuleGroups(rules.Groups); err != nil {
+		return nil, err
+	}
+	return rules.Groups, nil
+}
+
+// syncUserPrometheusRule ships the rule groups added by the user in their own
+// PrometheusRule, created by newRule, and reports the outcome in the
+// PrometheusRules condition. The rules rejected by the prometheus-operator,
+// e.g. for an invalid PromQL expression, are reported rather than failing
+// the sync: the operator rules are shipped anyway.
+func syncUserPrometheusRule(cr *imageregistryv1.Config, lister corelisters.ConfigMapNamespaceLister, newRule func([]ruleGroup) Mutator) error {
+	cm, err := getPrometheusRulesConfigMap(lister)
+	if err != nil {
+		return err
+	}
+	if cm == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, prometheusRulesCondition)
+		return deleteUserPrometheusRule(newRule(nil))
+	}
+
+	cond := operatorv1.OperatorCondition{
+		Type:   prometheusRulesCondition,
+		Status: operatorv1.ConditionTrue,
+		Reason: "AsExpected",
+	}
+	groups, err := parseRuleGroups(cm)
+	if err != nil {
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "InvalidUserRules"
+		cond.Message = fmt.Sprintf("The rule groups of the config map %s are ignored: %s", cm.Name, err)
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+		return deleteUserPrometheusRule(newRule(nil))
+	}
+
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	if err := ApplyMutator(newRule(groups)); err != nil {
+		klog.Warningf("unable to ship the rule groups of the config map %s: %s", cm.Name, err)
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "RejectedUserRules"
+		cond.Message = fmt.Sprintf("The rule groups of the config map %s are not shipped: %s", cm.Name, err)
+	} else {
+		cond.Message = fmt.Sprintf("The rule groups of the config map %s are shipped in the PrometheusRule %s: %s", cm.Name, defaults.UserPrometheusRuleName, strings.Join(names, ", "))
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+	return nil
+}
+
+// deleteUserPrometheusRule deletes the PrometheusRule holding the rule groups
+// added by the user, if there is one.
+func deleteUserPrometheusRule(gen Mutator) error {
+	if _, err := gen.Get(); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err := gen.Delete(metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+var _ Mutator = &generatorPrometheusRule{}
+
+// generatorPrometheusRule generates a PrometheusRule holding either the rules
+// shipped by the operator or the ones added by the user.
+type generatorPrometheusRule struct {
+	client dynamic.Interface
+	name   string
+	groups []ruleGroup
+}
+
+func newGeneratorPrometheusRule(client dynamic.Interface) *generatorPrometheusRule {
+	groups := make([]ruleGroup, 0, len(defaultRuleGroups)+1)
+	groups = append(groups, defaultRuleGroups...)
+	groups = append(groups, pullThroughRuleGroup)
+	return &generatorPrometheusRule{
+		client: client,
+		name:   defaults.PrometheusRuleName,
+		groups: groups,
+	}
+}
+
+// newGeneratorUserPrometheusRule returns the generator of the PrometheusRule
+// holding the rule groups added by the user. They are kept apart from the
+// operator rules so that the prometheus-operator rejecting them leaves the
+// operator rules alone.
+func newGeneratorUserPrometheusRule(client dynamic.Interface, groups []ruleGroup) *generatorPrometheusRule {
+	return &generatorPrometheusRule{
+		client: client,
+		name:   defaults.UserPrometheusRuleName,
+		groups: groups,
+	}
+}
+
+func (gp *generatorPrometheusRule) Type() runtime.Object {
+	return &unstructured.Unstructured{}
+}
+
+func (gp *generatorPrometheusRule) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gp *generatorPrometheusRule) GetName() string {
+	return gp.name
+}
+
+func (gp *generatorPrometheusRule) expected() (*unstructured.Unstructured, error) {
+	buf, err := json.Marshal(map[string]interface{}{"groups": gp.groups})
+	if err != nil {
+		return nil, err
+	}
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &spec); err != nil {
+		return nil, err
+	}
+	dgst, err := strategy.Checksum(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetAPIVersion(prometheusRuleResource.GroupVersion().String())
+	u.SetKind("PrometheusRule")
+	u.SetName(gp.GetName())
+	u.SetNamespace(gp.GetNamespace())
+	u.SetAnnotations(map[string]string{
+		defaults.ChecksumOperatorAnnotation: dgst,
+	})
+	return u, nil
+}
+
+func (gp *generatorPrometheusRule) Get() (runtime.Object, error) {
+	return gp.client.Resource(prometheusRuleResource).Namespace(gp.GetNamespace()).Get(context.TODO(), gp.GetName(), metav1.GetOptions{})
+}
+
+func (gp *generatorPrometheusRule) Create() (runtime.Object, error) {
+	n, err := gp.expected()
+	if err != nil {
+		return nil, err
+	}
+	return gp.client.Resource(prometheusRuleResource).Namespace(gp.GetNamespace()).Create(context.TODO(), n, metav1.CreateOptions{})
+}
+
+func (gp *generatorPrometheusRule) Update(o runtime.Object) (runtime.Object, bool, error) {
+	expected, err := gp.expected()
+	if err != nil {
+		return o, false, err
+	}
+	current := o.(*unstructured.Unstructured)
+
+	// the spec is compared rather than the checksum alone, so rules edited
+	// by hand are reverted.
+	dgst := expected.GetAnnotations()[defaults.ChecksumOperatorAnnotation]
+	if current.GetAnnotations()[defaults.ChecksumOperatorAnnotation] == dgst && equality.Semantic.DeepEqual(current.Object["spec"], expected.Object["spec"]) {
+		return o, false, nil
+	}
+
+	current.Object["spec"] = expected.Object["spec"]
+	annotations := current.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[defaults.ChecksumOperatorAnnotation] = dgst
+	current.SetAnnotations(annotations)
+
+	u, err := gp.client.Resource(prometheusRuleResource).Namespace(gp.GetNamespace()).Update(context.TODO(), current, metav1.UpdateOptions{})
+	return u, true, err
+}
+
+func (gp *generatorPrometheusRule) Delete(opts metav1.DeleteOptions) error {
+	return gp.client.Resource(prometheusRuleResource).Namespace(gp.GetNamespace()).Delete(context.TODO(), gp.GetName(), opts)
+}
+
+// Owned returns false, the rules are kept when the registry is removed:
+// the deprecated fields of the image pruner are still reported.
+func (gp *generatorPrometheusRule) Owned() bool {
+	return false
+}
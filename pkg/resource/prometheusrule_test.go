@@ -0,0 +1,278 @@
+package resource
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestParseRuleGroups(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		rules  string
+		groups []string
+		err    string
+	}{
+		{
+			name: "alert and recording rule",
+			rules: `groups:
+- name: imageregistry.custom
+  interval: 1m
+  rules:
+  - record: imageregistry:imagestreamtags:sum
+    expr: sum(imageregistry:imagestreamtags_count:sum)
+  - alert: ImageRegistryTooManyImageStreamTags
+    expr: imageregistry:imagestreamtags:sum > 50000
+    for: 30m
+    labels:
+      severity: warning
+    annotations:
+      summary: Too many image stream tags.
+`,
+			groups: []string{"imageregistry.custom"},
+		},
+		{
+			name:  "unknown field",
+			rules: "groups:\n- name: custom\n  rules:\n  - alert: Foo\n    expression: up == 0\n",
+			err:   "unable to parse",
+		},
+		{
+			name:  "operator group",
+			rules: "groups:\n- name: imagestreams.rules\n  rules:\n  - alert: Foo\n    expr: up == 0\n",
+			err:   "rule group imagestreams.rules: the name is already used",
+		},
+		{
+			name:  "duplicate group",
+			rules: "groups:\n- name: custom\n  rules:\n  - alert: Foo\n    expr: up == 0\n- name: custom\n  rules:\n  - alert: Bar\n    expr: up == 0\n",
+			err:   "rule group custom: the name is already used",
+		},
+		{
+			name:  "alert and record",
+			rules: "groups:\n- name: custom\n  rules:\n  - alert: Foo\n    record: foo\n    expr: up == 0\n",
+			err:   "only one of alert and record can be set",
+		},
+		{
+			name:  "no expr",
+			rules: "groups:\n- name: custom\n  rules:\n  - alert: Foo\n",
+			err:   "empty expr",
+		},
+		{
+			name:  "invalid record name",
+			rules: "groups:\n- name: custom\n  rules:\n  - record: foo-bar\n    expr: up\n",
+			err:   `invalid record name "foo-bar"`,
+		},
+		{
+			name:  "invalid for",
+			rules: "groups:\n- name: custom\n  rules:\n  - alert: Foo\n    expr: up == 0\n    for: 1 hour\n",
+			err:   "invalid for",
+		},
+		{
+			name:  "invalid label name",
+			rules: "groups:\n- name: custom\n  rules:\n  - alert: Foo\n    expr: up == 0\n    labels:\n      team-name: registry\n",
+			err:   `invalid label name "team-name"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := &corev1.ConfigMap{Data: map[string]string{defaults.PrometheusRulesKey: tt.rules}}
+			groups, err := parseRuleGroups(cm)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, g := range groups {
+				names = append(names, g.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.groups, ",") {
+				t.Errorf("got groups %v, want %v", names, tt.groups)
+			}
+		})
+	}
+}
+
+// fakeUserPrometheusRule keeps the user PrometheusRule in memory and fails
+// its creation with rejectErr, as the prometheus-operator webhook does.
+type fakeUserPrometheusRule struct {
+	*generatorPrometheusRule
+	current   **unstructured.Unstructured
+	rejectErr error
+}
+
+func (f *fakeUserPrometheusRule) Get() (runtime.Object, error) {
+	if *f.current == nil {
+		return nil, kerrors.NewNotFound(prometheusRuleResource.GroupResource(), f.GetName())
+	}
+	return *f.current, nil
+}
+
+func (f *fakeUserPrometheusRule) Create() (runtime.Object, error) {
+	if f.rejectErr != nil {
+		return nil, f.rejectErr
+	}
+	u, err := f.expected()
+	*f.current = u
+	return u, err
+}
+
+func (f *fakeUserPrometheusRule) Update(o runtime.Object) (runtime.Object, bool, error) {
+	u, err := f.expected()
+	*f.current = u
+	return u, true, err
+}
+
+func (f *fakeUserPrometheusRule) Delete(opts metav1.DeleteOptions) error {
+	*f.current = nil
+	return nil
+}
+
+func TestSyncUserPrometheusRule(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		configMap bool
+		rules     string
+		existing  bool
+		rejectErr error
+		status    operatorv1.ConditionStatus
+		reason    string
+		groups    int
+	}{
+		{
+			name: "no config map",
+		},
+		{
+			name:     "config map removed",
+			existing: true,
+		},
+		{
+			name:      "valid rules",
+			configMap: true,
+			rules:     "groups:\n- name: custom\n  rules:\n  - alert: Foo\n    expr: up == 0\n",
+			status:    operatorv1.ConditionTrue,
+			reason:    "AsExpected",
+			groups:    1,
+		},
+		{
+			name:      "invalid rules",
+			configMap: true,
+			rules:     "groups:\n- name: custom\n  rules: []\n",
+			existing:  true,
+			status:    operatorv1.ConditionFalse,
+			reason:    "InvalidUserRules",
+		},
+		{
+			name:      "rules rejected by the webhook",
+			configMap: true,
+			rules:     "groups:\n- name: custom\n  rules:\n  - alert: Foo\n    expr: up ==\n",
+			rejectErr: fmt.Errorf("admission webhook denied the request: parse error"),
+			status:    operatorv1.ConditionFalse,
+			reason:    "RejectedUserRules",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.configMap {
+				if err := indexer.Add(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.PrometheusRulesConfigMapName,
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+					},
+					Data: map[string]string{defaults.PrometheusRulesKey: tt.rules},
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			lister := corelisters.NewConfigMapLister(indexer).ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+
+			var current *unstructured.Unstructured
+			if tt.existing {
+				current = &unstructured.Unstructured{}
+			}
+			newRule := func(groups []ruleGroup) Mutator {
+				return &fakeUserPrometheusRule{
+					generatorPrometheusRule: newGeneratorUserPrometheusRule(nil, groups),
+					current:                 &current,
+					rejectErr:               tt.rejectErr,
+				}
+			}
+
+			cr := &imageregistryv1.Config{}
+			if err := syncUserPrometheusRule(cr, lister, newRule); err != nil {
+				t.Fatal(err)
+			}
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, prometheusRulesCondition)
+			if tt.status == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.status, tt.reason)
+			}
+
+			// invalid or rejected rule groups are not shipped, the
+			// operator ones are not affected.
+			var groups []interface{}
+			if current != nil {
+				groups, _, _ = unstructured.NestedSlice(current.Object, "spec", "groups")
+			}
+			if len(groups) != tt.groups {
+				t.Errorf("got %d user rule groups, want %d", len(groups), tt.groups)
+			}
+		})
+	}
+}
+
+func TestGeneratorPrometheusRuleExpected(t *testing.T) {
+	gp := newGeneratorPrometheusRule(nil)
+	u, err := gp.expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.GetKind() != "PrometheusRule" || u.GetAPIVersion() != "monitoring.coreos.com/v1" || u.GetName() != defaults.PrometheusRuleName || u.GetNamespace() != defaults.ImageRegistryOperatorNamespace {
+		t.Errorf("got %s %s %s/%s, want monitoring.coreos.com/v1 PrometheusRule %s/%s", u.GetAPIVersion(), u.GetKind(), u.GetNamespace(), u.GetName(), defaults.ImageRegistryOperatorNamespace, defaults.PrometheusRuleName)
+	}
+	groups, _, _ := unstructured.NestedSlice(u.Object, "spec", "groups")
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.(map[string]interface{})["name"].(string))
+	}
+	expected := "imageregistry.deprecations,imageregistry.pullthrough.rules"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("got groups %v, want %s", names, expected)
+	}
+
+	// the current object is left alone while it matches.
+	_, updated, err := gp.Update(u.DeepCopy())
+	if err != nil || updated {
+		t.Errorf("got updated %t and error %v, want no update", updated, err)
+	}
+}
+
+func TestPullThroughRuleGroup(t *testing.T) {
+	for _, r := range pullThroughRuleGroup.Rules {
+		if err := validateRule(r); err != nil {
+			t.Errorf("invalid rule %s%s: %s", r.Alert, r.Record, err)
+		}
+	}
+	if err := validateRuleGroups([]ruleGroup{{Name: pullThroughRuleGroup.Name, Rules: []rule{{Alert: "Foo", Expr: "up == 0"}}}}); err == nil {
+		t.Errorf("expected the name of the pull-through cache rule group to be reserved")
+	}
+}
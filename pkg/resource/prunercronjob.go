@@ -3,16 +3,21 @@ package resource
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
 
 	batchapi "k8s.io/api/batch/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
 	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 
 	imageregistryapiv1 "github.com/openshift/api/imageregistry/v1"
 	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
@@ -44,18 +49,22 @@ var (
 var _ Mutator = &generatorPrunerCronJob{}
 
 type generatorPrunerCronJob struct {
-	lister            batchlisters.CronJobNamespaceLister
-	client            batchset.BatchV1Interface
-	prunerLister      imageregistryv1listers.ImagePrunerLister
-	imageConfigLister configv1listers.ImageLister
+	lister               batchlisters.CronJobNamespaceLister
+	client               batchset.BatchV1Interface
+	prunerLister         imageregistryv1listers.ImagePrunerLister
+	registryConfigLister imageregistryv1listers.ConfigLister
+	imageConfigLister    configv1listers.ImageLister
+	namespaceLister      corelisters.NamespaceLister
 }
 
-func newGeneratorPrunerCronJob(lister batchlisters.CronJobNamespaceLister, client batchset.BatchV1Interface, prunerLister imageregistryv1listers.ImagePrunerLister, imageConfigLister configv1listers.ImageLister) *generatorPrunerCronJob {
+func newGeneratorPrunerCronJob(lister batchlisters.CronJobNamespaceLister, client batchset.BatchV1Interface, prunerLister imageregistryv1listers.ImagePrunerLister, registryConfigLister imageregistryv1listers.ConfigLister, imageConfigLister configv1listers.ImageLister, namespaceLister corelisters.NamespaceLister) *generatorPrunerCronJob {
 	return &generatorPrunerCronJob{
-		lister:            lister,
-		client:            client,
-		prunerLister:      prunerLister,
-		imageConfigLister: imageConfigLister,
+		lister:               lister,
+		client:               client,
+		prunerLister:         prunerLister,
+		registryConfigLister: registryConfigLister,
+		imageConfigLister:    imageConfigLister,
+		namespaceLister:      namespaceLister,
 	}
 }
 
@@ -82,6 +91,79 @@ func (gcj *generatorPrunerCronJob) expected() (runtime.Object, error) {
 		return nil, err
 	}
 
+	overrides, err := gcj.getPrunerOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	caFile := "/var/run/configmaps/serviceca/service-ca.crt"
+	volumes := []kcorev1.Volume{
+		{
+			Name: "serviceca",
+			VolumeSource: kcorev1.VolumeSource{
+				ConfigMap: &kcorev1.ConfigMapVolumeSource{
+					LocalObjectReference: kcorev1.LocalObjectReference{
+						Name: "serviceca",
+					},
+				},
+			},
+		},
+	}
+	mounts := []kcorev1.VolumeMount{
+		{
+			Name:      "serviceca",
+			MountPath: "/var/run/configmaps/serviceca",
+			ReadOnly:  true,
+		},
+	}
+	if overrides.CABundleConfigMap != "" {
+		caFile = "/var/run/configmaps/registry-ca/ca-bundle.crt"
+		volumes = append(volumes, kcorev1.Volume{
+			Name: "registry-ca",
+			VolumeSource: kcorev1.VolumeSource{
+				ConfigMap: &kcorev1.ConfigMapVolumeSource{
+					LocalObjectReference: kcorev1.LocalObjectReference{
+						Name: overrides.CABundleConfigMap,
+					},
+				},
+			},
+		})
+		mounts = append(mounts, kcorev1.VolumeMount{
+			Name:      "registry-ca",
+			MountPath: "/var/run/configmaps/registry-ca",
+			ReadOnly:  true,
+		})
+	}
+
+	var env []kcorev1.EnvVar
+	var automountToken *bool
+	if hosted := overrides.HostedCluster; hosted != nil {
+		key := hosted.KubeconfigKey
+		if key == "" {
+			key = "kubeconfig"
+		}
+		volumes = append(volumes, kcorev1.Volume{
+			Name: "hosted-kubeconfig",
+			VolumeSource: kcorev1.VolumeSource{
+				Secret: &kcorev1.SecretVolumeSource{
+					SecretName: hosted.KubeconfigSecret,
+					Items: []kcorev1.KeyToPath{
+						{Key: key, Path: "kubeconfig"},
+					},
+				},
+			},
+		})
+		mounts = append(mounts, kcorev1.VolumeMount{
+			Name:      "hosted-kubeconfig",
+			MountPath: "/etc/kubernetes/hosted-cluster",
+			ReadOnly:  true,
+		})
+		env = append(env, kcorev1.EnvVar{Name: "KUBECONFIG", Value: "/etc/kubernetes/hosted-cluster/kubeconfig"})
+		// the pruner only talks to the hosted cluster, the management
+		// cluster credentials are kept out of the pod.
+		automountToken = new(bool)
+	}
+
 	script := `set -eu
 "$@" && exit
 for i in 1 2 3 4 5; do
@@ -98,14 +180,28 @@ done
 		"prune",
 		"images",
 		"--confirm=true",
-		"--certificate-authority=/var/run/configmaps/serviceca/service-ca.crt",
+		fmt.Sprintf("--certificate-authority=%s", caFile),
 		fmt.Sprintf("--keep-tag-revisions=%d", gcj.getKeepTagRevisions(cr)),
 		fmt.Sprintf("--keep-younger-than=%s", gcj.getKeepYoungerThan(cr)),
 		fmt.Sprintf("--ignore-invalid-refs=%t", cr.Spec.IgnoreInvalidImageReferences),
 		fmt.Sprintf("--loglevel=%d", gcj.getLogLevel(cr)),
 	}
 
-	if imageConfig.Status.InternalRegistryHostname != "" {
+	registryDeletion, err := gcj.registryDeletionEnabled()
+	if err != nil {
+		return nil, err
+	}
+
+	if !registryDeletion {
+		// the registry rejects deletions, only the image objects are
+		// pruned.
+		args = append(args, "--prune-registry=false")
+	} else if overrides.RegistryURL != "" {
+		args = append(args,
+			"--prune-registry=true",
+			fmt.Sprintf("--registry-url=%s", overrides.RegistryURL),
+		)
+	} else if imageConfig.Status.InternalRegistryHostname != "" {
 		args = append(args,
 			"--prune-registry=true",
 			fmt.Sprintf("--registry-url=https://%s", imageConfig.Status.InternalRegistryHostname),
@@ -113,8 +209,23 @@ done
 	} else {
 		args = append(args, "--prune-registry=false")
 	}
+	if overrides.Insecure {
+		args = append(args, "--force-insecure=true")
+	}
+
+	if overrides.NamespaceSelector != nil {
+		namespaces, err := gcj.selectedNamespaces(overrides.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		script = namespacedPruneScript
+		env = append(env, kcorev1.EnvVar{Name: "PRUNE_NAMESPACES", Value: strings.Join(namespaces, " ")})
+	}
 
 	backoffLimit := int32(0)
+	// the jobs are resumed by the operator once they hold the storage
+	// lock, so they never run along with a garbage collection.
+	suspend := true
 	cj := &batchapi.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      gcj.GetName(),
@@ -130,26 +241,17 @@ done
 			JobTemplate: batchapi.JobTemplateSpec{
 				Spec: batchv1.JobSpec{
 					BackoffLimit: &backoffLimit,
+					Suspend:      &suspend,
 					Template: kcorev1.PodTemplateSpec{
 						Spec: kcorev1.PodSpec{
-							RestartPolicy:      kcorev1.RestartPolicyNever,
-							ServiceAccountName: "pruner",
-							PriorityClassName:  "system-cluster-critical",
-							Affinity:           gcj.getAffinity(cr),
-							NodeSelector:       gcj.getNodeSelector(cr),
-							Tolerations:        gcj.getTolerations(cr),
-							Volumes: []kcorev1.Volume{
-								{
-									Name: "serviceca",
-									VolumeSource: kcorev1.VolumeSource{
-										ConfigMap: &kcorev1.ConfigMapVolumeSource{
-											LocalObjectReference: kcorev1.LocalObjectReference{
-												Name: "serviceca",
-											},
-										},
-									},
-								},
-							},
+							RestartPolicy:                kcorev1.RestartPolicyNever,
+							ServiceAccountName:           "pruner",
+							AutomountServiceAccountToken: automountToken,
+							PriorityClassName:            "system-cluster-critical",
+							Affinity:                     gcj.getAffinity(cr),
+							NodeSelector:                 gcj.getNodeSelector(cr),
+							Tolerations:                  gcj.getTolerations(cr),
+							Volumes:                      volumes,
 							Containers: []kcorev1.Container{
 								{
 									Image:                    os.Getenv("IMAGE_PRUNER"),
@@ -158,13 +260,8 @@ done
 									Name:                     gcj.GetName(),
 									Command:                  []string{"/bin/sh"},
 									Args:                     append([]string{"-c", script}, args...),
-									VolumeMounts: []kcorev1.VolumeMount{
-										{
-											Name:      "serviceca",
-											MountPath: "/var/run/configmaps/serviceca",
-											ReadOnly:  true,
-										},
-									},
+									Env:                      env,
+									VolumeMounts:             mounts,
 								},
 							},
 						},
@@ -173,10 +270,113 @@ done
 			},
 		},
 	}
-	cj.Spec.JobTemplate.Labels = map[string]string{"created-by": gcj.GetName()}
+	cj.Spec.JobTemplate.Labels = map[string]string{
+		"created-by":              gcj.GetName(),
+		defaults.StorageLockLabel: "true",
+	}
 	return cj, nil
 }
 
+// namespacedPruneScript prunes the tag history of the image streams in the
+// namespaces listed in PRUNE_NAMESPACES, one namespace at a time, as the
+// pruner only takes one. Images are not pruned by namespaced runs, a final
+// cluster wide run that keeps every tag revision prunes the images no image
+// stream references anymore.
+const namespacedPruneScript = `set -eu
+retry() {
+  "$@" && return
+  for i in 1 2 3 4 5; do
+    echo "attempt #$i has failed (exit code $?), going to make another attempt..." >&2
+    sleep $(($i * 30))
+    "$@" && return
+  done
+  return 1
+}
+for ns in $PRUNE_NAMESPACES; do
+  retry "$@" --namespace="$ns"
+done
+retry "$@" --keep-tag-revisions=2147483647
+`
+
+// selectedNamespaces returns the names of the namespaces matching selector,
+// in order.
+func (gcj *generatorPrunerCronJob) selectedNamespaces(selector *metav1.LabelSelector) ([]string, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pruner namespace selector: %w", err)
+	}
+	namespaces, err := gcj.namespaceLister.List(sel)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		names = append(names, ns.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// registryDeletionEnabled returns true if the registry accepts deletions.
+func (gcj *generatorPrunerCronJob) registryDeletionEnabled() (bool, error) {
+	cr, err := gcj.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	enabled, err := GetStorageDeletion(cr)
+	return enabled, err
+}
+
+// getPrunerOverrides returns the pruner settings found in the registry
+// config overrides, after validating them.
+func (gcj *generatorPrunerCronJob) getPrunerOverrides() (*PrunerOverrides, error) {
+	cr, err := gcj.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return &PrunerOverrides{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides.Pruner == nil {
+		return &PrunerOverrides{}, nil
+	}
+
+	if overrides.Pruner.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(overrides.Pruner.NamespaceSelector); err != nil {
+			return nil, fmt.Errorf("invalid pruner namespace selector: %w", err)
+		}
+	}
+	if overrides.Pruner.RegistryURL != "" {
+		u, err := url.Parse(overrides.Pruner.RegistryURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pruner registry url: %w", err)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			return nil, fmt.Errorf("invalid pruner registry url %q: expected an http or https url", overrides.Pruner.RegistryURL)
+		}
+	}
+	if hosted := overrides.Pruner.HostedCluster; hosted != nil {
+		if hosted.KubeconfigSecret == "" {
+			return nil, fmt.Errorf("invalid pruner hosted cluster: kubeconfigSecret is required")
+		}
+		if overrides.Pruner.RegistryURL == "" {
+			return nil, fmt.Errorf("invalid pruner hosted cluster: registryURL is required, the internal registry hostname of the hosted cluster cannot be reached")
+		}
+		if overrides.Pruner.NamespaceSelector != nil {
+			// the namespaces are listed on the cluster the operator
+			// runs on.
+			return nil, fmt.Errorf("invalid pruner hosted cluster: namespaceSelector is not supported")
+		}
+	}
+	return overrides.Pruner, nil
+}
+
 func (gcj *generatorPrunerCronJob) getSuspend(cr *imageregistryapiv1.ImagePruner) *bool {
 	if cr.Spec.Suspend != nil {
 		return cr.Spec.Suspend
@@ -1,12 +1,22 @@
 package resource
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 
+	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
 func TestGetKeepYoungerThan(t *testing.T) {
@@ -90,3 +100,302 @@ func TestLogLevel(t *testing.T) {
 		}
 	}
 }
+
+func TestPrunerRegistryOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		overrides  string
+		args       []string
+		caBundleCM string
+		err        bool
+	}{
+		{
+			name: "internal registry",
+			args: []string{
+				"--certificate-authority=/var/run/configmaps/serviceca/service-ca.crt",
+				"--registry-url=https://image-registry.openshift-image-registry.svc:5000",
+			},
+		},
+		{
+			name:      "external route with custom ca",
+			overrides: `{"pruner":{"registryURL":"https://registry.apps.example.com","caBundleConfigMap":"registry-ca"}}`,
+			args: []string{
+				"--certificate-authority=/var/run/configmaps/registry-ca/ca-bundle.crt",
+				"--registry-url=https://registry.apps.example.com",
+			},
+			caBundleCM: "registry-ca",
+		},
+		{
+			name:      "insecure",
+			overrides: `{"pruner":{"registryURL":"http://registry.example.com","insecure":true}}`,
+			args: []string{
+				"--registry-url=http://registry.example.com",
+				"--force-insecure=true",
+			},
+		},
+		{
+			name:      "invalid url",
+			overrides: `{"pruner":{"registryURL":"registry.example.com"}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			registryConfig := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+			}
+			registryConfig.Spec.UnsupportedConfigOverrides.Raw = []byte(tc.overrides)
+			if err := indexer.Add(registryConfig); err != nil {
+				t.Fatal(err)
+			}
+			prunerIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := prunerIndexer.Add(&imageregistryv1.ImagePruner{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryImagePrunerResourceName},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			imageConfigIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := imageConfigIndexer.Add(&configv1.Image{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+				Status: configv1.ImageStatus{
+					InternalRegistryHostname: "image-registry.openshift-image-registry.svc:5000",
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			gcj := newGeneratorPrunerCronJob(
+				nil,
+				nil,
+				imageregistryv1listers.NewImagePrunerLister(prunerIndexer),
+				imageregistryv1listers.NewConfigLister(indexer),
+				configv1listers.NewImageLister(imageConfigIndexer),
+				nil,
+			)
+			obj, err := gcj.expected()
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			podSpec := obj.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec
+			args := strings.Join(podSpec.Containers[0].Args, " ")
+			for _, arg := range tc.args {
+				if !strings.Contains(args, arg) {
+					t.Errorf("expected argument %s, got %s", arg, args)
+				}
+			}
+
+			var caBundleCM string
+			for _, vol := range podSpec.Volumes {
+				if vol.Name == "registry-ca" {
+					caBundleCM = vol.ConfigMap.Name
+				}
+			}
+			if caBundleCM != tc.caBundleCM {
+				t.Errorf("got CA bundle config map %q, want %q", caBundleCM, tc.caBundleCM)
+			}
+		})
+	}
+}
+
+func TestPrunerNamespaceSelector(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		overrides  string
+		namespaces string
+		namespaced bool
+		err        bool
+	}{
+		{
+			name: "no selector",
+		},
+		{
+			name:       "excluded namespaces",
+			overrides:  `{"pruner":{"namespaceSelector":{"matchExpressions":[{"key":"imageregistry.openshift.io/prune","operator":"NotIn","values":["false"]}]}}}`,
+			namespaces: "ci default",
+			namespaced: true,
+		},
+		{
+			name:       "included namespaces",
+			overrides:  `{"pruner":{"namespaceSelector":{"matchLabels":{"team":"ci"}}}}`,
+			namespaces: "ci",
+			namespaced: true,
+		},
+		{
+			name:      "invalid selector",
+			overrides: `{"pruner":{"namespaceSelector":{"matchExpressions":[{"key":"team","operator":"Like"}]}}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			registryConfig := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+			}
+			registryConfig.Spec.UnsupportedConfigOverrides.Raw = []byte(tc.overrides)
+			if err := indexer.Add(registryConfig); err != nil {
+				t.Fatal(err)
+			}
+			prunerIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := prunerIndexer.Add(&imageregistryv1.ImagePruner{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryImagePrunerResourceName},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			imageConfigIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := imageConfigIndexer.Add(&configv1.Image{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			namespaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, ns := range []*corev1.Namespace{
+				{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "ci", Labels: map[string]string{"team": "ci"}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "releases", Labels: map[string]string{"imageregistry.openshift.io/prune": "false"}}},
+			} {
+				if err := namespaceIndexer.Add(ns); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gcj := newGeneratorPrunerCronJob(
+				nil,
+				nil,
+				imageregistryv1listers.NewImagePrunerLister(prunerIndexer),
+				imageregistryv1listers.NewConfigLister(indexer),
+				configv1listers.NewImageLister(imageConfigIndexer),
+				corelisters.NewNamespaceLister(namespaceIndexer),
+			)
+			obj, err := gcj.expected()
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			container := obj.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+			if namespaced := container.Args[1] == namespacedPruneScript; namespaced != tc.namespaced {
+				t.Errorf("got namespaced prune script %t, want %t", namespaced, tc.namespaced)
+			}
+			var namespaces string
+			for _, env := range container.Env {
+				if env.Name == "PRUNE_NAMESPACES" {
+					namespaces = env.Value
+				}
+			}
+			if namespaces != tc.namespaces {
+				t.Errorf("got namespaces %q, want %q", namespaces, tc.namespaces)
+			}
+		})
+	}
+}
+
+func TestPrunerHostedCluster(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		overrides string
+		secret    string
+		key       string
+		err       bool
+	}{
+		{
+			name:      "hosted cluster",
+			overrides: `{"pruner":{"registryURL":"https://registry.apps.guest.example.com","caBundleConfigMap":"guest-ca","hostedCluster":{"kubeconfigSecret":"guest-kubeconfig"}}}`,
+			secret:    "guest-kubeconfig",
+			key:       "kubeconfig",
+		},
+		{
+			name:      "custom key",
+			overrides: `{"pruner":{"registryURL":"https://registry.apps.guest.example.com","hostedCluster":{"kubeconfigSecret":"guest-kubeconfig","kubeconfigKey":"value"}}}`,
+			secret:    "guest-kubeconfig",
+			key:       "value",
+		},
+		{
+			name:      "no registry url",
+			overrides: `{"pruner":{"hostedCluster":{"kubeconfigSecret":"guest-kubeconfig"}}}`,
+			err:       true,
+		},
+		{
+			name:      "no secret",
+			overrides: `{"pruner":{"registryURL":"https://registry.apps.guest.example.com","hostedCluster":{}}}`,
+			err:       true,
+		},
+		{
+			name:      "namespace selector",
+			overrides: `{"pruner":{"registryURL":"https://registry.apps.guest.example.com","namespaceSelector":{"matchLabels":{"team":"ci"}},"hostedCluster":{"kubeconfigSecret":"guest-kubeconfig"}}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			registryConfig := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+			}
+			registryConfig.Spec.UnsupportedConfigOverrides.Raw = []byte(tc.overrides)
+			if err := indexer.Add(registryConfig); err != nil {
+				t.Fatal(err)
+			}
+			prunerIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := prunerIndexer.Add(&imageregistryv1.ImagePruner{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryImagePrunerResourceName},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			imageConfigIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := imageConfigIndexer.Add(&configv1.Image{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			gcj := newGeneratorPrunerCronJob(
+				nil,
+				nil,
+				imageregistryv1listers.NewImagePrunerLister(prunerIndexer),
+				imageregistryv1listers.NewConfigLister(indexer),
+				configv1listers.NewImageLister(imageConfigIndexer),
+				nil,
+			)
+			obj, err := gcj.expected()
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			podSpec := obj.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec
+			if podSpec.AutomountServiceAccountToken == nil || *podSpec.AutomountServiceAccountToken {
+				t.Errorf("expected the service account token not to be mounted")
+			}
+			var secret, key string
+			for _, vol := range podSpec.Volumes {
+				if vol.Secret != nil {
+					secret = vol.Secret.SecretName
+					key = vol.Secret.Items[0].Key
+				}
+			}
+			if secret != tc.secret || key != tc.key {
+				t.Errorf("got kubeconfig %s/%s, want %s/%s", secret, key, tc.secret, tc.key)
+			}
+			env := podSpec.Containers[0].Env
+			if len(env) != 1 || env[0].Name != "KUBECONFIG" || env[0].Value != "/etc/kubernetes/hosted-cluster/kubeconfig" {
+				t.Errorf("got env %v, want KUBECONFIG pointing to the hosted cluster kubeconfig", env)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package resource
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// Keys of the readiness config map.
+const (
+	// readinessReadyKey is "true" when the registry is available, not
+	// degraded and done rolling out, "false" otherwise.
+	readinessReadyKey = "ready"
+	// readinessReasonKey explains why the registry is not ready.
+	readinessReasonKey = "reason"
+	// readinessMessageKey holds the messages of the conditions that keep
+	// the registry from being ready.
+	readinessMessageKey = "message"
+	// readinessVersionKey is the version of the registry that is ready.
+	readinessVersionKey = "version"
+	// readinessSinceKey is the last transition time of the condition
+	// the readiness is derived from.
+	readinessSinceKey = "since"
+)
+
+var _ Mutator = &generatorReadiness{}
+
+// generatorReadiness publishes whether the registry is ready to serve images
+// in a well known config map, so operators depending on the registry can
+// watch a single object instead of polling the cluster operator status.
+type generatorReadiness struct {
+	lister       corelisters.ConfigMapNamespaceLister
+	client       coreset.CoreV1Interface
+	deployLister appslisters.DeploymentNamespaceLister
+	cr           *imageregistryv1.Config
+}
+
+func NewGeneratorReadiness(
+	lister corelisters.ConfigMapNamespaceLister,
+	client coreset.CoreV1Interface,
+	deployLister appslisters.DeploymentNamespaceLister,
+	cr *imageregistryv1.Config,
+) *generatorReadiness {
+	return &generatorReadiness{
+		lister:       lister,
+		client:       client,
+		deployLister: deployLister,
+		cr:           cr,
+	}
+}
+
+func (g *generatorReadiness) Type() runtime.Object {
+	return &corev1.ConfigMap{}
+}
+
+func (g *generatorReadiness) GetNamespace() string {
+	return defaults.OpenShiftConfigManagedNamespace
+}
+
+func (g *generatorReadiness) GetName() string {
+	return defaults.ReadinessConfigMapName
+}
+
+func (g *generatorReadiness) expected() (runtime.Object, error) {
+	data, err := g.readiness()
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      g.GetName(),
+			Namespace: g.GetNamespace(),
+		},
+		Data: data,
+	}, nil
+}
+
+// readiness derives the content of the config map from the conditions of
+// the registry config and from the registry deployment.
+func (g *generatorReadiness) readiness() (map[string]string, error) {
+	available := unionCondition("Available", operatorv1.ConditionTrue, g.cr.Status.Conditions)
+	degraded := unionCondition("Degraded", operatorv1.ConditionFalse, g.cr.Status.Conditions)
+
+	notReady := func(reason string, cond configv1.ClusterOperatorStatusCondition) map[string]string {
+		return map[string]string{
+			readinessReadyKey:   "false",
+			readinessReasonKey:  reason,
+			readinessMessageKey: cond.Message,
+			readinessSinceKey:   cond.LastTransitionTime.UTC().Format(time.RFC3339),
+		}
+	}
+
+	if g.cr.Spec.ManagementState == operatorv1.Removed {
+		return notReady("Removed", available), nil
+	}
+	if available.Status != configv1.ConditionTrue {
+		return notReady("NotAvailable", available), nil
+	}
+	if degraded.Status == configv1.ConditionTrue {
+		return notReady("Degraded", degraded), nil
+	}
+
+	version := ""
+	if g.cr.Spec.ManagementState == operatorv1.Managed {
+		deploy, err := g.deployLister.Get(defaults.ImageRegistryName)
+		if kerrors.IsNotFound(err) {
+			return notReady("NotDeployed", available), nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !isDeploymentStatusAvailableAndUpdated(deploy) {
+			progressing := unionCondition("Progressing", operatorv1.ConditionFalse, g.cr.Status.Conditions)
+			return notReady("RollingOut", progressing), nil
+		}
+		version = deploy.Annotations[defaults.VersionAnnotation]
+	}
+
+	return map[string]string{
+		readinessReadyKey:   "true",
+		readinessVersionKey: version,
+		readinessSinceKey:   available.LastTransitionTime.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (g *generatorReadiness) Get() (runtime.Object, error) {
+	return g.lister.Get(g.GetName())
+}
+
+func (g *generatorReadiness) Create() (runtime.Object, error) {
+	return commonCreate(g, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (g *generatorReadiness) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(g, o, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (g *generatorReadiness) Delete(opts metav1.DeleteOptions) error {
+	return g.client.ConfigMaps(g.GetNamespace()).Delete(
+		context.TODO(), g.GetName(), opts,
+	)
+}
+
+func (g *generatorReadiness) Owned() bool {
+	// the config map is kept when the registry is removed, it reports
+	// the registry as not ready.
+	return false
+}
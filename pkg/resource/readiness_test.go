@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imregv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestReadiness(t *testing.T) {
+	rolledOut := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{defaults.VersionAnnotation: "4.15.0"},
+		},
+		Status: appsv1.DeploymentStatus{AvailableReplicas: 2, UpdatedReplicas: 2, Replicas: 2},
+	}
+	rollingOut := rolledOut
+	rollingOut.Status.UpdatedReplicas = 1
+
+	available := operatorv1.OperatorCondition{Type: "Available", Status: operatorv1.ConditionTrue}
+	notAvailable := operatorv1.OperatorCondition{Type: "Available", Status: operatorv1.ConditionFalse, Reason: "NoReplicasAvailable", Message: "no replicas"}
+	degraded := operatorv1.OperatorCondition{Type: "Degraded", Status: operatorv1.ConditionTrue, Reason: "Unavailable", Message: "storage is broken"}
+
+	for _, tt := range []struct {
+		name            string
+		managementState operatorv1.ManagementState
+		conditions      []operatorv1.OperatorCondition
+		deploys         map[string]appsv1.Deployment
+		ready           string
+		reason          string
+		version         string
+	}{
+		{
+			name:            "ready",
+			managementState: operatorv1.Managed,
+			conditions:      []operatorv1.OperatorCondition{available},
+			deploys:         map[string]appsv1.Deployment{defaults.ImageRegistryName: rolledOut},
+			ready:           "true",
+			version:         "4.15.0",
+		},
+		{
+			name:            "rolling out",
+			managementState: operatorv1.Managed,
+			conditions:      []operatorv1.OperatorCondition{available},
+			deploys:         map[string]appsv1.Deployment{defaults.ImageRegistryName: rollingOut},
+			ready:           "false",
+			reason:          "RollingOut",
+		},
+		{
+			name:            "not available",
+			managementState: operatorv1.Managed,
+			conditions:      []operatorv1.OperatorCondition{notAvailable},
+			ready:           "false",
+			reason:          "NotAvailable",
+		},
+		{
+			name:            "degraded",
+			managementState: operatorv1.Managed,
+			conditions:      []operatorv1.OperatorCondition{available, degraded},
+			deploys:         map[string]appsv1.Deployment{defaults.ImageRegistryName: rolledOut},
+			ready:           "false",
+			reason:          "Degraded",
+		},
+		{
+			name:            "removed",
+			managementState: operatorv1.Removed,
+			conditions:      []operatorv1.OperatorCondition{available},
+			ready:           "false",
+			reason:          "Removed",
+		},
+		{
+			name:            "unmanaged",
+			managementState: operatorv1.Unmanaged,
+			conditions:      []operatorv1.OperatorCondition{available},
+			ready:           "true",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imregv1.Config{}
+			cr.Spec.ManagementState = tt.managementState
+			cr.Status.Conditions = tt.conditions
+
+			g := NewGeneratorReadiness(nil, nil, deployLister{deploys: tt.deploys}, cr)
+			data, err := g.readiness()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if data[readinessReadyKey] != tt.ready {
+				t.Errorf("got ready %q, want %q", data[readinessReadyKey], tt.ready)
+			}
+			if data[readinessReasonKey] != tt.reason {
+				t.Errorf("got reason %q, want %q", data[readinessReasonKey], tt.reason)
+			}
+			if data[readinessVersionKey] != tt.version {
+				t.Errorf("got version %q, want %q", data[readinessVersionKey], tt.version)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package resource
+
+import (
+	"fmt"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// rolloutBatch holds back registry rollouts for the debounce interval set by
+// the user, so changes of several inputs made in a short window are rolled
+// out at once.
+type rolloutBatch struct {
+	interval time.Duration
+	now      time.Time
+
+	// resyncAfter is how long until the held back rollout is due, zero if
+	// no rollout is held back.
+	resyncAfter time.Duration
+}
+
+// newRolloutBatch returns the rollout batching set in the unsupported config
+// overrides of cr, evaluated at now.
+func newRolloutBatch(cr *imageregistryv1.Config, now time.Time) (*rolloutBatch, error) {
+	b := &rolloutBatch{now: now}
+
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides.RolloutBatching == nil {
+		return b, nil
+	}
+
+	b.interval = overrides.RolloutBatching.DebounceInterval.Duration
+	if b.interval <= 0 {
+		return nil, fmt.Errorf("invalid rollout batching debounce interval %s: must be positive", b.interval)
+	}
+	return b, nil
+}
+
+// enabled returns true if rollouts are batched.
+func (b *rolloutBatch) enabled() bool {
+	return b != nil && b.interval > 0
+}
+
+// hold returns true if the rollout of a new pod template over current has to
+// wait for further changes, along with the time the first of the changes
+// was seen. The time recorded on current is left over from an earlier
+// batch, and ignored, once current runs another template than the one kept
+// back then.
+func (b *rolloutBatch) hold(current *appsapi.Deployment) (bool, time.Time) {
+	since, err := time.Parse(time.RFC3339, current.Annotations[defaults.RolloutPendingSinceAnnotation])
+	stale := current.Annotations[defaults.RolloutPendingTemplateAnnotation] != current.Annotations[defaults.ChecksumPodTemplateAnnotation]
+	if err != nil || stale || since.After(b.now) {
+		since = b.now
+	}
+
+	due := since.Add(b.interval)
+	if !b.now.Before(due) {
+		return false, since
+	}
+	b.resyncAfter = due.Sub(b.now)
+	return true, since
+}
@@ -0,0 +1,140 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestBatchRollout(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	newDeployment := func(dgst, version, pendingSince string) *appsapi.Deployment {
+		deploy := &appsapi.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.ImageRegistryName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+				Annotations: map[string]string{
+					defaults.ChecksumPodTemplateAnnotation: dgst,
+					defaults.VersionAnnotation:             version,
+				},
+			},
+		}
+		deploy.Spec.Template.Spec.Containers = []corev1.Container{{Name: "registry", Image: dgst}}
+		if pendingSince != "" {
+			deploy.Annotations[defaults.RolloutPendingSinceAnnotation] = pendingSince
+			deploy.Annotations[defaults.RolloutPendingTemplateAnnotation] = dgst
+		}
+		return deploy
+	}
+
+	for _, tt := range []struct {
+		name        string
+		current     *appsapi.Deployment
+		expected    *appsapi.Deployment
+		held        bool
+		resyncAfter time.Duration
+	}{
+		{
+			name:     "unchanged template",
+			current:  newDeployment("a", "4.14", ""),
+			expected: newDeployment("a", "4.14", ""),
+		},
+		{
+			name:        "first change",
+			current:     newDeployment("a", "4.14", ""),
+			expected:    newDeployment("b", "4.14", ""),
+			held:        true,
+			resyncAfter: 5 * time.Minute,
+		},
+		{
+			name:        "further change within the interval",
+			current:     newDeployment("a", "4.14", now.Add(-2*time.Minute).Format(time.RFC3339)),
+			expected:    newDeployment("c", "4.14", ""),
+			held:        true,
+			resyncAfter: 3 * time.Minute,
+		},
+		{
+			name:     "interval elapsed",
+			current:  newDeployment("a", "4.14", now.Add(-5*time.Minute).Format(time.RFC3339)),
+			expected: newDeployment("c", "4.14", ""),
+		},
+		{
+			name: "left over from an earlier batch",
+			current: func() *appsapi.Deployment {
+				d := newDeployment("b", "4.14", now.Add(-time.Hour).Format(time.RFC3339))
+				d.Annotations[defaults.RolloutPendingTemplateAnnotation] = "a"
+				return d
+			}(),
+			expected:    newDeployment("c", "4.14", ""),
+			held:        true,
+			resyncAfter: 5 * time.Minute,
+		},
+		{
+			name:     "upgrade",
+			current:  newDeployment("a", "4.13", ""),
+			expected: newDeployment("b", "4.14", ""),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := indexer.Add(tt.current); err != nil {
+				t.Fatal(err)
+			}
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"rolloutBatching":{"debounceInterval":"5m"}}`)
+			b, err := newRolloutBatch(cr, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gd := &generatorDeployment{
+				lister: appslisters.NewDeploymentLister(indexer).Deployments(defaults.ImageRegistryOperatorNamespace),
+				batch:  b,
+			}
+			deploy := tt.expected.DeepCopy()
+			if err := gd.batchRollout(deploy); err != nil {
+				t.Fatal(err)
+			}
+
+			wantImage := tt.expected.Spec.Template.Spec.Containers[0].Image
+			if tt.held {
+				wantImage = tt.current.Spec.Template.Spec.Containers[0].Image
+			}
+			if got := deploy.Spec.Template.Spec.Containers[0].Image; got != wantImage {
+				t.Errorf("got pod template %s, want %s", got, wantImage)
+			}
+			for k := range deploy.Annotations {
+				if strings.HasSuffix(k, "-") {
+					t.Errorf("got invalid annotation %q", k)
+				}
+			}
+			pendingTemplate := deploy.Annotations[defaults.RolloutPendingTemplateAnnotation]
+			if pending := pendingTemplate != "" && pendingTemplate == deploy.Annotations[defaults.ChecksumPodTemplateAnnotation]; pending != tt.held {
+				t.Errorf("got pending annotation %t, want %t", pending, tt.held)
+			}
+			if b.resyncAfter != tt.resyncAfter {
+				t.Errorf("got resync after %s, want %s", b.resyncAfter, tt.resyncAfter)
+			}
+		})
+	}
+}
+
+func TestNewRolloutBatchInvalidInterval(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"rolloutBatching":{"debounceInterval":"0s"}}`)
+	if _, err := newRolloutBatch(cr, time.Now()); err == nil {
+		t.Errorf("expected an error for a zero debounce interval")
+	}
+}
@@ -2,6 +2,9 @@ package resource
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -17,6 +20,10 @@ import (
 
 const RouteOwnerAnnotation = "imageregistry.openshift.io"
 
+// RouteIPWhitelistAnnotation restricts the source addresses the router
+// accepts connections from for a route.
+const RouteIPWhitelistAnnotation = "haproxy.router.openshift.io/ip_whitelist"
+
 func RouteIsCreatedByOperator(route *routeapi.Route) bool {
 	_, ok := route.Annotations[RouteOwnerAnnotation]
 	return ok
@@ -31,6 +38,7 @@ type generatorRoute struct {
 	namespace    string
 	serviceName  string
 	route        imageregistryv1.ImageRegistryConfigRoute
+	cr           *imageregistryv1.Config
 }
 
 func newGeneratorRoute(lister routelisters.RouteNamespaceLister, secretLister corelisters.SecretNamespaceLister, client routeset.RouteV1Interface, cr *imageregistryv1.Config, route imageregistryv1.ImageRegistryConfigRoute) *generatorRoute {
@@ -41,6 +49,7 @@ func newGeneratorRoute(lister routelisters.RouteNamespaceLister, secretLister co
 		namespace:    defaults.ImageRegistryOperatorNamespace,
 		serviceName:  defaults.ServiceName,
 		route:        route,
+		cr:           cr,
 	}
 }
 
@@ -72,6 +81,18 @@ func (gr *generatorRoute) expected() (runtime.Object, error) {
 		},
 	}
 
+	overrides, err := GetConfigOverrides(gr.cr)
+	if err != nil {
+		return nil, err
+	}
+	if whitelist := overrides.Routes[gr.GetName()].IPWhitelist; len(whitelist) > 0 {
+		value, err := ipWhitelistAnnotationValue(whitelist)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip whitelist for route %s: %w", gr.GetName(), err)
+		}
+		r.Annotations[RouteIPWhitelistAnnotation] = value
+	}
+
 	r.Spec.TLS = &routeapi.TLSConfig{}
 	r.Spec.TLS.Termination = routeapi.TLSTerminationReencrypt
 
@@ -93,6 +114,21 @@ func (gr *generatorRoute) expected() (runtime.Object, error) {
 	return r, nil
 }
 
+// ipWhitelistAnnotationValue validates the provided addresses and returns
+// them in the format expected by the router.
+func ipWhitelistAnnotationValue(whitelist []string) (string, error) {
+	for _, entry := range whitelist {
+		if _, _, err := net.ParseCIDR(entry); err == nil {
+			continue
+		}
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		return "", fmt.Errorf("%q is neither an IP address nor a CIDR range", entry)
+	}
+	return strings.Join(whitelist, " "), nil
+}
+
 func (gr *generatorRoute) Get() (runtime.Object, error) {
 	return gr.lister.Get(gr.GetName())
 }
@@ -0,0 +1,69 @@
+package resource
+
+import (
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	routeapi "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestRouteIPWhitelist(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		route     string
+		overrides string
+		whitelist string
+		err       bool
+	}{
+		{
+			name:  "no overrides",
+			route: defaults.RouteName,
+		},
+		{
+			name:      "default route",
+			route:     defaults.RouteName,
+			overrides: `{"routes":{"default-route":{"ipWhitelist":["10.0.0.0/8","192.168.1.10","fd00::/8"]}}}`,
+			whitelist: "10.0.0.0/8 192.168.1.10 fd00::/8",
+		},
+		{
+			name:      "other route",
+			route:     "public",
+			overrides: `{"routes":{"default-route":{"ipWhitelist":["10.0.0.0/8"]}}}`,
+		},
+		{
+			name:      "invalid cidr",
+			route:     defaults.RouteName,
+			overrides: `{"routes":{"default-route":{"ipWhitelist":["10.0.0.0/33"]}}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			if tt.overrides != "" {
+				cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			}
+			gr := newGeneratorRoute(nil, nil, nil, cr, imageregistryv1.ImageRegistryConfigRoute{Name: tt.route})
+
+			obj, err := gr.expected()
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			whitelist, ok := obj.(*routeapi.Route).Annotations[RouteIPWhitelistAnnotation]
+			if tt.whitelist == "" && ok {
+				t.Errorf("unexpected ip whitelist annotation %q", whitelist)
+			}
+			if whitelist != tt.whitelist {
+				t.Errorf("got ip whitelist %q, want %q", whitelist, tt.whitelist)
+			}
+		})
+	}
+}
@@ -3,14 +3,17 @@ package resource
 import (
 	"context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 )
 
@@ -22,6 +25,7 @@ type generatorSecret struct {
 	driver    storage.Driver
 	name      string
 	namespace string
+	now       func() time.Time
 }
 
 func newGeneratorSecret(lister corelisters.SecretNamespaceLister, client coreset.CoreV1Interface, driver storage.Driver) *generatorSecret {
@@ -31,6 +35,7 @@ func newGeneratorSecret(lister corelisters.SecretNamespaceLister, client coreset
 		driver:    driver,
 		name:      defaults.ImageRegistryPrivateConfiguration,
 		namespace: defaults.ImageRegistryOperatorNamespace,
+		now:       time.Now,
 	}
 }
 
@@ -79,6 +84,25 @@ func (gs *generatorSecret) expected() (runtime.Object, error) {
 
 	sec.StringData = data
 
+	// the rotation of the credentials is tracked by their checksum, so
+	// the time they last changed survives unrelated writes to the secret.
+	sum, err := strategy.Checksum(data)
+	if err != nil {
+		return nil, err
+	}
+	rotated := gs.now().UTC().Format(time.RFC3339)
+	current, err := gs.lister.Get(gs.GetName())
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if current != nil && current.Annotations[defaults.StorageCredentialsChecksumAnnotation] == sum && current.Annotations[defaults.StorageCredentialsRotatedAnnotation] != "" {
+		rotated = current.Annotations[defaults.StorageCredentialsRotatedAnnotation]
+	}
+	sec.Annotations = map[string]string{
+		defaults.StorageCredentialsChecksumAnnotation: sum,
+		defaults.StorageCredentialsRotatedAnnotation:  rotated,
+	}
+
 	return sec, nil
 }
 
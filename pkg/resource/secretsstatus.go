@@ -0,0 +1,329 @@
+package resource
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// secretsCondition reports whether the secrets the registry runs with are
+// valid, their rotation status is published in the
+// defaults.SecretsStatusConfigMapName config map.
+const secretsCondition = "Secrets"
+
+// SecretStatus describes the rotation of a secret of the registry.
+type SecretStatus struct {
+	// Name is the name of the secret, or the field holding it.
+	Name string `json:"name"`
+	// Kind is what the secret holds.
+	Kind string `json:"kind"`
+	// Created is when the secret was created, it gives its age.
+	Created *metav1.Time `json:"created,omitempty"`
+	// LastRotation is when the secret was last replaced, nil if unknown.
+	LastRotation *metav1.Time `json:"lastRotation,omitempty"`
+	// NextRotation is when the secret is due to be replaced, nil unless
+	// it is rotated on a schedule.
+	NextRotation *metav1.Time `json:"nextRotation,omitempty"`
+	// Expiry is when the secret stops being valid, if known.
+	Expiry *metav1.Time `json:"expiry,omitempty"`
+	// Rotation explains how the secret is rotated.
+	Rotation string `json:"rotation"`
+}
+
+// annotationTime returns the time held by the annotation key, nil if it is
+// not set or invalid.
+func annotationTime(annotations map[string]string, key string) *metav1.Time {
+	t, err := time.Parse(time.RFC3339, annotations[key])
+	if err != nil {
+		return nil
+	}
+	return &metav1.Time{Time: t}
+}
+
+// creationTime returns the creation time of an object, nil if unknown.
+func creationTime(meta metav1.ObjectMeta) *metav1.Time {
+	if meta.CreationTimestamp.IsZero() {
+		return nil
+	}
+	created := meta.CreationTimestamp
+	return &created
+}
+
+// httpSecretStatus describes the HTTP secret of the registry config. It was
+// generated along with the registry config unless the operator generated it
+// again since.
+func httpSecretStatus(cr *imageregistryv1.Config) SecretStatus {
+	status := SecretStatus{
+		Name:     "spec.httpSecret",
+		Kind:     "HTTP secret",
+		Created:  creationTime(cr.ObjectMeta),
+		Rotation: "rotated by clearing spec.httpSecret, the operator generates a new one",
+	}
+	status.LastRotation = annotationTime(cr.Annotations, defaults.HTTPSecretGeneratedAnnotation)
+	if status.LastRotation == nil {
+		status.LastRotation = status.Created
+	}
+	return status
+}
+
+// servingCertificateStatus describes the serving certificate of the
+// registry, issued and renewed by the service CA operator.
+func servingCertificateStatus(secretLister corelisters.SecretNamespaceLister) (SecretStatus, error) {
+	status := SecretStatus{
+		Name:     defaults.ImageRegistryName + "-tls",
+		Kind:     "serving certificate",
+		Rotation: "renewed by the service CA operator before it expires",
+	}
+	sec, err := secretLister.Get(status.Name)
+	if errors.IsNotFound(err) {
+		status.Rotation = "not issued yet by the service CA operator"
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+	status.Created = creationTime(sec.ObjectMeta)
+
+	block, _ := pem.Decode(sec.Data["tls.crt"])
+	if block == nil {
+		status.Rotation = "no certificate found in the secret, it is reissued by the service CA operator"
+		return status, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		status.Rotation = fmt.Sprintf("unable to parse the certificate: %s", err)
+		return status, nil
+	}
+	status.LastRotation = &metav1.Time{Time: cert.NotBefore}
+	status.Expiry = &metav1.Time{Time: cert.NotAfter}
+	return status, nil
+}
+
+// storageCredentialsStatus describes the storage credentials, nil if the
+// storage does not use credentials held in a secret. The credentials are
+// rotated when the operator copies new ones into the
+// defaults.ImageRegistryPrivateConfiguration secret the registry reads.
+func storageCredentialsStatus(driver storage.Driver, secretLister corelisters.SecretNamespaceLister) (*SecretStatus, error) {
+	reporter, ok := driver.(storage.CredentialsReporter)
+	if !ok {
+		return nil, nil
+	}
+	source, err := reporter.CredentialsSource()
+	if err != nil {
+		return nil, err
+	}
+	if source.Secret == "" {
+		return nil, nil
+	}
+
+	status := &SecretStatus{
+		Name:     source.Secret,
+		Kind:     fmt.Sprintf("storage credentials, %s", source.Mode),
+		Rotation: "rotated by the cloud credential operator",
+	}
+	if source.Mode == util.CredentialsModeUserProvided {
+		status.Rotation = "rotated by updating the secret"
+	}
+	if source.Expiry != nil {
+		status.Expiry = &metav1.Time{Time: *source.Expiry}
+	}
+
+	sec, err := secretLister.Get(source.Secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if sec != nil {
+		status.Created = creationTime(sec.ObjectMeta)
+	}
+	private, err := secretLister.Get(defaults.ImageRegistryPrivateConfiguration)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if private != nil {
+		status.LastRotation = annotationTime(private.Annotations, defaults.StorageCredentialsRotatedAnnotation)
+	}
+	return status, nil
+}
+
+// swiftTempURLKeyStatus describes the Swift temporary URL key, nil if it is
+// not managed by the operator.
+func swiftTempURLKeyStatus(cr *imageregistryv1.Config, secretLister corelisters.SecretNamespaceLister) (*SecretStatus, error) {
+	enabled, overrides, err := swiftTempURLEnabled(cr)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	status := &SecretStatus{
+		Name:     defaults.SwiftTempURLKeySecretName,
+		Kind:     "Swift temporary URL key",
+		Rotation: "not rotated automatically, set a rotation interval to rotate it",
+	}
+	sec, err := secretLister.Get(status.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if sec != nil {
+		status.Created = creationTime(sec.ObjectMeta)
+		status.LastRotation = annotationTime(sec.Annotations, defaults.SwiftTempURLKeyRotatedAnnotation)
+	}
+	if overrides.RotationInterval != nil && overrides.RotationInterval.Duration > 0 {
+		status.Rotation = fmt.Sprintf("rotated every %s in the maintenance window", overrides.RotationInterval.Duration)
+		if status.LastRotation != nil {
+			next := metav1.NewTime(status.LastRotation.Add(overrides.RotationInterval.Duration))
+			status.NextRotation = &next
+		}
+	}
+	return status, nil
+}
+
+// getSecretStatuses returns the rotation status of the secrets the registry
+// runs with.
+func getSecretStatuses(cr *imageregistryv1.Config, driver storage.Driver, secretLister corelisters.SecretNamespaceLister) ([]SecretStatus, error) {
+	statuses := []SecretStatus{httpSecretStatus(cr)}
+
+	serving, err := servingCertificateStatus(secretLister)
+	if err != nil {
+		return nil, err
+	}
+	statuses = append(statuses, serving)
+
+	for _, get := range []func() (*SecretStatus, error){
+		func() (*SecretStatus, error) { return storageCredentialsStatus(driver, secretLister) },
+		func() (*SecretStatus, error) { return swiftTempURLKeyStatus(cr, secretLister) },
+	} {
+		status, err := get()
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			statuses = append(statuses, *status)
+		}
+	}
+	return statuses, nil
+}
+
+// syncSecretsCondition reports whether the secrets the registry runs with
+// are valid. The condition is false when one of them expired.
+func syncSecretsCondition(cr *imageregistryv1.Config, statuses []SecretStatus, now time.Time) {
+	cond := operatorv1.OperatorCondition{
+		Type:    secretsCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: fmt.Sprintf("The rotation status of the registry secrets is published in the config map %s/%s.", defaults.ImageRegistryOperatorNamespace, defaults.SecretsStatusConfigMapName),
+	}
+	var expired []string
+	for _, status := range statuses {
+		if status.Expiry != nil && !now.Before(status.Expiry.Time) {
+			expired = append(expired, status.Name)
+		}
+	}
+	if len(expired) > 0 {
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "Expired"
+		cond.Message = fmt.Sprintf("Expired secrets: %s. %s", strings.Join(expired, ", "), cond.Message)
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+}
+
+var _ Mutator = &generatorSecretsStatus{}
+
+// generatorSecretsStatus publishes the rotation status of the secrets the
+// registry runs with in a config map, giving a single place to review their
+// hygiene.
+type generatorSecretsStatus struct {
+	lister       corelisters.ConfigMapNamespaceLister
+	client       coreset.CoreV1Interface
+	secretLister corelisters.SecretNamespaceLister
+	cr           *imageregistryv1.Config
+	driver       storage.Driver
+}
+
+func newGeneratorSecretsStatus(lister corelisters.ConfigMapNamespaceLister, client coreset.CoreV1Interface, secretLister corelisters.SecretNamespaceLister, cr *imageregistryv1.Config, driver storage.Driver) *generatorSecretsStatus {
+	return &generatorSecretsStatus{
+		lister:       lister,
+		client:       client,
+		secretLister: secretLister,
+		cr:           cr,
+		driver:       driver,
+	}
+}
+
+func (g *generatorSecretsStatus) Type() runtime.Object {
+	return &corev1.ConfigMap{}
+}
+
+func (g *generatorSecretsStatus) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (g *generatorSecretsStatus) GetName() string {
+	return defaults.SecretsStatusConfigMapName
+}
+
+func (g *generatorSecretsStatus) expected() (runtime.Object, error) {
+	statuses, err := getSecretStatuses(g.cr, g.driver, g.secretLister)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      g.GetName(),
+			Namespace: g.GetNamespace(),
+		},
+		Data: map[string]string{
+			defaults.SecretsStatusKey: string(buf),
+		},
+	}, nil
+}
+
+func (g *generatorSecretsStatus) Get() (runtime.Object, error) {
+	return g.lister.Get(g.GetName())
+}
+
+func (g *generatorSecretsStatus) Create() (runtime.Object, error) {
+	return commonCreate(g, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (g *generatorSecretsStatus) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(g, o, func(obj runtime.Object) (runtime.Object, error) {
+		return g.client.ConfigMaps(g.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.ConfigMap), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (g *generatorSecretsStatus) Delete(opts metav1.DeleteOptions) error {
+	return g.client.ConfigMaps(g.GetNamespace()).Delete(
+		context.TODO(), g.GetName(), opts,
+	)
+}
+
+func (g *generatorSecretsStatus) Owned() bool {
+	return true
+}
@@ -0,0 +1,205 @@
+package resource
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func servingCertificate(t *testing.T, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "image-registry.openshift-image-registry.svc"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestSyncSecretsCondition(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	issued := now.Add(-10 * 24 * time.Hour)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secretLister := corelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace)
+	tlsSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryName + "-tls",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{"tls.crt": servingCertificate(t, issued, issued.Add(365*24*time.Hour))},
+	}
+	if err := indexer.Add(tlsSecret); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.SwiftTempURLKeySecretName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SwiftTempURLKeyRotatedAnnotation: now.Add(-2 * time.Hour).Format(time.RFC3339),
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.NewTime(now.Add(-30 * 24 * time.Hour)),
+			Annotations: map[string]string{
+				defaults.HTTPSecretGeneratedAnnotation: now.Add(-24 * time.Hour).Format(time.RFC3339),
+			},
+		},
+	}
+	cr.Spec.Storage.Swift = &imageregistryv1.ImageRegistryConfigStorageSwift{}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"storage":{"swift":{"tempURL":{"enabled":true,"rotationInterval":"168h"}}}}`)
+
+	statuses, err := getSecretStatuses(cr, nil, secretLister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`{"name":"spec.httpSecret","kind":"HTTP secret","created":"2024-04-20T12:00:00Z","lastRotation":"2024-05-19T12:00:00Z","rotation":`,
+		`{"name":"image-registry-tls","kind":"serving certificate","lastRotation":"2024-05-10T12:00:00Z","expiry":"2025-05-10T12:00:00Z","rotation":`,
+		`{"name":"image-registry-swift-temp-url-key","kind":"Swift temporary URL key","lastRotation":"2024-05-20T10:00:00Z","nextRotation":"2024-05-27T10:00:00Z","rotation":`,
+	} {
+		if !strings.Contains(string(buf), expected) {
+			t.Errorf("got statuses %s, want them to contain %s", buf, expected)
+		}
+	}
+
+	syncSecretsCondition(cr, statuses, now)
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, secretsCondition)
+	if cond == nil || cond.Status != operatorv1.ConditionTrue {
+		t.Fatalf("got condition %#v, want it to be true", cond)
+	}
+
+	syncSecretsCondition(cr, statuses, issued.Add(400*24*time.Hour))
+	cond = v1helpers.FindOperatorCondition(cr.Status.Conditions, secretsCondition)
+	if cond == nil || cond.Status != operatorv1.ConditionFalse || cond.Reason != "Expired" || !strings.HasPrefix(cond.Message, "Expired secrets: image-registry-tls.") {
+		t.Errorf("got condition %#v, want the serving certificate to be reported as expired", cond)
+	}
+}
+
+func TestHTTPSecretStatusWithoutAnnotation(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cr := &imageregistryv1.Config{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+	status := httpSecretStatus(cr)
+	if status.LastRotation == nil || !status.LastRotation.Time.Equal(created) {
+		t.Errorf("got last rotation %v, want the creation of the registry config %v", status.LastRotation, created)
+	}
+}
+
+// credentialsDriver is a storage driver whose credentials are held in the
+// secret provided by the user.
+type credentialsDriver struct {
+	storage.Driver
+	accessKey string
+}
+
+func (d *credentialsDriver) ConfigEnv() (envvar.List, error) {
+	return envvar.List{{Name: "REGISTRY_STORAGE_S3_ACCESSKEY", Value: d.accessKey, Secret: true}}, nil
+}
+
+func (d *credentialsDriver) VolumeSecrets() (map[string]string, error) {
+	return nil, nil
+}
+
+func (d *credentialsDriver) CredentialsSource() (util.CredentialsSource, error) {
+	return util.CredentialsSource{
+		Mode:   util.CredentialsModeUserProvided,
+		Secret: defaults.ImageRegistryPrivateConfigurationUser,
+	}, nil
+}
+
+func TestStorageCredentialsRotation(t *testing.T) {
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secretLister := corelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace)
+	if err := indexer.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              defaults.ImageRegistryPrivateConfigurationUser,
+			Namespace:         defaults.ImageRegistryOperatorNamespace,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	driver := &credentialsDriver{accessKey: "first"}
+	gen := newGeneratorSecret(secretLister, nil, driver)
+
+	// apply writes the secret the generator expects at the given time.
+	apply := func(now time.Time) *corev1.Secret {
+		gen.now = func() time.Time { return now }
+		o, err := gen.expected()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sec := o.(*corev1.Secret)
+		// unrelated writes to the secret must not count as rotations
+		sec.ManagedFields = []metav1.ManagedFieldsEntry{{Time: &metav1.Time{Time: now}}}
+		if err := indexer.Update(sec); err != nil {
+			t.Fatal(err)
+		}
+		return sec
+	}
+
+	apply(created.Add(time.Hour))
+	apply(created.Add(2 * time.Hour))
+	status, err := storageCredentialsStatus(driver, secretLister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Created == nil || !status.Created.Time.Equal(created) {
+		t.Errorf("got created %v, want %s", status.Created, created)
+	}
+	if status.LastRotation == nil || !status.LastRotation.Time.Equal(created.Add(time.Hour)) {
+		t.Errorf("got last rotation %v, want %s", status.LastRotation, created.Add(time.Hour))
+	}
+
+	driver.accessKey = "second"
+	apply(created.Add(3 * time.Hour))
+	status, err = storageCredentialsStatus(driver, secretLister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastRotation == nil || !status.LastRotation.Time.Equal(created.Add(3*time.Hour)) {
+		t.Errorf("got last rotation %v, want %s", status.LastRotation, created.Add(3*time.Hour))
+	}
+}
@@ -3,14 +3,20 @@ package resource
 import (
 	"context"
 	"fmt"
+	"net"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
 
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 )
@@ -18,27 +24,128 @@ import (
 var _ Mutator = &generatorService{}
 
 type generatorService struct {
-	lister     corelisters.ServiceNamespaceLister
-	client     coreset.CoreV1Interface
-	name       string
-	namespace  string
-	labels     map[string]string
-	port       int
-	secretName string
+	lister      corelisters.ServiceNamespaceLister
+	client      coreset.CoreV1Interface
+	name        string
+	namespace   string
+	labels      map[string]string
+	port        int
+	secretName  string
+	annotations map[string]string
+	clusterIP   string
+
+	// selector selects the pods behind the Service, the ones with labels
+	// if it is nil.
+	selector map[string]string
 }
 
-func newGeneratorService(lister corelisters.ServiceNamespaceLister, client coreset.CoreV1Interface) *generatorService {
+func newGeneratorService(lister corelisters.ServiceNamespaceLister, client coreset.CoreV1Interface, port int) *generatorService {
 	return &generatorService{
 		lister:     lister,
 		client:     client,
 		name:       defaults.ServiceName,
 		namespace:  defaults.ImageRegistryOperatorNamespace,
 		labels:     defaults.DeploymentLabels,
-		port:       defaults.ContainerPort,
+		port:       port,
 		secretName: defaults.ImageRegistryName + "-tls",
 	}
 }
 
+// internalHostnameLabels are the labels of the alias Services.
+var internalHostnameLabels = map[string]string{"docker-registry": "internal-hostname"}
+
+// newGeneratorAliasService returns a generator for a Service that makes the
+// registry reachable under an additional internal hostname.
+func newGeneratorAliasService(lister corelisters.ServiceNamespaceLister, client coreset.CoreV1Interface, port int, name string) *generatorService {
+	gs := newGeneratorService(lister, client, port)
+	gs.name = name
+	// aliases are labelled apart from the main Service so that the
+	// ServiceMonitor does not scrape the registry pods once per alias.
+	gs.labels = internalHostnameLabels
+	gs.selector = defaults.DeploymentLabels
+	// the registry can only serve the certificate issued for the main
+	// Service, no certificate is requested for aliases.
+	gs.secretName = ""
+	gs.annotations = map[string]string{
+		defaults.InternalHostnameAnnotation: "true",
+	}
+	return gs
+}
+
+// ServiceIsInternalHostname returns true if the Service was created by the
+// operator as an alias of the registry hostname.
+func ServiceIsInternalHostname(svc *corev1.Service) bool {
+	_, ok := svc.Annotations[defaults.InternalHostnameAnnotation]
+	return ok
+}
+
+// getInternalHostnames returns the names of the alias Services requested by
+// the user.
+func getInternalHostnames(cr *imageregistryv1.Config) ([]string, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range overrides.InternalHostnames {
+		if errs := validation.IsDNS1035Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid internal hostname %q: %s", name, strings.Join(errs, ", "))
+		}
+		if name == defaults.ServiceName {
+			return nil, fmt.Errorf("invalid internal hostname %q: the name is used by the operator", name)
+		}
+	}
+	return overrides.InternalHostnames, nil
+}
+
+// getServiceClusterIP returns the cluster IP requested by the user for the
+// registry Service, corev1.ClusterIPNone for a headless Service.
+func getServiceClusterIP(cr *imageregistryv1.Config) (string, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return "", err
+	}
+	if overrides.Service == nil || overrides.Service.ClusterIP == "" {
+		return "", nil
+	}
+	clusterIP := overrides.Service.ClusterIP
+	if clusterIP != corev1.ClusterIPNone && net.ParseIP(clusterIP) == nil {
+		return "", fmt.Errorf("invalid service cluster IP %q: must be an IP address or %q", clusterIP, corev1.ClusterIPNone)
+	}
+	return clusterIP, nil
+}
+
+// clusterIPChanged returns true if the cluster IP of the Service differs
+// from the requested one. The cluster IP cannot be updated, the Service has
+// to be recreated.
+func clusterIPChanged(svc *corev1.Service, clusterIP string) bool {
+	if clusterIP == "" {
+		return svc.Spec.ClusterIP == corev1.ClusterIPNone
+	}
+	return svc.Spec.ClusterIP != clusterIP
+}
+
+// Bounds for the registry port, the registry runs as an unprivileged user
+// and cannot bind to privileged ports.
+const (
+	minRegistryPort = 1024
+	maxRegistryPort = 65535
+)
+
+// getRegistryPort returns the port the registry listens on.
+func getRegistryPort(cr *imageregistryv1.Config) (int, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return 0, err
+	}
+	if overrides.Port == 0 {
+		return defaults.ContainerPort, nil
+	}
+	if overrides.Port < minRegistryPort || overrides.Port > maxRegistryPort {
+		return 0, fmt.Errorf("invalid port %d: must be between %d and %d", overrides.Port, minRegistryPort, maxRegistryPort)
+	}
+	return int(overrides.Port), nil
+}
+
 func (gs *generatorService) Type() runtime.Object {
 	return &corev1.Service{}
 }
@@ -52,6 +159,10 @@ func (gs *generatorService) GetName() string {
 }
 
 func (gs *generatorService) expected() *corev1.Service {
+	selector := gs.selector
+	if selector == nil {
+		selector = gs.labels
+	}
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      gs.GetName(),
@@ -59,20 +170,31 @@ func (gs *generatorService) expected() *corev1.Service {
 			Labels:    gs.labels,
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: gs.labels,
+			Selector: selector,
 			Ports: []corev1.ServicePort{
 				{
-					Name:       fmt.Sprintf("%d-tcp", gs.port),
+					// the name is kept when the port is changed,
+					// the ServiceMonitor selects the port by name.
+					Name:       fmt.Sprintf("%d-tcp", defaults.ContainerPort),
 					Port:       int32(gs.port),
 					Protocol:   "TCP",
 					TargetPort: intstr.FromInt(gs.port),
 				},
 			},
+			ClusterIP: gs.clusterIP,
 		},
 	}
 
-	svc.ObjectMeta.Annotations = map[string]string{
-		"service.alpha.openshift.io/serving-cert-secret-name": gs.secretName,
+	if gs.secretName != "" {
+		svc.ObjectMeta.Annotations = map[string]string{
+			"service.alpha.openshift.io/serving-cert-secret-name": gs.secretName,
+		}
+	}
+	for k, v := range gs.annotations {
+		if svc.ObjectMeta.Annotations == nil {
+			svc.ObjectMeta.Annotations = map[string]string{}
+		}
+		svc.ObjectMeta.Annotations[k] = v
 	}
 
 	return svc
@@ -98,6 +220,14 @@ func (gs *generatorService) Create() (runtime.Object, error) {
 
 func (gs *generatorService) Update(o runtime.Object) (runtime.Object, bool, error) {
 	svc := o.(*corev1.Service)
+	if clusterIPChanged(svc, gs.clusterIP) {
+		if err := gs.Delete(metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return o, false, err
+		}
+		u, err := gs.Create()
+		return u, true, err
+	}
+
 	n := gs.expected()
 
 	updated, err := strategy.Service(svc, n)
@@ -0,0 +1,167 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestAliasService(t *testing.T) {
+	svc := newGeneratorAliasService(nil, nil, defaults.ContainerPort, "docker-registry").expected()
+	if svc.Name != "docker-registry" {
+		t.Errorf("got name %q, want %q", svc.Name, "docker-registry")
+	}
+	if !ServiceIsInternalHostname(svc) {
+		t.Errorf("expected the service to be marked as an internal hostname")
+	}
+	if _, ok := svc.Annotations["service.alpha.openshift.io/serving-cert-secret-name"]; ok {
+		t.Errorf("expected no serving certificate to be requested for an alias")
+	}
+	if !reflect.DeepEqual(svc.Spec.Selector, defaults.DeploymentLabels) {
+		t.Errorf("got selector %v, want %v", svc.Spec.Selector, defaults.DeploymentLabels)
+	}
+	if svc.Labels["docker-registry"] == defaults.DeploymentLabels["docker-registry"] {
+		t.Errorf("got labels %v, want them to differ from the main service labels", svc.Labels)
+	}
+	if ServiceIsInternalHostname(newGeneratorService(nil, nil, defaults.ContainerPort).expected()) {
+		t.Errorf("expected the main service not to be marked as an internal hostname")
+	}
+}
+
+func TestGetInternalHostnames(t *testing.T) {
+	for _, tt := range []struct {
+		overrides string
+		expected  []string
+		err       bool
+	}{
+		{
+			overrides: `{}`,
+		},
+		{
+			overrides: `{"internalHostnames":["docker-registry","registry"]}`,
+			expected:  []string{"docker-registry", "registry"},
+		},
+		{
+			overrides: `{"internalHostnames":["docker_registry"]}`,
+			err:       true,
+		},
+		{
+			overrides: `{"internalHostnames":["image-registry"]}`,
+			err:       true,
+		},
+	} {
+		cr := &imageregistryv1.Config{}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+		got, err := getInternalHostnames(cr)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", tt.overrides)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.overrides, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.overrides, got, tt.expected)
+		}
+	}
+}
+
+func TestServicePort(t *testing.T) {
+	svc := newGeneratorService(nil, nil, 8443).expected()
+	port := svc.Spec.Ports[0]
+	if port.Port != 8443 || port.TargetPort.IntValue() != 8443 {
+		t.Errorf("got port %d and target port %s, want 8443", port.Port, port.TargetPort.String())
+	}
+	if port.Name != "5000-tcp" {
+		t.Errorf("got port name %q, want the name used by the service monitor", port.Name)
+	}
+}
+
+func TestGetRegistryPort(t *testing.T) {
+	for _, tt := range []struct {
+		overrides string
+		expected  int
+		err       bool
+	}{
+		{overrides: `{}`, expected: defaults.ContainerPort},
+		{overrides: `{"port":8443}`, expected: 8443},
+		{overrides: `{"port":443}`, err: true},
+		{overrides: `{"port":70000}`, err: true},
+	} {
+		cr := &imageregistryv1.Config{}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+		port, err := getRegistryPort(cr)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.overrides)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.overrides, err)
+		}
+		if port != tt.expected {
+			t.Errorf("%s: got port %d, want %d", tt.overrides, port, tt.expected)
+		}
+	}
+}
+
+func TestGetServiceClusterIP(t *testing.T) {
+	for _, tt := range []struct {
+		overrides string
+		expected  string
+		err       bool
+	}{
+		{overrides: `{}`},
+		{overrides: `{"service":{"clusterIP":"None"}}`, expected: corev1.ClusterIPNone},
+		{overrides: `{"service":{"clusterIP":"172.30.0.10"}}`, expected: "172.30.0.10"},
+		{overrides: `{"service":{"clusterIP":"fd02::10"}}`, expected: "fd02::10"},
+		{overrides: `{"service":{"clusterIP":"none"}}`, err: true},
+		{overrides: `{"service":{"clusterIP":"172.30.0.300"}}`, err: true},
+	} {
+		cr := &imageregistryv1.Config{}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+		clusterIP, err := getServiceClusterIP(cr)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.overrides)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.overrides, err)
+		}
+		if clusterIP != tt.expected {
+			t.Errorf("%s: got cluster IP %q, want %q", tt.overrides, clusterIP, tt.expected)
+		}
+	}
+}
+
+func TestClusterIPChanged(t *testing.T) {
+	for _, tt := range []struct {
+		current   string
+		requested string
+		expected  bool
+	}{
+		{current: "172.30.0.10", requested: "", expected: false},
+		{current: corev1.ClusterIPNone, requested: "", expected: true},
+		{current: "172.30.0.10", requested: corev1.ClusterIPNone, expected: true},
+		{current: corev1.ClusterIPNone, requested: corev1.ClusterIPNone, expected: false},
+		{current: "172.30.0.10", requested: "172.30.0.20", expected: true},
+		{current: "172.30.0.20", requested: "172.30.0.20", expected: false},
+	} {
+		svc := &corev1.Service{Spec: corev1.ServiceSpec{ClusterIP: tt.current}}
+		if got := clusterIPChanged(svc, tt.requested); got != tt.expected {
+			t.Errorf("%q -> %q: got %t, want %t", tt.current, tt.requested, got, tt.expected)
+		}
+	}
+}
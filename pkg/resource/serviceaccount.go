@@ -2,18 +2,40 @@ package resource
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
 
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
 var _ Mutator = &generatorServiceAccount{}
 
+// getRegistryServiceAccountName returns the name of the service account the
+// registry pods run as.
+func getRegistryServiceAccountName(cr *imageregistryv1.Config) (string, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return "", err
+	}
+	if overrides.Deployment == nil || overrides.Deployment.ServiceAccountName == "" {
+		return defaults.ServiceAccountName, nil
+	}
+	name := overrides.Deployment.ServiceAccountName
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid service account name %q: %s", name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
 type generatorServiceAccount struct {
 	lister    corelisters.ServiceAccountNamespaceLister
 	client    coreset.CoreV1Interface
@@ -0,0 +1,47 @@
+package resource
+
+import (
+	"testing"
+
+	rbacapi "k8s.io/api/rbac/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestGetRegistryServiceAccountName(t *testing.T) {
+	for _, tt := range []struct {
+		overrides string
+		expected  string
+		err       bool
+	}{
+		{overrides: `{}`, expected: defaults.ServiceAccountName},
+		{overrides: `{"deployment":{"serviceAccountName":"custom-registry"}}`, expected: "custom-registry"},
+		{overrides: `{"deployment":{"serviceAccountName":"Invalid_Name"}}`, err: true},
+	} {
+		cr := &imageregistryv1.Config{}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+		name, err := getRegistryServiceAccountName(cr)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.overrides)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.overrides, err)
+		}
+		if name != tt.expected {
+			t.Errorf("%s: got %q, want %q", tt.overrides, name, tt.expected)
+		}
+
+		obj, err := newGeneratorClusterRoleBinding(nil, nil, name).expected()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subject := obj.(*rbacapi.ClusterRoleBinding).Subjects[0]; subject.Name != tt.expected {
+			t.Errorf("%s: got the registry role bound to %q, want %q", tt.overrides, subject.Name, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	appsset "k8s.io/client-go/kubernetes/typed/apps/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
+)
+
+// shardingCondition reports the registry shards.
+const shardingCondition = "Sharding"
+
+// shardStorageRoot is the prefix of the registry storage under which the
+// shards keep their storage, in a directory per shard. The storage inventory
+// looks for the shard blobs under it.
+const shardStorageRoot = "/" + inventory.ShardsPrefix
+
+// Names reserved for the objects of the shard router and of the shard
+// served by the registry deployment.
+const (
+	defaultShardName = "default"
+	routerShardName  = "router"
+)
+
+// Mount paths of the serving certificate and of the service CA in the shard
+// router pods.
+const (
+	shardRouterCertsPath     = "/etc/secrets"
+	shardRouterServiceCAPath = "/var/run/configmaps/serviceca"
+)
+
+// repositoryPrefixRegexp matches repository prefixes, i.e. one or more
+// repository path components.
+var repositoryPrefixRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+// shardRouterLabels are the labels of the shard router pods, the registry
+// Service selects them when the registry is sharded.
+var shardRouterLabels = map[string]string{
+	"docker-registry":   "shard-router",
+	defaults.ShardLabel: routerShardName,
+}
+
+// shardLabels returns the labels of the objects of the shard name. They do
+// not match the selectors of the registry deployment and Service.
+func shardLabels(name string) map[string]string {
+	return map[string]string{
+		"docker-registry":   "shard",
+		defaults.ShardLabel: name,
+	}
+}
+
+// shardServiceName returns the name of the Service in front of the pods of
+// the shard name.
+func shardServiceName(name string) string {
+	return defaults.ShardNamePrefix + name
+}
+
+// shardURL returns the URL the shard router forwards the requests for the
+// shard name to.
+func shardURL(name string, port int) string {
+	return fmt.Sprintf("https://%s.%s.svc:%d", shardServiceName(name), defaults.ImageRegistryOperatorNamespace, port)
+}
+
+// shardStorageEnvName returns the name of the environment variable setting
+// the root of the registry storage for storageType, as returned by
+// storage.StorageType. Shards need object storage, the registry replicas
+// cannot share claims.
+func shardStorageEnvName(storageType string) (string, error) {
+	switch storageType {
+	case "S3", "IBMCOS":
+		return "REGISTRY_STORAGE_S3_ROOTDIRECTORY", nil
+	case "GCS":
+		return "REGISTRY_STORAGE_GCS_ROOTDIRECTORY", nil
+	case "Azure":
+		return "REGISTRY_STORAGE_AZURE_ROOTDIRECTORY", nil
+	case "OSS":
+		return "REGISTRY_STORAGE_OSS_ROOTDIRECTORY", nil
+	case "Swift":
+		return "REGISTRY_STORAGE_SWIFT_PREFIX", nil
+	case "":
+		return "", fmt.Errorf("the registry storage is not configured")
+	default:
+		return "", fmt.Errorf("the %s storage cannot be sharded, shards require object storage", storageType)
+	}
+}
+
+// validateShards checks the shards have valid and distinct names and
+// repository prefixes, and that the registry storage can be sharded.
+func validateShards(s *imageregistryv1.ImageRegistryConfigStorage, shards []ShardOverrides) error {
+	if _, err := shardStorageEnvName(storage.StorageType(s)); err != nil {
+		return err
+	}
+
+	names := map[string]struct{}{}
+	prefixes := map[string]string{}
+	for _, shard := range shards {
+		if errs := validation.IsDNS1035Label(shardServiceName(shard.Name)); len(errs) > 0 || shard.Name == "" {
+			return fmt.Errorf("invalid shard name %q: %s", shard.Name, strings.Join(errs, ", "))
+		}
+		if shard.Name == defaultShardName || shard.Name == routerShardName {
+			return fmt.Errorf("invalid shard name %q: the name is used by the operator", shard.Name)
+		}
+		if _, ok := names[shard.Name]; ok {
+			return fmt.Errorf("duplicate shard name %q", shard.Name)
+		}
+		names[shard.Name] = struct{}{}
+
+		if len(shard.RepositoryPrefixes) == 0 {
+			return fmt.Errorf("shard %q has no repository prefixes", shard.Name)
+		}
+		for _, prefix := range shard.RepositoryPrefixes {
+			if !repositoryPrefixRegexp.MatchString(prefix) {
+				return fmt.Errorf("invalid repository prefix %q for shard %q", prefix, shard.Name)
+			}
+			if other, ok := prefixes[prefix]; ok {
+				return fmt.Errorf("repository prefix %q is used by the shards %q and %q", prefix, other, shard.Name)
+			}
+			prefixes[prefix] = shard.Name
+		}
+		if shard.Replicas < 0 {
+			return fmt.Errorf("invalid number of replicas %d for shard %q", shard.Replicas, shard.Name)
+		}
+	}
+	return nil
+}
+
+// shardingEnabled returns the shards if the user has configured them and
+// the feature gate is enabled.
+func shardingEnabled(cr *imageregistryv1.Config, gates featuregates.Gates) ([]ShardOverrides, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides.Sharding == nil || len(overrides.Sharding.Shards) == 0 {
+		return nil, nil
+	}
+	if !gates.Enabled(featuregates.Sharding) {
+		return nil, nil
+	}
+	if err := validateShards(&cr.Spec.Storage, overrides.Sharding.Shards); err != nil {
+		return nil, err
+	}
+	return overrides.Sharding.Shards, nil
+}
+
+// syncShardingCondition reports the shards the registry is split into.
+func syncShardingCondition(cr *imageregistryv1.Config, gates featuregates.Gates) error {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return err
+	}
+	if overrides.Sharding == nil || len(overrides.Sharding.Shards) == 0 {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, shardingCondition)
+		return nil
+	}
+	shards := overrides.Sharding.Shards
+
+	cond := operatorv1.OperatorCondition{
+		Type:   shardingCondition,
+		Status: operatorv1.ConditionFalse,
+	}
+	if !gates.Enabled(featuregates.Sharding) {
+		cond.Reason = "FeatureGateDisabled"
+		cond.Message = fmt.Sprintf("Shards are configured but the %s feature gate is disabled", featuregates.Sharding)
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+		return nil
+	}
+	if err := validateShards(&cr.Spec.Storage, shards); err != nil {
+		cond.Reason = "InvalidConfiguration"
+		cond.Message = err.Error()
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+		return nil
+	}
+
+	var served []string
+	for _, shard := range shards {
+		served = append(served, fmt.Sprintf("%s (%s)", shard.Name, strings.Join(shard.RepositoryPrefixes, ", ")))
+	}
+	cond.Status = operatorv1.ConditionTrue
+	cond.Reason = "Sharded"
+	cond.Message = fmt.Sprintf(
+		"The registry is split into the shards %s, the other repositories are served by the registry deployment. "+
+			"Each shard keeps its images under its own storage prefix: they are not moved when the shards change.",
+		strings.Join(served, ", "),
+	)
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+	return nil
+}
+
+// shardDeployment returns a generator for the deployment of the registry
+// shard. It is the registry deployment with its own labels and storage
+// prefix.
+func (gd *generatorDeployment) shardDeployment(shard ShardOverrides) *generatorDeployment {
+	s := *gd
+	s.domain = nil
+	s.failover = false
+	s.shard = &shard
+	return &s
+}
+
+// relabelSelector returns a selector for labels if selector is the one of
+// the registry pods, selector otherwise.
+func relabelSelector(selector *metav1.LabelSelector, labels map[string]string) *metav1.LabelSelector {
+	if selector == nil || len(selector.MatchExpressions) > 0 || !reflect.DeepEqual(selector.MatchLabels, defaults.DeploymentLabels) {
+		return selector
+	}
+	return &metav1.LabelSelector{MatchLabels: labels}
+}
+
+// applyShard makes deploy the deployment of the shard: its pods get the
+// shard labels, they are spread apart from each other rather than from the
+// registry pods, and the registry storage is rooted at the shard prefix.
+func (gd *generatorDeployment) applyShard(deploy *appsapi.Deployment) error {
+	if gd.shard == nil {
+		return nil
+	}
+
+	labels := shardLabels(gd.shard.Name)
+	deploy.Labels = labels
+	deploy.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	templateLabels := map[string]string{}
+	for k, v := range deploy.Spec.Template.Labels {
+		templateLabels[k] = v
+	}
+	for k, v := range labels {
+		templateLabels[k] = v
+	}
+	deploy.Spec.Template.Labels = templateLabels
+	if gd.shard.Replicas > 0 {
+		replicas := gd.shard.Replicas
+		deploy.Spec.Replicas = &replicas
+	}
+
+	spec := &deploy.Spec.Template.Spec
+	// the constraints may be the ones of the registry config.
+	constraints := make([]corev1.TopologySpreadConstraint, len(spec.TopologySpreadConstraints))
+	copy(constraints, spec.TopologySpreadConstraints)
+	for i := range constraints {
+		constraints[i].LabelSelector = relabelSelector(constraints[i].LabelSelector, labels)
+	}
+	spec.TopologySpreadConstraints = constraints
+	if spec.Affinity != nil && spec.Affinity.PodAntiAffinity != nil {
+		terms := spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		for i := range terms {
+			terms[i].LabelSelector = relabelSelector(terms[i].LabelSelector, labels)
+		}
+	}
+
+	envName, err := shardStorageEnvName(storage.StorageType(&gd.cr.Spec.Storage))
+	if err != nil {
+		return err
+	}
+	registry := &spec.Containers[0]
+	registry.Env = append(registry.Env, corev1.EnvVar{Name: envName, Value: shardStorageRoot + gd.shard.Name})
+	return nil
+}
+
+// newGeneratorShardService returns a generator for the Service in front of
+// the pods of the shard name. The pods of the registry deployment serve the
+// default shard.
+func newGeneratorShardService(lister corelisters.ServiceNamespaceLister, client coreset.CoreV1Interface, port int, name string) *generatorService {
+	gs := newGeneratorService(lister, client, port)
+	gs.name = shardServiceName(name)
+	gs.labels = shardLabels(name)
+	if name == defaultShardName {
+		gs.selector = defaults.DeploymentLabels
+	}
+	// the shard router verifies the certificate of the registry against
+	// the main Service hostname, no certificate is requested for shards.
+	gs.secretName = ""
+	return gs
+}
+
+var _ Mutator = &generatorShardRouter{}
+
+// generatorShardRouter generates the deployment of the router forwarding the
+// registry requests to the shard serving the repository. It runs the
+// shard-router command of the operator image.
+type generatorShardRouter struct {
+	eventRecorder   events.Recorder
+	lister          appslisters.DeploymentNamespaceLister
+	configMapLister corelisters.ConfigMapNamespaceLister
+	secretLister    corelisters.SecretNamespaceLister
+	client          appsset.AppsV1Interface
+	cr              *imageregistryv1.Config
+	port            int
+	shards          []ShardOverrides
+}
+
+func newGeneratorShardRouter(eventRecorder events.Recorder, lister appslisters.DeploymentNamespaceLister, configMapLister corelisters.ConfigMapNamespaceLister, secretLister corelisters.SecretNamespaceLister, client appsset.AppsV1Interface, cr *imageregistryv1.Config, port int, shards []ShardOverrides) *generatorShardRouter {
+	return &generatorShardRouter{
+		eventRecorder:   eventRecorder,
+		lister:          lister,
+		configMapLister: configMapLister,
+		secretLister:    secretLister,
+		client:          client,
+		cr:              cr,
+		port:            port,
+		shards:          shards,
+	}
+}
+
+func (gr *generatorShardRouter) Type() runtime.Object {
+	return &appsapi.Deployment{}
+}
+
+func (gr *generatorShardRouter) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gr *generatorShardRouter) GetName() string {
+	return defaults.ShardRouterName
+}
+
+func (gr *generatorShardRouter) expected() (*appsapi.Deployment, error) {
+	secretName := defaults.ImageRegistryName + "-tls"
+	deps := newDependencies()
+	deps.AddSecret(secretName)
+	deps.AddConfigMap(defaults.ServiceCAName)
+	depsChecksum, err := deps.Checksum(gr.configMapLister, gr.secretLister)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		fmt.Sprintf("--port=%d", gr.port),
+		"--tls-cert=" + shardRouterCertsPath + "/tls.crt",
+		"--tls-key=" + shardRouterCertsPath + "/tls.key",
+		"--ca-file=" + shardRouterServiceCAPath + "/service-ca.crt",
+		fmt.Sprintf("--server-name=%s.%s.svc", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace),
+		"--default-backend=" + shardURL(defaultShardName, gr.port),
+	}
+	for _, shard := range gr.shards {
+		for _, prefix := range shard.RepositoryPrefixes {
+			args = append(args, fmt.Sprintf("--shard=%s=%s", prefix, shardURL(shard.Name, gr.port)))
+		}
+	}
+
+	replicas := gr.cr.Spec.Replicas
+	return &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gr.GetName(),
+			Namespace: gr.GetNamespace(),
+			Labels:    shardRouterLabels,
+		},
+		Spec: appsapi.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: shardRouterLabels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: shardRouterLabels,
+					Annotations: map[string]string{
+						defaults.ChecksumOperatorDepsAnnotation: depsChecksum,
+					},
+				},
+				Spec: corev1.PodSpec{
+					AutomountServiceAccountToken: new(bool),
+					PriorityClassName:            "system-cluster-critical",
+					NodeSelector:                 gr.cr.Spec.NodeSelector,
+					Tolerations:                  gr.cr.Spec.Tolerations,
+					Containers: []corev1.Container{
+						{
+							Name:                     "shard-router",
+							Image:                    os.Getenv("OPERATOR_IMAGE"),
+							Resources:                defaultResources,
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							Command: []string{
+								"cluster-image-registry-operator",
+								"shard-router",
+							},
+							Args: args,
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: int32(gr.port),
+									Protocol:      "TCP",
+								},
+							},
+							ReadinessProbe: generateProbeConfig(gr.port),
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "registry-tls", MountPath: shardRouterCertsPath, ReadOnly: true},
+								{Name: "serviceca", MountPath: shardRouterServiceCAPath, ReadOnly: true},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "registry-tls",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{SecretName: secretName},
+							},
+						},
+						{
+							Name: "serviceca",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: defaults.ServiceCAName},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (gr *generatorShardRouter) Get() (runtime.Object, error) {
+	return gr.lister.Get(gr.GetName())
+}
+
+func (gr *generatorShardRouter) Create() (runtime.Object, error) {
+	dep, _, err := gr.Update(nil)
+	return dep, err
+}
+
+func (gr *generatorShardRouter) Update(o runtime.Object) (runtime.Object, bool, error) {
+	exp, err := gr.expected()
+	if err != nil {
+		return o, false, err
+	}
+
+	dep, updated, err := resourceapply.ApplyDeployment(
+		context.TODO(), gr.client, gr.eventRecorder, exp,
+		resourcemerge.ExpectedDeploymentGeneration(exp, gr.cr.Status.Generations),
+	)
+	if err != nil {
+		return o, false, err
+	}
+	resourcemerge.SetDeploymentGeneration(&gr.cr.Status.Generations, dep)
+	return dep, updated, nil
+}
+
+func (gr *generatorShardRouter) Delete(opts metav1.DeleteOptions) error {
+	return gr.client.Deployments(gr.GetNamespace()).Delete(
+		context.TODO(), gr.GetName(), opts,
+	)
+}
+
+func (gr *generatorShardRouter) Owned() bool {
+	return true
+}
+
+// shardRouterServing returns true if the registry Service is to select the
+// shard router pods. The Service is moved to the router once it has
+// available replicas, and is not moved back while the registry is sharded
+// as the registry deployment only serves the default shard.
+func (g *Generator) shardRouterServing() (bool, error) {
+	svc, err := g.listers.Services.Get(defaults.ServiceName)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	if err == nil && reflect.DeepEqual(svc.Spec.Selector, shardRouterLabels) {
+		return true, nil
+	}
+
+	dep, err := g.listers.Deployments.Get(defaults.ShardRouterName)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return dep.Status.AvailableReplicas > 0, nil
+}
+
+// removeObsoleteShards deletes the deployments and Services of the shards
+// that are no longer configured, along with the shard router once the
+// registry is no longer sharded. The images pushed to a removed shard are
+// left in its storage prefix. Nothing is deleted while the shards
+// configuration is invalid.
+func (g *Generator) removeObsoleteShards(cr *imageregistryv1.Config, gates featuregates.Gates, generators []Mutator) error {
+	if _, err := shardingEnabled(cr, gates); err != nil {
+		return nil
+	}
+
+	knownNames := map[string]bool{}
+	for _, gen := range generators {
+		knownNames[gen.GetName()] = true
+	}
+
+	deployments, err := g.listers.Deployments.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list deployments: %s", err)
+	}
+	for _, dep := range deployments {
+		if _, ok := dep.Labels[defaults.ShardLabel]; !ok || knownNames[dep.Name] {
+			continue
+		}
+		err = g.clients.Apps.Deployments(defaults.ImageRegistryOperatorNamespace).Delete(
+			context.TODO(), dep.Name, metav1.DeleteOptions{},
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	services, err := g.listers.Services.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list services: %s", err)
+	}
+	for _, svc := range services {
+		if _, ok := svc.Labels[defaults.ShardLabel]; !ok || knownNames[svc.Name] {
+			continue
+		}
+		err = g.clients.Core.Services(defaults.ImageRegistryOperatorNamespace).Delete(
+			context.TODO(), svc.Name, metav1.DeleteOptions{},
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package resource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+)
+
+func TestValidateShards(t *testing.T) {
+	s3 := &imageregistryv1.ImageRegistryConfigStorage{S3: &imageregistryv1.ImageRegistryConfigStorageS3{}}
+	for _, tt := range []struct {
+		name    string
+		storage *imageregistryv1.ImageRegistryConfigStorage
+		shards  []ShardOverrides
+		err     string
+	}{
+		{
+			name:    "valid",
+			storage: s3,
+			shards: []ShardOverrides{
+				{Name: "a", RepositoryPrefixes: []string{"team-a", "team-b/app"}},
+				{Name: "c", RepositoryPrefixes: []string{"team-c"}, Replicas: 3},
+			},
+		},
+		{
+			name:    "filesystem storage",
+			storage: &imageregistryv1.ImageRegistryConfigStorage{PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{}},
+			shards:  []ShardOverrides{{Name: "a", RepositoryPrefixes: []string{"team-a"}}},
+			err:     "the PVC storage cannot be sharded",
+		},
+		{
+			name:    "invalid name",
+			storage: s3,
+			shards:  []ShardOverrides{{Name: "Team_A", RepositoryPrefixes: []string{"team-a"}}},
+			err:     `invalid shard name "Team_A"`,
+		},
+		{
+			name:    "reserved name",
+			storage: s3,
+			shards:  []ShardOverrides{{Name: "router", RepositoryPrefixes: []string{"team-a"}}},
+			err:     "the name is used by the operator",
+		},
+		{
+			name:    "duplicate name",
+			storage: s3,
+			shards: []ShardOverrides{
+				{Name: "a", RepositoryPrefixes: []string{"team-a"}},
+				{Name: "a", RepositoryPrefixes: []string{"team-b"}},
+			},
+			err: `duplicate shard name "a"`,
+		},
+		{
+			name:    "no prefixes",
+			storage: s3,
+			shards:  []ShardOverrides{{Name: "a"}},
+			err:     `shard "a" has no repository prefixes`,
+		},
+		{
+			name:    "shared prefix",
+			storage: s3,
+			shards: []ShardOverrides{
+				{Name: "a", RepositoryPrefixes: []string{"team-a"}},
+				{Name: "b", RepositoryPrefixes: []string{"team-a"}},
+			},
+			err: `repository prefix "team-a" is used by the shards "a" and "b"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateShards(tt.storage, tt.shards)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApplyShard(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{}},
+			TopologySpreadConstraints: []corev1.TopologySpreadConstraint{{
+				TopologyKey:   "kubernetes.io/hostname",
+				LabelSelector: &metav1.LabelSelector{MatchLabels: defaults.DeploymentLabels},
+			}},
+		},
+	}
+	deploy := &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Labels: defaults.DeploymentLabels},
+		Spec: appsapi.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: defaults.DeploymentLabels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: defaults.DeploymentLabels},
+				Spec: corev1.PodSpec{
+					Containers:                []corev1.Container{{Name: "registry"}},
+					TopologySpreadConstraints: cr.Spec.TopologySpreadConstraints,
+				},
+			},
+		},
+	}
+
+	gd := (&generatorDeployment{cr: cr}).shardDeployment(ShardOverrides{Name: "a", RepositoryPrefixes: []string{"team-a"}, Replicas: 4})
+	if name := gd.GetName(); name != "image-registry-shard-a" {
+		t.Errorf("got deployment name %q, want image-registry-shard-a", name)
+	}
+	if err := gd.applyShard(deploy); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := shardLabels("a")
+	if !reflect.DeepEqual(deploy.Spec.Selector.MatchLabels, labels) || !reflect.DeepEqual(deploy.Spec.Template.Labels, labels) {
+		t.Errorf("got selector %v and pod labels %v, want %v", deploy.Spec.Selector.MatchLabels, deploy.Spec.Template.Labels, labels)
+	}
+	if *deploy.Spec.Replicas != 4 {
+		t.Errorf("got %d replicas, want 4", *deploy.Spec.Replicas)
+	}
+	if selector := deploy.Spec.Template.Spec.TopologySpreadConstraints[0].LabelSelector.MatchLabels; !reflect.DeepEqual(selector, labels) {
+		t.Errorf("got topology spread selector %v, want %v", selector, labels)
+	}
+	if selector := cr.Spec.TopologySpreadConstraints[0].LabelSelector.MatchLabels; !reflect.DeepEqual(selector, defaults.DeploymentLabels) {
+		t.Errorf("the topology spread constraints of the registry config were changed: %v", selector)
+	}
+	expected := []corev1.EnvVar{{Name: "REGISTRY_STORAGE_GCS_ROOTDIRECTORY", Value: "/shards/a"}}
+	if env := deploy.Spec.Template.Spec.Containers[0].Env; !reflect.DeepEqual(env, expected) {
+		t.Errorf("got env %v, want %v", env, expected)
+	}
+}
+
+func TestShardServices(t *testing.T) {
+	svc := newGeneratorShardService(nil, nil, defaults.ContainerPort, "a").expected()
+	if svc.Name != "image-registry-shard-a" || !reflect.DeepEqual(svc.Spec.Selector, shardLabels("a")) {
+		t.Errorf("got service %s selecting %v", svc.Name, svc.Spec.Selector)
+	}
+	if _, ok := svc.Annotations["service.alpha.openshift.io/serving-cert-secret-name"]; ok {
+		t.Errorf("expected no serving certificate to be requested for a shard")
+	}
+
+	svc = newGeneratorShardService(nil, nil, defaults.ContainerPort, defaultShardName).expected()
+	if !reflect.DeepEqual(svc.Spec.Selector, defaults.DeploymentLabels) {
+		t.Errorf("got default shard selector %v, want the registry pods", svc.Spec.Selector)
+	}
+	if _, ok := svc.Labels[defaults.ShardLabel]; !ok {
+		t.Errorf("expected the default shard service to be labeled as a shard object")
+	}
+}
+
+func TestShardRouterDeployment(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	cr := &imageregistryv1.Config{Spec: imageregistryv1.ImageRegistrySpec{Replicas: 2}}
+	gr := newGeneratorShardRouter(nil, nil,
+		corelisters.NewConfigMapLister(indexer).ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		corelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace),
+		nil, cr, 5001, []ShardOverrides{{Name: "a", RepositoryPrefixes: []string{"team-a", "team-b"}}},
+	)
+
+	deploy, err := gr.expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *deploy.Spec.Replicas != 2 || !reflect.DeepEqual(deploy.Spec.Template.Labels, shardRouterLabels) {
+		t.Errorf("got %d replicas labeled %v", *deploy.Spec.Replicas, deploy.Spec.Template.Labels)
+	}
+	args := strings.Join(deploy.Spec.Template.Spec.Containers[0].Args, " ")
+	for _, arg := range []string{
+		"--port=5001",
+		"--server-name=image-registry.openshift-image-registry.svc",
+		"--default-backend=https://image-registry-shard-default.openshift-image-registry.svc:5001",
+		"--shard=team-a=https://image-registry-shard-a.openshift-image-registry.svc:5001",
+		"--shard=team-b=https://image-registry-shard-a.openshift-image-registry.svc:5001",
+	} {
+		if !strings.Contains(args, arg) {
+			t.Errorf("got args %q, want %s", args, arg)
+		}
+	}
+}
+
+func TestSyncShardingCondition(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	cr.Spec.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"sharding":{"shards":[{"name":"a","repositoryPrefixes":["team-a"]}]}}`)
+
+	if err := syncShardingCondition(cr, featuregates.Gates{}); err != nil {
+		t.Fatal(err)
+	}
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, shardingCondition)
+	if cond == nil || cond.Status != operatorv1.ConditionFalse || cond.Reason != "FeatureGateDisabled" {
+		t.Errorf("got condition %#v, want the feature gate to be reported as disabled", cond)
+	}
+
+	gates := featuregates.Gates{featuregates.Sharding: true}
+	if err := syncShardingCondition(cr, gates); err != nil {
+		t.Fatal(err)
+	}
+	cond = v1helpers.FindOperatorCondition(cr.Status.Conditions, shardingCondition)
+	if cond == nil || cond.Status != operatorv1.ConditionTrue || !strings.Contains(cond.Message, "a (team-a)") {
+		t.Errorf("got condition %#v, want the shards to be reported", cond)
+	}
+	if shards, err := shardingEnabled(cr, gates); err != nil || len(shards) != 1 {
+		t.Errorf("got shards %v and error %v, want the configured shard", shards, err)
+	}
+
+	cr.Spec.UnsupportedConfigOverrides.Raw = nil
+	if err := syncShardingCondition(cr, gates); err != nil {
+		t.Fatal(err)
+	}
+	if cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, shardingCondition); cond != nil {
+		t.Errorf("got condition %#v, want it removed", cond)
+	}
+}
+
+func TestRemoveObsoleteShardsInvalidConfiguration(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shardServiceName("a"),
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Labels:    shardLabels("a"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the generator has no clients, deleting the shard would panic.
+	g := &Generator{
+		listers: &client.Listers{
+			StorageListers: client.StorageListers{
+				Deployments: appslisters.NewDeploymentLister(indexer).Deployments(defaults.ImageRegistryOperatorNamespace),
+			},
+		},
+	}
+	cr := &imageregistryv1.Config{}
+	cr.Spec.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"sharding":{"shards":[{"name":"a"}]}}`)
+
+	if err := g.removeObsoleteShards(cr, featuregates.Gates{featuregates.Sharding: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
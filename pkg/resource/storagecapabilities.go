@@ -0,0 +1,32 @@
+package resource
+
+import (
+	"fmt"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageCapabilitiesCondition reports what the storage in use supports, and
+// whether the registry config asks for something it does not.
+const storageCapabilitiesCondition = "StorageCapabilities"
+
+// syncStorageCapabilitiesCondition reports the capabilities of the storage
+// in the status of cr.
+func syncStorageCapabilitiesCondition(cr *imageregistryv1.Config, capabilities util.Capabilities) {
+	cond := operatorv1.OperatorCondition{
+		Type:    storageCapabilitiesCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "AsExpected",
+		Message: capabilities.String(),
+	}
+	if cr.Spec.Replicas > 1 && !capabilities.MultiReplica {
+		cond.Status = operatorv1.ConditionFalse
+		cond.Reason = "MultiReplicaUnsupported"
+		cond.Message = fmt.Sprintf("The storage cannot be shared by the %d registry replicas: %s", cr.Spec.Replicas, capabilities)
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+}
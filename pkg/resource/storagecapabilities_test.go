@@ -0,0 +1,59 @@
+package resource
+
+import (
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestSyncStorageCapabilitiesCondition(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		replicas     int32
+		capabilities util.Capabilities
+		status       operatorv1.ConditionStatus
+		reason       string
+		message      string
+	}{
+		{
+			name:         "single replica",
+			replicas:     1,
+			capabilities: util.Capabilities{},
+			status:       operatorv1.ConditionTrue,
+			reason:       "AsExpected",
+			message:      "MultiReplica=false, Redirect=false, EncryptionAtRestConfig=false, Tagging=false",
+		},
+		{
+			name:         "shared storage",
+			replicas:     2,
+			capabilities: util.Capabilities{MultiReplica: true, Redirect: true, Tagging: true},
+			status:       operatorv1.ConditionTrue,
+			reason:       "AsExpected",
+			message:      "MultiReplica=true, Redirect=true, EncryptionAtRestConfig=false, Tagging=true",
+		},
+		{
+			name:         "storage not shareable",
+			replicas:     2,
+			capabilities: util.Capabilities{},
+			status:       operatorv1.ConditionFalse,
+			reason:       "MultiReplicaUnsupported",
+			message:      "The storage cannot be shared by the 2 registry replicas: MultiReplica=false, Redirect=false, EncryptionAtRestConfig=false, Tagging=false",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Replicas = tt.replicas
+
+			syncStorageCapabilitiesCondition(cr, tt.capabilities)
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageCapabilitiesCondition)
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason || cond.Message != tt.message {
+				t.Errorf("got condition %#v, want status %s, reason %s and message %q", cond, tt.status, tt.reason, tt.message)
+			}
+		})
+	}
+}
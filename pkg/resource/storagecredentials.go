@@ -0,0 +1,45 @@
+package resource
+
+import (
+	"fmt"
+	"time"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageCredentialsCondition reports how the credentials used to reach the
+// storage are sourced, so the authentication mode can be seen at a glance.
+const storageCredentialsCondition = "StorageCredentials"
+
+// syncStorageCredentialsCondition reports the credentials mode of driver in
+// the status of cr. The reason of the condition is the mode.
+func syncStorageCredentialsCondition(cr *imageregistryv1.Config, driver storage.Driver, now time.Time) {
+	cond := operatorv1.OperatorCondition{
+		Type:    storageCredentialsCondition,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  string(util.CredentialsModeNone),
+		Message: "The storage does not need credentials",
+	}
+	if reporter, ok := driver.(storage.CredentialsReporter); ok {
+		source, err := reporter.CredentialsSource()
+		switch {
+		case err != nil:
+			cond.Status = operatorv1.ConditionUnknown
+			cond.Reason = "Unknown"
+			cond.Message = fmt.Sprintf("Unable to get the storage credentials: %s", err)
+		case source.Expiry != nil && !now.Before(*source.Expiry):
+			cond.Status = operatorv1.ConditionFalse
+			cond.Reason = string(source.Mode)
+			cond.Message = fmt.Sprintf("The storage credentials expired: %s", source)
+		default:
+			cond.Reason = string(source.Mode)
+			cond.Message = source.String()
+		}
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+}
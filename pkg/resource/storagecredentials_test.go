@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type credentialsReporterDriver struct {
+	storage.Driver
+	source storageutil.CredentialsSource
+	err    error
+}
+
+func (d *credentialsReporterDriver) CredentialsSource() (storageutil.CredentialsSource, error) {
+	return d.source, d.err
+}
+
+func TestSyncStorageCredentialsCondition(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Hour)
+	valid := now.Add(time.Hour)
+
+	for _, tc := range []struct {
+		name            string
+		driver          storage.Driver
+		expectedStatus  operatorv1.ConditionStatus
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:            "no credentials",
+			driver:          &testDriver{},
+			expectedStatus:  operatorv1.ConditionTrue,
+			expectedReason:  "None",
+			expectedMessage: "The storage does not need credentials",
+		},
+		{
+			name: "workload identity",
+			driver: &credentialsReporterDriver{source: storageutil.CredentialsSource{
+				Mode:   storageutil.CredentialsModeWorkloadIdentity,
+				Secret: "installer-cloud-credentials",
+			}},
+			expectedStatus:  operatorv1.ConditionTrue,
+			expectedReason:  "WorkloadIdentity",
+			expectedMessage: "Mode=WorkloadIdentity, Secret=installer-cloud-credentials",
+		},
+		{
+			name: "valid user provided credentials",
+			driver: &credentialsReporterDriver{source: storageutil.CredentialsSource{
+				Mode:   storageutil.CredentialsModeUserProvided,
+				Secret: "image-registry-private-configuration-user",
+				Expiry: &valid,
+			}},
+			expectedStatus:  operatorv1.ConditionTrue,
+			expectedReason:  "UserProvided",
+			expectedMessage: "Mode=UserProvided, Secret=image-registry-private-configuration-user, Expiry=2024-03-01T13:00:00Z",
+		},
+		{
+			name: "expired user provided credentials",
+			driver: &credentialsReporterDriver{source: storageutil.CredentialsSource{
+				Mode:   storageutil.CredentialsModeUserProvided,
+				Secret: "image-registry-private-configuration-user",
+				Expiry: &expired,
+			}},
+			expectedStatus:  operatorv1.ConditionFalse,
+			expectedReason:  "UserProvided",
+			expectedMessage: "The storage credentials expired: Mode=UserProvided, Secret=image-registry-private-configuration-user, Expiry=2024-03-01T11:00:00Z",
+		},
+		{
+			name:            "error",
+			driver:          &credentialsReporterDriver{err: errors.New("secret not found")},
+			expectedStatus:  operatorv1.ConditionUnknown,
+			expectedReason:  "Unknown",
+			expectedMessage: "Unable to get the storage credentials: secret not found",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			syncStorageCredentialsCondition(cr, tc.driver, now)
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageCredentialsCondition)
+			if cond == nil {
+				t.Fatal("condition not found")
+			}
+			if cond.Status != tc.expectedStatus || cond.Reason != tc.expectedReason || cond.Message != tc.expectedMessage {
+				t.Errorf("got %s %s %q, want %s %s %q", cond.Status, cond.Reason, cond.Message, tc.expectedStatus, tc.expectedReason, tc.expectedMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package resource
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+// GetStorageDeletion returns whether deleting from the registry storage is
+// enabled for cr.
+func GetStorageDeletion(cr *imageregistryv1.Config) (bool, error) {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return false, err
+	}
+	deletion := overrides.StorageDeletion
+	if deletion == nil || deletion.Enabled == nil {
+		return true, nil
+	}
+	return *deletion.Enabled, nil
+}
+
+// storageDeletionEnv returns the environment variable setting whether the
+// registry accepts deletions.
+func storageDeletionEnv(cr *imageregistryv1.Config) ([]corev1.EnvVar, error) {
+	enabled, err := GetStorageDeletion(cr)
+	if err != nil {
+		return nil, err
+	}
+	return []corev1.EnvVar{
+		{Name: "REGISTRY_STORAGE_DELETE_ENABLED", Value: strconv.FormatBool(enabled)},
+	}, nil
+}
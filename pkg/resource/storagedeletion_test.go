@@ -0,0 +1,51 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+func TestStorageDeletionEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		want      []corev1.EnvVar
+		wantErr   bool
+	}{
+		{
+			name: "default",
+			want: []corev1.EnvVar{
+				{Name: "REGISTRY_STORAGE_DELETE_ENABLED", Value: "true"},
+			},
+		},
+		{
+			name:      "disabled",
+			overrides: `{"storageDeletion":{"enabled":false}}`,
+			want: []corev1.EnvVar{
+				{Name: "REGISTRY_STORAGE_DELETE_ENABLED", Value: "false"},
+			},
+		},
+		{
+			name:      "invalid overrides",
+			overrides: `{"storageDeletion":{"enabled":"no"}}`,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			env, err := storageDeletionEnv(cr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(env, tt.want) {
+				t.Errorf("got %#v, want %#v", env, tt.want)
+			}
+		})
+	}
+}
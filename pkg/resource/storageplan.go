@@ -0,0 +1,87 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storagePlanCondition reports the cloud resources the operator provisions
+// for the registry storage the first time it is configured.
+const storagePlanCondition = "StorageProvisioningPlan"
+
+// planChecksum returns a short checksum identifying the plan, it is what
+// users put in the approval annotation.
+func planChecksum(plan []string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(plan, "\n"))))[:16]
+}
+
+// checkStoragePlan reports the resources the driver is about to provision in
+// the status of cr. It returns an error if the plan has to be approved and
+// the approval annotation does not match the current plan.
+func checkStoragePlan(cr *imageregistryv1.Config, driver storage.Driver) error {
+	planner, ok := driver.(storage.Planner)
+	if !ok {
+		return nil
+	}
+
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return err
+	}
+	requireApproval := overrides.Storage != nil && overrides.Storage.RequirePlanApproval
+
+	resources, err := planner.PlanStorage(cr)
+	if err != nil {
+		return fmt.Errorf("unable to plan the storage provisioning: %w", err)
+	}
+	if len(resources) == 0 {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, storagePlanCondition)
+		return nil
+	}
+
+	var plan []string
+	for _, r := range resources {
+		plan = append(plan, r.String())
+	}
+	checksum := planChecksum(plan)
+	cond := operatorv1.OperatorCondition{
+		Type:   storagePlanCondition,
+		Status: operatorv1.ConditionTrue,
+		Reason: "Planned",
+		Message: fmt.Sprintf(
+			"The following resources are provisioned unless they already exist (plan %s): %s",
+			checksum, strings.Join(plan, "; "),
+		),
+	}
+	if !requireApproval {
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+		return nil
+	}
+
+	if cr.Annotations[defaults.StoragePlanApprovedAnnotation] == checksum {
+		cond.Reason = "Approved"
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+		return nil
+	}
+
+	cond.Status = operatorv1.ConditionFalse
+	cond.Reason = "WaitingForApproval"
+	cond.Message = fmt.Sprintf(
+		"The following resources will be provisioned once the plan is approved with the annotation %s=%s: %s",
+		defaults.StoragePlanApprovedAnnotation, checksum, strings.Join(plan, "; "),
+	)
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, cond)
+	return &storageutil.DegradedError{
+		Reason: "StoragePlanNotApproved",
+		Err:    fmt.Errorf("the storage provisioning plan %s is waiting for approval", checksum),
+	}
+}
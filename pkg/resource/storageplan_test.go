@@ -0,0 +1,102 @@
+package resource
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type plannerDriver struct {
+	storage.Driver
+	resources []storageutil.PlannedResource
+}
+
+func (d *plannerDriver) PlanStorage(*imageregistryv1.Config) ([]storageutil.PlannedResource, error) {
+	return d.resources, nil
+}
+
+func TestCheckStoragePlan(t *testing.T) {
+	resources := []storageutil.PlannedResource{
+		{
+			Kind:   "S3 bucket",
+			Name:   "cluster-image-registry-us-east-1-*",
+			Region: "us-east-1",
+			Tags:   map[string]string{"kubernetes.io/cluster/cluster": "owned"},
+		},
+	}
+	checksum := planChecksum([]string{resources[0].String()})
+
+	for _, tc := range []struct {
+		name       string
+		overrides  string
+		approval   string
+		wantStatus operatorv1.ConditionStatus
+		wantReason string
+		err        bool
+	}{
+		{
+			name:       "approval not required",
+			wantStatus: operatorv1.ConditionTrue,
+			wantReason: "Planned",
+		},
+		{
+			name:       "waiting for approval",
+			overrides:  `{"storage":{"requirePlanApproval":true}}`,
+			wantStatus: operatorv1.ConditionFalse,
+			wantReason: "WaitingForApproval",
+			err:        true,
+		},
+		{
+			name:       "approval of another plan",
+			overrides:  `{"storage":{"requirePlanApproval":true}}`,
+			approval:   "0123456789abcdef",
+			wantStatus: operatorv1.ConditionFalse,
+			wantReason: "WaitingForApproval",
+			err:        true,
+		},
+		{
+			name:       "approved",
+			overrides:  `{"storage":{"requirePlanApproval":true}}`,
+			approval:   checksum,
+			wantStatus: operatorv1.ConditionTrue,
+			wantReason: "Approved",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tc.overrides)
+			if tc.approval != "" {
+				cr.Annotations = map[string]string{defaults.StoragePlanApprovedAnnotation: tc.approval}
+			}
+
+			err := checkStoragePlan(cr, &plannerDriver{resources: resources})
+			if tc.err {
+				var degradedErr *storageutil.DegradedError
+				if !errors.As(err, &degradedErr) {
+					t.Fatalf("got %v, want a degraded error", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storagePlanCondition)
+			if cond == nil {
+				t.Fatal("expected the storage plan condition to be set")
+			}
+			if cond.Status != tc.wantStatus || cond.Reason != tc.wantReason {
+				t.Errorf("got %s/%s, want %s/%s", cond.Status, cond.Reason, tc.wantStatus, tc.wantReason)
+			}
+			if !strings.Contains(cond.Message, checksum) || !strings.Contains(cond.Message, "S3 bucket cluster-image-registry-us-east-1-* in us-east-1 tagged kubernetes.io/cluster/cluster=owned") {
+				t.Errorf("unexpected message %q", cond.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"fmt"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageRegionCondition reports region changes of the registry storage.
+const storageRegionCondition = "StorageRegionChange"
+
+// storageLocation is where the registry storage lives.
+type storageLocation struct {
+	// name is the bucket or container, empty if it is to be generated.
+	name   string
+	region string
+}
+
+// getStorageLocation returns the location of the storage s, the ok result is
+// false for storage without a region.
+func getStorageLocation(s *imageregistryv1.ImageRegistryConfigStorage) (loc storageLocation, ok bool) {
+	switch {
+	case s.S3 != nil:
+		return storageLocation{name: s.S3.Bucket, region: s.S3.Region}, true
+	case s.GCS != nil:
+		return storageLocation{name: s.GCS.Bucket, region: s.GCS.Region}, true
+	case s.Swift != nil:
+		return storageLocation{name: s.Swift.Container, region: s.Swift.RegionName}, true
+	case s.IBMCOS != nil:
+		return storageLocation{name: s.IBMCOS.Bucket, region: s.IBMCOS.Location}, true
+	case s.OSS != nil:
+		return storageLocation{name: s.OSS.Bucket, region: s.OSS.Region}, true
+	}
+	return storageLocation{}, false
+}
+
+// requestedRegionChange returns the region the registry storage is in and
+// the one requested in the spec, they are equal when the region does not
+// change. The region is only compared for storage of the same type and the
+// same bucket or container, or one left to be generated: pointing the
+// registry at another existing bucket is not a region change. Regions left
+// to be defaulted are not a change either.
+func requestedRegionChange(cr *imageregistryv1.Config) (from, to string) {
+	if storage.StorageType(&cr.Spec.Storage) != storage.StorageType(&cr.Status.Storage) {
+		return "", ""
+	}
+	current, ok := getStorageLocation(&cr.Status.Storage)
+	if !ok || current.region == "" {
+		return "", ""
+	}
+	requested, _ := getStorageLocation(&cr.Spec.Storage)
+	if requested.region == "" || (requested.name != "" && requested.name != current.name) {
+		return current.region, current.region
+	}
+	return current.region, requested.region
+}
+
+// movedByStorageUpgrade returns true if the storage in the spec was set by
+// the storage upgrade, i.e. the registry is moved to its target or back to
+// its source storage.
+func movedByStorageUpgrade(cr *imageregistryv1.Config, state *StorageUpgradeState) bool {
+	if state == nil {
+		return false
+	}
+	requested, _ := getStorageLocation(&cr.Spec.Storage)
+	for _, s := range []*imageregistryv1.ImageRegistryConfigStorage{&state.Target, &state.Source} {
+		if loc, ok := getStorageLocation(s); ok && loc == requested && storage.StorageType(s) == storage.StorageType(&cr.Spec.Storage) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStorageRegionChange rejects changes to the region of the registry
+// storage made in place, the storage cannot be moved to another region that
+// way and the registry would end up with empty storage or none at all. The
+// region is changed by moving the registry to storage in the new region with
+// the storage upgrade, whose progress is reported here as well. Nothing is
+// checked while the StorageMigration feature gate is disabled.
+func checkStorageRegionChange(cr *imageregistryv1.Config, gates featuregates.Gates) error {
+	if !gates.Enabled(featuregates.StorageMigration) {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, storageRegionCondition)
+		return nil
+	}
+
+	state, err := GetStorageUpgradeState(cr)
+	if err != nil {
+		return err
+	}
+
+	from, to := requestedRegionChange(cr)
+	if from != to && !movedByStorageUpgrade(cr, state) {
+		v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+			Type:   storageRegionCondition,
+			Status: operatorv1.ConditionFalse,
+			Reason: "InPlaceChangeRejected",
+			Message: fmt.Sprintf(
+				"The region of the %s storage cannot be changed from %s to %s in place. Restore the region %s and move the registry to storage in the region %s by setting storageUpgrade.target in the unsupported config overrides",
+				storage.StorageType(&cr.Status.Storage), from, to, from, to,
+			),
+		})
+		return &storageutil.DegradedError{
+			Reason: "StorageRegionChangeRejected",
+			Err:    fmt.Errorf("the region of the registry storage cannot be changed from %s to %s in place", from, to),
+		}
+	}
+
+	if state != nil && !state.done() {
+		source, sourceOK := getStorageLocation(&state.Source)
+		target, targetOK := getStorageLocation(&state.Target)
+		if sourceOK && targetOK && target.region != "" && source.region != target.region {
+			v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+				Type:    storageRegionCondition,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Moving",
+				Message: fmt.Sprintf("The registry is moving from the region %s to %s (%s): %s", source.region, target.region, state.Phase, state.Message),
+			})
+			return nil
+		}
+	}
+
+	v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, storageRegionCondition)
+	return nil
+}
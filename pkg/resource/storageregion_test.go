@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+	storageutil "github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func s3Storage(bucket, region string) imageregistryv1.ImageRegistryConfigStorage {
+	return imageregistryv1.ImageRegistryConfigStorage{
+		S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: bucket, Region: region},
+	}
+}
+
+func TestCheckStorageRegionChange(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		spec         imageregistryv1.ImageRegistryConfigStorage
+		status       imageregistryv1.ImageRegistryConfigStorage
+		upgrade      *StorageUpgradeState
+		gateDisabled bool
+		wantStatus   operatorv1.ConditionStatus
+		wantReason   string
+		err          bool
+	}{
+		{
+			name:   "same region",
+			spec:   s3Storage("bucket", "us-east-1"),
+			status: s3Storage("bucket", "us-east-1"),
+		},
+		{
+			name:   "region left to be defaulted",
+			spec:   s3Storage("bucket", ""),
+			status: s3Storage("bucket", "us-east-1"),
+		},
+		{
+			name:   "initial configuration",
+			spec:   s3Storage("bucket", "us-east-1"),
+			status: imageregistryv1.ImageRegistryConfigStorage{},
+		},
+		{
+			name:       "changed in place",
+			spec:       s3Storage("bucket", "eu-west-1"),
+			status:     s3Storage("bucket", "us-east-1"),
+			wantStatus: operatorv1.ConditionFalse,
+			wantReason: "InPlaceChangeRejected",
+			err:        true,
+		},
+		{
+			name:         "changed in place with the feature gate disabled",
+			spec:         s3Storage("bucket", "eu-west-1"),
+			status:       s3Storage("bucket", "us-east-1"),
+			gateDisabled: true,
+		},
+		{
+			name:       "changed in place with a new bucket",
+			spec:       s3Storage("", "eu-west-1"),
+			status:     s3Storage("bucket", "us-east-1"),
+			wantStatus: operatorv1.ConditionFalse,
+			wantReason: "InPlaceChangeRejected",
+			err:        true,
+		},
+		{
+			name:   "another existing bucket",
+			spec:   s3Storage("other-bucket", "eu-west-1"),
+			status: s3Storage("bucket", "us-east-1"),
+		},
+		{
+			name:   "storage type changed",
+			spec:   imageregistryv1.ImageRegistryConfigStorage{GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{Region: "europe-west1"}},
+			status: s3Storage("bucket", "us-east-1"),
+		},
+		{
+			name:   "moving to another region",
+			spec:   s3Storage("bucket", "us-east-1"),
+			status: s3Storage("bucket", "us-east-1"),
+			upgrade: &StorageUpgradeState{
+				Phase:   StorageUpgradePhaseSyncing,
+				Source:  s3Storage("bucket", "us-east-1"),
+				Target:  s3Storage("bucket-eu", "eu-west-1"),
+				Message: "The registry is read-only while its storage is copied",
+			},
+			wantStatus: operatorv1.ConditionTrue,
+			wantReason: "Moving",
+		},
+		{
+			name:   "moved to another region",
+			spec:   s3Storage("bucket-eu", "eu-west-1"),
+			status: s3Storage("bucket", "us-east-1"),
+			upgrade: &StorageUpgradeState{
+				Phase:  StorageUpgradePhaseFlipped,
+				Source: s3Storage("bucket", "us-east-1"),
+				Target: s3Storage("bucket-eu", "eu-west-1"),
+			},
+			wantStatus: operatorv1.ConditionTrue,
+			wantReason: "Moving",
+		},
+		{
+			name:   "moved back after the upgrade completed",
+			spec:   s3Storage("bucket", "us-east-1"),
+			status: s3Storage("bucket-eu", "eu-west-1"),
+			upgrade: &StorageUpgradeState{
+				Phase:  StorageUpgradePhaseRolledBack,
+				Source: s3Storage("bucket", "us-east-1"),
+				Target: s3Storage("bucket-eu", "eu-west-1"),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage = tc.spec
+			cr.Status.Storage = tc.status
+			if tc.upgrade != nil {
+				if err := setStorageUpgradeState(cr, tc.upgrade); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gates := featuregates.Gates{featuregates.StorageMigration: !tc.gateDisabled}
+			err := checkStorageRegionChange(cr, gates)
+			var degraded *storageutil.DegradedError
+			if tc.err != errors.As(err, &degraded) {
+				t.Fatalf("got error %v, want a degraded error: %t", err, tc.err)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageRegionCondition)
+			if tc.wantReason == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Status != tc.wantStatus || cond.Reason != tc.wantReason {
+				t.Fatalf("got condition %#v, want status %s and reason %s", cond, tc.wantStatus, tc.wantReason)
+			}
+			if tc.err && !strings.Contains(cond.Message, "storageUpgrade.target") {
+				t.Errorf("got message %q, want it to point to the storage upgrade", cond.Message)
+			}
+		})
+	}
+}
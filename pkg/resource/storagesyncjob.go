@@ -0,0 +1,161 @@
+package resource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	batchapi "k8s.io/api/batch/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var _ Mutator = &generatorStorageSyncJob{}
+
+// generatorStorageSyncJob generates the Job copying the registry storage to
+// the target storage of a storage upgrade.
+type generatorStorageSyncJob struct {
+	client batchset.BatchV1Interface
+	state  *StorageUpgradeState
+}
+
+func newGeneratorStorageSyncJob(client batchset.BatchV1Interface, state *StorageUpgradeState) *generatorStorageSyncJob {
+	return &generatorStorageSyncJob{
+		client: client,
+		state:  state,
+	}
+}
+
+// storageSyncJobName returns the name of the job syncing the storage for
+// state. The name is derived from the target storage and from the direction
+// of the copy as the job template cannot be updated.
+func storageSyncJobName(state *StorageUpgradeState) string {
+	data, _ := json.Marshal(state.Target)
+	if state.Phase == StorageUpgradePhaseRollingBack {
+		data = append([]byte("rollback:"), data...)
+	}
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf("%s-%x", defaults.StorageSyncName, hash[:4])
+}
+
+func (gj *generatorStorageSyncJob) Type() runtime.Object {
+	return &batchapi.Job{}
+}
+
+func (gj *generatorStorageSyncJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gj *generatorStorageSyncJob) GetName() string {
+	return storageSyncJobName(gj.state)
+}
+
+func (gj *generatorStorageSyncJob) expected() (runtime.Object, error) {
+	// objects already copied are skipped, retries resume the copy.
+	backoffLimit := int32(3)
+	return &batchapi.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gj.GetName(),
+			Namespace: gj.GetNamespace(),
+			Labels: map[string]string{
+				"created-by": defaults.StorageSyncName,
+			},
+		},
+		Spec: batchapi.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: kcorev1.PodTemplateSpec{
+				Spec: kcorev1.PodSpec{
+					RestartPolicy:      kcorev1.RestartPolicyNever,
+					ServiceAccountName: defaults.OperatorServiceAccountName,
+					PriorityClassName:  "openshift-user-critical",
+					NodeSelector: map[string]string{
+						"kubernetes.io/os": "linux",
+					},
+					Containers: []kcorev1.Container{
+						{
+							Name:                     defaults.StorageSyncName,
+							Image:                    os.Getenv("OPERATOR_IMAGE"),
+							Resources:                defaultResources,
+							TerminationMessagePolicy: kcorev1.TerminationMessageFallbackToLogsOnError,
+							Command: []string{
+								"cluster-image-registry-operator",
+								"storage-sync",
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (gj *generatorStorageSyncJob) Get() (runtime.Object, error) {
+	return gj.client.Jobs(gj.GetNamespace()).Get(
+		context.TODO(), gj.GetName(), metav1.GetOptions{},
+	)
+}
+
+func (gj *generatorStorageSyncJob) Create() (runtime.Object, error) {
+	return commonCreate(gj, func(obj runtime.Object) (runtime.Object, error) {
+		return gj.client.Jobs(gj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchapi.Job), metav1.CreateOptions{},
+		)
+	})
+}
+
+// Update leaves the job alone, its template cannot be changed and a new
+// job is created for every target storage.
+func (gj *generatorStorageSyncJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return o, false, nil
+}
+
+func (gj *generatorStorageSyncJob) Delete(opts metav1.DeleteOptions) error {
+	return gj.client.Jobs(gj.GetNamespace()).Delete(
+		context.TODO(), gj.GetName(), opts,
+	)
+}
+
+func (gj *generatorStorageSyncJob) Owned() bool {
+	return true
+}
+
+// removeStorageSyncJobs deletes the storage sync jobs that are no longer
+// needed, i.e. all of them but the one copying the storage.
+func (g *Generator) removeStorageSyncJobs(cr *imageregistryv1.Config) error {
+	state, err := GetStorageUpgradeState(cr)
+	if err != nil || state == nil {
+		return err
+	}
+	var current string
+	if state.copying() {
+		current = storageSyncJobName(state)
+	}
+
+	jobs, err := g.listers.Jobs.List(labels.SelectorFromSet(labels.Set{"created-by": defaults.StorageSyncName}))
+	if err != nil {
+		return err
+	}
+	propagationPolicy := metav1.DeletePropagationBackground
+	for _, job := range jobs {
+		if job.Name == current {
+			continue
+		}
+		err := g.clients.Batch.Jobs(defaults.ImageRegistryOperatorNamespace).Delete(
+			context.TODO(), job.Name, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy},
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
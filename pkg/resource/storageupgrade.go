@@ -0,0 +1,363 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	batchapi "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// storageUpgradeCondition reports the progress of the storage upgrade.
+const storageUpgradeCondition = "StorageUpgrade"
+
+var defaultStorageUpgradeRollbackWindow = 24 * time.Hour
+
+// StorageUpgradePhase is the phase of a storage upgrade.
+type StorageUpgradePhase string
+
+const (
+	// StorageUpgradePhaseSyncing is set while the registry is read-only
+	// and its storage is copied to the target storage.
+	StorageUpgradePhaseSyncing StorageUpgradePhase = "Syncing"
+
+	// StorageUpgradePhaseFlipped is set once the registry has been moved
+	// to the target storage, until the rollback window ends.
+	StorageUpgradePhaseFlipped StorageUpgradePhase = "Flipped"
+
+	// StorageUpgradePhaseRollingBack is set while the registry is
+	// read-only and the target storage is copied back to the previous
+	// storage, so nothing pushed since the flip is lost.
+	StorageUpgradePhaseRollingBack StorageUpgradePhase = "RollingBack"
+
+	// StorageUpgradePhaseCompleted is set when the rollback window ended.
+	StorageUpgradePhaseCompleted StorageUpgradePhase = "Completed"
+
+	// StorageUpgradePhaseRolledBack is set when the registry has been
+	// moved back to its previous storage.
+	StorageUpgradePhaseRolledBack StorageUpgradePhase = "RolledBack"
+
+	// StorageUpgradePhaseFailed is set when the upgrade cannot proceed,
+	// the registry is left on its previous storage.
+	StorageUpgradePhaseFailed StorageUpgradePhase = "Failed"
+)
+
+// StorageUpgradeState is the state of a storage upgrade, it is kept in the
+// defaults.StorageUpgradeAnnotation annotation of the registry config.
+type StorageUpgradeState struct {
+	Phase StorageUpgradePhase `json:"phase"`
+	// Requested is the target storage configuration set by the user.
+	Requested imageregistryv1.ImageRegistryConfigStorage `json:"requested"`
+	// Source is the storage configuration the registry is moved from.
+	Source imageregistryv1.ImageRegistryConfigStorage `json:"source"`
+	// Target is the storage configuration the registry is moved to, as
+	// completed by the provisioning of the target storage.
+	Target imageregistryv1.ImageRegistryConfigStorage `json:"target"`
+	// FlippedAt is when the registry was moved to the target storage.
+	FlippedAt *metav1.Time `json:"flippedAt,omitempty"`
+	Message   string       `json:"message,omitempty"`
+}
+
+// done returns true if the upgrade no longer needs to be acted upon.
+func (s *StorageUpgradeState) done() bool {
+	switch s.Phase {
+	case StorageUpgradePhaseCompleted, StorageUpgradePhaseRolledBack, StorageUpgradePhaseFailed:
+		return true
+	}
+	return false
+}
+
+// GetStorageUpgradeState returns the state of the storage upgrade recorded
+// on the registry config, nil if no upgrade was ever started.
+func GetStorageUpgradeState(cr *imageregistryv1.Config) (*StorageUpgradeState, error) {
+	data, ok := cr.Annotations[defaults.StorageUpgradeAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	state := &StorageUpgradeState{}
+	if err := json.Unmarshal([]byte(data), state); err != nil {
+		return nil, fmt.Errorf("invalid storage upgrade state: %w", err)
+	}
+	return state, nil
+}
+
+// setStorageUpgradeState records state on the registry config and reports
+// it in the StorageUpgrade condition.
+func setStorageUpgradeState(cr *imageregistryv1.Config, state *StorageUpgradeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	cr.Annotations[defaults.StorageUpgradeAnnotation] = string(data)
+
+	status := operatorv1.ConditionFalse
+	if !state.done() {
+		status = operatorv1.ConditionTrue
+	}
+	v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+		Type:    storageUpgradeCondition,
+		Status:  status,
+		Reason:  string(state.Phase),
+		Message: state.Message,
+	})
+	return nil
+}
+
+// copying returns true while the content of one of the storages is copied
+// to the other one.
+func (s *StorageUpgradeState) copying() bool {
+	return s.Phase == StorageUpgradePhaseSyncing || s.Phase == StorageUpgradePhaseRollingBack
+}
+
+// storageUpgradeSyncing returns true while the registry storage is copied to
+// the target storage of an upgrade, or back to the previous storage, the
+// registry has to be read-only then.
+func storageUpgradeSyncing(cr *imageregistryv1.Config) (bool, error) {
+	state, err := GetStorageUpgradeState(cr)
+	if err != nil {
+		return false, err
+	}
+	return state != nil && state.copying(), nil
+}
+
+// syncStorageUpgrade moves the registry through the phases of the storage
+// upgrade requested in the config overrides. The registry is moved by
+// replacing its storage configuration, the storage itself is then synced
+// as usual. Upgrades are only started while the StorageMigration feature
+// gate is enabled, disabling it cancels the copy in progress.
+func (g *Generator) syncStorageUpgrade(cr *imageregistryv1.Config, gates featuregates.Gates, now time.Time) error {
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return err
+	}
+	o := overrides.StorageUpgrade
+	state, err := GetStorageUpgradeState(cr)
+	if err != nil {
+		return err
+	}
+
+	if !gates.Enabled(featuregates.StorageMigration) {
+		if state != nil && state.Phase == StorageUpgradePhaseSyncing {
+			state.Phase = StorageUpgradePhaseFailed
+			state.Message = fmt.Sprintf("The storage upgrade was cancelled as the %s feature gate is disabled, the registry was left on its previous storage", featuregates.StorageMigration)
+			g.eventRecorder.Warningf("StorageUpgradeCancelled", "%s", state.Message)
+			return setStorageUpgradeState(cr, state)
+		}
+		if (state == nil || state.done()) && o != nil && o.Target != nil {
+			v1helpers.SetOperatorCondition(&cr.Status.Conditions, operatorv1.OperatorCondition{
+				Type:    storageUpgradeCondition,
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "FeatureGateDisabled",
+				Message: fmt.Sprintf("The storage upgrade requires the %s feature gate", featuregates.StorageMigration),
+			})
+			return nil
+		}
+	}
+
+	if state == nil || state.done() {
+		if o == nil || o.Target == nil {
+			return nil
+		}
+		if state != nil && reflect.DeepEqual(state.Requested, *o.Target) {
+			return nil
+		}
+		return g.startStorageUpgrade(cr, *o.Target)
+	}
+
+	switch state.Phase {
+	case StorageUpgradePhaseSyncing:
+		if o == nil || o.Target == nil || !reflect.DeepEqual(state.Requested, *o.Target) {
+			state.Phase = StorageUpgradePhaseFailed
+			state.Message = "The storage upgrade was cancelled, the registry was left on its previous storage"
+			g.eventRecorder.Warningf("StorageUpgradeCancelled", "%s", state.Message)
+			return setStorageUpgradeState(cr, state)
+		}
+		return g.syncStorageUpgradeJob(cr, state, now)
+	case StorageUpgradePhaseFlipped:
+		window := defaultStorageUpgradeRollbackWindow
+		if o != nil && o.RollbackWindow != nil {
+			window = o.RollbackWindow.Duration
+		}
+		if !now.Before(state.FlippedAt.Add(window)) {
+			state.Phase = StorageUpgradePhaseCompleted
+			state.Message = "The rollback window ended, the previous storage can be deleted"
+			g.eventRecorder.Eventf("StorageUpgradeCompleted", "%s", state.Message)
+		} else if o != nil && o.Rollback {
+			state.Phase = StorageUpgradePhaseRollingBack
+			state.Message = fmt.Sprintf("The registry is read-only while its storage is copied back to %s", storage.StorageType(&state.Source))
+			g.eventRecorder.Eventf("StorageUpgradeRollingBack", "%s", state.Message)
+		} else {
+			return nil
+		}
+		return setStorageUpgradeState(cr, state)
+	case StorageUpgradePhaseRollingBack:
+		// the rollback window no longer applies, the rollback is
+		// either completed or cancelled.
+		if o == nil || !o.Rollback {
+			state.Phase = StorageUpgradePhaseFlipped
+			state.Message = fmt.Sprintf("The rollback was cancelled, the registry was left on %s", storage.StorageType(&state.Target))
+			g.eventRecorder.Warningf("StorageUpgradeRollbackCancelled", "%s", state.Message)
+			return setStorageUpgradeState(cr, state)
+		}
+		return g.syncStorageUpgradeJob(cr, state, now)
+	default:
+		return fmt.Errorf("unknown storage upgrade phase %q", state.Phase)
+	}
+}
+
+// startStorageUpgrade provisions the target storage and moves the upgrade
+// to the syncing phase. Upgrades that cannot be done are recorded as
+// failed, errors talking to the storage are returned to be retried.
+func (g *Generator) startStorageUpgrade(cr *imageregistryv1.Config, requested imageregistryv1.ImageRegistryConfigStorage) error {
+	state := &StorageUpgradeState{
+		Phase:     StorageUpgradePhaseFailed,
+		Requested: requested,
+		Source:    *cr.Spec.Storage.DeepCopy(),
+	}
+
+	if !storageConfigured(cr.Status.Storage) {
+		return fmt.Errorf("the registry storage has to be configured before it is upgraded")
+	}
+
+	source, err := storage.NewDriver(&state.Source, g.kubeconfig, &g.listers.StorageListers)
+	if err != nil {
+		return err
+	}
+
+	// the target storage is provisioned on a copy of the registry config,
+	// it is only used by the registry once the content has been copied.
+	// The status is cleared so the current storage is not reused for the
+	// target.
+	scratch := cr.DeepCopy()
+	scratch.Spec.Storage = *requested.DeepCopy()
+	scratch.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{}
+	target, err := storage.NewDriver(&scratch.Spec.Storage, g.kubeconfig, &g.listers.StorageListers)
+	if err != nil {
+		state.Message = fmt.Sprintf("Invalid target storage: %s", err)
+		return setStorageUpgradeState(cr, state)
+	}
+
+	_, sourceOK := source.(storage.ObjectStore)
+	_, targetOK := target.(storage.ObjectStore)
+	if !sourceOK || !targetOK {
+		state.Message = fmt.Sprintf("The storage cannot be upgraded from %s to %s", storage.StorageType(&state.Source), storage.StorageType(&requested))
+		return setStorageUpgradeState(cr, state)
+	}
+
+	// the current storage must not be provisioned again with the target
+	// settings, e.g. another region or encryption.
+	if storage.StorageType(&state.Source) == storage.StorageType(&requested) && target.ID() != "" && source.ID() == target.ID() {
+		state.Message = fmt.Sprintf("The target storage %s is the current storage of the registry", target.ID())
+		return setStorageUpgradeState(cr, state)
+	}
+
+	if err := target.CreateStorage(scratch); err != nil {
+		return fmt.Errorf("unable to provision the target storage: %w", err)
+	}
+
+	// the copy deletes the objects of the target storage that are not in
+	// the current storage, data already in the target would be lost.
+	if reader, ok := target.(storage.ConfigStateReader); ok {
+		reader.ReadConfigState(scratch)
+	}
+	empty, err := storage.Empty(context.TODO(), target.(storage.ObjectStore))
+	if err != nil {
+		return fmt.Errorf("unable to list the objects of the target storage: %w", err)
+	}
+	if !empty {
+		state.Message = fmt.Sprintf("The target storage %s is not empty, the registry can only be moved to empty storage", target.ID())
+		return setStorageUpgradeState(cr, state)
+	}
+
+	state.Phase = StorageUpgradePhaseSyncing
+	state.Target = scratch.Spec.Storage
+	state.Message = fmt.Sprintf("The registry is read-only while its storage is copied to %s %s", storage.StorageType(&state.Target), target.ID())
+	g.eventRecorder.Eventf("StorageUpgradeStarted", "%s", state.Message)
+	return setStorageUpgradeState(cr, state)
+}
+
+// syncStorageUpgradeJob moves the registry to the target storage, or back to
+// the previous storage during a rollback, once the storage sync job is
+// complete.
+func (g *Generator) syncStorageUpgradeJob(cr *imageregistryv1.Config, state *StorageUpgradeState, now time.Time) error {
+	job, err := g.listers.Jobs.Get(storageSyncJobName(state))
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch {
+		case cond.Type == batchapi.JobComplete && state.Phase == StorageUpgradePhaseRollingBack:
+			cr.Spec.Storage = *state.Source.DeepCopy()
+			state.Phase = StorageUpgradePhaseRolledBack
+			state.Message = fmt.Sprintf("The registry was moved back to its previous storage %s", storage.StorageType(&state.Source))
+			klog.Infof("storage sync job %s complete, moving the registry back to the previous storage", job.Name)
+			g.eventRecorder.Warningf("StorageUpgradeRolledBack", "%s", state.Message)
+			return setStorageUpgradeState(cr, state)
+		case cond.Type == batchapi.JobFailed && state.Phase == StorageUpgradePhaseRollingBack:
+			state.Phase = StorageUpgradePhaseFlipped
+			state.Message = fmt.Sprintf("The storage sync job %s failed: %s, the registry was left on %s", job.Name, cond.Message, storage.StorageType(&state.Target))
+			g.eventRecorder.Warningf("StorageUpgradeRollbackFailed", "%s", state.Message)
+			return setStorageUpgradeState(cr, state)
+		case cond.Type == batchapi.JobComplete:
+			cr.Spec.Storage = *state.Target.DeepCopy()
+			flippedAt := metav1.NewTime(now)
+			state.Phase = StorageUpgradePhaseFlipped
+			state.FlippedAt = &flippedAt
+			state.Message = fmt.Sprintf("The registry was moved to %s, it can be moved back to its previous storage until the rollback window ends", storage.StorageType(&state.Target))
+			klog.Infof("storage sync job %s complete, moving the registry to the target storage", job.Name)
+			g.eventRecorder.Eventf("StorageUpgradeFlipped", "%s", state.Message)
+			return setStorageUpgradeState(cr, state)
+		case cond.Type == batchapi.JobFailed:
+			state.Phase = StorageUpgradePhaseFailed
+			state.Message = fmt.Sprintf("The storage sync job %s failed: %s, the registry was left on its previous storage", job.Name, cond.Message)
+			g.eventRecorder.Warningf("StorageUpgradeFailed", "%s", state.Message)
+			return setStorageUpgradeState(cr, state)
+		}
+	}
+	return nil
+}
+
+// registryReadOnly returns true once every registry replica runs read-only,
+// so nothing is pushed to the storage while it is copied.
+func (g *Generator) registryReadOnly() (bool, error) {
+	deploy, err := g.listers.Deployments.Get(defaults.ImageRegistryName)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !isDeploymentStatusAvailableAndUpdated(deploy) {
+		return false, nil
+	}
+	for _, c := range deploy.Spec.Template.Spec.Containers {
+		for _, env := range c.Env {
+			if env.Name == "REGISTRY_STORAGE_MAINTENANCE_READONLY" {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
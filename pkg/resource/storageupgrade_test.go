@@ -0,0 +1,257 @@
+package resource
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+)
+
+func TestSyncStorageUpgrade(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	source := imageregistryv1.ImageRegistryConfigStorage{
+		S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "old", Region: "us-east-1"},
+	}
+	target := imageregistryv1.ImageRegistryConfigStorage{
+		S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "new", Region: "us-west-2"},
+	}
+	const overrides = `{"storageUpgrade":{"target":{"s3":{"bucket":"new","region":"us-west-2"}},"rollbackWindow":"1h"}}`
+
+	syncing := &StorageUpgradeState{Phase: StorageUpgradePhaseSyncing, Requested: target, Source: source, Target: target}
+	flippedAt := metav1.NewTime(now.Add(-30 * time.Minute))
+	flipped := &StorageUpgradeState{Phase: StorageUpgradePhaseFlipped, Requested: target, Source: source, Target: target, FlippedAt: &flippedAt}
+	rollingBack := &StorageUpgradeState{Phase: StorageUpgradePhaseRollingBack, Requested: target, Source: source, Target: target, FlippedAt: &flippedAt}
+	const rollbackOverrides = `{"storageUpgrade":{"target":{"s3":{"bucket":"new","region":"us-west-2"}},"rollback":true}}`
+
+	for _, tc := range []struct {
+		name            string
+		overrides       string
+		state           *StorageUpgradeState
+		jobCondition    batchv1.JobConditionType
+		gateDisabled    bool
+		now             time.Time
+		expectedPhase   StorageUpgradePhase
+		expectedStorage imageregistryv1.ImageRegistryConfigStorage
+	}{
+		{
+			name:            "sync in progress",
+			overrides:       overrides,
+			state:           syncing,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseSyncing,
+			expectedStorage: source,
+		},
+		{
+			name:            "sync complete",
+			overrides:       overrides,
+			state:           syncing,
+			jobCondition:    batchv1.JobComplete,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFlipped,
+			expectedStorage: target,
+		},
+		{
+			name:            "sync failed",
+			overrides:       overrides,
+			state:           syncing,
+			jobCondition:    batchv1.JobFailed,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFailed,
+			expectedStorage: source,
+		},
+		{
+			name:            "cancelled",
+			state:           syncing,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFailed,
+			expectedStorage: source,
+		},
+		{
+			name:            "rollback window open",
+			overrides:       overrides,
+			state:           flipped,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFlipped,
+			expectedStorage: target,
+		},
+		{
+			name:            "rollback",
+			overrides:       rollbackOverrides,
+			state:           flipped,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseRollingBack,
+			expectedStorage: target,
+		},
+		{
+			name:            "rollback copy in progress",
+			overrides:       rollbackOverrides,
+			state:           rollingBack,
+			now:             now.Add(time.Hour),
+			expectedPhase:   StorageUpgradePhaseRollingBack,
+			expectedStorage: target,
+		},
+		{
+			name:            "rollback copy complete",
+			overrides:       rollbackOverrides,
+			state:           rollingBack,
+			jobCondition:    batchv1.JobComplete,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseRolledBack,
+			expectedStorage: source,
+		},
+		{
+			name:            "rollback copy failed",
+			overrides:       rollbackOverrides,
+			state:           rollingBack,
+			jobCondition:    batchv1.JobFailed,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFlipped,
+			expectedStorage: target,
+		},
+		{
+			name:            "rollback cancelled",
+			overrides:       overrides,
+			state:           rollingBack,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFlipped,
+			expectedStorage: target,
+		},
+		{
+			name:            "rollback window ended",
+			overrides:       overrides,
+			state:           flipped,
+			now:             now.Add(time.Hour),
+			expectedPhase:   StorageUpgradePhaseCompleted,
+			expectedStorage: target,
+		},
+		{
+			name:            "feature gate disabled while syncing",
+			overrides:       overrides,
+			state:           syncing,
+			gateDisabled:    true,
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFailed,
+			expectedStorage: source,
+		},
+		{
+			name:            "same storage rejected before provisioning",
+			overrides:       `{"storageUpgrade":{"target":{"s3":{"bucket":"old","region":"us-west-2","encrypt":true}}}}`,
+			state:           &StorageUpgradeState{Phase: StorageUpgradePhaseCompleted, Source: target, Target: source},
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseFailed,
+			expectedStorage: source,
+		},
+		{
+			name:            "completed upgrade is not restarted",
+			overrides:       overrides,
+			state:           &StorageUpgradeState{Phase: StorageUpgradePhaseCompleted, Requested: target, Source: source, Target: target},
+			now:             now,
+			expectedPhase:   StorageUpgradePhaseCompleted,
+			expectedStorage: target,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tc.overrides)}
+			cr.Spec.Storage = *source.DeepCopy()
+			if tc.state.Phase != StorageUpgradePhaseSyncing {
+				cr.Spec.Storage = *tc.state.Target.DeepCopy()
+			}
+			cr.Status.Storage = *cr.Spec.Storage.DeepCopy()
+			if err := setStorageUpgradeState(cr, tc.state); err != nil {
+				t.Fatal(err)
+			}
+
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.jobCondition != "" {
+				job := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      storageSyncJobName(tc.state),
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+					},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{{Type: tc.jobCondition, Status: corev1.ConditionTrue}},
+					},
+				}
+				if err := indexer.Add(job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			g := &Generator{
+				eventRecorder: events.NewInMemoryRecorder("test"),
+				listers: &client.Listers{
+					Jobs: batchlisters.NewJobLister(indexer).Jobs(defaults.ImageRegistryOperatorNamespace),
+				},
+			}
+			gates := featuregates.Gates{featuregates.StorageMigration: !tc.gateDisabled}
+			if err := g.syncStorageUpgrade(cr, gates, tc.now); err != nil {
+				t.Fatal(err)
+			}
+
+			state, err := GetStorageUpgradeState(cr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Phase != tc.expectedPhase {
+				t.Errorf("got phase %s, want %s: %s", state.Phase, tc.expectedPhase, state.Message)
+			}
+			if cr.Spec.Storage.S3.Bucket != tc.expectedStorage.S3.Bucket {
+				t.Errorf("got bucket %s, want %s", cr.Spec.Storage.S3.Bucket, tc.expectedStorage.S3.Bucket)
+			}
+		})
+	}
+}
+
+func TestStorageUpgradeFeatureGateDisabled(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(`{"storageUpgrade":{"target":{"s3":{"bucket":"new"}}}}`)}
+	cr.Spec.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "old"}
+	cr.Status.Storage.S3 = &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "old"}
+
+	g := &Generator{eventRecorder: events.NewInMemoryRecorder("test")}
+	if err := g.syncStorageUpgrade(cr, featuregates.Gates{}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := GetStorageUpgradeState(cr); err != nil || state != nil {
+		t.Errorf("got state %#v, %v, want no upgrade started", state, err)
+	}
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageUpgradeCondition)
+	if cond == nil || cond.Reason != "FeatureGateDisabled" {
+		t.Errorf("got condition %#v, want reason FeatureGateDisabled", cond)
+	}
+}
+
+func TestStorageUpgradeReadOnly(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	if syncing, err := storageUpgradeSyncing(cr); err != nil || syncing {
+		t.Fatalf("got %t, %v, want false without an upgrade", syncing, err)
+	}
+
+	if err := setStorageUpgradeState(cr, &StorageUpgradeState{Phase: StorageUpgradePhaseSyncing}); err != nil {
+		t.Fatal(err)
+	}
+	if syncing, err := storageUpgradeSyncing(cr); err != nil || !syncing {
+		t.Fatalf("got %t, %v, want true while syncing", syncing, err)
+	}
+
+	if err := setStorageUpgradeState(cr, &StorageUpgradeState{Phase: StorageUpgradePhaseRollingBack}); err != nil {
+		t.Fatal(err)
+	}
+	if syncing, err := storageUpgradeSyncing(cr); err != nil || !syncing {
+		t.Fatalf("got %t, %v, want true while rolling back", syncing, err)
+	}
+}
@@ -19,6 +19,9 @@ func Service(o, n *corev1.Service) (bool, error) {
 	Metadata(&o.ObjectMeta, &n.ObjectMeta)
 	o.Spec.Selector = n.Spec.Selector
 	o.Spec.Type = n.Spec.Type
+	if n.Spec.ClusterIP != "" {
+		o.Spec.ClusterIP = n.Spec.ClusterIP
+	}
 	o.Spec.Ports = n.Spec.Ports
 
 	if o.Annotations == nil {
@@ -0,0 +1,161 @@
+package resource
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var _ Mutator = &generatorSwiftTempURLSecret{}
+
+// generatorSwiftTempURLSecret generates the secret holding the temporary URL
+// keys for the registry Swift container. The Swift storage driver takes care
+// of setting the keys on the container and of passing them to the registry.
+type generatorSwiftTempURLSecret struct {
+	lister      corelisters.SecretNamespaceLister
+	client      coreset.CoreV1Interface
+	overrides   *SwiftTempURLOverrides
+	maintenance *maintenance
+	now         func() time.Time
+}
+
+func newGeneratorSwiftTempURLSecret(lister corelisters.SecretNamespaceLister, client coreset.CoreV1Interface, overrides *SwiftTempURLOverrides, m *maintenance) *generatorSwiftTempURLSecret {
+	return &generatorSwiftTempURLSecret{
+		lister:      lister,
+		client:      client,
+		overrides:   overrides,
+		maintenance: m,
+		now:         time.Now,
+	}
+}
+
+// swiftTempURLEnabled returns true if the registry uses Swift and the user has
+// asked for temporary URL keys to be managed.
+func swiftTempURLEnabled(cr *imageregistryv1.Config) (bool, *SwiftTempURLOverrides, error) {
+	if cr.Spec.Storage.Swift == nil {
+		return false, nil, nil
+	}
+	overrides, err := GetConfigOverrides(cr)
+	if err != nil {
+		return false, nil, err
+	}
+	if overrides.Storage == nil || overrides.Storage.Swift == nil || overrides.Storage.Swift.TempURL == nil {
+		return false, nil, nil
+	}
+	if !overrides.Storage.Swift.TempURL.Enabled {
+		return false, nil, nil
+	}
+	return true, overrides.Storage.Swift.TempURL, nil
+}
+
+func generateSwiftTempURLKey() ([]byte, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(buf)), nil
+}
+
+func (gs *generatorSwiftTempURLSecret) Type() runtime.Object {
+	return &corev1.Secret{}
+}
+
+func (gs *generatorSwiftTempURLSecret) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gs *generatorSwiftTempURLSecret) GetName() string {
+	return defaults.SwiftTempURLKeySecretName
+}
+
+// rotationDue returns true if the key in the current secret is older than
+// the configured rotation interval and the maintenance window is open.
+func (gs *generatorSwiftTempURLSecret) rotationDue(current *corev1.Secret) bool {
+	if gs.overrides == nil || gs.overrides.RotationInterval == nil || gs.overrides.RotationInterval.Duration <= 0 {
+		return false
+	}
+	rotated, err := time.Parse(time.RFC3339, current.Annotations[defaults.SwiftTempURLKeyRotatedAnnotation])
+	if err == nil && gs.now().Before(rotated.Add(gs.overrides.RotationInterval.Duration)) {
+		return false
+	}
+	return gs.maintenance.allowed("Swift temporary URL key rotation")
+}
+
+func (gs *generatorSwiftTempURLSecret) expected() (runtime.Object, error) {
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        gs.GetName(),
+			Namespace:   gs.GetNamespace(),
+			Annotations: map[string]string{},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{},
+	}
+
+	current, err := gs.lister.Get(gs.GetName())
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if current != nil && len(current.Data[defaults.SwiftTempURLKey]) > 0 && !gs.rotationDue(current) {
+		sec.Annotations[defaults.SwiftTempURLKeyRotatedAnnotation] = current.Annotations[defaults.SwiftTempURLKeyRotatedAnnotation]
+		sec.Data[defaults.SwiftTempURLKey] = current.Data[defaults.SwiftTempURLKey]
+		if previous := current.Data[defaults.SwiftTempURLPreviousKey]; len(previous) > 0 {
+			sec.Data[defaults.SwiftTempURLPreviousKey] = previous
+		}
+		return sec, nil
+	}
+
+	key, err := generateSwiftTempURLKey()
+	if err != nil {
+		return nil, err
+	}
+	sec.Annotations[defaults.SwiftTempURLKeyRotatedAnnotation] = gs.now().UTC().Format(time.RFC3339)
+	sec.Data[defaults.SwiftTempURLKey] = key
+	if current != nil && len(current.Data[defaults.SwiftTempURLKey]) > 0 {
+		sec.Data[defaults.SwiftTempURLPreviousKey] = current.Data[defaults.SwiftTempURLKey]
+	}
+	return sec, nil
+}
+
+func (gs *generatorSwiftTempURLSecret) Get() (runtime.Object, error) {
+	return gs.lister.Get(gs.GetName())
+}
+
+func (gs *generatorSwiftTempURLSecret) Create() (runtime.Object, error) {
+	return commonCreate(gs, func(obj runtime.Object) (runtime.Object, error) {
+		return gs.client.Secrets(gs.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.Secret), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gs *generatorSwiftTempURLSecret) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gs, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gs.client.Secrets(gs.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.Secret), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gs *generatorSwiftTempURLSecret) Delete(opts metav1.DeleteOptions) error {
+	return gs.client.Secrets(gs.GetNamespace()).Delete(
+		context.TODO(), gs.GetName(), opts,
+	)
+}
+
+func (gs *generatorSwiftTempURLSecret) Owned() bool {
+	return true
+}
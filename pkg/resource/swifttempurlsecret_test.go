@@ -0,0 +1,106 @@
+package resource
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kcorelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestSwiftTempURLSecretRotation(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	rotationInterval := &metav1.Duration{Duration: 24 * time.Hour}
+
+	newCurrent := func(rotated time.Time) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.SwiftTempURLKeySecretName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+				Annotations: map[string]string{
+					defaults.SwiftTempURLKeyRotatedAnnotation: rotated.Format(time.RFC3339),
+				},
+			},
+			Data: map[string][]byte{
+				defaults.SwiftTempURLKey:         []byte("current"),
+				defaults.SwiftTempURLPreviousKey: []byte("previous"),
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name             string
+		current          *corev1.Secret
+		rotationInterval *metav1.Duration
+		rotated          bool
+	}{
+		{
+			name:    "new key",
+			rotated: true,
+		},
+		{
+			name:    "no rotation interval",
+			current: newCurrent(now.Add(-365 * 24 * time.Hour)),
+		},
+		{
+			name:             "rotation not due",
+			current:          newCurrent(now.Add(-time.Hour)),
+			rotationInterval: rotationInterval,
+		},
+		{
+			name:             "rotation due",
+			current:          newCurrent(now.Add(-25 * time.Hour)),
+			rotationInterval: rotationInterval,
+			rotated:          true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.current != nil {
+				if err := indexer.Add(tt.current); err != nil {
+					t.Fatal(err)
+				}
+			}
+			lister := kcorelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace)
+
+			gen := newGeneratorSwiftTempURLSecret(lister, nil, &SwiftTempURLOverrides{
+				Enabled:          true,
+				RotationInterval: tt.rotationInterval,
+			}, nil)
+			gen.now = func() time.Time { return now }
+
+			obj, err := gen.expected()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sec := obj.(*corev1.Secret)
+			key := string(sec.Data[defaults.SwiftTempURLKey])
+			previousKey := string(sec.Data[defaults.SwiftTempURLPreviousKey])
+
+			if !tt.rotated {
+				if key != "current" || previousKey != "previous" {
+					t.Errorf("expected keys to be preserved, got key %q and previous key %q", key, previousKey)
+				}
+				return
+			}
+
+			if len(key) != 64 || key == "current" {
+				t.Errorf("expected a new key, got %q", key)
+			}
+			wantPrevious := ""
+			if tt.current != nil {
+				wantPrevious = "current"
+			}
+			if previousKey != wantPrevious {
+				t.Errorf("got previous key %q, want %q", previousKey, wantPrevious)
+			}
+			if got := sec.Annotations[defaults.SwiftTempURLKeyRotatedAnnotation]; got != now.Format(time.RFC3339) {
+				t.Errorf("got rotation time %q, want %q", got, now.Format(time.RFC3339))
+			}
+		})
+	}
+}
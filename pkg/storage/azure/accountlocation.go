@@ -0,0 +1,110 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageAccountLocationCondition reports where the storage account was
+// found after the credentials moved to another subscription or resource
+// group.
+const storageAccountLocationCondition = "AzureStorageAccountLocation"
+
+// errAccountMoved is returned when the credentials no longer point to the
+// subscription and resource group the storage account was recorded in, and
+// the account cannot be found in the new ones.
+type errAccountMoved struct {
+	recorded string
+	current  string
+}
+
+func (e *errAccountMoved) Error() string {
+	return fmt.Sprintf("the storage account %s cannot be found at %s, the credentials point to another subscription or resource group", e.recorded, e.current)
+}
+
+// accountID returns the resource ID of the storage account in the
+// subscription and resource group of cfg.
+func accountID(cfg *Azure, accountName string) string {
+	return fmt.Sprintf(
+		"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s",
+		cfg.SubscriptionID, cfg.ResourceGroup, accountName,
+	)
+}
+
+// recordedAccountID returns the resource ID recorded for the storage
+// account, or an empty string if the recorded ID is for another account.
+func recordedAccountID(cr *imageregistryv1.Config, accountName string) string {
+	recorded := cr.Annotations[defaults.AzureStorageAccountIDAnnotation]
+	if !strings.HasSuffix(strings.ToLower(recorded), "/storageaccounts/"+strings.ToLower(accountName)) {
+		return ""
+	}
+	return recorded
+}
+
+// recordAccountID records the resource ID of the storage account on the
+// registry config. Nothing is recorded for accounts reached with a user
+// provided key, their location is unknown.
+func recordAccountID(cr *imageregistryv1.Config, cfg *Azure, accountName string) {
+	if cfg.AccountKey != "" || accountName == "" {
+		return
+	}
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	cr.Annotations[defaults.AzureStorageAccountIDAnnotation] = accountID(cfg, accountName)
+}
+
+// syncAccountLocation detects the credentials moving to another subscription
+// or resource group. If the storage account is found there, i.e. it was
+// moved along with the cluster, its new location is recorded. Otherwise an
+// errAccountMoved is returned and the account in the old location is left
+// alone.
+func (d *driver) syncAccountLocation(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	if cfg.AccountKey != "" || d.Config.AccountName == "" {
+		return nil
+	}
+
+	recorded := recordedAccountID(cr, d.Config.AccountName)
+	current := accountID(cfg, d.Config.AccountName)
+	if recorded == "" || strings.EqualFold(recorded, current) {
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	account, err := storageAccountsClient.GetProperties(d.Context, cfg.ResourceGroup, d.Config.AccountName, "")
+	if err != nil {
+		if e, ok := err.(autorest.DetailedError); ok && e.StatusCode == http.StatusNotFound {
+			moved := &errAccountMoved{recorded: recorded, current: current}
+			util.UpdateCondition(cr, storageAccountLocationCondition, operatorapiv1.ConditionFalse, "AccountNotFound",
+				fmt.Sprintf("The storage account %s was not found in subscription %s, resource group %s, it was last seen at %s",
+					d.Config.AccountName, cfg.SubscriptionID, cfg.ResourceGroup, recorded))
+			return moved
+		}
+		return fmt.Errorf("unable to get the properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+
+	location := "an unknown region"
+	if account.Location != nil {
+		location = *account.Location
+	}
+	klog.Infof("the storage account %s moved from %s to %s", d.Config.AccountName, recorded, current)
+	recordAccountID(cr, cfg, d.Config.AccountName)
+	util.UpdateCondition(cr, storageAccountLocationCondition, operatorapiv1.ConditionTrue, "AccountMoved",
+		fmt.Sprintf("The storage account %s was found in subscription %s, resource group %s, in %s",
+			d.Config.AccountName, cfg.SubscriptionID, cfg.ResourceGroup, location))
+	return nil
+}
@@ -0,0 +1,120 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestSyncAccountLocation(t *testing.T) {
+	const (
+		oldID = "/subscriptions/old_subscription/resourceGroups/resource_group/providers/Microsoft.Storage/storageAccounts/account"
+		newID = "/subscriptions/subscription_id/resourceGroups/resource_group/providers/Microsoft.Storage/storageAccounts/account"
+	)
+
+	for _, tt := range []struct {
+		name       string
+		recorded   string
+		code       int
+		body       string
+		requests   int
+		moved      bool
+		expectedID string
+		status     operatorapiv1.ConditionStatus
+	}{
+		{
+			name: "nothing recorded",
+		},
+		{
+			name:       "same location",
+			recorded:   newID,
+			expectedID: newID,
+		},
+		{
+			name:       "recorded for another account",
+			recorded:   "/subscriptions/old_subscription/resourceGroups/resource_group/providers/Microsoft.Storage/storageAccounts/another",
+			expectedID: "/subscriptions/old_subscription/resourceGroups/resource_group/providers/Microsoft.Storage/storageAccounts/another",
+		},
+		{
+			name:       "moved along with the credentials",
+			recorded:   oldID,
+			code:       http.StatusOK,
+			body:       `{"location":"westeurope"}`,
+			requests:   1,
+			expectedID: newID,
+			status:     operatorapiv1.ConditionTrue,
+		},
+		{
+			name:       "left in the old subscription",
+			recorded:   oldID,
+			code:       http.StatusNotFound,
+			body:       `{"error":{"code":"ResourceNotFound"}}`,
+			requests:   1,
+			moved:      true,
+			expectedID: oldID,
+			status:     operatorapiv1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{}
+			if tt.code != 0 {
+				sender.AddResponse(tt.code, tt.body)
+			}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			cr := &imageregistryv1.Config{}
+			if tt.recorded != "" {
+				cr.Annotations = map[string]string{defaults.AzureStorageAccountIDAnnotation: tt.recorded}
+			}
+			environment, _ := getEnvironmentByName("")
+			err := drv.syncAccountLocation(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment)
+			if _, moved := err.(*errAccountMoved); moved != tt.moved || (err != nil && !moved) {
+				t.Fatalf("got error %v, want account moved error: %t", err, tt.moved)
+			}
+
+			if got := len(sender.Requests()); got != tt.requests {
+				t.Errorf("got %d requests, want %d", got, tt.requests)
+			}
+			if got := cr.Annotations[defaults.AzureStorageAccountIDAnnotation]; got != tt.expectedID {
+				t.Errorf("got recorded account %q, want %q", got, tt.expectedID)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageAccountLocationCondition)
+			if tt.status == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Status != tt.status {
+				t.Errorf("got condition %#v, want status %s", cond, tt.status)
+			}
+		})
+	}
+}
+
+func TestRecordAccountID(t *testing.T) {
+	cr := &imageregistryv1.Config{ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName}}
+
+	recordAccountID(cr, &Azure{AccountKey: "key"}, "account")
+	if _, ok := cr.Annotations[defaults.AzureStorageAccountIDAnnotation]; ok {
+		t.Errorf("expected nothing to be recorded for a user provided account key")
+	}
+
+	recordAccountID(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, "account")
+	expected := "/subscriptions/subscription_id/resourceGroups/resource_group/providers/Microsoft.Storage/storageAccounts/account"
+	if got := cr.Annotations[defaults.AzureStorageAccountIDAnnotation]; got != expected {
+		t.Errorf("got recorded account %q, want %q", got, expected)
+	}
+}
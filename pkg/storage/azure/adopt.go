@@ -0,0 +1,185 @@
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// clusterTagPrefix prefixes the key of the tag identifying the cluster
+// owning a storage account, it is followed by the infrastructure name.
+const clusterTagPrefix = "kubernetes.io_cluster."
+
+// adoptionEnabled returns true if the user opted in to the adoption of a
+// storage account left behind by a previous installation of the cluster.
+func adoptionEnabled(cr *imageregistryv1.Config) bool {
+	return cr.Annotations[defaults.AdoptStorageAnnotation] == "true"
+}
+
+// findClusterAccounts returns the storage accounts of the resource group
+// owned by the cluster or by a previous installation of it, along with their
+// tags. Only the resource group of the cluster is searched: the installer
+// creates a resource group for each installation and deletes it, storage
+// account included, when the installation is destroyed, so accounts are
+// only left behind in resource groups provided by the user.
+func (d *driver) findClusterAccounts(cli storage.AccountsClient, resourceGroup, infrastructureName string) (map[string]map[string]*string, error) {
+	accounts, err := cli.ListByResourceGroup(d.Context, resourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the storage accounts of the resource group %s: %w", resourceGroup, err)
+	}
+
+	found := map[string]map[string]*string{}
+	if accounts.Value == nil {
+		return found, nil
+	}
+	for _, account := range *accounts.Value {
+		if account.Name == nil {
+			continue
+		}
+		for k, v := range account.Tags {
+			if !strings.HasPrefix(k, clusterTagPrefix) || v == nil || *v != "owned" {
+				continue
+			}
+			owner := strings.TrimPrefix(k, clusterTagPrefix)
+			if owner == infrastructureName || util.PreviousInstallation(infrastructureName, owner) {
+				found[*account.Name] = account.Tags
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// findAccountContainer returns the only container of the storage account, or
+// an empty string if it has none.
+func (d *driver) findAccountContainer(cli storage.AccountsClient, environment autorestazure.Environment, cfg *Azure, accountName string) (string, error) {
+	client := storage.NewBlobContainersClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	client.Client = cli.Client
+
+	it, err := client.ListComplete(d.Context, cfg.ResourceGroup, accountName, "", "", "")
+	if err != nil {
+		return "", fmt.Errorf("unable to list the containers of the storage account %s: %w", accountName, err)
+	}
+	var containers []string
+	for it.NotDone() {
+		if name := it.Value().Name; name != nil {
+			containers = append(containers, *name)
+		}
+		if err := it.NextWithContext(d.Context); err != nil {
+			return "", fmt.Errorf("unable to list the containers of the storage account %s: %w", accountName, err)
+		}
+	}
+
+	switch len(containers) {
+	case 0:
+		return "", nil
+	case 1:
+		return containers[0], nil
+	default:
+		sort.Strings(containers)
+		return "", fmt.Errorf("the storage account %s has the containers %s, set the one to adopt in spec.storage.azure.container", accountName, strings.Join(containers, ", "))
+	}
+}
+
+// adoptStorageAccount looks for storage accounts left behind by previous
+// installations of the cluster when the registry storage is created. When
+// the user opted in, the only one found is adopted, along with its
+// container, and tagged as owned by the cluster. They are reported
+// otherwise, so they do not accumulate unnoticed across installation
+// attempts. It returns true if an account was adopted.
+func (d *driver) adoptStorageAccount(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment, infra *configv1.Infrastructure) (bool, error) {
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return false, err
+	}
+	found, err := d.findClusterAccounts(storageAccountsClient, cfg.ResourceGroup, infra.Status.InfrastructureName)
+	if err != nil {
+		if adoptionEnabled(cr) {
+			return false, err
+		}
+		klog.Warningf("unable to look for storage accounts left behind by previous installations: %s", err)
+		return false, nil
+	}
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !adoptionEnabled(cr) || len(names) == 0 {
+		util.ReportOrphanedStorage(cr, names)
+		return false, nil
+	}
+	if len(names) > 1 {
+		return false, fmt.Errorf("the storage accounts %s were left behind by previous installations of the cluster, set the one to adopt in spec.storage.azure.accountName", strings.Join(names, ", "))
+	}
+	accountName := names[0]
+
+	container, err := d.findAccountContainer(storageAccountsClient, environment, cfg, accountName)
+	if err != nil {
+		return false, err
+	}
+
+	tags := map[string]*string{}
+	for k, v := range found[accountName] {
+		tags[k] = v
+	}
+	for k, v := range accountTags(infra) {
+		tags[k] = v
+	}
+	_, err = storageAccountsClient.Update(d.Context, cfg.ResourceGroup, accountName, storage.AccountUpdateParameters{
+		Tags: tags,
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to tag the storage account %s as owned by the cluster: %w", accountName, err)
+	}
+
+	klog.Infof("adopting the storage account %s left behind by a previous installation of the cluster", accountName)
+	d.Config.AccountName = accountName
+	d.Config.Container = container
+	util.ReportOrphanedStorage(cr, nil)
+	return true, nil
+}
+
+// syncOrphanedStorage looks again for the storage accounts reported as left
+// behind by previous installations of the cluster, so the OrphanedStorage
+// condition is cleared once they are deleted. Nothing is listed while the
+// condition is not set.
+func (d *driver) syncOrphanedStorage(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	if v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.OrphanedStorage) == nil {
+		return nil
+	}
+
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return err
+	}
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	found, err := d.findClusterAccounts(storageAccountsClient, cfg.ResourceGroup, infra.Status.InfrastructureName)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range found {
+		if name != d.Config.AccountName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	util.ReportOrphanedStorage(cr, names)
+	return nil
+}
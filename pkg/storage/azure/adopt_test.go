@@ -0,0 +1,166 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestAdoptStorageAccount(t *testing.T) {
+	const (
+		previous = `{"name":"oldaccount","tags":{"kubernetes.io_cluster.mycluster-a1b2c":"owned"}}`
+		another  = `{"name":"otheraccount","tags":{"kubernetes.io_cluster.othercluster-a1b2c":"owned"}}`
+	)
+
+	for _, tt := range []struct {
+		name              string
+		adopt             bool
+		responseBodies    []string
+		expectedAdopted   bool
+		expectedAccount   string
+		expectedContainer string
+		expectedOrphaned  bool
+		err               string
+	}{
+		{
+			name:           "no account left behind",
+			responseBodies: []string{`{"value":[` + another + `]}`},
+		},
+		{
+			name:             "account left behind without opt-in",
+			responseBodies:   []string{`{"value":[` + previous + `,` + another + `]}`},
+			expectedOrphaned: true,
+		},
+		{
+			name:              "account left behind with opt-in",
+			adopt:             true,
+			responseBodies:    []string{`{"value":[` + previous + `,` + another + `]}`, `{"value":[{"name":"image-registry"}]}`, previous},
+			expectedAdopted:   true,
+			expectedAccount:   "oldaccount",
+			expectedContainer: "image-registry",
+		},
+		{
+			name:           "several accounts left behind",
+			adopt:          true,
+			responseBodies: []string{`{"value":[` + previous + `,{"name":"olderaccount","tags":{"kubernetes.io_cluster.mycluster-z9y8x":"owned"}}]}`},
+			err:            "the storage accounts oldaccount, olderaccount were left behind",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{}
+			for _, body := range tt.responseBodies {
+				sender.AddJSONResponse(http.StatusOK, body)
+			}
+
+			cr := &imageregistryv1.Config{}
+			if tt.adopt {
+				cr.Annotations = map[string]string{defaults.AdoptStorageAnnotation: "true"}
+			}
+			infra := &configv1.Infrastructure{}
+			infra.Status.InfrastructureName = "mycluster-x2k4p"
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			environment, _ := getEnvironmentByName("")
+			adopted, err := drv.adoptStorageAccount(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment, infra)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if adopted != tt.expectedAdopted {
+				t.Errorf("got adopted %t, want %t", adopted, tt.expectedAdopted)
+			}
+			if drv.Config.AccountName != tt.expectedAccount || drv.Config.Container != tt.expectedContainer {
+				t.Errorf("got account %q and container %q, want %q and %q", drv.Config.AccountName, drv.Config.Container, tt.expectedAccount, tt.expectedContainer)
+			}
+			reqs := sender.Requests()
+			if len(reqs) != len(tt.responseBodies) {
+				t.Fatalf("got %d requests, want %d", len(reqs), len(tt.responseBodies))
+			}
+			if tt.expectedAdopted {
+				update := reqs[len(reqs)-1]
+				if update.Method != http.MethodPatch || !strings.Contains(string(update.Body), `"kubernetes.io_cluster.mycluster-x2k4p":"owned"`) || !strings.Contains(string(update.Body), `"kubernetes.io_cluster.mycluster-a1b2c":"owned"`) {
+					t.Errorf("got %s request %s, want the account tagged as owned by the cluster", update.Method, update.Body)
+				}
+			}
+			if cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.OrphanedStorage); (cond != nil) != tt.expectedOrphaned {
+				t.Errorf("got condition %#v, want orphaned storage reported %t", cond, tt.expectedOrphaned)
+			}
+		})
+	}
+}
+
+func TestSyncOrphanedStorage(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		reported         bool
+		responseBody     string
+		expectedRequests int
+		expectedOrphaned bool
+	}{
+		{
+			name: "not reported",
+		},
+		{
+			name:             "still left behind",
+			reported:         true,
+			responseBody:     `{"value":[{"name":"account"},{"name":"oldaccount","tags":{"kubernetes.io_cluster.user-a1b2c":"owned"}}]}`,
+			expectedRequests: 1,
+			expectedOrphaned: true,
+		},
+		{
+			name:             "deleted",
+			reported:         true,
+			responseBody:     `{"value":[{"name":"account","tags":{"kubernetes.io_cluster.user-j45xj":"owned"}}]}`,
+			expectedRequests: 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{}
+			if tt.responseBody != "" {
+				sender.AddJSONResponse(http.StatusOK, tt.responseBody)
+			}
+
+			cr := &imageregistryv1.Config{}
+			if tt.reported {
+				util.ReportOrphanedStorage(cr, []string{"oldaccount"})
+			}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, &regopclient.StorageListers{
+				Infrastructures: fakeInfrastructureLister("resource_group"),
+			})
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncOrphanedStorage(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment); err != nil {
+				t.Fatal(err)
+			}
+			if reqs := sender.Requests(); len(reqs) != tt.expectedRequests {
+				t.Errorf("got %d requests, want %d", len(reqs), tt.expectedRequests)
+			}
+			if cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.OrphanedStorage); (cond != nil) != tt.expectedOrphaned {
+				t.Errorf("got condition %#v, want orphaned storage reported %t", cond, tt.expectedOrphaned)
+			}
+		})
+	}
+}
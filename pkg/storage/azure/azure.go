@@ -20,6 +20,8 @@ import (
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/jongio/azidext/go/azidext"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/time/rate"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -35,6 +37,9 @@ import (
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/calllog"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/faultinject"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
@@ -46,7 +51,9 @@ const (
 	storageExistsReasonContainerNotFound = "ContainerNotFound"
 	storageExistsReasonContainerExists   = "ContainerExists"
 	storageExistsReasonContainerDeleted  = "ContainerDeleted"
+	storageExistsReasonDeletingBlobs     = "DeletingBlobs"
 	storageExistsReasonAccountDeleted    = "AccountDeleted"
+	storageExistsReasonAccountMoved      = "AccountMoved"
 )
 
 // storageAccountInvalidCharRe is a regular expression for characters that
@@ -67,6 +74,11 @@ type Azure struct {
 	ResourceGroup      string
 	Region             string
 	FederatedTokenFile string
+	// UseManagedIdentity makes the operator authenticate with the
+	// managed identity of the node it runs on, the user-assigned one
+	// identified by ClientID or the system-assigned one if ClientID is
+	// empty.
+	UseManagedIdentity bool
 
 	// UPI
 	AccountKey string
@@ -80,6 +92,19 @@ func (e *errDoesNotExist) Error() string {
 	return e.Err.Error()
 }
 
+// CredentialsSource returns how the Azure credentials are sourced.
+func (d *driver) CredentialsSource() (util.CredentialsSource, error) {
+	return util.GetCredentialsSource(d.Listers.Secrets, func(sec *corev1.Secret) util.CredentialsMode {
+		switch {
+		case string(sec.Data["azure_use_managed_identity"]) == "true":
+			return util.CredentialsModeNodeIdentity
+		case len(sec.Data["azure_federated_token_file"]) > 0:
+			return util.CredentialsModeWorkloadIdentity
+		}
+		return util.CredentialsModeMinted
+	})
+}
+
 // GetConfig reads configuration for the Azure cloud platform services. It first attempts to
 // load credentials from ImageRegistryPrivateConfigurationUser secret, if this secret is not
 // present this function loads credentials from cluster wide config present on secret
@@ -104,10 +129,12 @@ func GetConfig(secLister kcorelisters.SecretNamespaceLister, infraLister configl
 			ResourceGroup:      string(sec.Data["azure_resourcegroup"]),
 			Region:             string(sec.Data["azure_region"]),
 			FederatedTokenFile: string(sec.Data["azure_federated_token_file"]),
+			UseManagedIdentity: string(sec.Data["azure_use_managed_identity"]) == "true",
 		}
 
-		// when using azure workload identities, the secret does not contain
-		// a resource group, as it is not known at the time of its creation.
+		// when using azure workload identities or managed identities, the
+		// secret does not contain a resource group, as it is not known at
+		// the time of its creation.
 		if cfg.ResourceGroup == "" {
 			infra, err := util.GetInfrastructure(infraLister)
 			if err != nil {
@@ -147,12 +174,17 @@ func getEnvironmentByName(name string) (autorestazure.Environment, error) {
 // Account. Storage account names must be between 3 and 24 characters in
 // length and use numbers and lower-case letters only.
 func generateAccountName(infrastructureName string) string {
+	return strings.ToLower(accountNamePrefix(infrastructureName) + rand.String(5))
+}
+
+// accountNamePrefix returns the part of the generated storage account names
+// that is derived from the cluster.
+func accountNamePrefix(infrastructureName string) string {
 	prefix := "imageregistry" + storageAccountInvalidCharRe.ReplaceAllString(infrastructureName, "")
 	if len(prefix) > 24-5 {
 		prefix = prefix[:24-5]
 	}
-	prefix = prefix + rand.String(5)
-	return strings.ToLower(prefix)
+	return prefix
 }
 
 func getBlobServiceURL(environment autorestazure.Environment, accountName string) (*url.URL, error) {
@@ -169,23 +201,36 @@ func (d *driver) accountExists(storageAccountsClient storage.AccountsClient, acc
 	)
 }
 
-func (d *driver) createStorageAccount(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName, location, cloudName string, tagset map[string]*string) error {
-	klog.Infof("attempt to create azure storage account %s (resourceGroup=%q, location=%q)...", accountName, resourceGroupName, location)
+func (d *driver) createStorageAccount(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName, location, cloudName string, tagset map[string]*string, encryption *Encryption, sku storage.SkuName) error {
+	klog.Infof("attempt to create azure storage account %s (resourceGroup=%q, location=%q, sku=%q)...", accountName, resourceGroupName, location, sku)
 
-	kind := storage.StorageV2
+	kind := accountKind(sku, cloudName)
 	params := &storage.AccountPropertiesCreateParameters{
 		EnableHTTPSTrafficOnly: to.BoolPtr(true),
 		AllowBlobPublicAccess:  to.BoolPtr(false),
 		MinimumTLSVersion:      storage.TLS12,
 	}
+	decorators := []autorest.PrepareDecorator{withProtocolsDisabled()}
 
 	if strings.EqualFold(cloudName, "AZURESTACKCLOUD") {
 		// It seems Azure Stack Hub does not support new API.
-		kind = storage.Storage
 		params = &storage.AccountPropertiesCreateParameters{}
+		decorators = nil
+		if encryption != nil && encryption.KeyVaultProperties != nil {
+			return fmt.Errorf("customer-managed keys are not supported on Azure Stack Hub")
+		}
+		if d.disableSharedKey {
+			return fmt.Errorf("shared key access cannot be disabled on Azure Stack Hub")
+		}
+	}
+	if encryption != nil && encryption.KeyVaultProperties != nil {
+		decorators = append(decorators, withEncryption(encryption.KeyVaultProperties))
+	}
+	if d.disableSharedKey {
+		decorators = append(decorators, withSharedKeyAccessDisabled())
 	}
 
-	future, err := storageAccountsClient.Create(
+	req, err := storageAccountsClient.CreatePreparer(
 		d.Context,
 		resourceGroupName,
 		accountName,
@@ -193,12 +238,20 @@ func (d *driver) createStorageAccount(storageAccountsClient storage.AccountsClie
 			Kind:     kind,
 			Location: to.StringPtr(location),
 			Sku: &storage.Sku{
-				Name: storage.StandardLRS,
+				Name: sku,
 			},
 			AccountPropertiesCreateParameters: params,
 			Tags:                              tagset,
 		},
 	)
+	if err == nil {
+		req, err = autorest.Prepare(req, decorators...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to prepare the storage account creation: %s", err)
+	}
+
+	future, err := storageAccountsClient.CreateSender(req)
 	if err != nil {
 		return fmt.Errorf("failed to start creating storage account: %s", err)
 	}
@@ -219,8 +272,10 @@ func (d *driver) createStorageAccount(storageAccountsClient storage.AccountsClie
 	return nil
 }
 
-func (d *driver) getAccountPrimaryKey(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName string) (string, error) {
-	key, err := primaryKey.get(d.Context, storageAccountsClient, resourceGroupName, accountName)
+// getAccountKey returns the key of the storage account the registry uses,
+// key1 unless the keys were rotated.
+func (d *driver) getAccountKey(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName string) (string, error) {
+	key, err := primaryKey.get(d.Context, storageAccountsClient, resourceGroupName, accountName, d.activeKey())
 	if err != nil {
 		wrappedErr := fmt.Errorf("failed to get keys for the storage account %s: %s", accountName, err)
 		if e, ok := err.(autorest.DetailedError); ok {
@@ -234,15 +289,15 @@ func (d *driver) getAccountPrimaryKey(storageAccountsClient storage.AccountsClie
 	return key, nil
 }
 
-func (d *driver) getStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) (azblob.ContainerURL, error) {
-	c, err := azblob.NewSharedKeyCredential(accountName, key)
+func (d *driver) getStorageContainer(environment autorestazure.Environment, accountName string, c azblob.Credential, containerName string) (azblob.ContainerURL, error) {
+	sender, err := d.pipelineSender()
 	if err != nil {
 		return azblob.ContainerURL{}, err
 	}
 
 	p := azblob.NewPipeline(c, azblob.PipelineOptions{
 		Telemetry:  azblob.TelemetryOptions{Value: defaults.UserAgent},
-		HTTPSender: d.httpSender,
+		HTTPSender: sender,
 	})
 
 	u, err := getBlobServiceURL(environment, accountName)
@@ -254,8 +309,8 @@ func (d *driver) getStorageContainer(environment autorestazure.Environment, acco
 	return service.NewContainerURL(containerName), nil
 }
 
-func (d *driver) createStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) error {
-	container, err := d.getStorageContainer(environment, accountName, key, containerName)
+func (d *driver) createStorageContainer(environment autorestazure.Environment, accountName string, cred azblob.Credential, containerName string) error {
+	container, err := d.getStorageContainer(environment, accountName, cred, containerName)
 	if err != nil {
 		return err
 	}
@@ -264,12 +319,17 @@ func (d *driver) createStorageContainer(environment autorestazure.Environment, a
 	return err
 }
 
-func (d *driver) deleteStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) error {
-	container, err := d.getStorageContainer(environment, accountName, key, containerName)
+func (d *driver) deleteStorageContainer(environment autorestazure.Environment, accountName string, cred azblob.Credential, containerName string) error {
+	container, err := d.getStorageContainer(environment, accountName, cred, containerName)
 	if err != nil {
 		return err
 	}
 
+	limiter := rate.NewLimiter(blobDeletionRate, blobDeletionWorkers)
+	if _, err := deleteContainerBlobs(d.Context, container, limiter, blobDeletionBudget); err != nil {
+		return err
+	}
+
 	_, err = container.Delete(d.Context, azblob.ContainerAccessConditions{})
 	return err
 }
@@ -297,6 +357,42 @@ type driver struct {
 	// httpSender is for Azure Pipeline.
 	// Added as a member to the struct to allow injection for testing.
 	httpSender pipeline.Factory
+
+	// retry is the retry policy of the requests to Azure Resource
+	// Manager, the default one is used when it is nil.
+	retry *retryPolicy
+
+	// disableSharedKey disables shared key access on the storage accounts
+	// created by the driver.
+	disableSharedKey bool
+
+	// blobToken is the Microsoft Entra ID token for the blob service.
+	// Added as a member to the struct to allow injection for testing.
+	blobToken string
+
+	// accountKeyName is the name of the storage account key the registry
+	// uses, key1 when it is empty.
+	accountKeyName string
+
+	// allowDisruption reports whether a disruptive change can be made
+	// now, they are always allowed when it is nil.
+	allowDisruption func(change string) bool
+
+	// client is the HTTP client used to reach Azure, built for the proxy
+	// settings in clientProxy.
+	client      *http.Client
+	clientProxy httpproxy.Config
+}
+
+// SetDisruptionGate makes the driver defer the disruptive changes for which
+// allowed returns false.
+func (d *driver) SetDisruptionGate(allowed func(change string) bool) {
+	d.allowDisruption = allowed
+}
+
+// disruptionAllowed returns true if the disruptive change can be made now.
+func (d *driver) disruptionAllowed(change string) bool {
+	return d.allowDisruption == nil || d.allowDisruption(change)
 }
 
 // NewDriver creates a new storage driver for Azure Blob Storage.
@@ -321,6 +417,37 @@ func (d *driver) storageAccountsClient(cfg *Azure, environment autorestazure.Env
 		return storageAccountsClient, nil
 	}
 
+	httpClient, err := d.httpClient()
+	if err != nil {
+		return storage.AccountsClient{}, err
+	}
+	cred, err := d.newTokenCredential(cfg, environment, httpClient)
+	if err != nil {
+		return storage.AccountsClient{}, err
+	}
+
+	scope := environment.TokenAudience
+	if !strings.HasSuffix(scope, "/.default") {
+		scope += "/.default"
+	}
+
+	storageAccountsClient.Authorizer = azidext.NewTokenCredentialAdapter(cred, []string{scope})
+	storageAccountsClient.Sender = &calllog.Sender{Provider: "Azure", Base: faultinject.WrapSender("Azure", httpClient)}
+	storageAccountsClient.SendDecorators = d.sendDecorators(storageAccountsClient.Client)
+
+	return storageAccountsClient, nil
+}
+
+// tokenCredential returns the Microsoft Entra ID credential of the operator.
+func (d *driver) tokenCredential(cfg *Azure, environment autorestazure.Environment) (azcore.TokenCredential, error) {
+	httpClient, err := d.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	return d.newTokenCredential(cfg, environment, httpClient)
+}
+
+func (d *driver) newTokenCredential(cfg *Azure, environment autorestazure.Environment, httpClient *http.Client) (azcore.TokenCredential, error) {
 	cloudConfig := cloud.Configuration{
 		ActiveDirectoryAuthorityHost: environment.ActiveDirectoryEndpoint,
 		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
@@ -331,61 +458,37 @@ func (d *driver) storageAccountsClient(cfg *Azure, environment autorestazure.Env
 		},
 	}
 
-	var (
-		cred azcore.TokenCredential
-		err  error
-	)
-	if strings.TrimSpace(cfg.ClientSecret) == "" {
+	if cfg.UseManagedIdentity {
+		options := azidentity.ManagedIdentityCredentialOptions{
+			ClientOptions: azcore.ClientOptions{
+				Cloud:     cloudConfig,
+				Transport: httpClient,
+			},
+		}
+		if cfg.ClientID != "" {
+			options.ID = azidentity.ClientID(cfg.ClientID)
+		}
+		return azidentity.NewManagedIdentityCredential(&options)
+	} else if strings.TrimSpace(cfg.ClientSecret) == "" {
 		options := azidentity.WorkloadIdentityCredentialOptions{
 			ClientOptions: azcore.ClientOptions{
-				Cloud: cloudConfig,
+				Cloud:     cloudConfig,
+				Transport: httpClient,
 			},
 			ClientID:      cfg.ClientID,
 			TenantID:      cfg.TenantID,
 			TokenFilePath: cfg.FederatedTokenFile,
 		}
-		cred, err = azidentity.NewWorkloadIdentityCredential(&options)
-		if err != nil {
-			return storage.AccountsClient{}, err
-		}
+		return azidentity.NewWorkloadIdentityCredential(&options)
 	} else {
 		options := azidentity.ClientSecretCredentialOptions{
 			ClientOptions: azcore.ClientOptions{
-				Cloud: cloudConfig,
+				Cloud:     cloudConfig,
+				Transport: httpClient,
 			},
 		}
-		cred, err = azidentity.NewClientSecretCredential(cfg.TenantID, cfg.ClientID, cfg.ClientSecret, &options)
-		if err != nil {
-			return storage.AccountsClient{}, err
-		}
-	}
-
-	scope := environment.TokenAudience
-	if !strings.HasSuffix(scope, "/.default") {
-		scope += "/.default"
-	}
-
-	storageAccountsClient.Authorizer = azidext.NewTokenCredentialAdapter(cred, []string{scope})
-
-	return storageAccountsClient, nil
-}
-
-func (d *driver) getKey(cfg *Azure, environment autorestazure.Environment) (string, error) {
-	if cfg.AccountKey != "" {
-		return cfg.AccountKey, nil
-	}
-
-	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
-	if err != nil {
-		return "", err
+		return azidentity.NewClientSecretCredential(cfg.TenantID, cfg.ClientID, cfg.ClientSecret, &options)
 	}
-
-	key, err := d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
-	if err != nil {
-		return "", err
-	}
-
-	return key, nil
 }
 
 func (d *driver) CABundle() (string, bool, error) {
@@ -407,16 +510,24 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 
 	key := cfg.AccountKey
 	federated_token := cfg.FederatedTokenFile
+	sharedKeyDisabled := false
 	if key == "" && federated_token == "" {
 		storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
 		if err != nil {
 			return nil, err
 		}
 
-		key, err = d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
+		sharedKeyDisabled, err = d.sharedKeyAccessDisabled(storageAccountsClient, cfg)
 		if err != nil {
 			return nil, err
 		}
+
+		if !sharedKeyDisabled {
+			key, err = d.getAccountKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if key != "" {
@@ -439,6 +550,21 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		)
 	}
 
+	// without shared key access the registry authenticates with the
+	// credentials of the operator, also read by the azure-sdk.
+	if sharedKeyDisabled {
+		if cfg.ClientID != "" {
+			envs = append(envs, envvar.EnvVar{Name: "AZURE_CLIENT_ID", Value: cfg.ClientID})
+		}
+		if cfg.TenantID != "" {
+			envs = append(envs, envvar.EnvVar{Name: "AZURE_TENANT_ID", Value: cfg.TenantID})
+		}
+		if !cfg.UseManagedIdentity && cfg.ClientSecret != "" {
+			envs = append(envs, envvar.EnvVar{Name: "AZURE_CLIENT_SECRET", Value: cfg.ClientSecret, Secret: true})
+		}
+		envs = append(envs, envvar.EnvVar{Name: "AZURE_AUTHORITY_HOST", Value: environment.ActiveDirectoryEndpoint})
+	}
+
 	envs = append(envs,
 		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "azure"},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_CONTAINER", Value: d.Config.Container},
@@ -461,24 +587,24 @@ func (d *driver) VolumeSecrets() (map[string]string, error) {
 }
 
 // containerExists determines whether or not an azure container exists
-func (d *driver) containerExists(ctx context.Context, environment autorestazure.Environment, accountName, key, containerName string) (bool, error) {
+func (d *driver) containerExists(ctx context.Context, environment autorestazure.Environment, accountName string, c azblob.Credential, containerName string) (bool, error) {
 	if accountName == "" || containerName == "" {
 		return false, nil
 	}
 
-	c, err := azblob.NewSharedKeyCredential(accountName, key)
+	u, err := getBlobServiceURL(environment, accountName)
 	if err != nil {
 		return false, err
 	}
 
-	u, err := getBlobServiceURL(environment, accountName)
+	sender, err := d.pipelineSender()
 	if err != nil {
 		return false, err
 	}
 
 	p := azblob.NewPipeline(c, azblob.PipelineOptions{
 		Telemetry:  azblob.TelemetryOptions{Value: defaults.UserAgent},
-		HTTPSender: d.httpSender,
+		HTTPSender: sender,
 	})
 
 	service := azblob.NewServiceURL(*u, p)
@@ -490,7 +616,7 @@ func (d *driver) containerExists(ctx context.Context, environment autorestazure.
 		}
 	}
 	if err != nil {
-		return false, fmt.Errorf("unable to get the storage container %s: %s", containerName, err)
+		return false, fmt.Errorf("unable to get the storage container %s: %w", containerName, err)
 	}
 
 	return true, nil
@@ -509,21 +635,43 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
+	if err := d.setRetryPolicy(cr); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get retry options: %s", err))
+		return false, err
+	}
+	d.ReadConfigState(cr)
+
 	environment, err := getEnvironmentByName(d.Config.CloudName)
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get cloud environment: %s", err))
 		return false, err
 	}
 
-	key, err := d.getKey(cfg, environment)
+	if err := d.syncAccountLocation(cr, cfg, environment); err != nil {
+		reason := azureErrorReason(err)
+		if _, ok := err.(*errAccountMoved); ok {
+			reason = storageExistsReasonAccountMoved
+		}
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, reason, fmt.Sprintf("Unable to locate storage account: %s", err))
+		return false, err
+	}
+
+	if err := d.syncSharedKeyAccess(cr, cfg, environment); err != nil {
+		klog.Warningf("unable to sync the shared key access of the storage account: %s", err)
+	}
+	if err := d.syncKeyRotation(cr, cfg, environment, time.Now()); err != nil {
+		klog.Warningf("unable to rotate the keys of the storage account: %s", err)
+	}
+
+	cred, err := d.blobCredential(cfg, environment)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get storage account key: %s", err))
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, azureErrorReason(err), fmt.Sprintf("Unable to get storage account credentials: %s", err))
 		return false, err
 	}
 
-	exists, err := d.containerExists(d.Context, environment, d.Config.AccountName, key, d.Config.Container)
+	exists, err := d.containerExists(d.Context, environment, d.Config.AccountName, cred, d.Config.Container)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("%s", err))
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, azureErrorReason(err), fmt.Sprintf("%s", err))
 		return false, err
 	}
 	if !exists {
@@ -531,6 +679,39 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 		return false, nil
 	}
 
+	// the account properties can only be read with access to the Azure
+	// Resource Manager, not with an account key.
+	if cfg.AccountKey == "" {
+		if err := d.syncGeoRedundancy(cr, cfg, environment); err != nil {
+			klog.Warningf("unable to check the geo redundancy of the storage account: %s", err)
+		}
+		if err := d.syncPrivateEndpoint(cr, cfg, environment); err != nil {
+			klog.Warningf("unable to verify the private endpoint of the storage account: %s", err)
+		}
+		if err := d.syncProtocols(cr, cfg, environment); err != nil {
+			klog.Warningf("unable to check the protocols of the storage account: %s", err)
+		}
+		if err := d.syncEncryption(cr, cfg, environment); err != nil {
+			klog.Warningf("unable to sync the encryption of the storage account: %s", err)
+		}
+		if err := d.syncTags(cr, cfg, environment); err != nil {
+			klog.Warningf("unable to sync the tags of the storage account: %s", err)
+		}
+		if err := d.syncNetworkAccess(cr, cfg, environment, cred); err != nil {
+			klog.Warningf("unable to sync the network rules of the storage account: %s", err)
+		}
+		if err := d.syncSoftDelete(cr, cfg, environment); err != nil {
+			klog.Warningf("unable to sync the soft delete settings of the storage account: %s", err)
+		}
+		if err := d.syncInventoryPolicy(cr, cfg, environment, cred); err != nil {
+			klog.Warningf("unable to configure the blob inventory policy of the storage account: %s", err)
+		}
+		if err := d.syncOrphanedStorage(cr, cfg, environment); err != nil {
+			klog.Warningf("unable to look for storage accounts left behind by previous installations: %s", err)
+		}
+	}
+
+	recordAccountID(cr, cfg, d.Config.AccountName)
 	util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionTrue, storageExistsReasonContainerExists, "Storage container exists")
 	return true, nil
 }
@@ -543,7 +724,7 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 // assureStorageAccount makes sure there is a storage account in place and apply any provided tags.
 // If no storage account name is provided it attempts to generate one. Returns the account name
 // (either the one provided or the one generated), if the account was created or was already there and an error.
-func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure) (string, bool, error) {
+func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure, encryption *Encryption, sku storage.SkuName) (string, bool, error) {
 	environment, err := getEnvironmentByName(d.Config.CloudName)
 	if err != nil {
 		return "", false, err
@@ -575,20 +756,9 @@ func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure
 	// along with any user defined tags from the cluster configuration
 	klog.V(2).Info("setting azure storage account tags")
 
-	tagset := map[string]*string{
-		fmt.Sprintf("kubernetes.io_cluster.%s", infra.Status.InfrastructureName): to.StringPtr("owned"),
-	}
-
-	// at this stage we are not keeping user tags in sync. as per enhancement proposal
-	// we only set user provided tags when we created the bucket.
-	hasAzureStatus := infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Azure != nil && infra.Status.PlatformStatus.Azure.ResourceTags != nil
-	if hasAzureStatus {
-		klog.V(5).Infof("user has provided %d tags", len(infra.Status.PlatformStatus.Azure.ResourceTags))
-		for _, tag := range infra.Status.PlatformStatus.Azure.ResourceTags {
-			klog.V(5).Infof("user has provided storage account tag: %s: %s", tag.Key, tag.Value)
-			tagset[tag.Key] = to.StringPtr(tag.Value)
-		}
-	}
+	// user tags are only kept in sync when it is requested, as per
+	// enhancement proposal they are set when the account is created.
+	tagset := accountTags(infra)
 	klog.V(5).Infof("tagging storage account with tags: %+v", tagset)
 
 	// regardless if the storage account name was provided by the user or we generated it,
@@ -596,8 +766,11 @@ func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure
 	var storageAccountCreated bool
 	if *result.NameAvailable {
 		storageAccountCreated = true
+		if err := d.validateSKU(storageAccountsClient, environment, cfg, sku, d.Config.CloudName); err != nil {
+			return "", false, err
+		}
 		if err := d.createStorageAccount(
-			storageAccountsClient, cfg.ResourceGroup, accountName, cfg.Region, d.Config.CloudName, tagset,
+			storageAccountsClient, cfg.ResourceGroup, accountName, cfg.Region, d.Config.CloudName, tagset, encryption, sku,
 		); err != nil {
 			return "", false, err
 		}
@@ -620,9 +793,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 		return "", false, err
 	}
 
-	key, err := d.getAccountPrimaryKey(
-		storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName,
-	)
+	cred, err := d.accountBlobCredential(storageAccountsClient, cfg, environment)
 	if err != nil {
 		return "", false, err
 	}
@@ -634,7 +805,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 		}
 
 		if err = d.createStorageContainer(
-			environment, d.Config.AccountName, key, containerName,
+			environment, d.Config.AccountName, cred, containerName,
 		); err != nil {
 			return "", false, err
 		}
@@ -643,7 +814,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 	}
 
 	if exists, err := d.containerExists(
-		d.Context, environment, d.Config.AccountName, key, d.Config.Container,
+		d.Context, environment, d.Config.AccountName, cred, d.Config.Container,
 	); err != nil {
 		return "", false, err
 	} else if exists {
@@ -651,7 +822,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 	}
 
 	if err = d.createStorageContainer(
-		environment, d.Config.AccountName, key, d.Config.Container,
+		environment, d.Config.AccountName, cred, d.Config.Container,
 	); err != nil {
 		return "", false, err
 	}
@@ -701,6 +872,63 @@ func (d *driver) processUPI(cr *imageregistryv1.Config) {
 	)
 }
 
+// PlanStorage returns the storage account and container CreateStorage would
+// create. Nothing is planned when the account key is provided by the user.
+func (d *driver) PlanStorage(cr *imageregistryv1.Config) ([]util.PlannedResource, error) {
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AccountKey != "" {
+		return nil, nil
+	}
+
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudName := d.Config.CloudName
+	if cloudName == "" && d.Config.AccountName == "" {
+		platformStatus := infra.Status.PlatformStatus
+		if platformStatus != nil && platformStatus.Type == configv1.AzurePlatformType && platformStatus.Azure != nil {
+			cloudName = string(platformStatus.Azure.CloudName)
+		}
+	}
+
+	accountName := d.Config.AccountName
+	if accountName == "" {
+		accountName = strings.ToLower(accountNamePrefix(infra.Status.InfrastructureName)) + "*"
+	}
+	sku, err := getSKU(cr)
+	if err != nil {
+		return nil, err
+	}
+	kind := accountKind(sku, cloudName)
+	tags := map[string]string{}
+	for k, v := range accountTags(infra) {
+		tags[k] = *v
+	}
+
+	containerName := d.Config.Container
+	if containerName == "" {
+		if containerName, err = util.PlannedStorageName(d.Listers, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return []util.PlannedResource{
+		{
+			Kind:   fmt.Sprintf("%s storage account", kind),
+			Name:   accountName,
+			Region: fmt.Sprintf("%s (resource group %s)", cfg.Region, cfg.ResourceGroup),
+			SKU:    string(sku),
+			Tags:   tags,
+		},
+		{Kind: "storage container", Name: containerName},
+	}, nil
+}
+
 // CreateStorage attempts to create a storage account and a storage container.
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
@@ -715,6 +943,18 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	if err := d.setRetryPolicy(cr); err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Unable to get retry options: %s", err),
+		)
+		return err
+	}
+	d.ReadConfigState(cr)
+
 	// if AccountKey is present in our configuration it means it was provided by the user
 	// so we only verify if everything we need is in place.
 	if cfg.AccountKey != "" {
@@ -743,35 +983,125 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
-	storageAccountName, storageAccountCreated, err := d.assureStorageAccount(cfg, infra)
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Unable to get cloud environment: %s", err),
+		)
+		return err
+	}
+
+	// an account left in the subscription the credentials no longer point
+	// to is not recreated, its name is taken.
+	if err := d.syncAccountLocation(cr, cfg, environment); err != nil {
+		reason := azureErrorReason(err)
+		if _, ok := err.(*errAccountMoved); ok {
+			reason = storageExistsReasonAccountMoved
+		}
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			reason,
+			fmt.Sprintf("Unable to locate storage account: %s", err),
+		)
+		return err
+	}
+
+	encryption, err := getEncryption(cr)
+	if err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Unable to get storage encryption: %s", err),
+		)
+		return err
+	}
+
+	sku, err := getSKU(cr)
+	if err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Unable to get storage account SKU: %s", err),
+		)
+		return err
+	}
+
+	if d.disableSharedKey, err = sharedKeyAccessDisableRequested(cr); err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Unable to get shared key access: %s", err),
+		)
+		return err
+	}
+
+	var adopted bool
+	if d.Config.AccountName == "" {
+		if adopted, err = d.adoptStorageAccount(cr, cfg, environment, infra); err != nil {
+			util.UpdateCondition(
+				cr,
+				defaults.StorageExists,
+				operatorapiv1.ConditionUnknown,
+				azureErrorReason(err),
+				fmt.Sprintf("Unable to adopt storage account: %s", err),
+			)
+			return err
+		}
+	}
+
+	storageAccountName, storageAccountCreated, err := d.assureStorageAccount(cfg, infra, encryption, sku)
 	if err != nil {
 		util.UpdateCondition(
 			cr,
 			defaults.StorageExists,
 			operatorapiv1.ConditionUnknown,
-			storageExistsReasonAzureError,
+			azureErrorReason(err),
 			fmt.Sprintf("Unable to process storage account: %s", err),
 		)
 		return err
 	}
 	d.Config.AccountName = storageAccountName
 
+	if err := d.syncSharedKeyAccess(cr, cfg, environment); err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionUnknown,
+			azureErrorReason(err),
+			fmt.Sprintf("Unable to sync shared key access: %s", err),
+		)
+		return err
+	}
+
 	containerName, containerCreated, err := d.assureContainer(cfg)
 	if err != nil {
 		util.UpdateCondition(
 			cr,
 			defaults.StorageExists,
 			operatorapiv1.ConditionUnknown,
-			storageExistsReasonAzureError,
+			azureErrorReason(err),
 			fmt.Sprintf("Unable to process storage container: %s", err),
 		)
 		return err
 	}
 	d.Config.Container = containerName
+	recordAccountID(cr, cfg, d.Config.AccountName)
 
 	// We only set the storage management if it is not already set.
 	if cr.Spec.Storage.ManagementState == "" {
-		if storageAccountCreated || containerCreated {
+		if storageAccountCreated || containerCreated || adopted {
 			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
 		} else {
 			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
@@ -793,7 +1123,10 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	return nil
 }
 
-// RemoveStorage deletes the storage medium that was created.
+// RemoveStorage deletes the storage container and then the storage account
+// holding it, whether they were created by the operator or provided by the
+// user. It is not called with the Retain storage deletion policy, which is the
+// way to keep user-provided storage.
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err error) {
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
 		return false, nil
@@ -809,20 +1142,44 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 		return false, err
 	}
 
+	if err := d.setRetryPolicy(cr); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get retry options: %s", err))
+		return false, err
+	}
+	d.ReadConfigState(cr)
+
 	environment, err := getEnvironmentByName(d.Config.CloudName)
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get cloud environment: %s", err))
 		return false, err
 	}
 
+	// the credentials cannot reach an account left in another subscription
+	// or resource group, it is not ours to delete anymore.
+	if err := d.syncAccountLocation(cr, cfg, environment); err != nil {
+		if _, ok := err.(*errAccountMoved); ok {
+			klog.Warningf("not removing the storage account %s: %s", d.Config.AccountName, err)
+			d.Config.AccountName = ""
+			d.Config.Container = ""
+			cr.Spec.Storage.Azure.AccountName = ""
+			cr.Spec.Storage.Azure.Container = ""
+			cr.Status.Storage.Azure.AccountName = ""
+			cr.Status.Storage.Azure.Container = ""
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonAccountMoved, fmt.Sprintf("Storage account left in place: %s", err))
+			return false, nil
+		}
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, azureErrorReason(err), fmt.Sprintf("Unable to locate storage account: %s", err))
+		return false, err
+	}
+
 	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get accounts client: %s", err))
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, azureErrorReason(err), fmt.Sprintf("Unable to get accounts client: %s", err))
 		return false, err
 	}
 
 	if d.Config.Container != "" {
-		key, err := d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
+		cred, err := d.accountBlobCredential(storageAccountsClient, cfg, environment)
 		if _, ok := err.(*errDoesNotExist); ok {
 			d.Config.AccountName = ""
 			cr.Spec.Storage.Azure.AccountName = "" // TODO
@@ -831,25 +1188,29 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 			return false, nil
 		}
 		if err != nil {
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get account primary keys: %s", err))
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, azureErrorReason(err), fmt.Sprintf("Unable to get storage account credentials: %s", err))
 			return false, err
 		}
 
-		err = d.deleteStorageContainer(environment, d.Config.AccountName, key, d.Config.Container)
+		err = d.deleteStorageContainer(environment, d.Config.AccountName, cred, d.Config.Container)
+		if _, ok := err.(*errBlobDeletionInProgress); ok {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionTrue, storageExistsReasonDeletingBlobs, fmt.Sprintf("Deleting the blobs in the storage container: %s", err))
+			return true, err
+		}
 		if err != nil {
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage container: %s", err))
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, azureErrorReason(err), fmt.Sprintf("Unable to delete storage container: %s", err))
 			return false, err // TODO: is it retryable?
 		}
 
 		d.Config.Container = ""
-		cr.Spec.Storage.Azure.Container = "" // TODO: what if it was provided by a user?
+		cr.Spec.Storage.Azure.Container = ""
 		cr.Status.Storage.Azure.Container = ""
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonContainerDeleted, "Storage container has been deleted")
 	}
 
 	_, err = storageAccountsClient.Delete(d.Context, cfg.ResourceGroup, d.Config.AccountName)
 	if err != nil {
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage account: %s", err))
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, azureErrorReason(err), fmt.Sprintf("Unable to delete storage account: %s", err))
 		return false, err
 	}
 
@@ -861,8 +1222,60 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 	return false, nil
 }
 
+// Inventory accounts all blobs stored in the container in the provided
+// report.
+func (d *driver) Inventory(ctx context.Context, report *inventory.Report) error {
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return err
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return err
+	}
+
+	cred, err := d.blobCredential(cfg, environment)
+	if err != nil {
+		return err
+	}
+
+	container, err := d.getStorageContainer(environment, d.Config.AccountName, cred, d.Config.Container)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range inventory.Prefixes {
+		for marker := (azblob.Marker{}); marker.NotDone(); {
+			resp, err := container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
+				Prefix: prefix,
+			})
+			if err != nil {
+				return err
+			}
+			for _, blob := range resp.Segment.BlobItems {
+				if blob.Properties.ContentLength != nil && inventory.IsBlob(blob.Name) {
+					report.Add(*blob.Properties.ContentLength)
+				}
+			}
+			marker = resp.NextMarker
+		}
+	}
+	return nil
+}
+
 // ID return the underlying storage identificator, on this case the Azure
 // container name.
 func (d *driver) ID() string {
 	return d.Config.Container
 }
+
+// Capabilities returns what Azure Blob Storage supports.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiReplica:           true,
+		Redirect:               true,
+		EncryptionAtRestConfig: true,
+		Tagging:                true,
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/mocks"
 	"github.com/google/go-cmp/cmp"
@@ -179,6 +181,53 @@ func TestGetConfig(t *testing.T) {
 				FederatedTokenFile: "/path/to/token",
 			},
 		},
+		{
+			name: "cloud credentials user-assigned managed identity",
+			secrets: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.CloudCredentialsName,
+						Namespace: "test",
+					},
+					Data: map[string][]byte{
+						"azure_client_id":            []byte("client_id"),
+						"azure_region":               []byte("region"),
+						"azure_subscription_id":      []byte("subscription_id"),
+						"azure_use_managed_identity": []byte("true"),
+					},
+				},
+			},
+			result: &Azure{
+				SubscriptionID:     "subscription_id",
+				ClientID:           "client_id",
+				ResourceGroup:      "resource-group-123",
+				Region:             "region",
+				UseManagedIdentity: true,
+			},
+		},
+		{
+			name: "cloud credentials system-assigned managed identity",
+			secrets: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.CloudCredentialsName,
+						Namespace: "test",
+					},
+					Data: map[string][]byte{
+						"azure_resourcegroup":        []byte("resourcegroup"),
+						"azure_region":               []byte("region"),
+						"azure_subscription_id":      []byte("subscription_id"),
+						"azure_use_managed_identity": []byte("true"),
+					},
+				},
+			},
+			result: &Azure{
+				SubscriptionID:     "subscription_id",
+				ResourceGroup:      "resourcegroup",
+				Region:             "region",
+				UseManagedIdentity: true,
+			},
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
@@ -298,6 +347,7 @@ func TestConfigEnv(t *testing.T) {
 
 	authorizer := autorest.NullAuthorizer{}
 	sender := mocks.NewSender()
+	sender.AppendResponse(mocks.NewResponseWithContent(`{"value":[]}`))
 	sender.AppendResponse(mocks.NewResponseWithContent(`{"nameAvailable":true}`))
 	sender.AppendResponse(mocks.NewResponseWithContent(`?`))
 	sender.AppendResponse(mocks.NewResponseWithContent(`{"name":"account"}`))
@@ -547,6 +597,8 @@ func TestUserProvidedTags(t *testing.T) {
 						},
 					},
 				},
+				nil,
+				storage.StandardLRS,
 			)
 			if err != nil {
 				t.Errorf("unexpected error %q", err)
@@ -683,6 +735,8 @@ func Test_assureStorageAccount(t *testing.T) {
 					ResourceGroup:  "resource_group",
 				},
 				&configv1.Infrastructure{},
+				nil,
+				storage.StandardLRS,
 			)
 
 			if err != nil {
@@ -989,6 +1043,13 @@ func Test_assureContainer(t *testing.T) {
 			drv.sender = sender
 			primaryKey = cachedKey{}
 
+			cfg := &Azure{
+				SubscriptionID: "subscription_id",
+				ResourceGroup:  "resource_group",
+			}
+			// shared key access is synced before the container is assured.
+			sharedKeyAccess.set(accountID(cfg, storageConfig.AccountName), false)
+
 			var requestCounter int
 			drv.httpSender = pipeline.FactoryFunc(
 				func(_ pipeline.Policy, _ *pipeline.PolicyOptions) pipeline.PolicyFunc {
@@ -1006,12 +1067,7 @@ func Test_assureContainer(t *testing.T) {
 				},
 			)
 
-			name, generated, err := drv.assureContainer(
-				&Azure{
-					SubscriptionID: "subscription_id",
-					ResourceGroup:  "resource_group",
-				},
-			)
+			name, generated, err := drv.assureContainer(cfg)
 
 			if err != nil {
 				if len(tt.err) == 0 {
@@ -1125,13 +1181,17 @@ func Test_containerExists(t *testing.T) {
 				},
 			)
 
-			exists, err := drv.containerExists(
-				context.Background(),
-				environment,
-				tt.accountName,
-				tt.accountKey,
-				tt.containerName,
-			)
+			var exists bool
+			cred, err := azblob.NewSharedKeyCredential(tt.accountName, tt.accountKey)
+			if err == nil {
+				exists, err = drv.containerExists(
+					context.Background(),
+					environment,
+					tt.accountName,
+					cred,
+					tt.containerName,
+				)
+			}
 
 			if err != nil {
 				if len(tt.err) == 0 {
@@ -1211,6 +1271,7 @@ func Test_storageManagementState(t *testing.T) {
 			name: "user providing container and account name (both already exist)",
 			mockResponses: []*http.Response{
 				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
+				mocks.NewResponseWithContent(`{"properties":{}}`),
 				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
 			},
 			registryConfig: &imageregistryv1.Config{
@@ -1310,6 +1371,7 @@ func Test_storageManagementState(t *testing.T) {
 			},
 			mockResponses: []*http.Response{
 				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
+				mocks.NewResponseWithContent(`{"properties":{}}`),
 				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
 			},
 		},
@@ -1342,9 +1404,15 @@ func Test_storageManagementState(t *testing.T) {
 					sender.AppendResponse(resp)
 				}
 			} else {
+				if azure := tt.registryConfig.Spec.Storage.Azure; azure == nil || azure.AccountName == "" {
+					// no storage account left behind by a previous
+					// installation
+					sender.AppendResponse(mocks.NewResponseWithContent(`{"value":[]}`))
+				}
 				sender.AppendResponse(mocks.NewResponseWithContent(`{"nameAvailable":true}`))
 				sender.AppendResponse(mocks.NewResponseWithContent(`?`))
 				sender.AppendResponse(mocks.NewResponseWithContent(`{"name":"account"}`))
+				sender.AppendResponse(mocks.NewResponseWithContent(`{"properties":{}}`))
 				sender.AppendResponse(mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`))
 			}
 
@@ -1396,3 +1464,56 @@ func Test_storageManagementState(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncGeoRedundancy(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		account string
+		sku     string
+		status  operatorapiv1.ConditionStatus
+		message string
+	}{
+		{
+			name:    "read access geo redundant",
+			account: "ragrsaccount",
+			sku:     "Standard_RAGRS",
+			status:  operatorapiv1.ConditionTrue,
+			message: "The storage account ragrsaccount is Standard_RAGRS, its blobs can be read from the secondary endpoint https://ragrsaccount-secondary.blob.core.windows.net",
+		},
+		{
+			name:    "locally redundant",
+			account: "lrsaccount",
+			sku:     "Standard_LRS",
+			status:  operatorapiv1.ConditionFalse,
+			message: "The storage account lrsaccount is Standard_LRS, its blobs cannot be read from a secondary region",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := mocks.NewSender()
+			sender.AppendResponse(mocks.NewResponseWithContent(fmt.Sprintf(`{"name":%q,"sku":{"name":%q}}`, tt.account, tt.sku)))
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: tt.account}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			cr := &imageregistryv1.Config{}
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncGeoRedundancy(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			cond := cr.Status.Conditions[0]
+			if cond.Type != storageGeoRedundancyCondition || cond.Status != tt.status || cond.Message != tt.message {
+				t.Errorf("got condition %#v, want status %s and message %q", cond, tt.status, tt.message)
+			}
+		})
+	}
+
+	url, err := SecondaryBlobServiceURL(&imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account", CloudName: "AzureUSGovernmentCloud"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://account-secondary.blob.core.usgovcloudapi.net"; url != want {
+		t.Errorf("got secondary endpoint %q, want %q", url, want)
+	}
+}
@@ -0,0 +1,113 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// blobDeletionWorkers is the number of blobs deleted concurrently.
+	blobDeletionWorkers = 16
+
+	// blobDeletionRate is the maximum number of blobs deleted per second,
+	// each blob is deleted along with its snapshots by a single request.
+	// Bursts of up to blobDeletionWorkers requests are allowed. It stays
+	// well below the request rate targets of a storage account, so the
+	// deletion does not get throttled.
+	blobDeletionRate rate.Limit = 500
+
+	// blobDeletionBudget is for how long blobs are deleted before
+	// RemoveStorage returns to report progress. Blob deletion resumes
+	// where it stopped on the next attempt as deleted blobs are not listed
+	// again.
+	blobDeletionBudget = 2 * time.Minute
+)
+
+// errBlobDeletionInProgress is returned when the container still has blobs
+// after the blob deletion budget is spent.
+type errBlobDeletionInProgress struct {
+	deleted int64
+}
+
+func (e *errBlobDeletionInProgress) Error() string {
+	return fmt.Sprintf("deleted %d blobs, the container is not empty yet", e.deleted)
+}
+
+// deleteContainerBlobs deletes the blobs in the container, so the container
+// itself can be deleted without hitting the ARM timeouts on containers with
+// millions of blobs. It returns the number of deleted blobs.
+func deleteContainerBlobs(ctx context.Context, container azblob.ContainerURL, limiter *rate.Limiter, budget time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	var deleted int64
+	var firstErr error
+	var errOnce sync.Once
+	names := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < blobDeletionWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				if err := limiter.Wait(ctx); err != nil {
+					// the budget would be exceeded before the
+					// blob can be deleted.
+					cancel()
+					continue
+				}
+				_, err := container.NewBlobURL(name).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+				if err != nil {
+					if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+						continue
+					}
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("unable to delete blob %s: %w", name, err)
+						cancel()
+					})
+					continue
+				}
+				atomic.AddInt64(&deleted, 1)
+			}
+		}()
+	}
+
+	var listErr error
+	for marker := (azblob.Marker{}); marker.NotDone() && ctx.Err() == nil; {
+		resp, err := container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{})
+		if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeContainerNotFound {
+			break
+		} else if err != nil {
+			listErr = err
+			break
+		}
+		for _, blob := range resp.Segment.BlobItems {
+			select {
+			case names <- blob.Name:
+			case <-ctx.Done():
+			}
+		}
+		marker = resp.NextMarker
+	}
+	close(names)
+	wg.Wait()
+
+	if firstErr != nil {
+		return deleted, firstErr
+	}
+	if ctx.Err() != nil {
+		klog.Infof("deleted %d blobs from the storage container, resuming on the next attempt", deleted)
+		return deleted, &errBlobDeletionInProgress{deleted: deleted}
+	}
+	if listErr != nil {
+		return deleted, fmt.Errorf("unable to list blobs: %w", listErr)
+	}
+	return deleted, nil
+}
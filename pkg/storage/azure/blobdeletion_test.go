@@ -0,0 +1,88 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/mocks"
+	"golang.org/x/time/rate"
+)
+
+// fakeContainer serves the list and delete blob requests for a container.
+type fakeContainer struct {
+	mu    sync.Mutex
+	blobs map[string]bool
+}
+
+func (f *fakeContainer) Do(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch request.Method {
+	case http.MethodGet:
+		var items strings.Builder
+		for name := range f.blobs {
+			fmt.Fprintf(&items, "<Blob><Name>%s</Name><Properties></Properties></Blob>", name)
+		}
+		r := mocks.NewResponseWithContent(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>%s</Blobs><NextMarker /></EnumerationResults>`, items.String()))
+		return pipeline.NewHTTPResponse(r), nil
+	case http.MethodDelete:
+		name := strings.TrimPrefix(request.URL.Path, "/container/")
+		delete(f.blobs, name)
+		return pipeline.NewHTTPResponse(mocks.NewResponseWithStatus("", http.StatusAccepted)), nil
+	}
+	return nil, fmt.Errorf("unexpected request %s %s", request.Method, request.URL)
+}
+
+func newFakeContainerURL(f *fakeContainer) azblob.ContainerURL {
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{
+		HTTPSender: pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return f.Do
+		}),
+	})
+	u, _ := url.Parse("https://account.blob.core.windows.net/container")
+	return azblob.NewContainerURL(*u, p)
+}
+
+func TestDeleteContainerBlobs(t *testing.T) {
+	f := &fakeContainer{blobs: map[string]bool{}}
+	for i := 0; i < 100; i++ {
+		f.blobs[fmt.Sprintf("docker/registry/v2/blobs/sha256/%02d/data", i)] = true
+	}
+
+	deleted, err := deleteContainerBlobs(context.Background(), newFakeContainerURL(f), rate.NewLimiter(rate.Inf, 1), time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if deleted != 100 {
+		t.Errorf("got %d deleted blobs, want 100", deleted)
+	}
+	if len(f.blobs) != 0 {
+		t.Errorf("got %d blobs left, want 0", len(f.blobs))
+	}
+}
+
+func TestDeleteContainerBlobsBudget(t *testing.T) {
+	f := &fakeContainer{blobs: map[string]bool{}}
+	for i := 0; i < 10; i++ {
+		f.blobs[fmt.Sprintf("blob-%d", i)] = true
+	}
+
+	// one request per second doesn't allow to delete all the blobs within
+	// the budget.
+	_, err := deleteContainerBlobs(context.Background(), newFakeContainerURL(f), rate.NewLimiter(1, 1), 100*time.Millisecond)
+	if _, ok := err.(*errBlobDeletionInProgress); !ok {
+		t.Fatalf("expected blob deletion to be in progress, got %v", err)
+	}
+	if len(f.blobs) == 0 {
+		t.Errorf("expected blobs to be left")
+	}
+}
@@ -2,6 +2,7 @@ package azure
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -10,14 +11,16 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 )
 
-// primaryKey keeps account primary key in a cache.
+// primaryKey keeps the account key used by the registry in a cache.
 var primaryKey cachedKey
 
 // cachedKey holds an API access key in memory for five minutes.
 type cachedKey struct {
 	mtx           sync.Mutex
+	subscription  string
 	resourceGroup string
 	account       string
+	name          string
 	value         string
 	expire        time.Time
 }
@@ -25,12 +28,12 @@ type cachedKey struct {
 // get returns the cached key if it is not expired yet, if expired fetches the key
 // remotely using provided AccountsClient.
 func (k *cachedKey) get(
-	ctx context.Context, cli storage.AccountsClient, resourceGroup, account string,
+	ctx context.Context, cli storage.AccountsClient, resourceGroup, account, name string,
 ) (string, error) {
 	k.mtx.Lock()
 	defer k.mtx.Unlock()
 
-	if k.resourceGroup == resourceGroup && k.account == account && time.Now().Before(k.expire) {
+	if k.subscription == cli.SubscriptionID && k.resourceGroup == resourceGroup && k.account == account && k.name == name && time.Now().Before(k.expire) {
 		metrics.AzureKeyCacheHit()
 		return k.value, nil
 	}
@@ -41,9 +44,41 @@ func (k *cachedKey) get(
 		return "", err
 	}
 
+	value, err := keyValue(*keysResponse.Keys, name)
+	if err != nil {
+		return "", err
+	}
+
+	k.subscription = cli.SubscriptionID
 	k.resourceGroup = resourceGroup
 	k.account = account
-	k.value = *(*keysResponse.Keys)[0].Value
+	k.name = name
+	k.value = value
 	k.expire = time.Now().Add(5 * time.Minute)
 	return k.value, nil
 }
+
+// invalidate drops the cached key, e.g. after it was regenerated.
+func (k *cachedKey) invalidate() {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.expire = time.Time{}
+}
+
+// keyValue returns the value of the named key. Keys listed without a name
+// are taken in order, key1 first.
+func keyValue(keys []storage.AccountKey, name string) (string, error) {
+	for _, key := range keys {
+		if key.KeyName != nil && *key.KeyName == name && key.Value != nil {
+			return *key.Value, nil
+		}
+	}
+	i := 0
+	if name == accountKey2 {
+		i = 1
+	}
+	if i < len(keys) && keys[i].KeyName == nil && keys[i].Value != nil {
+		return *keys[i].Value, nil
+	}
+	return "", fmt.Errorf("the key %s is not listed", name)
+}
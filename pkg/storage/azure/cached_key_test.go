@@ -16,6 +16,7 @@ func Test_cachedKey_get(t *testing.T) {
 		key           *cachedKey
 		resourceGroup string
 		account       string
+		keyName       string
 		err           string
 		responses     []string
 		expectedKey   string
@@ -42,8 +43,10 @@ func Test_cachedKey_get(t *testing.T) {
 		{
 			name: "cache hit",
 			key: &cachedKey{
+				subscription:  "subscription_id",
 				resourceGroup: "resource_group",
 				account:       "account",
+				name:          accountKey1,
 				value:         "cachedkey",
 				expire:        time.Now().Add(time.Minute),
 			},
@@ -55,8 +58,10 @@ func Test_cachedKey_get(t *testing.T) {
 		{
 			name: "cache expired",
 			key: &cachedKey{
+				subscription:  "subscription_id",
 				resourceGroup: "resource_group",
 				account:       "account",
+				name:          accountKey1,
 				value:         "cachedkey",
 				expire:        time.Now().Add(-time.Minute),
 			},
@@ -68,8 +73,10 @@ func Test_cachedKey_get(t *testing.T) {
 		{
 			name: "different account",
 			key: &cachedKey{
+				subscription:  "subscription_id",
 				resourceGroup: "resource_group",
 				account:       "account",
+				name:          accountKey1,
 				value:         "cachedkey",
 				expire:        time.Now().Add(time.Minute),
 			},
@@ -81,8 +88,10 @@ func Test_cachedKey_get(t *testing.T) {
 		{
 			name: "different resource group",
 			key: &cachedKey{
+				subscription:  "subscription_id",
 				resourceGroup: "resource_group",
 				account:       "account",
+				name:          accountKey1,
 				value:         "cachedkey",
 				expire:        time.Now().Add(time.Minute),
 			},
@@ -91,8 +100,52 @@ func Test_cachedKey_get(t *testing.T) {
 			responses:     []string{`{"keys":[{"value":"another-api-key"}]}`},
 			expectedKey:   "another-api-key",
 		},
+		{
+			name: "different subscription",
+			key: &cachedKey{
+				subscription:  "another-subscription_id",
+				resourceGroup: "resource_group",
+				account:       "account",
+				name:          accountKey1,
+				value:         "cachedkey",
+				expire:        time.Now().Add(time.Minute),
+			},
+			resourceGroup: "resource_group",
+			account:       "account",
+			responses:     []string{`{"keys":[{"value":"another-api-key"}]}`},
+			expectedKey:   "another-api-key",
+		},
+		{
+			name: "different key",
+			key: &cachedKey{
+				subscription:  "subscription_id",
+				resourceGroup: "resource_group",
+				account:       "account",
+				name:          accountKey1,
+				value:         "cachedkey",
+				expire:        time.Now().Add(time.Minute),
+			},
+			resourceGroup: "resource_group",
+			account:       "account",
+			keyName:       accountKey2,
+			responses:     []string{`{"keys":[{"keyName":"key1","value":"firstKey"},{"keyName":"key2","value":"secondKey"}]}`},
+			expectedKey:   "secondKey",
+		},
+		{
+			name:          "key not listed",
+			key:           &cachedKey{},
+			resourceGroup: "resource_group",
+			account:       "account",
+			keyName:       accountKey2,
+			responses:     []string{`{"keys":[{"keyName":"key1","value":"firstKey"}]}`},
+			err:           "the key key2 is not listed",
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
+			if tt.keyName == "" {
+				tt.keyName = accountKey1
+			}
+
 			cli := storage.NewAccountsClient("subscription_id")
 			sender := mocks.NewSender()
 			for _, resp := range tt.responses {
@@ -105,6 +158,7 @@ func Test_cachedKey_get(t *testing.T) {
 				cli,
 				tt.resourceGroup,
 				tt.account,
+				tt.keyName,
 			)
 			if err != nil {
 				if len(tt.err) == 0 {
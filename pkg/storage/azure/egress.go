@@ -0,0 +1,62 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// networkRuleSetSourceIPs returns the source addresses allowed by the
+// network rules of a storage account and whether the rules restrict them
+// at all.
+func networkRuleSetSourceIPs(rules *storage.NetworkRuleSet) ([]string, bool) {
+	if rules == nil || rules.DefaultAction != storage.DefaultActionDeny {
+		return nil, false
+	}
+	var allowed []string
+	if rules.IPRules != nil {
+		for _, rule := range *rules.IPRules {
+			if rule.IPAddressOrRange != nil && (rule.Action == "" || rule.Action == storage.Allow) {
+				allowed = append(allowed, *rule.IPAddressOrRange)
+			}
+		}
+	}
+	return allowed, true
+}
+
+// DeniedEgressIPs returns the IPs out of ips the network rules of the
+// storage account deny. The rules can only be read through the Azure
+// Resource Manager, not with an account key.
+func (d *driver) DeniedEgressIPs(ips []string) ([]string, error) {
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AccountKey != "" {
+		return nil, fmt.Errorf("the network rules of the storage account cannot be read with an account key")
+	}
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return nil, err
+	}
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := storageAccountsClient.GetProperties(d.Context, cfg.ResourceGroup, d.Config.AccountName, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+	if account.AccountProperties == nil {
+		return nil, nil
+	}
+
+	allowed, restricted := networkRuleSetSourceIPs(account.AccountProperties.NetworkRuleSet)
+	if !restricted {
+		return nil, nil
+	}
+	return util.DeniedIPs(ips, allowed), nil
+}
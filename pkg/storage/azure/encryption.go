@@ -0,0 +1,298 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageEncryptionCondition reports whether the storage account is
+// encrypted with the customer-managed key set by the user.
+const storageEncryptionCondition = "AzureStorageEncryption"
+
+// keySourceKeyVault is the key source of storage accounts encrypted with a
+// customer-managed key.
+const keySourceKeyVault = "Microsoft.Keyvault"
+
+// Encryption configures how the storage account provisioned by the
+// operator is encrypted. Accounts are encrypted with Microsoft-managed keys
+// unless KeyVaultProperties is set.
+type Encryption struct {
+	// KeyVaultProperties references the customer-managed key the storage
+	// account is encrypted with.
+	KeyVaultProperties *KeyVaultProperties `json:"keyVaultProperties,omitempty"`
+}
+
+// KeyVaultProperties references a key of an Azure Key Vault, along with the
+// identity the storage account reads it with.
+type KeyVaultProperties struct {
+	// KeyVaultURI is the URI of the key vault, e.g.
+	// https://vault.vault.azure.net.
+	KeyVaultURI string `json:"keyVaultURI"`
+	// KeyName is the name of the key in the key vault.
+	KeyName string `json:"keyName"`
+	// KeyVersion pins a version of the key. The storage account follows
+	// the current version of the key when it is empty, i.e. the key is
+	// rotated automatically.
+	KeyVersion string `json:"keyVersion,omitempty"`
+	// Identity is the resource ID of the user-assigned managed identity
+	// granted access to the key. It is assigned to the storage account.
+	Identity string `json:"identity"`
+}
+
+// getEncryption returns the encryption set in the storage.azure.encryption
+// section of the unsupported config overrides, or nil if there is none.
+func getEncryption(cr *imageregistryv1.Config) (*Encryption, error) {
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides == nil || overrides.Encryption == nil {
+		return nil, nil
+	}
+
+	encryption := overrides.Encryption
+	kv := encryption.KeyVaultProperties
+	if kv == nil {
+		return encryption, nil
+	}
+	if u, err := url.Parse(kv.KeyVaultURI); err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Azure storage encryption: %q is not the https URI of a key vault", kv.KeyVaultURI)
+	}
+	if kv.KeyName == "" {
+		return nil, fmt.Errorf("invalid Azure storage encryption: the key name is required")
+	}
+	parts := strings.Split(strings.Trim(kv.Identity, "/"), "/")
+	if len(parts) != 8 || !strings.EqualFold(parts[5], "Microsoft.ManagedIdentity") || !strings.EqualFold(parts[6], "userAssignedIdentities") {
+		return nil, fmt.Errorf("invalid Azure storage encryption: %q is not the resource ID of a user-assigned managed identity", kv.Identity)
+	}
+	return encryption, nil
+}
+
+// accountEncryption holds the encryption properties of a storage account,
+// the SDK in use predates the identity used to read the key.
+type accountEncryption struct {
+	Identity *struct {
+		Type                   string                     `json:"type,omitempty"`
+		UserAssignedIdentities map[string]json.RawMessage `json:"userAssignedIdentities,omitempty"`
+	} `json:"identity,omitempty"`
+	Properties struct {
+		Encryption *struct {
+			KeySource          string `json:"keySource,omitempty"`
+			KeyVaultProperties *struct {
+				KeyName                       string `json:"keyname,omitempty"`
+				KeyVersion                    string `json:"keyversion,omitempty"`
+				KeyVaultURI                   string `json:"keyvaulturi,omitempty"`
+				CurrentVersionedKeyIdentifier string `json:"currentVersionedKeyIdentifier,omitempty"`
+			} `json:"keyvaultproperties,omitempty"`
+			Identity *struct {
+				UserAssignedIdentity string `json:"userAssignedIdentity,omitempty"`
+			} `json:"identity,omitempty"`
+		} `json:"encryption,omitempty"`
+	} `json:"properties"`
+}
+
+// uses returns true if the account is encrypted with the key kv.
+func (a *accountEncryption) uses(kv *KeyVaultProperties) bool {
+	enc := a.Properties.Encryption
+	if enc == nil || !strings.EqualFold(enc.KeySource, keySourceKeyVault) || enc.KeyVaultProperties == nil || enc.Identity == nil {
+		return false
+	}
+	current := enc.KeyVaultProperties
+	return strings.EqualFold(strings.TrimSuffix(current.KeyVaultURI, "/"), strings.TrimSuffix(kv.KeyVaultURI, "/")) &&
+		current.KeyName == kv.KeyName &&
+		current.KeyVersion == kv.KeyVersion &&
+		strings.EqualFold(enc.Identity.UserAssignedIdentity, kv.Identity)
+}
+
+// identityType returns the identity type of an account using the
+// user-assigned identity, the system-assigned identity of the account is
+// kept.
+func (a *accountEncryption) identityType() string {
+	if a != nil && a.Identity != nil && strings.Contains(a.Identity.Type, "SystemAssigned") {
+		return "SystemAssigned,UserAssigned"
+	}
+	return "UserAssigned"
+}
+
+// encryptionProperties returns the identity and encryption properties of an
+// account encrypted with the key kv. The identities already assigned to the
+// account are kept.
+func encryptionProperties(kv *KeyVaultProperties, current *accountEncryption) (map[string]interface{}, map[string]interface{}) {
+	identities := map[string]interface{}{
+		kv.Identity: map[string]interface{}{},
+	}
+	if current != nil && current.Identity != nil {
+		for id := range current.Identity.UserAssignedIdentities {
+			identities[id] = map[string]interface{}{}
+		}
+	}
+	identity := map[string]interface{}{
+		"type":                   current.identityType(),
+		"userAssignedIdentities": identities,
+	}
+
+	encryption := map[string]interface{}{
+		"keySource": keySourceKeyVault,
+		"keyvaultproperties": map[string]interface{}{
+			"keyvaulturi": kv.KeyVaultURI,
+			"keyname":     kv.KeyName,
+			// an empty version makes the account follow the
+			// current version of the key.
+			"keyversion": kv.KeyVersion,
+		},
+		"identity": map[string]interface{}{
+			"userAssignedIdentity": kv.Identity,
+		},
+		"services": map[string]interface{}{
+			"blob": map[string]interface{}{"enabled": true, "keyType": "Account"},
+		},
+	}
+	return identity, encryption
+}
+
+// withEncryption encrypts the storage account being created with the
+// customer-managed key kv. It has to follow withProtocolsDisabled, which
+// sets an API version knowing the identity of the key.
+func withEncryption(kv *KeyVaultProperties) autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err != nil {
+				return r, err
+			}
+
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				return r, err
+			}
+			r.Body.Close()
+			props, _ := body["properties"].(map[string]interface{})
+			if props == nil {
+				props = map[string]interface{}{}
+				body["properties"] = props
+			}
+			body["identity"], props["encryption"] = encryptionProperties(kv, nil)
+			return autorest.Prepare(r, autorest.WithJSON(body))
+		})
+	}
+}
+
+// getEncryptionProperties returns the encryption properties of the storage
+// account.
+func (d *driver) getEncryptionProperties(cli storage.AccountsClient, resourceGroup string) (*accountEncryption, error) {
+	req, err := d.accountRequest(cli, resourceGroup, autorest.AsGet())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var account accountEncryption
+	err = autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&account),
+		autorest.ByClosing(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// updateEncryption encrypts the storage account with the key kv.
+func (d *driver) updateEncryption(cli storage.AccountsClient, resourceGroup string, kv *KeyVaultProperties, current *accountEncryption) error {
+	identity, encryption := encryptionProperties(kv, current)
+	req, err := d.accountRequest(cli, resourceGroup,
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPatch(),
+		autorest.WithJSON(map[string]interface{}{
+			"identity": identity,
+			"properties": map[string]interface{}{
+				"encryption": encryption,
+			},
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return err
+	}
+	return autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByClosing(),
+	)
+}
+
+// syncEncryption makes the storage account managed by the operator use the
+// customer-managed key set by the user, e.g. after the key version was
+// rotated. Accounts not managed by the operator are only checked.
+func (d *driver) syncEncryption(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	encryption, err := getEncryption(cr)
+	if err != nil {
+		util.UpdateCondition(cr, storageEncryptionCondition, operatorapiv1.ConditionFalse, "InvalidConfiguration", err.Error())
+		return err
+	}
+	if encryption == nil || encryption.KeyVaultProperties == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, storageEncryptionCondition)
+		return nil
+	}
+	kv := encryption.KeyVaultProperties
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	account, err := d.getEncryptionProperties(storageAccountsClient, cfg.ResourceGroup)
+	if err != nil {
+		return fmt.Errorf("unable to get the properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+
+	key := fmt.Sprintf("%s/keys/%s", strings.TrimSuffix(kv.KeyVaultURI, "/"), kv.KeyName)
+	if kv.KeyVersion != "" {
+		key += "/" + kv.KeyVersion
+	}
+	if account.uses(kv) {
+		msg := fmt.Sprintf("The storage account %s is encrypted with the key %s", d.Config.AccountName, key)
+		if current := account.Properties.Encryption.KeyVaultProperties.CurrentVersionedKeyIdentifier; current != "" {
+			msg += fmt.Sprintf(", currently %s", current)
+		}
+		util.UpdateCondition(cr, storageEncryptionCondition, operatorapiv1.ConditionTrue, "CustomerManagedKey", msg)
+		return nil
+	}
+
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		util.UpdateCondition(cr, storageEncryptionCondition, operatorapiv1.ConditionFalse, "KeyMismatch",
+			fmt.Sprintf("The storage account %s is not managed by the operator and is not encrypted with the key %s", d.Config.AccountName, key))
+		return nil
+	}
+
+	if err := d.updateEncryption(storageAccountsClient, cfg.ResourceGroup, kv, account); err != nil {
+		util.UpdateCondition(cr, storageEncryptionCondition, operatorapiv1.ConditionFalse, "UpdateFailed",
+			fmt.Sprintf("Unable to encrypt the storage account %s with the key %s: %s", d.Config.AccountName, key, err))
+		return err
+	}
+	klog.Infof("the storage account %s is now encrypted with the key %s", d.Config.AccountName, key)
+	util.UpdateCondition(cr, storageEncryptionCondition, operatorapiv1.ConditionTrue, "CustomerManagedKey",
+		fmt.Sprintf("The storage account %s is encrypted with the key %s", d.Config.AccountName, key))
+	return nil
+}
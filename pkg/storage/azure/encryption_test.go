@@ -0,0 +1,194 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+const testIdentity = "/subscriptions/subscription_id/resourceGroups/resource_group/providers/Microsoft.ManagedIdentity/userAssignedIdentities/registry-cmk"
+
+func TestGetEncryption(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		err       string
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:      "customer-managed key",
+			overrides: `{"storage":{"azure":{"encryption":{"keyVaultProperties":{"keyVaultURI":"https://vault.vault.azure.net","keyName":"registry","identity":"` + testIdentity + `"}}}}}`,
+		},
+		{
+			name:      "invalid key vault URI",
+			overrides: `{"storage":{"azure":{"encryption":{"keyVaultProperties":{"keyVaultURI":"vault","keyName":"registry","identity":"` + testIdentity + `"}}}}}`,
+			err:       `"vault" is not the https URI of a key vault`,
+		},
+		{
+			name:      "no key name",
+			overrides: `{"storage":{"azure":{"encryption":{"keyVaultProperties":{"keyVaultURI":"https://vault.vault.azure.net","identity":"` + testIdentity + `"}}}}}`,
+			err:       "the key name is required",
+		},
+		{
+			name:      "invalid identity",
+			overrides: `{"storage":{"azure":{"encryption":{"keyVaultProperties":{"keyVaultURI":"https://vault.vault.azure.net","keyName":"registry","identity":"registry-cmk"}}}}}`,
+			err:       "is not the resource ID of a user-assigned managed identity",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+			_, err := getEncryption(cr)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSyncEncryption(t *testing.T) {
+	const overrides = `{"storage":{"azure":{"encryption":{"keyVaultProperties":{"keyVaultURI":"https://vault.vault.azure.net","keyName":"registry","keyVersion":"v2","identity":"` + testIdentity + `"}}}}}`
+	encrypted := func(version string) string {
+		return `{"identity":{"type":"SystemAssigned,UserAssigned","userAssignedIdentities":{"` + testIdentity + `":{}}},` +
+			`"properties":{"encryption":{"keySource":"Microsoft.Keyvault","keyvaultproperties":{"keyvaulturi":"https://vault.vault.azure.net/","keyname":"registry","keyversion":"` + version + `"},` +
+			`"identity":{"userAssignedIdentity":"` + testIdentity + `"}}}}`
+	}
+
+	for _, tt := range []struct {
+		name    string
+		state   string
+		account string
+		patched bool
+		status  operatorapiv1.ConditionStatus
+		reason  string
+	}{
+		{
+			name:    "up to date",
+			state:   imageregistryv1.StorageManagementStateManaged,
+			account: encrypted("v2"),
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "CustomerManagedKey",
+		},
+		{
+			name:    "rotated key",
+			state:   imageregistryv1.StorageManagementStateManaged,
+			account: encrypted("v1"),
+			patched: true,
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "CustomerManagedKey",
+		},
+		{
+			name:    "microsoft-managed keys",
+			state:   imageregistryv1.StorageManagementStateManaged,
+			account: `{"properties":{"encryption":{"keySource":"Microsoft.Storage"}}}`,
+			patched: true,
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "CustomerManagedKey",
+		},
+		{
+			name:    "unmanaged account",
+			state:   imageregistryv1.StorageManagementStateUnmanaged,
+			account: encrypted("v1"),
+			status:  operatorapiv1.ConditionFalse,
+			reason:  "KeyMismatch",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+			sender.AddResponse(http.StatusOK, tt.account)
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.state
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(overrides)}
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncEncryption(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var patched bool
+			for _, req := range sender.Requests() {
+				if req.Method != http.MethodPatch {
+					continue
+				}
+				patched = true
+				var body accountEncryption
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				if !body.uses(&KeyVaultProperties{KeyVaultURI: "https://vault.vault.azure.net", KeyName: "registry", KeyVersion: "v2", Identity: testIdentity}) {
+					t.Errorf("the account is not patched with the key: %s", req.Body)
+				}
+				if _, ok := body.Identity.UserAssignedIdentities[testIdentity]; !ok {
+					t.Errorf("the identity is not assigned to the account: %s", req.Body)
+				}
+			}
+			if patched != tt.patched {
+				t.Errorf("got patched %t, want %t", patched, tt.patched)
+			}
+
+			cond := cr.Status.Conditions[0]
+			if cond.Type != storageEncryptionCondition || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.status, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCreateStorageAccountWithCustomerManagedKey(t *testing.T) {
+	sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+	sender.AddResponse(http.StatusOK, `{"name":"account"}`)
+
+	drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{}, nil)
+	drv.authorizer = autorest.NullAuthorizer{}
+	drv.sender = sender
+
+	environment, _ := getEnvironmentByName("")
+	cli, err := drv.storageAccountsClient(&Azure{SubscriptionID: "subscription_id"}, environment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := &KeyVaultProperties{KeyVaultURI: "https://vault.vault.azure.net", KeyName: "registry", Identity: testIdentity}
+	if err := drv.createStorageAccount(cli, "resource_group", "account", "eastus", "", nil, &Encryption{KeyVaultProperties: kv}, storage.StandardLRS); err != nil {
+		t.Fatal(err)
+	}
+
+	req := sender.Requests()[0]
+	if got := req.URL.Query().Get("api-version"); got != protocolsAPIVersion {
+		t.Errorf("got api-version %s, want %s", got, protocolsAPIVersion)
+	}
+	var body accountEncryption
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.uses(kv) || body.Identity == nil || body.Identity.Type != "UserAssigned" {
+		t.Errorf("the account is not created with the key: %s", req.Body)
+	}
+	if !strings.Contains(string(req.Body), `"isSftpEnabled":false`) {
+		t.Errorf("the protocols are no longer disabled: %s", req.Body)
+	}
+
+	err = drv.createStorageAccount(cli, "resource_group", "account", "eastus", "AZURESTACKCLOUD", nil, &Encryption{KeyVaultProperties: kv}, storage.StandardLRS)
+	if err == nil {
+		t.Errorf("expected an error on Azure Stack Hub")
+	}
+}
@@ -0,0 +1,117 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageGeoRedundancyCondition reports whether the storage account is read
+// access geo redundant, along with its secondary blob endpoint.
+const storageGeoRedundancyCondition = "AzureStorageGeoRedundancy"
+
+// accountSKU keeps the SKU of the storage account in a cache.
+var accountSKU cachedSKU
+
+// cachedSKU holds the SKU of a storage account in memory for thirty minutes,
+// the SKU changes rarely and is checked on every sync.
+type cachedSKU struct {
+	mtx           sync.Mutex
+	resourceGroup string
+	account       string
+	value         storage.SkuName
+	expire        time.Time
+}
+
+// get returns the cached SKU if it is not expired yet, if expired fetches
+// the account properties using provided AccountsClient.
+func (s *cachedSKU) get(
+	ctx context.Context, cli storage.AccountsClient, resourceGroup, account string,
+) (storage.SkuName, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.resourceGroup == resourceGroup && s.account == account && time.Now().Before(s.expire) {
+		return s.value, nil
+	}
+
+	props, err := cli.GetProperties(ctx, resourceGroup, account, "")
+	if err != nil {
+		return "", err
+	}
+	if props.Sku == nil {
+		return "", fmt.Errorf("the storage account %s has no SKU", account)
+	}
+
+	s.resourceGroup = resourceGroup
+	s.account = account
+	s.value = props.Sku.Name
+	s.expire = time.Now().Add(30 * time.Minute)
+	return s.value, nil
+}
+
+// readAccessGeoRedundant returns true if the blobs of storage accounts with
+// the given SKU can be read from the secondary region.
+func readAccessGeoRedundant(sku storage.SkuName) bool {
+	return sku == storage.StandardRAGRS || sku == storage.StandardRAGZRS
+}
+
+func getSecondaryBlobServiceURL(environment autorestazure.Environment, accountName string) (*url.URL, error) {
+	return url.Parse("https://" + accountName + "-secondary.blob." + environment.StorageEndpointSuffix)
+}
+
+// SecondaryBlobServiceURL returns the endpoint serving the blobs of the
+// storage account from the secondary region. It is only available for read
+// access geo redundant accounts.
+func SecondaryBlobServiceURL(c *imageregistryv1.ImageRegistryConfigStorageAzure) (string, error) {
+	if c.AccountName == "" {
+		return "", fmt.Errorf("storage account name is not set")
+	}
+	environment, err := getEnvironmentByName(c.CloudName)
+	if err != nil {
+		return "", err
+	}
+	u, err := getSecondaryBlobServiceURL(environment, c.AccountName)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// syncGeoRedundancy reports the secondary blob endpoint of read access geo
+// redundant storage accounts, it is where the registry can be switched to
+// during an outage of the primary region.
+func (d *driver) syncGeoRedundancy(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	sku, err := accountSKU.get(d.Context, storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
+	if err != nil {
+		return fmt.Errorf("unable to get the properties of the storage account %s: %s", d.Config.AccountName, err)
+	}
+
+	if !readAccessGeoRedundant(sku) {
+		util.UpdateCondition(cr, storageGeoRedundancyCondition, operatorapiv1.ConditionFalse, "NotReadAccessGeoRedundant",
+			fmt.Sprintf("The storage account %s is %s, its blobs cannot be read from a secondary region", d.Config.AccountName, sku))
+		return nil
+	}
+
+	u, err := getSecondaryBlobServiceURL(environment, d.Config.AccountName)
+	if err != nil {
+		return err
+	}
+	util.UpdateCondition(cr, storageGeoRedundancyCondition, operatorapiv1.ConditionTrue, "ReadAccessGeoRedundant",
+		fmt.Sprintf("The storage account %s is %s, its blobs can be read from the secondary endpoint %s", d.Config.AccountName, sku, u))
+	return nil
+}
@@ -0,0 +1,466 @@
+package azure
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// blobInventoryCondition reports the state of the blob inventory policy
+// configured on the storage account.
+const blobInventoryCondition = "AzureBlobInventory"
+
+// inventoryPolicyAPIVersion is the first storage API version with the per
+// rule destination of blob inventory policies, the SDK in use predates
+// blob inventory.
+const inventoryPolicyAPIVersion = "2021-08-01"
+
+const (
+	// inventoryRuleName is the name of the blob inventory rule managed by
+	// the operator, the reports are delivered under a folder named after
+	// it.
+	inventoryRuleName = "image-registry"
+
+	// defaultInventoryContainer is the container the reports are delivered
+	// to when none is set.
+	defaultInventoryContainer = "image-registry-inventory"
+)
+
+// InventoryReport configures the Azure Blob Inventory reports of the registry
+// container, which are consumed by the inventory job instead of listing the
+// container.
+type InventoryReport struct {
+	// Container is the container of the storage account the reports are
+	// delivered to, it is created by the operator. Defaults to
+	// image-registry-inventory.
+	Container string `json:"container,omitempty"`
+}
+
+// GetInventoryReport returns the settings from the inventory.azureReport
+// section of the unsupported config overrides, or nil if there are none.
+func GetInventoryReport(cr *imageregistryv1.Config) (*InventoryReport, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		Inventory *struct {
+			AzureReport *InventoryReport `json:"azureReport,omitempty"`
+		} `json:"inventory,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	if overrides.Inventory == nil || overrides.Inventory.AzureReport == nil {
+		return nil, nil
+	}
+	report := *overrides.Inventory.AzureReport
+	if report.Container == "" {
+		report.Container = defaultInventoryContainer
+	}
+	return &report, nil
+}
+
+// inventoryPolicy is the blob inventory policy of a storage account.
+type inventoryPolicy struct {
+	Properties struct {
+		Policy struct {
+			Enabled bool                  `json:"enabled"`
+			Type    string                `json:"type"`
+			Rules   []inventoryPolicyRule `json:"rules"`
+		} `json:"policy"`
+	} `json:"properties"`
+}
+
+// inventoryPolicyRule is a rule of a blob inventory policy. The definition
+// is kept as is, so the rules created by others are not altered.
+type inventoryPolicyRule struct {
+	Enabled     bool            `json:"enabled"`
+	Name        string          `json:"name"`
+	Destination string          `json:"destination"`
+	Definition  json.RawMessage `json:"definition"`
+}
+
+// inventoryRuleDefinition is the definition of the rule managed by the
+// operator.
+type inventoryRuleDefinition struct {
+	Format       string   `json:"format"`
+	Schedule     string   `json:"schedule"`
+	ObjectType   string   `json:"objectType"`
+	SchemaFields []string `json:"schemaFields"`
+	Filters      struct {
+		BlobTypes   []string `json:"blobTypes"`
+		PrefixMatch []string `json:"prefixMatch"`
+	} `json:"filters"`
+}
+
+// expectedInventoryRule returns the rule listing the blobs of the registry
+// container every day.
+func expectedInventoryRule(container, destination string) (inventoryPolicyRule, error) {
+	def := inventoryRuleDefinition{
+		Format:       "Csv",
+		Schedule:     "Daily",
+		ObjectType:   "Blob",
+		SchemaFields: []string{"Name", "Content-Length"},
+	}
+	def.Filters.BlobTypes = []string{"blockBlob"}
+	for _, prefix := range inventory.Prefixes {
+		def.Filters.PrefixMatch = append(def.Filters.PrefixMatch, container+"/"+prefix)
+	}
+	data, err := json.Marshal(def)
+	if err != nil {
+		return inventoryPolicyRule{}, err
+	}
+	return inventoryPolicyRule{
+		Enabled:     true,
+		Name:        inventoryRuleName,
+		Destination: destination,
+		Definition:  data,
+	}, nil
+}
+
+// sameInventoryRule returns true if the rules have the same settings.
+func sameInventoryRule(a, b inventoryPolicyRule) bool {
+	if a.Enabled != b.Enabled || a.Name != b.Name || a.Destination != b.Destination {
+		return false
+	}
+	var da, db inventoryRuleDefinition
+	if json.Unmarshal(a.Definition, &da) != nil || json.Unmarshal(b.Definition, &db) != nil {
+		return false
+	}
+	return reflect.DeepEqual(da, db)
+}
+
+// inventoryPolicyRequest returns a request for the blob inventory policy of
+// the storage account.
+func (d *driver) inventoryPolicyRequest(cli storage.AccountsClient, resourceGroup string, decorators ...autorest.PrepareDecorator) (*http.Request, error) {
+	pathParameters := map[string]interface{}{
+		"accountName":       autorest.Encode("path", d.Config.AccountName),
+		"resourceGroupName": autorest.Encode("path", resourceGroup),
+		"subscriptionId":    autorest.Encode("path", cli.SubscriptionID),
+	}
+	decorators = append([]autorest.PrepareDecorator{
+		autorest.WithBaseURL(cli.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.Storage/storageAccounts/{accountName}/inventoryPolicies/default", pathParameters),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": inventoryPolicyAPIVersion}),
+	}, decorators...)
+	return autorest.Prepare((&http.Request{}).WithContext(d.Context), decorators...)
+}
+
+// getInventoryPolicy returns the blob inventory policy of the storage
+// account, nil if it has none.
+func (d *driver) getInventoryPolicy(cli storage.AccountsClient, resourceGroup string) (*inventoryPolicy, error) {
+	req, err := d.inventoryPolicyRequest(cli, resourceGroup, autorest.AsGet())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, autorest.Respond(resp, autorest.ByClosing())
+	}
+
+	var policy inventoryPolicy
+	err = autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&policy),
+		autorest.ByClosing(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// applyInventoryRule replaces the operator rule of the blob inventory policy
+// with rule, or removes it when rule is nil. The rules created by others are
+// kept. It returns true if the policy was changed.
+func (d *driver) applyInventoryRule(cli storage.AccountsClient, resourceGroup string, rule *inventoryPolicyRule) (bool, error) {
+	policy, err := d.getInventoryPolicy(cli, resourceGroup)
+	if err != nil {
+		return false, fmt.Errorf("unable to get the blob inventory policy: %w", err)
+	}
+	if policy == nil {
+		if rule == nil {
+			return false, nil
+		}
+		policy = &inventoryPolicy{}
+	}
+
+	var rules []inventoryPolicyRule
+	var current *inventoryPolicyRule
+	for i, r := range policy.Properties.Policy.Rules {
+		if r.Name == inventoryRuleName {
+			current = &policy.Properties.Policy.Rules[i]
+			continue
+		}
+		rules = append(rules, r)
+	}
+	switch {
+	case rule == nil && current == nil:
+		return false, nil
+	case rule != nil && current != nil && sameInventoryRule(*rule, *current) && policy.Properties.Policy.Enabled:
+		return false, nil
+	case rule != nil:
+		rules = append(rules, *rule)
+	}
+
+	var req *http.Request
+	if len(rules) == 0 {
+		req, err = d.inventoryPolicyRequest(cli, resourceGroup, autorest.AsDelete())
+	} else {
+		policy.Properties.Policy.Enabled = true
+		policy.Properties.Policy.Type = "Inventory"
+		policy.Properties.Policy.Rules = rules
+		req, err = d.inventoryPolicyRequest(cli, resourceGroup,
+			autorest.AsContentType("application/json; charset=utf-8"),
+			autorest.AsPut(),
+			autorest.WithJSON(policy),
+		)
+	}
+	if err != nil {
+		return false, err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return false, err
+	}
+	err = autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusNoContent),
+		autorest.ByClosing(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("unable to update the blob inventory policy: %w", err)
+	}
+	return true, nil
+}
+
+// syncInventoryPolicy configures the blob inventory policy of the storage
+// account to deliver reports for the registry container when the user asked
+// for them, and removes the operator rule once they are no longer wanted.
+func (d *driver) syncInventoryPolicy(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment, cred azblob.Credential) error {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged || strings.EqualFold(d.Config.CloudName, "AZURESTACKCLOUD") {
+		return nil
+	}
+	report, err := GetInventoryReport(cr)
+	if err != nil {
+		return err
+	}
+	// the policy is only read when the operator configured it, so the
+	// credentials of clusters not using the reports need no access to it.
+	if report == nil && v1helpers.FindOperatorCondition(cr.Status.Conditions, blobInventoryCondition) == nil {
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+
+	if report == nil {
+		if _, err := d.applyInventoryRule(storageAccountsClient, cfg.ResourceGroup, nil); err != nil {
+			return err
+		}
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, blobInventoryCondition)
+		return nil
+	}
+
+	err = d.createStorageContainer(environment, d.Config.AccountName, cred, report.Container)
+	if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeContainerAlreadyExists {
+		err = nil
+	}
+	if err != nil {
+		util.UpdateCondition(cr, blobInventoryCondition, operatorapiv1.ConditionFalse, "Unknown Error Occurred",
+			fmt.Sprintf("Unable to create the inventory container %s: %s", report.Container, err))
+		return err
+	}
+
+	rule, err := expectedInventoryRule(d.Config.Container, report.Container)
+	if err != nil {
+		return err
+	}
+	changed, err := d.applyInventoryRule(storageAccountsClient, cfg.ResourceGroup, &rule)
+	if err != nil {
+		util.UpdateCondition(cr, blobInventoryCondition, operatorapiv1.ConditionFalse, "Unknown Error Occurred", err.Error())
+		return err
+	}
+	if changed {
+		klog.Infof("blob inventory policy of the storage account %s configured to deliver reports to %s", d.Config.AccountName, report.Container)
+	}
+	util.UpdateCondition(cr, blobInventoryCondition, operatorapiv1.ConditionTrue, "AsExpected",
+		fmt.Sprintf("Blob inventory reports are delivered daily to the container %s", report.Container))
+	return nil
+}
+
+// inventoryManifest is the manifest delivered with each blob inventory
+// report.
+type inventoryManifest struct {
+	Status string `json:"status"`
+	Files  []struct {
+		Blob string `json:"blob"`
+	} `json:"files"`
+}
+
+// inventoryManifestSuffix returns the suffix of the names of the manifests
+// of rule. Reports are delivered under <date>/<time>/<rule>/, the manifest
+// is named <rule>-manifest.json.
+func inventoryManifestSuffix(rule string) string {
+	return "/" + rule + "/" + rule + "-manifest.json"
+}
+
+// InventoryFromReports accounts the blobs listed in the most recent
+// successful blob inventory report delivered to location. The bucket of
+// location is the container of the reports, the prefix the rule name, they
+// default to the ones set up by the operator.
+func (d *driver) InventoryFromReports(ctx context.Context, report *inventory.Report, location inventory.ReportLocation) error {
+	if location.Bucket == "" {
+		location.Bucket = defaultInventoryContainer
+	}
+	if location.Prefix == "" {
+		location.Prefix = inventoryRuleName
+	}
+
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return err
+	}
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return err
+	}
+	cred, err := d.blobCredential(cfg, environment)
+	if err != nil {
+		return err
+	}
+	container, err := d.getStorageContainer(environment, d.Config.AccountName, cred, location.Bucket)
+	if err != nil {
+		return err
+	}
+	return inventoryFromReports(ctx, container, report, location.Prefix)
+}
+
+func inventoryFromReports(ctx context.Context, container azblob.ContainerURL, report *inventory.Report, rule string) error {
+	suffix := inventoryManifestSuffix(rule)
+	var manifests []string
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to list inventory reports: %w", err)
+		}
+		for _, blob := range resp.Segment.BlobItems {
+			if strings.HasSuffix(blob.Name, suffix) {
+				manifests = append(manifests, blob.Name)
+			}
+		}
+		marker = resp.NextMarker
+	}
+
+	// the reports are delivered under a folder named after the time they
+	// were generated, so the most recent one sorts last.
+	sort.Sort(sort.Reverse(sort.StringSlice(manifests)))
+	for _, name := range manifests {
+		var manifest inventoryManifest
+		if err := readInventoryBlob(ctx, container, name, func(r io.Reader) error {
+			return json.NewDecoder(r).Decode(&manifest)
+		}); err != nil {
+			return fmt.Errorf("unable to read inventory manifest %s: %w", name, err)
+		}
+		if manifest.Status != "Succeeded" {
+			klog.Infof("skipping blob inventory report %s with status %s", name, manifest.Status)
+			continue
+		}
+		klog.Infof("using blob inventory report %s", name)
+
+		for _, file := range manifest.Files {
+			if err := readInventoryBlob(ctx, container, file.Blob, func(r io.Reader) error {
+				return addInventoryCSV(report, r)
+			}); err != nil {
+				return fmt.Errorf("unable to read inventory file %s: %w", file.Blob, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("no successful blob inventory report found for the rule %s", rule)
+}
+
+func readInventoryBlob(ctx context.Context, container azblob.ContainerURL, name string, fn func(io.Reader) error) error {
+	resp, err := container.NewBlobURL(name).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return err
+	}
+	body := resp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 3})
+	defer body.Close()
+	return fn(body)
+}
+
+// addInventoryCSV accounts the blobs listed in a CSV report file. The first
+// record holds the names of the fields.
+func addInventoryCSV(report *inventory.Report, r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	nameColumn, sizeColumn := -1, -1
+	for i, field := range header {
+		switch strings.TrimSpace(field) {
+		case "Name":
+			nameColumn = i
+		case "Content-Length":
+			sizeColumn = i
+		}
+	}
+	if nameColumn == -1 || sizeColumn == -1 {
+		return fmt.Errorf("inventory reports must include the Name and Content-Length fields, got %q", strings.Join(header, ","))
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) <= nameColumn || len(record) <= sizeColumn {
+			return fmt.Errorf("unexpected record with %d fields", len(record))
+		}
+		if !inventory.IsBlob(record[nameColumn]) {
+			continue
+		}
+		size, err := strconv.ParseInt(record[sizeColumn], 10, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse size of %s: %w", record[nameColumn], err)
+		}
+		report.Add(size)
+	}
+}
@@ -0,0 +1,163 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
+)
+
+func TestAddInventoryCSV(t *testing.T) {
+	const data = `Name,Content-Length,Last-Modified
+docker/registry/v2/blobs/sha256/aa/aaaa/data,1024,2024-03-01T12:00:00Z
+docker/registry/v2/blobs/sha256/bb/bbbb/data,20971520,2024-03-01T12:00:00Z
+docker/registry/v2/repositories/foo/_layers/sha256/aaaa/link,71,2024-03-01T12:00:00Z
+"docker/registry/v2/blobs/sha256/cc/cccc/data",2147483648,2024-03-01T12:00:00Z
+shards/team-a/docker/registry/v2/blobs/sha256/dd/dddd/data,512,2024-03-01T12:00:00Z
+shards/team-a/docker/registry/v2/repositories/bar/_layers/sha256/dddd/link,71,2024-03-01T12:00:00Z
+`
+	report := inventory.NewReport("Azure")
+	if err := addInventoryCSV(report, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if report.Objects != 4 || report.Bytes != 1024+20971520+2147483648+512 {
+		t.Errorf("got %d objects and %d bytes, want 4 objects and %d bytes", report.Objects, report.Bytes, 1024+20971520+2147483648+512)
+	}
+	if report.Sizes["1Mi"] != 2 || report.Sizes["100Mi"] != 1 || report.Sizes["+Inf"] != 1 {
+		t.Errorf("unexpected sizes %v", report.Sizes)
+	}
+
+	err := addInventoryCSV(inventory.NewReport("Azure"), strings.NewReader("Name,Last-Modified\n"))
+	if err == nil {
+		t.Errorf("expected an error for reports without the Content-Length field")
+	}
+}
+
+func TestApplyInventoryRule(t *testing.T) {
+	rule, err := expectedInventoryRule("registry", defaultInventoryContainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleJSON, err := json.Marshal(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := `{"enabled":true,"name":"audit","destination":"audit","definition":{"format":"Parquet","schedule":"Weekly","objectType":"Container","schemaFields":["Name"]}}`
+
+	for _, tt := range []struct {
+		name           string
+		policy         string
+		remove         bool
+		expectedMethod string
+		expectedRules  []string
+	}{
+		{
+			name:           "no policy",
+			expectedMethod: http.MethodPut,
+			expectedRules:  []string{inventoryRuleName},
+		},
+		{
+			name:           "policy with another rule",
+			policy:         `{"properties":{"policy":{"enabled":true,"type":"Inventory","rules":[` + other + `]}}}`,
+			expectedMethod: http.MethodPut,
+			expectedRules:  []string{"audit", inventoryRuleName},
+		},
+		{
+			name:   "up to date",
+			policy: `{"properties":{"policy":{"enabled":true,"type":"Inventory","rules":[` + string(ruleJSON) + `]}}}`,
+		},
+		{
+			name:           "remove with another rule",
+			policy:         `{"properties":{"policy":{"enabled":true,"type":"Inventory","rules":[` + other + `,` + string(ruleJSON) + `]}}}`,
+			remove:         true,
+			expectedMethod: http.MethodPut,
+			expectedRules:  []string{"audit"},
+		},
+		{
+			name:           "remove the only rule",
+			policy:         `{"properties":{"policy":{"enabled":true,"type":"Inventory","rules":[` + string(ruleJSON) + `]}}}`,
+			remove:         true,
+			expectedMethod: http.MethodDelete,
+		},
+		{
+			name:   "remove without policy",
+			remove: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+			if tt.policy == "" {
+				sender.AddResponse(http.StatusNotFound, `{"error":{"code":"BlobInventoryPolicyNotFound"}}`)
+			} else {
+				sender.AddResponse(http.StatusOK, tt.policy)
+			}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account", Container: "registry"}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			environment, _ := getEnvironmentByName("")
+			cli, err := drv.storageAccountsClient(&Azure{SubscriptionID: "subscription_id"}, environment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &rule
+			if tt.remove {
+				r = nil
+			}
+			changed, err := drv.applyInventoryRule(cli, "resource_group", r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reqs := sender.Requests()
+			if changed != (tt.expectedMethod != "") {
+				t.Errorf("got changed %t, want %t", changed, tt.expectedMethod != "")
+			}
+			if tt.expectedMethod == "" {
+				if len(reqs) != 1 {
+					t.Errorf("got %d requests, want only the policy to be read", len(reqs))
+				}
+				return
+			}
+			if len(reqs) != 2 {
+				t.Fatalf("got %d requests, want 2", len(reqs))
+			}
+			req := reqs[1]
+			if req.Method != tt.expectedMethod {
+				t.Errorf("got method %s, want %s", req.Method, tt.expectedMethod)
+			}
+			if !strings.HasSuffix(req.URL.Path, "/storageAccounts/account/inventoryPolicies/default") {
+				t.Errorf("got path %s, want the inventory policy of the account", req.URL.Path)
+			}
+			if tt.expectedMethod != http.MethodPut {
+				return
+			}
+
+			var policy inventoryPolicy
+			if err := json.Unmarshal(req.Body, &policy); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, r := range policy.Properties.Policy.Rules {
+				names = append(names, r.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expectedRules, ",") {
+				t.Errorf("got rules %v, want %v", names, tt.expectedRules)
+			}
+			for _, r := range policy.Properties.Policy.Rules {
+				if r.Name == "audit" && !strings.Contains(string(r.Definition), `"Parquet"`) {
+					t.Errorf("the definition of the other rule was altered: %s", r.Definition)
+				}
+			}
+		})
+	}
+}
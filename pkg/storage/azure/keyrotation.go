@@ -0,0 +1,274 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// keyRotationCondition reports the rotation of the storage account keys.
+const keyRotationCondition = "AzureAccountKeyRotation"
+
+// The names of the storage account keys.
+const (
+	accountKey1 = "key1"
+	accountKey2 = "key2"
+)
+
+// keyRotationInterval returns how often the storage account keys are rotated,
+// as set in storage.azure.keyRotationInterval in the unsupported config
+// overrides. The keys are not rotated if it is zero.
+func keyRotationInterval(cr *imageregistryv1.Config) (time.Duration, error) {
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return 0, err
+	}
+	if overrides == nil || overrides.KeyRotationInterval == nil {
+		return 0, nil
+	}
+	interval := overrides.KeyRotationInterval.Duration
+	if interval < 0 {
+		return 0, fmt.Errorf("invalid unsupportedConfigOverrides: storage.azure.keyRotationInterval must not be negative")
+	}
+	return interval, nil
+}
+
+// activeKeyName returns the name of the key the registry uses according to
+// the registry config.
+func activeKeyName(cr *imageregistryv1.Config) string {
+	if cr.Annotations[defaults.AzureAccountKeyAnnotation] == accountKey2 {
+		return accountKey2
+	}
+	return accountKey1
+}
+
+func otherKeyName(name string) string {
+	if name == accountKey1 {
+		return accountKey2
+	}
+	return accountKey1
+}
+
+// ReadConfigState makes the driver use the storage account key recorded in
+// the registry config, if the config records the keys of the driver's
+// storage account.
+func (d *driver) ReadConfigState(cr *imageregistryv1.Config) {
+	d.accountKeyName = ""
+	if cr.Status.Storage.Azure != nil && cr.Status.Storage.Azure.AccountName == d.Config.AccountName {
+		d.accountKeyName = activeKeyName(cr)
+	}
+}
+
+// activeKey returns the name of the key the driver uses, key1 unless the
+// keys were rotated.
+func (d *driver) activeKey() string {
+	if d.accountKeyName == "" {
+		return accountKey1
+	}
+	return d.accountKeyName
+}
+
+// readsPrivateConfiguration returns true if the pods of deploy read the
+// storage credentials from the registry private configuration secret.
+func readsPrivateConfiguration(deploy *appsv1.Deployment) bool {
+	for _, c := range deploy.Spec.Template.Spec.Containers {
+		for _, env := range c.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == defaults.ImageRegistryPrivateConfiguration {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// registryDeployments returns the deployments whose pods use the storage
+// account key, i.e. the registry deployment and its failover and shard
+// deployments.
+func (d *driver) registryDeployments() ([]*appsv1.Deployment, error) {
+	if d.Listers == nil || d.Listers.Deployments == nil {
+		return nil, nil
+	}
+	deploys, err := d.Listers.Deployments.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var registry []*appsv1.Deployment
+	for _, deploy := range deploys {
+		if readsPrivateConfiguration(deploy) {
+			registry = append(registry, deploy)
+		}
+	}
+	return registry, nil
+}
+
+// rolloutGenerations returns the generations of the registry deployments
+// recorded when the registry was switched to the current key.
+func rolloutGenerations(cr *imageregistryv1.Config) map[string]int64 {
+	generations := map[string]int64{}
+	if value := cr.Annotations[defaults.AzureAccountKeyRolloutAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &generations); err != nil {
+			klog.Warningf("ignoring the invalid annotation %s: %s", defaults.AzureAccountKeyRolloutAnnotation, err)
+		}
+	}
+	return generations
+}
+
+// registryRolledOut returns true if every registry deployment was updated
+// after the switch to the current key and all their replicas run the
+// updated pod template. Deployments created after the switch use the
+// current key from the start.
+func (d *driver) registryRolledOut(cr *imageregistryv1.Config) (bool, error) {
+	deploys, err := d.registryDeployments()
+	if err != nil || len(deploys) == 0 {
+		return false, err
+	}
+	switched := rolloutGenerations(cr)
+	for _, deploy := range deploys {
+		if deploy.Generation <= switched[deploy.Name] ||
+			deploy.Status.ObservedGeneration < deploy.Generation ||
+			deploy.Status.UpdatedReplicas != deploy.Status.Replicas ||
+			deploy.Status.AvailableReplicas != deploy.Status.Replicas {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// regenerateAccountKey regenerates the named key of the storage account.
+func (d *driver) regenerateAccountKey(cli storage.AccountsClient, resourceGroup, name string) error {
+	_, err := cli.RegenerateKey(d.Context, resourceGroup, d.Config.AccountName, storage.AccountRegenerateKeyParameters{
+		KeyName: to.StringPtr(name),
+	})
+	primaryKey.invalidate()
+	if err != nil {
+		return fmt.Errorf("failed to regenerate the key %s of the storage account %s: %s", name, d.Config.AccountName, err)
+	}
+	return nil
+}
+
+// syncKeyRotation rotates the keys of the storage account once the interval
+// set in the unsupported config overrides has elapsed and the maintenance
+// window is open. The key the registry does not use is regenerated and the
+// registry is switched to it, the key used so far is regenerated once the
+// registry is rolled out, so running pods are not left with an invalid key.
+func (d *driver) syncKeyRotation(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment, now time.Time) error {
+	if cfg.AccountKey != "" {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, keyRotationCondition)
+		return nil
+	}
+
+	id := accountID(cfg, d.Config.AccountName)
+	active := activeKeyName(cr)
+	d.accountKeyName = active
+
+	interval, err := keyRotationInterval(cr)
+	if err != nil {
+		return err
+	}
+	pending := cr.Annotations[defaults.AzureAccountKeyPendingAnnotation]
+	if interval == 0 && pending == "" {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, keyRotationCondition)
+		return nil
+	}
+
+	if disabled, _ := sharedKeyAccess.get(id); disabled || cfg.FederatedTokenFile != "" {
+		util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionFalse, "NotApplicable",
+			"The registry does not use the keys of the storage account")
+		return nil
+	}
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionFalse, "NotManaged",
+			fmt.Sprintf("The storage account %s is not managed by the operator, its keys are not rotated", d.Config.AccountName))
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+
+	rotated, _ := time.Parse(time.RFC3339, cr.Annotations[defaults.AzureAccountKeyRotatedAnnotation])
+	if pending != "" {
+		rolledOut, err := d.registryRolledOut(cr)
+		if err != nil {
+			return err
+		}
+		if !rolledOut {
+			util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionTrue, "Rotating",
+				fmt.Sprintf("The registry is being rolled out with the key %s of the storage account %s, the key %s is regenerated once the rollout completes", active, d.Config.AccountName, pending))
+			return nil
+		}
+		if err := d.regenerateAccountKey(storageAccountsClient, cfg.ResourceGroup, pending); err != nil {
+			util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionFalse, "RotationFailed", err.Error())
+			return err
+		}
+		klog.Infof("the key %s of the storage account %s has been regenerated", pending, d.Config.AccountName)
+		delete(cr.Annotations, defaults.AzureAccountKeyPendingAnnotation)
+		delete(cr.Annotations, defaults.AzureAccountKeyRolloutAnnotation)
+	}
+
+	if interval == 0 {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, keyRotationCondition)
+		return nil
+	}
+
+	next := rotated.Add(interval)
+	if !rotated.IsZero() && now.Before(next) {
+		util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The registry uses the key %s of the storage account %s, the next rotation is due at %s", active, d.Config.AccountName, next.UTC().Format(time.RFC3339)))
+		return nil
+	}
+	// switching the key rolls out the registry.
+	if !d.disruptionAllowed("Azure storage account key rotation") {
+		util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionTrue, "WaitingForMaintenanceWindow",
+			fmt.Sprintf("The registry uses the key %s of the storage account %s, the rotation is due and waits for the maintenance window", active, d.Config.AccountName))
+		return nil
+	}
+
+	deploys, err := d.registryDeployments()
+	if err != nil {
+		return err
+	}
+	generations := map[string]int64{}
+	for _, deploy := range deploys {
+		generations[deploy.Name] = deploy.Generation
+	}
+	rollout, err := json.Marshal(generations)
+	if err != nil {
+		return err
+	}
+
+	replacement := otherKeyName(active)
+	if err := d.regenerateAccountKey(storageAccountsClient, cfg.ResourceGroup, replacement); err != nil {
+		util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionFalse, "RotationFailed", err.Error())
+		return err
+	}
+	klog.Infof("the registry is switched to the regenerated key %s of the storage account %s", replacement, d.Config.AccountName)
+
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	cr.Annotations[defaults.AzureAccountKeyAnnotation] = replacement
+	cr.Annotations[defaults.AzureAccountKeyRotatedAnnotation] = now.UTC().Format(time.RFC3339)
+	cr.Annotations[defaults.AzureAccountKeyPendingAnnotation] = active
+	cr.Annotations[defaults.AzureAccountKeyRolloutAnnotation] = string(rollout)
+	d.accountKeyName = replacement
+
+	util.UpdateCondition(cr, keyRotationCondition, operatorapiv1.ConditionTrue, "Rotating",
+		fmt.Sprintf("The registry is being rolled out with the key %s of the storage account %s, the key %s is regenerated once the rollout completes", replacement, d.Config.AccountName, active))
+	return nil
+}
@@ -0,0 +1,313 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+// registryDeployment returns a registry deployment whose generation is
+// rolled out.
+func registryDeployment(generation int64) *appsv1.Deployment {
+	return namedRegistryDeployment(defaults.ImageRegistryName, generation)
+}
+
+// namedRegistryDeployment returns the deployment name, whose pods read the
+// registry private configuration, with its generation rolled out.
+func namedRegistryDeployment(name string, generation int64) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  defaults.ImageRegistryOperatorNamespace,
+			Generation: generation,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "registry",
+						Env: []corev1.EnvVar{{
+							Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY",
+							ValueFrom: &corev1.EnvVarSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{Name: defaults.ImageRegistryPrivateConfiguration},
+									Key:                  "REGISTRY_STORAGE_AZURE_ACCOUNTKEY",
+								},
+							},
+						}},
+					}},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: generation,
+			Replicas:           2,
+			UpdatedReplicas:    2,
+			AvailableReplicas:  2,
+		},
+	}
+}
+
+func TestSyncKeyRotation(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	rotated := now.Add(-24 * time.Hour).Format(time.RFC3339)
+
+	for _, tt := range []struct {
+		name                string
+		overrides           string
+		annotations         map[string]string
+		deployment          *appsv1.Deployment
+		others              []*appsv1.Deployment
+		maintenanceClosed   bool
+		regenerated         []string
+		expectedKey         string
+		expectedPending     string
+		expectedRotated     string
+		expectedRollout     string
+		reason              string
+		expectNoCondition   bool
+		expectNoAnnotations bool
+	}{
+		{
+			name:                "rotation disabled",
+			expectedKey:         accountKey1,
+			expectNoCondition:   true,
+			expectNoAnnotations: true,
+		},
+		{
+			name:            "first rotation",
+			overrides:       `{"storage":{"azure":{"keyRotationInterval":"720h"}}}`,
+			deployment:      registryDeployment(2),
+			regenerated:     []string{accountKey2},
+			expectedKey:     accountKey2,
+			expectedPending: accountKey1,
+			expectedRotated: now.Format(time.RFC3339),
+			expectedRollout: `{"image-registry":2}`,
+			reason:          "Rotating",
+		},
+		{
+			name:      "not updated since the switch",
+			overrides: `{"storage":{"azure":{"keyRotationInterval":"720h"}}}`,
+			annotations: map[string]string{
+				defaults.AzureAccountKeyAnnotation:        accountKey2,
+				defaults.AzureAccountKeyPendingAnnotation: accountKey1,
+				defaults.AzureAccountKeyRotatedAnnotation: rotated,
+				defaults.AzureAccountKeyRolloutAnnotation: `{"image-registry":2}`,
+			},
+			deployment:      registryDeployment(2),
+			expectedKey:     accountKey2,
+			expectedPending: accountKey1,
+			expectedRotated: rotated,
+			expectedRollout: `{"image-registry":2}`,
+			reason:          "Rotating",
+		},
+		{
+			name:      "waiting for the rollout",
+			overrides: `{"storage":{"azure":{"keyRotationInterval":"720h"}}}`,
+			annotations: map[string]string{
+				defaults.AzureAccountKeyAnnotation:        accountKey2,
+				defaults.AzureAccountKeyPendingAnnotation: accountKey1,
+				defaults.AzureAccountKeyRotatedAnnotation: rotated,
+				defaults.AzureAccountKeyRolloutAnnotation: `{"image-registry":2}`,
+			},
+			deployment: func() *appsv1.Deployment {
+				deploy := registryDeployment(3)
+				deploy.Status.UpdatedReplicas = 1
+				return deploy
+			}(),
+			expectedKey:     accountKey2,
+			expectedPending: accountKey1,
+			expectedRotated: rotated,
+			expectedRollout: `{"image-registry":2}`,
+			reason:          "Rotating",
+		},
+		{
+			name:      "rolled out",
+			overrides: `{"storage":{"azure":{"keyRotationInterval":"720h"}}}`,
+			annotations: map[string]string{
+				defaults.AzureAccountKeyAnnotation:        accountKey2,
+				defaults.AzureAccountKeyPendingAnnotation: accountKey1,
+				defaults.AzureAccountKeyRotatedAnnotation: rotated,
+				defaults.AzureAccountKeyRolloutAnnotation: `{"image-registry":2}`,
+			},
+			deployment:      registryDeployment(3),
+			regenerated:     []string{accountKey1},
+			expectedKey:     accountKey2,
+			expectedRotated: rotated,
+			reason:          "AsExpected",
+		},
+		{
+			name:      "waiting for the rollout of a shard",
+			overrides: `{"storage":{"azure":{"keyRotationInterval":"720h"}}}`,
+			annotations: map[string]string{
+				defaults.AzureAccountKeyAnnotation:        accountKey2,
+				defaults.AzureAccountKeyPendingAnnotation: accountKey1,
+				defaults.AzureAccountKeyRotatedAnnotation: rotated,
+				defaults.AzureAccountKeyRolloutAnnotation: `{"image-registry":2,"image-registry-shard-a":4}`,
+			},
+			deployment:      registryDeployment(3),
+			others:          []*appsv1.Deployment{namedRegistryDeployment(defaults.ShardNamePrefix+"a", 4)},
+			expectedKey:     accountKey2,
+			expectedPending: accountKey1,
+			expectedRotated: rotated,
+			expectedRollout: `{"image-registry":2,"image-registry-shard-a":4}`,
+			reason:          "Rotating",
+		},
+		{
+			name:      "rotation due outside the maintenance window",
+			overrides: `{"storage":{"azure":{"keyRotationInterval":"12h"}}}`,
+			annotations: map[string]string{
+				defaults.AzureAccountKeyAnnotation:        accountKey2,
+				defaults.AzureAccountKeyRotatedAnnotation: rotated,
+			},
+			deployment:        registryDeployment(3),
+			maintenanceClosed: true,
+			expectedKey:       accountKey2,
+			expectedRotated:   rotated,
+			reason:            "WaitingForMaintenanceWindow",
+		},
+		{
+			name:      "rotation due",
+			overrides: `{"storage":{"azure":{"keyRotationInterval":"12h"}}}`,
+			annotations: map[string]string{
+				defaults.AzureAccountKeyAnnotation:        accountKey2,
+				defaults.AzureAccountKeyRotatedAnnotation: rotated,
+			},
+			deployment:      registryDeployment(3),
+			regenerated:     []string{accountKey1},
+			expectedKey:     accountKey1,
+			expectedPending: accountKey2,
+			expectedRotated: now.Format(time.RFC3339),
+			expectedRollout: `{"image-registry":3}`,
+			reason:          "Rotating",
+		},
+		{
+			name:      "rotation disabled while pending",
+			overrides: `{}`,
+			annotations: map[string]string{
+				defaults.AzureAccountKeyAnnotation:        accountKey2,
+				defaults.AzureAccountKeyPendingAnnotation: accountKey1,
+				defaults.AzureAccountKeyRotatedAnnotation: rotated,
+				defaults.AzureAccountKeyRolloutAnnotation: `{"image-registry":2}`,
+			},
+			deployment:        registryDeployment(3),
+			regenerated:       []string{accountKey1},
+			expectedKey:       accountKey2,
+			expectedRotated:   rotated,
+			expectNoCondition: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.deployment != nil {
+				if err := indexer.Add(tt.deployment); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, deploy := range tt.others {
+				if err := indexer.Add(deploy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			listers := &regopclient.StorageListers{
+				Deployments: appslisters.NewDeploymentLister(indexer).Deployments(defaults.ImageRegistryOperatorNamespace),
+			}
+
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{"keys":[]}`}}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, listers)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+			if tt.maintenanceClosed {
+				drv.SetDisruptionGate(func(string) bool { return false })
+			}
+
+			cr := &imageregistryv1.Config{}
+			cr.Annotations = tt.annotations
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			cfg := &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncKeyRotation(cr, cfg, environment, now); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var regenerated []string
+			for _, req := range sender.Requests() {
+				if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/regenerateKey") {
+					t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+					continue
+				}
+				var body struct {
+					KeyName string `json:"keyName"`
+				}
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				regenerated = append(regenerated, body.KeyName)
+			}
+			if strings.Join(regenerated, ",") != strings.Join(tt.regenerated, ",") {
+				t.Errorf("got regenerated keys %v, want %v", regenerated, tt.regenerated)
+			}
+
+			if got := drv.activeKey(); got != tt.expectedKey {
+				t.Errorf("got driver key %s, want %s", got, tt.expectedKey)
+			}
+			if tt.expectNoAnnotations {
+				if len(cr.Annotations) != 0 {
+					t.Errorf("got annotations %v, want none", cr.Annotations)
+				}
+			} else {
+				if got := cr.Annotations[defaults.AzureAccountKeyAnnotation]; got != tt.expectedKey {
+					t.Errorf("got key annotation %q, want %q", got, tt.expectedKey)
+				}
+				if got := cr.Annotations[defaults.AzureAccountKeyPendingAnnotation]; got != tt.expectedPending {
+					t.Errorf("got pending annotation %q, want %q", got, tt.expectedPending)
+				}
+				if got := cr.Annotations[defaults.AzureAccountKeyRotatedAnnotation]; got != tt.expectedRotated {
+					t.Errorf("got rotated annotation %q, want %q", got, tt.expectedRotated)
+				}
+				if got := cr.Annotations[defaults.AzureAccountKeyRolloutAnnotation]; got != tt.expectedRollout {
+					t.Errorf("got rollout annotation %q, want %q", got, tt.expectedRollout)
+				}
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, keyRotationCondition)
+			if tt.expectNoCondition {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want reason %s", cond, tt.reason)
+			}
+		})
+	}
+}
+
+func TestKeyRotationInterval(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"storage":{"azure":{"keyRotationInterval":"-1h"}}}`)
+	if _, err := keyRotationInterval(cr); err == nil {
+		t.Errorf("expected an error for a negative interval")
+	}
+}
@@ -0,0 +1,333 @@
+package azure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// networkAccessCondition reports whether the firewall of the storage account
+// only accepts requests from the networks set by the user.
+const networkAccessCondition = "AzureStorageNetworkAccess"
+
+// serviceCodeAuthorizationFailure is returned by the blob service for
+// requests denied by the network rules of the storage account.
+const serviceCodeAuthorizationFailure azblob.ServiceCodeType = "AuthorizationFailure"
+
+// networkAccessVerificationAttempts and networkAccessVerificationInterval
+// set how the operator verifies it still reaches the storage account once
+// its network rules are updated.
+var (
+	networkAccessVerificationAttempts = 3
+	networkAccessVerificationInterval = 10 * time.Second
+)
+
+// NetworkAccess restricts the networks the storage account accepts requests
+// from. The networks the registry and the operator run in have to be part of
+// the rules, the egress IPs assigned to the registry are added to them. The
+// rules are reverted if the operator is denied access once they are applied.
+type NetworkAccess struct {
+	// IPRules are the public IPv4 addresses or ranges, in CIDR notation,
+	// allowed to reach the storage account.
+	IPRules []string `json:"ipRules,omitempty"`
+	// VirtualNetworkRules are the resource IDs of the subnets allowed to
+	// reach the storage account. The subnets need the Microsoft.Storage
+	// service endpoint.
+	VirtualNetworkRules []string `json:"virtualNetworkRules,omitempty"`
+}
+
+// getNetworkAccess returns the network access set in the
+// storage.azure.networkAccess section of the unsupported config overrides,
+// or nil if there is none. The egress IPs of the registry are added to the
+// IP rules.
+func getNetworkAccess(cr *imageregistryv1.Config) (*NetworkAccess, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		Storage *struct {
+			Azure *Overrides `json:"azure,omitempty"`
+		} `json:"storage,omitempty"`
+		Egress *struct {
+			IPs []string `json:"ips"`
+		} `json:"egress,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	if overrides.Storage == nil || overrides.Storage.Azure == nil || overrides.Storage.Azure.NetworkAccess == nil {
+		return nil, nil
+	}
+
+	na := &NetworkAccess{}
+	seen := map[string]bool{}
+	ipRules := overrides.Storage.Azure.NetworkAccess.IPRules
+	if overrides.Egress != nil {
+		ipRules = append(ipRules, overrides.Egress.IPs...)
+	}
+	for _, value := range ipRules {
+		// Azure rejects /32 ranges, single addresses are set without a
+		// prefix length.
+		rule := strings.TrimSuffix(value, "/32")
+		if ip := net.ParseIP(rule); ip == nil || ip.To4() == nil {
+			if ip, _, err := net.ParseCIDR(rule); err != nil || ip.To4() == nil {
+				return nil, fmt.Errorf("invalid Azure network access: %q is not an IPv4 address or range", value)
+			}
+		}
+		if !seen[rule] {
+			seen[rule] = true
+			na.IPRules = append(na.IPRules, rule)
+		}
+	}
+	for _, rule := range overrides.Storage.Azure.NetworkAccess.VirtualNetworkRules {
+		parts := strings.Split(strings.Trim(rule, "/"), "/")
+		if len(parts) != 10 || !strings.EqualFold(parts[5], "Microsoft.Network") || !strings.EqualFold(parts[6], "virtualNetworks") || !strings.EqualFold(parts[8], "subnets") {
+			return nil, fmt.Errorf("invalid Azure network access: %q is not the resource ID of a subnet", rule)
+		}
+		na.VirtualNetworkRules = append(na.VirtualNetworkRules, rule)
+	}
+	if len(na.IPRules) == 0 && len(na.VirtualNetworkRules) == 0 {
+		return nil, fmt.Errorf("invalid Azure network access: at least one IP or virtual network rule must be set, the registry would be denied access to the storage account otherwise")
+	}
+	sort.Strings(na.IPRules)
+	return na, nil
+}
+
+// networkRuleSetDrift returns the differences between the network rules of
+// the storage account and the expected ones.
+func networkRuleSetDrift(rules *storage.NetworkRuleSet, na *NetworkAccess) []string {
+	if rules == nil {
+		rules = &storage.NetworkRuleSet{}
+	}
+
+	var drift []string
+	if rules.DefaultAction != storage.DefaultActionDeny {
+		drift = append(drift, "requests from other networks are allowed")
+	}
+
+	current := map[string]bool{}
+	if rules.IPRules != nil {
+		for _, rule := range *rules.IPRules {
+			if rule.IPAddressOrRange != nil {
+				current[strings.TrimSuffix(*rule.IPAddressOrRange, "/32")] = true
+			}
+		}
+	}
+	for _, rule := range na.IPRules {
+		if !current[rule] {
+			drift = append(drift, fmt.Sprintf("%s is not allowed", rule))
+		}
+		delete(current, rule)
+	}
+	for rule := range current {
+		drift = append(drift, fmt.Sprintf("%s is allowed", rule))
+	}
+
+	current = map[string]bool{}
+	if rules.VirtualNetworkRules != nil {
+		for _, rule := range *rules.VirtualNetworkRules {
+			if rule.VirtualNetworkResourceID != nil {
+				current[strings.ToLower(strings.Trim(*rule.VirtualNetworkResourceID, "/"))] = true
+			}
+		}
+	}
+	for _, rule := range na.VirtualNetworkRules {
+		id := strings.ToLower(strings.Trim(rule, "/"))
+		if !current[id] {
+			drift = append(drift, fmt.Sprintf("the subnet %s is not allowed", rule))
+		}
+		delete(current, id)
+	}
+	for id := range current {
+		drift = append(drift, fmt.Sprintf("the subnet /%s is allowed", id))
+	}
+
+	sort.Strings(drift)
+	return drift
+}
+
+// expectedNetworkRuleSet returns the network rules of the storage account
+// for na. The traffic bypassing the rules is kept as it is.
+func expectedNetworkRuleSet(rules *storage.NetworkRuleSet, na *NetworkAccess) *storage.NetworkRuleSet {
+	bypass := storage.AzureServices
+	if rules != nil && rules.Bypass != "" {
+		bypass = rules.Bypass
+	}
+
+	ipRules := []storage.IPRule{}
+	for _, rule := range na.IPRules {
+		ipRules = append(ipRules, storage.IPRule{
+			IPAddressOrRange: to.StringPtr(rule),
+			Action:           storage.Allow,
+		})
+	}
+	virtualNetworkRules := []storage.VirtualNetworkRule{}
+	for _, rule := range na.VirtualNetworkRules {
+		virtualNetworkRules = append(virtualNetworkRules, storage.VirtualNetworkRule{
+			VirtualNetworkResourceID: to.StringPtr(rule),
+			Action:                   storage.Allow,
+		})
+	}
+	return &storage.NetworkRuleSet{
+		Bypass:              bypass,
+		IPRules:             &ipRules,
+		VirtualNetworkRules: &virtualNetworkRules,
+		DefaultAction:       storage.DefaultActionDeny,
+	}
+}
+
+// networkAccessChecksum identifies the network rules na, so the ones that
+// denied access to the operator are not applied again.
+func networkAccessChecksum(na *NetworkAccess) string {
+	h := sha256.New()
+	for _, rule := range na.IPRules {
+		fmt.Fprintf(h, "ip:%s\n", rule)
+	}
+	for _, rule := range na.VirtualNetworkRules {
+		fmt.Fprintf(h, "subnet:%s\n", strings.ToLower(strings.Trim(rule, "/")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// operatorDenied returns true if the network rules of the storage account
+// keep the operator from reaching its container. The rules take a few
+// seconds to be enforced, the container is checked until
+// networkAccessVerificationAttempts attempts succeed.
+func (d *driver) operatorDenied(environment autorestazure.Environment, cred azblob.Credential) (bool, error) {
+	for i := 0; i < networkAccessVerificationAttempts; i++ {
+		if i > 0 {
+			time.Sleep(networkAccessVerificationInterval)
+		}
+		_, err := d.containerExists(d.Context, environment, d.Config.AccountName, cred, d.Config.Container)
+		var serr azblob.StorageError
+		if errors.As(err, &serr) && serr.ServiceCode() == serviceCodeAuthorizationFailure {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// syncNetworkAccess restricts the networks the storage account accepts
+// requests from to the ones set in the unsupported config overrides, and
+// puts the rules back when they drift. The rules of accounts not managed by
+// the operator are only compared. The rules are left in place when the
+// setting is removed, the firewall is not opened behind the user's back.
+// Rules denying access to the operator itself are reverted and not applied
+// again until they change, the operator would not be able to manage the
+// storage otherwise.
+func (d *driver) syncNetworkAccess(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment, cred azblob.Credential) error {
+	na, err := getNetworkAccess(cr)
+	if err != nil {
+		util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionFalse, "InvalidConfiguration", err.Error())
+		return err
+	}
+	if na == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, networkAccessCondition)
+		return nil
+	}
+	if strings.EqualFold(d.Config.CloudName, "AZURESTACKCLOUD") {
+		util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionFalse, "NotSupported",
+			"The network rules of storage accounts are not supported on Azure Stack Hub")
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	account, err := storageAccountsClient.GetProperties(d.Context, cfg.ResourceGroup, d.Config.AccountName, "")
+	if err != nil {
+		return fmt.Errorf("unable to get the properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+	var rules *storage.NetworkRuleSet
+	if account.AccountProperties != nil {
+		rules = account.AccountProperties.NetworkRuleSet
+	}
+
+	drift := networkRuleSetDrift(rules, na)
+	if len(drift) == 0 {
+		util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The storage account %s only accepts requests from the configured networks", d.Config.AccountName))
+		return nil
+	}
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionFalse, "NotManaged",
+			fmt.Sprintf("The network rules of the storage account %s, not managed by the operator, differ from the configured ones: %s", d.Config.AccountName, strings.Join(drift, ", ")))
+		return nil
+	}
+
+	dgst := networkAccessChecksum(na)
+	if cr.Annotations[defaults.AzureNetworkAccessDeniedAnnotation] == dgst {
+		util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionFalse, "OperatorDenied",
+			fmt.Sprintf("The configured network rules are not applied to the storage account %s, they deny access to the operator. Add the networks the operator runs in to them", d.Config.AccountName))
+		return nil
+	}
+
+	_, err = storageAccountsClient.Update(d.Context, cfg.ResourceGroup, d.Config.AccountName, storage.AccountUpdateParameters{
+		AccountPropertiesUpdateParameters: &storage.AccountPropertiesUpdateParameters{
+			NetworkRuleSet: expectedNetworkRuleSet(rules, na),
+		},
+	})
+	if err != nil {
+		util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionFalse, "UpdateFailed",
+			fmt.Sprintf("Unable to update the network rules of the storage account %s: %s", d.Config.AccountName, err))
+		return err
+	}
+	klog.Infof("the network rules of the storage account %s have been updated: %s", d.Config.AccountName, strings.Join(drift, ", "))
+
+	denied, err := d.operatorDenied(environment, cred)
+	if err != nil {
+		klog.Warningf("unable to verify the access to the storage account %s after updating its network rules: %s", d.Config.AccountName, err)
+	}
+	if denied {
+		previous := rules
+		if previous == nil {
+			previous = &storage.NetworkRuleSet{Bypass: storage.AzureServices, DefaultAction: storage.DefaultActionAllow}
+		}
+		_, err = storageAccountsClient.Update(d.Context, cfg.ResourceGroup, d.Config.AccountName, storage.AccountUpdateParameters{
+			AccountPropertiesUpdateParameters: &storage.AccountPropertiesUpdateParameters{
+				NetworkRuleSet: previous,
+			},
+		})
+		if err != nil {
+			util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionFalse, "UpdateFailed",
+				fmt.Sprintf("The network rules of the storage account %s deny access to the operator and could not be reverted: %s", d.Config.AccountName, err))
+			return err
+		}
+		klog.Warningf("the network rules of the storage account %s have been reverted, they deny access to the operator", d.Config.AccountName)
+		if cr.Annotations == nil {
+			cr.Annotations = map[string]string{}
+		}
+		cr.Annotations[defaults.AzureNetworkAccessDeniedAnnotation] = dgst
+		util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionFalse, "OperatorDenied",
+			fmt.Sprintf("The configured network rules are not applied to the storage account %s, they deny access to the operator. Add the networks the operator runs in to them", d.Config.AccountName))
+		return fmt.Errorf("the network rules of the storage account %s deny access to the operator", d.Config.AccountName)
+	}
+	delete(cr.Annotations, defaults.AzureNetworkAccessDeniedAnnotation)
+	util.UpdateCondition(cr, networkAccessCondition, operatorapiv1.ConditionTrue, "DriftCorrected",
+		fmt.Sprintf("The storage account %s only accepts requests from the configured networks, the rules had to be updated: %s", d.Config.AccountName, strings.Join(drift, ", ")))
+	return nil
+}
@@ -0,0 +1,263 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/mocks"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+const testSubnet = "/subscriptions/subscription_id/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/worker"
+
+func TestGetNetworkAccess(t *testing.T) {
+	for _, tt := range []struct {
+		overrides string
+		expected  *NetworkAccess
+		err       string
+	}{
+		{
+			overrides: `{"storage":{"azure":{"syncTags":true}}}`,
+		},
+		{
+			overrides: `{"storage":{"azure":{"networkAccess":{"ipRules":["203.0.113.0/24","198.51.100.7/32"],"virtualNetworkRules":["` + testSubnet + `"]}}},"egress":{"ips":["198.51.100.7","198.51.100.8"]}}`,
+			expected: &NetworkAccess{
+				IPRules:             []string{"198.51.100.7", "198.51.100.8", "203.0.113.0/24"},
+				VirtualNetworkRules: []string{testSubnet},
+			},
+		},
+		{
+			overrides: `{"storage":{"azure":{"networkAccess":{"ipRules":["2001:db8::/32"]}}}}`,
+			err:       `"2001:db8::/32" is not an IPv4 address or range`,
+		},
+		{
+			overrides: `{"storage":{"azure":{"networkAccess":{"virtualNetworkRules":["/subscriptions/subscription_id/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet"]}}}}`,
+			err:       "is not the resource ID of a subnet",
+		},
+		{
+			overrides: `{"storage":{"azure":{"networkAccess":{}}}}`,
+			err:       "at least one IP or virtual network rule must be set",
+		},
+	} {
+		cr := &imageregistryv1.Config{}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+		na, err := getNetworkAccess(cr)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.overrides, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.overrides, err)
+		} else if !reflect.DeepEqual(na, tt.expected) {
+			t.Errorf("%s: got %#v, want %#v", tt.overrides, na, tt.expected)
+		}
+	}
+}
+
+func TestSyncNetworkAccess(t *testing.T) {
+	const networkAccess = `{"storage":{"azure":{"networkAccess":{"ipRules":["203.0.113.0/24"],"virtualNetworkRules":["` + testSubnet + `"]}}}}`
+
+	defer func(attempts int, interval time.Duration) {
+		networkAccessVerificationAttempts = attempts
+		networkAccessVerificationInterval = interval
+	}(networkAccessVerificationAttempts, networkAccessVerificationInterval)
+	networkAccessVerificationAttempts = 2
+	networkAccessVerificationInterval = 0
+
+	deniedChecksum := networkAccessChecksum(&NetworkAccess{IPRules: []string{"203.0.113.0/24"}, VirtualNetworkRules: []string{testSubnet}})
+
+	for _, tt := range []struct {
+		name           string
+		overrides      string
+		state          string
+		rules          string
+		denied         string
+		operatorDenied bool
+		expectedStatus operatorapiv1.ConditionStatus
+		expectedReason string
+		expectedCalls  int
+		expectedDenied string
+		err            bool
+	}{
+		{
+			name:  "not requested",
+			state: imageregistryv1.StorageManagementStateManaged,
+		},
+		{
+			name:           "in sync",
+			overrides:      networkAccess,
+			state:          imageregistryv1.StorageManagementStateManaged,
+			rules:          `{"bypass":"AzureServices","defaultAction":"Deny","ipRules":[{"value":"203.0.113.0/24","action":"Allow"}],"virtualNetworkRules":[{"id":"` + strings.ToLower(testSubnet) + `","action":"Allow"}]}`,
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: "AsExpected",
+			expectedCalls:  1,
+		},
+		{
+			name:           "open firewall",
+			overrides:      networkAccess,
+			state:          imageregistryv1.StorageManagementStateManaged,
+			rules:          `{"bypass":"Logging, Metrics","defaultAction":"Allow"}`,
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: "DriftCorrected",
+			expectedCalls:  2,
+		},
+		{
+			name:           "operator denied",
+			overrides:      networkAccess,
+			state:          imageregistryv1.StorageManagementStateManaged,
+			rules:          `{"bypass":"Logging, Metrics","defaultAction":"Allow"}`,
+			operatorDenied: true,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "OperatorDenied",
+			expectedCalls:  3,
+			expectedDenied: deniedChecksum,
+			err:            true,
+		},
+		{
+			name:           "denied the operator before",
+			overrides:      networkAccess,
+			state:          imageregistryv1.StorageManagementStateManaged,
+			rules:          `{"bypass":"Logging, Metrics","defaultAction":"Allow"}`,
+			denied:         deniedChecksum,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "OperatorDenied",
+			expectedCalls:  1,
+			expectedDenied: deniedChecksum,
+		},
+		{
+			name:           "changed after denying the operator",
+			overrides:      networkAccess,
+			state:          imageregistryv1.StorageManagementStateManaged,
+			rules:          `{"bypass":"Logging, Metrics","defaultAction":"Allow"}`,
+			denied:         "other",
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: "DriftCorrected",
+			expectedCalls:  2,
+		},
+		{
+			name:           "unmanaged account",
+			overrides:      networkAccess,
+			state:          imageregistryv1.StorageManagementStateUnmanaged,
+			rules:          `{"defaultAction":"Deny","ipRules":[{"value":"192.0.2.1","action":"Allow"}]}`,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "NotManaged",
+			expectedCalls:  1,
+		},
+		{
+			name:           "invalid rules",
+			overrides:      `{"storage":{"azure":{"networkAccess":{"ipRules":["10.0.0.0/33"]}}}}`,
+			state:          imageregistryv1.StorageManagementStateManaged,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "InvalidConfiguration",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+			rules := tt.rules
+			if rules == "" {
+				rules = `{}`
+			}
+			sender.AddJSONResponse(http.StatusOK, `{"properties":{"networkAcls":`+rules+`}}`)
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.state
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			if tt.denied != "" {
+				cr.Annotations = map[string]string{defaults.AzureNetworkAccessDeniedAnnotation: tt.denied}
+			}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account", Container: "container"}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+			containerChecks := 0
+			drv.httpSender = pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+				return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+					containerChecks++
+					if tt.operatorDenied {
+						r := mocks.NewResponseWithStatus("", http.StatusForbidden)
+						r.Header = http.Header{"X-Ms-Error-Code": {"AuthorizationFailure"}}
+						return pipeline.NewHTTPResponse(r), nil
+					}
+					return pipeline.NewHTTPResponse(mocks.NewResponseWithContent(`{}`)), nil
+				}
+			})
+
+			environment, _ := getEnvironmentByName("")
+			cred := azblob.NewAnonymousCredential()
+			err := drv.syncNetworkAccess(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment, cred)
+			if tt.expectedReason == "InvalidConfiguration" || tt.err {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if denied := cr.Annotations[defaults.AzureNetworkAccessDeniedAnnotation]; denied != tt.expectedDenied {
+				t.Errorf("got denied rules %q, want %q", denied, tt.expectedDenied)
+			}
+			if tt.expectedReason == "DriftCorrected" && containerChecks != networkAccessVerificationAttempts {
+				t.Errorf("got %d container checks, want %d", containerChecks, networkAccessVerificationAttempts)
+			}
+
+			reqs := sender.Requests()
+			if len(reqs) != tt.expectedCalls {
+				t.Fatalf("got %d requests, want %d", len(reqs), tt.expectedCalls)
+			}
+			if tt.expectedReason == "DriftCorrected" {
+				req := reqs[1]
+				if req.Method != http.MethodPatch {
+					t.Fatalf("got method %s, want %s", req.Method, http.MethodPatch)
+				}
+				var body struct {
+					Properties struct {
+						NetworkAcls struct {
+							Bypass              string                   `json:"bypass"`
+							DefaultAction       string                   `json:"defaultAction"`
+							IPRules             []struct{ Value string } `json:"ipRules"`
+							VirtualNetworkRules []struct{ ID string }    `json:"virtualNetworkRules"`
+						} `json:"networkAcls"`
+					} `json:"properties"`
+				}
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				acls := body.Properties.NetworkAcls
+				if acls.DefaultAction != "Deny" || acls.Bypass != "Logging, Metrics" ||
+					len(acls.IPRules) != 1 || acls.IPRules[0].Value != "203.0.113.0/24" ||
+					len(acls.VirtualNetworkRules) != 1 || acls.VirtualNetworkRules[0].ID != testSubnet {
+					t.Errorf("got network rules %s", req.Body)
+				}
+			}
+
+			if tt.operatorDenied {
+				revert := reqs[2]
+				if revert.Method != http.MethodPatch || !strings.Contains(string(revert.Body), `"defaultAction":"Allow"`) {
+					t.Errorf("got %s request %s, want the network rules reverted", revert.Method, revert.Body)
+				}
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, networkAccessCondition)
+			if tt.expectedStatus == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.expectedStatus, tt.expectedReason)
+			}
+		})
+	}
+}
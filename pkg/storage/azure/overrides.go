@@ -0,0 +1,94 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+// Overrides holds the Azure specific storage settings, i.e. the
+// storage.azure section of the unsupported config overrides.
+type Overrides struct {
+	// UseSecondaryEndpoint switches the registry to the secondary blob
+	// endpoint of a read access geo redundant storage account, e.g.
+	// during an outage of the primary region. The secondary endpoint is
+	// read-only, so is the registry while it is in use. The endpoint is
+	// reported by the AzureStorageGeoRedundancy condition.
+	UseSecondaryEndpoint bool `json:"useSecondaryEndpoint,omitempty"`
+	// PrivateEndpoint references an existing private endpoint of the
+	// storage account, managed outside of the operator. The operator
+	// verifies the registry reaches the account through it and reports
+	// the result with the AzurePrivateEndpoint condition.
+	PrivateEndpoint *PrivateEndpoint `json:"privateEndpoint,omitempty"`
+	// Encryption encrypts the storage account provisioned by the operator
+	// with a customer-managed key. The key of an existing account managed
+	// by the operator is updated, e.g. when its version is rotated. The
+	// key in use is reported by the AzureStorageEncryption condition.
+	Encryption *Encryption `json:"encryption,omitempty"`
+	// SKU is the SKU of the storage account provisioned by the operator,
+	// e.g. Standard_ZRS, Standard_GZRS or Premium_LRS, defaults to
+	// Standard_LRS. Premium SKUs create BlockBlobStorage accounts. It is
+	// validated against the SKUs available in the region when the
+	// account is created, existing accounts keep their SKU.
+	SKU string `json:"sku,omitempty"`
+	// SyncTags keeps the tags of the cluster, i.e. the ownership tag and
+	// the resource tags of the infrastructure, set on the storage account
+	// managed by the operator. Tags are only set when the account is
+	// created otherwise. Other tags of the account are kept. The state is
+	// reported by the AzureStorageTags condition.
+	SyncTags bool `json:"syncTags,omitempty"`
+	// NetworkAccess restricts the networks the storage account accepts
+	// requests from to the given IP ranges and subnets. The rules of the
+	// account managed by the operator are put back when they drift, they
+	// are left in place when the setting is removed. The egress IPs of the
+	// registry are allowed as well. The state is reported by the
+	// AzureStorageNetworkAccess condition.
+	NetworkAccess *NetworkAccess `json:"networkAccess,omitempty"`
+	// Retry sets how the requests of the operator to Azure Resource
+	// Manager are retried when they fail with a transient error, e.g.
+	// throttling. They are retried 3 times with an exponential backoff by
+	// default. Throttled requests are reported with the Throttled reason
+	// of the StorageExists condition.
+	Retry *RetryOptions `json:"retry,omitempty"`
+	// SoftDelete keeps the deleted blobs and containers of the storage
+	// account managed by the operator for a number of days. The state is
+	// reported by the AzureBlobSoftDelete condition.
+	SoftDelete *SoftDelete `json:"softDelete,omitempty"`
+	// DisableSharedKeyAccess disables the requests authorized with the
+	// account keys on the storage account, the operator and the registry
+	// then authenticate to the blob service with Microsoft Entra ID.
+	// Shared key access is not enabled again once the setting is
+	// removed. The state is reported by the AzureSharedKeyAccess
+	// condition.
+	DisableSharedKeyAccess bool `json:"disableSharedKeyAccess,omitempty"`
+	// KeyRotationInterval is how often the keys of the storage account
+	// managed by the operator are rotated. The keys are not rotated if it
+	// is unset. The rotation is reported by the AzureAccountKeyRotation
+	// condition.
+	KeyRotationInterval *metav1.Duration `json:"keyRotationInterval,omitempty"`
+}
+
+// getOverrides returns the storage.azure section of the unsupported config
+// overrides, or nil if there is none.
+func getOverrides(cr *imageregistryv1.Config) (*Overrides, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		Storage *struct {
+			Azure *Overrides `json:"azure,omitempty"`
+		} `json:"storage,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	if overrides.Storage == nil {
+		return nil, nil
+	}
+	return overrides.Storage.Azure, nil
+}
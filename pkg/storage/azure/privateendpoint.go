@@ -0,0 +1,217 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/featuregates"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// privateEndpointCondition reports whether the registry reaches the storage
+// account through the private endpoint provided by the user.
+const privateEndpointCondition = "AzurePrivateEndpoint"
+
+// azureDNSAddress is the virtual IP of the Azure provided DNS, it is the only
+// resolver that serves the privatelink zones linked to a virtual network.
+const azureDNSAddress = "168.63.129.16"
+
+// lookupIPAddr resolves hostnames, it is a variable so tests can fake DNS.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// PrivateEndpoint references a private endpoint of the storage account that
+// is managed outside of the operator, e.g. by a networking team. The
+// operator does not create nor delete it, it only verifies the registry
+// reaches the storage account through it.
+type PrivateEndpoint struct {
+	// ID is the resource ID of the private endpoint.
+	ID string `json:"id,omitempty"`
+	// Name is the name of the private endpoint, it can be used instead of
+	// ID when the name is unique among the private endpoints connected to
+	// the storage account.
+	Name string `json:"name,omitempty"`
+}
+
+// GetPrivateEndpoint returns the private endpoint set in the
+// storage.azure.privateEndpoint section of the unsupported config overrides,
+// or nil if there is none.
+func GetPrivateEndpoint(cr *imageregistryv1.Config) (*PrivateEndpoint, error) {
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides == nil || overrides.PrivateEndpoint == nil {
+		return nil, nil
+	}
+
+	pe := overrides.PrivateEndpoint
+	if pe.ID == "" && pe.Name == "" {
+		return nil, fmt.Errorf("invalid Azure private endpoint: either id or name must be set")
+	}
+	if pe.ID != "" {
+		parts := strings.Split(strings.Trim(pe.ID, "/"), "/")
+		if len(parts) != 8 || !strings.EqualFold(parts[5], "Microsoft.Network") || !strings.EqualFold(parts[6], "privateEndpoints") {
+			return nil, fmt.Errorf("invalid Azure private endpoint: %q is not the resource ID of a private endpoint", pe.ID)
+		}
+	}
+	return pe, nil
+}
+
+// matches returns true if id is the resource ID of the private endpoint.
+func (pe *PrivateEndpoint) matches(id string) bool {
+	if pe.ID != "" {
+		return strings.EqualFold(strings.Trim(pe.ID, "/"), strings.Trim(id, "/"))
+	}
+	return strings.HasSuffix(strings.ToLower(id), "/privateendpoints/"+strings.ToLower(pe.Name))
+}
+
+func (pe *PrivateEndpoint) String() string {
+	if pe.ID != "" {
+		return pe.ID
+	}
+	return pe.Name
+}
+
+// resolvesPrivately returns true if every address of host is a private one,
+// i.e. the DNS records of the storage account point to a private endpoint.
+func resolvesPrivately(ctx context.Context, host string) (bool, []string, error) {
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return false, nil, err
+	}
+	var ips []string
+	private := len(addrs) > 0
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+		if !addr.IP.IsPrivate() {
+			private = false
+		}
+	}
+	return private, ips, nil
+}
+
+// syncPrivateEndpoint verifies the private endpoint provided by the user is
+// connected to the storage account and that the blob endpoint of the account
+// resolves to it.
+func (d *driver) syncPrivateEndpoint(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	pe, err := GetPrivateEndpoint(cr)
+	if err != nil {
+		util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionFalse, "InvalidPrivateEndpoint", err.Error())
+		return err
+	}
+	if pe == nil {
+		return nil
+	}
+
+	var featureGates configlisters.FeatureGateLister
+	if d.Listers != nil {
+		featureGates = d.Listers.FeatureGates
+	}
+	gates, err := featuregates.Get(featureGates, cr)
+	if err != nil {
+		return err
+	}
+	if !gates.Enabled(featuregates.AzurePrivateEndpoint) {
+		util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionFalse, "FeatureGateDisabled",
+			fmt.Sprintf("The private endpoint is not verified as the %s feature gate is disabled", featuregates.AzurePrivateEndpoint))
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	client := storage.NewPrivateEndpointConnectionsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	client.Client = storageAccountsClient.Client
+
+	connections, err := client.List(d.Context, cfg.ResourceGroup, d.Config.AccountName)
+	if err != nil {
+		util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return fmt.Errorf("unable to list the private endpoint connections of the storage account %s: %w", d.Config.AccountName, err)
+	}
+
+	var connection *storage.PrivateEndpointConnection
+	if connections.Value != nil {
+		for i, c := range *connections.Value {
+			if c.PrivateEndpointConnectionProperties == nil || c.PrivateEndpoint == nil || c.PrivateEndpoint.ID == nil {
+				continue
+			}
+			if pe.matches(*c.PrivateEndpoint.ID) {
+				connection = &(*connections.Value)[i]
+				break
+			}
+		}
+	}
+	if connection == nil {
+		util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionFalse, "NotConnected",
+			fmt.Sprintf("The private endpoint %s is not connected to the storage account %s", pe, d.Config.AccountName))
+		return nil
+	}
+	if state := connection.PrivateLinkServiceConnectionState; state == nil || state.Status != storage.Approved {
+		status := "unknown"
+		if state != nil {
+			status = string(state.Status)
+		}
+		util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionFalse, "NotApproved",
+			fmt.Sprintf("The connection of the private endpoint %s to the storage account %s is %s", pe, d.Config.AccountName, status))
+		return nil
+	}
+
+	u, err := getBlobServiceURL(environment, d.Config.AccountName)
+	if err != nil {
+		return err
+	}
+	private, ips, err := resolvesPrivately(d.Context, u.Hostname())
+	if err != nil {
+		util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionFalse, "NotResolved",
+			fmt.Sprintf("Unable to resolve %s: %s", u.Hostname(), err))
+		return nil
+	}
+	if !private {
+		reason, message := d.diagnosePublicResolution(environment, u.Hostname(), ips, pe)
+		util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionFalse, reason, message)
+		return nil
+	}
+
+	util.UpdateCondition(cr, privateEndpointCondition, operatorapiv1.ConditionTrue, "Connected",
+		fmt.Sprintf("The storage account %s is reached through the private endpoint %s at %s", d.Config.AccountName, pe, strings.Join(ips, ", ")))
+	return nil
+}
+
+// diagnosePublicResolution explains why host, the blob endpoint of the
+// storage account, resolves to the public addresses ips. The public record of
+// the blob endpoint is an alias of its privatelink name, which only resolves
+// to the private endpoint when the query reaches Azure DNS from a virtual
+// network linked to the privatelink zone. If the privatelink name resolves
+// publicly too, the DNS servers used by the cluster never ask Azure DNS,
+// which happens when the virtual network uses custom DNS servers without a
+// conditional forwarder for the privatelink zone.
+func (d *driver) diagnosePublicResolution(environment autorestazure.Environment, host string, ips []string, pe *PrivateEndpoint) (string, string) {
+	zone := "privatelink.blob." + environment.StorageEndpointSuffix
+	privateLinkHost := d.Config.AccountName + "." + zone
+
+	private, privateLinkIPs, err := resolvesPrivately(d.Context, privateLinkHost)
+	if err != nil || private {
+		// the privatelink name is either unknown or correct, the record
+		// of the blob endpoint itself was overridden.
+		return "NotResolvedPrivately", fmt.Sprintf(
+			"%s resolves to %s instead of the private endpoint %s, check the private DNS zone records",
+			host, strings.Join(ips, ", "), pe,
+		)
+	}
+
+	return "MissingDNSForwarder", fmt.Sprintf(
+		"%s resolves to the public address %s instead of the private endpoint %s: the DNS servers used by the cluster do not forward the %s zone to Azure DNS; "+
+			"if the virtual network uses custom DNS servers, add a conditional forwarder for %s to %s on them",
+		privateLinkHost, strings.Join(privateLinkIPs, ", "), pe, zone, zone, azureDNSAddress,
+	)
+}
@@ -0,0 +1,129 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/mocks"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestSyncPrivateEndpoint(t *testing.T) {
+	defer func(lookup func(context.Context, string) ([]net.IPAddr, error)) { lookupIPAddr = lookup }(lookupIPAddr)
+
+	peID := "/subscriptions/sub/resourceGroups/network/providers/Microsoft.Network/privateEndpoints/registry-pe"
+	connection := func(id, status string) string {
+		return fmt.Sprintf(`{"properties":{"privateEndpoint":{"id":%q},"privateLinkServiceConnectionState":{"status":%q}}}`, id, status)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		overrides   string
+		connections string
+		ip          string
+		privateIP   string
+		status      operatorapiv1.ConditionStatus
+		reason      string
+		err         bool
+	}{
+		{
+			name:        "connected by id",
+			overrides:   fmt.Sprintf(`{"storage":{"azure":{"privateEndpoint":{"id":%q}}}}`, peID),
+			connections: connection(peID, "Approved"),
+			ip:          "10.0.1.4",
+			status:      operatorapiv1.ConditionTrue,
+			reason:      "Connected",
+		},
+		{
+			name:        "connected by name",
+			overrides:   `{"storage":{"azure":{"privateEndpoint":{"name":"registry-pe"}}}}`,
+			connections: connection(peID, "Approved"),
+			ip:          "10.0.1.4",
+			status:      operatorapiv1.ConditionTrue,
+			reason:      "Connected",
+		},
+		{
+			name:        "not connected",
+			overrides:   `{"storage":{"azure":{"privateEndpoint":{"name":"other-pe"}}}}`,
+			connections: connection(peID, "Approved"),
+			status:      operatorapiv1.ConditionFalse,
+			reason:      "NotConnected",
+		},
+		{
+			name:        "pending approval",
+			overrides:   `{"storage":{"azure":{"privateEndpoint":{"name":"registry-pe"}}}}`,
+			connections: connection(peID, "Pending"),
+			status:      operatorapiv1.ConditionFalse,
+			reason:      "NotApproved",
+		},
+		{
+			name:        "public DNS record",
+			overrides:   `{"storage":{"azure":{"privateEndpoint":{"name":"registry-pe"}}}}`,
+			connections: connection(peID, "Approved"),
+			ip:          "20.60.1.4",
+			privateIP:   "10.0.1.4",
+			status:      operatorapiv1.ConditionFalse,
+			reason:      "NotResolvedPrivately",
+		},
+		{
+			name:        "custom DNS servers without forwarder",
+			overrides:   `{"storage":{"azure":{"privateEndpoint":{"name":"registry-pe"}}}}`,
+			connections: connection(peID, "Approved"),
+			ip:          "20.60.1.4",
+			privateIP:   "20.60.1.4",
+			status:      operatorapiv1.ConditionFalse,
+			reason:      "MissingDNSForwarder",
+		},
+		{
+			name:      "feature gate disabled",
+			overrides: `{"featureGates":{"ImageRegistryAzurePrivateEndpoint":false},"storage":{"azure":{"privateEndpoint":{"name":"registry-pe"}}}}`,
+			status:    operatorapiv1.ConditionFalse,
+			reason:    "FeatureGateDisabled",
+		},
+		{
+			name:      "invalid id",
+			overrides: `{"storage":{"azure":{"privateEndpoint":{"id":"/subscriptions/sub/resourceGroups/network"}}}}`,
+			status:    operatorapiv1.ConditionFalse,
+			reason:    "InvalidPrivateEndpoint",
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupIPAddr = func(_ context.Context, host string) ([]net.IPAddr, error) {
+				switch host {
+				case "account.blob.core.windows.net":
+					return []net.IPAddr{{IP: net.ParseIP(tt.ip)}}, nil
+				case "account.privatelink.blob.core.windows.net":
+					return []net.IPAddr{{IP: net.ParseIP(tt.privateIP)}}, nil
+				}
+				return nil, fmt.Errorf("unexpected host %s", host)
+			}
+
+			sender := mocks.NewSender()
+			sender.AppendResponse(mocks.NewResponseWithContent(fmt.Sprintf(`{"value":[%s]}`, tt.connections)))
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+			environment, _ := getEnvironmentByName("")
+			err := drv.syncPrivateEndpoint(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error %t", err, tt.err)
+			}
+
+			cond := cr.Status.Conditions[0]
+			if cond.Type != privateEndpointCondition || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.status, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageProtocolsCondition reports whether the storage account only serves
+// blobs over HTTPS, i.e. SFTP and NFSv3 are disabled.
+const storageProtocolsCondition = "AzureStorageProtocols"
+
+// protocolsAPIVersion is the first storage API version knowing both the
+// isSftpEnabled and isNfsV3Enabled properties, the SDK in use predates them.
+const protocolsAPIVersion = "2021-08-01"
+
+// accountProtocols holds the protocol properties of a storage account.
+type accountProtocols struct {
+	Properties struct {
+		IsSftpEnabled  *bool `json:"isSftpEnabled,omitempty"`
+		IsNfsV3Enabled *bool `json:"isNfsV3Enabled,omitempty"`
+	} `json:"properties"`
+}
+
+// withProtocolsDisabled explicitly disables SFTP and NFSv3 in the request
+// creating a storage account. Compliance scanners flag accounts without an
+// explicit setting. NFSv3 can only be set when the account is created.
+func withProtocolsDisabled() autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err != nil {
+				return r, err
+			}
+
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				return r, err
+			}
+			r.Body.Close()
+			props, _ := body["properties"].(map[string]interface{})
+			if props == nil {
+				props = map[string]interface{}{}
+				body["properties"] = props
+			}
+			props["isSftpEnabled"] = false
+			props["isNfsV3Enabled"] = false
+
+			q := r.URL.Query()
+			q.Set("api-version", protocolsAPIVersion)
+			r.URL.RawQuery = q.Encode()
+			return autorest.Prepare(r, autorest.WithJSON(body))
+		})
+	}
+}
+
+// accountRequest returns a request for the storage account, sent with the
+// API version knowing the protocol properties.
+func (d *driver) accountRequest(cli storage.AccountsClient, resourceGroup string, decorators ...autorest.PrepareDecorator) (*http.Request, error) {
+	pathParameters := map[string]interface{}{
+		"accountName":       autorest.Encode("path", d.Config.AccountName),
+		"resourceGroupName": autorest.Encode("path", resourceGroup),
+		"subscriptionId":    autorest.Encode("path", cli.SubscriptionID),
+	}
+	decorators = append([]autorest.PrepareDecorator{
+		autorest.WithBaseURL(cli.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.Storage/storageAccounts/{accountName}", pathParameters),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": protocolsAPIVersion}),
+	}, decorators...)
+	return autorest.Prepare((&http.Request{}).WithContext(d.Context), decorators...)
+}
+
+// getProtocols returns the protocol properties of the storage account.
+func (d *driver) getProtocols(cli storage.AccountsClient, resourceGroup string) (*accountProtocols, error) {
+	req, err := d.accountRequest(cli, resourceGroup, autorest.AsGet())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var account accountProtocols
+	err = autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&account),
+		autorest.ByClosing(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// disableSFTP explicitly disables SFTP on the storage account.
+func (d *driver) disableSFTP(cli storage.AccountsClient, resourceGroup string) error {
+	req, err := d.accountRequest(cli, resourceGroup,
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPatch(),
+		autorest.WithJSON(map[string]interface{}{
+			"properties": map[string]interface{}{
+				"isSftpEnabled": false,
+			},
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return err
+	}
+	return autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByClosing(),
+	)
+}
+
+// syncProtocols detects SFTP and NFSv3 being enabled on the storage account.
+// SFTP is disabled again on accounts managed by the operator, NFSv3 cannot
+// be disabled once the account exists, it is only reported.
+func (d *driver) syncProtocols(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	if strings.EqualFold(d.Config.CloudName, "AZURESTACKCLOUD") {
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	account, err := d.getProtocols(storageAccountsClient, cfg.ResourceGroup)
+	if err != nil {
+		return fmt.Errorf("unable to get the properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+
+	// the properties are left out by Azure when they were never set,
+	// both protocols are then disabled.
+	managed := cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
+	sftp := account.Properties.IsSftpEnabled != nil && *account.Properties.IsSftpEnabled
+	nfsv3 := account.Properties.IsNfsV3Enabled != nil && *account.Properties.IsNfsV3Enabled
+
+	var corrected string
+	if managed && sftp {
+		if err := d.disableSFTP(storageAccountsClient, cfg.ResourceGroup); err != nil {
+			util.UpdateCondition(cr, storageProtocolsCondition, operatorapiv1.ConditionUnknown, "Unknown Error Occurred",
+				fmt.Sprintf("Unable to disable SFTP on the storage account %s: %s", d.Config.AccountName, err))
+			return err
+		}
+		klog.Warningf("SFTP was enabled on the storage account %s, it has been disabled", d.Config.AccountName)
+		corrected = "SFTP was enabled and has been disabled"
+		sftp = false
+	}
+
+	switch {
+	case nfsv3:
+		util.UpdateCondition(cr, storageProtocolsCondition, operatorapiv1.ConditionFalse, "NFSv3Enabled",
+			fmt.Sprintf("NFSv3 is enabled on the storage account %s, it can only be disabled by recreating the account", d.Config.AccountName))
+	case sftp:
+		util.UpdateCondition(cr, storageProtocolsCondition, operatorapiv1.ConditionFalse, "SFTPEnabled",
+			fmt.Sprintf("SFTP is enabled on the storage account %s", d.Config.AccountName))
+	case corrected != "":
+		util.UpdateCondition(cr, storageProtocolsCondition, operatorapiv1.ConditionTrue, "DriftCorrected",
+			fmt.Sprintf("SFTP and NFSv3 are disabled on the storage account %s: %s", d.Config.AccountName, corrected))
+	default:
+		util.UpdateCondition(cr, storageProtocolsCondition, operatorapiv1.ConditionTrue, "AsExpected",
+			fmt.Sprintf("SFTP and NFSv3 are disabled on the storage account %s", d.Config.AccountName))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestSyncProtocols(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		state   string
+		account string
+		patched bool
+		status  operatorapiv1.ConditionStatus
+		reason  string
+	}{
+		{
+			name:    "explicitly disabled",
+			state:   imageregistryv1.StorageManagementStateManaged,
+			account: `{"properties":{"isSftpEnabled":false,"isNfsV3Enabled":false}}`,
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "AsExpected",
+		},
+		{
+			name:    "unset",
+			state:   imageregistryv1.StorageManagementStateManaged,
+			account: `{"properties":{}}`,
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "AsExpected",
+		},
+		{
+			name:    "sftp drift",
+			state:   imageregistryv1.StorageManagementStateManaged,
+			account: `{"properties":{"isSftpEnabled":true,"isNfsV3Enabled":false}}`,
+			patched: true,
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "DriftCorrected",
+		},
+		{
+			name:    "sftp enabled on unmanaged account",
+			state:   imageregistryv1.StorageManagementStateUnmanaged,
+			account: `{"properties":{"isSftpEnabled":true}}`,
+			status:  operatorapiv1.ConditionFalse,
+			reason:  "SFTPEnabled",
+		},
+		{
+			name:    "nfsv3 enabled",
+			state:   imageregistryv1.StorageManagementStateManaged,
+			account: `{"properties":{"isSftpEnabled":false,"isNfsV3Enabled":true}}`,
+			status:  operatorapiv1.ConditionFalse,
+			reason:  "NFSv3Enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+			sender.AddResponse(http.StatusOK, tt.account)
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.state
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncProtocols(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var patched bool
+			for _, req := range sender.Requests() {
+				if got := req.URL.Query().Get("api-version"); got != protocolsAPIVersion {
+					t.Errorf("got api-version %s, want %s", got, protocolsAPIVersion)
+				}
+				if req.Method != http.MethodPatch {
+					continue
+				}
+				patched = true
+				var body accountProtocols
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				if sftp := body.Properties.IsSftpEnabled; sftp == nil || *sftp {
+					t.Errorf("got isSftpEnabled %v, want false", sftp)
+				}
+			}
+			if patched != tt.patched {
+				t.Errorf("got patched %t, want %t", patched, tt.patched)
+			}
+
+			cond := cr.Status.Conditions[0]
+			if cond.Type != storageProtocolsCondition || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.status, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCreateStorageAccountDisablesProtocols(t *testing.T) {
+	sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+	sender.AddResponse(http.StatusOK, `{"name":"account"}`)
+
+	drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{}, nil)
+	drv.authorizer = autorest.NullAuthorizer{}
+	drv.sender = sender
+
+	environment, _ := getEnvironmentByName("")
+	cli, err := drv.storageAccountsClient(&Azure{SubscriptionID: "subscription_id"}, environment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := drv.createStorageAccount(cli, "resource_group", "account", "eastus", "", nil, nil, storage.StandardLRS); err != nil {
+		t.Fatal(err)
+	}
+
+	req := sender.Requests()[0]
+	if got := req.URL.Query().Get("api-version"); got != protocolsAPIVersion {
+		t.Errorf("got api-version %s, want %s", got, protocolsAPIVersion)
+	}
+	var body struct {
+		Properties struct {
+			IsSftpEnabled            *bool `json:"isSftpEnabled"`
+			IsNfsV3Enabled           *bool `json:"isNfsV3Enabled"`
+			SupportsHTTPSTrafficOnly *bool `json:"supportsHttpsTrafficOnly"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	props := body.Properties
+	if props.IsSftpEnabled == nil || *props.IsSftpEnabled || props.IsNfsV3Enabled == nil || *props.IsNfsV3Enabled {
+		t.Errorf("got isSftpEnabled %v and isNfsV3Enabled %v, want both false", props.IsSftpEnabled, props.IsNfsV3Enabled)
+	}
+	if props.SupportsHTTPSTrafficOnly == nil || !*props.SupportsHTTPSTrafficOnly {
+		t.Errorf("got supportsHttpsTrafficOnly %v, want true", props.SupportsHTTPSTrafficOnly)
+	}
+}
@@ -0,0 +1,81 @@
+package azure
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"golang.org/x/net/http/httpproxy"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/faultinject"
+)
+
+// proxyConfig returns the proxy settings of the cluster, the ones of the
+// environment are used when the cluster proxy is not known to the driver.
+func (d *driver) proxyConfig() (*httpproxy.Config, error) {
+	if d.Listers == nil || d.Listers.ProxyConfigs == nil {
+		return httpproxy.FromEnvironment(), nil
+	}
+	proxy, err := d.Listers.ProxyConfigs.Get(defaults.ClusterProxyResourceName)
+	if errors.IsNotFound(err) {
+		return &httpproxy.Config{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get cluster proxy configuration: %w", err)
+	}
+	return &httpproxy.Config{
+		HTTPProxy:  proxy.Status.HTTPProxy,
+		HTTPSProxy: proxy.Status.HTTPSProxy,
+		NoProxy:    proxy.Status.NoProxy,
+	}, nil
+}
+
+// httpClient returns the client used to reach Azure, sending the requests
+// through the cluster proxy. The client is built once per driver and only
+// replaced when the proxy settings change, so its connections are reused.
+func (d *driver) httpClient() (*http.Client, error) {
+	cfg, err := d.proxyConfig()
+	if err != nil {
+		return nil, err
+	}
+	if d.client != nil && d.clientProxy == *cfg {
+		return d.client, nil
+	}
+	proxyFunc := cfg.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	d.client, d.clientProxy = &http.Client{Transport: transport}, *cfg
+	return d.client, nil
+}
+
+// pipelineSender returns the sender of the Azure Blob Storage pipelines.
+func (d *driver) pipelineSender() (pipeline.Factory, error) {
+	if d.httpSender != nil {
+		return d.httpSender, nil
+	}
+	client, err := d.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	sender := faultinject.WrapSender("Azure", client)
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			resp, err := sender.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+			return pipeline.NewHTTPResponse(resp), err
+		}
+	}), nil
+}
@@ -0,0 +1,115 @@
+package azure
+
+import (
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configv1 "github.com/openshift/api/config/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+)
+
+func TestHTTPClientProxy(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(&configv1.Proxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Status: configv1.ProxyStatus{
+			HTTPProxy:  "http://proxy.example.com:3128",
+			HTTPSProxy: "http://secure-proxy.example.com:3129",
+			NoProxy:    ".blob.core.windows.net",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDriver(nil, nil, &regopclient.StorageListers{ProxyConfigs: configlisters.NewProxyLister(indexer)})
+
+	client, err := d.httpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := client.Transport.(*http.Transport)
+
+	for _, tt := range []struct {
+		url      string
+		expected string
+	}{
+		{url: "https://management.azure.com/subscriptions", expected: "http://secure-proxy.example.com:3129"},
+		{url: "http://login.microsoftonline.com/", expected: "http://proxy.example.com:3128"},
+		{url: "https://account.blob.core.windows.net/container", expected: ""},
+	} {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxy, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if proxy != nil {
+			got = proxy.String()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: got proxy %q, want %q", tt.url, got, tt.expected)
+		}
+	}
+}
+
+func TestHTTPClientWithoutClusterProxy(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	d := NewDriver(nil, nil, &regopclient.StorageListers{ProxyConfigs: configlisters.NewProxyLister(indexer)})
+
+	client, err := d.httpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://management.azure.com/subscriptions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxy != nil {
+		t.Errorf("got proxy %v and error %v, want a direct connection", proxy, err)
+	}
+}
+
+func TestHTTPClientReused(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	proxy := &configv1.Proxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Status:     configv1.ProxyStatus{HTTPSProxy: "http://proxy.example.com:3128"},
+	}
+	if err := indexer.Add(proxy); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDriver(nil, nil, &regopclient.StorageListers{ProxyConfigs: configlisters.NewProxyLister(indexer)})
+
+	first, err := d.httpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.httpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("got a new client while the proxy settings did not change")
+	}
+
+	proxy = proxy.DeepCopy()
+	proxy.Status.HTTPSProxy = "http://other-proxy.example.com:3128"
+	if err := indexer.Update(proxy); err != nil {
+		t.Fatal(err)
+	}
+	third, err := d.httpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == second {
+		t.Errorf("got the same client after the proxy settings changed")
+	}
+}
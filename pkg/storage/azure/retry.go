@@ -0,0 +1,210 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+// storageExistsReasonThrottled is the reason of the StorageExists condition
+// when Azure Resource Manager kept throttling the requests of the operator.
+const storageExistsReasonThrottled = "Throttled"
+
+// RetryOptions configures how the requests to Azure Resource Manager are
+// retried. The fields mirror the retry options of the Azure SDK.
+type RetryOptions struct {
+	// MaxRetries is the number of times a request is retried, 3 if zero.
+	// Set it to -1 to disable retries.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// RetryDelay is the initial delay between retries, it doubles after
+	// every retry. 800ms if empty.
+	RetryDelay string `json:"retryDelay,omitempty"`
+	// MaxRetryDelay caps the delay between retries, including the one
+	// asked by Azure in the Retry-After header. 60s if empty.
+	MaxRetryDelay string `json:"maxRetryDelay,omitempty"`
+	// StatusCodes are the status codes of the responses the requests are
+	// retried for, 408, 429, 500, 502, 503 and 504 if empty.
+	StatusCodes []int `json:"statusCodes,omitempty"`
+}
+
+// retryPolicy is the parsed form of RetryOptions.
+type retryPolicy struct {
+	maxRetries    int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	statusCodes   []int
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxRetries:    3,
+	retryDelay:    800 * time.Millisecond,
+	maxRetryDelay: 60 * time.Second,
+	statusCodes:   autorest.StatusCodesForRetry,
+}
+
+// getRetryPolicy returns the retry policy set in the storage.azure.retry
+// section of the unsupported config overrides, the unset fields keep their
+// defaults.
+func getRetryPolicy(cr *imageregistryv1.Config) (retryPolicy, error) {
+	policy := defaultRetryPolicy
+
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return policy, err
+	}
+	if overrides == nil || overrides.Retry == nil {
+		return policy, nil
+	}
+	opts := overrides.Retry
+
+	switch {
+	case opts.MaxRetries < 0:
+		policy.maxRetries = 0
+	case opts.MaxRetries > 0:
+		policy.maxRetries = opts.MaxRetries
+	}
+	if opts.RetryDelay != "" {
+		d, err := time.ParseDuration(opts.RetryDelay)
+		if err != nil || d <= 0 {
+			return policy, fmt.Errorf("invalid Azure retry options: retryDelay %q is not a positive duration", opts.RetryDelay)
+		}
+		policy.retryDelay = d
+	}
+	if opts.MaxRetryDelay != "" {
+		d, err := time.ParseDuration(opts.MaxRetryDelay)
+		if err != nil || d <= 0 {
+			return policy, fmt.Errorf("invalid Azure retry options: maxRetryDelay %q is not a positive duration", opts.MaxRetryDelay)
+		}
+		policy.maxRetryDelay = d
+	}
+	if policy.retryDelay > policy.maxRetryDelay {
+		return policy, fmt.Errorf("invalid Azure retry options: retryDelay %s is greater than maxRetryDelay %s", policy.retryDelay, policy.maxRetryDelay)
+	}
+	for _, code := range opts.StatusCodes {
+		if code < 400 || code > 599 {
+			return policy, fmt.Errorf("invalid Azure retry options: %d is not an error status code", code)
+		}
+	}
+	if len(opts.StatusCodes) > 0 {
+		policy.statusCodes = opts.StatusCodes
+	}
+	return policy, nil
+}
+
+// delay returns for how long to wait before the retry following the given
+// attempt, counted from zero. A random jitter of -20% to +30% is applied so
+// the retries of several clients do not hit Azure at the same time.
+func (p retryPolicy) delay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			if d := time.Duration(seconds) * time.Second; d < p.maxRetryDelay {
+				return d
+			}
+			return p.maxRetryDelay
+		}
+	}
+	d := p.retryDelay << attempt
+	if d <= 0 || d > p.maxRetryDelay {
+		d = p.maxRetryDelay
+	}
+	return time.Duration(float64(d) * (0.8 + 0.5*rand.Float64()))
+}
+
+// retryable returns true if the request is to be retried after receiving
+// resp or err.
+func (p retryPolicy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// rejected credentials are not going to be accepted later.
+		return !autorest.IsTokenRefreshError(err)
+	}
+	return autorest.ResponseHasStatusCode(resp, p.statusCodes...)
+}
+
+// sendDecorator returns a decorator retrying the requests with an
+// exponential backoff.
+func (p retryPolicy) sendDecorator() autorest.SendDecorator {
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			rr := autorest.NewRetriableRequest(r)
+			for attempt := 0; ; attempt++ {
+				if err := rr.Prepare(); err != nil {
+					return nil, err
+				}
+				resp, err := s.Do(rr.Request())
+				if attempt >= p.maxRetries || !p.retryable(resp, err) {
+					return resp, err
+				}
+
+				delay := p.delay(resp, attempt)
+				if resp != nil {
+					klog.V(2).Infof("retrying %s %s in %s: %s", r.Method, r.URL.Path, delay, resp.Status)
+				} else {
+					klog.V(2).Infof("retrying %s %s in %s: %s", r.Method, r.URL.Path, delay, err)
+				}
+				autorest.DrainResponseBody(resp)
+
+				t := time.NewTimer(delay)
+				select {
+				case <-r.Context().Done():
+					t.Stop()
+					return nil, r.Context().Err()
+				case <-t.C:
+				}
+			}
+		})
+	}
+}
+
+// setRetryPolicy sets the retry policy of the requests to Azure Resource
+// Manager from the unsupported config overrides.
+func (d *driver) setRetryPolicy(cr *imageregistryv1.Config) error {
+	policy, err := getRetryPolicy(cr)
+	if err != nil {
+		return err
+	}
+	d.retry = &policy
+	return nil
+}
+
+// sendDecorators returns the decorators of the requests sent by client. The
+// retries for the registration of the resource providers are kept.
+func (d *driver) sendDecorators(client autorest.Client) []autorest.SendDecorator {
+	policy := defaultRetryPolicy
+	if d.retry != nil {
+		policy = *d.retry
+	}
+	return []autorest.SendDecorator{
+		autorestazure.DoRetryWithRegistration(client),
+		policy.sendDecorator(),
+	}
+}
+
+// throttled returns true if err comes from a request Azure Resource Manager
+// kept throttling.
+func throttled(err error) bool {
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		if code, ok := detailedErr.StatusCode.(int); ok {
+			return code == http.StatusTooManyRequests
+		}
+	}
+	return false
+}
+
+// azureErrorReason returns the reason of the StorageExists condition for a
+// failed request to Azure.
+func azureErrorReason(err error) string {
+	if throttled(err) {
+		return storageExistsReasonThrottled
+	}
+	return storageExistsReasonAzureError
+}
@@ -0,0 +1,152 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestGetRetryPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		overrides string
+		expected  retryPolicy
+		err       string
+	}{
+		{
+			overrides: `{"storage":{"azure":{"syncTags":true}}}`,
+			expected:  defaultRetryPolicy,
+		},
+		{
+			overrides: `{"storage":{"azure":{"retry":{"maxRetries":5,"retryDelay":"2s","maxRetryDelay":"30s","statusCodes":[429,503]}}}}`,
+			expected:  retryPolicy{maxRetries: 5, retryDelay: 2 * time.Second, maxRetryDelay: 30 * time.Second, statusCodes: []int{429, 503}},
+		},
+		{
+			overrides: `{"storage":{"azure":{"retry":{"maxRetries":-1}}}}`,
+			expected:  retryPolicy{maxRetries: 0, retryDelay: defaultRetryPolicy.retryDelay, maxRetryDelay: defaultRetryPolicy.maxRetryDelay, statusCodes: defaultRetryPolicy.statusCodes},
+		},
+		{
+			overrides: `{"storage":{"azure":{"retry":{"retryDelay":"soon"}}}}`,
+			err:       `retryDelay "soon" is not a positive duration`,
+		},
+		{
+			overrides: `{"storage":{"azure":{"retry":{"retryDelay":"2m"}}}}`,
+			err:       "retryDelay 2m0s is greater than maxRetryDelay 1m0s",
+		},
+		{
+			overrides: `{"storage":{"azure":{"retry":{"statusCodes":[200]}}}}`,
+			err:       "200 is not an error status code",
+		},
+	} {
+		cr := &imageregistryv1.Config{}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+		policy, err := getRetryPolicy(cr)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.overrides, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.overrides, err)
+		} else if !reflect.DeepEqual(policy, tt.expected) {
+			t.Errorf("%s: got %#v, want %#v", tt.overrides, policy, tt.expected)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{retryDelay: time.Second, maxRetryDelay: 10 * time.Second}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		d := p.delay(nil, attempt)
+		if lo, hi := time.Duration(float64(expected)*0.8), time.Duration(float64(expected)*1.3); d < lo || d > hi {
+			t.Errorf("attempt %d: got delay %s, want between %s and %s", attempt, d, lo, hi)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if d := p.delay(resp, 0); d != 3*time.Second {
+		t.Errorf("got delay %s, want the one from Retry-After", d)
+	}
+	resp.Header.Set("Retry-After", "3600")
+	if d := p.delay(resp, 0); d != p.maxRetryDelay {
+		t.Errorf("got delay %s, want it capped at %s", d, p.maxRetryDelay)
+	}
+}
+
+func TestRetryPolicySendDecorator(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		codes         []int
+		expectedCode  int
+		expectedCalls int
+	}{
+		{
+			name:          "recovered",
+			codes:         []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK},
+			expectedCode:  http.StatusOK,
+			expectedCalls: 3,
+		},
+		{
+			name:          "still throttled",
+			codes:         []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			expectedCode:  http.StatusTooManyRequests,
+			expectedCalls: 3,
+		},
+		{
+			name:          "not retryable",
+			codes:         []int{http.StatusNotFound, http.StatusOK},
+			expectedCode:  http.StatusNotFound,
+			expectedCalls: 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{}
+			for _, code := range tt.codes {
+				sender.AddJSONResponse(code, `{}`)
+			}
+
+			p := retryPolicy{maxRetries: 2, retryDelay: time.Millisecond, maxRetryDelay: time.Millisecond, statusCodes: autorest.StatusCodesForRetry}
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, "https://management.azure.com/account", strings.NewReader(`{"location":"eastus"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := autorest.SendWithSender(sender, req, p.sendDecorator())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("got status code %d, want %d", resp.StatusCode, tt.expectedCode)
+			}
+
+			reqs := sender.Requests()
+			if len(reqs) != tt.expectedCalls {
+				t.Fatalf("got %d requests, want %d", len(reqs), tt.expectedCalls)
+			}
+			for i, r := range reqs {
+				if string(r.Body) != `{"location":"eastus"}` {
+					t.Errorf("request %d: got body %q, want the original one", i, r.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestAzureErrorReason(t *testing.T) {
+	throttledErr := autorest.NewErrorWithError(fmt.Errorf("too many requests"), "storage.AccountsClient", "ListKeys", &http.Response{StatusCode: http.StatusTooManyRequests}, "Failure responding to request")
+	if reason := azureErrorReason(fmt.Errorf("unable to get keys: %w", throttledErr)); reason != storageExistsReasonThrottled {
+		t.Errorf("got reason %q for a throttled request, want %q", reason, storageExistsReasonThrottled)
+	}
+
+	failedErr := autorest.NewErrorWithError(fmt.Errorf("internal error"), "storage.AccountsClient", "ListKeys", &http.Response{StatusCode: http.StatusInternalServerError}, "Failure responding to request")
+	if reason := azureErrorReason(failedErr); reason != storageExistsReasonAzureError {
+		t.Errorf("got reason %q for a failed request, want %q", reason, storageExistsReasonAzureError)
+	}
+}
@@ -0,0 +1,309 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// sharedKeyAccessCondition reports whether shared key access, i.e. requests
+// authorized with the account keys, is disabled on the storage account.
+const sharedKeyAccessCondition = "AzureSharedKeyAccess"
+
+// sharedKeyAccessDisableRequested returns true if
+// storage.azure.disableSharedKeyAccess is set in the unsupported config
+// overrides. The operator and the registry then authenticate to the blob
+// service with Microsoft Entra ID. The operator does not enable shared key
+// access again once the setting is removed, the registry keeps using
+// Microsoft Entra ID until shared key access is enabled on the account.
+func sharedKeyAccessDisableRequested(cr *imageregistryv1.Config) (bool, error) {
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return false, err
+	}
+	return overrides != nil && overrides.DisableSharedKeyAccess, nil
+}
+
+// accountSharedKeyAccess holds the shared key access property of a storage
+// account, the SDK in use predates it.
+type accountSharedKeyAccess struct {
+	Properties struct {
+		AllowSharedKeyAccess *bool `json:"allowSharedKeyAccess,omitempty"`
+	} `json:"properties"`
+}
+
+// withSharedKeyAccessDisabled disables shared key access in the request
+// creating a storage account, so policies denying accounts that allow it do
+// not block the creation.
+func withSharedKeyAccessDisabled() autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err != nil {
+				return r, err
+			}
+
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				return r, err
+			}
+			r.Body.Close()
+			props, _ := body["properties"].(map[string]interface{})
+			if props == nil {
+				props = map[string]interface{}{}
+				body["properties"] = props
+			}
+			props["allowSharedKeyAccess"] = false
+
+			q := r.URL.Query()
+			q.Set("api-version", protocolsAPIVersion)
+			r.URL.RawQuery = q.Encode()
+			return autorest.Prepare(r, autorest.WithJSON(body))
+		})
+	}
+}
+
+// sharedKeyAccess records whether shared key access is disabled on the
+// storage accounts the operator uses, by resource ID. It is recorded when
+// the storage is synced, before the registry configuration is generated.
+var sharedKeyAccess = sharedKeyAccessRecord{disabled: map[string]bool{}}
+
+type sharedKeyAccessRecord struct {
+	mtx      sync.Mutex
+	disabled map[string]bool
+}
+
+func (r *sharedKeyAccessRecord) get(id string) (disabled bool, known bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	disabled, known = r.disabled[strings.ToLower(id)]
+	return disabled, known
+}
+
+func (r *sharedKeyAccessRecord) set(id string, disabled bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.disabled[strings.ToLower(id)] = disabled
+}
+
+// getSharedKeyAccessDisabled returns true if shared key access is disabled
+// on the storage account. Accounts without the property allow it.
+func (d *driver) getSharedKeyAccessDisabled(cli storage.AccountsClient, resourceGroup string) (bool, error) {
+	req, err := d.accountRequest(cli, resourceGroup, autorest.AsGet())
+	if err != nil {
+		return false, err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return false, err
+	}
+
+	var account accountSharedKeyAccess
+	err = autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&account),
+		autorest.ByClosing(),
+	)
+	if err != nil {
+		wrappedErr := fmt.Errorf("failed to get the properties of the storage account %s: %s", d.Config.AccountName, err)
+		if e, ok := err.(autorest.DetailedError); ok && e.StatusCode == http.StatusNotFound {
+			return false, &errDoesNotExist{Err: wrappedErr}
+		}
+		return false, wrappedErr
+	}
+	allowed := account.Properties.AllowSharedKeyAccess
+	return allowed != nil && !*allowed, nil
+}
+
+// disableSharedKeyAccess disables shared key access on the storage account.
+func (d *driver) disableSharedKeyAccess(cli storage.AccountsClient, resourceGroup string) error {
+	req, err := d.accountRequest(cli, resourceGroup,
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPatch(),
+		autorest.WithJSON(map[string]interface{}{
+			"properties": map[string]interface{}{
+				"allowSharedKeyAccess": false,
+			},
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.Send(req)
+	if err != nil {
+		return err
+	}
+	return autorest.Respond(
+		resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByClosing(),
+	)
+}
+
+// sharedKeyAccessDisabled returns true if shared key access is disabled on
+// the storage account reached through the Azure Resource Manager. The
+// account is only queried when nothing was recorded for it, e.g. in the
+// jobs run by the operator.
+func (d *driver) sharedKeyAccessDisabled(cli storage.AccountsClient, cfg *Azure) (bool, error) {
+	id := accountID(cfg, d.Config.AccountName)
+	if disabled, ok := sharedKeyAccess.get(id); ok {
+		return disabled, nil
+	}
+	disabled, err := d.getSharedKeyAccessDisabled(cli, cfg.ResourceGroup)
+	if err != nil {
+		return false, err
+	}
+	sharedKeyAccess.set(id, disabled)
+	return disabled, nil
+}
+
+// syncSharedKeyAccess disables shared key access on the storage account when
+// it is requested in the unsupported config overrides. Accounts not managed
+// by the operator are only checked.
+func (d *driver) syncSharedKeyAccess(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	requested, err := sharedKeyAccessDisableRequested(cr)
+	if err != nil {
+		return err
+	}
+	if !requested {
+		return d.checkSharedKeyAccess(cr, cfg, environment)
+	}
+	if cfg.AccountKey != "" {
+		util.UpdateCondition(cr, sharedKeyAccessCondition, operatorapiv1.ConditionFalse, "AccountKeyProvided",
+			fmt.Sprintf("Shared key access cannot be disabled, the registry uses the account key from the secret %s", defaults.ImageRegistryPrivateConfigurationUser))
+		return nil
+	}
+	if strings.EqualFold(d.Config.CloudName, "AZURESTACKCLOUD") {
+		util.UpdateCondition(cr, sharedKeyAccessCondition, operatorapiv1.ConditionFalse, "NotSupported",
+			"Shared key access cannot be disabled on Azure Stack Hub")
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	id := accountID(cfg, d.Config.AccountName)
+	disabled, err := d.getSharedKeyAccessDisabled(storageAccountsClient, cfg.ResourceGroup)
+	if err != nil {
+		util.UpdateCondition(cr, sharedKeyAccessCondition, operatorapiv1.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return err
+	}
+	if !disabled {
+		if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+			sharedKeyAccess.set(id, false)
+			util.UpdateCondition(cr, sharedKeyAccessCondition, operatorapiv1.ConditionFalse, "NotManaged",
+				fmt.Sprintf("The storage account %s is not managed by the operator, shared key access is left enabled", d.Config.AccountName))
+			return nil
+		}
+		if err := d.disableSharedKeyAccess(storageAccountsClient, cfg.ResourceGroup); err != nil {
+			util.UpdateCondition(cr, sharedKeyAccessCondition, operatorapiv1.ConditionFalse, "UpdateFailed",
+				fmt.Sprintf("Unable to disable shared key access on the storage account %s: %s", d.Config.AccountName, err))
+			return err
+		}
+		klog.Infof("shared key access has been disabled on the storage account %s", d.Config.AccountName)
+	}
+	sharedKeyAccess.set(id, true)
+	util.UpdateCondition(cr, sharedKeyAccessCondition, operatorapiv1.ConditionTrue, "Disabled",
+		fmt.Sprintf("Shared key access is disabled on the storage account %s, the registry authenticates with Microsoft Entra ID", d.Config.AccountName))
+	return nil
+}
+
+// checkSharedKeyAccess records whether shared key access is disabled on a
+// storage account for which it is not requested, the setting may have been
+// removed after the operator disabled it.
+func (d *driver) checkSharedKeyAccess(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	if cfg.AccountKey != "" {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, sharedKeyAccessCondition)
+		return nil
+	}
+	id := accountID(cfg, d.Config.AccountName)
+	if strings.EqualFold(d.Config.CloudName, "AZURESTACKCLOUD") {
+		sharedKeyAccess.set(id, false)
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, sharedKeyAccessCondition)
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	disabled, err := d.getSharedKeyAccessDisabled(storageAccountsClient, cfg.ResourceGroup)
+	if err != nil {
+		return err
+	}
+	sharedKeyAccess.set(id, disabled)
+	if !disabled {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, sharedKeyAccessCondition)
+		return nil
+	}
+	util.UpdateCondition(cr, sharedKeyAccessCondition, operatorapiv1.ConditionTrue, "DisabledOnAccount",
+		fmt.Sprintf("Shared key access is still disabled on the storage account %s, the registry authenticates with Microsoft Entra ID until it is enabled on the account", d.Config.AccountName))
+	return nil
+}
+
+// blobCredential returns the credential the operator accesses the blobs of
+// the storage account with: the account key, or a Microsoft Entra ID token
+// when shared key access is disabled on the account.
+func (d *driver) blobCredential(cfg *Azure, environment autorestazure.Environment) (azblob.Credential, error) {
+	if cfg.AccountKey != "" {
+		return azblob.NewSharedKeyCredential(d.Config.AccountName, cfg.AccountKey)
+	}
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return nil, err
+	}
+	return d.accountBlobCredential(storageAccountsClient, cfg, environment)
+}
+
+// accountBlobCredential is blobCredential for storage accounts reached
+// through the Azure Resource Manager.
+func (d *driver) accountBlobCredential(cli storage.AccountsClient, cfg *Azure, environment autorestazure.Environment) (azblob.Credential, error) {
+	disabled, err := d.sharedKeyAccessDisabled(cli, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if disabled {
+		return d.blobTokenCredential(cfg, environment)
+	}
+	key, err := d.getAccountKey(cli, cfg.ResourceGroup, d.Config.AccountName)
+	if err != nil {
+		return nil, err
+	}
+	return azblob.NewSharedKeyCredential(d.Config.AccountName, key)
+}
+
+// blobTokenCredential returns a Microsoft Entra ID token for the blob
+// service. The credential is used for a single sync, it is not refreshed.
+func (d *driver) blobTokenCredential(cfg *Azure, environment autorestazure.Environment) (azblob.Credential, error) {
+	if d.blobToken != "" {
+		return azblob.NewTokenCredential(d.blobToken, nil), nil
+	}
+	cred, err := d.tokenCredential(cfg, environment)
+	if err != nil {
+		return nil, err
+	}
+	scope := strings.TrimSuffix(environment.ResourceIdentifiers.Storage, "/") + "/.default"
+	token, err := cred.GetToken(d.Context, policy.TokenRequestOptions{Scopes: []string{scope}})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get a token for the storage account %s: %w", d.Config.AccountName, err)
+	}
+	return azblob.NewTokenCredential(token.Token, nil), nil
+}
@@ -0,0 +1,243 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestSyncSharedKeyAccess(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		overrides  string
+		accountKey string
+		state      string
+		account    string
+		patched    bool
+		disabled   bool
+		status     operatorapiv1.ConditionStatus
+		reason     string
+	}{
+		{
+			name:  "not requested",
+			state: imageregistryv1.StorageManagementStateManaged,
+		},
+		{
+			name:     "not requested and still disabled",
+			state:    imageregistryv1.StorageManagementStateManaged,
+			account:  `{"properties":{"allowSharedKeyAccess":false}}`,
+			disabled: true,
+			status:   operatorapiv1.ConditionTrue,
+			reason:   "DisabledOnAccount",
+		},
+		{
+			name:      "already disabled",
+			overrides: `{"storage":{"azure":{"disableSharedKeyAccess":true}}}`,
+			state:     imageregistryv1.StorageManagementStateManaged,
+			account:   `{"properties":{"allowSharedKeyAccess":false}}`,
+			disabled:  true,
+			status:    operatorapiv1.ConditionTrue,
+			reason:    "Disabled",
+		},
+		{
+			name:      "enabled on managed account",
+			overrides: `{"storage":{"azure":{"disableSharedKeyAccess":true}}}`,
+			state:     imageregistryv1.StorageManagementStateManaged,
+			account:   `{"properties":{}}`,
+			patched:   true,
+			disabled:  true,
+			status:    operatorapiv1.ConditionTrue,
+			reason:    "Disabled",
+		},
+		{
+			name:      "enabled on unmanaged account",
+			overrides: `{"storage":{"azure":{"disableSharedKeyAccess":true}}}`,
+			state:     imageregistryv1.StorageManagementStateUnmanaged,
+			account:   `{"properties":{"allowSharedKeyAccess":true}}`,
+			status:    operatorapiv1.ConditionFalse,
+			reason:    "NotManaged",
+		},
+		{
+			name:       "account key provided",
+			overrides:  `{"storage":{"azure":{"disableSharedKeyAccess":true}}}`,
+			accountKey: "key",
+			state:      imageregistryv1.StorageManagementStateManaged,
+			status:     operatorapiv1.ConditionFalse,
+			reason:     "AccountKeyProvided",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sharedKeyAccess = sharedKeyAccessRecord{disabled: map[string]bool{}}
+
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+			if tt.account != "" {
+				sender.AddResponse(http.StatusOK, tt.account)
+			}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.state
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			cfg := &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group", AccountKey: tt.accountKey}
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncSharedKeyAccess(cr, cfg, environment); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var patched bool
+			for _, req := range sender.Requests() {
+				if req.Method != http.MethodPatch {
+					continue
+				}
+				patched = true
+				var body accountSharedKeyAccess
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				if allowed := body.Properties.AllowSharedKeyAccess; allowed == nil || *allowed {
+					t.Errorf("got allowSharedKeyAccess %v, want false", allowed)
+				}
+			}
+			if patched != tt.patched {
+				t.Errorf("got patched %t, want %t", patched, tt.patched)
+			}
+
+			if tt.accountKey == "" {
+				disabled, ok := sharedKeyAccess.get(accountID(cfg, "account"))
+				if !ok || disabled != tt.disabled {
+					t.Errorf("got recorded %t (known %t), want %t", disabled, ok, tt.disabled)
+				}
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, sharedKeyAccessCondition)
+			if tt.reason == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.status, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCreateStorageAccountDisablesSharedKeyAccess(t *testing.T) {
+	sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+	sender.AddResponse(http.StatusOK, `{"name":"account"}`)
+
+	drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{}, nil)
+	drv.authorizer = autorest.NullAuthorizer{}
+	drv.sender = sender
+	drv.disableSharedKey = true
+
+	environment, _ := getEnvironmentByName("")
+	cli, err := drv.storageAccountsClient(&Azure{SubscriptionID: "subscription_id"}, environment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := drv.createStorageAccount(cli, "resource_group", "account", "eastus", "", nil, nil, storage.StandardLRS); err != nil {
+		t.Fatal(err)
+	}
+
+	var body accountSharedKeyAccess
+	if err := json.Unmarshal(sender.Requests()[0].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if allowed := body.Properties.AllowSharedKeyAccess; allowed == nil || *allowed {
+		t.Errorf("got allowSharedKeyAccess %v, want false", allowed)
+	}
+
+	err = drv.createStorageAccount(cli, "resource_group", "account", "eastus", "AZURESTACKCLOUD", nil, nil, storage.StandardLRS)
+	if err == nil {
+		t.Errorf("expected an error on Azure Stack Hub")
+	}
+}
+
+func TestConfigEnvWithoutSharedKeyAccess(t *testing.T) {
+	sharedKeyAccess = sharedKeyAccessRecord{disabled: map[string]bool{}}
+
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceGroupName: "resourcegroup",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"azure_subscription_id": []byte("subscription_id"),
+			"azure_client_id":       []byte("client_id"),
+			"azure_client_secret":   []byte("client_secret"),
+			"azure_tenant_id":       []byte("tenant_id"),
+			"azure_resourcegroup":   []byte("resourcegroup"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{"keys":[{"value":"firstKey"}]}`}}
+	sender.AddResponse(http.StatusOK, `{"properties":{"allowSharedKeyAccess":false}}`)
+
+	d := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{
+		AccountName: "account",
+		Container:   "container",
+	}, &listers.StorageListers)
+	d.authorizer = autorest.NullAuthorizer{}
+	d.sender = sender
+
+	envvars, err := d.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := findEnvVar(envvars, "REGISTRY_STORAGE_AZURE_ACCOUNTKEY"); e != nil {
+		t.Errorf("got %s, want no account key", e.Name)
+	}
+	for key, value := range map[string]string{
+		"AZURE_CLIENT_ID":      "client_id",
+		"AZURE_TENANT_ID":      "tenant_id",
+		"AZURE_CLIENT_SECRET":  "client_secret",
+		"AZURE_AUTHORITY_HOST": "https://login.microsoftonline.com/",
+	} {
+		e := findEnvVar(envvars, key)
+		if e == nil {
+			t.Fatalf("envvar %s not found, %v", key, envvars)
+		}
+		if e.Value != value {
+			t.Errorf("%s: got %#+v, want %#+v", key, e.Value, value)
+		}
+	}
+	if e := findEnvVar(envvars, "AZURE_CLIENT_SECRET"); !e.Secret {
+		t.Errorf("AZURE_CLIENT_SECRET is not marked as a secret")
+	}
+}
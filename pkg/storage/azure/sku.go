@@ -0,0 +1,103 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+// getSKU returns the SKU set in the storage.azure.sku section of the
+// unsupported config overrides, Standard_LRS if there is none.
+func getSKU(cr *imageregistryv1.Config) (storage.SkuName, error) {
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return "", err
+	}
+	if overrides == nil || overrides.SKU == "" {
+		return storage.StandardLRS, nil
+	}
+
+	sku := storage.SkuName(overrides.SKU)
+	for _, known := range storage.PossibleSkuNameValues() {
+		if sku == known {
+			return sku, nil
+		}
+	}
+	return "", fmt.Errorf("unknown Azure storage account SKU %q", sku)
+}
+
+// accountKind returns the kind of the storage accounts with the given SKU
+// created by the operator. Premium accounts holding block blobs have their
+// own kind, StorageV2 premium accounts only hold page blobs.
+func accountKind(sku storage.SkuName, cloudName string) storage.Kind {
+	switch {
+	case strings.EqualFold(cloudName, "AZURESTACKCLOUD"):
+		return storage.Storage
+	case sku == storage.PremiumLRS || sku == storage.PremiumZRS:
+		return storage.BlockBlobStorage
+	default:
+		return storage.StorageV2
+	}
+}
+
+// validateSKU returns an error if storage accounts with the given SKU
+// cannot be created in the region. Azure Stack Hub only supports locally
+// redundant standard accounts and doesn't list its SKUs. Standard_LRS is
+// available in every region, it is not looked up.
+func (d *driver) validateSKU(cli storage.AccountsClient, environment autorestazure.Environment, cfg *Azure, sku storage.SkuName, cloudName string) error {
+	if strings.EqualFold(cloudName, "AZURESTACKCLOUD") {
+		if sku != storage.StandardLRS {
+			return fmt.Errorf("the storage account SKU %s is not supported on Azure Stack Hub, only %s is", sku, storage.StandardLRS)
+		}
+		return nil
+	}
+	if sku == storage.StandardLRS {
+		return nil
+	}
+
+	client := storage.NewSkusClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	client.Client = cli.Client
+	skus, err := client.List(d.Context)
+	if err != nil {
+		return fmt.Errorf("unable to list the storage account SKUs: %w", err)
+	}
+
+	kind := accountKind(sku, cloudName)
+	region := strings.ReplaceAll(cfg.Region, " ", "")
+	var infos []storage.SkuInformation
+	if skus.Value != nil {
+		infos = *skus.Value
+	}
+	for _, info := range infos {
+		if info.Name != sku || info.Kind != kind || info.Locations == nil {
+			continue
+		}
+		available := false
+		for _, location := range *info.Locations {
+			if strings.EqualFold(strings.ReplaceAll(location, " ", ""), region) {
+				available = true
+			}
+		}
+		if !available {
+			continue
+		}
+		if info.Restrictions != nil {
+			for _, restriction := range *info.Restrictions {
+				if restriction.Values == nil {
+					continue
+				}
+				for _, location := range *restriction.Values {
+					if strings.EqualFold(strings.ReplaceAll(location, " ", ""), region) {
+						return fmt.Errorf("the storage account SKU %s is restricted in the region %s: %s", sku, cfg.Region, restriction.ReasonCode)
+					}
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("the storage account SKU %s is not available for %s accounts in the region %s", sku, kind, cfg.Region)
+}
@@ -0,0 +1,137 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestGetSKU(t *testing.T) {
+	for _, tt := range []struct {
+		overrides string
+		expected  storage.SkuName
+		err       string
+	}{
+		{
+			expected: storage.StandardLRS,
+		},
+		{
+			overrides: `{"storage":{"azure":{"useSecondaryEndpoint":true}}}`,
+			expected:  storage.StandardLRS,
+		},
+		{
+			overrides: `{"storage":{"azure":{"sku":"Standard_GZRS"}}}`,
+			expected:  storage.StandardGZRS,
+		},
+		{
+			overrides: `{"storage":{"azure":{"sku":"Standard_XRS"}}}`,
+			err:       `unknown Azure storage account SKU "Standard_XRS"`,
+		},
+	} {
+		cr := &imageregistryv1.Config{}
+		cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+		sku, err := getSKU(cr)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.overrides, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.overrides, err)
+		} else if sku != tt.expected {
+			t.Errorf("%s: got SKU %s, want %s", tt.overrides, sku, tt.expected)
+		}
+	}
+}
+
+func TestValidateSKU(t *testing.T) {
+	const skus = `{"value":[
+		{"name":"Standard_ZRS","kind":"StorageV2","locations":["eastus"],"restrictions":[]},
+		{"name":"Standard_GZRS","kind":"StorageV2","locations":["eastus"],"restrictions":[{"type":"Location","values":["eastus"],"reasonCode":"NotAvailableForSubscription"}]},
+		{"name":"Premium_LRS","kind":"StorageV2","locations":["eastus"],"restrictions":[]},
+		{"name":"Premium_LRS","kind":"BlockBlobStorage","locations":["eastus"],"restrictions":[]}
+	]}`
+
+	for _, tt := range []struct {
+		name      string
+		sku       storage.SkuName
+		cloudName string
+		region    string
+		requests  int
+		err       string
+	}{
+		{
+			name:   "default SKU",
+			sku:    storage.StandardLRS,
+			region: "eastus",
+		},
+		{
+			name:     "available",
+			sku:      storage.StandardZRS,
+			region:   "East US",
+			requests: 1,
+		},
+		{
+			name:     "other region",
+			sku:      storage.StandardZRS,
+			region:   "westus",
+			requests: 1,
+			err:      "not available for StorageV2 accounts in the region westus",
+		},
+		{
+			name:     "restricted",
+			sku:      storage.StandardGZRS,
+			region:   "eastus",
+			requests: 1,
+			err:      "restricted in the region eastus: NotAvailableForSubscription",
+		},
+		{
+			name:     "premium block blobs",
+			sku:      storage.PremiumLRS,
+			region:   "eastus",
+			requests: 1,
+		},
+		{
+			name:      "Azure Stack Hub",
+			sku:       storage.StandardZRS,
+			cloudName: "AZURESTACKCLOUD",
+			region:    "local",
+			err:       "not supported on Azure Stack Hub",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{}
+			sender.AddJSONResponse(http.StatusOK, skus)
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			environment, _ := getEnvironmentByName("")
+			cfg := &Azure{SubscriptionID: "subscription_id", Region: tt.region}
+			cli, err := drv.storageAccountsClient(cfg, environment)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = drv.validateSKU(cli, environment, cfg, tt.sku, tt.cloudName)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Error(err)
+			}
+			if reqs := sender.Requests(); len(reqs) != tt.requests {
+				t.Errorf("got %d requests, want %d", len(reqs), tt.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// softDeleteCondition reports whether the deleted blobs and containers of the
+// storage account are retained as configured.
+const softDeleteCondition = "AzureBlobSoftDelete"
+
+// SoftDelete keeps the deleted blobs and containers of the storage account
+// for a number of days, so the registry content deleted by accident, e.g. by
+// the pruner, can be restored.
+type SoftDelete struct {
+	// BlobRetentionDays is how long deleted blobs are kept, between 1
+	// and 365 days. Blob soft delete is left as it is if unset.
+	BlobRetentionDays int32 `json:"blobRetentionDays,omitempty"`
+	// ContainerRetentionDays is how long deleted containers are kept,
+	// between 1 and 365 days. Container soft delete is left as it is if
+	// unset.
+	ContainerRetentionDays int32 `json:"containerRetentionDays,omitempty"`
+}
+
+// getSoftDelete returns the soft delete set in the storage.azure.softDelete
+// section of the unsupported config overrides, or nil if there is none.
+func getSoftDelete(cr *imageregistryv1.Config) (*SoftDelete, error) {
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides == nil || overrides.SoftDelete == nil {
+		return nil, nil
+	}
+
+	sd := overrides.SoftDelete
+	if sd.BlobRetentionDays == 0 && sd.ContainerRetentionDays == 0 {
+		return nil, fmt.Errorf("invalid Azure soft delete: at least one of blobRetentionDays and containerRetentionDays must be set")
+	}
+	for name, days := range map[string]int32{
+		"blobRetentionDays":      sd.BlobRetentionDays,
+		"containerRetentionDays": sd.ContainerRetentionDays,
+	} {
+		if days < 0 || days > 365 {
+			return nil, fmt.Errorf("invalid Azure soft delete: %s must be between 1 and 365, got %d", name, days)
+		}
+	}
+	return sd, nil
+}
+
+// retentionPolicyDrift returns how policy differs from retaining the deleted
+// items for days, or an empty string if it does not.
+func retentionPolicyDrift(kind string, policy *storage.DeleteRetentionPolicy, days int32) string {
+	if days == 0 {
+		return ""
+	}
+	if policy == nil || policy.Enabled == nil || !*policy.Enabled {
+		return fmt.Sprintf("%s soft delete is disabled", kind)
+	}
+	if policy.Days == nil || *policy.Days != days {
+		current := "unset"
+		if policy.Days != nil {
+			current = fmt.Sprintf("%d", *policy.Days)
+		}
+		return fmt.Sprintf("deleted %ss are retained for %s days instead of %d", kind, current, days)
+	}
+	return ""
+}
+
+// softDeleteDrift returns the differences between the soft delete settings
+// of the blob service and the expected ones.
+func softDeleteDrift(props *storage.BlobServicePropertiesProperties, sd *SoftDelete) []string {
+	if props == nil {
+		props = &storage.BlobServicePropertiesProperties{}
+	}
+	var drift []string
+	if d := retentionPolicyDrift("blob", props.DeleteRetentionPolicy, sd.BlobRetentionDays); d != "" {
+		drift = append(drift, d)
+	}
+	if d := retentionPolicyDrift("container", props.ContainerDeleteRetentionPolicy, sd.ContainerRetentionDays); d != "" {
+		drift = append(drift, d)
+	}
+	return drift
+}
+
+// syncSoftDelete sets the retention of the deleted blobs and containers of
+// the storage account to the one set in the unsupported config overrides,
+// and puts it back when it drifts. The settings of accounts not managed by
+// the operator are only compared. Soft delete is left as it is when the
+// setting is removed.
+func (d *driver) syncSoftDelete(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	sd, err := getSoftDelete(cr)
+	if err != nil {
+		util.UpdateCondition(cr, softDeleteCondition, operatorapiv1.ConditionFalse, "InvalidConfiguration", err.Error())
+		return err
+	}
+	if sd == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, softDeleteCondition)
+		return nil
+	}
+	if strings.EqualFold(d.Config.CloudName, "AZURESTACKCLOUD") {
+		util.UpdateCondition(cr, softDeleteCondition, operatorapiv1.ConditionFalse, "NotSupported",
+			"Soft delete is not supported on Azure Stack Hub")
+		return nil
+	}
+
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	client := storage.NewBlobServicesClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	client.Client = storageAccountsClient.Client
+
+	props, err := client.GetServiceProperties(d.Context, cfg.ResourceGroup, d.Config.AccountName)
+	if err != nil {
+		return fmt.Errorf("unable to get the blob service properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+
+	drift := softDeleteDrift(props.BlobServicePropertiesProperties, sd)
+	if len(drift) == 0 {
+		util.UpdateCondition(cr, softDeleteCondition, operatorapiv1.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The deleted blobs and containers of the storage account %s are retained as configured", d.Config.AccountName))
+		return nil
+	}
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		util.UpdateCondition(cr, softDeleteCondition, operatorapiv1.ConditionFalse, "NotManaged",
+			fmt.Sprintf("The soft delete settings of the storage account %s, not managed by the operator, differ from the configured ones: %s", d.Config.AccountName, strings.Join(drift, ", ")))
+		return nil
+	}
+
+	// the other properties of the blob service are sent back as they are.
+	expected := storage.BlobServiceProperties{
+		BlobServicePropertiesProperties: props.BlobServicePropertiesProperties,
+	}
+	if expected.BlobServicePropertiesProperties == nil {
+		expected.BlobServicePropertiesProperties = &storage.BlobServicePropertiesProperties{}
+	}
+	if sd.BlobRetentionDays != 0 {
+		expected.DeleteRetentionPolicy = &storage.DeleteRetentionPolicy{
+			Enabled: to.BoolPtr(true),
+			Days:    to.Int32Ptr(sd.BlobRetentionDays),
+		}
+	}
+	if sd.ContainerRetentionDays != 0 {
+		expected.ContainerDeleteRetentionPolicy = &storage.DeleteRetentionPolicy{
+			Enabled: to.BoolPtr(true),
+			Days:    to.Int32Ptr(sd.ContainerRetentionDays),
+		}
+	}
+	if _, err := client.SetServiceProperties(d.Context, cfg.ResourceGroup, d.Config.AccountName, expected); err != nil {
+		util.UpdateCondition(cr, softDeleteCondition, operatorapiv1.ConditionFalse, "UpdateFailed",
+			fmt.Sprintf("Unable to update the soft delete settings of the storage account %s: %s", d.Config.AccountName, err))
+		return err
+	}
+	klog.Infof("the soft delete settings of the storage account %s have been updated: %s", d.Config.AccountName, strings.Join(drift, ", "))
+	util.UpdateCondition(cr, softDeleteCondition, operatorapiv1.ConditionTrue, "DriftCorrected",
+		fmt.Sprintf("The deleted blobs and containers of the storage account %s are retained as configured, the settings had to be updated: %s", d.Config.AccountName, strings.Join(drift, ", ")))
+	return nil
+}
@@ -0,0 +1,221 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestGetSoftDelete(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		expected  *SoftDelete
+		err       bool
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:      "not set",
+			overrides: `{"storage":{"azure":{}}}`,
+		},
+		{
+			name:      "blobs only",
+			overrides: `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7}}}}`,
+			expected:  &SoftDelete{BlobRetentionDays: 7},
+		},
+		{
+			name:      "blobs and containers",
+			overrides: `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7,"containerRetentionDays":14}}}}`,
+			expected:  &SoftDelete{BlobRetentionDays: 7, ContainerRetentionDays: 14},
+		},
+		{
+			name:      "empty",
+			overrides: `{"storage":{"azure":{"softDelete":{}}}}`,
+			err:       true,
+		},
+		{
+			name:      "too long",
+			overrides: `{"storage":{"azure":{"softDelete":{"containerRetentionDays":366}}}}`,
+			err:       true,
+		},
+		{
+			name:      "negative",
+			overrides: `{"storage":{"azure":{"softDelete":{"blobRetentionDays":-1}}}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			sd, err := getSoftDelete(cr)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error: %t", err, tt.err)
+			}
+			if tt.expected == nil {
+				if sd != nil {
+					t.Errorf("got %#v, want nil", sd)
+				}
+				return
+			}
+			if sd == nil || *sd != *tt.expected {
+				t.Errorf("got %#v, want %#v", sd, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSyncSoftDelete(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		overrides  string
+		cloudName  string
+		state      string
+		properties string
+		putStatus  int
+		updated    bool
+		status     operatorapiv1.ConditionStatus
+		reason     string
+		err        bool
+	}{
+		{
+			name:  "not set",
+			state: imageregistryv1.StorageManagementStateManaged,
+		},
+		{
+			name:       "as expected",
+			overrides:  `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7,"containerRetentionDays":7}}}}`,
+			state:      imageregistryv1.StorageManagementStateManaged,
+			properties: `{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":7},"containerDeleteRetentionPolicy":{"enabled":true,"days":7}}}`,
+			status:     operatorapiv1.ConditionTrue,
+			reason:     "AsExpected",
+		},
+		{
+			name:       "disabled on managed account",
+			overrides:  `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7,"containerRetentionDays":7}}}}`,
+			state:      imageregistryv1.StorageManagementStateManaged,
+			properties: `{"properties":{"isVersioningEnabled":true}}`,
+			updated:    true,
+			status:     operatorapiv1.ConditionTrue,
+			reason:     "DriftCorrected",
+		},
+		{
+			name:       "other retention on managed account",
+			overrides:  `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7}}}}`,
+			state:      imageregistryv1.StorageManagementStateManaged,
+			properties: `{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":1}}}`,
+			updated:    true,
+			status:     operatorapiv1.ConditionTrue,
+			reason:     "DriftCorrected",
+		},
+		{
+			name:       "disabled on unmanaged account",
+			overrides:  `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7}}}}`,
+			state:      imageregistryv1.StorageManagementStateUnmanaged,
+			properties: `{"properties":{}}`,
+			status:     operatorapiv1.ConditionFalse,
+			reason:     "NotManaged",
+		},
+		{
+			name:       "update failed",
+			overrides:  `{"storage":{"azure":{"softDelete":{"containerRetentionDays":7}}}}`,
+			state:      imageregistryv1.StorageManagementStateManaged,
+			properties: `{"properties":{}}`,
+			putStatus:  http.StatusForbidden,
+			updated:    true,
+			status:     operatorapiv1.ConditionFalse,
+			reason:     "UpdateFailed",
+			err:        true,
+		},
+		{
+			name:      "azure stack hub",
+			overrides: `{"storage":{"azure":{"softDelete":{"blobRetentionDays":7}}}}`,
+			cloudName: "AzureStackCloud",
+			state:     imageregistryv1.StorageManagementStateManaged,
+			status:    operatorapiv1.ConditionFalse,
+			reason:    "NotSupported",
+		},
+		{
+			name:      "invalid",
+			overrides: `{"storage":{"azure":{"softDelete":{}}}}`,
+			state:     imageregistryv1.StorageManagementStateManaged,
+			status:    operatorapiv1.ConditionFalse,
+			reason:    "InvalidConfiguration",
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+			if tt.properties != "" {
+				sender.AddResponse(http.StatusOK, tt.properties)
+			}
+			if tt.putStatus != 0 {
+				sender.AddResponse(tt.putStatus, `{}`)
+			}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account", CloudName: tt.cloudName}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.state
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			cfg := &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncSoftDelete(cr, cfg, environment); (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error: %t", err, tt.err)
+			}
+
+			var updated bool
+			for _, req := range sender.Requests() {
+				if req.Method != http.MethodPut {
+					continue
+				}
+				updated = true
+				var body storage.BlobServiceProperties
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.BlobServicePropertiesProperties == nil {
+					t.Fatalf("got no blob service properties in %s", req.Body)
+				}
+				if tt.name == "disabled on managed account" {
+					if v := body.IsVersioningEnabled; v == nil || !*v {
+						t.Errorf("got isVersioningEnabled %v, want the other properties to be kept", v)
+					}
+					if p := body.ContainerDeleteRetentionPolicy; p == nil || p.Days == nil || *p.Days != 7 {
+						t.Errorf("got container retention policy %#v, want 7 days", p)
+					}
+				}
+				if p := body.DeleteRetentionPolicy; tt.name == "other retention on managed account" && (p == nil || p.Days == nil || *p.Days != 7) {
+					t.Errorf("got blob retention policy %#v, want 7 days", p)
+				}
+			}
+			if updated != tt.updated {
+				t.Errorf("got updated %t, want %t", updated, tt.updated)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, softDeleteCondition)
+			if tt.reason == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.status, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageTagsCondition reports whether the storage account carries the tags
+// of the cluster.
+const storageTagsCondition = "AzureStorageTags"
+
+// accountTags returns the tags of the storage accounts managed by the
+// operator: the cluster ownership tag along with the user defined tags from
+// the cluster configuration.
+func accountTags(infra *configv1.Infrastructure) map[string]*string {
+	tagset := map[string]*string{
+		clusterTagPrefix + infra.Status.InfrastructureName: to.StringPtr("owned"),
+	}
+
+	hasAzureStatus := infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Azure != nil && infra.Status.PlatformStatus.Azure.ResourceTags != nil
+	if hasAzureStatus {
+		klog.V(5).Infof("user has provided %d tags", len(infra.Status.PlatformStatus.Azure.ResourceTags))
+		for _, tag := range infra.Status.PlatformStatus.Azure.ResourceTags {
+			klog.V(5).Infof("user has provided storage account tag: %s: %s", tag.Key, tag.Value)
+			tagset[tag.Key] = to.StringPtr(tag.Value)
+		}
+	}
+	return tagset
+}
+
+// tagsSyncEnabled returns true if storage.azure.syncTags is set in the
+// unsupported config overrides.
+func tagsSyncEnabled(cr *imageregistryv1.Config) (bool, error) {
+	overrides, err := getOverrides(cr)
+	if err != nil {
+		return false, err
+	}
+	return overrides != nil && overrides.SyncTags, nil
+}
+
+// tagAuditInterval is how often the tags of the storage account are audited
+// when they are not kept in sync.
+const tagAuditInterval = time.Hour
+
+// tagAudit records when the tags of the storage account were last audited.
+var tagAudit auditedAccount
+
+// auditedAccount holds in memory when a storage account was last audited, so
+// the audit does not read the account properties on every sync.
+type auditedAccount struct {
+	mtx           sync.Mutex
+	resourceGroup string
+	account       string
+	next          time.Time
+}
+
+// due returns true if the account was not audited in the last interval.
+func (a *auditedAccount) due(resourceGroup, account string) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.resourceGroup != resourceGroup || a.account != account || !time.Now().Before(a.next)
+}
+
+// done records the account has just been audited.
+func (a *auditedAccount) done(resourceGroup, account string, interval time.Duration) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.resourceGroup = resourceGroup
+	a.account = account
+	a.next = time.Now().Add(interval)
+}
+
+// driftedTags returns the keys of the expected tags that are missing from
+// tags or set to another value.
+func driftedTags(tags, expected map[string]*string) []string {
+	var drifted []string
+	for k, v := range expected {
+		if current, ok := tags[k]; !ok || current == nil || *current != *v {
+			drifted = append(drifted, k)
+		}
+	}
+	sort.Strings(drifted)
+	return drifted
+}
+
+// syncTags adds the tags of the cluster missing from the storage account, or
+// set to another value, when it is requested in the unsupported config
+// overrides. Tags are only set at creation otherwise, and audited
+// periodically so drift is reported. Other tags of the account are kept,
+// including the ones removed from the cluster configuration. Accounts not
+// managed by the operator are left untouched.
+func (d *driver) syncTags(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	enabled, err := tagsSyncEnabled(cr)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return d.auditTags(cr, cfg, environment)
+	}
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		util.UpdateCondition(cr, storageTagsCondition, operatorapiv1.ConditionFalse, "NotManaged",
+			fmt.Sprintf("The storage account %s is not managed by the operator, its tags are not reconciled", d.Config.AccountName))
+		return nil
+	}
+
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return err
+	}
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	account, err := storageAccountsClient.GetProperties(d.Context, cfg.ResourceGroup, d.Config.AccountName, "")
+	if err != nil {
+		return fmt.Errorf("unable to get the properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+
+	expected := accountTags(infra)
+	changed := driftedTags(account.Tags, expected)
+	if len(changed) == 0 {
+		util.UpdateCondition(cr, storageTagsCondition, operatorapiv1.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The storage account %s carries the tags of the cluster", d.Config.AccountName))
+		return nil
+	}
+
+	tags := map[string]*string{}
+	for k, v := range account.Tags {
+		tags[k] = v
+	}
+	for _, k := range changed {
+		tags[k] = expected[k]
+	}
+	_, err = storageAccountsClient.Update(d.Context, cfg.ResourceGroup, d.Config.AccountName, storage.AccountUpdateParameters{
+		Tags: tags,
+	})
+	if err != nil {
+		util.UpdateCondition(cr, storageTagsCondition, operatorapiv1.ConditionFalse, "UpdateFailed",
+			fmt.Sprintf("Unable to set the tags %s on the storage account %s: %s", strings.Join(changed, ", "), d.Config.AccountName, err))
+		return err
+	}
+	klog.Infof("the tags %s of the storage account %s have been updated", strings.Join(changed, ", "), d.Config.AccountName)
+	util.UpdateCondition(cr, storageTagsCondition, operatorapiv1.ConditionTrue, "DriftCorrected",
+		fmt.Sprintf("The storage account %s carries the tags of the cluster, %s had to be updated", d.Config.AccountName, strings.Join(changed, ", ")))
+	return nil
+}
+
+// auditTags reports the tags of the cluster missing from the storage
+// account, or set to another value, without changing them. The audit runs
+// once per tagAuditInterval, the condition is kept in between.
+func (d *driver) auditTags(cr *imageregistryv1.Config, cfg *Azure, environment autorestazure.Environment) error {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, storageTagsCondition)
+		return nil
+	}
+	if !tagAudit.due(cfg.ResourceGroup, d.Config.AccountName) {
+		return nil
+	}
+
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return err
+	}
+	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+	account, err := storageAccountsClient.GetProperties(d.Context, cfg.ResourceGroup, d.Config.AccountName, "")
+	if err != nil {
+		return fmt.Errorf("unable to get the properties of the storage account %s: %w", d.Config.AccountName, err)
+	}
+	tagAudit.done(cfg.ResourceGroup, d.Config.AccountName, tagAuditInterval)
+
+	drifted := driftedTags(account.Tags, accountTags(infra))
+	if len(drifted) == 0 {
+		util.UpdateCondition(cr, storageTagsCondition, operatorapiv1.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The storage account %s carries the tags of the cluster", d.Config.AccountName))
+		return nil
+	}
+	util.UpdateCondition(cr, storageTagsCondition, operatorapiv1.ConditionFalse, "Drifted",
+		fmt.Sprintf("The tags %s of the storage account %s do not match the cluster configuration, set storage.azure.syncTags in the unsupported config overrides to correct them", strings.Join(drifted, ", "), d.Config.AccountName))
+	return nil
+}
@@ -0,0 +1,196 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestSyncTags(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "cluster-abcde",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceTags: []configv1.AzureResourceTag{
+						{Key: "cost-center", Value: "registry"},
+					},
+				},
+			},
+		},
+	})
+	listers := builder.BuildListers()
+
+	const syncTags = `{"storage":{"azure":{"syncTags":true}}}`
+
+	for _, tt := range []struct {
+		name           string
+		overrides      string
+		state          string
+		tags           string
+		expectedTags   map[string]string
+		expectedStatus operatorapiv1.ConditionStatus
+		expectedReason string
+		expectedCalls  int
+	}{
+		{
+			name:  "not requested, unmanaged account",
+			state: imageregistryv1.StorageManagementStateUnmanaged,
+		},
+		{
+			name:           "not requested, audited",
+			state:          imageregistryv1.StorageManagementStateManaged,
+			tags:           `{"kubernetes.io_cluster.cluster-abcde":"owned","cost-center":"registry"}`,
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: "AsExpected",
+			expectedCalls:  1,
+		},
+		{
+			name:           "not requested, drift audited",
+			state:          imageregistryv1.StorageManagementStateManaged,
+			tags:           `{"kubernetes.io_cluster.cluster-abcde":"owned"}`,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "Drifted",
+			expectedCalls:  1,
+		},
+		{
+			name:           "unmanaged account",
+			overrides:      syncTags,
+			state:          imageregistryv1.StorageManagementStateUnmanaged,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "NotManaged",
+			expectedCalls:  0,
+		},
+		{
+			name:           "in sync",
+			overrides:      syncTags,
+			state:          imageregistryv1.StorageManagementStateManaged,
+			tags:           `{"kubernetes.io_cluster.cluster-abcde":"owned","cost-center":"registry","team":"infra"}`,
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: "AsExpected",
+			expectedCalls:  1,
+		},
+		{
+			name:      "drift",
+			overrides: syncTags,
+			state:     imageregistryv1.StorageManagementStateManaged,
+			tags:      `{"kubernetes.io_cluster.cluster-abcde":"owned","cost-center":"other","team":"infra"}`,
+			expectedTags: map[string]string{
+				"kubernetes.io_cluster.cluster-abcde": "owned",
+				"cost-center":                         "registry",
+				"team":                                "infra",
+			},
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: "DriftCorrected",
+			expectedCalls:  2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tagAudit.done("", "", 0)
+			sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{}`}}
+			sender.AddJSONResponse(http.StatusOK, `{"tags":`+tt.tags+`}`)
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = tt.state
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, &listers.StorageListers)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = sender
+
+			environment, _ := getEnvironmentByName("")
+			if err := drv.syncTags(cr, &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}, environment); err != nil {
+				t.Fatal(err)
+			}
+
+			reqs := sender.Requests()
+			if len(reqs) != tt.expectedCalls {
+				t.Fatalf("got %d requests, want %d", len(reqs), tt.expectedCalls)
+			}
+			if tt.expectedTags != nil {
+				req := reqs[1]
+				if req.Method != http.MethodPatch {
+					t.Fatalf("got method %s, want %s", req.Method, http.MethodPatch)
+				}
+				var body struct {
+					Tags map[string]string `json:"tags"`
+				}
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				if len(body.Tags) != len(tt.expectedTags) {
+					t.Errorf("got tags %v, want %v", body.Tags, tt.expectedTags)
+				}
+				for k, v := range tt.expectedTags {
+					if body.Tags[k] != v {
+						t.Errorf("got tags %v, want %v", body.Tags, tt.expectedTags)
+						break
+					}
+				}
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageTagsCondition)
+			if tt.expectedStatus == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.expectedStatus, tt.expectedReason)
+			}
+		})
+	}
+}
+
+func TestAuditTagsInterval(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "cluster-abcde",
+		},
+	})
+	listers := builder.BuildListers()
+
+	tagAudit.done("", "", 0)
+	sender := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: `{"tags":{}}`}}
+	drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{AccountName: "account"}, &listers.StorageListers)
+	drv.authorizer = autorest.NullAuthorizer{}
+	drv.sender = sender
+
+	cr := &imageregistryv1.Config{}
+	cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+	environment, _ := getEnvironmentByName("")
+	cfg := &Azure{SubscriptionID: "subscription_id", ResourceGroup: "resource_group"}
+	for i := 0; i < 2; i++ {
+		if err := drv.syncTags(cr, cfg, environment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reqs := sender.Requests(); len(reqs) != 1 {
+		t.Errorf("got %d requests, want the tags to be audited once per interval", len(reqs))
+	}
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageTagsCondition)
+	if cond == nil || cond.Reason != "Drifted" || !strings.Contains(cond.Message, "kubernetes.io_cluster.cluster-abcde") {
+		t.Errorf("got condition %#v, want the missing ownership tag to be reported", cond)
+	}
+}
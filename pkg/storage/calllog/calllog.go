@@ -0,0 +1,89 @@
+// Package calllog keeps the last calls made by the operator to the cloud
+// APIs in memory, so throttling and permission issues can be investigated
+// without enabling debug logging. The calls are served as JSON by the
+// operator metrics server.
+package calllog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of calls kept by the default log.
+const DefaultSize = 256
+
+// Call is a call made to a cloud API.
+type Call struct {
+	Time time.Time `json:"time"`
+	// Provider is the cloud the call was made to, e.g. S3 or Azure.
+	Provider string `json:"provider"`
+	// Operation is the API operation, or the method and the path of the
+	// request when the SDK does not name operations. Query strings are
+	// never recorded as they can hold credentials.
+	Operation string        `json:"operation"`
+	Duration  time.Duration `json:"duration"`
+	// Status is the HTTP status code of the response, zero if none was
+	// received.
+	Status  int    `json:"status"`
+	Retries int    `json:"retries,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Log is a rolling buffer of calls.
+type Log struct {
+	mu    sync.Mutex
+	calls []Call
+	next  int
+	full  bool
+}
+
+// NewLog returns a log keeping the last size calls.
+func NewLog(size int) *Log {
+	return &Log{calls: make([]Call, size)}
+}
+
+// Record adds c to the log, replacing the oldest call if the log is full.
+func (l *Log) Record(c Call) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.calls) == 0 {
+		return
+	}
+	l.calls[l.next] = c
+	l.next = (l.next + 1) % len(l.calls)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Calls returns the calls held by the log, oldest first.
+func (l *Log) Calls() []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]Call{}, l.calls[:l.next]...)
+	}
+	return append(append([]Call{}, l.calls[l.next:]...), l.calls[:l.next]...)
+}
+
+// ServeHTTP writes the calls as a JSON array.
+func (l *Log) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l.Calls()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var defaultLog = NewLog(DefaultSize)
+
+// Default returns the log the storage drivers record their calls in.
+func Default() *Log {
+	return defaultLog
+}
+
+// Record adds c to the default log.
+func Record(c Call) {
+	defaultLog.Record(c)
+}
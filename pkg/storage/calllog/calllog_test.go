@@ -0,0 +1,59 @@
+package calllog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestLog(t *testing.T) {
+	l := NewLog(3)
+	if calls := l.Calls(); len(calls) != 0 {
+		t.Fatalf("got %d calls, want none", len(calls))
+	}
+
+	for i := 0; i < 5; i++ {
+		l.Record(Call{Operation: fmt.Sprintf("op%d", i)})
+	}
+	calls := l.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+	for i, c := range calls {
+		if want := fmt.Sprintf("op%d", i+2); c.Operation != want {
+			t.Errorf("got call %d %s, want %s", i, c.Operation, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cloud-api-calls", nil))
+	var served []Call
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 3 {
+		t.Errorf("got %d served calls, want 3", len(served))
+	}
+}
+
+func TestTransport(t *testing.T) {
+	rt := &httpmock.Transport{}
+	rt.AddResponse(http.StatusTooManyRequests, "")
+
+	client := &http.Client{Transport: &Transport{Provider: "GCS", Base: rt}}
+	resp, err := client.Get("https://storage.example.com/b/bucket?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	calls := Default().Calls()
+	last := calls[len(calls)-1]
+	if last.Provider != "GCS" || last.Operation != "GET /b/bucket" || last.Status != http.StatusTooManyRequests {
+		t.Errorf("got %+v, want the throttled GCS call without its query", last)
+	}
+}
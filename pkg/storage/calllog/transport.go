@@ -0,0 +1,56 @@
+package calllog
+
+import (
+	"net/http"
+	"time"
+)
+
+// Transport records in the default log the requests sent through Base.
+type Transport struct {
+	Provider string
+	Base     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	record(t.Provider, req, resp, err, start)
+	return resp, err
+}
+
+// Doer sends HTTP requests, it is the interface of the Azure autorest
+// senders.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Sender records in the default log the requests sent through Base.
+type Sender struct {
+	Provider string
+	Base     Doer
+}
+
+// Do implements Doer.
+func (s *Sender) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := s.Base.Do(req)
+	record(s.Provider, req, resp, err, start)
+	return resp, err
+}
+
+func record(provider string, req *http.Request, resp *http.Response, err error, start time.Time) {
+	c := Call{
+		Time:      start.UTC(),
+		Provider:  provider,
+		Operation: req.Method + " " + req.URL.Path,
+		Duration:  time.Since(start),
+	}
+	if resp != nil {
+		c.Status = resp.StatusCode
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	Record(c)
+}
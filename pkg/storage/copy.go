@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// blobDataRegexp matches the keys of the blob data files of the registry.
+// Their key is the digest of their content.
+var blobDataRegexp = regexp.MustCompile(`(^|/)docker/registry/v2/blobs/[^/]+/[0-9a-f]{2}/[0-9a-f]+/data$`)
+
+// contentAddressed returns true if the content of the object key is
+// identified by its key, i.e. two objects with this key and the same size
+// hold the same content.
+func contentAddressed(key string) bool {
+	return blobDataRegexp.MatchString(key)
+}
+
+// CopyResult accounts the objects processed by CopyObjects.
+type CopyResult struct {
+	// Objects and Bytes account the objects copied.
+	Objects int64
+	Bytes   int64
+	// Skipped is the number of blobs already present in the target.
+	Skipped int64
+	// Deleted is the number of objects removed from the target as they
+	// are not in the source.
+	Deleted int64
+}
+
+// errNotEmpty stops the walk of a storage as soon as an object is found.
+var errNotEmpty = errors.New("storage not empty")
+
+// Empty returns true if store holds no object.
+func Empty(ctx context.Context, store ObjectStore) (bool, error) {
+	err := store.WalkObjects(ctx, func(key string, size int64) error {
+		return errNotEmpty
+	})
+	if err == errNotEmpty {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CopyObjects makes dst a copy of src. The blob data already present in dst
+// with the same size is skipped, so an interrupted copy resumes where it
+// stopped without copying the bulk of the content again. The other objects,
+// e.g. the link files of the tags, always have the same size and are copied
+// every time, and the objects of dst not found in src are deleted, so dst
+// must not hold anything but an earlier copy of src. The registry has to be
+// read-only while the copy runs for the result to be consistent.
+func CopyObjects(ctx context.Context, src, dst ObjectStore) (CopyResult, error) {
+	var result CopyResult
+
+	stale := map[string]int64{}
+	err := dst.WalkObjects(ctx, func(key string, size int64) error {
+		stale[key] = size
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("unable to list the objects of the target storage: %w", err)
+	}
+
+	err = src.WalkObjects(ctx, func(key string, size int64) error {
+		s, ok := stale[key]
+		delete(stale, key)
+		if ok && s == size && contentAddressed(key) {
+			result.Skipped++
+			return nil
+		}
+
+		r, err := src.ReadObject(ctx, key)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", key, err)
+		}
+		defer r.Close()
+
+		if err := dst.WriteObject(ctx, key, r, size); err != nil {
+			return fmt.Errorf("unable to write %s: %w", key, err)
+		}
+		result.Objects++
+		result.Bytes += size
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("unable to copy the objects of the source storage: %w", err)
+	}
+
+	for key := range stale {
+		if err := dst.DeleteObject(ctx, key); err != nil {
+			return result, fmt.Errorf("unable to delete %s from the target storage: %w", key, err)
+		}
+		result.Deleted++
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+)
+
+type memoryObjectStore struct {
+	objects map[string][]byte
+	failOn  string
+}
+
+func (s *memoryObjectStore) WalkObjects(ctx context.Context, fn func(key string, size int64) error) error {
+	var keys []string
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, int64(len(s.objects[key]))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryObjectStore) ReadObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.objects[key])), nil
+}
+
+func (s *memoryObjectStore) WriteObject(ctx context.Context, key string, r io.Reader, size int64) error {
+	if key == s.failOn {
+		return fmt.Errorf("write failed")
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryObjectStore) DeleteObject(ctx context.Context, key string) error {
+	delete(s.objects, key)
+	return nil
+}
+
+func TestCopyObjects(t *testing.T) {
+	const (
+		layer  = "docker/registry/v2/blobs/sha256/aa/aa01/data"
+		config = "docker/registry/v2/blobs/sha256/bb/bb01/data"
+		tag    = "docker/registry/v2/repositories/ns/is/_manifests/tags/latest/current/link"
+		stale  = "docker/registry/v2/repositories/ns/is/_manifests/tags/old/current/link"
+	)
+	src := &memoryObjectStore{objects: map[string][]byte{
+		layer:  []byte("layer"),
+		config: []byte("config"),
+		tag:    []byte("sha256:aa01"),
+	}}
+	dst := &memoryObjectStore{
+		objects: map[string][]byte{
+			layer: []byte("layer"),
+			// a link of the same length left by an earlier run.
+			tag:   []byte("sha256:ff01"),
+			stale: []byte("sha256:ff01"),
+		},
+		failOn: config,
+	}
+
+	if _, err := CopyObjects(context.Background(), src, dst); err == nil {
+		t.Fatal("expected the copy to fail")
+	}
+
+	dst.failOn = ""
+	result, err := CopyObjects(context.Background(), src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CopyResult{Objects: 2, Bytes: int64(len("config") + len("sha256:aa01")), Skipped: 1, Deleted: 1}
+	if result != expected {
+		t.Errorf("got %+v, want %+v", result, expected)
+	}
+	if len(dst.objects) != len(src.objects) {
+		t.Errorf("got objects %v in the target, want the ones of the source", dst.objects)
+	}
+	for key, data := range src.objects {
+		if !bytes.Equal(dst.objects[key], data) {
+			t.Errorf("got %s = %q, want %q", key, dst.objects[key], data)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	store := &memoryObjectStore{objects: map[string][]byte{}}
+	if empty, err := Empty(context.Background(), store); err != nil || !empty {
+		t.Errorf("got %t, %v, want an empty storage", empty, err)
+	}
+
+	store.objects["docker/registry/v2/blobs/sha256/aa/aa01/data"] = []byte("layer")
+	store.objects["unrelated"] = []byte("data")
+	if empty, err := Empty(context.Background(), store); err != nil || empty {
+		t.Errorf("got %t, %v, want a non-empty storage", empty, err)
+	}
+}
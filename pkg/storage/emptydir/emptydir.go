@@ -96,3 +96,9 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 func (d *driver) ID() string {
 	return ""
 }
+
+// Capabilities returns what an emptyDir volume supports. Every registry pod
+// has its own volume, the pods cannot share it.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{}
+}
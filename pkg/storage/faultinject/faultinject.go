@@ -0,0 +1,270 @@
+// Package faultinject injects faults in the requests the storage drivers
+// send to the cloud APIs, so e2e tests can exercise the Degraded and
+// recovery paths of the operator without a real cloud outage.
+//
+// It is only meant for tests and is disabled unless the
+// STORAGE_FAULT_INJECTION environment variable of the operator holds the
+// faults to inject as a JSON array, for instance:
+//
+//	[{"provider":"S3","operation":"^PUT /","type":"throttle","count":10},
+//	 {"provider":"Azure","type":"latency","latency":"20s"}]
+//
+// The faults are injected below the call log, the calls are recorded as the
+// SDKs saw them.
+package faultinject
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// EnvVar is the environment variable holding the faults to inject.
+const EnvVar = "STORAGE_FAULT_INJECTION"
+
+// Fault types.
+const (
+	// Throttle replies with 429 Too Many Requests.
+	Throttle = "throttle"
+	// Error replies with 503 Service Unavailable.
+	Error = "error"
+	// Latency delays the request before it is sent.
+	Latency = "latency"
+)
+
+const defaultLatency = 5 * time.Second
+
+// Fault is a fault injected in the requests matching it.
+type Fault struct {
+	// Provider is the cloud the fault is injected in: S3, GCS, Azure,
+	// IBMCOS, Swift or OSS. All of them if empty.
+	Provider string `json:"provider,omitempty"`
+	// Operation is a regular expression matched against the method and
+	// the path of the requests, e.g. "^DELETE /". All requests match if
+	// it is empty.
+	Operation string `json:"operation,omitempty"`
+	// Type is throttle, error or latency.
+	Type string `json:"type"`
+	// StatusCode replaces the status code of throttle and error faults.
+	StatusCode int `json:"statusCode,omitempty"`
+	// Latency is the delay of latency faults, 5s if empty.
+	Latency string `json:"latency,omitempty"`
+	// Count is the number of requests the fault is injected in, every
+	// matching request if zero. The cloud recovers once they are used up.
+	Count int `json:"count,omitempty"`
+
+	operation *regexp.Regexp
+	latency   time.Duration
+}
+
+// Injector injects faults in the requests matching them.
+type Injector struct {
+	mu     sync.Mutex
+	faults []*Fault
+}
+
+// New returns an injector for faults, it validates them.
+func New(faults []Fault) (*Injector, error) {
+	inj := &Injector{}
+	for i := range faults {
+		f := faults[i]
+		switch f.Type {
+		case Throttle, Error, Latency:
+		default:
+			return nil, fmt.Errorf("fault %d: unknown type %q, expected %s, %s or %s", i, f.Type, Throttle, Error, Latency)
+		}
+		if f.Operation != "" {
+			re, err := regexp.Compile(f.Operation)
+			if err != nil {
+				return nil, fmt.Errorf("fault %d: invalid operation: %w", i, err)
+			}
+			f.operation = re
+		}
+		f.latency = defaultLatency
+		if f.Latency != "" {
+			d, err := time.ParseDuration(f.Latency)
+			if err != nil {
+				return nil, fmt.Errorf("fault %d: invalid latency: %w", i, err)
+			}
+			f.latency = d
+		}
+		if f.Count < 0 {
+			return nil, fmt.Errorf("fault %d: count cannot be negative", i)
+		}
+		inj.faults = append(inj.faults, &f)
+	}
+	return inj, nil
+}
+
+// match returns the first fault matching the request and counts it, or nil
+// if there is none.
+func (inj *Injector) match(provider string, req *http.Request) *Fault {
+	operation := req.Method + " " + req.URL.Path
+
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	for i, f := range inj.faults {
+		if f.Provider != "" && !strings.EqualFold(f.Provider, provider) {
+			continue
+		}
+		if f.operation != nil && !f.operation.MatchString(operation) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				inj.faults = append(inj.faults[:i:i], inj.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// do sends req with send, unless a fault replaces the response.
+func (inj *Injector) do(provider string, req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	f := inj.match(provider, req)
+	if f == nil {
+		return send(req)
+	}
+	klog.V(2).Infof("injecting a %s fault in %s %s %s", f.Type, provider, req.Method, req.URL.Path)
+
+	switch f.Type {
+	case Latency:
+		if err := sleep(req.Context(), f.latency); err != nil {
+			return nil, err
+		}
+		return send(req)
+	case Throttle:
+		return response(req, f.statusCode(http.StatusTooManyRequests)), nil
+	default:
+		return response(req, f.statusCode(http.StatusServiceUnavailable)), nil
+	}
+}
+
+func (f *Fault) statusCode(def int) int {
+	if f.StatusCode != 0 {
+		return f.StatusCode
+	}
+	return def
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func response(req *http.Request, code int) *http.Response {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	header := http.Header{}
+	if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+		header.Set("Retry-After", "1")
+	}
+	body := fmt.Sprintf("fault injected by %s", EnvVar)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// Transport injects faults in the requests sent through Base.
+type Transport struct {
+	Provider string
+	Base     http.RoundTripper
+	Injector *Injector
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Injector.do(t.Provider, req, t.Base.RoundTrip)
+}
+
+// Doer sends HTTP requests, it is the interface of the Azure autorest
+// senders.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Sender injects faults in the requests sent through Base.
+type Sender struct {
+	Provider string
+	Base     Doer
+	Injector *Injector
+}
+
+// Do implements Doer.
+func (s *Sender) Do(req *http.Request) (*http.Response, error) {
+	return s.Injector.do(s.Provider, req, s.Base.Do)
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultInjector *Injector
+)
+
+// Default returns the injector for the faults set in the environment, or nil
+// if fault injection is disabled.
+func Default() *Injector {
+	defaultOnce.Do(func() {
+		value := os.Getenv(EnvVar)
+		if value == "" {
+			return
+		}
+		var faults []Fault
+		if err := json.Unmarshal([]byte(value), &faults); err != nil {
+			klog.Errorf("fault injection disabled, unable to parse %s: %s", EnvVar, err)
+			return
+		}
+		inj, err := New(faults)
+		if err != nil {
+			klog.Errorf("fault injection disabled, invalid %s: %s", EnvVar, err)
+			return
+		}
+		klog.Warningf("fault injection enabled, %d faults will be injected in the requests to the cloud APIs", len(faults))
+		defaultInjector = inj
+	})
+	return defaultInjector
+}
+
+// Wrap returns base injecting the faults set in the environment in the
+// requests to provider, or base itself if fault injection is disabled.
+func Wrap(provider string, base http.RoundTripper) http.RoundTripper {
+	inj := Default()
+	if inj == nil {
+		return base
+	}
+	return &Transport{Provider: provider, Base: base, Injector: inj}
+}
+
+// WrapSender is Wrap for the Azure autorest senders.
+func WrapSender(provider string, base Doer) Doer {
+	inj := Default()
+	if inj == nil {
+		return base
+	}
+	return &Sender{Provider: provider, Base: base, Injector: inj}
+}
@@ -0,0 +1,87 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		fault Fault
+		err   string
+	}{
+		{fault: Fault{Type: "outage"}, err: `unknown type "outage"`},
+		{fault: Fault{Type: Throttle, Operation: "PUT ("}, err: "invalid operation"},
+		{fault: Fault{Type: Latency, Latency: "soon"}, err: "invalid latency"},
+		{fault: Fault{Type: Error, Count: -1}, err: "count cannot be negative"},
+	} {
+		if _, err := New([]Fault{tt.fault}); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%+v: got error %v, want %q", tt.fault, err, tt.err)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	inj, err := New([]Fault{
+		{Provider: "GCS", Type: Throttle},
+		{Provider: "S3", Operation: "^PUT /", Type: Error, Count: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK}}
+	client := &http.Client{Transport: &Transport{Provider: "S3", Base: rt, Injector: inj}}
+
+	var codes []int
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPut, http.MethodPut} {
+		req, err := http.NewRequest(method, "https://s3.example.com/bucket", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		codes = append(codes, resp.StatusCode)
+	}
+
+	expected := []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}
+	for i := range expected {
+		if codes[i] != expected[i] {
+			t.Fatalf("got status codes %v, want %v", codes, expected)
+		}
+	}
+	if reqs := rt.Requests(); len(reqs) != 2 {
+		t.Errorf("got %d requests sent, want the 2 without a fault", len(reqs))
+	}
+}
+
+func TestSenderLatency(t *testing.T) {
+	inj, err := New([]Fault{{Type: Latency, Latency: "1h"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := &httpmock.Transport{}
+	sender := &Sender{Provider: "Azure", Base: rt.Client(), Injector: inj}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://management.azure.com/subscriptions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want the request to be delayed until it is canceled", err)
+	}
+	if reqs := rt.Requests(); len(reqs) != 0 {
+		t.Errorf("got %d requests sent, want none", len(reqs))
+	}
+}
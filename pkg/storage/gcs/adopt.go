@@ -0,0 +1,153 @@
+package gcs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// labelInvalidCharRe matches the characters GCS label keys cannot contain.
+var labelInvalidCharRe = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// clusterLabelPrefix prefixes the key of the cluster label, it is followed
+// by the infrastructure name.
+const clusterLabelPrefix = "kubernetes-io-cluster-"
+
+// clusterLabelValue is the value of the cluster label on the buckets
+// created by the operator.
+const clusterLabelValue = "owned"
+
+// clusterLabelKey returns the key of the label identifying the cluster
+// owning a bucket, the GCP counterpart of the kubernetes.io/cluster tag.
+func clusterLabelKey(infrastructureName string) string {
+	key := clusterLabelPrefix + labelInvalidCharRe.ReplaceAllString(strings.ToLower(infrastructureName), "-")
+	if len(key) > 63 {
+		key = key[:63]
+	}
+	return key
+}
+
+// clusterLabels returns the labels set on the buckets the operator creates.
+func (d *driver) clusterLabels() (map[string]string, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		clusterLabelKey(infra.Status.InfrastructureName): clusterLabelValue,
+	}, nil
+}
+
+// adoptionEnabled returns true if the user opted in to the adoption of a
+// bucket left behind by a previous installation of the cluster.
+func adoptionEnabled(cr *imageregistryv1.Config) bool {
+	return cr.Annotations[defaults.AdoptStorageAnnotation] == "true"
+}
+
+// ownedByCluster returns true if the bucket carries the cluster label of
+// the current installation of the cluster or of a previous one.
+func ownedByCluster(attrs *gstorage.BucketAttrs, infrastructureName string) bool {
+	current := clusterLabelKey(infrastructureName)
+	for k, v := range attrs.Labels {
+		if v != clusterLabelValue || !strings.HasPrefix(k, clusterLabelPrefix) {
+			continue
+		}
+		if k == current || util.PreviousInstallation(strings.TrimPrefix(current, clusterLabelPrefix), strings.TrimPrefix(k, clusterLabelPrefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// findClusterBuckets returns the names of the buckets of the project
+// carrying the cluster label of the current installation of the cluster or
+// of a previous one.
+func (d *driver) findClusterBuckets(gclient *gstorage.Client) ([]string, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	it := gclient.Buckets(d.Context, d.Config.ProjectID)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the buckets of the project %s: %w", d.Config.ProjectID, err)
+		}
+		if ownedByCluster(attrs, infra.Status.InfrastructureName) {
+			found = append(found, attrs.Name)
+		}
+	}
+	return found, nil
+}
+
+// findClusterBucket returns the name of the bucket left behind by a previous
+// installation of the cluster when the user opted in to its adoption, or an
+// empty string if there is none. Adopting one bucket among several would be
+// a guess, the user has to pick it then. The buckets are reported otherwise,
+// so they do not accumulate unnoticed across installation attempts.
+func (d *driver) findClusterBucket(cr *imageregistryv1.Config, gclient *gstorage.Client) (string, error) {
+	found, err := d.findClusterBuckets(gclient)
+	if err != nil {
+		if adoptionEnabled(cr) {
+			return "", err
+		}
+		klog.Warningf("unable to look for buckets left behind by previous installations: %s", err)
+		return "", nil
+	}
+	sort.Strings(found)
+
+	if !adoptionEnabled(cr) || len(found) == 0 {
+		util.ReportOrphanedStorage(cr, found)
+		return "", nil
+	}
+	if len(found) > 1 {
+		return "", fmt.Errorf("the buckets %s carry the cluster label, set the one to adopt in spec.storage.gcs.bucket", strings.Join(found, ", "))
+	}
+	util.ReportOrphanedStorage(cr, nil)
+	return found[0], nil
+}
+
+// bucketAdoptable returns true if the user opted in to adoption and the
+// existing bucket carries the cluster label. A bucket left behind by a
+// previous installation is labelled as owned by the current one.
+func (d *driver) bucketAdoptable(cr *imageregistryv1.Config, bucket *gstorage.BucketHandle) (bool, error) {
+	if !adoptionEnabled(cr) {
+		return false, nil
+	}
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return false, err
+	}
+	attrs, err := bucket.Attrs(d.Context)
+	if err != nil {
+		return false, err
+	}
+	if !ownedByCluster(attrs, infra.Status.InfrastructureName) {
+		return false, nil
+	}
+
+	key := clusterLabelKey(infra.Status.InfrastructureName)
+	if attrs.Labels[key] != clusterLabelValue {
+		update := gstorage.BucketAttrsToUpdate{}
+		update.SetLabel(key, clusterLabelValue)
+		if _, err := bucket.Update(d.Context, update); err != nil {
+			return false, fmt.Errorf("unable to label the bucket %s as owned by the cluster: %w", attrs.Name, err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,192 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestClusterLabelKey(t *testing.T) {
+	for infra, expected := range map[string]string{
+		"mycluster-x2k4p":       "kubernetes-io-cluster-mycluster-x2k4p",
+		"MyCluster.Prod-x2k4p":  "kubernetes-io-cluster-mycluster-prod-x2k4p",
+		strings.Repeat("a", 60): "kubernetes-io-cluster-" + strings.Repeat("a", 41),
+	} {
+		if got := clusterLabelKey(infra); got != expected {
+			t.Errorf("clusterLabelKey(%q) = %q, want %q", infra, got, expected)
+		}
+	}
+}
+
+func TestCreateStorageAdoption(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "service-account-email",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "mycluster-x2k4p",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	const (
+		labelled   = `{"name":"old-bucket","labels":{"kubernetes-io-cluster-mycluster-x2k4p":"owned"}}`
+		unlabelled = `{"name":"old-bucket"}`
+		previous   = `{"name":"old-bucket","labels":{"kubernetes-io-cluster-mycluster-a1b2c":"owned"}}`
+	)
+
+	for _, tt := range []struct {
+		name             string
+		adopt            bool
+		bucket           string
+		responseBodies   []string
+		expectedBucket   string
+		expectedState    string
+		expectedReason   string
+		expectedCreated  bool
+		expectedOrphaned bool
+	}{
+		{
+			name:           "bucket found in the project",
+			adopt:          true,
+			responseBodies: []string{`{"items":[{"name":"another-bucket"},` + labelled + `]}`, unlabelled, labelled},
+			expectedBucket: "old-bucket",
+			expectedState:  imageregistryv1.StorageManagementStateManaged,
+			expectedReason: "GCS Bucket Adopted",
+		},
+		{
+			name:           "bucket of a previous installation found in the project",
+			adopt:          true,
+			responseBodies: []string{`{"items":[` + previous + `]}`, previous, previous, labelled},
+			expectedBucket: "old-bucket",
+			expectedState:  imageregistryv1.StorageManagementStateManaged,
+			expectedReason: "GCS Bucket Adopted",
+		},
+		{
+			name:             "bucket of a previous installation without opt-in",
+			responseBodies:   []string{`{"items":[` + previous + `]}`, `{}`},
+			expectedState:    imageregistryv1.StorageManagementStateManaged,
+			expectedReason:   "Creation Successful",
+			expectedCreated:  true,
+			expectedOrphaned: true,
+		},
+		{
+			name:            "no bucket found in the project",
+			adopt:           true,
+			responseBodies:  []string{`{"items":[{"name":"another-bucket"}]}`, `{}`},
+			expectedState:   imageregistryv1.StorageManagementStateManaged,
+			expectedReason:  "Creation Successful",
+			expectedCreated: true,
+		},
+		{
+			name:           "labelled bucket set by the user",
+			adopt:          true,
+			bucket:         "old-bucket",
+			responseBodies: []string{labelled, labelled},
+			expectedBucket: "old-bucket",
+			expectedState:  imageregistryv1.StorageManagementStateManaged,
+			expectedReason: "GCS Bucket Adopted",
+		},
+		{
+			name:           "unlabelled bucket set by the user",
+			adopt:          true,
+			bucket:         "old-bucket",
+			responseBodies: []string{unlabelled, unlabelled},
+			expectedBucket: "old-bucket",
+			expectedState:  imageregistryv1.StorageManagementStateUnmanaged,
+			expectedReason: "GCS Bucket Exists",
+		},
+		{
+			name:           "labelled bucket without opt-in",
+			bucket:         "old-bucket",
+			responseBodies: []string{labelled},
+			expectedBucket: "old-bucket",
+			expectedState:  imageregistryv1.StorageManagementStateUnmanaged,
+			expectedReason: "GCS Bucket Exists",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &httpmock.Transport{}
+			for _, body := range tt.responseBodies {
+				rt.AddJSONResponse(http.StatusOK, body)
+			}
+
+			cr := &imageregistryv1.Config{}
+			if tt.adopt {
+				cr.Annotations = map[string]string{defaults.AdoptStorageAnnotation: "true"}
+			}
+			cr.Spec.Storage.GCS = &imageregistryv1.ImageRegistryConfigStorageGCS{
+				Bucket:    tt.bucket,
+				ProjectID: "project-id",
+				Region:    "us-east1",
+			}
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.GCS, &listers.StorageListers)
+			drv.roundTripper = rt
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatal(err)
+			}
+
+			reqs := rt.Requests()
+			if len(reqs) != len(tt.responseBodies) {
+				t.Fatalf("got %d requests, want %d", len(reqs), len(tt.responseBodies))
+			}
+			if tt.expectedCreated {
+				created := reqs[len(reqs)-1]
+				if !strings.Contains(string(created.Body), `"kubernetes-io-cluster-mycluster-x2k4p":"owned"`) {
+					t.Errorf("got bucket creation request %s, want the cluster label", created.Body)
+				}
+			} else if cr.Spec.Storage.GCS.Bucket != tt.expectedBucket {
+				t.Errorf("got bucket %q, want %q", cr.Spec.Storage.GCS.Bucket, tt.expectedBucket)
+			}
+			if cr.Spec.Storage.ManagementState != tt.expectedState {
+				t.Errorf("got management state %q, want %q", cr.Spec.Storage.ManagementState, tt.expectedState)
+			}
+			if cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageExists); cond == nil || cond.Reason != tt.expectedReason {
+				t.Errorf("got condition %#v, want reason %q", cond, tt.expectedReason)
+			}
+			if cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.OrphanedStorage); (cond != nil) != tt.expectedOrphaned {
+				t.Errorf("got condition %#v, want orphaned storage reported %t", cond, tt.expectedOrphaned)
+			}
+		})
+	}
+}
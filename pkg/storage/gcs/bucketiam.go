@@ -0,0 +1,279 @@
+package gcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	gstorage "cloud.google.com/go/storage"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/genproto/googleapis/type/expr"
+
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// bucketIAMCondition reports whether the bucket IAM policy grants access to
+// the bucket to principals other than the registry and the bucket IAM
+// members.
+const bucketIAMCondition = "GCSBucketIAM"
+
+const (
+	// bucketIAMRole is the role granted on the bucket. The registry only
+	// needs to manage the objects, the operator keeps managing the bucket
+	// through the roles it already has.
+	bucketIAMRole = "roles/storage.objectAdmin"
+
+	// bucketIAMConditionTitle is the title of the IAM condition of the
+	// binding set by the operator.
+	bucketIAMConditionTitle = "image-registry-bucket-only"
+)
+
+// impersonatedServiceAccount matches the service account impersonated by
+// workload identity federation credentials.
+var impersonatedServiceAccount = regexp.MustCompile(`/serviceAccounts/([^/:]+):generateAccessToken$`)
+
+// BucketIAM configures the binding the operator sets in the IAM policy of the
+// bucket for the registry.
+type BucketIAM struct {
+	// Manage adds a binding, conditioned on the bucket, granting
+	// roles/storage.objectAdmin to the service account of the registry
+	// and to Members to the IAM policy of the bucket, and enables uniform
+	// bucket-level access so that ACLs no longer grant access. The other
+	// bindings are kept, the principals they grant access to, such as
+	// the owners, editors and viewers of the project, are only reported
+	// by the GCSBucketIAM condition so they can be removed. Drift of the
+	// binding is repaired on every sync of buckets managed by the
+	// operator.
+	Manage bool `json:"manage,omitempty"`
+	// Members are additional principals granted access to the bucket,
+	// e.g. serviceAccount:backup@project.iam.gserviceaccount.com.
+	Members []string `json:"members,omitempty"`
+}
+
+// getBucketIAM returns the storage.gcs.bucketIAM section of the unsupported
+// config overrides if the operator manages the bucket binding, or nil.
+func getBucketIAM(cr *imageregistryv1.Config) (*BucketIAM, error) {
+	overrides, err := getGCSOverrides(cr)
+	if err != nil {
+		return nil, err
+	}
+	if overrides == nil || overrides.BucketIAM == nil || !overrides.BucketIAM.Manage {
+		return nil, nil
+	}
+	for _, member := range overrides.BucketIAM.Members {
+		kind, _, ok := strings.Cut(member, ":")
+		if !ok || kind == "" {
+			return nil, fmt.Errorf("invalid bucket IAM member %q, expected a principal such as serviceAccount:name@project.iam.gserviceaccount.com", member)
+		}
+		switch kind {
+		case "projectOwner", "projectEditor", "projectViewer":
+			return nil, fmt.Errorf("invalid bucket IAM member %q, project convenience values grant access through project-wide roles", member)
+		}
+	}
+	return overrides.BucketIAM, nil
+}
+
+// registryServiceAccount returns the email of the service account the
+// registry authenticates as, either from the service account key or from
+// the service account impersonated by workload identity federation.
+func registryServiceAccount(keyfileData string) (string, error) {
+	var keyfile struct {
+		Type                           string `json:"type"`
+		ClientEmail                    string `json:"client_email"`
+		ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	}
+	if err := json.Unmarshal([]byte(keyfileData), &keyfile); err != nil {
+		return "", fmt.Errorf("unable to parse the GCP credentials: %w", err)
+	}
+	if keyfile.ClientEmail != "" {
+		return keyfile.ClientEmail, nil
+	}
+	if match := impersonatedServiceAccount.FindStringSubmatch(keyfile.ServiceAccountImpersonationURL); match != nil {
+		return match[1], nil
+	}
+	return "", fmt.Errorf("unable to find the service account of the %s credentials, it has to be added to the bucket IAM members", keyfile.Type)
+}
+
+// expectedBucketBinding returns the binding the operator sets in the bucket
+// policy.
+func (d *driver) expectedBucketBinding(bucketIAM *BucketIAM) (*iampb.Binding, error) {
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+	email, err := registryServiceAccount(cfg.KeyfileData)
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[string]struct{}{"serviceAccount:" + email: {}}
+	for _, member := range bucketIAM.Members {
+		members[member] = struct{}{}
+	}
+	binding := &iampb.Binding{
+		Role: bucketIAMRole,
+		Condition: &expr.Expr{
+			Title:      bucketIAMConditionTitle,
+			Expression: fmt.Sprintf("resource.name.startsWith(%q)", "projects/_/buckets/"+d.Config.Bucket),
+		},
+	}
+	for member := range members {
+		binding.Members = append(binding.Members, member)
+	}
+	sort.Strings(binding.Members)
+	return binding, nil
+}
+
+// operatorBucketBinding returns the binding set by the operator in bindings,
+// or nil if there is none.
+func operatorBucketBinding(bindings []*iampb.Binding) *iampb.Binding {
+	for _, b := range bindings {
+		if b.Condition != nil && b.Condition.Title == bucketIAMConditionTitle {
+			return b
+		}
+	}
+	return nil
+}
+
+// bucketBindingUpToDate returns true if b grants the role of expected to its
+// members on the bucket.
+func bucketBindingUpToDate(b, expected *iampb.Binding) bool {
+	if b == nil || b.Role != expected.Role || b.Condition == nil || b.Condition.Expression != expected.Condition.Expression {
+		return false
+	}
+	members := append([]string(nil), b.Members...)
+	sort.Strings(members)
+	return reflect.DeepEqual(members, expected.Members)
+}
+
+// mergeBucketBinding returns bindings with the binding set by the operator
+// replaced by expected. The other bindings are kept.
+func mergeBucketBinding(bindings []*iampb.Binding, expected *iampb.Binding) []*iampb.Binding {
+	merged := []*iampb.Binding{expected}
+	for _, b := range bindings {
+		if b.Condition != nil && b.Condition.Title == bucketIAMConditionTitle {
+			continue
+		}
+		merged = append(merged, b)
+	}
+	return merged
+}
+
+// bucketOverGrants returns the principals the bindings other than the one set
+// by the operator grant access to the bucket, excluding the members of
+// expected. The owners, editors and viewers of the project show up as
+// projectOwner, projectEditor and projectViewer principals.
+func bucketOverGrants(bindings []*iampb.Binding, expected *iampb.Binding) []string {
+	allowed := map[string]struct{}{}
+	for _, member := range expected.Members {
+		allowed[member] = struct{}{}
+	}
+	var grants []string
+	for _, b := range bindings {
+		if b.Condition != nil && b.Condition.Title == bucketIAMConditionTitle {
+			continue
+		}
+		for _, member := range b.Members {
+			if _, ok := allowed[member]; !ok {
+				grants = append(grants, fmt.Sprintf("%s (%s)", member, b.Role))
+			}
+		}
+	}
+	sort.Strings(grants)
+	return grants
+}
+
+// updateBucketIAMCondition reports whether principals other than the
+// members of expected are granted access to the bucket.
+func (d *driver) updateBucketIAMCondition(cr *imageregistryv1.Config, expected *iampb.Binding, overGrants []string) {
+	if len(overGrants) > 0 {
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionFalse, "OverGranted",
+			fmt.Sprintf("The IAM policy of the GCS bucket %s also grants access to %s", d.Config.Bucket, strings.Join(overGrants, ", ")))
+		return
+	}
+	util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionTrue, "AsExpected",
+		fmt.Sprintf("The IAM policy of the GCS bucket %s only grants access to %s", d.Config.Bucket, strings.Join(expected.Members, ", ")))
+}
+
+// syncBucketIAM grants access to the bucket to the registry when it is
+// requested in the unsupported config overrides, and reports the other
+// principals with access to the bucket with the GCSBucketIAM condition. The
+// policy of buckets not managed by the operator is only checked. Failures
+// are reported by the condition, the caller only logs them.
+func (d *driver) syncBucketIAM(cr *imageregistryv1.Config) error {
+	bucketIAM, err := getBucketIAM(cr)
+	if err != nil {
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionFalse, "InvalidConfiguration", err.Error())
+		return err
+	}
+	if bucketIAM == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, bucketIAMCondition)
+		return nil
+	}
+
+	expected, err := d.expectedBucketBinding(bucketIAM)
+	if err != nil {
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionFalse, "InvalidConfiguration", err.Error())
+		return err
+	}
+
+	client, err := d.getGCSClient()
+	if err != nil {
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return err
+	}
+	bucket := client.Bucket(d.Config.Bucket)
+	attrs, err := bucket.Attrs(d.Context)
+	if err != nil {
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return err
+	}
+	policy, err := bucket.IAM().V3().Policy(d.Context)
+	if err != nil {
+		err = fmt.Errorf("unable to get the IAM policy of the GCS bucket %s: %w", d.Config.Bucket, err)
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return err
+	}
+
+	overGrants := bucketOverGrants(policy.Bindings, expected)
+	uniform := attrs.UniformBucketLevelAccess.Enabled
+	if uniform && bucketBindingUpToDate(operatorBucketBinding(policy.Bindings), expected) {
+		d.updateBucketIAMCondition(cr, expected, overGrants)
+		return nil
+	}
+
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionFalse, "NotManaged",
+			fmt.Sprintf("The GCS bucket %s is not managed by the operator and its IAM policy does not grant %s to %s", d.Config.Bucket, bucketIAMRole, strings.Join(expected.Members, ", ")))
+		return nil
+	}
+
+	if !uniform {
+		_, err := bucket.Update(d.Context, gstorage.BucketAttrsToUpdate{
+			UniformBucketLevelAccess: &gstorage.UniformBucketLevelAccess{Enabled: true},
+		})
+		if err != nil {
+			util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionFalse, "UpdateFailed",
+				fmt.Sprintf("Unable to enable uniform bucket-level access on the GCS bucket %s: %s", d.Config.Bucket, err))
+			return err
+		}
+	}
+	policy.Bindings = mergeBucketBinding(policy.Bindings, expected)
+	if err := bucket.IAM().V3().SetPolicy(d.Context, policy); err != nil {
+		util.UpdateCondition(cr, bucketIAMCondition, operatorapi.ConditionFalse, "UpdateFailed",
+			fmt.Sprintf("Unable to set the IAM policy of the GCS bucket %s: %s", d.Config.Bucket, err))
+		return err
+	}
+	klog.Infof("the IAM policy of the GCS bucket %s now grants %s to %s", d.Config.Bucket, bucketIAMRole, strings.Join(expected.Members, ", "))
+	d.updateBucketIAMCondition(cr, expected, overGrants)
+	return nil
+}
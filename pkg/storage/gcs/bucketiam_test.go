@@ -0,0 +1,235 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestRegistryServiceAccount(t *testing.T) {
+	for _, tt := range []struct {
+		keyfile  string
+		expected string
+	}{
+		{
+			keyfile:  `{"type":"service_account","client_email":"registry@project.iam.gserviceaccount.com"}`,
+			expected: "registry@project.iam.gserviceaccount.com",
+		},
+		{
+			keyfile:  `{"type":"external_account","service_account_impersonation_url":"https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/registry@project.iam.gserviceaccount.com:generateAccessToken"}`,
+			expected: "registry@project.iam.gserviceaccount.com",
+		},
+		{
+			keyfile: `{"type":"external_account"}`,
+		},
+	} {
+		got, err := registryServiceAccount(tt.keyfile)
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("%s: got %q, want an error", tt.keyfile, got)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.keyfile, err)
+		} else if got != tt.expected {
+			t.Errorf("%s: got %q, want %q", tt.keyfile, got, tt.expected)
+		}
+	}
+}
+
+func TestSyncBucketIAM(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "registry@project-id.iam.gserviceaccount.com",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	const (
+		manage       = `{"storage":{"gcs":{"bucketIAM":{"manage":true,"members":["serviceAccount:backup@project-id.iam.gserviceaccount.com"]}}}}`
+		uniform      = `{"name":"bucket","iamConfiguration":{"uniformBucketLevelAccess":{"enabled":true}}}`
+		nonUniform   = `{"name":"bucket"}`
+		upToDate     = `{"version":3,"bindings":[{"role":"roles/storage.objectAdmin","members":["serviceAccount:registry@project-id.iam.gserviceaccount.com","serviceAccount:backup@project-id.iam.gserviceaccount.com"],"condition":{"title":"image-registry-bucket-only","expression":"resource.name.startsWith(\"projects/_/buckets/bucket\")"}}]}`
+		overGranted  = `{"version":3,"bindings":[{"role":"roles/storage.objectAdmin","members":["serviceAccount:registry@project-id.iam.gserviceaccount.com","serviceAccount:backup@project-id.iam.gserviceaccount.com"],"condition":{"title":"image-registry-bucket-only","expression":"resource.name.startsWith(\"projects/_/buckets/bucket\")"}},{"role":"roles/storage.legacyBucketOwner","members":["projectEditor:project-id","projectOwner:project-id"]}]}`
+		storageAdmin = `{"version":3,"bindings":[{"role":"roles/storage.admin","members":["serviceAccount:registry@project-id.iam.gserviceaccount.com","serviceAccount:backup@project-id.iam.gserviceaccount.com"],"condition":{"title":"image-registry-bucket-only","expression":"resource.name.startsWith(\"projects/_/buckets/bucket\")"}}]}`
+		defaultACL   = `{"version":1,"bindings":[{"role":"roles/storage.legacyBucketOwner","members":["projectEditor:project-id","projectOwner:project-id"]}]}`
+	)
+
+	for _, tt := range []struct {
+		name             string
+		overrides        string
+		managementState  string
+		responseBodies   []string
+		expectedUpdates  int
+		expectedBindings int
+		expectedStatus   operatorapi.ConditionStatus
+		expectedReason   string
+	}{
+		{
+			name:            "not requested",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+		},
+		{
+			name:            "up to date",
+			overrides:       manage,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			responseBodies:  []string{uniform, upToDate},
+			expectedStatus:  operatorapi.ConditionTrue,
+			expectedReason:  "AsExpected",
+		},
+		{
+			name:            "over granted",
+			overrides:       manage,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			responseBodies:  []string{uniform, overGranted},
+			expectedStatus:  operatorapi.ConditionFalse,
+			expectedReason:  "OverGranted",
+		},
+		{
+			name:             "drift repaired",
+			overrides:        manage,
+			managementState:  imageregistryv1.StorageManagementStateManaged,
+			responseBodies:   []string{nonUniform, defaultACL, uniform, `{}`},
+			expectedUpdates:  2,
+			expectedBindings: 2,
+			expectedStatus:   operatorapi.ConditionFalse,
+			expectedReason:   "OverGranted",
+		},
+		{
+			name:             "role updated",
+			overrides:        manage,
+			managementState:  imageregistryv1.StorageManagementStateManaged,
+			responseBodies:   []string{uniform, storageAdmin, `{}`},
+			expectedUpdates:  1,
+			expectedBindings: 1,
+			expectedStatus:   operatorapi.ConditionTrue,
+			expectedReason:   "AsExpected",
+		},
+		{
+			name:            "unmanaged bucket",
+			overrides:       manage,
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+			responseBodies:  []string{uniform, defaultACL},
+			expectedStatus:  operatorapi.ConditionFalse,
+			expectedReason:  "NotManaged",
+		},
+		{
+			name:            "convenience member",
+			overrides:       `{"storage":{"gcs":{"bucketIAM":{"manage":true,"members":["projectOwner:project-id"]}}}}`,
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			expectedStatus:  operatorapi.ConditionFalse,
+			expectedReason:  "InvalidConfiguration",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &httpmock.Transport{}
+			for _, body := range tt.responseBodies {
+				rt.AddResponse(http.StatusOK, body)
+			}
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.GCS = &imageregistryv1.ImageRegistryConfigStorageGCS{Bucket: "bucket"}
+			cr.Spec.Storage.ManagementState = tt.managementState
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.GCS, &listers.StorageListers)
+			drv.roundTripper = rt
+
+			err := drv.syncBucketIAM(cr)
+			if tt.expectedReason == "InvalidConfiguration" {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			reqs := rt.Requests()
+			if len(reqs) != len(tt.responseBodies) {
+				t.Fatalf("got %d requests, want %d", len(reqs), len(tt.responseBodies))
+			}
+			var updates int
+			for _, req := range reqs {
+				switch req.Method {
+				case http.MethodPatch:
+					updates++
+					if !strings.Contains(string(req.Body), `"uniformBucketLevelAccess":{"enabled":true}`) {
+						t.Errorf("got bucket update %s, want uniform bucket-level access to be enabled", req.Body)
+					}
+				case http.MethodPut:
+					updates++
+					var policy struct {
+						Bindings []struct {
+							Role    string   `json:"role"`
+							Members []string `json:"members"`
+						} `json:"bindings"`
+					}
+					if err := json.Unmarshal(req.Body, &policy); err != nil {
+						t.Fatal(err)
+					}
+					var granted bool
+					for _, b := range policy.Bindings {
+						if b.Role == bucketIAMRole && len(b.Members) == 2 {
+							granted = true
+						}
+					}
+					if !granted || len(policy.Bindings) != tt.expectedBindings {
+						t.Errorf("got policy %s, want %d bindings including one for the registry and the backup service accounts", req.Body, tt.expectedBindings)
+					}
+				}
+			}
+			if updates != tt.expectedUpdates {
+				t.Errorf("got %d updates, want %d", updates, tt.expectedUpdates)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, bucketIAMCondition)
+			if tt.expectedStatus == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("got condition %#v, want status %s and reason %s", cond, tt.expectedStatus, tt.expectedReason)
+			}
+		})
+	}
+}
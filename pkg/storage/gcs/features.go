@@ -0,0 +1,138 @@
+package gcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	gstorage "cloud.google.com/go/storage"
+	gapi "google.golang.org/api/googleapi"
+	htransport "google.golang.org/api/transport/http"
+
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// hierarchicalNamespaceCondition reports whether the bucket created by the
+// operator has a hierarchical namespace.
+const hierarchicalNamespaceCondition = "GCSHierarchicalNamespace"
+
+// bucketsEndpoint is the GCS JSON API endpoint to create buckets.
+const bucketsEndpoint = "https://storage.googleapis.com/storage/v1/b"
+
+// gcsOverrides is the storage.gcs section of the unsupported config
+// overrides.
+type gcsOverrides struct {
+	VPCServiceControlsPerimeter string     `json:"vpcServiceControlsPerimeter,omitempty"`
+	HierarchicalNamespace       bool       `json:"hierarchicalNamespace,omitempty"`
+	BucketIAM                   *BucketIAM `json:"bucketIAM,omitempty"`
+}
+
+// getGCSOverrides returns the storage.gcs section of the unsupported config
+// overrides, or nil if there is none.
+func getGCSOverrides(cr *imageregistryv1.Config) (*gcsOverrides, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		Storage *struct {
+			GCS *gcsOverrides `json:"gcs,omitempty"`
+		} `json:"storage,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	if overrides.Storage == nil {
+		return nil, nil
+	}
+	return overrides.Storage.GCS, nil
+}
+
+// createBucket creates the bucket, with a hierarchical namespace if it is
+// requested in the unsupported config overrides. Hierarchical namespace is
+// not available in every location and project, the bucket is created with
+// a flat namespace when GCS rejects it.
+func (d *driver) createBucket(cr *imageregistryv1.Config, bucket *gstorage.BucketHandle) error {
+	overrides, err := getGCSOverrides(cr)
+	if err != nil {
+		return err
+	}
+	labels, err := d.clusterLabels()
+	if err != nil {
+		return err
+	}
+	if overrides == nil || !overrides.HierarchicalNamespace {
+		return bucket.Create(d.Context, d.Config.ProjectID, &gstorage.BucketAttrs{Location: d.Config.Region, Labels: labels})
+	}
+
+	err = d.createHierarchicalNamespaceBucket(labels)
+	var gerr *gapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusBadRequest {
+		klog.Warningf("unable to create the bucket %s with a hierarchical namespace, falling back to a flat namespace: %s", d.Config.Bucket, err)
+		if err := bucket.Create(d.Context, d.Config.ProjectID, &gstorage.BucketAttrs{Location: d.Config.Region, Labels: labels}); err != nil {
+			return err
+		}
+		util.UpdateCondition(cr, hierarchicalNamespaceCondition, operatorapi.ConditionFalse, "Unsupported",
+			fmt.Sprintf("The GCS bucket %s was created with a flat namespace as hierarchical namespace was rejected: %s", d.Config.Bucket, gerr.Message))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	util.UpdateCondition(cr, hierarchicalNamespaceCondition, operatorapi.ConditionTrue, "Enabled",
+		fmt.Sprintf("The GCS bucket %s was created with a hierarchical namespace", d.Config.Bucket))
+	return nil
+}
+
+// createHierarchicalNamespaceBucket creates the bucket with a hierarchical
+// namespace through the JSON API, the storage client doesn't support it.
+// Hierarchical namespace requires uniform bucket-level access.
+func (d *driver) createHierarchicalNamespaceBucket(labels map[string]string) error {
+	opts, err := d.clientOptions()
+	if err != nil {
+		return err
+	}
+	client, _, err := htransport.NewClient(d.Context, opts...)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"name":     d.Config.Bucket,
+		"location": d.Config.Region,
+		"labels":   labels,
+		"hierarchicalNamespace": map[string]interface{}{
+			"enabled": true,
+		},
+		"iamConfiguration": map[string]interface{}{
+			"uniformBucketLevelAccess": map[string]interface{}{
+				"enabled": true,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(d.Context, http.MethodPost, bucketsEndpoint+"?project="+url.QueryEscape(d.Config.ProjectID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return gapi.CheckResponse(resp)
+}
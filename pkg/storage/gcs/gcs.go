@@ -2,6 +2,7 @@ package gcs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -12,6 +13,7 @@ import (
 	gapi "google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	goption "google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -24,6 +26,9 @@ import (
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/calllog"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/faultinject"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
@@ -38,8 +43,12 @@ type driver struct {
 	Config  *imageregistryv1.ImageRegistryConfigStorageGCS
 	Listers *regopclient.StorageListers
 
-	// httpClient is used only during tests.
-	httpClient *http.Client
+	// objectsClient is reused by the object methods, which are called
+	// once per object when copying the bucket.
+	objectsClient *gstorage.Client
+
+	// roundTripper is used only during tests.
+	roundTripper http.RoundTripper
 }
 
 func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorageGCS, listers *regopclient.StorageListers) *driver {
@@ -50,9 +59,9 @@ func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorag
 	}
 }
 
-// getGCSClient returns a client that allows us to interact
-// with the GCS services
-func (d *driver) getGCSClient() (*gstorage.Client, error) {
+// clientOptions returns the options of the clients talking to the GCS
+// services.
+func (d *driver) clientOptions() ([]goption.ClientOption, error) {
 	cfg, err := GetConfig(d.Listers)
 	if err != nil {
 		return nil, err
@@ -69,8 +78,25 @@ func (d *driver) getGCSClient() (*gstorage.Client, error) {
 	}
 
 	opts := []goption.ClientOption{goption.WithCredentials(credentials)}
-	if d.httpClient != nil {
-		opts = append(opts, goption.WithHTTPClient(d.httpClient))
+	if d.roundTripper != nil {
+		return append(opts, goption.WithHTTPClient(&http.Client{Transport: d.roundTripper})), nil
+	}
+
+	// requests are recorded in the cloud API call log before they are
+	// authorized.
+	transport, err := htransport.NewTransport(d.Context, &calllog.Transport{Provider: "GCS", Base: faultinject.Wrap("GCS", http.DefaultTransport)}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, goption.WithHTTPClient(&http.Client{Transport: transport})), nil
+}
+
+// getGCSClient returns a client that allows us to interact
+// with the GCS services
+func (d *driver) getGCSClient() (*gstorage.Client, error) {
+	opts, err := d.clientOptions()
+	if err != nil {
+		return nil, err
 	}
 
 	gcsClient, err := gstorage.NewClient(d.Context, opts...)
@@ -121,6 +147,21 @@ func GetConfig(listers *regopclient.StorageListers) (*GCS, error) {
 	return gcsConfig, nil
 }
 
+// CredentialsSource returns how the GCP credentials are sourced. Credentials
+// minted for clusters using workload identity federation hold an external
+// account configuration instead of a service account key.
+func (d *driver) CredentialsSource() (util.CredentialsSource, error) {
+	return util.GetCredentialsSource(d.Listers.Secrets, func(sec *corev1.Secret) util.CredentialsMode {
+		var keyfile struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(sec.Data["service_account.json"], &keyfile); err == nil && keyfile.Type == "external_account" {
+			return util.CredentialsModeWorkloadIdentity
+		}
+		return util.CredentialsModeMinted
+	})
+}
+
 func (d *driver) CABundle() (string, bool, error) {
 	return "", true, nil
 }
@@ -194,11 +235,15 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 		return false, nil
 	} else if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
-		return false, err
+		return false, d.checkVPCServiceControls(cr, err)
 	}
 
 	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "GCS Bucket Exists", "")
 
+	if err := d.syncBucketIAM(cr); err != nil {
+		klog.Warningf("unable to sync the IAM policy of the GCS bucket %s: %s", d.Config.Bucket, err)
+	}
+
 	return true, nil
 }
 
@@ -211,6 +256,30 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
+// PlanStorage returns the bucket CreateStorage would create.
+func (d *driver) PlanStorage(cr *imageregistryv1.Config) ([]util.PlannedResource, error) {
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+
+	region := d.Config.Region
+	if region == "" {
+		region = cfg.Region
+	}
+
+	name := d.Config.Bucket
+	if name == "" {
+		if name, err = util.PlannedStorageName(d.Listers, region); err != nil {
+			return nil, err
+		}
+	}
+
+	return []util.PlannedResource{
+		{Kind: "GCS bucket", Name: name, Region: region},
+	}, nil
+}
+
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	gclient, err := d.getGCSClient()
 	if err != nil {
@@ -222,6 +291,18 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	var bucket *gstorage.BucketHandle
 	var bucketExists bool
 	var bucketCreated bool
+	if len(d.Config.Bucket) == 0 {
+		if d.Config.Bucket, err = d.findClusterBucket(cr, gclient); err != nil {
+			util.UpdateCondition(
+				cr,
+				defaults.StorageExists,
+				operatorapi.ConditionUnknown,
+				"Unknown Error Occurred",
+				err.Error(),
+			)
+			return err
+		}
+	}
 	if len(d.Config.Bucket) != 0 {
 		if err := d.bucketExists(d.Config.Bucket); err == nil {
 			bucketExists = true
@@ -233,18 +314,38 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				"Unknown Error Occurred",
 				err.Error(),
 			)
-			return err
+			return d.checkVPCServiceControls(cr, err)
 		}
 	}
 	if len(d.Config.Bucket) != 0 && bucketExists {
 		bucket = gclient.Bucket(d.Config.Bucket)
+		var adopted bool
 		if cr.Spec.Storage.ManagementState == "" {
-			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+			if adopted, err = d.bucketAdoptable(cr, bucket); err != nil {
+				util.UpdateCondition(
+					cr,
+					defaults.StorageExists,
+					operatorapi.ConditionUnknown,
+					"Unknown Error Occurred",
+					err.Error(),
+				)
+				return err
+			}
+			if adopted {
+				cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+			} else {
+				cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+			}
 		}
 		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 			GCS: d.Config.DeepCopy(),
 		}
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "GCS Bucket Exists", "User supplied GCS bucket exists and is accessible")
+		if adopted {
+			cr.Spec.Storage.GCS = d.Config.DeepCopy()
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "GCS Bucket Adopted", fmt.Sprintf("GCS bucket %s carrying the cluster label was adopted", d.Config.Bucket))
+		} else {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "GCS Bucket Exists", "User supplied GCS bucket exists and is accessible")
+		}
 	} else {
 		// If the bucket name is blank, let's generate one
 		if len(d.Config.Bucket) == 0 {
@@ -252,14 +353,13 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				return err
 			}
 		}
-		bucketAttrs := gstorage.BucketAttrs{Location: d.Config.Region}
 		bucket = gclient.Bucket(d.Config.Bucket)
 
-		err := bucket.Create(d.Context, d.Config.ProjectID, &bucketAttrs)
+		err := d.createBucket(cr, bucket)
 		if err != nil {
 			if gerr, ok := err.(*gapi.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, strconv.Itoa(gerr.Code), gerr.Error())
-				return err
+				return d.checkVPCServiceControls(cr, err)
 			} else {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
 				return err
@@ -312,6 +412,10 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
+	if err := d.syncBucketIAM(cr); err != nil {
+		klog.Warningf("unable to sync the IAM policy of the GCS bucket %s: %s", d.Config.Bucket, err)
+	}
+
 	return nil
 }
 
@@ -359,7 +463,43 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 	return true, nil
 }
 
+// Inventory accounts all blobs stored in the bucket in the provided report.
+func (d *driver) Inventory(ctx context.Context, report *inventory.Report) error {
+	gclient, err := d.getGCSClient()
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range inventory.Prefixes {
+		itr := gclient.Bucket(d.Config.Bucket).Objects(ctx, &gstorage.Query{
+			Prefix: prefix,
+		})
+		for {
+			attr, err := itr.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if inventory.IsBlob(attr.Name) {
+				report.Add(attr.Size)
+			}
+		}
+	}
+	return nil
+}
+
 // ID return the underlying storage identificator, on this case the bucket name.
 func (d *driver) ID() string {
 	return d.Config.Bucket
 }
+
+// Capabilities returns what GCS supports.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiReplica:           true,
+		Redirect:               true,
+		EncryptionAtRestConfig: true,
+	}
+}
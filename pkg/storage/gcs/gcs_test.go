@@ -1,10 +1,9 @@
 package gcs
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
 	"strings"
 	"testing"
@@ -14,33 +13,15 @@ import (
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
-// tripper is injected on gcs client to simulate api responses.
-type tripper struct {
-	req            int
-	responseCodes  []int
-	responseBodies []string
-}
-
-func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	defer func() {
-		r.req++
-	}()
-	return &http.Response{
-		StatusCode: r.responseCodes[r.req],
-		Body:       io.NopCloser(bytes.NewBufferString(r.responseBodies[r.req])),
-	}, nil
-}
-
-func (r *tripper) AddResponse(code int, body string) {
-	r.responseCodes = append(r.responseCodes, code)
-	r.responseBodies = append(r.responseBodies, body)
-}
-
 func TestStorageManagementState(t *testing.T) {
 	accountConfigJSON, err := json.Marshal(map[string]string{
 		"type":           "service_account",
@@ -94,6 +75,8 @@ func TestStorageManagementState(t *testing.T) {
 					},
 				},
 			},
+			responseCodes:  []int{http.StatusOK, http.StatusOK},
+			responseBodies: []string{`{"items":[]}`, `{}`},
 		},
 		{
 			name:                    "user manually set the bucket (bucket exists)",
@@ -157,7 +140,7 @@ func TestStorageManagementState(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			rt := &tripper{}
+			rt := &httpmock.Transport{}
 			if len(tt.responseCodes) == 0 {
 				rt.AddResponse(http.StatusOK, "{}")
 			} else {
@@ -167,7 +150,7 @@ func TestStorageManagementState(t *testing.T) {
 			}
 
 			drv := NewDriver(context.Background(), tt.config.Spec.Storage.GCS, &listers.StorageListers)
-			drv.httpClient = &http.Client{Transport: rt}
+			drv.roundTripper = rt
 
 			if err := drv.CreateStorage(tt.config); err != nil {
 				if len(tt.err) == 0 {
@@ -191,3 +174,198 @@ func TestStorageManagementState(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageExistsVPCServiceControls(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "service-account-email",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name      string
+		body      string
+		overrides string
+		reason    string
+		err       string
+	}{
+		{
+			name:      "vpc service controls",
+			body:      `{"error":{"code":403,"message":"Request is prohibited by organization's policy. vpcServiceControlsUniqueIdentifier: abc123","errors":[{"reason":"vpcServiceControls","message":"Request is prohibited by organization's policy. vpcServiceControlsUniqueIdentifier: abc123"}]}}`,
+			overrides: `{"storage":{"gcs":{"vpcServiceControlsPerimeter":"registry-perimeter"}}}`,
+			reason:    reasonVPCServiceControlsDenied,
+			err:       "violation abc123",
+		},
+		{
+			name: "permission denied",
+			body: `{"error":{"code":403,"message":"service-account-email does not have storage.buckets.get access","errors":[{"reason":"forbidden","message":"service-account-email does not have storage.buckets.get access"}]}}`,
+			err:  "does not have storage.buckets.get access",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &httpmock.Transport{}
+			rt.AddResponse(http.StatusForbidden, tt.body)
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.GCS = &imageregistryv1.ImageRegistryConfigStorageGCS{
+				Bucket:    "bucket",
+				ProjectID: "project-id",
+			}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.GCS, &listers.StorageListers)
+			drv.roundTripper = rt
+
+			_, err := drv.StorageExists(cr)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+
+			var degradedErr *util.DegradedError
+			if isDegraded := errors.As(err, &degradedErr); isDegraded != (tt.reason != "") {
+				t.Fatalf("got degraded error %v, want %v", isDegraded, tt.reason != "")
+			}
+			if tt.reason == "" {
+				return
+			}
+			if degradedErr.Reason != tt.reason {
+				t.Errorf("got reason %q, want %q", degradedErr.Reason, tt.reason)
+			}
+			if !strings.Contains(err.Error(), "registry-perimeter") {
+				t.Errorf("expected the perimeter in the error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateStorageHierarchicalNamespace(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "service-account-email",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "cluster-abcde",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{Region: "us-central1"},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name           string
+		overrides      string
+		responseCodes  []int
+		responseBodies []string
+		hns            bool
+		status         operatorapi.ConditionStatus
+	}{
+		{
+			name:           "flat namespace",
+			responseCodes:  []int{http.StatusOK},
+			responseBodies: []string{`{}`},
+		},
+		{
+			name:           "hierarchical namespace",
+			overrides:      `{"storage":{"gcs":{"hierarchicalNamespace":true}}}`,
+			responseCodes:  []int{http.StatusOK},
+			responseBodies: []string{`{}`},
+			hns:            true,
+			status:         operatorapi.ConditionTrue,
+		},
+		{
+			name:           "hierarchical namespace rejected",
+			overrides:      `{"storage":{"gcs":{"hierarchicalNamespace":true}}}`,
+			responseCodes:  []int{http.StatusBadRequest, http.StatusOK},
+			responseBodies: []string{`{"error":{"code":400,"message":"hierarchical namespace is not supported in this location"}}`, `{}`},
+			hns:            true,
+			status:         operatorapi.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &httpmock.Transport{}
+			// no bucket left behind by a previous installation
+			rt.AddJSONResponse(http.StatusOK, `{"items":[]}`)
+			for i, code := range tt.responseCodes {
+				rt.AddResponse(code, tt.responseBodies[i])
+			}
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.GCS = &imageregistryv1.ImageRegistryConfigStorageGCS{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.GCS, &listers.StorageListers)
+			drv.roundTripper = rt
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatal(err)
+			}
+			reqs := rt.Requests()[1:]
+			if len(reqs) != len(tt.responseCodes) {
+				t.Fatalf("got %d requests, want %d", len(reqs), len(tt.responseCodes))
+			}
+			if got := strings.Contains(string(reqs[0].Body), `"hierarchicalNamespace":{"enabled":true}`); got != tt.hns {
+				t.Errorf("got bucket creation request %s, want hierarchical namespace %t", reqs[0].Body, tt.hns)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, hierarchicalNamespaceCondition)
+			if tt.status == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Status != tt.status {
+				t.Errorf("got condition %#v, want status %s", cond, tt.status)
+			}
+		})
+	}
+}
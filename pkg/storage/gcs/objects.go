@@ -0,0 +1,82 @@
+package gcs
+
+import (
+	"context"
+	"io"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// getObjectsClient returns the GCS client used by the object methods.
+func (d *driver) getObjectsClient() (*gstorage.Client, error) {
+	if d.objectsClient != nil {
+		return d.objectsClient, nil
+	}
+	gclient, err := d.getGCSClient()
+	if err != nil {
+		return nil, err
+	}
+	d.objectsClient = gclient
+	return gclient, nil
+}
+
+// WalkObjects calls fn for every object stored in the bucket.
+func (d *driver) WalkObjects(ctx context.Context, fn func(key string, size int64) error) error {
+	gclient, err := d.getObjectsClient()
+	if err != nil {
+		return err
+	}
+
+	itr := gclient.Bucket(d.Config.Bucket).Objects(ctx, &gstorage.Query{})
+	for {
+		attr, err := itr.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(attr.Name, attr.Size); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadObject returns the content of the object key.
+func (d *driver) ReadObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	gclient, err := d.getObjectsClient()
+	if err != nil {
+		return nil, err
+	}
+	return gclient.Bucket(d.Config.Bucket).Object(key).NewReader(ctx)
+}
+
+// WriteObject stores the content read from r as the object key, the bucket
+// default encryption applies.
+func (d *driver) WriteObject(ctx context.Context, key string, r io.Reader, size int64) error {
+	gclient, err := d.getObjectsClient()
+	if err != nil {
+		return err
+	}
+
+	w := gclient.Bucket(d.Config.Bucket).Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// DeleteObject removes the object key.
+func (d *driver) DeleteObject(ctx context.Context, key string) error {
+	gclient, err := d.getObjectsClient()
+	if err != nil {
+		return err
+	}
+	err = gclient.Bucket(d.Config.Bucket).Object(key).Delete(ctx)
+	if err == gstorage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
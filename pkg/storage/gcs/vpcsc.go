@@ -0,0 +1,93 @@
+package gcs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	gapi "google.golang.org/api/googleapi"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// reasonVPCServiceControlsDenied is reported when a request to GCS is
+// rejected by a VPC Service Controls perimeter.
+const reasonVPCServiceControlsDenied = "VPCServiceControlsDenied"
+
+// vpcServiceControlsErrorReason is the reason GCS attaches to the errors
+// caused by VPC Service Controls.
+const vpcServiceControlsErrorReason = "vpcServiceControls"
+
+// vpcServiceControlsID matches the identifier GCS puts in the message of
+// errors caused by VPC Service Controls. It can be looked up in the audit
+// logs of the project to find which perimeter rejected the request.
+var vpcServiceControlsID = regexp.MustCompile(`vpcServiceControlsUniqueIdentifier:\s*([^\s.]+)`)
+
+// getVPCServiceControlsPerimeter returns the perimeter set in the
+// storage.gcs.vpcServiceControlsPerimeter section of the unsupported config
+// overrides. The perimeter is only used to make error messages actionable,
+// the operator doesn't verify it.
+func getVPCServiceControlsPerimeter(cr *imageregistryv1.Config) string {
+	overrides, err := getGCSOverrides(cr)
+	if err != nil || overrides == nil {
+		// invalid overrides are reported by the operator.
+		return ""
+	}
+	return overrides.VPCServiceControlsPerimeter
+}
+
+// isVPCServiceControlsError returns true if err is a GCS error caused by
+// VPC Service Controls, along with the unique identifier of the violation.
+func isVPCServiceControlsError(err error) (string, bool) {
+	var gerr *gapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusForbidden {
+		return "", false
+	}
+
+	found := false
+	messages := []string{gerr.Message}
+	for _, item := range gerr.Errors {
+		if item.Reason == vpcServiceControlsErrorReason {
+			found = true
+		}
+		messages = append(messages, item.Message)
+	}
+	message := strings.Join(messages, " ")
+	match := vpcServiceControlsID.FindStringSubmatch(message)
+	if match != nil {
+		return match[1], true
+	}
+	return "", found
+}
+
+// checkVPCServiceControls turns errors caused by VPC Service Controls into
+// errors that explain what to look for, and reports them with a dedicated
+// reason. Other errors are returned as they are.
+func (d *driver) checkVPCServiceControls(cr *imageregistryv1.Config, err error) error {
+	id, ok := isVPCServiceControlsError(err)
+	if !ok {
+		return err
+	}
+
+	msg := fmt.Sprintf("access to the GCS bucket %s was denied by VPC Service Controls", d.Config.Bucket)
+	if id != "" {
+		msg += fmt.Sprintf(" (violation %s, look it up in the audit logs of project %s)", id, d.Config.ProjectID)
+	}
+	if perimeter := getVPCServiceControlsPerimeter(cr); perimeter != "" {
+		msg += fmt.Sprintf(": the bucket is expected to be in the perimeter %s, verify that the project is a member of it and that the ingress rules allow the cluster service accounts and networks", perimeter)
+	} else {
+		msg += ": verify that the perimeter protecting the bucket allows the cluster service accounts and networks"
+	}
+
+	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, reasonVPCServiceControlsDenied, msg)
+	return &util.DegradedError{
+		Reason: reasonVPCServiceControlsDenied,
+		Err:    fmt.Errorf("%s: %w", msg, err),
+	}
+}
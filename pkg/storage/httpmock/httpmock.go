@@ -0,0 +1,136 @@
+// Package httpmock provides the HTTP transport the storage drivers' tests use
+// to replace the cloud APIs with canned responses.
+//
+// Every driver has an unexported field only set during tests, either an
+// http.RoundTripper or, for the Azure autorest clients, an autorest.Sender.
+// A Transport satisfies both, so the same responses can be played back to
+// any driver:
+//
+//	rt := &httpmock.Transport{}
+//	rt.AddResponse(http.StatusNotFound, "")
+//	drv.roundTripper = rt
+package httpmock
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Response is a canned response.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// Request is a request received by a Transport.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// Transport replies to requests with the responses added to it, in order,
+// and records the requests it receives.
+type Transport struct {
+	// Default is the response sent once the added responses are used up.
+	// If it is nil, requests fail instead.
+	Default *Response
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+}
+
+// Add queues resp.
+func (t *Transport) Add(resp Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.responses = append(t.responses, resp)
+}
+
+// AddResponse queues a response with the given status code and body.
+func (t *Transport) AddResponse(code int, body string) {
+	t.Add(Response{StatusCode: code, Body: body})
+}
+
+// AddJSONResponse queues a response with the given status code and JSON
+// body, some SDKs ignore bodies without a JSON content type.
+func (t *Transport) AddJSONResponse(code int, body string) {
+	t.Add(Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       body,
+	})
+}
+
+// Requests returns the requests received so far.
+func (t *Transport) Requests() []Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Request(nil), t.requests...)
+}
+
+// Client returns an HTTP client using the transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests = append(t.requests, Request{
+		Method: req.Method,
+		URL:    req.URL,
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+
+	var resp Response
+	switch {
+	case len(t.responses) > 0:
+		resp, t.responses = t.responses[0], t.responses[1:]
+	case t.Default != nil:
+		resp = *t.Default
+	default:
+		return nil, fmt.Errorf("httpmock: no response for %s %s", req.Method, req.URL)
+	}
+
+	header := resp.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewBufferString(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Do implements autorest.Sender.
+func (t *Transport) Do(req *http.Request) (*http.Response, error) {
+	return t.RoundTrip(req)
+}
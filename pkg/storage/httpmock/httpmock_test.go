@@ -0,0 +1,75 @@
+package httpmock
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+var (
+	_ http.RoundTripper = &Transport{}
+	_ autorest.Sender   = &Transport{}
+)
+
+func TestTransport(t *testing.T) {
+	rt := &Transport{}
+	rt.AddResponse(http.StatusNotFound, "not found")
+	rt.AddJSONResponse(http.StatusOK, `{}`)
+
+	client := rt.Client()
+	for _, want := range []struct {
+		code        int
+		contentType string
+		body        string
+	}{
+		{code: http.StatusNotFound, body: "not found"},
+		{code: http.StatusOK, contentType: "application/json", body: `{}`},
+	} {
+		resp, err := client.Post("https://bucket.example.com/key", "text/plain", strings.NewReader("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want.code || resp.Header.Get("Content-Type") != want.contentType || string(body) != want.body {
+			t.Errorf("got %d %q %q, want %d %q %q", resp.StatusCode, resp.Header.Get("Content-Type"), body, want.code, want.contentType, want.body)
+		}
+	}
+
+	if _, err := client.Get("https://bucket.example.com/key"); err == nil {
+		t.Errorf("expected an error once the responses are used up")
+	}
+
+	reqs := rt.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d requests, want 3", len(reqs))
+	}
+	if reqs[0].Method != http.MethodPost || reqs[0].URL.Host != "bucket.example.com" || string(reqs[0].Body) != "data" {
+		t.Errorf("got request %s %s %q, want POST to bucket.example.com with body data", reqs[0].Method, reqs[0].URL, reqs[0].Body)
+	}
+}
+
+func TestTransportDefault(t *testing.T) {
+	rt := &Transport{Default: &Response{StatusCode: http.StatusOK, Body: `{}`}}
+	rt.AddResponse(http.StatusForbidden, "")
+
+	for _, code := range []int{http.StatusForbidden, http.StatusOK, http.StatusOK} {
+		req, err := http.NewRequest(http.MethodGet, "https://bucket.example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != code {
+			t.Errorf("got status %d, want %d", resp.StatusCode, code)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package ibmcos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// bucketConfigurationCondition reports whether the firewall and the hard
+// quota of the bucket match the ones requested in the config overrides.
+const bucketConfigurationCondition = "IBMCOSBucketConfiguration"
+
+// defaultResourceConfigurationURL is the public endpoint of the COS Resource
+// Configuration API, the S3 API has no notion of bucket firewall and quota.
+const defaultResourceConfigurationURL = "https://config.cloud-object-storage.cloud.ibm.com/v1"
+
+// BucketConfiguration holds the firewall and the quota the operator sets on
+// the buckets it manages. Unset fields are left untouched on the bucket.
+type BucketConfiguration struct {
+	// AllowedIPs are the addresses and CIDRs the bucket accepts requests
+	// from. The networks the registry and the operator reach IBM COS from
+	// have to be part of the list, the egress IPs assigned to the registry
+	// are added to it. The firewall is left in place when the list is
+	// removed, it is not opened behind the user's back.
+	AllowedIPs *[]string `json:"allowedIPs,omitempty"`
+	// HardQuota is the maximum size of the bucket, writes are rejected
+	// once it is reached. Zero removes the quota.
+	HardQuota *resource.Quantity `json:"hardQuota,omitempty"`
+	// Endpoint is the URL of the Resource Configuration API, the public
+	// endpoint by default. Clusters without access to it set the private
+	// one, https://config.private.cloud-object-storage.cloud.ibm.com/v1.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// bucketConfig is the bucket representation of the Resource Configuration
+// API.
+type bucketConfig struct {
+	Firewall *struct {
+		AllowedIP []string `json:"allowed_ip"`
+	} `json:"firewall,omitempty"`
+	HardQuota int64 `json:"hard_quota,omitempty"`
+}
+
+// GetBucketConfiguration returns the bucket configuration set in the
+// storage.ibmcos section of the unsupported config overrides, or nil if
+// there is none. The egress IPs of the registry are added to the allowed
+// IPs.
+func GetBucketConfiguration(cr *imageregistryv1.Config) (*BucketConfiguration, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		Storage *struct {
+			IBMCOS *struct {
+				BucketConfiguration *BucketConfiguration `json:"bucketConfiguration,omitempty"`
+			} `json:"ibmcos,omitempty"`
+		} `json:"storage,omitempty"`
+		Egress *struct {
+			IPs []string `json:"ips"`
+		} `json:"egress,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	if overrides.Storage == nil || overrides.Storage.IBMCOS == nil || overrides.Storage.IBMCOS.BucketConfiguration == nil {
+		return nil, nil
+	}
+
+	config := overrides.Storage.IBMCOS.BucketConfiguration
+	if config.AllowedIPs != nil {
+		values := *config.AllowedIPs
+		if len(values) == 0 {
+			return nil, fmt.Errorf("invalid IBM COS bucket configuration: allowedIPs must have at least one address, the registry would be denied access to the bucket otherwise")
+		}
+		if overrides.Egress != nil {
+			values = append(values, overrides.Egress.IPs...)
+		}
+		allowed := []string{}
+		seen := map[string]bool{}
+		for _, value := range values {
+			if net.ParseIP(value) == nil {
+				if _, _, err := net.ParseCIDR(value); err != nil {
+					return nil, fmt.Errorf("invalid IBM COS bucket configuration: %q is not an IP address or range", value)
+				}
+			}
+			if !seen[value] {
+				seen[value] = true
+				allowed = append(allowed, value)
+			}
+		}
+		sort.Strings(allowed)
+		config.AllowedIPs = &allowed
+	}
+	if config.Endpoint != "" {
+		if u, err := url.Parse(config.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid IBM COS bucket configuration: endpoint %q is not an https URL", config.Endpoint)
+		}
+	}
+	if config.HardQuota != nil && config.HardQuota.Sign() < 0 {
+		return nil, fmt.Errorf("invalid IBM COS bucket configuration: hardQuota cannot be negative")
+	}
+	return config, nil
+}
+
+// getResourceConfigurationService returns a client for the Resource
+// Configuration API at endpoint, the public one if it is empty.
+func (d *driver) getResourceConfigurationService(endpoint string) (*core.BaseService, error) {
+	if d.resourceConfiguration != nil {
+		return d.resourceConfiguration, nil
+	}
+
+	IAMAPIKey, err := d.getCredentialsConfigData()
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint == "" {
+		endpoint = defaultResourceConfigurationURL
+	}
+	return core.NewBaseService(&core.ServiceOptions{
+		URL: endpoint,
+		Authenticator: &core.IamAuthenticator{
+			ApiKey: IAMAPIKey,
+		},
+	})
+}
+
+// bucketConfigurationRequest returns a request for the configuration of the
+// bucket.
+func (d *driver) bucketConfigurationRequest(service *core.BaseService, method string, body interface{}) (*http.Request, error) {
+	builder := core.NewRequestBuilder(method).WithContext(d.Context)
+	builder, err := builder.ResolveRequestURL(service.GetServiceURL(), "/b/{bucket}", map[string]string{"bucket": d.Config.Bucket})
+	if err != nil {
+		return nil, err
+	}
+	builder.AddHeader("Accept", "application/json")
+	if body != nil {
+		builder.AddHeader("Content-Type", "application/merge-patch+json")
+		if _, err := builder.SetBodyContentJSON(body); err != nil {
+			return nil, err
+		}
+	}
+	return builder.Build()
+}
+
+// bucketConfigurationMatches returns true if the bucket has the requested
+// firewall and quota.
+func bucketConfigurationMatches(current *bucketConfig, config *BucketConfiguration) bool {
+	if config.AllowedIPs != nil {
+		var allowed []string
+		if current.Firewall != nil {
+			allowed = append(allowed, current.Firewall.AllowedIP...)
+		}
+		requested := append([]string(nil), *config.AllowedIPs...)
+		sort.Strings(allowed)
+		sort.Strings(requested)
+		if strings.Join(allowed, ",") != strings.Join(requested, ",") {
+			return false
+		}
+	}
+	if config.HardQuota != nil && current.HardQuota != config.HardQuota.Value() {
+		return false
+	}
+	return true
+}
+
+// describeBucketConfiguration returns a description of the requested
+// configuration for the condition.
+func describeBucketConfiguration(bucket string, config *BucketConfiguration) string {
+	var parts []string
+	if config.AllowedIPs != nil {
+		parts = append(parts, fmt.Sprintf("a firewall allowing %s", strings.Join(*config.AllowedIPs, ", ")))
+	}
+	if config.HardQuota != nil {
+		if config.HardQuota.IsZero() {
+			parts = append(parts, "no hard quota")
+		} else {
+			parts = append(parts, fmt.Sprintf("a hard quota of %s", config.HardQuota.String()))
+		}
+	}
+	return fmt.Sprintf("The bucket %s has %s", bucket, strings.Join(parts, " and "))
+}
+
+// syncBucketConfiguration applies the firewall and the hard quota requested
+// in the config overrides to the managed bucket. It is run on every sync, so
+// changes made out-of-band are reverted.
+func (d *driver) syncBucketConfiguration(cr *imageregistryv1.Config) error {
+	config, err := GetBucketConfiguration(cr)
+	if err != nil {
+		util.UpdateCondition(cr, bucketConfigurationCondition, operatorapi.ConditionFalse, "InvalidConfiguration", err.Error())
+		return err
+	}
+	if config == nil || (config.AllowedIPs == nil && config.HardQuota == nil) {
+		return nil
+	}
+
+	service, err := d.getResourceConfigurationService(config.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := d.bucketConfigurationRequest(service, core.GET, nil)
+	if err != nil {
+		return err
+	}
+	var current bucketConfig
+	if _, err := service.Request(req, &current); err != nil {
+		util.UpdateCondition(cr, bucketConfigurationCondition, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return fmt.Errorf("unable to get the configuration of the bucket %s: %w", d.Config.Bucket, err)
+	}
+	if bucketConfigurationMatches(&current, config) {
+		util.UpdateCondition(cr, bucketConfigurationCondition, operatorapi.ConditionTrue, "ConfigurationApplied", describeBucketConfiguration(d.Config.Bucket, config))
+		return nil
+	}
+
+	patch := map[string]interface{}{}
+	if config.AllowedIPs != nil {
+		patch["firewall"] = map[string]interface{}{
+			"allowed_ip": *config.AllowedIPs,
+		}
+	}
+	if config.HardQuota != nil {
+		patch["hard_quota"] = config.HardQuota.Value()
+	}
+	req, err = d.bucketConfigurationRequest(service, core.PATCH, patch)
+	if err != nil {
+		return err
+	}
+	if _, err := service.Request(req, nil); err != nil {
+		util.UpdateCondition(cr, bucketConfigurationCondition, operatorapi.ConditionFalse, "ConfigurationNotApplied",
+			fmt.Sprintf("Unable to configure the bucket %s: %s", d.Config.Bucket, err))
+		return fmt.Errorf("unable to configure the bucket %s: %w", d.Config.Bucket, err)
+	}
+
+	util.UpdateCondition(cr, bucketConfigurationCondition, operatorapi.ConditionTrue, "ConfigurationApplied", describeBucketConfiguration(d.Config.Bucket, config))
+	return nil
+}
@@ -0,0 +1,203 @@
+package ibmcos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+)
+
+func TestGetBucketConfiguration(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		expected  bool
+		allowed   string
+		err       bool
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:      "quota",
+			overrides: `{"storage":{"ibmcos":{"bucketConfiguration":{"hardQuota":"100Gi"}}}}`,
+			expected:  true,
+		},
+		{
+			name:      "firewall",
+			overrides: `{"storage":{"ibmcos":{"bucketConfiguration":{"allowedIPs":["192.168.0.0/16","10.0.0.1"]}}}}`,
+			expected:  true,
+			allowed:   "10.0.0.1,192.168.0.0/16",
+		},
+		{
+			name:      "firewall with egress IPs",
+			overrides: `{"egress":{"ips":["10.0.0.2","10.0.0.1"]},"storage":{"ibmcos":{"bucketConfiguration":{"allowedIPs":["10.0.0.1"]}}}}`,
+			expected:  true,
+			allowed:   "10.0.0.1,10.0.0.2",
+		},
+		{
+			name:      "empty firewall",
+			overrides: `{"storage":{"ibmcos":{"bucketConfiguration":{"allowedIPs":[]}}}}`,
+			err:       true,
+		},
+		{
+			name:      "invalid address",
+			overrides: `{"storage":{"ibmcos":{"bucketConfiguration":{"allowedIPs":["10.0.0"]}}}}`,
+			err:       true,
+		},
+		{
+			name:      "invalid endpoint",
+			overrides: `{"storage":{"ibmcos":{"bucketConfiguration":{"hardQuota":"1Gi","endpoint":"config.private.cloud-object-storage.cloud.ibm.com"}}}}`,
+			err:       true,
+		},
+		{
+			name:      "negative quota",
+			overrides: `{"storage":{"ibmcos":{"bucketConfiguration":{"hardQuota":"-1Gi"}}}}`,
+			err:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+			config, err := GetBucketConfiguration(cr)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if (config != nil) != tt.expected {
+				t.Errorf("got %#v, want configuration: %t", config, tt.expected)
+			}
+			if config != nil && config.AllowedIPs != nil {
+				if allowed := strings.Join(*config.AllowedIPs, ","); allowed != tt.allowed {
+					t.Errorf("got allowed IPs %s, want %s", allowed, tt.allowed)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncBucketConfiguration(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		overrides      string
+		current        string
+		patchCode      int
+		expectedPatch  map[string]interface{}
+		expectedStatus operatorapi.ConditionStatus
+		err            bool
+	}{
+		{
+			name:           "already applied",
+			overrides:      `{"storage":{"ibmcos":{"bucketConfiguration":{"allowedIPs":["10.0.0.1"],"hardQuota":"1Ki"}}}}`,
+			current:        `{"firewall":{"allowed_ip":["10.0.0.1"]},"hard_quota":1024}`,
+			expectedStatus: operatorapi.ConditionTrue,
+		},
+		{
+			name:           "firewall set",
+			overrides:      `{"egress":{"ips":["10.0.0.2"]},"storage":{"ibmcos":{"bucketConfiguration":{"allowedIPs":["10.0.0.1"]}}}}`,
+			current:        `{"hard_quota":1024}`,
+			patchCode:      http.StatusNoContent,
+			expectedPatch:  map[string]interface{}{"firewall": map[string]interface{}{"allowed_ip": []interface{}{"10.0.0.1", "10.0.0.2"}}},
+			expectedStatus: operatorapi.ConditionTrue,
+		},
+		{
+			name:           "firewall left in place when not requested",
+			overrides:      `{"storage":{"ibmcos":{"bucketConfiguration":{"hardQuota":"1Ki"}}}}`,
+			current:        `{"firewall":{"allowed_ip":["10.0.0.1"]},"hard_quota":1024}`,
+			expectedStatus: operatorapi.ConditionTrue,
+		},
+		{
+			name:           "quota removed",
+			overrides:      `{"storage":{"ibmcos":{"bucketConfiguration":{"hardQuota":"0"}}}}`,
+			current:        `{"hard_quota":1024}`,
+			patchCode:      http.StatusNoContent,
+			expectedPatch:  map[string]interface{}{"hard_quota": float64(0)},
+			expectedStatus: operatorapi.ConditionTrue,
+		},
+		{
+			name:           "rejected",
+			overrides:      `{"storage":{"ibmcos":{"bucketConfiguration":{"hardQuota":"1Gi"}}}}`,
+			current:        `{}`,
+			patchCode:      http.StatusForbidden,
+			expectedPatch:  map[string]interface{}{"hard_quota": float64(1 << 30)},
+			expectedStatus: operatorapi.ConditionFalse,
+			err:            true,
+		},
+		{
+			name:           "empty firewall refused",
+			overrides:      `{"storage":{"ibmcos":{"bucketConfiguration":{"allowedIPs":[]}}}}`,
+			expectedStatus: operatorapi.ConditionFalse,
+			err:            true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &httpmock.Transport{}
+			rt.AddJSONResponse(http.StatusOK, tt.current)
+			if tt.patchCode != 0 {
+				rt.AddResponse(tt.patchCode, "")
+			}
+
+			service, err := core.NewBaseService(&core.ServiceOptions{
+				URL:           "http://nowhere.cloud",
+				Authenticator: &core.NoAuthAuthenticator{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			service.SetHTTPClient(rt.Client())
+
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageIBMCOS{Bucket: "bucket", Location: "us-east"}, nil)
+			drv.resourceConfiguration = service
+
+			err = drv.syncBucketConfiguration(cr)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error: %t", err, tt.err)
+			}
+
+			var patch map[string]interface{}
+			for _, req := range rt.Requests() {
+				if req.URL.Path != "/b/bucket" {
+					t.Errorf("got path %s, want /b/bucket", req.URL.Path)
+				}
+				if req.Method != http.MethodPatch {
+					continue
+				}
+				if err := json.Unmarshal(req.Body, &patch); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expectedPatch, _ := json.Marshal(tt.expectedPatch)
+			gotPatch, _ := json.Marshal(patch)
+			if string(gotPatch) != string(expectedPatch) {
+				t.Errorf("got patch %s, want %s", gotPatch, expectedPatch)
+			}
+
+			var status operatorapi.ConditionStatus
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type == bucketConfigurationCondition {
+					status = cond.Status
+				}
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("got condition status %q, want %q", status, tt.expectedStatus)
+			}
+		})
+	}
+}
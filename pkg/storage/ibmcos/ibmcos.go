@@ -15,6 +15,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 
 	"github.com/IBM/go-sdk-core/v5/core"
 	"github.com/IBM/ibm-cos-sdk-go/aws"
@@ -35,6 +36,8 @@ import (
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/calllog"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/faultinject"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 	"github.com/openshift/cluster-image-registry-operator/pkg/version"
 )
@@ -57,6 +60,10 @@ type driver struct {
 	// IBM Services used only during tests.
 	resourceController *resourcecontrollerv2.ResourceControllerV2
 	resourceManager    *resourcemanagerv2.ResourceManagerV2
+
+	// resourceConfiguration is the COS Resource Configuration API client,
+	// set only during tests.
+	resourceConfiguration *core.BaseService
 }
 
 // NewDriver creates a new IBM COS storage driver.
@@ -69,6 +76,11 @@ func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorag
 	}
 }
 
+// CredentialsSource returns how the IBM Cloud credentials are sourced.
+func (d *driver) CredentialsSource() (util.CredentialsSource, error) {
+	return util.GetCredentialsSource(d.Listers.Secrets, util.MintedCredentials)
+}
+
 // CABundle returns a additional CA bundle for IBM COS.
 func (d *driver) CABundle() (string, bool, error) {
 	return "", true, nil
@@ -133,6 +145,46 @@ func (d *driver) UpdateEffectiveConfig() (*imageregistryv1.ImageRegistryConfigSt
 	return effectiveConfig, nil
 }
 
+// PlanStorage returns the service instance, resource key and bucket
+// CreateStorage would create.
+func (d *driver) PlanStorage(cr *imageregistryv1.Config) ([]util.PlannedResource, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.UpdateEffectiveConfig(); err != nil {
+		return nil, err
+	}
+
+	var resources []util.PlannedResource
+	name := fmt.Sprintf("%s-%s", infra.Status.InfrastructureName, defaults.ImageRegistryName)
+	if len(d.Config.ServiceInstanceCRN) == 0 {
+		resources = append(resources, util.PlannedResource{
+			Kind: "COS service instance",
+			Name: name,
+			Tags: map[string]string{fmt.Sprintf("kubernetes.io_cluster_%s", infra.Status.InfrastructureName): "owned"},
+		})
+	}
+	if len(d.Config.ResourceKeyCRN) == 0 {
+		resources = append(resources, util.PlannedResource{Kind: "COS resource key", Name: name})
+	}
+
+	bucket := d.Config.Bucket
+	if bucket == "" {
+		if bucket, err = util.PlannedStorageName(d.Listers, d.Config.Location); err != nil {
+			return nil, err
+		}
+	}
+	resources = append(resources, util.PlannedResource{
+		Kind:   "COS bucket",
+		Name:   bucket,
+		Region: d.Config.Location,
+		SKU:    "smart",
+	})
+	return resources, nil
+}
+
 // CreateStorage attempts to create an IBM COS service instance,
 // resource key, and bucket.
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
@@ -537,6 +589,14 @@ func (d *driver) ID() string {
 	return d.Config.Bucket
 }
 
+// Capabilities returns what IBM COS supports.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiReplica: true,
+		Redirect:     true,
+	}
+}
+
 // RemoveStorage deletes the storage medium that was created.
 // The COS bucket must be empty before it can be removed.
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
@@ -662,6 +722,12 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 	}
 
 	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "IBM COS Bucket Exists", "")
+
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		if err := d.syncBucketConfiguration(cr); err != nil {
+			klog.Warningf("unable to sync the configuration of the bucket: %s", err)
+		}
+	}
 	return true, nil
 }
 
@@ -718,7 +784,7 @@ func (d *driver) getIBMCOSClient(serviceInstanceCRN string) (*s3.S3, error) {
 			Endpoint: &serviceEndpoint,
 			Region:   &d.Config.Location,
 			HTTPClient: &http.Client{
-				Transport: &http.Transport{
+				Transport: faultinject.Wrap("IBMCOS", &http.Transport{
 					Proxy: func(req *http.Request) (*url.URL, error) {
 						return httpproxy.FromEnvironment().ProxyFunc()(req.URL)
 					},
@@ -732,7 +798,7 @@ func (d *driver) getIBMCOSClient(serviceInstanceCRN string) (*s3.S3, error) {
 					IdleConnTimeout:       90 * time.Second,
 					TLSHandshakeTimeout:   10 * time.Second,
 					ExpectContinueTimeout: 1 * time.Second,
-				},
+				}),
 			},
 			S3ForcePathStyle: aws.Bool(true),
 		},
@@ -753,10 +819,33 @@ func (d *driver) getIBMCOSClient(serviceInstanceCRN string) (*s3.S3, error) {
 		Name: "openshift.io/cluster-image-registry-operator",
 		Fn:   request.MakeAddToUserAgentHandler("openshift.io cluster-image-registry-operator", version.Version),
 	})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "openshift.io/cluster-image-registry-operator/calllog",
+		Fn:   recordCall,
+	})
 
 	return s3.New(sess), nil
 }
 
+// recordCall records the request in the cloud API call log once it is
+// complete, retries included.
+func recordCall(r *request.Request) {
+	c := calllog.Call{
+		Time:      r.Time.UTC(),
+		Provider:  "IBMCOS",
+		Operation: r.Operation.Name,
+		Duration:  time.Since(r.Time),
+		Retries:   r.RetryCount,
+	}
+	if r.HTTPResponse != nil {
+		c.Status = r.HTTPResponse.StatusCode
+	}
+	if r.Error != nil {
+		c.Error = r.Error.Error()
+	}
+	calllog.Record(c)
+}
+
 // getCredentialsConfigData reads credential data for IBM Cloud.
 func (d *driver) getCredentialsConfigData() (string, error) {
 	// Look for a user defined secret to get the IBM Cloud credentials from first
@@ -1,9 +1,7 @@
 package ibmcos
 
 import (
-	"bytes"
 	"context"
-	"io"
 	"net/http"
 	"path/filepath"
 	"testing"
@@ -20,6 +18,7 @@ import (
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
 )
 
 func TestConfigEnv(t *testing.T) {
@@ -300,12 +299,12 @@ func TestStorageManagementState(t *testing.T) {
 	} {
 		// Test for each management state
 		t.Run(tt.name, func(t *testing.T) {
-			rt := &tripper{}
+			rt := &httpmock.Transport{}
 			if len(tt.responseCodes) == 0 {
-				rt.AddResponse(http.StatusOK, "{}")
+				rt.AddJSONResponse(http.StatusOK, "{}")
 			} else {
 				for i, code := range tt.responseCodes {
-					rt.AddResponse(code, tt.responseBodies[i])
+					rt.AddJSONResponse(code, tt.responseBodies[i])
 				}
 			}
 
@@ -314,7 +313,7 @@ func TestStorageManagementState(t *testing.T) {
 			drv.roundTripper = rt
 			drv.resourceController = &resourcecontrollerv2.ResourceControllerV2{
 				Service: &core.BaseService{
-					Client: &http.Client{Transport: rt},
+					Client: rt.Client(),
 					Options: &core.ServiceOptions{
 						URL:           "http://nowhere.cloud",
 						Authenticator: &core.NoAuthAuthenticator{},
@@ -323,7 +322,7 @@ func TestStorageManagementState(t *testing.T) {
 			}
 			drv.resourceManager = &resourcemanagerv2.ResourceManagerV2{
 				Service: &core.BaseService{
-					Client: &http.Client{Transport: rt},
+					Client: rt.Client(),
 					Options: &core.ServiceOptions{
 						URL:           "http://nowhere.cloud",
 						Authenticator: &core.NoAuthAuthenticator{},
@@ -346,26 +345,3 @@ func TestStorageManagementState(t *testing.T) {
 		})
 	}
 }
-
-type tripper struct {
-	req            int
-	responseCodes  []int
-	responseBodies []string
-}
-
-func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	defer func() {
-		r.req++
-	}()
-
-	return &http.Response{
-		StatusCode: r.responseCodes[r.req],
-		Header:     http.Header{"Content-Type": {"application/json"}},
-		Body:       io.NopCloser(bytes.NewBufferString(r.responseBodies[r.req])),
-	}, nil
-}
-
-func (r *tripper) AddResponse(code int, body string) {
-	r.responseCodes = append(r.responseCodes, code)
-	r.responseBodies = append(r.responseBodies, body)
-}
@@ -0,0 +1,127 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BlobsPrefix is the path, relative to the storage root, where the registry
+// keeps layer and config blobs.
+const BlobsPrefix = "docker/registry/v2/blobs/"
+
+// ShardsPrefix is the path, relative to the storage root, under which the
+// registry shards keep their storage, in a directory per shard.
+const ShardsPrefix = "shards/"
+
+// Prefixes are the paths, relative to the storage root, that have to be
+// listed to find all blobs, including the ones of the registry shards.
+var Prefixes = []string{BlobsPrefix, ShardsPrefix}
+
+// IsBlob returns true if key, relative to the storage root, is a blob of the
+// registry or of one of its shards.
+func IsBlob(key string) bool {
+	if strings.HasPrefix(key, BlobsPrefix) {
+		return true
+	}
+	if !strings.HasPrefix(key, ShardsPrefix) {
+		return false
+	}
+	i := strings.Index(key[len(ShardsPrefix):], "/")
+	if i <= 0 {
+		return false
+	}
+	return strings.HasPrefix(key[len(ShardsPrefix)+i+1:], BlobsPrefix)
+}
+
+// sizeBuckets holds the upper bounds, in bytes, of the buckets used to build
+// the blob size histogram. Blobs bigger than the last bound are accounted in
+// the "+Inf" bucket.
+var sizeBuckets = []struct {
+	Name  string
+	Bound int64
+}{
+	{"1Mi", 1 << 20},
+	{"10Mi", 10 << 20},
+	{"100Mi", 100 << 20},
+	{"1Gi", 1 << 30},
+}
+
+// Report holds the result of a storage inventory run.
+type Report struct {
+	// Time is the moment the inventory finished.
+	Time time.Time `json:"time"`
+	// Storage is the type of the storage that was inventoried.
+	Storage string `json:"storage"`
+	// Objects is the number of blobs found in the storage.
+	Objects int64 `json:"objects"`
+	// Bytes is the sum of the sizes of all blobs found in the storage.
+	Bytes int64 `json:"bytes"`
+	// Sizes is a histogram of blob sizes, indexed by bucket name. Buckets are
+	// not cumulative.
+	Sizes map[string]int64 `json:"sizes"`
+}
+
+// NewReport returns an empty report for the given storage type.
+func NewReport(storage string) *Report {
+	sizes := map[string]int64{"+Inf": 0}
+	for _, b := range sizeBuckets {
+		sizes[b.Name] = 0
+	}
+	return &Report{
+		Storage: storage,
+		Sizes:   sizes,
+	}
+}
+
+// Add accounts a blob of the given size in the report.
+func (r *Report) Add(size int64) {
+	r.Objects++
+	r.Bytes += size
+	for _, b := range sizeBuckets {
+		if size <= b.Bound {
+			r.Sizes[b.Name]++
+			return
+		}
+	}
+	r.Sizes["+Inf"]++
+}
+
+// Inventorier is implemented by storage drivers that are able to list the
+// blobs they hold.
+type Inventorier interface {
+	// Inventory walks through all blobs in the storage and accounts them
+	// in the provided report.
+	Inventory(ctx context.Context, report *Report) error
+}
+
+// ErrNotSupported is returned when the storage driver in use can't be
+// inventoried.
+type ErrNotSupported struct {
+	Storage string
+}
+
+func (e *ErrNotSupported) Error() string {
+	return fmt.Sprintf("storage inventory is not supported for %s", e.Storage)
+}
+
+// ReportLocation points to the inventory reports generated by the storage
+// provider itself.
+type ReportLocation struct {
+	// Bucket is where the reports are delivered. When empty, the bucket
+	// used by the registry is assumed.
+	Bucket string
+	// Prefix is the path under which the reports for the registry bucket
+	// are delivered.
+	Prefix string
+}
+
+// ReportReader is implemented by storage drivers that can account blobs
+// using the inventory reports generated by the storage provider. This is
+// much cheaper than listing very big buckets.
+type ReportReader interface {
+	// InventoryFromReports accounts the blobs found in the most recent
+	// inventory report delivered to location.
+	InventoryFromReports(ctx context.Context, report *Report, location ReportLocation) error
+}
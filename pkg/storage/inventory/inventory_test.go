@@ -0,0 +1,47 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReportAdd(t *testing.T) {
+	r := NewReport("S3")
+	for _, size := range []int64{0, 1 << 20, 1<<20 + 1, 50 << 20, 2 << 30} {
+		r.Add(size)
+	}
+
+	if r.Objects != 5 {
+		t.Errorf("got %d objects, want 5", r.Objects)
+	}
+	if want := int64(1<<20 + 1<<20 + 1 + 50<<20 + 2<<30); r.Bytes != want {
+		t.Errorf("got %d bytes, want %d", r.Bytes, want)
+	}
+
+	expected := map[string]int64{
+		"1Mi":   2,
+		"10Mi":  1,
+		"100Mi": 1,
+		"1Gi":   0,
+		"+Inf":  1,
+	}
+	if !reflect.DeepEqual(r.Sizes, expected) {
+		t.Errorf("got sizes %v, want %v", r.Sizes, expected)
+	}
+}
+
+func TestIsBlob(t *testing.T) {
+	for key, expected := range map[string]bool{
+		"docker/registry/v2/blobs/sha256/aa/aaaa/data":                      true,
+		"docker/registry/v2/repositories/foo/_layers/sha256/aaaa/link":      false,
+		"shards/team-a/docker/registry/v2/blobs/sha256/aa/aaaa/data":        true,
+		"shards/team-a/docker/registry/v2/repositories/foo/_manifests/link": false,
+		"shards/docker/registry/v2/blobs/sha256/aa/aaaa/data":               false,
+		"shards//docker/registry/v2/blobs/sha256/aa/aaaa/data":              false,
+		"other/docker/registry/v2/blobs/sha256/aa/aaaa/data":                false,
+	} {
+		if got := IsBlob(key); got != expected {
+			t.Errorf("IsBlob(%q) = %t, want %t", key, got, expected)
+		}
+	}
+}
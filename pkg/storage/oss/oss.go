@@ -26,6 +26,7 @@ import (
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/faultinject"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
@@ -56,6 +57,11 @@ func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorag
 	}
 }
 
+// CredentialsSource returns how the Alibaba Cloud credentials are sourced.
+func (d *driver) CredentialsSource() (util.CredentialsSource, error) {
+	return util.GetCredentialsSource(d.Listers.Secrets, util.MintedCredentials)
+}
+
 func (d *driver) CABundle() (string, bool, error) {
 	return "", true, nil
 }
@@ -184,6 +190,10 @@ func (d *driver) getOSSService() (*oss.Client, error) {
 	clientOptions := []oss.ClientOption{}
 	if d.roundTripper != nil {
 		clientOptions = append(clientOptions, oss.HTTPClient(&http.Client{Transport: d.roundTripper}))
+	} else if faultinject.Default() != nil {
+		// the SDK builds its own transport unless it is given a client,
+		// it is only replaced when faults are injected.
+		clientOptions = append(clientOptions, oss.HTTPClient(&http.Client{Transport: faultinject.Wrap("OSS", http.DefaultTransport)}))
 	}
 
 	return oss.New(endpoint, d.credentials.AccessKeyId, d.credentials.AccessKeySecret, clientOptions...)
@@ -323,6 +333,42 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
+// PlanStorage returns the bucket CreateStorage would create, along with
+// its tags.
+func (d *driver) PlanStorage(cr *imageregistryv1.Config) ([]util.PlannedResource, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.UpdateEffectiveConfig(); err != nil {
+		return nil, err
+	}
+
+	name := d.Config.Bucket
+	if name == "" {
+		if name, err = util.PlannedStorageName(d.Listers, d.Config.Region); err != nil {
+			return nil, err
+		}
+	}
+
+	tags := map[string]string{
+		"kubernetes.io/cluster/" + infra.Status.InfrastructureName: "owned",
+		"Name": infra.Status.InfrastructureName + "-image-registry",
+		"sigs.k8s.io/cloud-provider-alibaba/origin": "ocp",
+		"GISV": "ocp",
+	}
+	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.AlibabaCloud != nil {
+		for _, tag := range infra.Status.PlatformStatus.AlibabaCloud.ResourceTags {
+			tags[tag.Key] = tag.Value
+		}
+	}
+
+	return []util.PlannedResource{
+		{Kind: "OSS bucket", Name: name, Region: d.Config.Region, Tags: tags},
+	}, nil
+}
+
 // CreateStorage attempts to create an OSS bucket
 // and apply any provided tags
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
@@ -659,3 +705,13 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 func (d *driver) ID() string {
 	return d.Config.Bucket
 }
+
+// Capabilities returns what OSS supports.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiReplica:           true,
+		Redirect:               true,
+		EncryptionAtRestConfig: true,
+		Tagging:                true,
+	}
+}
@@ -0,0 +1,247 @@
+package pvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageAutoscalingCondition reports whether the registry claim is being
+// expanded as it fills up.
+const storageAutoscalingCondition = "StorageAutoscaling"
+
+// defaultAutoscalingThreshold is the volume usage, in percent, above which
+// the claim is expanded when no threshold is set.
+const defaultAutoscalingThreshold = 80
+
+// expansionRequestedAnnotation records on the claim when the operator last
+// expanded it.
+const expansionRequestedAnnotation = "imageregistry.openshift.io/expansion-requested"
+
+// expansionTimeout is for how long an expansion can be in progress before it
+// is reported as stuck.
+const expansionTimeout = 30 * time.Minute
+
+// Autoscaling configures the expansion of the registry claim as its volume
+// fills up. The claim is expanded by Increment every time the volume usage
+// crosses ThresholdPercent, until it reaches MaxSize. The storage class of
+// the claim has to allow volume expansion. Only the claims created by the
+// operator are expanded, the size of the claims provided by the user is left
+// to them.
+type Autoscaling struct {
+	// ThresholdPercent is the volume usage, in percent of its capacity,
+	// above which the claim is expanded. Defaults to 80.
+	ThresholdPercent int32 `json:"thresholdPercent,omitempty"`
+	// Increment is the size added to the claim on each expansion.
+	Increment resource.Quantity `json:"increment"`
+	// MaxSize is the size the claim is never expanded beyond.
+	MaxSize resource.Quantity `json:"maxSize"`
+}
+
+// getAutoscaling returns the autoscaling set in the storage.pvc.autoscaling
+// section of the unsupported config overrides, or nil if there is none.
+func getAutoscaling(cr *imageregistryv1.Config) (*Autoscaling, error) {
+	overrides, err := getPVCOverrides(cr)
+	if err != nil || overrides == nil || overrides.Autoscaling == nil {
+		return nil, err
+	}
+
+	autoscaling := overrides.Autoscaling
+	if autoscaling.ThresholdPercent == 0 {
+		autoscaling.ThresholdPercent = defaultAutoscalingThreshold
+	}
+	if autoscaling.ThresholdPercent < 1 || autoscaling.ThresholdPercent > 99 {
+		return nil, fmt.Errorf("invalid storage autoscaling threshold %d%%: must be between 1 and 99", autoscaling.ThresholdPercent)
+	}
+	if autoscaling.Increment.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid storage autoscaling increment %s: must be positive", autoscaling.Increment.String())
+	}
+	if autoscaling.MaxSize.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid storage autoscaling max size %s: must be positive", autoscaling.MaxSize.String())
+	}
+	return autoscaling, nil
+}
+
+// thanosQuerierURL is the query endpoint of the tenancy port of the cluster
+// monitoring Thanos Querier. It only returns the series of the namespace set
+// in the request, which the operator is allowed to read.
+const thanosQuerierURL = "https://thanos-querier.openshift-monitoring.svc:9092/api/v1/query"
+
+// serviceCAFile is the service CA bundle mounted in the pods, it signs the
+// certificate of the Thanos Querier.
+const serviceCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+
+// prometheusResponse holds the fields of the response to a Prometheus
+// instant query that returns a vector.
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Data   struct {
+		Result []struct {
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// queryVolumeStat returns the value of the kubelet volume stats metric for
+// the claim.
+func queryVolumeStat(ctx context.Context, client *http.Client, endpoint, namespace, metric, claim string) (uint64, error) {
+	query := fmt.Sprintf("max(%s{namespace=%q,persistentvolumeclaim=%q})", metric, namespace, claim)
+	params := url.Values{"namespace": {namespace}, "query": {query}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result prometheusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("unable to decode the result of %s (%s): %w", query, resp.Status, err)
+	}
+	if result.Status != "success" {
+		return 0, fmt.Errorf("query %s failed (%s): %s", query, resp.Status, result.Error)
+	}
+	if len(result.Data.Result) == 0 {
+		return 0, fmt.Errorf("no %s series for claim %s", metric, claim)
+	}
+	value := result.Data.Result[0].Value
+	if len(value) != 2 {
+		return 0, fmt.Errorf("unexpected value %v for %s", value, query)
+	}
+	s, ok := value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected value %v for %s", value, query)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected value %v for %s: %w", value, query, err)
+	}
+	return uint64(f), nil
+}
+
+// prometheusVolumeUsage returns the used and total bytes of the volume
+// backing the claim, from the kubelet volume stats collected by the cluster
+// monitoring.
+func (d *driver) prometheusVolumeUsage(ctx context.Context, claim string) (uint64, uint64, error) {
+	cfg := rest.CopyConfig(d.kubeconfig)
+	cfg.TLSClientConfig = rest.TLSClientConfig{CAFile: serviceCAFile}
+	rt, err := rest.TransportFor(cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	client := &http.Client{Transport: rt, Timeout: 30 * time.Second}
+
+	used, err := queryVolumeStat(ctx, client, thanosQuerierURL, d.Namespace, "kubelet_volume_stats_used_bytes", claim)
+	if err != nil {
+		return 0, 0, err
+	}
+	capacity, err := queryVolumeStat(ctx, client, thanosQuerierURL, d.Namespace, "kubelet_volume_stats_capacity_bytes", claim)
+	if err != nil {
+		return 0, 0, err
+	}
+	if capacity == 0 {
+		return 0, 0, fmt.Errorf("the capacity of the volume of claim %s is reported as 0", claim)
+	}
+	return used, capacity, nil
+}
+
+// AutoscaleStorage expands the registry claim by the configured increment
+// when the usage of its volume crosses the threshold, up to the max size.
+// Failures to get the usage or to expand the claim are reported in the
+// StorageAutoscaling condition, only invalid settings are returned as
+// errors.
+func (d *driver) AutoscaleStorage(cr *imageregistryv1.Config) (string, error) {
+	autoscaling, err := getAutoscaling(cr)
+	if err != nil {
+		return "", err
+	}
+	if autoscaling == nil {
+		return "", nil
+	}
+
+	ctx := context.TODO()
+	claim, err := d.Client.PersistentVolumeClaims(d.Namespace).Get(ctx, d.Config.Claim, metav1.GetOptions{})
+	if err != nil {
+		util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionUnknown, "ClaimUnavailable", err.Error())
+		return "", nil
+	}
+
+	if !pvcIsCreatedByOperator(claim) {
+		util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionFalse, "NotManaged",
+			fmt.Sprintf("PVC %s was not created by the operator, it is not expanded automatically", claim.Name))
+		return "", nil
+	}
+
+	requested := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	if capacity, ok := claim.Status.Capacity[corev1.ResourceStorage]; ok && capacity.Cmp(requested) < 0 {
+		since, err := time.Parse(time.RFC3339, claim.Annotations[expansionRequestedAnnotation])
+		if err == nil && time.Since(since) > expansionTimeout {
+			util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionFalse, "ExpansionStuck",
+				fmt.Sprintf("PVC %s has not been expanded from %s to %s since %s, check the conditions and events of the claim", claim.Name, capacity.String(), requested.String(), since.Format(time.RFC3339)))
+			return "", nil
+		}
+		util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionTrue, "ExpansionInProgress",
+			fmt.Sprintf("PVC %s is being expanded from %s to %s", claim.Name, capacity.String(), requested.String()))
+		return "", nil
+	}
+
+	used, total, err := d.volumeUsage(ctx, claim.Name)
+	if err != nil {
+		util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionUnknown, "UsageUnknown",
+			fmt.Sprintf("Unable to get the usage of the volume of PVC %s: %s", claim.Name, err))
+		return "", nil
+	}
+	metrics.ReportStorageVolumeUsage(used, total)
+
+	usage := used * 100 / total
+	if usage < uint64(autoscaling.ThresholdPercent) {
+		util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The volume of PVC %s is %d%% full", claim.Name, usage))
+		return "", nil
+	}
+
+	if requested.Cmp(autoscaling.MaxSize) >= 0 {
+		util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionFalse, "MaxSizeReached",
+			fmt.Sprintf("The volume of PVC %s is %d%% full and the claim reached the max size %s", claim.Name, usage, autoscaling.MaxSize.String()))
+		return "", nil
+	}
+
+	size := requested.DeepCopy()
+	size.Add(autoscaling.Increment)
+	if size.Cmp(autoscaling.MaxSize) > 0 {
+		size = autoscaling.MaxSize.DeepCopy()
+	}
+
+	claim = claim.DeepCopy()
+	claim.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	claim.Annotations[expansionRequestedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	if _, err := d.Client.PersistentVolumeClaims(d.Namespace).Update(ctx, claim, metav1.UpdateOptions{}); err != nil {
+		util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionFalse, "ExpansionFailed",
+			fmt.Sprintf("Unable to expand PVC %s to %s, the storage class of the claim may not allow volume expansion: %s", claim.Name, size.String(), err))
+		return "", nil
+	}
+	metrics.StorageVolumeExpanded()
+
+	msg := fmt.Sprintf("PVC %s was expanded from %s to %s as its volume was %d%% full", claim.Name, requested.String(), size.String(), usage)
+	util.UpdateCondition(cr, storageAutoscalingCondition, operatorapi.ConditionTrue, "Expanded", msg)
+	return msg, nil
+}
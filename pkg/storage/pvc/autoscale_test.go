@@ -0,0 +1,289 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func TestAutoscaleStorage(t *testing.T) {
+	const namespace = "openshift-image-registry"
+	const autoscaling = `{"storage":{"pvc":{"autoscaling":{"increment":"50Gi","maxSize":"220Gi"}}}}`
+
+	for _, tt := range []struct {
+		name         string
+		overrides    string
+		userProvided bool
+		requestedAgo time.Duration
+		requested    string
+		capacity     string
+		used         uint64
+		usageErr     error
+		size         string
+		reason       string
+		status       operatorapi.ConditionStatus
+		expanded     bool
+		err          string
+	}{
+		{
+			name:      "disabled",
+			requested: "100Gi",
+			capacity:  "100Gi",
+			used:      99,
+			size:      "100Gi",
+		},
+		{
+			name:      "below threshold",
+			overrides: autoscaling,
+			requested: "100Gi",
+			capacity:  "100Gi",
+			used:      79,
+			size:      "100Gi",
+			reason:    "AsExpected",
+			status:    operatorapi.ConditionTrue,
+		},
+		{
+			name:      "above threshold",
+			overrides: autoscaling,
+			requested: "100Gi",
+			capacity:  "100Gi",
+			used:      85,
+			size:      "150Gi",
+			reason:    "Expanded",
+			status:    operatorapi.ConditionTrue,
+			expanded:  true,
+		},
+		{
+			name:      "custom threshold",
+			overrides: `{"storage":{"pvc":{"autoscaling":{"thresholdPercent":90,"increment":"50Gi","maxSize":"220Gi"}}}}`,
+			requested: "100Gi",
+			capacity:  "100Gi",
+			used:      85,
+			size:      "100Gi",
+			reason:    "AsExpected",
+			status:    operatorapi.ConditionTrue,
+		},
+		{
+			name:      "capped by the max size",
+			overrides: autoscaling,
+			requested: "200Gi",
+			capacity:  "200Gi",
+			used:      90,
+			size:      "220Gi",
+			reason:    "Expanded",
+			status:    operatorapi.ConditionTrue,
+			expanded:  true,
+		},
+		{
+			name:      "max size reached",
+			overrides: autoscaling,
+			requested: "220Gi",
+			capacity:  "220Gi",
+			used:      95,
+			size:      "220Gi",
+			reason:    "MaxSizeReached",
+			status:    operatorapi.ConditionFalse,
+		},
+		{
+			name:         "expansion in progress",
+			overrides:    autoscaling,
+			requestedAgo: 5 * time.Minute,
+			requested:    "150Gi",
+			capacity:     "100Gi",
+			used:         95,
+			size:         "150Gi",
+			reason:       "ExpansionInProgress",
+			status:       operatorapi.ConditionTrue,
+		},
+		{
+			name:         "expansion stuck",
+			overrides:    autoscaling,
+			requestedAgo: time.Hour,
+			requested:    "150Gi",
+			capacity:     "100Gi",
+			used:         95,
+			size:         "150Gi",
+			reason:       "ExpansionStuck",
+			status:       operatorapi.ConditionFalse,
+		},
+		{
+			name:         "user provided claim",
+			overrides:    autoscaling,
+			userProvided: true,
+			requested:    "100Gi",
+			capacity:     "100Gi",
+			used:         95,
+			size:         "100Gi",
+			reason:       "NotManaged",
+			status:       operatorapi.ConditionFalse,
+		},
+		{
+			name:      "usage unknown",
+			overrides: autoscaling,
+			requested: "100Gi",
+			capacity:  "100Gi",
+			usageErr:  fmt.Errorf("no kubelet_volume_stats_used_bytes series for claim image-registry-storage"),
+			size:      "100Gi",
+			reason:    "UsageUnknown",
+			status:    operatorapi.ConditionUnknown,
+		},
+		{
+			name:      "invalid increment",
+			overrides: `{"storage":{"pvc":{"autoscaling":{"maxSize":"220Gi"}}}}`,
+			requested: "100Gi",
+			capacity:  "100Gi",
+			size:      "100Gi",
+			err:       "invalid storage autoscaling increment",
+		},
+		{
+			name:      "invalid threshold",
+			overrides: `{"storage":{"pvc":{"autoscaling":{"thresholdPercent":100,"increment":"50Gi","maxSize":"220Gi"}}}}`,
+			requested: "100Gi",
+			capacity:  "100Gi",
+			size:      "100Gi",
+			err:       "invalid storage autoscaling threshold",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "image-registry-storage",
+					Namespace: namespace,
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse(tt.requested),
+						},
+					},
+				},
+				Status: corev1.PersistentVolumeClaimStatus{
+					Capacity: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse(tt.capacity),
+					},
+				},
+			}
+			if !tt.userProvided {
+				claim.Annotations = map[string]string{PVCOwnerAnnotation: "true"}
+			}
+			if tt.requestedAgo != 0 {
+				claim.Annotations[expansionRequestedAnnotation] = time.Now().Add(-tt.requestedAgo).UTC().Format(time.RFC3339)
+			}
+			cliset := fake.NewSimpleClientset(claim)
+
+			drv := &driver{
+				Namespace: namespace,
+				Config:    &imageregistryv1.ImageRegistryConfigStoragePVC{Claim: claim.Name},
+				Client:    cliset.CoreV1(),
+				volumeUsage: func(ctx context.Context, name string) (uint64, uint64, error) {
+					if name != claim.Name {
+						t.Errorf("got usage request for claim %s, want %s", name, claim.Name)
+					}
+					return tt.used, 100, tt.usageErr
+				},
+			}
+			cr := &imageregistryv1.Config{}
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+
+			expansion, err := drv.AutoscaleStorage(cr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := expansion != ""; got != tt.expanded {
+				t.Errorf("got expansion %q, want expanded %t", expansion, tt.expanded)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, storageAutoscalingCondition)
+			if tt.reason == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Reason != tt.reason || cond.Status != tt.status {
+				t.Errorf("got condition %#v, want reason %s and status %s", cond, tt.reason, tt.status)
+			}
+
+			updated, err := cliset.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := updated.Spec.Resources.Requests[corev1.ResourceStorage]
+			if want := resource.MustParse(tt.size); size.Cmp(want) != 0 {
+				t.Errorf("got claim size %s, want %s", size.String(), want.String())
+			}
+			if tt.expanded && updated.Annotations[expansionRequestedAnnotation] == "" {
+				t.Errorf("got annotations %v, want the expansion request to be recorded", updated.Annotations)
+			}
+		})
+	}
+}
+
+func TestQueryVolumeStat(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		response string
+		expected uint64
+		err      string
+	}{
+		{
+			name:     "value",
+			response: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1760000000,"53687091200"]}]}}`,
+			expected: 53687091200,
+		},
+		{
+			name:     "no series",
+			response: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			err:      "no kubelet_volume_stats_used_bytes series",
+		},
+		{
+			name:     "query error",
+			response: `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+			err:      "parse error",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ns := r.URL.Query().Get("namespace"); ns != "openshift-image-registry" {
+					t.Errorf("got namespace %q, want openshift-image-registry", ns)
+				}
+				want := `max(kubelet_volume_stats_used_bytes{namespace="openshift-image-registry",persistentvolumeclaim="image-registry-storage"})`
+				if q := r.URL.Query().Get("query"); q != want {
+					t.Errorf("got query %q, want %q", q, want)
+				}
+				fmt.Fprint(w, tt.response)
+			}))
+			defer server.Close()
+
+			got, err := queryVolumeStat(context.Background(), server.Client(), server.URL, "openshift-image-registry", "kubelet_volume_stats_used_bytes", "image-registry-storage")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
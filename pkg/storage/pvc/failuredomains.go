@@ -0,0 +1,155 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// failoverClaimSuffix is appended to the name of the registry claim to name
+// the claim of the failover replica.
+const failoverClaimSuffix = "-failover"
+
+// FailureDomains runs the registry in two zones without object storage.
+// The registry deployment is pinned to the first zone and uses the registry
+// claim, a failover deployment is pinned to the second zone and uses its own
+// claim, provisioned by the operator with the same spec as the registry
+// claim. The volume of the registry claim has to be reachable from the first
+// zone, and the storage class should bind volumes on first consumer so the
+// failover claim is provisioned in the second zone.
+//
+// The claims are not replicated: each replica only serves the images pushed
+// through it.
+type FailureDomains struct {
+	// Zones are the two zones, as set in the topology.kubernetes.io/zone
+	// label of the nodes, the registry replicas are pinned to.
+	Zones []string `json:"zones"`
+}
+
+// getFailureDomains returns the failure domains set in the
+// storage.pvc.failureDomains section of the unsupported config overrides, or
+// nil if there are none.
+func getFailureDomains(cr *imageregistryv1.Config) (*FailureDomains, error) {
+	overrides, err := getPVCOverrides(cr)
+	if err != nil || overrides == nil || overrides.FailureDomains == nil {
+		return nil, err
+	}
+
+	zones := overrides.FailureDomains.Zones
+	if len(zones) != 2 {
+		return nil, fmt.Errorf("invalid storage failure domains: exactly two zones are required, got %d", len(zones))
+	}
+	if zones[0] == "" || zones[1] == "" {
+		return nil, fmt.Errorf("invalid storage failure domains: zone names cannot be empty")
+	}
+	if zones[0] == zones[1] {
+		return nil, fmt.Errorf("invalid storage failure domains: the zones have to be distinct, got %s twice", zones[0])
+	}
+	if cr.Spec.Replicas > 1 {
+		return nil, fmt.Errorf("invalid storage failure domains: a single replica runs in each zone, the registry cannot be scaled to %d replicas", cr.Spec.Replicas)
+	}
+	return overrides.FailureDomains, nil
+}
+
+// failoverClaimName returns the name of the claim of the failover replica.
+func failoverClaimName(claim string) string {
+	return claim + failoverClaimSuffix
+}
+
+// FailureDomains returns the zones the registry replicas are pinned to,
+// along with the claims holding their storage.
+func (d *driver) FailureDomains(cr *imageregistryv1.Config) ([]util.FailureDomain, error) {
+	fd, err := getFailureDomains(cr)
+	if err != nil || fd == nil {
+		return nil, err
+	}
+
+	claim := d.Config.Claim
+	if claim == "" {
+		claim = defaults.PVCImageRegistryName
+	}
+	return []util.FailureDomain{
+		{Zone: fd.Zones[0], Claim: claim},
+		{Zone: fd.Zones[1], Claim: failoverClaimName(claim)},
+	}, nil
+}
+
+// syncFailoverClaim provisions the claim of the failover replica from the
+// spec of the registry claim when the registry runs in two zones. The
+// claim is kept once the registry runs in a single zone again, the images
+// it holds would be lost otherwise.
+func (d *driver) syncFailoverClaim(cr *imageregistryv1.Config, claim *corev1.PersistentVolumeClaim) error {
+	fd, err := getFailureDomains(cr)
+	if err != nil || fd == nil {
+		return err
+	}
+
+	name := failoverClaimName(claim.Name)
+	_, err = d.Client.PersistentVolumeClaims(d.Namespace).Get(
+		context.TODO(), name, metav1.GetOptions{},
+	)
+	if err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+
+	failover := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: d.Namespace,
+			Annotations: map[string]string{
+				PVCOwnerAnnotation: "true",
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      claim.Spec.AccessModes,
+			StorageClassName: claim.Spec.StorageClassName,
+			VolumeMode:       claim.Spec.VolumeMode,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: claim.Spec.Resources.Requests[corev1.ResourceStorage],
+				},
+			},
+		},
+	}
+	if _, err := d.Client.PersistentVolumeClaims(d.Namespace).Create(
+		context.TODO(), failover, metav1.CreateOptions{},
+	); err != nil {
+		return fmt.Errorf("unable to create the claim %s of the failover replica: %w", name, err)
+	}
+	klog.Infof("created the claim %s of the registry replica in the zone %s", name, fd.Zones[1])
+	return nil
+}
+
+// removeFailoverClaim deletes the claim of the failover replica if it was
+// provisioned by the operator.
+func (d *driver) removeFailoverClaim(claim string) error {
+	name := failoverClaimName(claim)
+	failover, err := d.Client.PersistentVolumeClaims(d.Namespace).Get(
+		context.TODO(), name, metav1.GetOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !pvcIsCreatedByOperator(failover) {
+		return nil
+	}
+
+	err = d.Client.PersistentVolumeClaims(d.Namespace).Delete(
+		context.TODO(), name, metav1.DeleteOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
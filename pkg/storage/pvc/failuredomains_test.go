@@ -0,0 +1,141 @@
+package pvc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestGetFailureDomains(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		overrides string
+		replicas  int32
+		zones     []string
+		err       string
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:      "two zones",
+			overrides: `{"storage":{"pvc":{"failureDomains":{"zones":["zone-a","zone-b"]}}}}`,
+			replicas:  1,
+			zones:     []string{"zone-a", "zone-b"},
+		},
+		{
+			name:      "single zone",
+			overrides: `{"storage":{"pvc":{"failureDomains":{"zones":["zone-a"]}}}}`,
+			err:       "exactly two zones are required, got 1",
+		},
+		{
+			name:      "same zone",
+			overrides: `{"storage":{"pvc":{"failureDomains":{"zones":["zone-a","zone-a"]}}}}`,
+			err:       "the zones have to be distinct",
+		},
+		{
+			name:      "scaled registry",
+			overrides: `{"storage":{"pvc":{"failureDomains":{"zones":["zone-a","zone-b"]}}}}`,
+			replicas:  2,
+			err:       "cannot be scaled to 2 replicas",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Replicas = tt.replicas
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(tt.overrides)}
+
+			fd, err := getFailureDomains(cr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var zones []string
+			if fd != nil {
+				zones = fd.Zones
+			}
+			if strings.Join(zones, ",") != strings.Join(tt.zones, ",") {
+				t.Errorf("got zones %v, want %v", zones, tt.zones)
+			}
+		})
+	}
+}
+
+func TestSyncFailoverClaim(t *testing.T) {
+	storageClass := "topolvm"
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "openshift-image-registry",
+			Name:      defaults.PVCImageRegistryName,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &storageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("200Gi")},
+			},
+		},
+	}
+	cliset := fake.NewSimpleClientset(claim)
+	drv := &driver{
+		Namespace: "openshift-image-registry",
+		Config:    &imageregistryv1.ImageRegistryConfigStoragePVC{Claim: defaults.PVCImageRegistryName},
+		Client:    cliset.CoreV1(),
+	}
+
+	cr := &imageregistryv1.Config{}
+	cr.Spec.Replicas = 1
+	cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{Raw: []byte(`{"storage":{"pvc":{"failureDomains":{"zones":["zone-a","zone-b"]}}}}`)}
+
+	domains, err := drv.FailureDomains(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 2 || domains[0].Zone != "zone-a" || domains[0].Claim != defaults.PVCImageRegistryName ||
+		domains[1].Zone != "zone-b" || domains[1].Claim != defaults.PVCImageRegistryName+failoverClaimSuffix {
+		t.Errorf("got failure domains %+v", domains)
+	}
+
+	if err := drv.syncFailoverClaim(cr, claim); err != nil {
+		t.Fatal(err)
+	}
+	failover, err := cliset.CoreV1().PersistentVolumeClaims("openshift-image-registry").Get(context.Background(), defaults.PVCImageRegistryName+failoverClaimSuffix, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pvcIsCreatedByOperator(failover) {
+		t.Errorf("the failover claim is not annotated as created by the operator")
+	}
+	if failover.Spec.StorageClassName == nil || *failover.Spec.StorageClassName != storageClass {
+		t.Errorf("got storage class %v, want %s", failover.Spec.StorageClassName, storageClass)
+	}
+	if size := failover.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "200Gi" {
+		t.Errorf("got size %s, want 200Gi", size.String())
+	}
+
+	// the existing claim is left alone.
+	if err := drv.syncFailoverClaim(cr, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := drv.removeFailoverClaim(defaults.PVCImageRegistryName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cliset.CoreV1().PersistentVolumeClaims("openshift-image-registry").Get(context.Background(), defaults.PVCImageRegistryName+failoverClaimSuffix, metav1.GetOptions{}); err == nil {
+		t.Errorf("the failover claim was not removed")
+	}
+}
@@ -0,0 +1,214 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// filesystemProbeCondition reports whether the filesystem backing the
+	// claim has the semantics the registry relies on.
+	filesystemProbeCondition = "FilesystemSemantics"
+
+	// filesystemProbeAnnotation records the result of the probe on the
+	// claim, so it runs once per claim. It is either Passed or Failed
+	// followed by the problem that was found, removing it runs the probe
+	// again.
+	filesystemProbeAnnotation = "imageregistry.openshift.io/filesystem-probe"
+
+	filesystemProbePassed = "Passed"
+	filesystemProbeFailed = "Failed"
+
+	filesystemProbeJobName = "image-registry-filesystem-probe"
+
+	// filesystemProbeDeadline bounds how long the probe job can run, a
+	// probe stuck on an unresponsive filesystem fails once it is reached.
+	filesystemProbeDeadline = int64(600)
+)
+
+// filesystemProbeScript checks the operations the registry uses to commit
+// blobs and tags are honored by the filesystem: fsync, exclusive file
+// creation (O_EXCL, used by the shell noclobber option) and rename. Some
+// NFS setups silently ignore them, which corrupts the registry data once
+// several replicas write to it.
+const filesystemProbeScript = `set -u
+dir="` + rootDirectory + `/.filesystem-probe-$HOSTNAME"
+fail() {
+	echo "$1" >/dev/termination-log
+	rm -rf "$dir"
+	exit 1
+}
+rm -rf "$dir"
+mkdir -p "$dir" || fail "unable to create a directory in the volume"
+dd if=/dev/zero of="$dir/fsync" bs=4096 count=16 conv=fsync 2>/dev/null || fail "fsync is not supported by the filesystem"
+(set -C; echo a >"$dir/excl") 2>/dev/null || fail "unable to create a file exclusively"
+if (set -C; echo b >"$dir/excl") 2>/dev/null; then
+	fail "exclusive file creation (O_EXCL) is not honored by the filesystem, existing files are overwritten"
+fi
+echo c >"$dir/tmp" && mv "$dir/tmp" "$dir/renamed" && [ "$(cat "$dir/renamed")" = c ] || fail "rename is not supported by the filesystem"
+rm -rf "$dir"
+`
+
+func (d *driver) filesystemProbeJob() *batchv1.Job {
+	backoffLimit := int32(0)
+	deadline := filesystemProbeDeadline
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      filesystemProbeJobName,
+			Namespace: d.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: defaults.ServiceAccountName,
+					Containers: []corev1.Container{
+						{
+							Name:                     "probe",
+							Image:                    os.Getenv("IMAGE"),
+							Command:                  []string{"/bin/sh", "-c", filesystemProbeScript},
+							TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "registry-storage", MountPath: rootDirectory},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "registry-storage",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: d.Config.Claim,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// probeResult returns the result of a finished probe job, or an empty
+// string if the job is still running. The problem found by a failed probe
+// is read from the termination message of its pod.
+func (d *driver) probeResult(job *batchv1.Job) (string, error) {
+	var finished *batchv1.JobCondition
+	for i, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+			finished = &job.Status.Conditions[i]
+		}
+	}
+	if finished == nil {
+		return "", nil
+	}
+	if finished.Type == batchv1.JobComplete {
+		return filesystemProbePassed, nil
+	}
+
+	message := "the probe failed"
+	if finished.Message != "" {
+		message += ": " + finished.Message
+	} else if finished.Reason != "" {
+		message += ": " + finished.Reason
+	}
+	pods, err := d.Client.Pods(job.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "job-name=" + job.Name,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list the pods of the filesystem probe job: %w", err)
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil && status.State.Terminated.Message != "" {
+				message = strings.TrimSpace(status.State.Terminated.Message)
+			}
+		}
+	}
+	return filesystemProbeFailed + ": " + message, nil
+}
+
+// syncFilesystemProbe runs the filesystem probe against the claim when the
+// Filesystem profile is used and reports its result. It returns an error
+// if the registry is configured to run more than one replica before the
+// probe passed.
+func (d *driver) syncFilesystemProbe(cr *imageregistryv1.Config, claim *corev1.PersistentVolumeClaim) error {
+	profile, err := getProfile(cr)
+	if err != nil {
+		return err
+	}
+	if profile == nil || profile.Name != ProfileFilesystem {
+		return nil
+	}
+
+	result := claim.Annotations[filesystemProbeAnnotation]
+	if result == "" {
+		jobs := d.BatchClient.Jobs(d.Namespace)
+		job, err := jobs.Get(context.TODO(), filesystemProbeJobName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			job, err = jobs.Create(context.TODO(), d.filesystemProbeJob(), metav1.CreateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("unable to run the filesystem probe: %w", err)
+		}
+
+		result, err = d.probeResult(job)
+		if err != nil {
+			return err
+		}
+		if result != "" {
+			claim = claim.DeepCopy()
+			if claim.Annotations == nil {
+				claim.Annotations = map[string]string{}
+			}
+			claim.Annotations[filesystemProbeAnnotation] = result
+			if _, err := d.Client.PersistentVolumeClaims(d.Namespace).Update(context.TODO(), claim, metav1.UpdateOptions{}); err != nil {
+				return fmt.Errorf("unable to record the filesystem probe result: %w", err)
+			}
+			propagation := metav1.DeletePropagationBackground
+			if err := jobs.Delete(context.TODO(), job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("unable to delete the filesystem probe job: %w", err)
+			}
+		}
+	}
+
+	switch {
+	case result == filesystemProbePassed:
+		util.UpdateCondition(cr, filesystemProbeCondition, operatorapi.ConditionTrue, "ProbePassed",
+			fmt.Sprintf("The filesystem of PVC %s supports fsync, exclusive file creation and rename", claim.Name))
+		return nil
+	case strings.HasPrefix(result, filesystemProbeFailed):
+		message := fmt.Sprintf("The filesystem of PVC %s is not safe to share between registry replicas: %s; remove the %s annotation of the claim to run the probe again",
+			claim.Name, strings.TrimPrefix(result, filesystemProbeFailed+": "), filesystemProbeAnnotation)
+		util.UpdateCondition(cr, filesystemProbeCondition, operatorapi.ConditionFalse, "ProbeFailed", message)
+		if cr.Spec.Replicas > 1 {
+			return &util.DegradedError{
+				Reason: "FilesystemProbeFailed",
+				Err:    fmt.Errorf("cannot run more than one replica of the image registry: %s", message),
+			}
+		}
+		return nil
+	}
+
+	util.UpdateCondition(cr, filesystemProbeCondition, operatorapi.ConditionUnknown, "Probing",
+		fmt.Sprintf("Verifying the filesystem of PVC %s", claim.Name))
+	if cr.Spec.Replicas > 1 {
+		return fmt.Errorf("waiting for the filesystem probe of PVC %s before running more than one replica of the image registry", claim.Name)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package pvc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestSyncFilesystemProbe(t *testing.T) {
+	const namespace = "openshift-image-registry"
+
+	probeJob := func(finished batchv1.JobConditionType, message string) *batchv1.Job {
+		job := &batchv1.Job{}
+		job.Name = filesystemProbeJobName
+		job.Namespace = namespace
+		if finished != "" {
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: finished, Status: corev1.ConditionTrue, Message: message},
+			}
+		}
+		return job
+	}
+	probePod := func(message string) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Name = filesystemProbeJobName + "-abcde"
+		pod.Namespace = namespace
+		pod.Labels = map[string]string{"job-name": filesystemProbeJobName}
+		pod.Status.Phase = corev1.PodFailed
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}}},
+		}
+		return pod
+	}
+
+	for _, tt := range []struct {
+		name       string
+		replicas   int32
+		annotation string
+		job        *batchv1.Job
+		pod        *corev1.Pod
+		status     operatorapi.ConditionStatus
+		result     string
+		jobExists  bool
+		err        bool
+		degraded   bool
+	}{
+		{
+			name:      "probe started",
+			replicas:  2,
+			status:    operatorapi.ConditionUnknown,
+			jobExists: true,
+			err:       true,
+		},
+		{
+			name:      "probe running with one replica",
+			replicas:  1,
+			job:       probeJob("", ""),
+			status:    operatorapi.ConditionUnknown,
+			jobExists: true,
+		},
+		{
+			name:     "probe passed",
+			replicas: 2,
+			job:      probeJob(batchv1.JobComplete, ""),
+			status:   operatorapi.ConditionTrue,
+			result:   filesystemProbePassed,
+		},
+		{
+			name:     "probe failed",
+			replicas: 2,
+			job:      probeJob(batchv1.JobFailed, "Job has reached the specified backoff limit"),
+			pod:      probePod("exclusive file creation (O_EXCL) is not honored by the filesystem\n"),
+			status:   operatorapi.ConditionFalse,
+			result:   "Failed: exclusive file creation (O_EXCL) is not honored by the filesystem",
+			err:      true,
+			degraded: true,
+		},
+		{
+			name:     "probe timed out",
+			replicas: 1,
+			job:      probeJob(batchv1.JobFailed, "Job was active longer than specified deadline"),
+			status:   operatorapi.ConditionFalse,
+			result:   "Failed: the probe failed: Job was active longer than specified deadline",
+		},
+		{
+			name:       "probe failed with one replica",
+			replicas:   1,
+			annotation: "Failed: fsync is not supported by the filesystem",
+			status:     operatorapi.ConditionFalse,
+			result:     "Failed: fsync is not supported by the filesystem",
+		},
+		{
+			name:       "already passed",
+			replicas:   3,
+			annotation: filesystemProbePassed,
+			status:     operatorapi.ConditionTrue,
+			result:     filesystemProbePassed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "image-registry-storage",
+					Namespace: namespace,
+				},
+			}
+			if tt.annotation != "" {
+				claim.Annotations = map[string]string{filesystemProbeAnnotation: tt.annotation}
+			}
+			objects := []runtime.Object{claim}
+			if tt.job != nil {
+				objects = append(objects, tt.job)
+			}
+			if tt.pod != nil {
+				objects = append(objects, tt.pod)
+			}
+			cliset := fake.NewSimpleClientset(objects...)
+
+			drv := &driver{
+				Namespace:   namespace,
+				Config:      &imageregistryv1.ImageRegistryConfigStoragePVC{Claim: claim.Name},
+				Client:      cliset.CoreV1(),
+				BatchClient: cliset.BatchV1(),
+			}
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Replicas = tt.replicas
+			cr.Spec.UnsupportedConfigOverrides = runtime.RawExtension{
+				Raw: []byte(`{"storage":{"pvc":{"profile":{"name":"Filesystem","storageClassName":"cephfs"}}}}`),
+			}
+
+			err := drv.syncFilesystemProbe(cr, claim)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error %t", err, tt.err)
+			}
+			var degradedErr *util.DegradedError
+			if tt.degraded != errors.As(err, &degradedErr) {
+				t.Errorf("got error %v, want degraded %t", err, tt.degraded)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, filesystemProbeCondition)
+			if cond == nil || cond.Status != tt.status {
+				t.Errorf("got condition %#v, want status %s", cond, tt.status)
+			}
+
+			updated, err := cliset.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := updated.Annotations[filesystemProbeAnnotation]; got != tt.result {
+				t.Errorf("got probe result %q, want %q", got, tt.result)
+			}
+
+			_, err = cliset.BatchV1().Jobs(namespace).Get(context.Background(), filesystemProbeJobName, metav1.GetOptions{})
+			if exists := !kerrors.IsNotFound(err); exists != tt.jobExists {
+				t.Errorf("got probe job exists %t, want %t", exists, tt.jobExists)
+			}
+		})
+	}
+}
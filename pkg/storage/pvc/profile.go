@@ -0,0 +1,141 @@
+package pvc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+// ProfileName identifies a set of defaults used when the operator provisions
+// the registry claim.
+type ProfileName string
+
+const (
+	// ProfileAzureFile provisions the claim from Azure Files, through the
+	// azurefile-csi storage class unless another one is provided.
+	ProfileAzureFile ProfileName = "AzureFile"
+
+	// ProfileAzureNetAppFiles provisions the claim from Azure NetApp
+	// Files. The storage class has to be provided as it depends on how
+	// the NetApp provisioner was installed.
+	ProfileAzureNetAppFiles ProfileName = "AzureNetAppFiles"
+
+	// ProfileFilesystem provisions the claim from a shared network
+	// filesystem such as CephFS or NFS. The storage class has to be
+	// provided. Before the registry runs more than one replica, a probe
+	// verifies the filesystem honors fsync and exclusive file creation,
+	// the registry data gets corrupted silently otherwise.
+	ProfileFilesystem ProfileName = "Filesystem"
+)
+
+// defaultAzureFileStorageClass is the storage class created by the Azure
+// File CSI driver operator.
+const defaultAzureFileStorageClass = "azurefile-csi"
+
+// defaultClaimSize is the size requested for claims provisioned by the
+// operator.
+var defaultClaimSize = resource.MustParse("100Gi")
+
+// Profile configures how the operator provisions the registry claim when
+// no claim name is set. Profiles always request a ReadWriteMany claim, so
+// the registry can be scaled and rolled out without the restrictions that
+// apply to ReadWriteOnce claims. The Azure profiles are an alternative to
+// blob storage for Azure users that cannot reach storage accounts through
+// private endpoints.
+type Profile struct {
+	Name ProfileName `json:"name"`
+	// StorageClassName is the storage class the claim is provisioned
+	// from.
+	StorageClassName string `json:"storageClassName,omitempty"`
+	// Size is the requested size of the claim. Defaults to 100Gi.
+	Size *resource.Quantity `json:"size,omitempty"`
+}
+
+// pvcOverrides is the storage.pvc section of the unsupported config
+// overrides.
+type pvcOverrides struct {
+	Profile        *Profile        `json:"profile,omitempty"`
+	Autoscaling    *Autoscaling    `json:"autoscaling,omitempty"`
+	FailureDomains *FailureDomains `json:"failureDomains,omitempty"`
+}
+
+// getPVCOverrides returns the storage.pvc section of the unsupported config
+// overrides, or nil if there is none.
+func getPVCOverrides(cr *imageregistryv1.Config) (*pvcOverrides, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		Storage *struct {
+			PVC *pvcOverrides `json:"pvc,omitempty"`
+		} `json:"storage,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	if overrides.Storage == nil {
+		return nil, nil
+	}
+	return overrides.Storage.PVC, nil
+}
+
+// getProfile returns the profile set in the storage.pvc.profile section of
+// the unsupported config overrides, or nil if there is none.
+func getProfile(cr *imageregistryv1.Config) (*Profile, error) {
+	overrides, err := getPVCOverrides(cr)
+	if err != nil || overrides == nil || overrides.Profile == nil {
+		return nil, err
+	}
+
+	profile := overrides.Profile
+	switch profile.Name {
+	case ProfileAzureFile:
+		if profile.StorageClassName == "" {
+			profile.StorageClassName = defaultAzureFileStorageClass
+		}
+	case ProfileAzureNetAppFiles, ProfileFilesystem:
+		if profile.StorageClassName == "" {
+			return nil, fmt.Errorf("a storage class name is required for the %s storage profile", profile.Name)
+		}
+	default:
+		return nil, fmt.Errorf("unknown storage profile %q, expected %s, %s or %s", profile.Name, ProfileAzureFile, ProfileAzureNetAppFiles, ProfileFilesystem)
+	}
+	return profile, nil
+}
+
+// applyProfile sets the claim storage class and size according to the
+// profile.
+func applyProfile(claim *corev1.PersistentVolumeClaim, profile *Profile) {
+	if profile == nil {
+		return
+	}
+	claim.Spec.StorageClassName = &profile.StorageClassName
+	if profile.Size != nil {
+		claim.Spec.Resources.Requests[corev1.ResourceStorage] = *profile.Size
+	}
+}
+
+// checkProfile verifies that an existing claim provisioned by the operator
+// matches the storage class requested by the profile. The storage class of
+// a claim can't be changed, the claim has to be deleted for the operator to
+// provision it again.
+func checkProfile(cr *imageregistryv1.Config, claim *corev1.PersistentVolumeClaim) error {
+	profile, err := getProfile(cr)
+	if err != nil || profile == nil {
+		return err
+	}
+	if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName != profile.StorageClassName {
+		current := "<default>"
+		if claim.Spec.StorageClassName != nil {
+			current = *claim.Spec.StorageClassName
+		}
+		return fmt.Errorf("PVC %s was provisioned from the storage class %s while the %s profile requests %s, delete the claim to provision it again", claim.Name, current, profile.Name, profile.StorageClassName)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package pvc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestCreateStorageWithProfile(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		overrides    string
+		storageClass string
+		size         string
+		err          string
+	}{
+		{
+			name:         "azure file",
+			overrides:    `{"storage":{"pvc":{"profile":{"name":"AzureFile"}}}}`,
+			storageClass: "azurefile-csi",
+			size:         "100Gi",
+		},
+		{
+			name:         "azure netapp files",
+			overrides:    `{"storage":{"pvc":{"profile":{"name":"AzureNetAppFiles","storageClassName":"anf-premium","size":"4Ti"}}}}`,
+			storageClass: "anf-premium",
+			size:         "4Ti",
+		},
+		{
+			name:      "azure netapp files without storage class",
+			overrides: `{"storage":{"pvc":{"profile":{"name":"AzureNetAppFiles"}}}}`,
+			err:       "a storage class name is required",
+		},
+		{
+			name:      "unknown profile",
+			overrides: `{"storage":{"pvc":{"profile":{"name":"Foo"}}}}`,
+			err:       "unknown storage profile",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{},
+					},
+					Replicas:        2,
+					RolloutStrategy: "RollingUpdate",
+				},
+			}
+			cr.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			cliset := fake.NewSimpleClientset()
+			drv := &driver{
+				Namespace: "openshift-image-registry",
+				Config:    cr.Spec.Storage.PVC,
+				Client:    cliset.CoreV1(),
+			}
+
+			err := drv.CreateStorage(cr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			claim, err := cliset.CoreV1().PersistentVolumeClaims("openshift-image-registry").Get(context.Background(), defaults.PVCImageRegistryName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName != tt.storageClass {
+				t.Errorf("got storage class %v, want %s", claim.Spec.StorageClassName, tt.storageClass)
+			}
+			if size := claim.Spec.Resources.Requests[corev1.ResourceStorage]; size.Cmp(resource.MustParse(tt.size)) != 0 {
+				t.Errorf("got size %s, want %s", size.String(), tt.size)
+			}
+			if len(claim.Spec.AccessModes) != 1 || claim.Spec.AccessModes[0] != corev1.ReadWriteMany {
+				t.Errorf("got access modes %v, want %s", claim.Spec.AccessModes, corev1.ReadWriteMany)
+			}
+		})
+	}
+}
+
+func TestCreateStorageWithProfileMismatch(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{},
+			},
+		},
+	}
+	cr.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"storage":{"pvc":{"profile":{"name":"AzureFile"}}}}`)
+
+	storageClass := "managed-csi"
+	cliset := fake.NewSimpleClientset(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "openshift-image-registry",
+			Name:      defaults.PVCImageRegistryName,
+			Annotations: map[string]string{
+				PVCOwnerAnnotation: "true",
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			StorageClassName: &storageClass,
+		},
+	})
+	drv := &driver{
+		Namespace: "openshift-image-registry",
+		Config:    cr.Spec.Storage.PVC,
+		Client:    cliset.CoreV1(),
+	}
+
+	if err := drv.CreateStorage(cr); err == nil || !strings.Contains(err.Error(), "delete the claim") {
+		t.Errorf("expected storage class mismatch error, got %v", err)
+	}
+}
@@ -8,8 +8,8 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 
@@ -28,12 +28,19 @@ const (
 )
 
 type driver struct {
-	Namespace string
-	Config    *imageregistryv1.ImageRegistryConfigStoragePVC
-	Client    coreset.CoreV1Interface
+	Namespace   string
+	Config      *imageregistryv1.ImageRegistryConfigStoragePVC
+	Client      coreset.CoreV1Interface
+	BatchClient batchset.BatchV1Interface
+	Listers     *regopclient.StorageListers
+
+	kubeconfig *rest.Config
+	// volumeUsage returns the used and total bytes of the volume
+	// backing a claim.
+	volumeUsage func(ctx context.Context, claim string) (uint64, uint64, error)
 }
 
-func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *rest.Config) (*driver, error) {
+func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *rest.Config, listers *regopclient.StorageListers) (*driver, error) {
 	namespace, err := regopclient.GetWatchNamespace()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get watch namespace: %s", err)
@@ -44,11 +51,21 @@ func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *res
 		return nil, err
 	}
 
-	return &driver{
-		Namespace: namespace,
-		Config:    c,
-		Client:    client,
-	}, nil
+	batchClient, err := batchset.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &driver{
+		Namespace:   namespace,
+		Config:      c,
+		Client:      client,
+		BatchClient: batchClient,
+		Listers:     listers,
+		kubeconfig:  kubeconfig,
+	}
+	d.volumeUsage = d.prometheusVolumeUsage
+	return d, nil
 }
 
 func (d *driver) CABundle() (string, bool, error) {
@@ -91,11 +108,17 @@ func (d *driver) Secrets() (map[string]string, error) {
 
 func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 	if len(d.Config.Claim) != 0 {
-		_, err := d.Client.PersistentVolumeClaims(d.Namespace).Get(
+		claim, err := d.Client.PersistentVolumeClaims(d.Namespace).Get(
 			context.TODO(), d.Config.Claim, metav1.GetOptions{},
 		)
 		if err == nil {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "PVC Exists", "")
+			if err := d.syncFilesystemProbe(cr, claim); err != nil {
+				return true, err
+			}
+			if err := d.syncFailoverClaim(cr, claim); err != nil {
+				return true, err
+			}
 			return true, nil
 		}
 		if !errors.IsNotFound(err) {
@@ -158,6 +181,11 @@ func (d *driver) checkPVC(cr *imageregistryv1.Config, claim *corev1.PersistentVo
 }
 
 func (d *driver) createPVC(cr *imageregistryv1.Config) (*corev1.PersistentVolumeClaim, error) {
+	profile, err := getProfile(cr)
+	if err != nil {
+		return nil, err
+	}
+
 	claim := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      d.Config.Claim,
@@ -172,11 +200,12 @@ func (d *driver) createPVC(cr *imageregistryv1.Config) (*corev1.PersistentVolume
 			},
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse("100Gi"),
+					corev1.ResourceStorage: defaultClaimSize,
 				},
 			},
 		},
 	}
+	applyProfile(claim, profile)
 
 	return d.Client.PersistentVolumeClaims(d.Namespace).Create(
 		context.TODO(), claim, metav1.CreateOptions{},
@@ -206,6 +235,10 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "PVC Already Exists", err.Error())
 				return err
 			}
+			if err := checkProfile(cr, claim); err != nil {
+				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "PVC Profile Mismatch", err.Error())
+				return err
+			}
 		} else if errors.IsNotFound(err) {
 			claim, err = d.createPVC(cr)
 			if err != nil {
@@ -220,11 +253,30 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "PVC Exists", "")
 	}
 
+	if claim == nil {
+		claim, err = d.Client.PersistentVolumeClaims(d.Namespace).Get(
+			context.TODO(), d.Config.Claim, metav1.GetOptions{},
+		)
+		if err != nil {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "PVC Issues Found", err.Error())
+			return err
+		}
+	}
+
 	if err := d.checkPVC(cr, claim); err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "PVC Issues Found", err.Error())
 		return err
 	}
 
+	if err := d.syncFilesystemProbe(cr, claim); err != nil {
+		return err
+	}
+
+	if err := d.syncFailoverClaim(cr, claim); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Failover PVC Creation Failed", err.Error())
+		return err
+	}
+
 	if cr.Spec.Storage.ManagementState == "" {
 		cr.Spec.Storage.ManagementState = managementState
 	}
@@ -250,6 +302,10 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retriable bool, err
 		return false, err
 	}
 
+	if err := d.removeFailoverClaim(d.Config.Claim); err != nil {
+		return false, err
+	}
+
 	return false, nil
 }
 
@@ -262,3 +318,22 @@ func pvcIsCreatedByOperator(claim *corev1.PersistentVolumeClaim) (exist bool) {
 func (d *driver) ID() string {
 	return d.Config.Claim
 }
+
+// Capabilities returns what the claim supports. Registry pods can only share
+// ReadWriteMany claims, the claim is assumed ReadWriteOnce if it cannot be
+// read from the informer cache.
+func (d *driver) Capabilities() util.Capabilities {
+	if d.Listers == nil || d.Listers.PersistentVolumeClaims == nil {
+		return util.Capabilities{}
+	}
+	claim, err := d.Listers.PersistentVolumeClaims.Get(d.Config.Claim)
+	if err != nil {
+		return util.Capabilities{}
+	}
+	for _, mode := range claim.Spec.AccessModes {
+		if mode == corev1.ReadWriteMany {
+			return util.Capabilities{MultiReplica: true}
+		}
+	}
+	return util.Capabilities{}
+}
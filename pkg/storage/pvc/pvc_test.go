@@ -11,7 +11,9 @@ import (
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func TestStorageManagementState(t *testing.T) {
@@ -219,3 +221,52 @@ func TestStorageManagementState(t *testing.T) {
 		})
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		claims   []*corev1.PersistentVolumeClaim
+		expected util.Capabilities
+	}{
+		{
+			name:     "claim not in cache",
+			expected: util.Capabilities{},
+		},
+		{
+			name: "read write once",
+			claims: []*corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.PVCImageRegistryName, Namespace: defaults.ImageRegistryOperatorNamespace},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				},
+			}},
+			expected: util.Capabilities{},
+		},
+		{
+			name: "read write many",
+			claims: []*corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.PVCImageRegistryName, Namespace: defaults.ImageRegistryOperatorNamespace},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+				},
+			}},
+			expected: util.Capabilities{MultiReplica: true},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			listers := cirofake.NewFixturesBuilder().AddPersistentVolumeClaims(tt.claims...).BuildListers()
+			drv := &driver{
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+				Config: &imageregistryv1.ImageRegistryConfigStoragePVC{
+					Claim: defaults.PVCImageRegistryName,
+				},
+				// the claim must not be fetched from the API server
+				Client:  fake.NewSimpleClientset().CoreV1(),
+				Listers: &listers.StorageListers,
+			}
+			if got := drv.Capabilities(); got != tt.expected {
+				t.Errorf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
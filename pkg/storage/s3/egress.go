@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// errCodeNoSuchBucketPolicy is returned when getting the policy of a bucket
+// that has none.
+const errCodeNoSuchBucketPolicy = "NoSuchBucketPolicy"
+
+// stringOrSlice decodes policy values that are either a string or a list of
+// strings.
+type stringOrSlice []string
+
+func (s *stringOrSlice) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = []string{str}
+		return nil
+	}
+	var strs []string
+	if err := json.Unmarshal(data, &strs); err != nil {
+		return err
+	}
+	*s = strs
+	return nil
+}
+
+// bucketPolicy holds the fields of a bucket policy that restrict the source
+// addresses of requests.
+type bucketPolicy struct {
+	Statement []struct {
+		Effect    string                              `json:"Effect"`
+		Condition map[string]map[string]stringOrSlice `json:"Condition"`
+	} `json:"Statement"`
+}
+
+// policySourceIPs returns the source addresses allowed by the bucket policy
+// and whether the policy restricts them at all. Addresses are restricted by
+// statements denying requests whose aws:SourceIp is not in a list.
+func policySourceIPs(policy string) ([]string, bool, error) {
+	var p bucketPolicy
+	if err := json.Unmarshal([]byte(policy), &p); err != nil {
+		return nil, false, fmt.Errorf("unable to decode the bucket policy: %w", err)
+	}
+
+	var allowed []string
+	restricted := false
+	for _, stmt := range p.Statement {
+		if stmt.Effect != "Deny" {
+			continue
+		}
+		for key, values := range stmt.Condition["NotIpAddress"] {
+			if key != "aws:SourceIp" {
+				continue
+			}
+			restricted = true
+			allowed = append(allowed, values...)
+		}
+	}
+	return allowed, restricted, nil
+}
+
+// DeniedEgressIPs returns the IPs out of ips the bucket policy denies.
+func (d *driver) DeniedEgressIPs(ips []string) ([]string, error) {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := svc.GetBucketPolicyWithContext(d.Context, &s3.GetBucketPolicyInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeNoSuchBucketPolicy {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	allowed, restricted, err := policySourceIPs(aws.StringValue(out.Policy))
+	if err != nil || !restricted {
+		return nil, err
+	}
+	return util.DeniedIPs(ips, allowed), nil
+}
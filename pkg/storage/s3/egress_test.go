@@ -0,0 +1,58 @@
+package s3
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestPolicySourceIPs(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		policy     string
+		ips        []string
+		restricted bool
+		denied     []string
+	}{
+		{
+			name:   "no source restriction",
+			policy: `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`,
+			ips:    []string{"203.0.113.10"},
+		},
+		{
+			name:       "single address",
+			policy:     `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Condition":{"NotIpAddress":{"aws:SourceIp":"203.0.113.10"}}}]}`,
+			ips:        []string{"203.0.113.10", "203.0.113.11"},
+			restricted: true,
+			denied:     []string{"203.0.113.11"},
+		},
+		{
+			name:       "address ranges",
+			policy:     `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Condition":{"NotIpAddress":{"aws:SourceIp":["198.51.100.0/24","203.0.113.0/28"]}}}]}`,
+			ips:        []string{"203.0.113.10", "198.51.100.7"},
+			restricted: true,
+		},
+		{
+			name:   "allow statements do not restrict",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Condition":{"IpAddress":{"aws:SourceIp":"198.51.100.0/24"}}}]}`,
+			ips:    []string{"203.0.113.10"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, restricted, err := policySourceIPs(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restricted != tt.restricted {
+				t.Fatalf("got restricted %t, want %t", restricted, tt.restricted)
+			}
+			if !restricted {
+				return
+			}
+			if denied := util.DeniedIPs(tt.ips, allowed); !reflect.DeepEqual(denied, tt.denied) {
+				t.Errorf("got denied %v, want %v", denied, tt.denied)
+			}
+		})
+	}
+}
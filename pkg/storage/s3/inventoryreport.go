@@ -0,0 +1,190 @@
+package s3
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
+)
+
+// inventoryManifest is the manifest.json file delivered with each S3
+// Inventory report.
+type inventoryManifest struct {
+	FileFormat string `json:"fileFormat"`
+	FileSchema string `json:"fileSchema"`
+	Files      []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// InventoryFromReports accounts the blobs listed in the most recent S3
+// Inventory report delivered to location.
+func (d *driver) InventoryFromReports(ctx context.Context, report *inventory.Report, location inventory.ReportLocation) error {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return err
+	}
+
+	if location.Bucket == "" {
+		location.Bucket = d.Config.Bucket
+	}
+	return inventoryFromReports(ctx, svc, report, location)
+}
+
+func inventoryFromReports(ctx context.Context, svc s3iface.S3API, report *inventory.Report, location inventory.ReportLocation) error {
+	manifestKey, err := latestInventoryManifest(ctx, svc, location)
+	if err != nil {
+		return err
+	}
+	klog.Infof("using S3 inventory report s3://%s/%s", location.Bucket, manifestKey)
+
+	obj, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(location.Bucket),
+		Key:    aws.String(manifestKey),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to get inventory manifest %s: %w", manifestKey, err)
+	}
+	defer obj.Body.Close()
+
+	var manifest inventoryManifest
+	if err := json.NewDecoder(obj.Body).Decode(&manifest); err != nil {
+		return fmt.Errorf("unable to parse inventory manifest %s: %w", manifestKey, err)
+	}
+	if manifest.FileFormat != "CSV" {
+		return fmt.Errorf("inventory reports in the %s format are not supported, only CSV is", manifest.FileFormat)
+	}
+	keyColumn, sizeColumn, err := inventorySchemaColumns(manifest.FileSchema)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range manifest.Files {
+		if err := addInventoryFile(ctx, svc, report, location.Bucket, file.Key, keyColumn, sizeColumn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestInventoryManifest returns the key of the manifest of the most recent
+// report. Reports are delivered under a folder named after the time they
+// were generated, so the most recent one sorts last.
+func latestInventoryManifest(ctx context.Context, svc s3iface.S3API, location inventory.ReportLocation) (string, error) {
+	prefix := strings.TrimSuffix(location.Prefix, "/") + "/"
+
+	var folders []string
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(location.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, p := range page.CommonPrefixes {
+			folder := strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(p.Prefix), prefix), "/")
+			if folder == "data" || folder == "hive" {
+				continue
+			}
+			folders = append(folders, folder)
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list inventory reports in s3://%s/%s: %w", location.Bucket, prefix, err)
+	}
+	if len(folders) == 0 {
+		return "", fmt.Errorf("no inventory reports found in s3://%s/%s", location.Bucket, prefix)
+	}
+
+	sort.Strings(folders)
+	return prefix + path.Join(folders[len(folders)-1], "manifest.json"), nil
+}
+
+// inventorySchemaColumns returns the position of the key and the size
+// columns in the report files.
+func inventorySchemaColumns(schema string) (int, int, error) {
+	keyColumn, sizeColumn := -1, -1
+	for i, field := range strings.Split(schema, ",") {
+		switch strings.TrimSpace(field) {
+		case "Key":
+			keyColumn = i
+		case "Size":
+			sizeColumn = i
+		}
+	}
+	if keyColumn == -1 || sizeColumn == -1 {
+		return 0, 0, fmt.Errorf("inventory reports must include the Key and Size fields, got %q", schema)
+	}
+	return keyColumn, sizeColumn, nil
+}
+
+func addInventoryFile(ctx context.Context, svc s3iface.S3API, report *inventory.Report, bucket, key string, keyColumn, sizeColumn int) error {
+	obj, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to get inventory file %s: %w", key, err)
+	}
+	defer obj.Body.Close()
+
+	gz, err := gzip.NewReader(obj.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read inventory file %s: %w", key, err)
+	}
+	defer gz.Close()
+
+	if err := addInventoryCSV(report, gz, keyColumn, sizeColumn); err != nil {
+		return fmt.Errorf("unable to read inventory file %s: %w", key, err)
+	}
+	return nil
+}
+
+// addInventoryCSV accounts the blobs listed in a CSV report file. Object
+// keys are URL encoded in the reports.
+func addInventoryCSV(report *inventory.Report, r io.Reader, keyColumn, sizeColumn int) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) <= keyColumn || len(record) <= sizeColumn {
+			return fmt.Errorf("unexpected record with %d fields", len(record))
+		}
+
+		key, err := url.QueryUnescape(record[keyColumn])
+		if err != nil {
+			return fmt.Errorf("unable to decode key %q: %w", record[keyColumn], err)
+		}
+		if !inventory.IsBlob(key) {
+			continue
+		}
+		if record[sizeColumn] == "" {
+			// delete markers have no size.
+			continue
+		}
+		size, err := strconv.ParseInt(record[sizeColumn], 10, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse size of %s: %w", key, err)
+		}
+		report.Add(size)
+	}
+}
@@ -0,0 +1,111 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
+)
+
+type fakeInventoryS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (f *fakeInventoryS3) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	prefix := aws.StringValue(input.Prefix)
+	seen := map[string]bool{}
+	page := &s3.ListObjectsV2Output{}
+	for key := range f.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		if i := strings.Index(rest, "/"); i != -1 {
+			folder := prefix + rest[:i+1]
+			if !seen[folder] {
+				seen[folder] = true
+				page.CommonPrefixes = append(page.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(folder)})
+			}
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func (f *fakeInventoryS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInventoryFromReports(t *testing.T) {
+	prefix := "inventory/registry-bucket/daily"
+	svc := &fakeInventoryS3{
+		objects: map[string][]byte{
+			prefix + "/2023-01-01T01-00Z/manifest.json": []byte(`{"fileFormat":"CSV","fileSchema":"Bucket, Key, Size","files":[{"key":"` + prefix + `/data/old.csv.gz"}]}`),
+			prefix + "/2023-01-02T01-00Z/manifest.json": []byte(`{"fileFormat":"CSV","fileSchema":"Bucket, Key, Size","files":[{"key":"` + prefix + `/data/new.csv.gz"}]}`),
+			prefix + "/data/old.csv.gz":                 gzipped(t, `"registry-bucket","docker/registry/v2/blobs/sha256/aa/aa/data","1"`+"\n"),
+			prefix + "/data/new.csv.gz": gzipped(t, strings.Join([]string{
+				`"registry-bucket","docker/registry/v2/blobs/sha256/bb/bb/data","1048576"`,
+				`"registry-bucket","docker/registry/v2/blobs/sha256/cc/cc/data","2097152"`,
+				`"registry-bucket","docker/registry/v2/repositories/foo/_layers/sha256/bb/link","71"`,
+				`"registry-bucket","docker%2Fregistry%2Fv2%2Fblobs%2Fsha256%2Fdd%2Fdd%2Fdata","10"`,
+			}, "\n")),
+		},
+	}
+
+	report := inventory.NewReport("S3")
+	err := inventoryFromReports(context.Background(), svc, report, inventory.ReportLocation{
+		Bucket: "inventory-bucket",
+		Prefix: prefix + "/",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if report.Objects != 3 {
+		t.Errorf("got %d objects, want 3", report.Objects)
+	}
+	if want := int64(1048576 + 2097152 + 10); report.Bytes != want {
+		t.Errorf("got %d bytes, want %d", report.Bytes, want)
+	}
+}
+
+func TestInventorySchemaColumns(t *testing.T) {
+	key, size, err := inventorySchemaColumns("Bucket, Key, VersionId, IsLatest, Size, LastModifiedDate")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if key != 1 || size != 4 {
+		t.Errorf("got key column %d and size column %d, want 1 and 4", key, size)
+	}
+
+	if _, _, err := inventorySchemaColumns("Bucket, Key"); err == nil {
+		t.Errorf("expected error for schema without size")
+	}
+}
@@ -0,0 +1,143 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// objectDeletionWorkers is the number of DeleteObjects requests sent
+	// concurrently. Each request deletes up to 1000 objects, the size of
+	// a ListObjectsV2 page.
+	objectDeletionWorkers = 8
+
+	// objectDeletionRetries is how many times the objects a DeleteObjects
+	// request failed to delete are retried.
+	objectDeletionRetries = 3
+
+	// objectDeletionBudget is for how long objects are deleted before
+	// RemoveStorage returns to report progress. Deletion resumes where it
+	// stopped on the next attempt as deleted objects are not listed again.
+	objectDeletionBudget = 2 * time.Minute
+)
+
+// objectDeletionRetryDelay is the delay before the objects that could not
+// be deleted are retried, it is multiplied by the attempt number.
+var objectDeletionRetryDelay = time.Second
+
+// errObjectDeletionInProgress is returned when the bucket still has objects
+// after the object deletion budget is spent.
+type errObjectDeletionInProgress struct {
+	deleted int64
+}
+
+func (e *errObjectDeletionInProgress) Error() string {
+	return fmt.Sprintf("deleted %d objects, the bucket is not empty yet", e.deleted)
+}
+
+// deleteBucketObjects deletes the objects in the bucket in batches of up to
+// 1000 keys, with objectDeletionWorkers batches in flight. It returns the
+// number of deleted objects.
+func deleteBucketObjects(ctx context.Context, svc s3iface.S3API, bucket string, budget time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	var deleted int64
+	var firstErr error
+	var errOnce sync.Once
+	batches := make(chan []*s3.ObjectIdentifier)
+	var wg sync.WaitGroup
+	for i := 0; i < objectDeletionWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				n, err := deleteObjectsBatch(ctx, svc, bucket, batch)
+				atomic.AddInt64(&deleted, n)
+				if err != nil && ctx.Err() == nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	listErr := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		var batch []*s3.ObjectIdentifier
+		for _, obj := range page.Contents {
+			batch = append(batch, &s3.ObjectIdentifier{Key: obj.Key})
+		}
+		if len(batch) == 0 {
+			return true
+		}
+		select {
+		case batches <- batch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(batches)
+	wg.Wait()
+
+	if firstErr != nil {
+		return deleted, firstErr
+	}
+	if ctx.Err() != nil {
+		klog.Infof("deleted %d objects from the storage bucket, resuming on the next attempt", deleted)
+		return deleted, &errObjectDeletionInProgress{deleted: deleted}
+	}
+	if listErr != nil {
+		return deleted, listErr
+	}
+	return deleted, nil
+}
+
+// deleteObjectsBatch deletes objects with a single DeleteObjects request,
+// retrying the objects S3 reports it could not delete.
+func deleteObjectsBatch(ctx context.Context, svc s3iface.S3API, bucket string, objects []*s3.ObjectIdentifier) (int64, error) {
+	var deleted int64
+	for attempt := 0; ; attempt++ {
+		resp, err := svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int64(len(objects) - len(resp.Errors))
+		if len(resp.Errors) == 0 {
+			return deleted, nil
+		}
+
+		if attempt == objectDeletionRetries {
+			e := resp.Errors[0]
+			return deleted, fmt.Errorf("unable to delete %d objects, %s: %s: %s", len(resp.Errors), aws.StringValue(e.Key), aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+		objects = objects[:0]
+		for _, e := range resp.Errors {
+			objects = append(objects, &s3.ObjectIdentifier{Key: e.Key, VersionId: e.VersionId})
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt+1) * objectDeletionRetryDelay):
+		case <-ctx.Done():
+			return deleted, ctx.Err()
+		}
+	}
+}
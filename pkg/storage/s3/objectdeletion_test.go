@@ -0,0 +1,98 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type fakeDeletionS3 struct {
+	s3iface.S3API
+
+	mu       sync.Mutex
+	objects  map[string]bool
+	failOnce map[string]bool
+	requests int
+}
+
+func (f *fakeDeletionS3) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	f.mu.Lock()
+	var keys []string
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	f.mu.Unlock()
+	sort.Strings(keys)
+
+	for len(keys) > 0 {
+		n := 1000
+		if len(keys) < n {
+			n = len(keys)
+		}
+		page := &s3.ListObjectsV2Output{}
+		for _, key := range keys[:n] {
+			page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key)})
+		}
+		keys = keys[n:]
+		if !fn(page, len(keys) == 0) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeDeletionS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if len(input.Delete.Objects) > 1000 {
+		return nil, fmt.Errorf("too many objects in a single request: %d", len(input.Delete.Objects))
+	}
+	out := &s3.DeleteObjectsOutput{}
+	for _, obj := range input.Delete.Objects {
+		key := aws.StringValue(obj.Key)
+		if f.failOnce[key] {
+			delete(f.failOnce, key)
+			out.Errors = append(out.Errors, &s3.Error{Key: obj.Key, Code: aws.String("InternalError"), Message: aws.String("try again")})
+			continue
+		}
+		delete(f.objects, key)
+	}
+	return out, nil
+}
+
+func TestDeleteBucketObjects(t *testing.T) {
+	objectDeletionRetryDelay = 0
+
+	f := &fakeDeletionS3{
+		objects:  map[string]bool{},
+		failOnce: map[string]bool{"docker/registry/v2/blobs/sha256/00/0042/data": true},
+	}
+	for i := 0; i < 2500; i++ {
+		f.objects[fmt.Sprintf("docker/registry/v2/blobs/sha256/00/%04d/data", i)] = true
+	}
+
+	deleted, err := deleteBucketObjects(context.Background(), f, "bucket", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if deleted != 2500 {
+		t.Errorf("got %d deleted objects, want 2500", deleted)
+	}
+	if len(f.objects) != 0 {
+		t.Errorf("got %d objects left, want 0", len(f.objects))
+	}
+	// three batches and a retry for the object that failed.
+	if f.requests != 4 {
+		t.Errorf("got %d DeleteObjects requests, want 4", f.requests)
+	}
+}
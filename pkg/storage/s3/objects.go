@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// getObjectsService returns the S3 client used by the object methods.
+func (d *driver) getObjectsService() (*s3.S3, error) {
+	if d.objectsService != nil {
+		return d.objectsService, nil
+	}
+	svc, err := d.getS3Service()
+	if err != nil {
+		return nil, err
+	}
+	d.objectsService = svc
+	return svc, nil
+}
+
+// WalkObjects calls fn for every object stored in the bucket.
+func (d *driver) WalkObjects(ctx context.Context, fn func(key string, size int64) error) error {
+	svc, err := d.getObjectsService()
+	if err != nil {
+		return err
+	}
+
+	var walkErr error
+	err = svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.Config.Bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if walkErr = fn(aws.StringValue(obj.Key), aws.Int64Value(obj.Size)); walkErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+	return err
+}
+
+// ReadObject returns the content of the object key.
+func (d *driver) ReadObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	svc, err := d.getObjectsService()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// WriteObject stores the content read from r as the object key. Large
+// objects are uploaded in parts, the bucket default encryption applies.
+func (d *driver) WriteObject(ctx context.Context, key string, r io.Reader, size int64) error {
+	svc, err := d.getObjectsService()
+	if err != nil {
+		return err
+	}
+
+	_, err = s3manager.NewUploaderWithClient(svc).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+	return err
+}
+
+// DeleteObject removes the object key.
+func (d *driver) DeleteObject(ctx context.Context, key string) error {
+	svc, err := d.getObjectsService()
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -26,7 +26,6 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/klog/v2"
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -35,6 +34,9 @@ import (
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/calllog"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/faultinject"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/inventory"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 	"github.com/openshift/cluster-image-registry-operator/pkg/version"
 )
@@ -98,6 +100,34 @@ func regionHasDualStackS3(region string) (bool, error) {
 	return true, nil
 }
 
+// fipsEndpointsCondition reports whether the driver uses the FIPS endpoints
+// of S3 when the cluster runs in FIPS mode.
+const fipsEndpointsCondition = "S3FIPSEndpoints"
+
+// regionHasFIPSS3 returns the FIPS endpoint of S3 in region, if the region
+// has one. The dual-stack variant is preferred when dualStack is true.
+func regionHasFIPSS3(region string, dualStack bool) (string, bool, error) {
+	variants := [][]func(*endpoints.Options){
+		{endpoints.UseFIPSEndpointOption, endpoints.StrictMatchingOption},
+	}
+	if dualStack {
+		variants = append([][]func(*endpoints.Options){
+			{endpoints.UseFIPSEndpointOption, endpoints.UseDualStackEndpointOption, endpoints.StrictMatchingOption},
+		}, variants...)
+	}
+	for _, opts := range variants {
+		ep, err := endpoints.DefaultResolver().EndpointFor("s3", region, opts...)
+		if isUnknownEndpointError(err) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return ep.URL, true, nil
+	}
+	return "", false, nil
+}
+
 type driver struct {
 	Context context.Context
 	Config  *imageregistryv1.ImageRegistryConfigStorageS3
@@ -107,6 +137,10 @@ type driver struct {
 	// account the cluster configuration.
 	endpointsResolver *endpointsResolver
 
+	// objectsService is reused by the object methods, which are called
+	// once per object when copying the bucket.
+	objectsService *s3.S3
+
 	// roundTripper is used only during tests.
 	roundTripper http.RoundTripper
 }
@@ -225,6 +259,24 @@ func (d *driver) getCredentialsConfigData() ([]byte, error) {
 	}
 }
 
+// CredentialsSource returns how the AWS credentials are sourced. Credentials
+// minted for clusters using AWS STS hold a role and a web identity token
+// file instead of access keys.
+func (d *driver) CredentialsSource() (util.CredentialsSource, error) {
+	return util.GetCredentialsSource(d.Listers.Secrets, func(sec *corev1.Secret) util.CredentialsMode {
+		data, err := sharedCredentialsDataFromSecret(sec)
+		switch {
+		case err != nil:
+			return util.CredentialsModeMinted
+		case bytes.Contains(data, []byte("web_identity_token_file")):
+			return util.CredentialsModeWorkloadIdentity
+		case bytes.Contains(data, []byte("credential_source")):
+			return util.CredentialsModeNodeIdentity
+		}
+		return util.CredentialsModeMinted
+	})
+}
+
 // CABundle gets the custom CA bundle for trusting communication with the AWS
 // API.
 func (d *driver) CABundle() (string, bool, error) {
@@ -268,6 +320,59 @@ func (d *driver) useDualStack() (bool, error) {
 	return ok, nil
 }
 
+// fipsEndpoint returns the FIPS endpoint of S3 the driver should use. It
+// returns an empty string if the cluster does not run in FIPS mode or if the
+// S3 endpoint is provided by the user or by the cluster configuration, such
+// endpoints are used as they are.
+func (d *driver) fipsEndpoint() (string, error) {
+	if !util.FIPSEnabled() || d.Config.RegionEndpoint != "" {
+		return "", nil
+	}
+	if _, ok := d.endpointsResolver.serviceEndpoints["s3"]; ok {
+		return "", nil
+	}
+	useDualStack, err := d.useDualStack()
+	if err != nil {
+		return "", err
+	}
+	url, ok, err := regionHasFIPSS3(d.Config.Region, useDualStack)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine if region %s has FIPS S3 endpoints: %w", d.Config.Region, err)
+	}
+	if !ok {
+		return "", nil
+	}
+	return url, nil
+}
+
+// syncFIPSCondition reports in cr whether the driver is able to use FIPS
+// endpoints when the cluster runs in FIPS mode.
+func (d *driver) syncFIPSCondition(cr *imageregistryv1.Config) error {
+	if !util.FIPSEnabled() {
+		return nil
+	}
+	if err := d.UpdateEffectiveConfig(); err != nil {
+		return err
+	}
+	endpoint, err := d.fipsEndpoint()
+	if err != nil {
+		util.UpdateCondition(cr, fipsEndpointsCondition, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return err
+	}
+	switch {
+	case endpoint != "":
+		util.UpdateCondition(cr, fipsEndpointsCondition, operatorapi.ConditionTrue, "FIPSEndpoint",
+			fmt.Sprintf("The cluster runs in FIPS mode, S3 is accessed through %s", endpoint))
+	case d.Config.RegionEndpoint != "" || d.endpointsResolver.serviceEndpoints["s3"] != "":
+		util.UpdateCondition(cr, fipsEndpointsCondition, operatorapi.ConditionTrue, "CustomEndpoint",
+			"The cluster runs in FIPS mode, the configured S3 endpoint is used as it is and has to be FIPS compliant")
+	default:
+		util.UpdateCondition(cr, fipsEndpointsCondition, operatorapi.ConditionFalse, "FIPSEndpointUnavailable",
+			fmt.Sprintf("The cluster runs in FIPS mode, but the region %s has no FIPS endpoint for S3", d.Config.Region))
+	}
+	return nil
+}
+
 // getS3Service returns a client that allows us to interact
 // with the aws S3 service
 func (d *driver) getS3Service() (*s3.S3, error) {
@@ -329,7 +434,7 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 		Config: aws.Config{
 			Region: &d.Config.Region,
 			HTTPClient: &http.Client{
-				Transport: tr,
+				Transport: faultinject.Wrap("S3", tr),
 			},
 		},
 		SharedConfigState: session.SharedConfigEnable,
@@ -348,6 +453,14 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 		awsOptions.Config.WithUseDualStack(true)
 	}
 
+	fipsEndpoint, err := d.fipsEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	if fipsEndpoint != "" {
+		awsOptions.Config.WithEndpoint(fipsEndpoint)
+	}
+
 	if d.Config.RegionEndpoint != "" {
 		if !d.Config.VirtualHostedStyle {
 			awsOptions.Config.WithS3ForcePathStyle(true)
@@ -364,10 +477,33 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 		Name: "openshift.io/cluster-image-registry-operator",
 		Fn:   request.MakeAddToUserAgentHandler("openshift.io cluster-image-registry-operator", version.Version),
 	})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "openshift.io/cluster-image-registry-operator/calllog",
+		Fn:   recordCall,
+	})
 
 	return s3.New(sess), nil
 }
 
+// recordCall records the request in the cloud API call log once it is
+// complete, retries included.
+func recordCall(r *request.Request) {
+	c := calllog.Call{
+		Time:      r.Time.UTC(),
+		Provider:  "S3",
+		Operation: r.Operation.Name,
+		Duration:  time.Since(r.Time),
+		Retries:   r.RetryCount,
+	}
+	if r.HTTPResponse != nil {
+		c.Status = r.HTTPResponse.StatusCode
+	}
+	if r.Error != nil {
+		c.Error = r.Error.Error()
+	}
+	calllog.Record(c)
+}
+
 func isBucketNotFound(err interface{}) bool {
 	switch s3Err := err.(type) {
 	case awserr.Error:
@@ -426,6 +562,16 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_USEDUALSTACK", Value: true})
 	}
 
+	// The registry cannot resolve FIPS endpoints by itself, it is given
+	// the resolved one.
+	fipsEndpoint, err := d.fipsEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	if fipsEndpoint != "" {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_REGIONENDPOINT", Value: fipsEndpoint})
+	}
+
 	if d.Config.CloudFront != nil {
 		// Use structs to make ordering deterministic
 		type cloudFrontOptions struct {
@@ -558,6 +704,10 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 		return false, nil
 	}
 
+	if err := d.syncFIPSCondition(cr); err != nil {
+		return false, err
+	}
+
 	err := d.bucketExists(d.Config.Bucket)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
@@ -572,6 +722,19 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 	}
 
 	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "S3 Bucket Exists", "")
+
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+		if err != nil {
+			return true, err
+		}
+		svc, err := d.getS3Service()
+		if err != nil {
+			return true, err
+		}
+		d.syncTags(cr, svc, infra)
+	}
+
 	return true, nil
 }
 
@@ -586,6 +749,40 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
+// PlanStorage returns the bucket CreateStorage would create, along with
+// its tags.
+func (d *driver) PlanStorage(cr *imageregistryv1.Config) ([]util.PlannedResource, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.UpdateEffectiveConfig(); err != nil {
+		return nil, err
+	}
+
+	name := d.Config.Bucket
+	if name == "" {
+		if name, err = util.PlannedStorageName(d.Listers, d.Config.Region); err != nil {
+			return nil, err
+		}
+	}
+
+	tags := map[string]string{
+		"kubernetes.io/cluster/" + infra.Status.InfrastructureName: "owned",
+		"Name": infra.Status.InfrastructureName + "-image-registry",
+	}
+	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.AWS != nil {
+		for _, tag := range infra.Status.PlatformStatus.AWS.ResourceTags {
+			tags[tag.Key] = tag.Value
+		}
+	}
+
+	return []util.PlannedResource{
+		{Kind: "S3 bucket", Name: name, Region: d.Config.Region, Tags: tags},
+	}, nil
+}
+
 // CreateStorage attempts to create an s3 bucket
 // and apply any provided tags
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
@@ -603,6 +800,10 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	if err := d.syncFIPSCondition(cr); err != nil {
+		return err
+	}
+
 	// If a bucket name is supplied, and it already exists and we can access it
 	// just update the config
 	var bucketExists bool
@@ -728,53 +929,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 
 	// Tag the bucket with the openshiftClusterID
 	// along with any user defined tags from the cluster configuration
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		klog.Info("setting aws bucket tags")
-
-		tagset := []*s3.Tag{
-			{
-				Key:   aws.String("kubernetes.io/cluster/" + infra.Status.InfrastructureName),
-				Value: aws.String("owned"),
-			},
-			{
-				Key:   aws.String("Name"),
-				Value: aws.String(infra.Status.InfrastructureName + "-image-registry"),
-			},
-		}
-
-		// at this stage we are not keeping user tags in sync. as per enhancement proposal
-		// we only set user provided tags when we created the bucket.
-		hasAWSStatus := infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.AWS != nil
-		if hasAWSStatus {
-			klog.Infof("user provided %d tags", len(infra.Status.PlatformStatus.AWS.ResourceTags))
-			for _, tag := range infra.Status.PlatformStatus.AWS.ResourceTags {
-				klog.Infof("user provided bucket tag: %s: %s", tag.Key, tag.Value)
-				tagset = append(tagset, &s3.Tag{
-					Key:   aws.String(tag.Key),
-					Value: aws.String(tag.Value),
-				})
-			}
-		}
-		klog.V(5).Infof("tagging bucket with tags: %+v", tagset)
-
-		_, err := svc.PutBucketTaggingWithContext(d.Context, &s3.PutBucketTaggingInput{
-			Bucket: aws.String(d.Config.Bucket),
-			Tagging: &s3.Tagging{
-				TagSet: tagset,
-			},
-		})
-		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
-			} else {
-				util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
-			}
-		} else {
-			util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionTrue, "Tagging Successful", "Tags were successfully applied to the S3 bucket")
-		}
-	} else {
-		klog.Info("ignoring bucket tags, storage is not managed")
-	}
+	d.syncTags(cr, svc, infra)
 
 	// Enable default encryption on the bucket
 	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
@@ -872,11 +1027,11 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
-	iter := s3manager.NewDeleteListIterator(svc, &s3.ListObjectsInput{
-		Bucket: aws.String(d.Config.Bucket),
-	})
-
-	err = s3manager.NewBatchDeleteWithClient(svc).Delete(d.Context, iter)
+	_, err = deleteBucketObjects(d.Context, svc, d.Config.Bucket, objectDeletionBudget)
+	if _, ok := err.(*errObjectDeletionInProgress); ok {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "DeletingObjects", fmt.Sprintf("Deleting the objects in the S3 bucket: %s", err))
+		return true, err
+	}
 	if err != nil && !isBucketNotFound(err) {
 		return false, err
 	}
@@ -930,6 +1085,54 @@ func (d *driver) ID() string {
 	return d.Config.Bucket
 }
 
+// Capabilities returns what S3 supports.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiReplica:           true,
+		Redirect:               true,
+		EncryptionAtRestConfig: true,
+		Tagging:                true,
+	}
+}
+
+// Endpoints returns the S3 endpoint used by the registry when it is not the
+// AWS default one.
+func (d *driver) Endpoints() ([]string, error) {
+	if err := d.UpdateEffectiveConfig(); err != nil {
+		return nil, err
+	}
+	if d.Config.RegionEndpoint == "" {
+		return nil, nil
+	}
+	return []string{d.Config.RegionEndpoint}, nil
+}
+
+// Inventory accounts all blobs stored in the bucket in the provided report.
+func (d *driver) Inventory(ctx context.Context, report *inventory.Report) error {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range inventory.Prefixes {
+		err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(d.Config.Bucket),
+			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				if inventory.IsBlob(aws.StringValue(obj.Key)) {
+					report.Add(aws.Int64Value(obj.Size))
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // saveSharedCredentialsFile will create a file with the provided data expected to be
 // an AWS ini-style credentials configuration file.
 // Caller is responsible for cleaning up the created file.
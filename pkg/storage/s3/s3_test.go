@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
-	"io"
 	"net/http"
 	"path/filepath"
 	"reflect"
@@ -22,10 +21,14 @@ import (
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func TestEndpointsResolver(t *testing.T) {
@@ -160,6 +163,52 @@ func TestGetConfig(t *testing.T) {
 	}
 }
 
+func TestPlanStorage(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "cluster-abc",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region:       "us-east-1",
+					ResourceTags: []configv1.AWSResourceTag{{Key: "team", Value: "registry"}},
+				},
+			},
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	s3Driver := &driver{
+		Listers: &listers.StorageListers,
+		Config:  &imageregistryv1.ImageRegistryConfigStorageS3{},
+	}
+
+	plan, err := s3Driver.PlanStorage(&imageregistryv1.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []util.PlannedResource{
+		{
+			Kind:   "S3 bucket",
+			Name:   "cluster-abc-image-registry-us-east-1-*",
+			Region: "us-east-1",
+			Tags: map[string]string{
+				"kubernetes.io/cluster/cluster-abc": "owned",
+				"Name":                              "cluster-abc-image-registry",
+				"team":                              "registry",
+			},
+		},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("unexpected plan: %s", cmp.Diff(expected, plan))
+	}
+}
+
 func TestGetConfigCustomRegionEndpoint(t *testing.T) {
 	testBuilder := cirofake.NewFixturesBuilder()
 	testBuilder.AddInfraConfig(&configv1.Infrastructure{
@@ -350,40 +399,6 @@ func TestServiceEndpointCanBeOverwritten(t *testing.T) {
 	}
 }
 
-type tripper struct {
-	req           int
-	reqBodies     [][]byte
-	responseCodes []int
-}
-
-func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	defer func() {
-		r.req++
-	}()
-
-	if req.Body != nil {
-		dt, err := io.ReadAll(req.Body)
-		if err != nil {
-			return nil, err
-		}
-		r.reqBodies = append(r.reqBodies, dt)
-	}
-
-	code := http.StatusOK
-	if r.req < len(r.responseCodes) {
-		code = r.responseCodes[r.req]
-	}
-
-	return &http.Response{
-		StatusCode: code,
-		Body:       io.NopCloser(bytes.NewBufferString("{}")),
-	}, nil
-}
-
-func (r *tripper) AddResponse(code int) {
-	r.responseCodes = append(r.responseCodes, code)
-}
-
 func TestStorageManagementState(t *testing.T) {
 	builder := cirofake.NewFixturesBuilder()
 	builder.AddInfraConfig(&configv1.Infrastructure{
@@ -498,11 +513,9 @@ func TestStorageManagementState(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			rt := &tripper{}
-			if len(tt.responseCodes) > 0 {
-				for _, code := range tt.responseCodes {
-					rt.AddResponse(code)
-				}
+			rt := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: "{}"}}
+			for _, code := range tt.responseCodes {
+				rt.AddResponse(code, "{}")
 			}
 
 			drv := NewDriver(context.Background(), tt.config.Spec.Storage.S3, &listers.StorageListers)
@@ -737,11 +750,9 @@ func TestUserProvidedTags(t *testing.T) {
 			listers := builder.BuildListers()
 
 			drv := NewDriver(context.Background(), tt.config.Spec.Storage.S3, &listers.StorageListers)
-			rt := &tripper{}
-			if len(tt.responseCodes) > 0 {
-				for _, code := range tt.responseCodes {
-					rt.AddResponse(code)
-				}
+			rt := &httpmock.Transport{Default: &httpmock.Response{StatusCode: http.StatusOK, Body: "{}"}}
+			for _, code := range tt.responseCodes {
+				rt.AddResponse(code, "{}")
 			}
 			drv.roundTripper = rt
 
@@ -750,13 +761,13 @@ func TestUserProvidedTags(t *testing.T) {
 				return
 			}
 
-			for _, body := range rt.reqBodies {
+			for _, req := range rt.Requests() {
 				// ignore any other types of request.
-				if !strings.Contains(string(body), "Tagging") {
+				if !strings.Contains(string(req.Body), "Tagging") {
 					continue
 				}
 
-				buf := bytes.NewBuffer(body)
+				buf := bytes.NewBuffer(req.Body)
 				tagging := s3.Tagging{}
 				xmldec := xml.NewDecoder(buf)
 
@@ -780,3 +791,97 @@ func TestUserProvidedTags(t *testing.T) {
 		})
 	}
 }
+
+func TestFIPSEndpoints(t *testing.T) {
+	defer func(fipsEnabled func() bool) { util.FIPSEnabled = fipsEnabled }(util.FIPSEnabled)
+	util.FIPSEnabled = func() bool { return true }
+
+	for _, tt := range []struct {
+		name           string
+		region         string
+		regionEndpoint string
+		endpoint       string
+		status         operatorapi.ConditionStatus
+		reason         string
+	}{
+		{
+			name:     "region with FIPS endpoints",
+			region:   "us-east-1",
+			endpoint: "https://s3-fips.dualstack.us-east-1.amazonaws.com",
+			status:   operatorapi.ConditionTrue,
+			reason:   "FIPSEndpoint",
+		},
+		{
+			name:   "region without FIPS endpoints",
+			region: "eu-west-1",
+			status: operatorapi.ConditionFalse,
+			reason: "FIPSEndpointUnavailable",
+		},
+		{
+			name:           "custom endpoint",
+			region:         "us-east-1",
+			regionEndpoint: "https://s3.example.com",
+			endpoint:       "https://s3.example.com",
+			status:         operatorapi.ConditionTrue,
+			reason:         "CustomEndpoint",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			testBuilder := cirofake.NewFixturesBuilder()
+			testBuilder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: tt.region,
+						},
+					},
+				},
+			})
+			testBuilder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			})
+			listers := testBuilder.BuildListers()
+
+			config := &imageregistryv1.ImageRegistryConfigStorageS3{
+				Region:         tt.region,
+				RegionEndpoint: tt.regionEndpoint,
+			}
+			d := NewDriver(context.Background(), config, &listers.StorageListers)
+
+			envvars, err := d.ConfigEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_REGIONENDPOINT")
+			switch {
+			case tt.endpoint == "" && e != nil:
+				t.Errorf("unexpected region endpoint %v", e.Value)
+			case tt.endpoint != "" && (e == nil || e.Value != tt.endpoint):
+				t.Errorf("got region endpoint %v, want %s", e, tt.endpoint)
+			}
+
+			cr := &imageregistryv1.Config{}
+			if err := d.syncFIPSCondition(cr); err != nil {
+				t.Fatal(err)
+			}
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, fipsEndpointsCondition)
+			if cond == nil {
+				t.Fatalf("condition %s not found", fipsEndpointsCondition)
+			}
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %s/%s, want %s/%s", cond.Status, cond.Reason, tt.status, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package s3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// errCodeNoSuchTagSet is returned when getting the tags of a bucket that has
+// none.
+const errCodeNoSuchTagSet = "NoSuchTagSet"
+
+// expectedTags returns the tags of the bucket: the cluster ownership tags
+// followed by the user tags from the infrastructure status, in order.
+func expectedTags(infra *configv1.Infrastructure) []*s3.Tag {
+	tagset := []*s3.Tag{
+		{
+			Key:   aws.String("kubernetes.io/cluster/" + infra.Status.InfrastructureName),
+			Value: aws.String("owned"),
+		},
+		{
+			Key:   aws.String("Name"),
+			Value: aws.String(infra.Status.InfrastructureName + "-image-registry"),
+		},
+	}
+	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.AWS != nil {
+		for _, tag := range infra.Status.PlatformStatus.AWS.ResourceTags {
+			tagset = append(tagset, &s3.Tag{
+				Key:   aws.String(tag.Key),
+				Value: aws.String(tag.Value),
+			})
+		}
+	}
+	return tagset
+}
+
+// mergeTags returns the tags the bucket should have and the keys of the
+// expected tags that are missing from current or have a different value.
+// Tags of current that are not expected, e.g. added by other tools, are
+// kept.
+func mergeTags(current, expected []*s3.Tag) ([]*s3.Tag, []string) {
+	values := map[string]string{}
+	for _, tag := range current {
+		values[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	var drifted []string
+	tagset := make([]*s3.Tag, 0, len(expected)+len(current))
+	seen := map[string]bool{}
+	for _, tag := range expected {
+		key := aws.StringValue(tag.Key)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if value, ok := values[key]; !ok || value != aws.StringValue(tag.Value) {
+			drifted = append(drifted, key)
+		}
+		tagset = append(tagset, tag)
+	}
+	for _, tag := range current {
+		if !seen[aws.StringValue(tag.Key)] {
+			tagset = append(tagset, tag)
+		}
+	}
+	sort.Strings(drifted)
+	return tagset, drifted
+}
+
+// syncTags makes sure the bucket has the cluster tags and the user tags from
+// the infrastructure status. User tags change over the lifetime of a cluster,
+// e.g. when tag policies are updated, so drifted tags are reapplied every
+// time the storage is reconciled.
+func (d *driver) syncTags(cr *imageregistryv1.Config, svc s3iface.S3API, infra *configv1.Infrastructure) {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		klog.Info("ignoring bucket tags, storage is not managed")
+		return
+	}
+
+	var current []*s3.Tag
+	out, err := svc.GetBucketTaggingWithContext(d.Context, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	aerr, isAWSError := err.(awserr.Error)
+	switch {
+	case err == nil:
+		current = out.TagSet
+	case isAWSError && aerr.Code() == errCodeNoSuchTagSet:
+		// the bucket has no tags yet.
+	default:
+		// putting the expected tags would remove the tags set by
+		// other tools, the bucket is left as it is.
+		klog.Warningf("unable to get the tags of the bucket %s: %s", d.Config.Bucket, err)
+		reason := "Unknown Error Occurred"
+		if isAWSError {
+			reason = aerr.Code()
+		}
+		util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionUnknown, reason,
+			fmt.Sprintf("Unable to get the tags of the S3 bucket: %s", err))
+		return
+	}
+
+	tagset, drifted := mergeTags(current, expectedTags(infra))
+	if len(drifted) == 0 {
+		util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionTrue, "Tagging Successful", "Tags were successfully applied to the S3 bucket")
+		return
+	}
+
+	klog.V(5).Infof("tagging bucket with tags: %+v", tagset)
+	_, err = svc.PutBucketTaggingWithContext(d.Context, &s3.PutBucketTaggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Tagging: &s3.Tagging{
+			TagSet: tagset,
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+		} else {
+			util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+		}
+		return
+	}
+
+	if len(current) == 0 {
+		util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionTrue, "Tagging Successful", "Tags were successfully applied to the S3 bucket")
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionTrue, "Tags Reconciled",
+		fmt.Sprintf("Tags %s of the S3 bucket were missing or had drifted and were reapplied", strings.Join(drifted, ", ")))
+}
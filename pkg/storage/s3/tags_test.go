@@ -0,0 +1,154 @@
+package s3
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+type fakeTaggingS3 struct {
+	s3iface.S3API
+
+	tags   []*s3.Tag
+	getErr error
+	puts   int
+}
+
+func (f *fakeTaggingS3) GetBucketTaggingWithContext(ctx aws.Context, input *s3.GetBucketTaggingInput, opts ...request.Option) (*s3.GetBucketTaggingOutput, error) {
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	if f.tags == nil {
+		return nil, awserr.New(errCodeNoSuchTagSet, "The TagSet does not exist", nil)
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: f.tags}, nil
+}
+
+func (f *fakeTaggingS3) PutBucketTaggingWithContext(ctx aws.Context, input *s3.PutBucketTaggingInput, opts ...request.Option) (*s3.PutBucketTaggingOutput, error) {
+	f.puts++
+	f.tags = input.Tagging.TagSet
+	return &s3.PutBucketTaggingOutput{}, nil
+}
+
+func tagMap(tags []*s3.Tag) map[string]string {
+	m := map[string]string{}
+	for _, tag := range tags {
+		m[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return m
+}
+
+func TestSyncTags(t *testing.T) {
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "tinfra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					ResourceTags: []configv1.AWSResourceTag{
+						{Key: "cost-center", Value: "1234"},
+					},
+				},
+			},
+		},
+	}
+	expected := map[string]string{
+		"kubernetes.io/cluster/tinfra": "owned",
+		"Name":                         "tinfra-image-registry",
+		"cost-center":                  "1234",
+	}
+
+	for _, tt := range []struct {
+		name     string
+		current  []*s3.Tag
+		getErr   error
+		puts     int
+		status   operatorapi.ConditionStatus
+		reason   string
+		wantTags map[string]string
+	}{
+		{
+			name:     "untagged bucket",
+			puts:     1,
+			status:   operatorapi.ConditionTrue,
+			reason:   "Tagging Successful",
+			wantTags: expected,
+		},
+		{
+			name: "tags in sync",
+			current: []*s3.Tag{
+				{Key: aws.String("kubernetes.io/cluster/tinfra"), Value: aws.String("owned")},
+				{Key: aws.String("Name"), Value: aws.String("tinfra-image-registry")},
+				{Key: aws.String("cost-center"), Value: aws.String("1234")},
+			},
+			status:   operatorapi.ConditionTrue,
+			reason:   "Tagging Successful",
+			wantTags: expected,
+		},
+		{
+			name: "drifted user tag",
+			current: []*s3.Tag{
+				{Key: aws.String("kubernetes.io/cluster/tinfra"), Value: aws.String("owned")},
+				{Key: aws.String("Name"), Value: aws.String("tinfra-image-registry")},
+				{Key: aws.String("cost-center"), Value: aws.String("0000")},
+				{Key: aws.String("backup"), Value: aws.String("daily")},
+			},
+			puts:   1,
+			status: operatorapi.ConditionTrue,
+			reason: "Tags Reconciled",
+			wantTags: map[string]string{
+				"kubernetes.io/cluster/tinfra": "owned",
+				"Name":                         "tinfra-image-registry",
+				"cost-center":                  "1234",
+				"backup":                       "daily",
+			},
+		},
+		{
+			name: "tags unknown",
+			current: []*s3.Tag{
+				{Key: aws.String("backup"), Value: aws.String("daily")},
+			},
+			getErr: awserr.New("AccessDenied", "Access Denied", nil),
+			status: operatorapi.ConditionUnknown,
+			reason: "AccessDenied",
+			wantTags: map[string]string{
+				"backup": "daily",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeTaggingS3{tags: tt.current, getErr: tt.getErr}
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "a-bucket"}, nil)
+			drv.syncTags(cr, svc, infra)
+
+			if svc.puts != tt.puts {
+				t.Errorf("got %d tagging requests, want %d", svc.puts, tt.puts)
+			}
+			if got := tagMap(svc.tags); !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("got tags %v, want %v", got, tt.wantTags)
+			}
+
+			cond := cr.Status.Conditions[0]
+			if cond.Type != defaults.StorageTagged || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got condition %#v, want status %s and reason %q", cond, tt.status, tt.reason)
+			}
+		})
+	}
+}
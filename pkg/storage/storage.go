@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"io"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
@@ -86,6 +87,94 @@ type Driver interface {
 	// the operator to determine if the storage backend is changed and the
 	// data potentially needs to be migrated.
 	ID() string
+
+	// Capabilities returns what the storage backend supports.
+	Capabilities() util.Capabilities
+}
+
+// Endpointer is implemented by drivers whose storage endpoints can be
+// customized by the user or by the cluster infrastructure.
+type Endpointer interface {
+	// Endpoints returns the URLs of the storage endpoints the registry
+	// talks to, if they differ from the provider defaults.
+	Endpoints() ([]string, error)
+}
+
+// Planner is implemented by drivers that provision cloud resources.
+type Planner interface {
+	// PlanStorage returns the resources CreateStorage would provision for
+	// the registry config, without provisioning them.
+	PlanStorage(*imageregistryv1.Config) ([]util.PlannedResource, error)
+}
+
+// Autoscaler is implemented by drivers whose storage has a fixed capacity
+// that can be expanded.
+type Autoscaler interface {
+	// AutoscaleStorage expands the storage if its usage crossed the
+	// threshold set for the registry config. It returns a description of
+	// the expansion, or an empty string if the storage was not expanded.
+	AutoscaleStorage(*imageregistryv1.Config) (string, error)
+}
+
+// EgressVerifier is implemented by drivers whose storage firewall can
+// restrict the addresses it accepts requests from.
+type EgressVerifier interface {
+	// DeniedEgressIPs returns the IPs out of ips the storage firewall
+	// does not accept requests from, nil if the firewall accepts them all
+	// or does not restrict addresses.
+	DeniedEgressIPs(ips []string) ([]string, error)
+}
+
+// CredentialsReporter is implemented by drivers that need credentials to
+// reach the storage.
+type CredentialsReporter interface {
+	// CredentialsSource returns how the credentials used by the operator
+	// and the registry are sourced.
+	CredentialsSource() (util.CredentialsSource, error)
+}
+
+// ZonePinner is implemented by drivers whose storage can only be reached
+// from a single zone, and that can provision storage for registry replicas
+// in distinct zones.
+type ZonePinner interface {
+	// FailureDomains returns the zones the registry replicas are pinned
+	// to, the first one being the zone of the registry deployment. It
+	// returns nil if the registry is not spread across zones.
+	FailureDomains(*imageregistryv1.Config) ([]util.FailureDomain, error)
+}
+
+// ConfigStateReader is implemented by drivers that record state in the
+// registry config that their access to the storage depends on.
+type ConfigStateReader interface {
+	// ReadConfigState makes the driver use the state recorded in the
+	// registry config, e.g. the storage account key the registry uses.
+	ReadConfigState(*imageregistryv1.Config)
+}
+
+// DisruptionGater is implemented by drivers that make disruptive changes to
+// the storage, e.g. rotating the keys the registry uses, which have to wait
+// for the maintenance window.
+type DisruptionGater interface {
+	// SetDisruptionGate makes the driver call allowed before making a
+	// disruptive change, the change is deferred if it returns false.
+	SetDisruptionGate(allowed func(change string) bool)
+}
+
+// ObjectStore is implemented by drivers whose objects can be copied to
+// another storage, e.g. when the registry is moved to new storage.
+type ObjectStore interface {
+	// WalkObjects calls fn for every object held by the storage, it
+	// stops at the first error returned by fn.
+	WalkObjects(ctx context.Context, fn func(key string, size int64) error) error
+
+	// ReadObject returns the content of the object key.
+	ReadObject(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// WriteObject stores size bytes read from r as the object key.
+	WriteObject(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// DeleteObject removes the object key.
+	DeleteObject(ctx context.Context, key string) error
 }
 
 func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest.Config, listers *regopclient.StorageListers) (Driver, error) {
@@ -121,7 +210,7 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 	}
 
 	if cfg.PVC != nil {
-		drv, err := pvc.NewDriver(cfg.PVC, kubeconfig)
+		drv, err := pvc.NewDriver(cfg.PVC, kubeconfig, listers)
 		if err != nil {
 			return nil, err
 		}
@@ -152,6 +241,30 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 	return nil, &MultiStoragesError{names}
 }
 
+// StorageType returns the name of the storage type configured in cfg, or an
+// empty string if none or more than one is configured.
+func StorageType(cfg *imageregistryv1.ImageRegistryConfigStorage) string {
+	var names []string
+	for name, configured := range map[string]bool{
+		"EmptyDir": cfg.EmptyDir != nil,
+		"S3":       cfg.S3 != nil,
+		"Swift":    cfg.Swift != nil,
+		"GCS":      cfg.GCS != nil,
+		"IBMCOS":   cfg.IBMCOS != nil,
+		"PVC":      cfg.PVC != nil,
+		"Azure":    cfg.Azure != nil,
+		"OSS":      cfg.OSS != nil,
+	} {
+		if configured {
+			names = append(names, name)
+		}
+	}
+	if len(names) != 1 {
+		return ""
+	}
+	return names[0]
+}
+
 // GetPlatformStorage returns the storage configuration that should be used
 // based on the cloud platform we are running on, as determined from the
 // infrastructure configuration. Also it returns the recommend number of
@@ -0,0 +1,132 @@
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// quotaBytesMeta is the container metadata the Swift container_quotas
+	// middleware enforces.
+	quotaBytesMeta = "Quota-Bytes"
+
+	// quotaManagedMeta is the container metadata set alongside the quota
+	// when it is managed by the operator.
+	quotaManagedMeta = "Openshift-Quota-Managed"
+
+	// containerQuotaCondition reports whether the quota of the container
+	// is the one requested by the user.
+	containerQuotaCondition = "SwiftContainerQuota"
+)
+
+// Quota configures the quota of the registry container. Swift rejects the
+// uploads that would make the container exceed it, pushes fail once the
+// registry reaches its quota. The cloud has to enable the container_quotas
+// middleware.
+type Quota struct {
+	// Bytes is the maximum size of the objects in the container, set as
+	// the X-Container-Meta-Quota-Bytes metadata.
+	Bytes *resource.Quantity `json:"bytes,omitempty"`
+}
+
+// getQuota returns the quota set in the storage.swift.quota section of the
+// unsupported config overrides, or nil if there is none.
+func getQuota(cr *imageregistryv1.Config) (*Quota, error) {
+	rawoverrides := cr.Spec.UnsupportedConfigOverrides.Raw
+	if len(rawoverrides) == 0 {
+		return nil, nil
+	}
+
+	var overrides struct {
+		Storage *struct {
+			Swift *struct {
+				Quota *Quota `json:"quota,omitempty"`
+			} `json:"swift,omitempty"`
+		} `json:"storage,omitempty"`
+	}
+	if err := json.Unmarshal(rawoverrides, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid unsupportedConfigOverrides: %w", err)
+	}
+	if overrides.Storage == nil || overrides.Storage.Swift == nil || overrides.Storage.Swift.Quota == nil {
+		return nil, nil
+	}
+
+	quota := overrides.Storage.Swift.Quota
+	if quota.Bytes != nil && quota.Bytes.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid swift container quota %s: must be positive", quota.Bytes.String())
+	}
+	return quota, nil
+}
+
+// syncQuota makes sure the quota of the container matches the one requested
+// by the user. A quota previously set by the operator is removed once it is
+// no longer requested, a quota set by someone else is left untouched unless
+// the user requests another one. The quota of containers not managed by the
+// operator is only compared. It returns the quota of the container in bytes,
+// 0 if it has none.
+func (d *driver) syncQuota(cr *imageregistryv1.Config, client *gophercloud.ServiceClient, containerName string, metadata map[string]string) (int64, error) {
+	current, _ := strconv.ParseInt(metadata[quotaBytesMeta], 10, 64)
+	managed := metadata[quotaManagedMeta] == "true"
+	storageManaged := cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
+
+	quota, err := getQuota(cr)
+	if err != nil {
+		util.UpdateCondition(cr, containerQuotaCondition, operatorapi.ConditionFalse, "InvalidConfiguration", err.Error())
+		return current, err
+	}
+
+	if quota == nil || quota.Bytes == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, containerQuotaCondition)
+		if !managed || !storageManaged {
+			return current, nil
+		}
+		_, err := containers.Update(client, containerName, containers.UpdateOpts{
+			RemoveMetadata: []string{quotaBytesMeta, quotaManagedMeta},
+		}).Extract()
+		if err != nil {
+			return current, fmt.Errorf("unable to remove the quota from container %s: %v", containerName, err)
+		}
+		klog.Infof("removed the quota from swift container %s", containerName)
+		return 0, nil
+	}
+
+	bytes := quota.Bytes.Value()
+	if current == bytes && (managed || !storageManaged) {
+		util.UpdateCondition(cr, containerQuotaCondition, operatorapi.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The quota of the swift container %s is %d bytes", containerName, bytes))
+		return current, nil
+	}
+	if !storageManaged {
+		util.UpdateCondition(cr, containerQuotaCondition, operatorapi.ConditionFalse, "NotManaged",
+			fmt.Sprintf("The swift container %s is not managed by the operator, its quota of %d bytes is not set to the requested %d bytes", containerName, current, bytes))
+		return current, nil
+	}
+
+	_, err = containers.Update(client, containerName, containers.UpdateOpts{
+		Metadata: map[string]string{
+			quotaBytesMeta:   strconv.FormatInt(bytes, 10),
+			quotaManagedMeta: "true",
+		},
+	}).Extract()
+	if err != nil {
+		util.UpdateCondition(cr, containerQuotaCondition, operatorapi.ConditionFalse, "UpdateFailed",
+			fmt.Sprintf("Unable to set the quota of the swift container %s: %s", containerName, err))
+		return current, fmt.Errorf("unable to set the quota of container %s: %v", containerName, err)
+	}
+	klog.Infof("set the quota of swift container %s to %d bytes", containerName, bytes)
+	util.UpdateCondition(cr, containerQuotaCondition, operatorapi.ConditionTrue, "AsExpected",
+		fmt.Sprintf("The quota of the swift container %s is %d bytes", containerName, bytes))
+	return bytes, nil
+}
@@ -0,0 +1,133 @@
+package swift
+
+import (
+	"net/http"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/testhelper"
+
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+)
+
+func TestSwiftStorageExistsSyncsQuota(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		overrides     string
+		unmanaged     bool
+		headers       map[string]string
+		expectUpdate  bool
+		updateHeaders map[string]string
+		status        operatorapi.ConditionStatus
+	}{
+		{
+			name:    "not managed",
+			headers: map[string]string{"X-Container-Meta-Quota-Bytes": "1000"},
+		},
+		{
+			name:      "storage not managed",
+			overrides: `{"storage":{"swift":{"quota":{"bytes":"1Gi"}}}}`,
+			unmanaged: true,
+			headers:   map[string]string{"X-Container-Meta-Quota-Bytes": "1000"},
+			status:    operatorapi.ConditionFalse,
+		},
+		{
+			name:      "update failure is only reported",
+			overrides: `{"storage":{"swift":{"quota":{"bytes":"1Gi"}}}}`,
+			headers:   map[string]string{"X-Container-Meta-Quota-Bytes": "1000", "X-Fail-Update": "true"},
+			status:    operatorapi.ConditionFalse,
+		},
+		{
+			name:         "removed when no longer requested",
+			headers:      map[string]string{"X-Container-Meta-Quota-Bytes": "1000", "X-Container-Meta-Openshift-Quota-Managed": "true"},
+			expectUpdate: true,
+			updateHeaders: map[string]string{
+				"X-Remove-Container-Meta-Quota-Bytes":             "remove",
+				"X-Remove-Container-Meta-Openshift-Quota-Managed": "remove",
+			},
+		},
+		{
+			name:         "set when missing",
+			overrides:    `{"storage":{"swift":{"quota":{"bytes":"1Gi"}}}}`,
+			expectUpdate: true,
+			updateHeaders: map[string]string{
+				"X-Container-Meta-Quota-Bytes":             "1073741824",
+				"X-Container-Meta-Openshift-Quota-Managed": "true",
+			},
+			status: operatorapi.ConditionTrue,
+		},
+		{
+			name:         "replaces the quota set by the user",
+			overrides:    `{"storage":{"swift":{"quota":{"bytes":"1Gi"}}}}`,
+			headers:      map[string]string{"X-Container-Meta-Quota-Bytes": "1000"},
+			expectUpdate: true,
+			updateHeaders: map[string]string{
+				"X-Container-Meta-Quota-Bytes":             "1073741824",
+				"X-Container-Meta-Openshift-Quota-Managed": "true",
+			},
+			status: operatorapi.ConditionTrue,
+		},
+		{
+			name:      "in sync",
+			overrides: `{"storage":{"swift":{"quota":{"bytes":"1Gi"}}}}`,
+			headers:   map[string]string{"X-Container-Meta-Quota-Bytes": "1073741824", "X-Container-Meta-Openshift-Quota-Managed": "true"},
+			status:    operatorapi.ConditionTrue,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+			handleAuthentication(t, "container")
+
+			updated := false
+			th.Mux.HandleFunc("/"+container, func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "HEAD":
+					for k, v := range tt.headers {
+						w.Header().Set(k, v)
+					}
+					w.Header().Set("X-Container-Bytes-Used", "512")
+					w.Header().Set("X-Container-Object-Count", "2")
+					w.WriteHeader(http.StatusNoContent)
+				case "POST":
+					if tt.headers["X-Fail-Update"] != "" {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					updated = true
+					for k, v := range tt.updateHeaders {
+						th.TestHeader(t, r, k, v)
+					}
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected request %s", r.Method)
+				}
+			})
+
+			d, installConfig := mockConfig(false, th.Endpoint()+"v3", MockUPISecretNamespaceLister{}, !tt.unmanaged)
+			installConfig.Spec.UnsupportedConfigOverrides.Raw = []byte(tt.overrides)
+
+			res, err := d.StorageExists(&installConfig)
+			th.AssertNoErr(t, err)
+			th.AssertEquals(t, true, res)
+			th.AssertEquals(t, tt.expectUpdate, updated)
+
+			cond := v1helpers.FindOperatorCondition(installConfig.Status.Conditions, containerQuotaCondition)
+			if tt.status == "" {
+				if cond != nil {
+					t.Errorf("got condition %#v, want none", cond)
+				}
+			} else if cond == nil || cond.Status != tt.status {
+				t.Errorf("got condition %#v, want status %s", cond, tt.status)
+			}
+		})
+	}
+}
+
+func TestGetQuotaInvalid(t *testing.T) {
+	_, installConfig := mockConfig(false, "", MockUPISecretNamespaceLister{}, false)
+	installConfig.Spec.UnsupportedConfigOverrides.Raw = []byte(`{"storage":{"swift":{"quota":{"bytes":"0"}}}}`)
+	if _, err := getQuota(&installConfig); err == nil {
+		t.Errorf("expected an error for a zero quota")
+	}
+}
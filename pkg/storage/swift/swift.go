@@ -26,13 +26,26 @@ import (
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/faultinject"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
+const (
+	// tempURLKeyManagedMeta is the container metadata set alongside the
+	// temporary URL keys when they are managed by the operator.
+	tempURLKeyManagedMeta = "Openshift-Temp-Url-Key-Managed"
+
+	// tempURLKeysCondition reports whether the temporary URL keys of the
+	// container are the ones generated by the operator.
+	tempURLKeysCondition = "SwiftTempURLKeys"
+)
+
 type Swift struct {
 	AuthURL                     string
 	Username                    string
@@ -53,6 +66,9 @@ type driver struct {
 	Config *imageregistryv1.ImageRegistryConfigStorageSwift
 	// Listers are used to download OpenStack credentials from the native secret
 	Listers *regopclient.StorageListers
+
+	// roundTripper is used only during tests.
+	roundTripper http.RoundTripper
 }
 
 // replaceEmpty is a helper function to replace empty fields with another field
@@ -177,6 +193,11 @@ func GetConfig(listers *regopclient.StorageListers) (*Swift, error) {
 	return cfg, nil
 }
 
+// CredentialsSource returns how the OpenStack credentials are sourced.
+func (d *driver) CredentialsSource() (util.CredentialsSource, error) {
+	return util.GetCredentialsSource(d.Listers.Secrets, util.MintedCredentials)
+}
+
 // CABundle returns either the configured CA bundle or indicates that the
 // system trust bundle should be used instead.
 func (d *driver) CABundle() (string, bool, error) {
@@ -256,6 +277,15 @@ func (d *driver) getSwiftClient() (*gophercloud.ServiceClient, error) {
 		}
 		provider.HTTPClient = client
 	}
+	if d.roundTripper != nil {
+		provider.HTTPClient = http.Client{Transport: d.roundTripper}
+	} else {
+		transport := provider.HTTPClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		provider.HTTPClient.Transport = faultinject.Wrap("Swift", transport)
+	}
 
 	err = openstack.Authenticate(provider, *opts)
 	if err != nil {
@@ -308,6 +338,20 @@ func NewDriver(c *imageregistryv1.ImageRegistryConfigStorageSwift, listers *rego
 	}
 }
 
+// Endpoints returns the Keystone endpoint used by the registry to
+// authenticate against OpenStack.
+func (d *driver) Endpoints() ([]string, error) {
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+	authURL := replaceEmpty(d.Config.AuthURL, cfg.AuthURL)
+	if authURL == "" {
+		return nil, nil
+	}
+	return []string{authURL}, nil
+}
+
 func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 	cfg, err := GetConfig(d.Listers)
 	if err != nil {
@@ -360,9 +404,92 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_REGION", Value: regionName})
 	}
 
+	tempURLKey, _, err := d.tempURLKeys()
+	if err != nil {
+		return nil, err
+	}
+	if tempURLKey != "" {
+		envs = append(envs,
+			envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_SECRETKEY", Value: tempURLKey, Secret: true},
+			envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_TEMPURLCONTAINERKEY", Value: true},
+		)
+	}
+
 	return
 }
 
+// tempURLKeys returns the current and the previous temporary URL keys
+// generated by the operator. Empty keys are returned if the operator does not
+// manage temporary URL keys.
+func (d *driver) tempURLKeys() (string, string, error) {
+	sec, err := d.Listers.Secrets.Get(defaults.SwiftTempURLKeySecretName)
+	if apimachineryerrors.IsNotFound(err) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", fmt.Errorf("unable to get swift temporary url keys: %v", err)
+	}
+	return string(sec.Data[defaults.SwiftTempURLKey]), string(sec.Data[defaults.SwiftTempURLPreviousKey]), nil
+}
+
+// syncTempURLKeys makes sure the temporary URL keys set on the container
+// match the ones generated by the operator. Keys previously set by the
+// operator are removed once the operator no longer manages them, keys set by
+// someone else are left untouched. The keys of containers not managed by the
+// operator are only compared.
+func (d *driver) syncTempURLKeys(cr *imageregistryv1.Config, client *gophercloud.ServiceClient, containerName string, header *containers.GetHeader, metadata map[string]string) error {
+	key, previousKey, err := d.tempURLKeys()
+	if err != nil {
+		return err
+	}
+
+	managed := metadata[tempURLKeyManagedMeta] == "true"
+	storageManaged := cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
+	if key == "" {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, tempURLKeysCondition)
+		if !managed || !storageManaged {
+			return nil
+		}
+		_, err := containers.Update(client, containerName, containers.UpdateOpts{
+			RemoveMetadata: []string{"Temp-URL-Key", "Temp-URL-Key-2", tempURLKeyManagedMeta},
+		}).Extract()
+		if err != nil {
+			return fmt.Errorf("unable to remove temporary url keys from container %s: %v", containerName, err)
+		}
+		klog.Infof("removed temporary url keys from swift container %s", containerName)
+		return nil
+	}
+
+	if header.TempURLKey == key && header.TempURLKey2 == previousKey && (managed || !storageManaged) {
+		util.UpdateCondition(cr, tempURLKeysCondition, operatorapi.ConditionTrue, "AsExpected",
+			fmt.Sprintf("The swift container %s has the temporary url keys generated by the operator", containerName))
+		return nil
+	}
+	if !storageManaged {
+		util.UpdateCondition(cr, tempURLKeysCondition, operatorapi.ConditionFalse, "NotManaged",
+			fmt.Sprintf("The swift container %s is not managed by the operator, its temporary url keys are not set to the ones generated by the operator", containerName))
+		return nil
+	}
+
+	opts := containers.UpdateOpts{
+		Metadata:   map[string]string{tempURLKeyManagedMeta: "true"},
+		TempURLKey: key,
+	}
+	if previousKey != "" {
+		opts.TempURLKey2 = previousKey
+	} else {
+		opts.RemoveMetadata = []string{"Temp-URL-Key-2"}
+	}
+	if _, err := containers.Update(client, containerName, opts).Extract(); err != nil {
+		util.UpdateCondition(cr, tempURLKeysCondition, operatorapi.ConditionFalse, "UpdateFailed",
+			fmt.Sprintf("Unable to set the temporary url keys of the swift container %s: %s", containerName, err))
+		return fmt.Errorf("unable to set temporary url keys on container %s: %v", containerName, err)
+	}
+	klog.Infof("updated temporary url keys on swift container %s", containerName)
+	util.UpdateCondition(cr, tempURLKeysCondition, operatorapi.ConditionTrue, "AsExpected",
+		fmt.Sprintf("The swift container %s has the temporary url keys generated by the operator", containerName))
+	return nil
+}
+
 func ensureAuthURLHasAPIVersion(authURL, authVersion string) (string, error) {
 	authURL, err := urlx.NormalizeString(authURL)
 	if err != nil {
@@ -406,7 +533,8 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
-	err = d.containerExists(client, cr.Spec.Storage.Swift.Container)
+	result := containers.Get(client, cr.Spec.Storage.Swift.Container, containers.GetOpts{})
+	header, err := result.Extract()
 	if err != nil {
 		if serr, ok := err.(*gophercloud.ErrResourceNotFound); ok {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Storage does not exist", serr.Error())
@@ -415,8 +543,24 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown error occurred", err.Error())
 		return false, err
 	}
+	metadata, err := result.ExtractMetadata()
+	if err != nil {
+		return false, err
+	}
 
 	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Swift container Exists", "")
+
+	// the container settings are best effort, failing to sync them does
+	// not make the container unusable.
+	if err := d.syncTempURLKeys(cr, client, cr.Spec.Storage.Swift.Container, header, metadata); err != nil {
+		klog.Warningf("unable to sync the temporary url keys of the swift container: %s", err)
+	}
+	quotaBytes, err := d.syncQuota(cr, client, cr.Spec.Storage.Swift.Container, metadata)
+	if err != nil {
+		klog.Warningf("unable to sync the quota of the swift container: %s", err)
+	}
+	metrics.ReportSwiftContainerUsage(header.BytesUsed, header.ObjectCount, quotaBytes)
+
 	return true, nil
 }
 
@@ -429,6 +573,25 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
+// PlanStorage returns the container CreateStorage would create.
+func (d *driver) PlanStorage(cr *imageregistryv1.Config) ([]util.PlannedResource, error) {
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cr.Spec.Storage.Swift.Container
+	if name == "" {
+		if name, err = util.PlannedStorageName(d.Listers, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return []util.PlannedResource{
+		{Kind: "Swift container", Name: name, Region: replaceEmpty(d.Config.RegionName, cfg.RegionName)},
+	}, nil
+}
+
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	client, err := d.getSwiftClient()
 	if err != nil {
@@ -587,3 +750,12 @@ func (d *driver) VolumeSecrets() (map[string]string, error) {
 func (d *driver) ID() string {
 	return d.Config.Container
 }
+
+// Capabilities returns what Swift supports. The registry redirects clients
+// with temporary URLs.
+func (d *driver) Capabilities() util.Capabilities {
+	return util.Capabilities{
+		MultiReplica: true,
+		Redirect:     true,
+	}
+}
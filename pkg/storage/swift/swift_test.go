@@ -23,8 +23,11 @@ import (
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorapi "github.com/openshift/api/operator/v1"
 	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/httpmock"
 )
 
 const (
@@ -542,6 +545,202 @@ func TestSwiftStorageExistsNativeSecret(t *testing.T) {
 	th.AssertEquals(t, true, res)
 }
 
+func TestSwiftStorageExistsTransport(t *testing.T) {
+	rt := &httpmock.Transport{}
+	rt.Add(httpmock.Response{
+		StatusCode: http.StatusCreated,
+		Header: http.Header{
+			"Content-Type":    {"application/json"},
+			"X-Subject-Token": {"token"},
+		},
+		Body: `{
+			"token": {
+				"expires_at": "2030-10-02T13:45:00.000000Z",
+				"catalog": [{
+					"endpoints": [{
+						"url": "https://swift.example.com/v1/AUTH_tenant",
+						"interface": "public",
+						"region": "RegionOne",
+						"region_id": "RegionOne"
+					}],
+					"type": "container",
+					"name": "swift"
+				}]
+			}
+		}`,
+	})
+	rt.Add(httpmock.Response{
+		StatusCode: http.StatusNoContent,
+		Header: http.Header{
+			"X-Container-Bytes-Used":   {"100"},
+			"X-Container-Object-Count": {"4"},
+		},
+	})
+
+	d, installConfig := mockConfig(false, "https://keystone.example.com/v3", MockUPISecretNamespaceLister{}, false)
+	d.roundTripper = rt
+
+	res, err := d.StorageExists(&installConfig)
+
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, res)
+	th.AssertEquals(t, "StorageExists", installConfig.Status.Conditions[0].Type)
+	th.AssertEquals(t, operatorapi.ConditionTrue, installConfig.Status.Conditions[0].Status)
+
+	reqs := rt.Requests()
+	th.AssertEquals(t, 2, len(reqs))
+	th.AssertEquals(t, "https://keystone.example.com/v3/auth/tokens", reqs[0].URL.String())
+	th.AssertEquals(t, http.MethodHead, reqs[1].Method)
+	th.AssertEquals(t, "https://swift.example.com/v1/AUTH_tenant/"+container, reqs[1].URL.String())
+}
+
+// MockTempURLSecretNamespaceLister returns the temporary url keys secret on
+// top of the user provided credentials.
+type MockTempURLSecretNamespaceLister struct {
+	MockUPISecretNamespaceLister
+	key         string
+	previousKey string
+}
+
+func (m MockTempURLSecretNamespaceLister) Get(name string) (*corev1.Secret, error) {
+	if name == defaults.SwiftTempURLKeySecretName {
+		return &corev1.Secret{
+			Data: map[string][]byte{
+				defaults.SwiftTempURLKey:         []byte(m.key),
+				defaults.SwiftTempURLPreviousKey: []byte(m.previousKey),
+			},
+		}, nil
+	}
+	return m.MockUPISecretNamespaceLister.Get(name)
+}
+
+func TestSwiftStorageExistsSyncsTempURLKeys(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		lister        MockSecretNamespaceLister
+		unmanaged     bool
+		failUpdate    bool
+		headers       map[string]string
+		expectUpdate  bool
+		updateHeaders map[string]string
+	}{
+		{
+			name:      "storage not managed",
+			lister:    MockTempURLSecretNamespaceLister{key: "key1"},
+			unmanaged: true,
+			headers:   map[string]string{"X-Container-Meta-Temp-Url-Key": "user-key"},
+		},
+		{
+			name:       "update failure is only reported",
+			lister:     MockTempURLSecretNamespaceLister{key: "key1"},
+			failUpdate: true,
+		},
+		{
+			name:   "not managed",
+			lister: MockUPISecretNamespaceLister{},
+			headers: map[string]string{
+				"X-Container-Meta-Temp-Url-Key": "user-key",
+			},
+		},
+		{
+			name:         "removed when no longer managed",
+			lister:       MockUPISecretNamespaceLister{},
+			headers:      map[string]string{"X-Container-Meta-Temp-Url-Key": "key1", "X-Container-Meta-Openshift-Temp-Url-Key-Managed": "true"},
+			expectUpdate: true,
+			updateHeaders: map[string]string{
+				"X-Remove-Container-Meta-Temp-Url-Key":                   "remove",
+				"X-Remove-Container-Meta-Openshift-Temp-Url-Key-Managed": "remove",
+			},
+		},
+		{
+			name:         "set when missing",
+			lister:       MockTempURLSecretNamespaceLister{key: "key1"},
+			expectUpdate: true,
+			updateHeaders: map[string]string{
+				"X-Container-Meta-Temp-Url-Key":                   "key1",
+				"X-Container-Meta-Openshift-Temp-Url-Key-Managed": "true",
+			},
+		},
+		{
+			name:         "rotated",
+			lister:       MockTempURLSecretNamespaceLister{key: "key2", previousKey: "key1"},
+			headers:      map[string]string{"X-Container-Meta-Temp-Url-Key": "key1", "X-Container-Meta-Openshift-Temp-Url-Key-Managed": "true"},
+			expectUpdate: true,
+			updateHeaders: map[string]string{
+				"X-Container-Meta-Temp-Url-Key":   "key2",
+				"X-Container-Meta-Temp-Url-Key-2": "key1",
+			},
+		},
+		{
+			name:    "in sync",
+			lister:  MockTempURLSecretNamespaceLister{key: "key2", previousKey: "key1"},
+			headers: map[string]string{"X-Container-Meta-Temp-Url-Key": "key2", "X-Container-Meta-Temp-Url-Key-2": "key1", "X-Container-Meta-Openshift-Temp-Url-Key-Managed": "true"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+			handleAuthentication(t, "container")
+
+			updated := false
+			th.Mux.HandleFunc("/"+container, func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "HEAD":
+					for k, v := range tt.headers {
+						w.Header().Set(k, v)
+					}
+					w.WriteHeader(http.StatusNoContent)
+				case "POST":
+					if tt.failUpdate {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					updated = true
+					for k, v := range tt.updateHeaders {
+						th.TestHeader(t, r, k, v)
+					}
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected request %s", r.Method)
+				}
+			})
+
+			d, installConfig := mockConfig(false, th.Endpoint()+"v3", tt.lister, !tt.unmanaged)
+
+			res, err := d.StorageExists(&installConfig)
+			th.AssertNoErr(t, err)
+			th.AssertEquals(t, true, res)
+			th.AssertEquals(t, tt.expectUpdate, updated)
+			if tt.unmanaged || tt.failUpdate {
+				cond := v1helpers.FindOperatorCondition(installConfig.Status.Conditions, tempURLKeysCondition)
+				if cond == nil || cond.Status != operatorapi.ConditionFalse {
+					t.Errorf("got condition %#v, want status False", cond)
+				}
+			}
+		})
+	}
+}
+
+func TestSwiftConfigEnvTempURLKey(t *testing.T) {
+	d, _ := mockConfig(false, "http://localhost:5000/v3", MockTempURLSecretNamespaceLister{key: "key1"}, false)
+
+	configenv, err := d.ConfigEnv()
+	th.AssertNoErr(t, err)
+
+	res, err := configenv.SecretData()
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "key1", res["REGISTRY_STORAGE_SWIFT_SECRETKEY"])
+
+	found := false
+	for _, env := range configenv {
+		if env.Name == "REGISTRY_STORAGE_SWIFT_TEMPURLCONTAINERKEY" {
+			found = true
+			th.AssertEquals(t, true, env.Value)
+		}
+	}
+	th.AssertEquals(t, true, found)
+}
+
 func TestSwiftSecrets(t *testing.T) {
 	config := imageregistryv1.ImageRegistryConfigStorageSwift{
 		AuthURL:   "http://localhost:5000/v3",
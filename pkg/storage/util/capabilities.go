@@ -0,0 +1,30 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capabilities describes what a storage backend supports.
+type Capabilities struct {
+	// MultiReplica is true if several registry pods can share the storage.
+	MultiReplica bool
+	// Redirect is true if the registry can redirect clients to the
+	// storage to fetch blobs.
+	Redirect bool
+	// EncryptionAtRestConfig is true if the encryption at rest of the
+	// storage can be configured in the registry config.
+	EncryptionAtRestConfig bool
+	// Tagging is true if the operator tags the storage with the resource
+	// tags of the cluster.
+	Tagging bool
+}
+
+func (c Capabilities) String() string {
+	return strings.Join([]string{
+		fmt.Sprintf("MultiReplica=%t", c.MultiReplica),
+		fmt.Sprintf("Redirect=%t", c.Redirect),
+		fmt.Sprintf("EncryptionAtRestConfig=%t", c.EncryptionAtRestConfig),
+		fmt.Sprintf("Tagging=%t", c.Tagging),
+	}, ", ")
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// CredentialsMode is how the credentials used to reach the storage are
+// sourced.
+type CredentialsMode string
+
+const (
+	// CredentialsModeNone is used by storage that needs no credentials.
+	CredentialsModeNone CredentialsMode = "None"
+	// CredentialsModeMinted is used with long lived credentials minted
+	// by the cloud credential operator.
+	CredentialsModeMinted CredentialsMode = "Minted"
+	// CredentialsModeUserProvided is used with the credentials provided
+	// by the user in defaults.ImageRegistryPrivateConfigurationUser.
+	CredentialsModeUserProvided CredentialsMode = "UserProvided"
+	// CredentialsModeWorkloadIdentity is used with short lived credentials
+	// exchanged for the registry service account token (AWS STS, Azure
+	// and GCP workload identity federation).
+	CredentialsModeWorkloadIdentity CredentialsMode = "WorkloadIdentity"
+	// CredentialsModeNodeIdentity is used with the credentials of the
+	// identity of the node the registry runs on.
+	CredentialsModeNodeIdentity CredentialsMode = "NodeIdentity"
+)
+
+// CredentialsSource describes where the storage credentials come from.
+type CredentialsSource struct {
+	Mode CredentialsMode
+	// Secret is the name of the secret holding the credentials.
+	Secret string
+	// UpdatedAt is the last time the secret was written.
+	UpdatedAt *time.Time
+	// Expiry is the time at which the credentials expire, if known.
+	Expiry *time.Time
+}
+
+func (s CredentialsSource) String() string {
+	if s.Secret == "" {
+		return fmt.Sprintf("Mode=%s", s.Mode)
+	}
+	parts := []string{
+		fmt.Sprintf("Mode=%s", s.Mode),
+		fmt.Sprintf("Secret=%s", s.Secret),
+	}
+	if s.UpdatedAt != nil {
+		parts = append(parts, fmt.Sprintf("UpdatedAt=%s", s.UpdatedAt.UTC().Format(time.RFC3339)))
+	}
+	if s.Expiry != nil {
+		parts = append(parts, fmt.Sprintf("Expiry=%s", s.Expiry.UTC().Format(time.RFC3339)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GetCredentialsSource describes the credentials the drivers load, the ones
+// provided by the user take precedence over the ones provided by the cloud
+// credential operator. mintedMode returns the mode of the credentials found
+// in the secret provided by the cloud credential operator.
+func GetCredentialsSource(lister corelisters.SecretNamespaceLister, mintedMode func(*corev1.Secret) CredentialsMode) (CredentialsSource, error) {
+	mode := CredentialsModeUserProvided
+	sec, err := lister.Get(defaults.ImageRegistryPrivateConfigurationUser)
+	if errors.IsNotFound(err) {
+		sec, err = lister.Get(defaults.CloudCredentialsName)
+		if err != nil {
+			return CredentialsSource{}, fmt.Errorf("unable to get cluster minted credentials %q: %w", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.CloudCredentialsName), err)
+		}
+		mode = mintedMode(sec)
+	} else if err != nil {
+		return CredentialsSource{}, err
+	}
+
+	source := CredentialsSource{
+		Mode:   mode,
+		Secret: sec.Name,
+	}
+	updatedAt := sec.CreationTimestamp.Time
+	for _, f := range sec.ManagedFields {
+		if f.Time != nil && f.Time.After(updatedAt) {
+			updatedAt = f.Time.Time
+		}
+	}
+	if !updatedAt.IsZero() {
+		source.UpdatedAt = &updatedAt
+	}
+	if v, ok := sec.Annotations[defaults.CredentialsExpiryAnnotation]; ok {
+		expiry, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return CredentialsSource{}, fmt.Errorf("invalid %s annotation on secret %s: %w", defaults.CredentialsExpiryAnnotation, sec.Name, err)
+		}
+		source.Expiry = &expiry
+	}
+	return source, nil
+}
+
+// MintedCredentials is the mintedMode of GetCredentialsSource for drivers
+// that only support long lived credentials.
+func MintedCredentials(*corev1.Secret) CredentialsMode {
+	return CredentialsModeMinted
+}
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestGetCredentialsSource(t *testing.T) {
+	created := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	updated := metav1.NewTime(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	workloadIdentity := func(sec *corev1.Secret) CredentialsMode {
+		if len(sec.Data["token_file"]) > 0 {
+			return CredentialsModeWorkloadIdentity
+		}
+		return CredentialsModeMinted
+	}
+
+	for _, tc := range []struct {
+		name           string
+		secrets        []*corev1.Secret
+		expectedMode   CredentialsMode
+		expectedSecret string
+		expectedExpiry string
+		err            bool
+	}{
+		{
+			name: "minted",
+			secrets: []*corev1.Secret{
+				{ObjectMeta: metav1.ObjectMeta{Name: defaults.CloudCredentialsName}},
+			},
+			expectedMode:   CredentialsModeMinted,
+			expectedSecret: defaults.CloudCredentialsName,
+		},
+		{
+			name: "workload identity",
+			secrets: []*corev1.Secret{
+				{ObjectMeta: metav1.ObjectMeta{Name: defaults.CloudCredentialsName}, Data: map[string][]byte{"token_file": []byte("/token")}},
+			},
+			expectedMode:   CredentialsModeWorkloadIdentity,
+			expectedSecret: defaults.CloudCredentialsName,
+		},
+		{
+			name: "user provided",
+			secrets: []*corev1.Secret{
+				{ObjectMeta: metav1.ObjectMeta{Name: defaults.CloudCredentialsName}},
+				{ObjectMeta: metav1.ObjectMeta{
+					Name:        defaults.ImageRegistryPrivateConfigurationUser,
+					Annotations: map[string]string{defaults.CredentialsExpiryAnnotation: "2024-06-01T00:00:00Z"},
+				}},
+			},
+			expectedMode:   CredentialsModeUserProvided,
+			expectedSecret: defaults.ImageRegistryPrivateConfigurationUser,
+			expectedExpiry: "2024-06-01T00:00:00Z",
+		},
+		{
+			name: "invalid expiry",
+			secrets: []*corev1.Secret{
+				{ObjectMeta: metav1.ObjectMeta{
+					Name:        defaults.ImageRegistryPrivateConfigurationUser,
+					Annotations: map[string]string{defaults.CredentialsExpiryAnnotation: "June"},
+				}},
+			},
+			err: true,
+		},
+		{
+			name: "no credentials",
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, sec := range tc.secrets {
+				sec.Namespace = defaults.ImageRegistryOperatorNamespace
+				sec.CreationTimestamp = created
+				sec.ManagedFields = []metav1.ManagedFieldsEntry{{Time: &created}, {Time: &updated}}
+				if err := indexer.Add(sec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			lister := corelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace)
+
+			source, err := GetCredentialsSource(lister, workloadIdentity)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source.Mode != tc.expectedMode || source.Secret != tc.expectedSecret {
+				t.Errorf("got %s, want mode %s and secret %s", source, tc.expectedMode, tc.expectedSecret)
+			}
+			if source.UpdatedAt == nil || !source.UpdatedAt.Equal(updated.Time) {
+				t.Errorf("got updated at %v, want %s", source.UpdatedAt, updated)
+			}
+			var expiry string
+			if source.Expiry != nil {
+				expiry = source.Expiry.Format(time.RFC3339)
+			}
+			if expiry != tc.expectedExpiry {
+				t.Errorf("got expiry %q, want %q", expiry, tc.expectedExpiry)
+			}
+		})
+	}
+}
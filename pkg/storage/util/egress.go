@@ -0,0 +1,45 @@
+package util
+
+import (
+	"net"
+	"strings"
+)
+
+// DeniedIPs returns the IPs out of ips that are not allowed by a firewall
+// allowing the addresses in allowed. Allowed addresses are IPs or CIDRs,
+// invalid ones are ignored.
+func DeniedIPs(ips []string, allowed []string) []string {
+	var nets []*net.IPNet
+	for _, a := range allowed {
+		a = strings.TrimSpace(a)
+		if !strings.Contains(a, "/") {
+			if ip := net.ParseIP(a); ip != nil {
+				bits := 8 * net.IPv4len
+				if ip.To4() == nil {
+					bits = 8 * net.IPv6len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, n, err := net.ParseCIDR(a); err == nil {
+			nets = append(nets, n)
+		}
+	}
+
+	var denied []string
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		found := false
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			denied = append(denied, s)
+		}
+	}
+	return denied
+}
@@ -0,0 +1,8 @@
+package util
+
+// FailureDomain is a zone a registry replica is pinned to, along with the
+// claim holding the storage of that replica.
+type FailureDomain struct {
+	Zone  string
+	Claim string
+}
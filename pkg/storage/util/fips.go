@@ -0,0 +1,20 @@
+package util
+
+import (
+	"os"
+	"strings"
+)
+
+// fipsEnabledPath is where the kernel reports whether it runs in FIPS mode.
+// The operator runs on the cluster nodes, so it shares their FIPS mode.
+const fipsEnabledPath = "/proc/sys/crypto/fips_enabled"
+
+// FIPSEnabled returns true if the cluster runs in FIPS mode. It is a variable
+// so tests can fake the FIPS mode.
+var FIPSEnabled = func() bool {
+	data, err := os.ReadFile(fipsEnabledPath)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(data)) == "1"
+}
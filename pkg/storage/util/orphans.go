@@ -0,0 +1,49 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// installationSuffixLength is the length of the random suffix the installer
+// appends to the cluster name to form the infrastructure name.
+const installationSuffixLength = 5
+
+// InstallationPrefix returns the part of the infrastructure name derived
+// from the cluster name, i.e. without the random suffix of the installation.
+func InstallationPrefix(infrastructureName string) string {
+	i := strings.LastIndex(infrastructureName, "-")
+	if i <= 0 || len(infrastructureName)-i-1 != installationSuffixLength {
+		return infrastructureName
+	}
+	return infrastructureName[:i]
+}
+
+// PreviousInstallation returns true if other is the infrastructure name of
+// another installation of the cluster current belongs to, e.g. a failed
+// installation attempt.
+func PreviousInstallation(current, other string) bool {
+	prefix := InstallationPrefix(current)
+	otherPrefix := InstallationPrefix(other)
+	return other != current && prefix != current && otherPrefix != other && otherPrefix == prefix
+}
+
+// ReportOrphanedStorage reports with the OrphanedStorage condition the
+// storage left behind by previous installations of the cluster, or removes
+// the condition if there is none.
+func ReportOrphanedStorage(cr *imageregistryv1.Config, orphans []string) {
+	if len(orphans) == 0 {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.OrphanedStorage)
+		return
+	}
+	UpdateCondition(cr, defaults.OrphanedStorage, operatorapi.ConditionTrue, "Found", fmt.Sprintf(
+		"Storage left behind by previous installations of the cluster was found: %s. Delete it, or set the %s annotation to \"true\" to adopt it when the registry storage is created",
+		strings.Join(orphans, ", "), defaults.AdoptStorageAnnotation,
+	))
+}
@@ -0,0 +1,42 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PlannedResource describes a cloud resource a storage driver would
+// provision.
+type PlannedResource struct {
+	// Kind is the type of the resource, e.g. "S3 bucket".
+	Kind string
+	// Name is the name of the resource. Generated names end with an
+	// asterisk in place of their random suffix.
+	Name string
+	// Region is where the resource is provisioned, if it is regional.
+	Region string
+	// SKU is the pricing tier of the resource, if it has one.
+	SKU string
+	// Tags are the tags or labels the resource is created with.
+	Tags map[string]string
+}
+
+func (r PlannedResource) String() string {
+	s := fmt.Sprintf("%s %s", r.Kind, r.Name)
+	if r.Region != "" {
+		s += fmt.Sprintf(" in %s", r.Region)
+	}
+	if r.SKU != "" {
+		s += fmt.Sprintf(" (SKU %s)", r.SKU)
+	}
+	if len(r.Tags) > 0 {
+		tags := make([]string, 0, len(r.Tags))
+		for k, v := range r.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		s += fmt.Sprintf(" tagged %s", strings.Join(tags, ", "))
+	}
+	return s
+}
@@ -21,6 +21,22 @@ import (
 // multiDashes is a regexp matching multiple dashes in a sequence.
 var multiDashes = regexp.MustCompile(`-{2,}`)
 
+// DegradedError is returned by storage drivers for errors with a well known
+// cause. Reason is reported as the reason of the operator Degraded condition
+// so the cause can be told apart from generic storage errors.
+type DegradedError struct {
+	Reason string
+	Err    error
+}
+
+func (e *DegradedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DegradedError) Unwrap() error {
+	return e.Err
+}
+
 // UpdateCondition will update or add the provided condition.
 func UpdateCondition(cr *imageregistryv1.Config, conditionType string, status operatorapi.ConditionStatus, reason string, message string) {
 	found := false
@@ -77,6 +93,46 @@ func GetValueFromSecret(sec *corev1.Secret, key string) (string, error) {
 // GenerateStorageName generates a unique name for the storage
 // medium that the registry will use
 func GenerateStorageName(listers *regopclient.StorageListers, additionalInfo ...string) (string, error) {
+	name, err := storageNameBase(listers, additionalInfo...)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the length and pad or truncate as needed
+	switch {
+	case len(name) < 62:
+		padding := 62 - len(name) - 1
+		bytes := make([]byte, padding)
+		for i := 0; i < padding; i++ {
+			bytes[i] = byte(97 + rand.Intn(25)) // a=97 and z=97+25
+		}
+		name = fmt.Sprintf("%s-%s", name, string(bytes))
+	case len(name) > 62:
+		name = name[0:62]
+		if strings.HasSuffix(name, "-") {
+			name = name[0:61] + string(byte(97+rand.Intn(25)))
+		}
+	}
+
+	return strings.ToLower(name), nil
+}
+
+// PlannedStorageName returns the name GenerateStorageName would generate, with
+// its random suffix replaced by an asterisk.
+func PlannedStorageName(listers *regopclient.StorageListers, additionalInfo ...string) (string, error) {
+	name, err := storageNameBase(listers, additionalInfo...)
+	if err != nil {
+		return "", err
+	}
+	if len(name) >= 62 {
+		return strings.ToLower(name[0:62]), nil
+	}
+	return strings.ToLower(name) + "-*", nil
+}
+
+// storageNameBase returns the part of the generated storage names that is
+// derived from the cluster.
+func storageNameBase(listers *regopclient.StorageListers, additionalInfo ...string) (string, error) {
 	// Get the infrastructure name
 	infra, err := GetInfrastructure(listers.Infrastructures)
 	if err != nil {
@@ -102,23 +158,5 @@ func GenerateStorageName(listers *regopclient.StorageListers, additionalInfo ...
 	// Join the slice together with dashes, removing any occurrence of
 	// multiple dashes in a row as some cloud providers consider this
 	// invalid.
-	name := multiDashes.ReplaceAllString(strings.Join(parts, "-"), "-")
-
-	// Check the length and pad or truncate as needed
-	switch {
-	case len(name) < 62:
-		padding := 62 - len(name) - 1
-		bytes := make([]byte, padding)
-		for i := 0; i < padding; i++ {
-			bytes[i] = byte(97 + rand.Intn(25)) // a=97 and z=97+25
-		}
-		name = fmt.Sprintf("%s-%s", name, string(bytes))
-	case len(name) > 62:
-		name = name[0:62]
-		if strings.HasSuffix(name, "-") {
-			name = name[0:61] + string(byte(97+rand.Intn(25)))
-		}
-	}
-
-	return strings.ToLower(name), nil
+	return multiDashes.ReplaceAllString(strings.Join(parts, "-"), "-"), nil
 }
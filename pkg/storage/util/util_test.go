@@ -126,3 +126,22 @@ func TestGenerateStorageName(t *testing.T) {
 		})
 	}
 }
+
+func TestPreviousInstallation(t *testing.T) {
+	for _, tt := range []struct {
+		current  string
+		other    string
+		expected bool
+	}{
+		{current: "mycluster-x2k4p", other: "mycluster-a1b2c", expected: true},
+		{current: "my-cluster-x2k4p", other: "my-cluster-a1b2c", expected: true},
+		{current: "mycluster-x2k4p", other: "mycluster-x2k4p"},
+		{current: "mycluster-x2k4p", other: "othercluster-a1b2c"},
+		{current: "mycluster-x2k4p", other: "mycluster"},
+		{current: "mycluster", other: "mycluster-a1b2c"},
+	} {
+		if got := PreviousInstallation(tt.current, tt.other); got != tt.expected {
+			t.Errorf("PreviousInstallation(%q, %q) = %t, want %t", tt.current, tt.other, got, tt.expected)
+		}
+	}
+}